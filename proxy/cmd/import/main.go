@@ -0,0 +1,67 @@
+// Command import loads JSON lines exports from /api/v1/requests/export into a
+// database, skipping requests it already has, to move or merge histories:
+//
+//	go run ./cmd/import -db requests.db laptop.jsonl desktop.jsonl
+//	curl -s localhost:3001/api/v1/requests/export | go run ./cmd/import -db merged.db -
+//
+// Stop the proxy using the database first, or post the file to
+// /api/v1/requests/import instead.
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/service"
+)
+
+func main() {
+	logger := log.New(os.Stdout, "import: ", log.LstdFlags)
+
+	storageConfig := config.StorageConfig{DBPath: "requests.db"}
+	if cfg, err := config.Load(); err == nil {
+		storageConfig = cfg.Storage
+	}
+	dbPath := flag.String("db", storageConfig.DBPath, "SQLite database to import into")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		logger.Fatalf("❌ Pass the export files to import, or - for standard input")
+	}
+
+	storageConfig.DBPath = *dbPath
+	storage, err := service.NewSQLiteStorageService(&storageConfig)
+	if err != nil {
+		logger.Fatalf("❌ Failed to open %s: %v", *dbPath, err)
+	}
+
+	failed := false
+	for _, path := range flag.Args() {
+		var input io.Reader = os.Stdin
+		if path != "-" {
+			file, err := os.Open(path)
+			if err != nil {
+				logger.Fatalf("❌ Failed to open %s: %v", path, err)
+			}
+			defer file.Close()
+			input = file
+		}
+
+		summary, err := service.ImportRequests(storage, input)
+		if err != nil {
+			logger.Fatalf("❌ Failed to import %s after %d requests: %v", path, summary.Imported, err)
+		}
+		logger.Printf("📥 %s: imported %d requests, %d already stored, %d invalid", path, summary.Imported, summary.Duplicates, summary.Invalid)
+		for _, message := range summary.Errors {
+			logger.Printf("   %s", message)
+		}
+		if summary.Invalid > 0 {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -8,29 +8,51 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	// Time zones for ?tz=, as the container images don't ship a zoneinfo
+	_ "time/tzdata"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 
 	"github.com/seifghazi/claude-code-monitor/internal/config"
 	"github.com/seifghazi/claude-code-monitor/internal/handler"
+	"github.com/seifghazi/claude-code-monitor/internal/i18n"
 	"github.com/seifghazi/claude-code-monitor/internal/middleware"
 	"github.com/seifghazi/claude-code-monitor/internal/provider"
 	"github.com/seifghazi/claude-code-monitor/internal/service"
 )
 
+// version is set at build time by release builds
+var version = "dev"
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	logger := log.New(os.Stdout, "proxy: ", log.LstdFlags|log.Lshortfile)
 
 	cfg, err := config.Load()
 	if err != nil {
 		logger.Fatalf("❌ Failed to load configuration: %v", err)
 	}
+	if cfg.Storage.DataDir != "" {
+		logger.Printf("📁 Using data directory %s", cfg.Storage.DataDir)
+	}
 
 	// Initialize providers
 	providers := make(map[string]provider.Provider)
 	providers["anthropic"] = provider.NewAnthropicProvider(&cfg.Providers.Anthropic)
 	providers["openai"] = provider.NewOpenAIProvider(&cfg.Providers.OpenAI)
+	ollamaProvider := provider.NewOllamaProvider(&cfg.Providers.Ollama, logger)
+	providers["ollama"] = ollamaProvider
+	ollamaProvider.Start()
+	providers["lmstudio"] = provider.NewLMStudioProvider(&cfg.Providers.LMStudio)
+	providers["llamacpp"] = provider.NewLlamaCppProvider(&cfg.Providers.LlamaCpp)
+	providers["huggingface"] = provider.NewHuggingFaceProvider(&cfg.Providers.HuggingFace)
+	providers["cohere"] = provider.NewCohereProvider(&cfg.Providers.Cohere)
+	providers["perplexity"] = provider.NewPerplexityProvider(&cfg.Providers.Perplexity)
 
 	// Initialize model router
 	modelRouter := service.NewModelRouter(cfg, providers, logger)
@@ -38,14 +60,174 @@ func main() {
 	// Use legacy anthropic service for backward compatibility
 	anthropicService := service.NewAnthropicService(&cfg.Anthropic)
 
-	// Use SQLite storage
-	storageService, err := service.NewSQLiteStorageService(&cfg.Storage)
+	storageService, err := service.NewStorageService(&cfg.Storage)
+	if err != nil {
+		logger.Fatalf("❌ Failed to initialize storage: %v", err)
+	}
+	if cfg.Storage.Driver == "memory" {
+		logger.Println("🗿 In-memory storage ready; requests are lost when the proxy exits")
+	} else {
+		logger.Println("🗿 SQLite database ready")
+	}
+	// A read-only proxy leaves requests stored without a cost as they are
+	if !cfg.Server.ReadOnly {
+		if err := storageService.SetPrices(modelRouter.Prices()); err != nil {
+			logger.Printf("⚠️  Failed to cost stored requests: %v", err)
+		}
+	}
+
+	// Log requests from a queue so the database never holds a request up
+	var asyncStorage *service.AsyncStorage
+	if cfg.Storage.WriteQueue.Enable {
+		asyncStorage = service.NewAsyncStorage(storageService, cfg.Storage.WriteQueue, logger)
+		storageService = asyncStorage
+	}
+
+	// Message catalogs for dashboard and digest text
+	catalog, err := i18n.Load(cfg.Locale.Language, cfg.Locale.Dir, logger)
+	if err != nil {
+		logger.Fatalf("❌ Failed to load message catalogs: %v", err)
+	}
+
+	// Set up recurring tasks from the schedules config
+	scheduler := service.NewScheduler(logger)
+	scheduler.RegisterTask("prune", service.NewPruneTask(storageService))
+	scheduler.RegisterTask("purge_trash", service.NewPurgeTrashTask(storageService, cfg.Storage.TrashDays))
+	scheduler.RegisterTask("backup", service.NewBackupTask(storageService))
+	scheduler.RegisterTask("maintenance", service.NewMaintenanceTask(storageService))
+	scheduler.RegisterTask("digest", service.NewDigestTask(storageService, logger, catalog))
+	scheduler.RegisterTask("pricing_refresh", service.NewPricingRefreshTask(modelRouter.Prices()))
+	scheduler.RegisterTask("eval_suite", service.NewEvalSuiteTask(modelRouter))
+	archiver, err := service.NewArchiver(&cfg.Storage, storageService, modelRouter.Prices())
 	if err != nil {
-		logger.Fatalf("❌ Failed to initialize SQLite storage: %v", err)
+		logger.Fatalf("❌ Failed to open the archive: %v", err)
 	}
-	logger.Println("🗿 SQLite database ready")
+	if archiver.Enabled() {
+		scheduler.RegisterTask("archive", service.NewArchiveTask(archiver))
+		logger.Printf("🗄️  Archiving requests to %s", cfg.Storage.Archive.URL)
+	}
+	// A read-only proxy leaves the database as it is, so the tasks that delete,
+	// move or rewrite requests aren't scheduled
+	writeTasks := map[string]bool{"prune": true, "purge_trash": true, "archive": true, "maintenance": true}
+	purgesTrash := false
+	for _, schedule := range cfg.Schedules {
+		if cfg.Server.ReadOnly && writeTasks[schedule.Task] {
+			logger.Printf("🔒 Read-only mode: skipping schedule %s", schedule.Name)
+			continue
+		}
+		if err := scheduler.AddSchedule(schedule); err != nil {
+			logger.Printf("⚠️  Skipping schedule: %v", err)
+		}
+		purgesTrash = purgesTrash || schedule.Task == "purge_trash"
+	}
+	// Requests past the trash's grace period are purged hourly unless the
+	// schedules already do it
+	if cfg.Storage.TrashDays > 0 && !purgesTrash && !cfg.Server.ReadOnly {
+		if err := scheduler.AddSchedule(config.ScheduleConfig{Name: "purge_trash", Cron: "0 * * * *", Task: "purge_trash"}); err != nil {
+			logger.Printf("⚠️  Requests in the trash won't be purged: %v", err)
+		}
+	}
+	scheduler.Start()
 
-	h := handler.New(anthropicService, storageService, logger, modelRouter)
+	// Snapshot the routing configuration whenever it changes, so requests can
+	// be tied to the configuration they were routed under. A read-only proxy
+	// routes nothing and keeps the latest generation stored.
+	configSnapshots, err := service.NewConfigSnapshots(storageService, modelRouter, logger)
+	if err != nil {
+		logger.Fatalf("❌ Failed to load config snapshots: %v", err)
+	}
+	if !cfg.Server.ReadOnly {
+		modelRouter.OnConfigChange(func() {
+			if err := configSnapshots.Record(); err != nil {
+				logger.Printf("❌ Error recording config snapshot: %v", err)
+			}
+		})
+	}
+
+	// Rules created through the API are evaluated after the ones in config
+	storedRules, err := storageService.GetRoutingRules()
+	if err != nil {
+		logger.Printf("⚠️  Failed to load stored routing rules: %v", err)
+	} else if len(storedRules) > 0 {
+		modelRouter.SetStoredRules(storedRules)
+		logger.Printf("📐 Loaded %d routing rule(s) from the database", len(storedRules))
+	}
+	if !cfg.Server.ReadOnly {
+		if err := configSnapshots.Record(); err != nil {
+			logger.Printf("❌ Error recording config snapshot: %v", err)
+		}
+	}
+
+	// Count what was already spent today and this month against the budget,
+	// and what the subscription's open usage window has used, and pick up the
+	// rate limits the providers last reported
+	if err := modelRouter.Budget().Load(storageService); err != nil {
+		logger.Printf("⚠️  Failed to load spend for the budget: %v", err)
+	}
+	if err := modelRouter.LoadUsageWindow(storageService); err != nil {
+		logger.Printf("⚠️  Failed to load the usage window: %v", err)
+	}
+	if err := modelRouter.LoadRateLimits(storageService); err != nil {
+		logger.Printf("⚠️  Failed to load the latest rate limits: %v", err)
+	}
+
+	// Post an alert when usage crosses a threshold
+	alerter := service.NewAlerter(cfg.Alerts, cfg.Notify, storageService, modelRouter, logger)
+	if alerter.Enabled() {
+		alerter.Start()
+		logger.Printf("🚨 Checking usage alerts every %s", alerter.Interval())
+	}
+
+	// Pick up edits to .claude/agents without a restart
+	var agentWatcher *service.AgentWatcher
+	if cfg.Subagents.Enable {
+		if agentWatcher, err = service.NewAgentWatcher(modelRouter, logger); err != nil {
+			logger.Printf("⚠️  Subagent definitions won't reload on change: %v", err)
+		} else {
+			agentWatcher.Start()
+		}
+	}
+
+	routingCanary := service.NewRoutingCanary(cfg.Routing.Canary, storageService, modelRouter, logger)
+	if cfg.Routing.Canary.Enable {
+		logger.Println("🐤 Routing rule changes are canaried before reaching all traffic")
+	}
+
+	idleSessions := service.NewIdleSessionMonitor(cfg.IdleSessions, logger)
+	if idleSessions.Enabled() {
+		logger.Printf("💤 Watching for sessions running %s without a user message", idleSessions.After())
+	}
+
+	shadowMirror := service.NewShadowMirror(&cfg.Shadow, modelRouter, storageService, logger)
+
+	requestParser := service.NewRequestParser(cfg.Server.ParsingMode, logger)
+	logger.Printf("🧾 Parsing requests in %s mode", requestParser.Mode())
+	if cfg.Server.ReadOnly {
+		logger.Println("🔒 Read-only mode: serving the dashboard and analytics, refusing /v1/messages and changes to stored data")
+	}
+
+	notifier := service.NewNotifier(cfg.Notify, logger)
+	if notifier.Enabled() {
+		logger.Printf("🔔 Notifying when requests running %s or longer finish", notifier.After())
+	}
+
+	// On a shared proxy each user may only see their own requests
+	tenancy, err := service.NewTenancy(cfg.Tenancy, modelRouter)
+	if err != nil {
+		logger.Fatalf("❌ Invalid tenancy config: %v", err)
+	}
+	if tenancy.Enabled() {
+		logger.Println("🔐 Dashboard and API partitioned by user; callers must sign in with their API key")
+	}
+
+	grader, err := service.NewPromptGrader(cfg.Grading, modelRouter, storageService, logger)
+	if err != nil {
+		logger.Fatalf("❌ Invalid grading config: %v", err)
+	}
+	logger.Printf("📝 Grading prompts with %s", grader.Model())
+
+	conversations := service.NewConversationSource(cfg.Conversations, storageService, logger)
+	h := handler.New(anthropicService, storageService, conversations, logger, modelRouter, scheduler, shadowMirror, requestParser, catalog, cfg.Ingest.Token, configSnapshots, routingCanary, idleSessions, notifier, archiver, grader, tenancy, cfg.Server.ReadOnly)
 
 	r := mux.NewRouter()
 
@@ -56,6 +238,8 @@ func main() {
 	)
 
 	r.Use(middleware.Logging)
+	r.Use(h.Tenancy)
+	r.Use(h.ReadOnly)
 
 	r.HandleFunc("/v1/chat/completions", h.ChatCompletions).Methods("POST")
 	r.HandleFunc("/v1/messages", h.Messages).Methods("POST")
@@ -64,31 +248,110 @@ func main() {
 
 	r.HandleFunc("/", h.UI).Methods("GET")
 	r.HandleFunc("/ui", h.UI).Methods("GET")
-	r.HandleFunc("/api/requests", h.GetRequests).Methods("GET")
-	r.HandleFunc("/api/requests", h.DeleteRequests).Methods("DELETE")
-	r.HandleFunc("/api/conversations", h.GetConversations).Methods("GET")
-	r.HandleFunc("/api/conversations/{id}", h.GetConversationByID).Methods("GET")
-	r.HandleFunc("/api/conversations/project", h.GetConversationsByProject).Methods("GET")
+	if h.HasEmbeddedUI() {
+		r.PathPrefix("/assets/").HandlerFunc(h.UI).Methods("GET")
+		r.HandleFunc("/routing", h.UI).Methods("GET")
+		r.HandleFunc("/{file:[^/]+\\.[a-z]+}", h.UI).Methods("GET")
+	}
+	api := r.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/openapi.json", h.GetAPISpec(r)).Methods("GET")
+	api.HandleFunc("/requests", h.GetRequests).Methods("GET")
+	api.HandleFunc("/requests", h.DeleteRequests).Methods("DELETE")
+	api.HandleFunc("/requests/search", h.SearchRequests).Methods("GET")
+	api.HandleFunc("/requests/export", h.ExportRequests).Methods("GET")
+	api.HandleFunc("/requests/compare", h.CompareRequests).Methods("GET")
+	api.HandleFunc("/requests/import", h.ImportRequests).Methods("POST")
+	api.HandleFunc("/requests/{id}", h.GetRequest).Methods("GET")
+	api.HandleFunc("/requests/{id}/chunks", h.GetRequestChunks).Methods("GET")
+	api.HandleFunc("/requests/{id}/tags", h.AddRequestTags).Methods("POST")
+	api.HandleFunc("/requests/{id}/tags/{tag}", h.RemoveRequestTag).Methods("DELETE")
+	api.HandleFunc("/tags", h.GetTags).Methods("GET")
+	api.HandleFunc("/requests/{id}/grade", h.GradeRequest).Methods("POST")
+	api.HandleFunc("/requests/{id}/grade", h.GetRequestGrade).Methods("GET")
+	api.HandleFunc("/grading/jobs", h.StartGradingJob).Methods("POST")
+	api.HandleFunc("/grading/jobs", h.GetGradingJobs).Methods("GET")
+	api.HandleFunc("/grading/jobs/{id}", h.GetGradingJob).Methods("GET")
+	api.HandleFunc("/grading/jobs/{id}", h.CancelGradingJob).Methods("DELETE")
+	api.HandleFunc("/requests/{id}/star", h.StarRequest).Methods("PUT", "DELETE")
+	api.HandleFunc("/requests/{id}/note", h.SetRequestNote).Methods("PUT")
+	api.HandleFunc("/trash", h.GetTrash).Methods("GET")
+	api.HandleFunc("/trash", h.PurgeTrash).Methods("DELETE")
+	api.HandleFunc("/trash/restore", h.RestoreRequests).Methods("POST")
+	api.HandleFunc("/conversations", h.GetConversations).Methods("GET")
+	api.HandleFunc("/conversations/{id}", h.GetConversationByID).Methods("GET")
+	api.HandleFunc("/conversations/project", h.GetConversationsByProject).Methods("GET")
+	api.HandleFunc("/conversations/{id}/report", h.AnalyzeConversation).Methods("POST")
+	api.HandleFunc("/conversations/{id}/report", h.GetConversationReport).Methods("GET")
+	api.HandleFunc("/streams", h.GetStreams).Methods("GET")
+	api.HandleFunc("/streams/{id}", h.WatchStream).Methods("GET")
+	r.HandleFunc("/ws/requests", h.WatchRequests).Methods("GET")
+	api.HandleFunc("/events", h.StreamEvents).Methods("GET")
+	api.HandleFunc("/stats", h.GetStats).Methods("GET")
+	api.HandleFunc("/stats/burn-rate", h.GetBurnRate).Methods("GET")
+	api.HandleFunc("/budget", h.GetBudget).Methods("GET")
+	api.HandleFunc("/usage/window", h.GetUsageWindow).Methods("GET")
+	api.HandleFunc("/usage/ratelimits", h.GetRateLimits).Methods("GET")
+	api.HandleFunc("/stats/summary", h.GetStatsSummary).Methods("GET")
+	api.HandleFunc("/stats/sessions", h.GetSessionUsage).Methods("GET")
+	api.HandleFunc("/stats/costs", h.GetCosts).Methods("GET")
+	api.HandleFunc("/stats/errors", h.GetErrorSeries).Methods("GET")
+	api.HandleFunc("/stats/heatmap", h.GetHeatmap).Methods("GET")
+	api.HandleFunc("/stats/grades", h.GetGradeTrends).Methods("GET")
+	api.HandleFunc("/stats/models/compare", h.CompareModels).Methods("GET")
+	api.HandleFunc("/stats/clients", h.GetClientStats).Methods("GET")
+	api.HandleFunc("/measure/start", h.StartMeasurement).Methods("POST")
+	api.HandleFunc("/measure/stop", h.StopMeasurement).Methods("POST")
+	api.HandleFunc("/measure/{id}", h.GetMeasurement).Methods("GET")
+	api.HandleFunc("/storage/stats", h.GetStorageStats).Methods("GET")
+	api.HandleFunc("/storage/maintenance", h.MaintainStorage).Methods("POST")
+	api.HandleFunc("/reports/sla", h.GetSLAReport).Methods("GET")
+	api.HandleFunc("/summary.txt", h.GetSummaryText).Methods("GET")
+	api.HandleFunc("/export/anonymized", h.ExportAnonymized).Methods("GET")
+	api.HandleFunc("/ingest/usage", h.IngestUsage).Methods("POST")
+	api.HandleFunc("/schema/unknown-fields", h.GetUnknownFields).Methods("GET")
+	api.HandleFunc("/meta/schema", h.GetMetaSchema).Methods("GET")
+	api.HandleFunc("/schedules", h.GetSchedules).Methods("GET")
+	api.HandleFunc("/quotas", h.GetQuotas).Methods("GET")
+	api.HandleFunc("/providers/health", h.GetProviderHealth).Methods("GET")
+	api.HandleFunc("/providers/keys", h.GetProviderKeys).Methods("GET")
+	api.HandleFunc("/config/snapshots", h.GetConfigSnapshots).Methods("GET")
+	api.HandleFunc("/config/snapshots/{generation}", h.GetConfigSnapshot).Methods("GET")
+	api.HandleFunc("/experiments", h.GetExperiments).Methods("GET")
+	api.HandleFunc("/shadow", h.GetShadow).Methods("GET")
+	api.HandleFunc("/shadow", h.SetShadow).Methods("PUT")
+	api.HandleFunc("/routing/rules", h.GetRoutingRules).Methods("GET")
+	api.HandleFunc("/routing/rules", h.CreateRoutingRule).Methods("POST")
+	api.HandleFunc("/routing/rules/{id}", h.UpdateRoutingRule).Methods("PUT")
+	api.HandleFunc("/routing/rules/{id}", h.DeleteRoutingRule).Methods("DELETE")
+	api.HandleFunc("/routing/canary", h.GetRoutingCanary).Methods("GET")
+	api.HandleFunc("/routing/canary/promote", h.PromoteRoutingCanary).Methods("POST")
+	api.HandleFunc("/routing/canary/rollback", h.RollbackRoutingCanary).Methods("POST")
+	api.HandleFunc("/sessions/active", h.GetActiveSessions).Methods("GET")
+	api.HandleFunc("/sessions/idle", h.GetIdleSessions).Methods("GET")
+	api.HandleFunc("/sessions/idle/{id}/resume", h.ResumeIdleSession).Methods("POST")
+	api.HandleFunc("/sessions/{id}/requests", h.GetSessionRequests).Methods("GET")
+	api.HandleFunc("/archive/requests/{id}", h.GetArchivedRequest).Methods("GET")
 
 	r.NotFoundHandler = http.HandlerFunc(h.NotFound)
 
 	srv := &http.Server{
 		Addr:         ":" + cfg.Server.Port,
-		Handler:      corsHandler(r),
+		Handler:      corsHandler(h.VersionedAPI(r)),
 		ReadTimeout:  cfg.Server.ReadTimeout,
 		WriteTimeout: cfg.Server.WriteTimeout,
 		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
 
 	go func() {
-		logger.Printf("🚀 Claude Code Monitor Server running on http://localhost:%s", cfg.Server.Port)
+		logger.Printf("🚀 Claude Code Monitor Server %s running on http://localhost:%s", version, cfg.Server.Port)
 		logger.Printf("📡 API endpoints available at:")
 		logger.Printf("   - POST http://localhost:%s/v1/messages (Anthropic format)", cfg.Server.Port)
 		logger.Printf("   - GET  http://localhost:%s/v1/models", cfg.Server.Port)
 		logger.Printf("   - GET  http://localhost:%s/health", cfg.Server.Port)
 		logger.Printf("🎨 Web UI available at:")
 		logger.Printf("   - GET  http://localhost:%s/ (Request Visualizer)", cfg.Server.Port)
-		logger.Printf("   - GET  http://localhost:%s/api/requests (Request API)", cfg.Server.Port)
+		logger.Printf("   - GET  http://localhost:%s/api/v1/requests (Request API)", cfg.Server.Port)
+		logger.Printf("   - GET  http://localhost:%s/api/v1/openapi.json (API reference)", cfg.Server.Port)
 
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.Fatalf("❌ Server failed to start: %v", err)
@@ -108,5 +371,16 @@ func main() {
 		logger.Fatalf("❌ Server forced to shutdown: %v", err)
 	}
 
+	scheduler.Stop()
+	alerter.Stop()
+	ollamaProvider.Stop()
+	if agentWatcher != nil {
+		agentWatcher.Stop()
+	}
+	if asyncStorage != nil {
+		asyncStorage.Close()
+		logger.Println("💾 Stored queued request logs")
+	}
+
 	logger.Println("✅ Server exited")
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	_ "github.com/lib/pq"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/service"
+)
+
+// runMigrate is the migrate subcommand, which copies the requests of a SQLite
+// database into Postgres, keeping their IDs and timestamps:
+//
+//	claude-code-proxy migrate --from sqlite --to postgres \
+//		-db requests.db -dsn postgres://monitor@localhost/monitor
+//
+// It only copies data: the proxy itself keeps storing requests in SQLite.
+// Progress is committed with every batch, so an interrupted migration picks up
+// where it stopped when run again. Stop the proxy using the database first.
+func runMigrate(args []string) {
+	logger := log.New(os.Stdout, "migrate: ", log.LstdFlags)
+
+	storageConfig := config.StorageConfig{DBPath: "requests.db"}
+	if cfg, err := config.Load(); err == nil {
+		storageConfig = cfg.Storage
+	}
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: claude-code-proxy migrate --from sqlite --to postgres -dsn <connection string>")
+		fmt.Fprintln(flags.Output(), "Copies the stored requests into Postgres; the proxy keeps storing in SQLite.")
+		flags.PrintDefaults()
+	}
+	from := flags.String("from", "sqlite", "Storage to copy from, only sqlite")
+	to := flags.String("to", "postgres", "Database to copy into, only postgres")
+	dbPath := flags.String("db", storageConfig.DBPath, "SQLite database to copy from")
+	dsn := flags.String("dsn", os.Getenv("DATABASE_URL"), "Postgres connection string, by default $DATABASE_URL")
+	batchSize := flags.Int("batch", 500, "Requests copied per transaction")
+	flags.Parse(args)
+
+	if *from != "sqlite" || *to != "postgres" {
+		logger.Fatalf("❌ Only --from sqlite --to postgres is supported")
+	}
+	if *dsn == "" {
+		logger.Fatalf("❌ Pass the Postgres connection string with -dsn or DATABASE_URL")
+	}
+
+	storageConfig.DBPath = *dbPath
+	storage, err := service.NewSQLiteStorageService(&storageConfig)
+	if err != nil {
+		logger.Fatalf("❌ Failed to open %s: %v", *dbPath, err)
+	}
+	dst, err := sql.Open("postgres", *dsn)
+	if err != nil {
+		logger.Fatalf("❌ Failed to open Postgres: %v", err)
+	}
+	defer dst.Close()
+
+	// Progress is kept per source database, so the same Postgres database can
+	// take several
+	source, err := filepath.Abs(*dbPath)
+	if err != nil {
+		logger.Fatalf("❌ Failed to resolve %s: %v", *dbPath, err)
+	}
+	progress, err := service.MigrateToPostgres(storage, dst, source, *batchSize, func(progress service.MigrationProgress) {
+		logger.Printf("📦 %d of %d requests copied", progress.Copied, progress.Total)
+	})
+	if err != nil {
+		logger.Fatalf("❌ Migration stopped after %d of %d requests, run again to resume: %v", progress.Copied, progress.Total, err)
+	}
+	logger.Printf("✅ Copied %d requests into Postgres", progress.Copied)
+}
@@ -0,0 +1,98 @@
+// Command sandbox fills a database with synthetic Claude Code traffic, for
+// working on the dashboard or integrations without real prompts:
+//
+//	go run ./cmd/sandbox -db sandbox.db -sessions 200
+//	DB_PATH=sandbox.db go run ./cmd/proxy
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/service"
+)
+
+func main() {
+	logger := log.New(os.Stdout, "sandbox: ", log.LstdFlags)
+	defaults := service.DefaultSyntheticOptions()
+
+	dbPath := flag.String("db", "sandbox.db", "SQLite database to fill")
+	appendData := flag.Bool("append", false, "add to a database that already has requests")
+	sessions := flag.Int("sessions", defaults.Sessions, "conversations to generate")
+	maxTurns := flag.Int("max-turns", defaults.MaxTurns, "most requests in one conversation")
+	days := flag.Int("days", defaults.Days, "spread sessions over the last this many days")
+	models := flag.String("models", formatModels(defaults.Models), "requested models and their weights, as model=weight,...")
+	errorRate := flag.Float64("error-rate", defaults.ErrorRate, "share of requests that fail")
+	streamRate := flag.Float64("stream-rate", defaults.StreamRate, "share of requests that stream")
+	subagentRate := flag.Float64("subagent-rate", defaults.SubagentRate, "share of sessions that are subagents")
+	seed := flag.Int64("seed", defaults.Seed, "random seed; the same seed produces the same data")
+	flag.Parse()
+
+	opts := service.SyntheticOptions{
+		Sessions:     *sessions,
+		MaxTurns:     *maxTurns,
+		Days:         *days,
+		ErrorRate:    *errorRate,
+		StreamRate:   *streamRate,
+		SubagentRate: *subagentRate,
+		Seed:         *seed,
+	}
+	var err error
+	if opts.Models, err = parseModels(*models); err != nil {
+		logger.Fatalf("❌ Invalid -models: %v", err)
+	}
+
+	storage, err := service.NewSQLiteStorageService(&config.StorageConfig{DBPath: *dbPath})
+	if err != nil {
+		logger.Fatalf("❌ Failed to open %s: %v", *dbPath, err)
+	}
+
+	// Refuse to mix synthetic requests into a database with real ones by accident
+	if _, total, err := storage.GetRequests(1, 1); err != nil {
+		logger.Fatalf("❌ Failed to read %s: %v", *dbPath, err)
+	} else if total > 0 && !*appendData {
+		logger.Fatalf("❌ %s already has %d requests; pass -append to add to it", *dbPath, total)
+	}
+
+	summary, err := service.GenerateSynthetic(storage, opts)
+	if err != nil {
+		logger.Fatalf("❌ Failed to generate synthetic data: %v", err)
+	}
+	logger.Printf("🧪 Wrote %d requests (%d errors) in %d sessions to %s", summary.Requests, summary.Errors, summary.Sessions, *dbPath)
+	logger.Printf("   Start the proxy on it with DB_PATH=%s", *dbPath)
+}
+
+func parseModels(value string) (map[string]int, error) {
+	models := make(map[string]int)
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, weight, found := strings.Cut(entry, "=")
+		if !found {
+			models[name] = 1
+			continue
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil {
+			return nil, fmt.Errorf("weight of %s: %w", name, err)
+		}
+		models[name] = w
+	}
+	return models, nil
+}
+
+func formatModels(models map[string]int) string {
+	var entries []string
+	for name, weight := range models {
+		entries = append(entries, fmt.Sprintf("%s=%d", name, weight))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
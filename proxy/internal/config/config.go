@@ -1,9 +1,12 @@
 package config
 
 import (
+	_ "embed"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -11,16 +14,42 @@ import (
 )
 
 type Config struct {
-	Server    ServerConfig    `yaml:"server"`
-	Providers ProvidersConfig `yaml:"providers"`
-	Storage   StorageConfig   `yaml:"storage"`
-	Subagents SubagentsConfig `yaml:"subagents"`
-	Anthropic AnthropicConfig
+	Server        ServerConfig           `yaml:"server"`
+	Providers     ProvidersConfig        `yaml:"providers"`
+	Storage       StorageConfig          `yaml:"storage"`
+	Subagents     SubagentsConfig        `yaml:"subagents"`
+	Routing       RoutingConfig          `yaml:"routing"`
+	Quotas        map[string]QuotaConfig `yaml:"quotas"`
+	Schedules     []ScheduleConfig       `yaml:"schedules"`
+	Experiments   []ExperimentConfig     `yaml:"experiments"`
+	Shadow        ShadowConfig           `yaml:"shadow"`
+	Locale        LocaleConfig           `yaml:"locale"`
+	Ingest        IngestConfig           `yaml:"ingest"`
+	Pricing       map[string]PriceConfig `yaml:"pricing"`
+	Budget        BudgetConfig           `yaml:"budget"`
+	UsageWindow   UsageWindowConfig      `yaml:"usage_window"`
+	IdleSessions  IdleSessionsConfig     `yaml:"idle_sessions"`
+	Notify        NotifyConfig           `yaml:"notify"`
+	Alerts        AlertsConfig           `yaml:"alerts"`
+	SLA           SLAConfig              `yaml:"sla"`
+	Users         []UserPolicyConfig     `yaml:"users"`
+	Tenancy       TenancyConfig          `yaml:"tenancy"`
+	Conversations ConversationsConfig    `yaml:"conversations"`
+	Grading       GradingConfig          `yaml:"grading"`
+	Anthropic     AnthropicConfig
 }
 
+// ServerConfig configures the HTTP server. ParsingMode decides what happens to
+// /v1/messages bodies the proxy's models can't fully represent: "lenient"
+// (default) logs them and forwards them untouched, "strict" rejects them with a
+// 400 describing every unknown field and mistyped value. With ReadOnly, the
+// dashboard and analytics are served but /v1/messages and the API routes that
+// change stored data are refused.
 type ServerConfig struct {
-	Port     string         `yaml:"port"`
-	Timeouts TimeoutsConfig `yaml:"timeouts"`
+	Port        string         `yaml:"port"`
+	Timeouts    TimeoutsConfig `yaml:"timeouts"`
+	ParsingMode string         `yaml:"parsing_mode"`
+	ReadOnly    bool           `yaml:"read_only"`
 	// Legacy fields
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
@@ -34,19 +63,100 @@ type TimeoutsConfig struct {
 }
 
 type ProvidersConfig struct {
-	Anthropic AnthropicProviderConfig `yaml:"anthropic"`
-	OpenAI    OpenAIProviderConfig    `yaml:"openai"`
+	Anthropic   AnthropicProviderConfig   `yaml:"anthropic"`
+	OpenAI      OpenAIProviderConfig      `yaml:"openai"`
+	Ollama      OllamaProviderConfig      `yaml:"ollama"`
+	LMStudio    LocalProviderConfig       `yaml:"lmstudio"`
+	LlamaCpp    LocalProviderConfig       `yaml:"llamacpp"`
+	HuggingFace HuggingFaceProviderConfig `yaml:"huggingface"`
+	Cohere      OpenAIProviderConfig      `yaml:"cohere"`
+	Perplexity  OpenAIProviderConfig      `yaml:"perplexity"`
 }
 
+// AnthropicProviderConfig configures the Anthropic upstream. Set UpstreamProxy
+// when BaseURL is another Anthropic-compatible proxy (a second instance of this
+// proxy, LiteLLM, ...): the anthropic-version default is left to that proxy and
+// a hop count is sent so chains that loop are caught. AuthMode decides which
+// credentials go upstream: "passthrough" (default) forwards the client's,
+// "api_key" and "bearer" replace them with APIKey (or rotate across APIKeys),
+// and "none" strips them.
 type AnthropicProviderConfig struct {
-	BaseURL    string `yaml:"base_url"`
-	Version    string `yaml:"version"`
-	MaxRetries int    `yaml:"max_retries"`
+	BaseURL        string `yaml:"base_url"`
+	Version        string `yaml:"version"`
+	MaxRetries     int    `yaml:"max_retries"`
+	InitialBackoff string `yaml:"initial_backoff"`
+	MaxBackoff     string `yaml:"max_backoff"`
+	UpstreamProxy  bool   `yaml:"upstream_proxy"`
+	AuthMode       string `yaml:"auth_mode"`
+	APIKey         string `yaml:"api_key"`
+
+	APIKeys []APIKeyConfig `yaml:"api_keys"` // used instead of APIKey when set
 }
 
 type OpenAIProviderConfig struct {
-	BaseURL string `yaml:"base_url"`
-	APIKey  string `yaml:"api_key"`
+	BaseURL        string `yaml:"base_url"`
+	APIKey         string `yaml:"api_key"`
+	MaxRetries     int    `yaml:"max_retries"`
+	InitialBackoff string `yaml:"initial_backoff"`
+	MaxBackoff     string `yaml:"max_backoff"`
+
+	APIKeys []APIKeyConfig `yaml:"api_keys"` // used instead of APIKey when set
+}
+
+// APIKeyConfig is one of several keys a provider spreads requests across.
+// Keys are picked by weighted round-robin (equal weights take turns), and a key
+// that is rate limited sits out until its Retry-After has passed.
+type APIKeyConfig struct {
+	Name   string `yaml:"name"`
+	Key    string `yaml:"key"`
+	Weight int    `yaml:"weight"` // default 1
+}
+
+// OllamaProviderConfig configures a local Ollama server. Models are routed to it
+// with an "ollama/" prefix (e.g. "ollama/qwen2.5-coder:32b"). When Enable is set
+// the proxy polls the server and falls back to FallbackModel (or the originally
+// requested model) while it is unreachable, busy, or missing the model.
+type OllamaProviderConfig struct {
+	OpenAIProviderConfig `yaml:",inline"`
+	Enable               bool     `yaml:"enable"`
+	Models               []string `yaml:"models"`
+	PrePull              bool     `yaml:"pre_pull"`
+	PollInterval         string   `yaml:"poll_interval"`
+	MaxConcurrent        int      `yaml:"max_concurrent"`
+	RequireLoaded        bool     `yaml:"require_loaded"`
+	FallbackModel        string   `yaml:"fallback_model"`
+}
+
+// LocalProviderConfig configures an OpenAI-compatible local server such as LM
+// Studio ("lmstudio/" model prefix) or llama.cpp's llama-server ("llamacpp/").
+// ContextSize overrides the context window detected from the server. Overflow
+// decides what happens to requests that don't fit: "reject" (default) returns
+// Anthropic's "prompt is too long" error, "trim" drops the oldest turns, and
+// "fallback" reroutes to FallbackModel (or the originally requested model).
+type LocalProviderConfig struct {
+	OpenAIProviderConfig `yaml:",inline"`
+	ContextSize          int    `yaml:"context_size"`
+	Overflow             string `yaml:"overflow"`
+	FallbackModel        string `yaml:"fallback_model"`
+}
+
+// HuggingFaceProviderConfig configures Hugging Face Inference Endpoints serving
+// TGI's Messages API. Each endpoint hosts one model and is addressed as
+// "hf/<name>", where name is its key in Endpoints.
+type HuggingFaceProviderConfig struct {
+	Token          string                      `yaml:"token"`
+	MaxRetries     int                         `yaml:"max_retries"`
+	InitialBackoff string                      `yaml:"initial_backoff"`
+	MaxBackoff     string                      `yaml:"max_backoff"`
+	Endpoints      map[string]HFEndpointConfig `yaml:"endpoints"`
+}
+
+// HFEndpointConfig is one Inference Endpoint and what its model supports
+type HFEndpointConfig struct {
+	URL              string `yaml:"url"`
+	Tools            bool   `yaml:"tools"`             // model handles tool definitions; otherwise they are dropped
+	DisableSystem    bool   `yaml:"disable_system"`    // chat template rejects the system role
+	DisableStreaming bool   `yaml:"disable_streaming"` // fetch whole responses and replay them as a stream
 }
 
 type AnthropicConfig struct {
@@ -55,14 +165,437 @@ type AnthropicConfig struct {
 	MaxRetries int
 }
 
+// StorageConfig says where requests are stored. DataDir is set from the
+// DATA_DIR environment variable: the directory is created on first run with a
+// starter config.yaml, config.yaml is read from it, and a relative DBPath is
+// resolved inside it. Driver is "sqlite" (the default) or "memory", which
+// keeps requests only until the proxy exits, for demos and tests; it's also
+// settable with STORAGE_DRIVER.
+//
+// Request bodies and responses of at least CompressMinBytes are stored
+// gzip-compressed; 0 stores everything as plain JSON. With an EncryptionKey,
+// a base64 AES-256 key also settable with STORAGE_ENCRYPTION_KEY, they're
+// encrypted with AES-GCM as well. Unless they're encrypted, the system
+// prompt, tool definitions and messages of request bodies of at least
+// DedupMinBytes are stored once and shared by the requests repeating them; 0
+// turns that off. Those of at least BlobMinBytes are kept as
+// files in BlobDir (a "blobs" directory next to the database by default), with
+// only a reference and a preview in the database; 0 keeps everything in it.
+//
+// Requests deleted through the API are moved to the trash, from which they
+// can be restored for TrashDays (default 7) before they're purged; 0 deletes
+// them right away. It's also settable with STORAGE_TRASH_DAYS.
+//
+// ReadOnly follows the server's read-only mode: reads then don't fill in the
+// caches kept in the database, such as the daily usage sums.
 type StorageConfig struct {
-	RequestsDir string `yaml:"requests_dir"`
-	DBPath      string `yaml:"db_path"`
+	Driver           string           `yaml:"driver"`
+	RequestsDir      string           `yaml:"requests_dir"`
+	DBPath           string           `yaml:"db_path"`
+	CompressMinBytes int              `yaml:"compress_min_bytes"`
+	EncryptionKey    string           `yaml:"encryption_key"`
+	DedupMinBytes    int              `yaml:"dedup_min_bytes"`
+	BlobMinBytes     int              `yaml:"blob_min_bytes"`
+	BlobDir          string           `yaml:"blob_dir"`
+	TrashDays        int              `yaml:"trash_days"`
+	SQLite           SQLiteConfig     `yaml:"sqlite"`
+	WriteQueue       WriteQueueConfig `yaml:"write_queue"`
+	Archive          ArchiveConfig    `yaml:"archive"`
+	DataDir          string           `yaml:"-"`
+	ReadOnly         bool             `yaml:"-"`
 }
 
+// SQLiteConfig tunes the database file; unset fields keep SQLite's defaults.
+// CacheSizeKB is the page cache of each connection, MmapSizeMB how much of the
+// file reads may map into memory, and Synchronous ("off", "normal", "full" or
+// "extra") how often writes wait for the disk. JournalMode "wal" lets the
+// dashboard read while requests are being logged.
+type SQLiteConfig struct {
+	CacheSizeKB int    `yaml:"cache_size_kb"`
+	MmapSizeMB  int    `yaml:"mmap_size_mb"`
+	Synchronous string `yaml:"synchronous"`
+	JournalMode string `yaml:"journal_mode"`
+}
+
+// WriteQueueConfig queues request logging so it doesn't slow requests down:
+// up to Size writes wait to be stored in batches of at most BatchSize. When
+// the queue is full, requests wait for room rather than lose their logs.
+type WriteQueueConfig struct {
+	Enable    bool `yaml:"enable"`
+	Size      int  `yaml:"size"`
+	BatchSize int  `yaml:"batch_size"`
+}
+
+// ArchiveConfig is the bucket the "archive" task moves old requests to, as
+// gzip-compressed JSON lines: URL is s3://bucket/prefix or gs://bucket/prefix.
+// Endpoint points s3:// URLs at an S3-compatible service such as MinIO; gs://
+// uses Cloud Storage's S3-compatible API with HMAC keys. The keys may also be
+// set with ARCHIVE_ACCESS_KEY_ID and ARCHIVE_SECRET_ACCESS_KEY, or AWS's
+// variables. Requests older than AfterDays (default 90) are archived.
+type ArchiveConfig struct {
+	URL             string `yaml:"url"`
+	Endpoint        string `yaml:"endpoint"`
+	Region          string `yaml:"region"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	AfterDays       int    `yaml:"after_days"`
+}
+
+// SubagentsConfig maps Claude Code subagents to models. Detection lists how
+// requests are recognized as coming from a mapped agent, tried in order:
+// "hash" (exact hash of the agent's prompt, the default), "prefix" (the first
+// PrefixLength characters of the prompt, ignoring whitespace), and
+// "subagent_type" (the Task tool call that started the agent, matched on the
+// agent's frontmatter name).
+//
+// A mapping is either just the target model or a model with a canary_percent,
+// the share of the agent's sessions sent to it while the rest keep the
+// requested model; CanaryPercent holds those shares by agent.
 type SubagentsConfig struct {
-	Enable   bool              `yaml:"enable"`
-	Mappings map[string]string `yaml:"mappings"`
+	Enable        bool              `yaml:"enable"`
+	Mappings      map[string]string `yaml:"-"`
+	CanaryPercent map[string]int    `yaml:"-"`
+	Detection     []string          `yaml:"detection"`
+	PrefixLength  int               `yaml:"prefix_length"`
+}
+
+// subagentMapping is one entry of subagents.mappings in config.yaml
+type subagentMapping struct {
+	Model         string `yaml:"model"`
+	CanaryPercent int    `yaml:"canary_percent"`
+}
+
+func (m *subagentMapping) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&m.Model)
+	}
+	type plain subagentMapping
+	return value.Decode((*plain)(m))
+}
+
+func (c *SubagentsConfig) UnmarshalYAML(value *yaml.Node) error {
+	type plain SubagentsConfig
+	if err := value.Decode((*plain)(c)); err != nil {
+		return err
+	}
+
+	var raw struct {
+		Mappings map[string]subagentMapping `yaml:"mappings"`
+	}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	if raw.Mappings == nil {
+		return nil
+	}
+	c.Mappings = make(map[string]string, len(raw.Mappings))
+	c.CanaryPercent = make(map[string]int)
+	for agent, mapping := range raw.Mappings {
+		c.Mappings[agent] = mapping.Model
+		if mapping.CanaryPercent != 0 {
+			c.CanaryPercent[agent] = mapping.CanaryPercent
+		}
+	}
+	return nil
+}
+
+// RoutingConfig holds routing beyond subagent mappings. Requests not claimed by
+// a subagent or rule are routed by their estimated input size: at or above
+// LongContextThreshold tokens to LongContextModel, at or below
+// SmallRequestThreshold tokens to SmallRequestModel. Anything left is remapped
+// by Tiers, keyed by Claude model family (haiku, sonnet, opus).
+type RoutingConfig struct {
+	Rules                 []RoutingRuleConfig `yaml:"rules"`
+	Tiers                 map[string]string   `yaml:"tiers"`
+	LongContextModel      string              `yaml:"long_context_model"`
+	LongContextThreshold  int                 `yaml:"long_context_threshold"`
+	SmallRequestModel     string              `yaml:"small_request_model"`
+	SmallRequestThreshold int                 `yaml:"small_request_threshold"`
+	Fallback              FallbackConfig      `yaml:"fallback"`
+	Canary                CanaryConfig        `yaml:"canary"`
+	ModelAccess           ModelAccessConfig   `yaml:"model_access"`
+	Hook                  RoutingHookConfig   `yaml:"hook"`
+	Continuation          ContinuationConfig  `yaml:"continuation"`
+}
+
+// ContinuationConfig re-issues a non-streaming request whose response stopped
+// at max_tokens in the middle of a tool call, which Claude Code can't use.
+// The retry asks for MaxTokens (default twice the original, up to 32000),
+// optionally on a cheaper Model, and its response is returned instead.
+type ContinuationConfig struct {
+	Enable    bool   `yaml:"enable"`
+	MaxTokens int    `yaml:"max_tokens"`
+	Model     string `yaml:"model"`
+}
+
+// RoutingHookConfig runs Command (a program and its arguments) to route each
+// request not forced by an override, before subagent mappings and rules. The
+// command gets the request's metadata as JSON on stdin and answers with the
+// model to use as JSON on stdout, or with nothing to leave the request to the
+// other routing steps. It is killed after Timeout (default 500ms); a hook that
+// fails or times out doesn't fail the request.
+type RoutingHookConfig struct {
+	Command []string `yaml:"command"`
+	Timeout string   `yaml:"timeout"`
+}
+
+// ModelAccessConfig restricts which models requests may be sent upstream to,
+// after routing. Allow and Deny are glob patterns (e.g. "*opus*"); with Allow
+// set only matching models may be used, and Deny wins over Allow. Action is
+// "reject" (default) to refuse denied requests or "rewrite" to send them to
+// RewriteTo instead.
+type ModelAccessConfig struct {
+	Allow     []string `yaml:"allow"`
+	Deny      []string `yaml:"deny"`
+	Action    string   `yaml:"action"`
+	RewriteTo string   `yaml:"rewrite_to"`
+}
+
+// CanaryConfig rolls changes to the routing rules managed through the API out
+// to Percent of traffic first. The change is rolled back if its error rate is
+// more than MaxErrorRateIncrease above the rest of traffic (0.05 = 5 points),
+// or its average latency more than MaxLatencyIncrease slower (0.5 = 50%), once
+// both sides have MinRequests requests. It is promoted to all traffic after
+// Duration without a regression.
+type CanaryConfig struct {
+	Enable               bool    `yaml:"enable"`
+	Percent              int     `yaml:"percent"`
+	MinRequests          int     `yaml:"min_requests"`
+	MaxErrorRateIncrease float64 `yaml:"max_error_rate_increase"`
+	MaxLatencyIncrease   float64 `yaml:"max_latency_increase"`
+	Duration             string  `yaml:"duration"`
+}
+
+// FallbackConfig re-issues requests whose upstream still answers 429 or 529
+// after retries. Models maps a target model to its fallback; Model is used for
+// anything not listed.
+type FallbackConfig struct {
+	Model    string            `yaml:"model"`
+	Provider string            `yaml:"provider"` // defaults to the provider inferred from the fallback model
+	Models   map[string]string `yaml:"models"`
+}
+
+// RoutingRuleConfig routes requests whose content matches any of Keywords
+// (case-insensitive) or Pattern (regexp) to TargetModel. Rules are evaluated
+// in order and the first match wins.
+type RoutingRuleConfig struct {
+	Name        string   `yaml:"name"`
+	Keywords    []string `yaml:"keywords"`
+	Pattern     string   `yaml:"pattern"`
+	Scope       string   `yaml:"scope"`  // last_user (default), messages, system, all
+	Models      []string `yaml:"models"` // only apply when the requested model contains one of these
+	TargetModel string   `yaml:"target_model"`
+	Provider    string   `yaml:"provider"` // defaults to the provider inferred from target_model
+}
+
+// UserPolicyConfig scopes routing to one user of a shared proxy. A request
+// belongs to the first user listing its API key (x-api-key or the bearer
+// token, either as is or as "sha256:<hex digest>") in APIKeys, or its Claude
+// Code account (the account UUID in metadata.user_id) in Accounts. The user's
+// subagent mappings and tiers replace the shared entry for the same agent or
+// tier, an empty model opting out of it, and their rules are tried before the
+// shared rules.
+type UserPolicyConfig struct {
+	Name     string              `yaml:"name"`
+	APIKeys  []string            `yaml:"api_keys"`
+	Accounts []string            `yaml:"accounts"`
+	Mappings map[string]string   `yaml:"mappings"`
+	Tiers    map[string]string   `yaml:"tiers"`
+	Rules    []RoutingRuleConfig `yaml:"rules"`
+}
+
+// TenancyConfig partitions the dashboard and its API between the users of a
+// shared proxy. With Enable set, callers authenticate with an API key of a
+// user (x-api-key, a bearer token, or the password of HTTP basic auth, which
+// browsers prompt for) and see only the requests routed for that user. Keys
+// in AdminKeys, as is or as "sha256:<hex digest>" and also settable as a
+// comma-separated TENANCY_ADMIN_KEYS, see every request and are the only ones
+// allowed to change configuration or maintain storage.
+type TenancyConfig struct {
+	Enable    bool     `yaml:"enable"`
+	AdminKeys []string `yaml:"admin_keys"`
+}
+
+// ConversationsConfig picks where the conversation views come from: "files"
+// reads the session logs Claude Code keeps in ~/.claude/projects, "proxy"
+// threads the logged /v1/messages requests into conversations, which works
+// without Claude Code's files and for other clients too. "auto" (default)
+// reads the files when the directory exists.
+type ConversationsConfig struct {
+	Source string `yaml:"source"`
+}
+
+// GradingConfig sets how prompts are graded. Model is sent through its
+// provider like a routed request, so grading can run on a cheap or local
+// model instead of burning paid tokens. Prompt replaces the grading
+// instructions: a text/template given .MaxScore and .Criteria (each with .Name
+// and .Description) that must ask for the grade as JSON. Criteria replace the
+// default clarity, specificity, context and structure.
+type GradingConfig struct {
+	Model     string             `yaml:"model"`      // default claude-3-5-sonnet-20240620
+	Provider  string             `yaml:"provider"`   // defaults to the provider inferred from model
+	MaxTokens int                `yaml:"max_tokens"` // default 2000
+	Prompt    string             `yaml:"prompt"`
+	Criteria  []GradingCriterion `yaml:"criteria"`
+
+	// MaxConcurrent caps the prompts a grading job grades at once (default 4)
+	MaxConcurrent int `yaml:"max_concurrent"`
+}
+
+// GradingCriterion is something prompts are scored on
+type GradingCriterion struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+}
+
+// QuotaConfig limits how many requests may be sent to a provider,
+// independent of token spend. MaxConcurrent caps the requests in flight at
+// once. Policy is "reject" (default) or "queue"; queued requests are served
+// interactive first.
+type QuotaConfig struct {
+	RequestsPerMinute int    `yaml:"requests_per_minute"`
+	RequestsPerDay    int    `yaml:"requests_per_day"`
+	MaxConcurrent     int    `yaml:"max_concurrent"`
+	Policy            string `yaml:"policy"`
+	MaxWait           string `yaml:"max_wait"`
+}
+
+// PriceConfig is what a model costs, in USD per million tokens. Pricing is
+// keyed by a substring of the model name and overrides the built-in prices.
+type PriceConfig struct {
+	Input      float64 `yaml:"input"`
+	Output     float64 `yaml:"output"`
+	CacheRead  float64 `yaml:"cache_read"`
+	CacheWrite float64 `yaml:"cache_write"`
+}
+
+// BudgetConfig caps what proxied requests may cost per day and per month, in
+// USD (0 for no cap). As the tighter of the two is used up, each threshold
+// whose percent has been reached downgrades the models matching its keys to
+// cheaper ones, or blocks requests outright. Models caps the spend on the
+// models matching each key on its own.
+type BudgetConfig struct {
+	Daily      float64                      `yaml:"daily"`
+	Monthly    float64                      `yaml:"monthly"`
+	Thresholds []BudgetThresholdConfig      `yaml:"thresholds"`
+	Models     map[string]ModelBudgetConfig `yaml:"models"` // model name substring -> budget
+}
+
+// ModelBudgetConfig is the daily and monthly budget of the models matching a
+// key. Once either is used up their requests are sent to Downgrade instead,
+// or blocked without one.
+type ModelBudgetConfig struct {
+	Daily     float64 `yaml:"daily"`
+	Monthly   float64 `yaml:"monthly"`
+	Downgrade string  `yaml:"downgrade"`
+}
+
+type BudgetThresholdConfig struct {
+	Percent   float64           `yaml:"percent"`
+	Downgrade map[string]string `yaml:"downgrade"` // model name substring -> cheaper model
+	Block     bool              `yaml:"block"`
+}
+
+// UsageWindowConfig describes the rolling window a Claude subscription is
+// throttled over, which opens with the first request after the last window
+// closed and lasts Duration (default "5h"). With TokenLimit or MessageLimit
+// set, the window's usage is also reported as a share of them.
+type UsageWindowConfig struct {
+	Duration     string `yaml:"duration"`
+	TokenLimit   int64  `yaml:"token_limit"`
+	MessageLimit int    `yaml:"message_limit"`
+}
+
+// IdleSessionsConfig flags sessions that keep making requests with no user
+// message for After (default 30m), such as an agent left running overnight.
+// With Pause, the session's requests are refused from then on until the user
+// sends a message or it is resumed through the API.
+type IdleSessionsConfig struct {
+	Enable bool   `yaml:"enable"`
+	After  string `yaml:"after"`
+	Pause  bool   `yaml:"pause"`
+}
+
+// NotifyConfig sends a notification when a request that ran for at least After
+// (e.g. "2m") finishes, so a long Opus turn can be left running in the
+// background. It is posted to WebhookURL as a Slack-compatible {"text": ...}
+// payload and, with Desktop, shown with notify-send on Linux or osascript on
+// macOS. Nothing is sent while After is empty.
+type NotifyConfig struct {
+	After      string `yaml:"after"`
+	WebhookURL string `yaml:"webhook_url"`
+	Desktop    bool   `yaml:"desktop"`
+}
+
+// AlertsConfig posts a Slack-compatible {"text": ...} message to WebhookURL
+// (default notify's) when today's tokens reach DailyTokens, today's cost
+// reaches DailyCost in USD, the subscription's usage window reaches
+// WindowPercent of its limits, or any budget reaches BudgetPercent of itself.
+// Each alert fires once per day, window or budget period; 0 leaves it off.
+// Usage is checked every Interval (default "1m").
+type AlertsConfig struct {
+	WebhookURL    string  `yaml:"webhook_url"`
+	Interval      string  `yaml:"interval"`
+	DailyTokens   int64   `yaml:"daily_tokens"`
+	DailyCost     float64 `yaml:"daily_cost"`
+	WindowPercent float64 `yaml:"window_percent"`
+	BudgetPercent float64 `yaml:"budget_percent"`
+}
+
+// SLAConfig sets the targets the monthly provider report checks each provider
+// against: Availability is the percent of requests that must not fail with a
+// 5xx, P95Latency (e.g. "30s") the slowest the 95th percentile may be. Either
+// may be left unset.
+type SLAConfig struct {
+	Availability float64 `yaml:"availability"`
+	P95Latency   string  `yaml:"p95_latency"`
+}
+
+// ExperimentConfig splits sessions between two models. Split is the
+// percentage of sessions routed to ModelB; the rest go to ModelA.
+type ExperimentConfig struct {
+	Name   string   `yaml:"name"`
+	Models []string `yaml:"models"` // only apply when the requested model contains one of these
+	ModelA string   `yaml:"model_a"`
+	ModelB string   `yaml:"model_b"`
+	Split  int      `yaml:"split"`
+}
+
+// ShadowConfig mirrors requests to a second model for offline comparison. The
+// copy is sent alongside the primary request and its response is stored with
+// the primary's but never returned to the client. Enable is the kill switch; it
+// can also be flipped at runtime.
+type ShadowConfig struct {
+	Enable        bool     `yaml:"enable"`
+	Model         string   `yaml:"model"`
+	Provider      string   `yaml:"provider"`       // defaults to the provider inferred from model
+	Models        []string `yaml:"models"`         // only mirror requests for models containing one of these
+	Percent       int      `yaml:"percent"`        // share of requests mirrored (default 100)
+	MaxConcurrent int      `yaml:"max_concurrent"` // shadow requests in flight; copies beyond it are dropped
+	Timeout       string   `yaml:"timeout"`
+}
+
+// LocaleConfig selects the language of server-generated text for the dashboard
+// API and digests. Language is used when a request's Accept-Language doesn't
+// match a catalog; Dir holds extra "<language>.json" catalogs that add to or
+// override the built-in ones.
+type LocaleConfig struct {
+	Language string `yaml:"language"`
+	Dir      string `yaml:"dir"`
+}
+
+// IngestConfig protects /api/v1/ingest/usage, which records usage that didn't go
+// through the proxy. When Token is set, posts must send it as a bearer token.
+type IngestConfig struct {
+	Token string `yaml:"token"`
+}
+
+// ScheduleConfig runs a named task on a cron schedule
+type ScheduleConfig struct {
+	Name string            `yaml:"name"`
+	Cron string            `yaml:"cron"`
+	Task string            `yaml:"task"`
+	Args map[string]string `yaml:"args"`
 }
 
 func Load() (*Config, error) {
@@ -81,6 +614,7 @@ func Load() (*Config, error) {
 	cfg := &Config{
 		Server: ServerConfig{
 			Port:         "3001",
+			ParsingMode:  "lenient",
 			ReadTimeout:  600 * time.Second,
 			WriteTimeout: 600 * time.Second,
 			IdleTimeout:  600 * time.Second,
@@ -92,22 +626,85 @@ func Load() (*Config, error) {
 				MaxRetries: 3,
 			},
 			OpenAI: OpenAIProviderConfig{
-				BaseURL: "https://api.openai.com",
-				APIKey:  "",
+				BaseURL:    "https://api.openai.com",
+				APIKey:     "",
+				MaxRetries: 3,
+			},
+			Ollama: OllamaProviderConfig{
+				OpenAIProviderConfig: OpenAIProviderConfig{
+					BaseURL: "http://localhost:11434",
+				},
+			},
+			LMStudio: LocalProviderConfig{
+				OpenAIProviderConfig: OpenAIProviderConfig{
+					BaseURL: "http://localhost:1234",
+				},
+			},
+			LlamaCpp: LocalProviderConfig{
+				OpenAIProviderConfig: OpenAIProviderConfig{
+					BaseURL: "http://localhost:8080",
+				},
+			},
+			HuggingFace: HuggingFaceProviderConfig{
+				// Scaled-to-zero endpoints answer 503 while they wake up
+				MaxRetries: 5,
+				MaxBackoff: "60s",
+			},
+			Cohere: OpenAIProviderConfig{
+				BaseURL:    "https://api.cohere.com",
+				MaxRetries: 3,
+			},
+			Perplexity: OpenAIProviderConfig{
+				BaseURL:    "https://api.perplexity.ai",
+				MaxRetries: 3,
 			},
 		},
 		Storage: StorageConfig{
-			DBPath: "requests.db",
+			Driver:           "sqlite",
+			DBPath:           "requests.db",
+			CompressMinBytes: 4096,
+			DedupMinBytes:    1024,
+			BlobMinBytes:     1 << 20,
+			TrashDays:        7,
+			Archive: ArchiveConfig{
+				AfterDays: 90,
+			},
+			WriteQueue: WriteQueueConfig{
+				Enable:    true,
+				Size:      1000,
+				BatchSize: 100,
+			},
 		},
 		Subagents: SubagentsConfig{
-			Enable:   false,
-			Mappings: make(map[string]string),
+			Enable:       false,
+			Mappings:     make(map[string]string),
+			Detection:    []string{"hash"},
+			PrefixLength: 200,
 		},
+		Shadow: ShadowConfig{
+			Percent:       100,
+			MaxConcurrent: 2,
+			Timeout:       "5m",
+		},
+		Locale: LocaleConfig{
+			Language: "en",
+		},
+	}
+
+	// A data directory holds the config and database of a standalone binary
+	cfg.Storage.DataDir = os.Getenv("DATA_DIR")
+	if cfg.Storage.DataDir != "" {
+		if err := bootstrapDataDir(cfg.Storage.DataDir); err != nil {
+			return nil, err
+		}
 	}
 
 	// Try to load config.yaml from the project root
 	// The proxy binary is in proxy/ directory, config.yaml is in the parent
 	configPath := filepath.Join(filepath.Dir(os.Args[0]), "..", "config.yaml")
+	if cfg.Storage.DataDir != "" {
+		configPath = filepath.Join(cfg.Storage.DataDir, "config.yaml")
+	}
 
 	// If that doesn't work, try relative to current directory
 	if _, err := os.Stat(configPath); err != nil {
@@ -126,6 +723,15 @@ func Load() (*Config, error) {
 	if envPort := os.Getenv("PORT"); envPort != "" {
 		cfg.Server.Port = envPort
 	}
+	if envMode := os.Getenv("PARSING_MODE"); envMode != "" {
+		cfg.Server.ParsingMode = envMode
+	}
+	if envReadOnly := os.Getenv("READ_ONLY"); envReadOnly != "" {
+		if readOnly, err := strconv.ParseBool(envReadOnly); err == nil {
+			cfg.Server.ReadOnly = readOnly
+		}
+	}
+	cfg.Storage.ReadOnly = cfg.Server.ReadOnly
 	if envTimeout := os.Getenv("READ_TIMEOUT"); envTimeout != "" {
 		cfg.Server.ReadTimeout = getDuration("READ_TIMEOUT", cfg.Server.ReadTimeout)
 	}
@@ -146,6 +752,18 @@ func Load() (*Config, error) {
 	if envRetries := os.Getenv("ANTHROPIC_MAX_RETRIES"); envRetries != "" {
 		cfg.Providers.Anthropic.MaxRetries = getInt("ANTHROPIC_MAX_RETRIES", cfg.Providers.Anthropic.MaxRetries)
 	}
+	if envProxy := os.Getenv("ANTHROPIC_UPSTREAM_PROXY"); envProxy != "" {
+		cfg.Providers.Anthropic.UpstreamProxy = envProxy == "true"
+	}
+	if envMode := os.Getenv("ANTHROPIC_AUTH_MODE"); envMode != "" {
+		cfg.Providers.Anthropic.AuthMode = envMode
+	}
+	if envKey := os.Getenv("ANTHROPIC_UPSTREAM_API_KEY"); envKey != "" {
+		cfg.Providers.Anthropic.APIKey = envKey
+	}
+	if envKeys := os.Getenv("ANTHROPIC_UPSTREAM_API_KEYS"); envKeys != "" {
+		cfg.Providers.Anthropic.APIKeys = parseAPIKeys(envKeys)
+	}
 
 	// Override OpenAI settings
 	if envURL := os.Getenv("OPENAI_BASE_URL"); envURL != "" {
@@ -154,11 +772,141 @@ func Load() (*Config, error) {
 	if envKey := os.Getenv("OPENAI_API_KEY"); envKey != "" {
 		cfg.Providers.OpenAI.APIKey = envKey
 	}
+	if envKeys := os.Getenv("OPENAI_API_KEYS"); envKeys != "" {
+		cfg.Providers.OpenAI.APIKeys = parseAPIKeys(envKeys)
+	}
+	if envRetries := os.Getenv("OPENAI_MAX_RETRIES"); envRetries != "" {
+		cfg.Providers.OpenAI.MaxRetries = getInt("OPENAI_MAX_RETRIES", cfg.Providers.OpenAI.MaxRetries)
+	}
+
+	// Override Ollama settings
+	if envURL := os.Getenv("OLLAMA_BASE_URL"); envURL != "" {
+		cfg.Providers.Ollama.BaseURL = envURL
+	}
+
+	// Override Hugging Face settings
+	if envToken := os.Getenv("HF_TOKEN"); envToken != "" {
+		cfg.Providers.HuggingFace.Token = envToken
+	}
+
+	// Override Cohere settings
+	if envURL := os.Getenv("COHERE_BASE_URL"); envURL != "" {
+		cfg.Providers.Cohere.BaseURL = envURL
+	}
+	if envKey := os.Getenv("COHERE_API_KEY"); envKey != "" {
+		cfg.Providers.Cohere.APIKey = envKey
+	}
+
+	// Override Perplexity settings
+	if envKey := os.Getenv("PERPLEXITY_API_KEY"); envKey != "" {
+		cfg.Providers.Perplexity.APIKey = envKey
+	}
+
+	// Override local server settings
+	if envURL := os.Getenv("LMSTUDIO_BASE_URL"); envURL != "" {
+		cfg.Providers.LMStudio.BaseURL = envURL
+	}
+	if envURL := os.Getenv("LLAMACPP_BASE_URL"); envURL != "" {
+		cfg.Providers.LlamaCpp.BaseURL = envURL
+	}
+
+	// Model tier remapping, e.g. ROUTING_TIER_HAIKU=gpt-4o-mini
+	for _, tier := range []string{"haiku", "sonnet", "opus"} {
+		if envModel := os.Getenv("ROUTING_TIER_" + strings.ToUpper(tier)); envModel != "" {
+			if cfg.Routing.Tiers == nil {
+				cfg.Routing.Tiers = make(map[string]string)
+			}
+			cfg.Routing.Tiers[tier] = envModel
+		}
+	}
+
+	// Shadow traffic kill switch
+	if os.Getenv("SHADOW_DISABLE") == "true" {
+		cfg.Shadow.Enable = false
+	}
 
 	// Override storage settings
+	cfg.Storage.Driver = getEnv("STORAGE_DRIVER", cfg.Storage.Driver)
+	if envDays := os.Getenv("STORAGE_TRASH_DAYS"); envDays != "" {
+		if days, err := strconv.Atoi(envDays); err == nil {
+			cfg.Storage.TrashDays = days
+		}
+	}
 	if envPath := os.Getenv("DB_PATH"); envPath != "" {
 		cfg.Storage.DBPath = envPath
 	}
+	if envKey := os.Getenv("STORAGE_ENCRYPTION_KEY"); envKey != "" {
+		cfg.Storage.EncryptionKey = envKey
+	}
+	if cfg.Storage.DataDir != "" && !filepath.IsAbs(cfg.Storage.DBPath) {
+		cfg.Storage.DBPath = filepath.Join(cfg.Storage.DataDir, cfg.Storage.DBPath)
+	}
+	archive := &cfg.Storage.Archive
+	archive.AccessKeyID = getEnv("ARCHIVE_ACCESS_KEY_ID", archive.AccessKeyID)
+	archive.SecretAccessKey = getEnv("ARCHIVE_SECRET_ACCESS_KEY", archive.SecretAccessKey)
+	if archive.AccessKeyID == "" && archive.SecretAccessKey == "" {
+		archive.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		archive.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if cfg.Storage.DataDir != "" && cfg.Storage.BlobDir != "" && !filepath.IsAbs(cfg.Storage.BlobDir) {
+		cfg.Storage.BlobDir = filepath.Join(cfg.Storage.DataDir, cfg.Storage.BlobDir)
+	}
+
+	if envDetection := os.Getenv("SUBAGENT_DETECTION"); envDetection != "" {
+		cfg.Subagents.Detection = strings.Split(envDetection, ",")
+	}
+
+	if envLanguage := os.Getenv("LOCALE"); envLanguage != "" {
+		cfg.Locale.Language = envLanguage
+	}
+	if envDir := os.Getenv("LOCALE_DIR"); envDir != "" {
+		cfg.Locale.Dir = envDir
+	}
+
+	if envKeys := os.Getenv("TENANCY_ADMIN_KEYS"); envKeys != "" {
+		cfg.Tenancy.AdminKeys = strings.Split(envKeys, ",")
+	}
+
+	if envSource := os.Getenv("CONVERSATIONS_SOURCE"); envSource != "" {
+		cfg.Conversations.Source = envSource
+	}
+
+	if envModel := os.Getenv("GRADING_MODEL"); envModel != "" {
+		cfg.Grading.Model = envModel
+	}
+
+	if envToken := os.Getenv("INGEST_TOKEN"); envToken != "" {
+		cfg.Ingest.Token = envToken
+	}
+	if envURL := os.Getenv("NOTIFY_WEBHOOK_URL"); envURL != "" {
+		cfg.Notify.WebhookURL = envURL
+	}
+
+	if envURL := os.Getenv("ALERTS_WEBHOOK_URL"); envURL != "" {
+		cfg.Alerts.WebhookURL = envURL
+	}
+
+	if envBudget := os.Getenv("BUDGET_DAILY"); envBudget != "" {
+		if budget, err := strconv.ParseFloat(envBudget, 64); err == nil {
+			cfg.Budget.Daily = budget
+		}
+	}
+	if envBudget := os.Getenv("BUDGET_MONTHLY"); envBudget != "" {
+		if budget, err := strconv.ParseFloat(envBudget, 64); err == nil {
+			cfg.Budget.Monthly = budget
+		}
+	}
+
+	if envLimit := os.Getenv("USAGE_WINDOW_TOKEN_LIMIT"); envLimit != "" {
+		if limit, err := strconv.ParseInt(envLimit, 10, 64); err == nil {
+			cfg.UsageWindow.TokenLimit = limit
+		}
+	}
+	if envLimit := os.Getenv("USAGE_WINDOW_MESSAGE_LIMIT"); envLimit != "" {
+		if limit, err := strconv.Atoi(envLimit); err == nil {
+			cfg.UsageWindow.MessageLimit = limit
+		}
+	}
 
 	// Sync legacy Anthropic config
 	cfg.Anthropic = AnthropicConfig{
@@ -203,6 +951,25 @@ func (c *Config) loadFromFile(path string) error {
 	return yaml.Unmarshal(data, c)
 }
 
+//go:embed starter.yaml
+var starterConfig []byte
+
+// bootstrapDataDir creates dir, and a starter config.yaml in it, if they don't
+// exist yet
+func bootstrapDataDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	configPath := filepath.Join(dir, "config.yaml")
+	if _, err := os.Stat(configPath); !os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.WriteFile(configPath, starterConfig, 0o600); err != nil {
+		return fmt.Errorf("failed to write starter config: %w", err)
+	}
+	return nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -210,12 +977,17 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getDuration reads a duration such as "10m", or a bare number of seconds as
+// the timeouts were once given
 func getDuration(key string, defaultValue time.Duration) time.Duration {
 	value := os.Getenv(key)
 	if value == "" {
 		return defaultValue
 	}
 
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
 	duration, err := time.ParseDuration(value)
 	if err != nil {
 		return defaultValue
@@ -237,3 +1009,14 @@ func getInt(key string, defaultValue int) int {
 
 	return intValue
 }
+
+// parseAPIKeys reads a comma-separated list of keys, all with the same weight
+func parseAPIKeys(value string) []APIKeyConfig {
+	var keys []APIKeyConfig
+	for _, key := range strings.Split(value, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, APIKeyConfig{Key: key})
+		}
+	}
+	return keys
+}
@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gorilla/mux"
+)
+
+// apiPrefix is where the dashboard API is served. The unversioned /api paths
+// it was served at before still work, rewritten to it.
+const apiPrefix = "/api/v1"
+
+// pathVariable matches a variable of a mux path template, with the pattern it
+// may have
+var pathVariable = regexp.MustCompile(`\{([^}:]+)(?::[^}]*)?\}`)
+
+// VersionedAPI serves the unversioned /api paths scripts and dashboards called
+// before the API was versioned as the v1 API. Their responses are marked
+// deprecated, with a link to the versioned path.
+func (h *Handler) VersionedAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") && !strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+			versioned := *r.URL
+			versioned.Path = apiPrefix + strings.TrimPrefix(r.URL.Path, "/api")
+			if versioned.RawPath != "" {
+				versioned.RawPath = apiPrefix + strings.TrimPrefix(r.URL.RawPath, "/api")
+			}
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", "<"+versioned.EscapedPath()+`>; rel="successor-version"`)
+
+			r = r.Clone(r.Context())
+			r.URL = &versioned
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// openAPIDocument is an OpenAPI 3 description of the API
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Security   []map[string][]string                   `json:"security"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components map[string]interface{}                  `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Tags        []string                   `json:"tags"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+	// AdminOnly marks operations tenants can't call when tenancy is on
+	AdminOnly bool `json:"x-admin-only,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name     string            `json:"name"`
+	In       string            `json:"in"`
+	Required bool              `json:"required"`
+	Schema   map[string]string `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string                 `json:"description"`
+	Content     map[string]interface{} `json:"content,omitempty"`
+}
+
+// GetAPISpec returns the handler of the OpenAPI document of the API, generated
+// from the routes of router under apiPrefix the first time it's asked for
+func (h *Handler) GetAPISpec(router *mux.Router) http.HandlerFunc {
+	var once sync.Once
+	var spec *openAPIDocument
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { spec = apiSpec(router) })
+		writeJSONResponse(w, spec)
+	}
+}
+
+// apiSpec describes the API routes of router: an operation for each method of
+// each route, named after its handler and tagged with the first part of its
+// path
+func apiSpec(router *mux.Router) *openAPIDocument {
+	spec := &openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title: "Claude Code Monitor API",
+			Description: "The API of the dashboard. With tenancy on, callers sign in with their API key, and operations " +
+				"marked x-admin-only are for admins. Errors are answered with an Error.",
+			Version: "1",
+		},
+		Security: []map[string][]string{{"apiKey": {}}, {"basic": {}}, {}},
+		Paths:    make(map[string]map[string]*openAPIOperation),
+		Components: map[string]interface{}{
+			"schemas": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"error": map[string]string{"type": "string"}},
+					"required":   []string{"error"},
+				},
+			},
+			"securitySchemes": map[string]interface{}{
+				"apiKey": map[string]string{"type": "apiKey", "in": "header", "name": "x-api-key"},
+				"basic":  map[string]string{"type": "http", "scheme": "basic"},
+			},
+		},
+	}
+
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(template, apiPrefix+"/") || route.GetHandler() == nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		var parameters []openAPIParameter
+		for _, match := range pathVariable.FindAllStringSubmatch(template, -1) {
+			parameters = append(parameters, openAPIParameter{Name: match[1], In: "path", Required: true, Schema: map[string]string{"type": "string"}})
+		}
+		specPath := pathVariable.ReplaceAllString(template, "{$1}")
+		tag := strings.SplitN(strings.TrimPrefix(specPath, apiPrefix+"/"), "/", 2)[0]
+		tag = strings.TrimSuffix(tag, path.Ext(tag))
+		name := handlerName(route.GetHandler())
+
+		operations := spec.Paths[specPath]
+		if operations == nil {
+			operations = make(map[string]*openAPIOperation)
+			spec.Paths[specPath] = operations
+		}
+		for _, method := range methods {
+			operationID := lowerFirst(name)
+			if len(methods) > 1 {
+				operationID += method[:1] + strings.ToLower(method[1:])
+			}
+			operations[strings.ToLower(method)] = &openAPIOperation{
+				OperationID: operationID,
+				Summary:     operationSummary(name),
+				Tags:        []string{tag},
+				Parameters:  parameters,
+				Responses: map[string]openAPIResponse{
+					"2XX": {Description: "Success"},
+					"default": {Description: "Error", Content: map[string]interface{}{
+						"application/json": map[string]interface{}{"schema": map[string]string{"$ref": "#/components/schemas/Error"}},
+					}},
+				},
+				AdminOnly: !tenantRoutes[method+" "+template],
+			}
+		}
+		return nil
+	})
+	return spec
+}
+
+// handlerName is the name of the Handler method handler is, or that made it
+func handlerName(handler http.Handler) string {
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+	if i := strings.LastIndex(name, ")."); i >= 0 {
+		name = name[i+2:]
+	}
+	return strings.FieldsFunc(name, func(r rune) bool { return r == '.' || r == '-' })[0]
+}
+
+// operationSummary spells out a handler name: GetSLAReport is "Get SLA report"
+func operationSummary(name string) string {
+	runes := []rune(name)
+	var words []string
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		wordStart := unicode.IsLower(runes[i-1]) && unicode.IsUpper(runes[i])
+		acronymEnd := unicode.IsUpper(runes[i-1]) && unicode.IsUpper(runes[i]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if wordStart || acronymEnd {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	words = append(words, string(runes[start:]))
+	for i, word := range words {
+		if i > 0 && (len(word) == 1 || strings.ToUpper(word) != word) {
+			words[i] = strings.ToLower(word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func lowerFirst(s string) string {
+	runes := []rune(s)
+	if len(runes) == 0 {
+		return s
+	}
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
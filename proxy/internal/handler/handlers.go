@@ -3,23 +3,32 @@ package handler
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/rand"
+	"crypto/subtle"
+	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"math"
 	"net/http"
-	"os"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 
+	"github.com/seifghazi/claude-code-monitor/internal/i18n"
 	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
 	"github.com/seifghazi/claude-code-monitor/internal/service"
+	"github.com/seifghazi/claude-code-monitor/internal/webui"
 )
 
 type Handler struct {
@@ -27,17 +36,57 @@ type Handler struct {
 	storageService      service.StorageService
 	conversationService service.ConversationService
 	modelRouter         *service.ModelRouter
+	scheduler           *service.Scheduler
+	shadow              *service.ShadowMirror
+	schema              *service.SchemaTracker
+	streams             *service.StreamHub
+	feed                *service.RequestFeed
+	grader              *service.PromptGrader
+	gradingJobs         *service.GradingJobs
+	sessions            *service.SessionTracker
+	parser              *service.RequestParser
+	catalog             *i18n.Catalog
+	ingestToken         string
+	configSnapshots     *service.ConfigSnapshots
+	canary              *service.RoutingCanary
+	idle                *service.IdleSessionMonitor
+	notifier            *service.Notifier
+	archiver            *service.Archiver
+	tenancy             *service.Tenancy
+	stopwatch           *service.Stopwatch
+	ui                  fs.FS // the embedded dashboard, if built in
+	readOnly            bool
 	logger              *log.Logger
 }
 
-func New(anthropicService service.AnthropicService, storageService service.StorageService, logger *log.Logger, modelRouter *service.ModelRouter) *Handler {
-	conversationService := service.NewConversationService()
+func New(anthropicService service.AnthropicService, storageService service.StorageService, conversationService service.ConversationService, logger *log.Logger, modelRouter *service.ModelRouter, scheduler *service.Scheduler, shadow *service.ShadowMirror, parser *service.RequestParser, catalog *i18n.Catalog, ingestToken string, configSnapshots *service.ConfigSnapshots, canary *service.RoutingCanary, idle *service.IdleSessionMonitor, notifier *service.Notifier, archiver *service.Archiver, grader *service.PromptGrader, tenancy *service.Tenancy, readOnly bool) *Handler {
+	ui, _ := webui.FS()
 
 	return &Handler{
 		anthropicService:    anthropicService,
 		storageService:      storageService,
 		conversationService: conversationService,
 		modelRouter:         modelRouter,
+		scheduler:           scheduler,
+		shadow:              shadow,
+		schema:              service.NewSchemaTracker(logger),
+		streams:             service.NewStreamHub(),
+		feed:                service.NewRequestFeed(modelRouter.Prices()),
+		grader:              grader,
+		gradingJobs:         service.NewGradingJobs(grader, storageService),
+		sessions:            service.NewSessionTracker(modelRouter.Prices()),
+		parser:              parser,
+		catalog:             catalog,
+		ingestToken:         ingestToken,
+		configSnapshots:     configSnapshots,
+		canary:              canary,
+		idle:                idle,
+		notifier:            notifier,
+		archiver:            archiver,
+		tenancy:             tenancy,
+		stopwatch:           service.NewStopwatch(),
+		ui:                  ui,
+		readOnly:            readOnly,
 		logger:              logger,
 	}
 }
@@ -49,6 +98,11 @@ func (h *Handler) ChatCompletions(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) Messages(w http.ResponseWriter, r *http.Request) {
+	if h.readOnly {
+		writeAnthropicError(w, http.StatusServiceUnavailable, "api_error", "this proxy is read-only and doesn't forward requests")
+		return
+	}
+
 	// Get body bytes from context (set by middleware)
 	bodyBytes := getBodyBytes(r)
 	if bodyBytes == nil {
@@ -57,191 +111,2264 @@ func (h *Handler) Messages(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse the request
-	var req model.AnthropicRequest
-	if err := json.Unmarshal(bodyBytes, &req); err != nil {
-		log.Printf("❌ Error parsing JSON: %v", err)
-		writeErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+	requestID := generateRequestID()
+	req, partial, err := h.parser.Parse(requestID, bodyBytes)
+	if err != nil {
+		log.Printf("❌ Rejecting request: %v", err)
+		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	startTime := time.Now()
+	h.schema.ObserveRequest(requestID, bodyBytes)
+
+	// Sessions paused for running too long without the user are refused
+	if err := h.idle.Observe(&req); err != nil {
+		log.Printf("⏸️  Rejecting request: %v", err)
+		writeAnthropicError(w, http.StatusForbidden, "permission_error", err.Error())
+		return
+	}
+
+	// Use model router to determine provider and route the request, unless the
+	// client forced a model or provider for this request. The override headers
+	// are meant for the proxy, so they aren't forwarded.
+	overrideModel := r.Header.Get(service.OverrideModelHeader)
+	overrideProvider := r.Header.Get(service.OverrideProviderHeader)
+	priority := r.Header.Get(service.PriorityHeader)
+	r.Header.Del(service.OverrideModelHeader)
+	r.Header.Del(service.OverrideProviderHeader)
+	r.Header.Del(service.PriorityHeader)
+
+	// On a shared proxy the client's key may select a user's routing policy
+	apiKey := service.RequestAPIKey(r.Header)
+	var decision *service.RoutingDecision
+	if overrideModel != "" || overrideProvider != "" {
+		decision, err = h.modelRouter.OverrideRoute(&req, overrideModel, overrideProvider)
+		if err == nil {
+			decision.Explanation.User = h.modelRouter.UserFor(apiKey, &req)
+		}
+	} else {
+		decision, err = h.modelRouter.DetermineRouteForKey(&req, apiKey)
+	}
+	if err != nil {
+		var overflowErr *service.ContextOverflowError
+		if errors.As(err, &overflowErr) {
+			log.Printf("📏 Rejecting request for %s: %v", overflowErr.Provider, overflowErr)
+			writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", overflowErr.Error())
+			return
+		}
+		var deniedErr *service.ModelDeniedError
+		if errors.As(err, &deniedErr) {
+			log.Printf("⛔ Rejecting request: %v", deniedErr)
+			errorBytes := writeAnthropicError(w, http.StatusForbidden, "permission_error", deniedErr.Error())
+			h.saveDeniedRequest(r, requestID, req, bodyBytes, deniedErr, errorBytes, startTime)
+			return
+		}
+		var budgetErr *service.BudgetExceededError
+		if errors.As(err, &budgetErr) {
+			log.Printf("💸 Blocking request: %v", budgetErr)
+			// A spent budget is a hard cap until the period rolls over; a
+			// threshold short of it throttles the client like a rate limit
+			status, errorType := http.StatusTooManyRequests, "rate_limit_error"
+			if budgetErr.HardCap() {
+				status, errorType = http.StatusForbidden, "permission_error"
+			}
+			writeAnthropicError(w, status, errorType, budgetErr.Error())
+			return
+		}
+		if errors.Is(err, service.ErrUnknownProvider) {
+			log.Printf("❌ Rejecting routing override: %v", err)
+			writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+			return
+		}
+
+		log.Printf("❌ Error routing request: %v", err)
+		writeErrorResponse(w, "Failed to route request", http.StatusInternalServerError)
+		return
+	}
+
+	decision.Explanation.Priority = service.RequestPriority(priority, &req)
+
+	// Log partially parsed requests as received, since req is missing fields
+	var logBody interface{} = req
+	if partial {
+		logBody = json.RawMessage(bodyBytes)
+	}
+
+	// Create request log with routing information
+	requestLog := &model.RequestLog{
+		RequestID:     requestID,
+		Timestamp:     time.Now().Format(time.RFC3339),
+		Method:        r.Method,
+		Endpoint:      r.URL.Path,
+		Headers:       SanitizeHeaders(r.Header),
+		Body:          logBody,
+		Model:         decision.OriginalModel,
+		OriginalModel: decision.OriginalModel,
+		RoutedModel:   decision.TargetModel,
+		Experiment:    decision.Experiment,
+		ExperimentArm: decision.ExperimentArm,
+		Provider:      decision.Provider.Name(),
+		SessionID:     service.SessionID(&req),
+		Routing:       &decision.Explanation,
+		UserAgent:     r.Header.Get("User-Agent"),
+		ContentType:   r.Header.Get("Content-Type"),
+
+		ConfigGeneration: h.configSnapshots.Generation(),
+		RequestWireBytes: getWireBytes(r),
+		RequestBytes:     int64(len(bodyBytes)),
+	}
+
+	if _, err := h.storageService.SaveRequest(requestLog); err != nil {
+		log.Printf("❌ Error saving request: %v", err)
+	}
+	h.feed.RequestStarted(requestLog)
+
+	h.sessions.Start(&req, decision.TargetModel)
+
+	// Let a running routing canary compare how its sessions fare, count
+	// what the request cost against the budget and its session, and tell the
+	// user if it took long
+	defer func() {
+		h.canary.Record(requestLog)
+		h.modelRouter.RecordSpend(requestLog)
+		h.feed.BudgetChecked(h.modelRouter.Budget())
+		h.idle.Record(&req, requestLog)
+		h.sessions.Finish(&req, requestLog)
+		h.notifier.Record(requestLog)
+		h.feed.RequestCompleted(requestLog)
+		h.feed.BurnRateChanged(h.modelRouter.BurnRate())
+	}()
+
+	// Enforce the provider's request quota; with the queue policy this may wait for a slot
+	release, err := h.modelRouter.AcquireQuota(r.Context(), decision)
+	if err != nil {
+		var quotaErr *service.QuotaExceededError
+		if !errors.As(err, &quotaErr) {
+			// The client went away while queued
+			log.Printf("⚠️ Request abandoned while waiting for %s quota: %v", decision.Provider.Name(), err)
+			return
+		}
+
+		log.Printf("🚦 %v", quotaErr)
+		retryAfter := int(math.Ceil(quotaErr.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		errorBytes := writeAnthropicError(w, http.StatusTooManyRequests, "rate_limit_error", quotaErr.Error())
+
+		requestLog.Response = &model.ResponseLog{
+			StatusCode:   http.StatusTooManyRequests,
+			BodyText:     string(errorBytes),
+			ResponseTime: time.Since(startTime).Milliseconds(),
+			IsStreaming:  req.Stream,
+			CompletedAt:  time.Now().Format(time.RFC3339),
+			Origin:       model.ResponseOriginSynthetic,
+		}
+		if err := h.storageService.UpdateRequestWithResponse(requestLog); err != nil {
+			log.Printf("❌ Error updating request with quota rejection: %v", err)
+		}
+		return
+	}
+	defer release()
+
+	// Copy the request to the shadow model, if any, without waiting on it
+	h.shadow.Mirror(requestID, decision, req, r.Header)
+
+	// If the model was changed (or the request trimmed) by routing, update the request body
+	if decision.TargetModel != decision.OriginalModel || decision.RequestModified {
+		req.Model = decision.TargetModel
+		if err := h.setRequestBody(r, bodyBytes, &req, partial, decision.RequestModified); err != nil {
+			log.Printf("❌ Error marshaling updated request: %v", err)
+			writeErrorResponse(w, "Failed to process request", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Forward the request to the selected provider, collecting any retries it makes
+	retryTrace := &model.RetryTrace{}
+	ctx := context.WithValue(r.Context(), model.RetryTraceKey, retryTrace)
+	resp, err := decision.Provider.ForwardRequest(ctx, r)
+
+	// If the upstream is still rate limited or overloaded after retries, re-issue
+	// the request to the configured fallback instead of surfacing the error
+	if err == nil && isOverloadStatus(resp.StatusCode) {
+		fallback := h.modelRouter.OverloadFallback(decision)
+		var releaseFallback func()
+		if fallback != nil {
+			// Give up the primary's slot first: the fallback may be on the
+			// same provider, whose only slot this request would otherwise hold.
+			// The fallback's slot is then waited for at the same priority.
+			release()
+			fallback.Explanation.Priority = decision.Explanation.Priority
+			releaseFallback, _ = h.modelRouter.AcquireQuota(ctx, fallback)
+		}
+		if releaseFallback != nil {
+			defer releaseFallback()
+
+			log.Printf("⚠️ %s returned %d, failing over \033[36m%s\033[0m → \033[32m%s\033[0m",
+				decision.Provider.Name(), resp.StatusCode, decision.TargetModel, fallback.TargetModel)
+
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+
+			retryTrace.Failover = &model.Failover{
+				FromModel:    decision.TargetModel,
+				FromProvider: decision.Provider.Name(),
+				StatusCode:   resp.StatusCode,
+			}
+			decision = fallback
+			requestLog.RoutedModel = fallback.TargetModel
+			requestLog.Provider = fallback.Provider.Name()
+			requestLog.Routing = &fallback.Explanation
+
+			req.Model = fallback.TargetModel
+			if err := h.setRequestBody(r, bodyBytes, &req, partial, fallback.RequestModified); err != nil {
+				log.Printf("❌ Error marshaling failover request: %v", err)
+				writeErrorResponse(w, "Failed to process request", http.StatusInternalServerError)
+				return
+			}
+			resp, err = decision.Provider.ForwardRequest(ctx, r)
+		}
+	}
+
+	if err != nil {
+		log.Printf("❌ Error forwarding to %s API: %v", decision.Provider.Name(), err)
+
+		requestLog.Response = &model.ResponseLog{
+			StatusCode:   http.StatusInternalServerError,
+			BodyText:     err.Error(),
+			ResponseTime: time.Since(startTime).Milliseconds(),
+			IsStreaming:  req.Stream,
+			CompletedAt:  time.Now().Format(time.RFC3339),
+			Retries:      retryTrace.Attempts,
+			Failover:     retryTrace.Failover,
+			Origin:       model.ResponseOriginSynthetic,
+		}
+		if err := h.storageService.UpdateRequestWithResponse(requestLog); err != nil {
+			log.Printf("❌ Error updating request with forward error: %v", err)
+		}
+
+		writeErrorResponse(w, "Failed to forward request", http.StatusInternalServerError)
+		return
+	}
+	defer resp.Body.Close()
+
+	if len(retryTrace.Attempts) > 0 {
+		log.Printf("🔁 Request to %s completed after %d retries", decision.Provider.Name(), len(retryTrace.Attempts))
+	}
+
+	if req.Stream {
+		h.handleStreamingResponse(w, resp, requestLog, startTime, retryTrace)
+		return
+	}
+
+	h.handleNonStreamingResponse(w, resp, requestLog, startTime, retryTrace, &truncationRetry{
+		r:         r,
+		req:       &req,
+		bodyBytes: bodyBytes,
+		partial:   partial,
+		decision:  decision,
+	})
+}
+
+// truncationRetry is what re-issuing a non-streaming request whose response
+// was cut off needs
+type truncationRetry struct {
+	r         *http.Request
+	req       *model.AnthropicRequest
+	bodyBytes []byte
+	partial   bool
+	decision  *service.RoutingDecision
+}
+
+// continueTruncated re-issues a request whose response stopped at max_tokens
+// in the middle of a tool call, when continuations are configured. The retry
+// is logged as a request of its own, linked to the original both ways. It
+// returns the retry's response if it succeeded.
+func (h *Handler) continueTruncated(retry *truncationRetry, requestLog *model.RequestLog, responseBytes []byte) ([]byte, bool) {
+	if retry == nil || retry.partial {
+		return nil, false
+	}
+	retryReq, route, ok := h.modelRouter.Continuation(retry.req, retry.decision, responseBytes)
+	if !ok {
+		return nil, false
+	}
+
+	startTime := time.Now()
+	continuationLog := &model.RequestLog{
+		RequestID:        generateRequestID(),
+		Timestamp:        startTime.Format(time.RFC3339),
+		Method:           requestLog.Method,
+		Endpoint:         requestLog.Endpoint,
+		Headers:          requestLog.Headers,
+		Body:             retryReq,
+		Model:            requestLog.Model,
+		OriginalModel:    requestLog.OriginalModel,
+		RoutedModel:      route.TargetModel,
+		Provider:         route.Provider.Name(),
+		SessionID:        requestLog.SessionID,
+		Routing:          &route.Explanation,
+		UserAgent:        requestLog.UserAgent,
+		ContentType:      requestLog.ContentType,
+		ConfigGeneration: requestLog.ConfigGeneration,
+	}
+	route.Explanation.ContinuationOf = requestLog.RequestID
+	requestLog.Routing.ContinuedBy = continuationLog.RequestID
+
+	if err := h.setRequestBody(retry.r, retry.bodyBytes, retryReq, false, true); err != nil {
+		log.Printf("❌ Error marshaling continuation request: %v", err)
+		return nil, false
+	}
+	continuationLog.RequestBytes = retry.r.ContentLength
+	if _, err := h.storageService.SaveRequest(continuationLog); err != nil {
+		log.Printf("❌ Error saving continuation request: %v", err)
+	}
+	defer h.modelRouter.RecordSpend(continuationLog)
+
+	// The original request still holds its provider's slot
+	if route.Provider.Name() != retry.decision.Provider.Name() {
+		release, err := h.modelRouter.AcquireQuota(retry.r.Context(), route)
+		if err != nil {
+			log.Printf("⚠️  Not continuing truncated response: %v", err)
+			continuationLog.Response = &model.ResponseLog{
+				StatusCode:   http.StatusTooManyRequests,
+				BodyText:     err.Error(),
+				ResponseTime: time.Since(startTime).Milliseconds(),
+				CompletedAt:  time.Now().Format(time.RFC3339),
+				Origin:       model.ResponseOriginSynthetic,
+			}
+			h.storageService.UpdateRequestWithResponse(continuationLog)
+			return nil, false
+		}
+		defer release()
+	}
+
+	retryTrace := &model.RetryTrace{}
+	ctx := context.WithValue(retry.r.Context(), model.RetryTraceKey, retryTrace)
+	resp, err := route.Provider.ForwardRequest(ctx, retry.r)
+	if err != nil {
+		log.Printf("❌ Error forwarding continuation to %s: %v", route.Provider.Name(), err)
+		continuationLog.Response = &model.ResponseLog{
+			StatusCode:   http.StatusInternalServerError,
+			BodyText:     err.Error(),
+			ResponseTime: time.Since(startTime).Milliseconds(),
+			CompletedAt:  time.Now().Format(time.RFC3339),
+			Retries:      retryTrace.Attempts,
+			Origin:       model.ResponseOriginSynthetic,
+		}
+		h.storageService.UpdateRequestWithResponse(continuationLog)
+		return nil, false
+	}
+	defer resp.Body.Close()
+
+	continuationBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("❌ Error reading continuation response: %v", err)
+		return nil, false
+	}
+	responseLog := &model.ResponseLog{
+		StatusCode:   resp.StatusCode,
+		Headers:      SanitizeHeaders(resp.Header),
+		ResponseTime: time.Since(startTime).Milliseconds(),
+		CompletedAt:  time.Now().Format(time.RFC3339),
+		Retries:      retryTrace.Attempts,
+		Origin:       responseOrigin(retryTrace),
+	}
+	setResponseSizes(responseLog, resp.Body, int64(len(continuationBytes)))
+	if resp.StatusCode == http.StatusOK && json.Valid(continuationBytes) {
+		responseLog.Body = json.RawMessage(continuationBytes)
+	} else {
+		responseLog.BodyText = string(continuationBytes)
+	}
+	continuationLog.Response = responseLog
+	if err := h.storageService.UpdateRequestWithResponse(continuationLog); err != nil {
+		log.Printf("❌ Error updating continuation with response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("⚠️  Continuation returned %d, passing on the truncated response", resp.StatusCode)
+		return nil, false
+	}
+	return continuationBytes, true
+}
+
+func (h *Handler) Models(w http.ResponseWriter, r *http.Request) {
+	// This proxy uses pattern-based routing and supports any model dynamically.
+	// Returning an empty list since the actual supported models depend on the
+	// upstream providers (Anthropic, OpenAI) and their current offerings.
+	response := &model.ModelsResponse{
+		Object: "list",
+		Data:   []model.ModelInfo{},
+	}
+
+	writeJSONResponse(w, response)
+}
+
+func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
+	response := &model.HealthResponse{
+		Status:    "healthy",
+		Timestamp: time.Now(),
+		ReadOnly:  h.readOnly,
+	}
+
+	writeJSONResponse(w, response)
+}
+
+// HasEmbeddedUI reports whether the dashboard is built into the binary
+func (h *Handler) HasEmbeddedUI() bool {
+	return h.ui != nil
+}
+
+// UI serves the dashboard's static files, and its index page for any path
+// that isn't a file so the client-side routes work on reload. A binary built
+// without the embedui tag has no dashboard.
+func (h *Handler) UI(w http.ResponseWriter, r *http.Request) {
+	if h.ui == nil {
+		http.Error(w, h.translate(r, "UI not available"), http.StatusNotFound)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if name != "" && name != "ui" {
+		if info, err := fs.Stat(h.ui, name); err == nil && !info.IsDir() {
+			http.FileServer(http.FS(h.ui)).ServeHTTP(w, r)
+			return
+		}
+	}
+
+	index, err := fs.ReadFile(h.ui, "index.html")
+	if err != nil {
+		http.Error(w, h.translate(r, "UI not available"), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(index)
+}
+
+func (h *Handler) GetRequests(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 10 // Default limit
+	}
+
+	// The model, status, error type and session filters are those of a bulk
+	// delete, and "all" models is no filter
+	filter, _, err := parseRequestFilter(r)
+	if err != nil {
+		writeErrorResponse(w, h.translate(r, err.Error()), http.StatusBadRequest)
+		return
+	}
+	if filter.Model == "all" {
+		filter.Model = ""
+	}
+	if r.URL.Query().Get("tag") != "" {
+		if filter.Tag, err = service.NormalizeTag(r.URL.Query().Get("tag")); err != nil {
+			writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	filter.Starred = r.URL.Query().Get("starred") == "true"
+	filter.Annotated = r.URL.Query().Get("annotated") == "true"
+
+	// Get all requests with the filters applied at storage level
+	allRequests, err := h.storage(r).GetAllRequests(filter)
+	if err != nil {
+		log.Printf("Error getting requests: %v", err)
+		http.Error(w, h.translate(r, "Failed to get requests"), http.StatusInternalServerError)
+		return
+	}
+
+	// Convert pointers to values for consistency
+	requests := make([]model.RequestLog, len(allRequests))
+	for i, req := range allRequests {
+		if req != nil {
+			requests[i] = *req
+		}
+	}
+
+	// Calculate total before pagination
+	total := len(requests)
+
+	// Apply pagination
+	start := (page - 1) * limit
+	end := start + limit
+	if start >= len(requests) {
+		requests = []model.RequestLog{}
+	} else {
+		if end > len(requests) {
+			end = len(requests)
+		}
+		requests = requests[start:end]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Requests []model.RequestLog `json:"requests"`
+		Total    int                `json:"total"`
+	}{
+		Requests: requests,
+		Total:    total,
+	})
+}
+
+// SearchRequests finds stored requests by the text of their messages and
+// responses, newest first
+func (h *Handler) SearchRequests(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeErrorResponse(w, h.translate(r, "Missing search query"), http.StatusBadRequest)
 		return
 	}
 
-	requestID := generateRequestID()
-	startTime := time.Now()
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 10
+	}
+
+	requests, total, err := h.storage(r).SearchRequests(query, page, limit)
+	if err != nil {
+		log.Printf("❌ Error searching requests: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to search requests"), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, struct {
+		Query    string             `json:"query"`
+		Requests []model.RequestLog `json:"requests"`
+		Total    int                `json:"total"`
+	}{
+		Query:    query,
+		Requests: requests,
+		Total:    total,
+	})
+}
+
+// DeleteRequests clears the request history, or with any of the "before"
+// (RFC3339 or YYYY-MM-DD), "model", "status" and "session" query parameters
+// only the requests matching all of them. Unless the trash is turned off,
+// they're moved to it and can be restored.
+func (h *Handler) DeleteRequests(w http.ResponseWriter, r *http.Request) {
+	filter, filtered, err := parseRequestFilter(r)
+	if err != nil {
+		writeErrorResponse(w, h.translate(r, err.Error()), http.StatusBadRequest)
+		return
+	}
+	if filtered {
+		deleted, err := h.storage(r).DeleteRequests(filter)
+		if err != nil {
+			log.Printf("❌ Error deleting requests: %v", err)
+			writeErrorResponse(w, h.translate(r, "Error clearing request history"), http.StatusInternalServerError)
+			return
+		}
+		writeJSONResponse(w, map[string]interface{}{
+			"message": "Matching requests deleted",
+			"deleted": deleted,
+		})
+		return
+	}
+
+	clearedCount, err := h.storage(r).ClearRequests()
+	if err != nil {
+		log.Printf("Error clearing requests: %v", err)
+		writeErrorResponse(w, h.translate(r, "Error clearing request history"), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "Request history cleared",
+		"deleted": clearedCount,
+	}
+
+	writeJSONResponse(w, response)
+}
+
+// GetTrash lists the requests in the trash, most recently deleted first, and
+// how many days they stay restorable
+func (h *Handler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 10
+	}
+
+	requests, total, err := h.storage(r).GetTrash(page, limit)
+	if err != nil {
+		log.Printf("❌ Error getting trash: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get trash"), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, struct {
+		Requests  []model.RequestLog `json:"requests"`
+		Total     int                `json:"total"`
+		TrashDays int                `json:"trashDays"`
+	}{
+		Requests:  requests,
+		Total:     total,
+		TrashDays: h.storage(r).GetConfig().TrashDays,
+	})
+}
+
+// RestoreRequests takes the requests listed in the {"ids": [...]} body out of
+// the trash, or every request in it without a body
+func (h *Handler) RestoreRequests(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		writeErrorResponse(w, h.translate(r, "Invalid request IDs"), http.StatusBadRequest)
+		return
+	}
+
+	restored, err := h.storage(r).RestoreRequests(body.IDs)
+	if err != nil {
+		log.Printf("❌ Error restoring requests: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to restore requests"), http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, map[string]interface{}{
+		"message":  "Requests restored",
+		"restored": restored,
+	})
+}
+
+// PurgeTrash deletes every request in the trash for good
+func (h *Handler) PurgeTrash(w http.ResponseWriter, r *http.Request) {
+	purged, err := h.storage(r).PurgeTrash(time.Time{})
+	if err != nil {
+		log.Printf("❌ Error purging trash: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to purge trash"), http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, map[string]interface{}{
+		"message": "Trash purged",
+		"purged":  purged,
+	})
+}
+
+// GetStats returns usage and bandwidth between the RFC3339 "start" and "end"
+// query parameters, defaulting to the last 24 hours
+func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
+	start, end, err := parseTimeRange(r, 24*time.Hour)
+	if err != nil {
+		writeErrorResponse(w, h.translate(r, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.storage(r).GetStats(start, end)
+	if err != nil {
+		log.Printf("❌ Error getting stats: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get stats"), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, stats)
+}
+
+// GetStatsSummary totals usage between the RFC3339 "from" and "to" (or
+// "start" and "end") query parameters, defaulting to the last 24 hours
+func (h *Handler) GetStatsSummary(w http.ResponseWriter, r *http.Request) {
+	start, end, err := parseTimeRange(r, 24*time.Hour)
+	if err != nil {
+		writeErrorResponse(w, h.translate(r, err.Error()), http.StatusBadRequest)
+		return
+	}
+	if !start.Before(end) {
+		writeErrorResponse(w, h.translate(r, "Invalid time range, start must be before end"), http.StatusBadRequest)
+		return
+	}
+
+	summary, err := h.storage(r).GetStatsSummary(start, end)
+	if err != nil {
+		log.Printf("❌ Error getting stats summary: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get stats"), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, summary)
+}
+
+// GetClientStats breaks usage down by client and user over a range
+// (?start=&end=, default the last 24 hours)
+func (h *Handler) GetClientStats(w http.ResponseWriter, r *http.Request) {
+	start, end, err := parseTimeRange(r, 24*time.Hour)
+	if err != nil {
+		writeErrorResponse(w, h.translate(r, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.storage(r).GetClientStats(start, end)
+	if err != nil {
+		log.Printf("❌ Error getting client stats: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get stats"), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, stats)
+}
+
+// maxComparedModels is how many models one comparison sets side by side
+const maxComparedModels = 10
+
+// CompareModels sets the comma-separated ?models= side by side over a range
+// (?from=&to=, default the last week), by the model requests were served by
+func (h *Handler) CompareModels(w http.ResponseWriter, r *http.Request) {
+	var models []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(r.URL.Query().Get("models"), ",") {
+		if name = strings.TrimSpace(name); name != "" && !seen[name] {
+			seen[name] = true
+			models = append(models, name)
+		}
+	}
+	if len(models) == 0 || len(models) > maxComparedModels {
+		writeErrorResponse(w, h.translate(r, "Invalid models, expected a comma-separated list of up to 10"), http.StatusBadRequest)
+		return
+	}
+	start, end, err := parseTimeRange(r, 7*24*time.Hour)
+	if err != nil {
+		writeErrorResponse(w, h.translate(r, err.Error()), http.StatusBadRequest)
+		return
+	}
+	if !start.Before(end) {
+		writeErrorResponse(w, h.translate(r, "Invalid time range, start must be before end"), http.StatusBadRequest)
+		return
+	}
+
+	comparison, err := h.storage(r).GetModelComparison(models, start, end)
+	if err != nil {
+		log.Printf("❌ Error comparing models: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get stats"), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, comparison)
+}
+
+// GetSessionUsage totals usage by conversation between the optional
+// RFC3339 "start" and "end" query parameters (default the last 24 hours)
+func (h *Handler) GetSessionUsage(w http.ResponseWriter, r *http.Request) {
+	start, end, err := parseTimeRange(r, 24*time.Hour)
+	if err != nil {
+		writeErrorResponse(w, h.translate(r, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	sessions, err := h.storage(r).GetSessionUsage(start, end)
+	if err != nil {
+		log.Printf("❌ Error getting session usage: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get stats"), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, map[string]interface{}{
+		"from":     start.Format(time.RFC3339),
+		"to":       end.Format(time.RFC3339),
+		"sessions": sessions,
+	})
+}
+
+// GetBurnRate reports token and cost rates over the last 1, 5 and 15 minutes,
+// and when each budget runs out at the current pace
+func (h *Handler) GetBurnRate(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, h.modelRouter.BurnRate())
+}
+
+// GetBudget reports each budget's spend, pace and forecast overrun, with the
+// current burn rate
+func (h *Handler) GetBudget(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, h.modelRouter.BudgetReport())
+}
+
+// GetUsageWindow reports what the subscription's rolling usage window has
+// used and when it resets
+func (h *Handler) GetUsageWindow(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, h.modelRouter.UsageWindow())
+}
+
+// GetRateLimits reports the rate limits each provider's latest response gave
+// in its anthropic-ratelimit-* headers
+func (h *Handler) GetRateLimits(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, map[string]interface{}{"providers": h.modelRouter.RateLimits()})
+}
+
+// StartMeasurement starts a stopwatch for measuring what the requests made
+// until it's stopped use, labelled with the optional {"label": ...} body
+func (h *Handler) StartMeasurement(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Label string `json:"label"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		writeErrorResponse(w, h.translate(r, "Invalid measurement"), http.StatusBadRequest)
+		return
+	}
+
+	h.writeMeasurement(w, r, h.stopwatch.Start(body.Label), http.StatusCreated)
+}
+
+// StopMeasurement stops the measurement in the {"id": ...} body and returns
+// what the requests made while it ran used
+func (h *Handler) StopMeasurement(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ID == "" {
+		writeErrorResponse(w, h.translate(r, "Invalid measurement"), http.StatusBadRequest)
+		return
+	}
+	if err := h.stopwatch.Stop(body.ID); err != nil {
+		writeErrorResponse(w, h.translate(r, "Measurement not found"), http.StatusNotFound)
+		return
+	}
+	h.writeMeasurement(w, r, body.ID, http.StatusOK)
+}
+
+// GetMeasurement returns what the requests of a measurement used so far, or
+// in the end once it's stopped, so requests still running at the stop can be
+// counted later
+func (h *Handler) GetMeasurement(w http.ResponseWriter, r *http.Request) {
+	h.writeMeasurement(w, r, mux.Vars(r)["id"], http.StatusOK)
+}
+
+func (h *Handler) writeMeasurement(w http.ResponseWriter, r *http.Request, id string, status int) {
+	measurement, err := h.stopwatch.Measure(id, h.storage(r))
+	if errors.Is(err, service.ErrUnknownMeasurement) {
+		writeErrorResponse(w, h.translate(r, "Measurement not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error measuring requests: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to measure requests"), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(measurement); err != nil {
+		log.Printf("❌ Error encoding measurement: %v", err)
+	}
+}
+
+// GetCosts breaks down spend by day, model, provider and project between the
+// optional RFC3339 "start" and "end" query parameters (default the last 30
+// days), along with what routing saved on the models Claude Code asked for
+func (h *Handler) GetCosts(w http.ResponseWriter, r *http.Request) {
+	start, end, err := parseTimeRange(r, 30*24*time.Hour)
+	if err != nil {
+		writeErrorResponse(w, h.translate(r, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	groups, err := h.storage(r).GetCostGroups(start, end)
+	if err != nil {
+		log.Printf("❌ Error getting costs: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get stats"), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, h.modelRouter.CostReport(groups, start, end))
+}
+
+// GetErrorSeries charts the error rate hour by hour over a range (?start=&end=,
+// default the last day), with failures by status and error type
+func (h *Handler) GetErrorSeries(w http.ResponseWriter, r *http.Request) {
+	start, end, err := parseTimeRange(r, 24*time.Hour)
+	if err != nil {
+		writeErrorResponse(w, h.translate(r, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	groups, err := h.storage(r).GetErrorGroups(start, end)
+	if err != nil {
+		log.Printf("❌ Error getting error series: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get stats"), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, service.BuildErrorSeries(groups, start, end))
+}
+
+// maxHeatmapWeeks is how many weeks back a heatmap can total
+const maxHeatmapWeeks = 52
+
+// GetHeatmap totals usage by weekday and hour over the last weeks
+// (?weeks=, default 4) in the time zone of ?tz=, default the server's
+func (h *Handler) GetHeatmap(w http.ResponseWriter, r *http.Request) {
+	weeks := 4
+	if value := r.URL.Query().Get("weeks"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxHeatmapWeeks {
+			writeErrorResponse(w, h.translate(r, "Invalid weeks, expected 1 to 52"), http.StatusBadRequest)
+			return
+		}
+		weeks = parsed
+	}
+	location, err := parseTimeZone(r)
+	if err != nil {
+		writeErrorResponse(w, h.translate(r, err.Error()), http.StatusBadRequest)
+		return
+	}
+	end := time.Now().In(location)
+	start := end.AddDate(0, 0, -7*weeks)
+
+	hours, err := h.storage(r).GetHourlyUsage(start, end)
+	if err != nil {
+		log.Printf("❌ Error getting heatmap: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get stats"), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, service.BuildHeatmap(hours, start, end))
+}
+
+// GetGradeTrends reports how prompt grades went over a range (?start=&end=,
+// default the last 30 days) day by day or week by week (?interval=week)
+func (h *Handler) GetGradeTrends(w http.ResponseWriter, r *http.Request) {
+	start, end, err := parseTimeRange(r, 30*24*time.Hour)
+	if err != nil {
+		writeErrorResponse(w, h.translate(r, err.Error()), http.StatusBadRequest)
+		return
+	}
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = service.GradeIntervalDay
+	}
+	if interval != service.GradeIntervalDay && interval != service.GradeIntervalWeek {
+		writeErrorResponse(w, h.translate(r, "Invalid interval, expected day or week"), http.StatusBadRequest)
+		return
+	}
+
+	prompts, err := h.storage(r).GetGradedPrompts(start, end)
+	if err != nil {
+		log.Printf("❌ Error getting grade trends: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get stats"), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, service.BuildGradeTrends(prompts, start, end, interval))
+}
+
+// GetSLAReport compares providers' availability, latency and cost over a
+// month (?month=2006-01, default the current one) in the time zone of ?tz=
+func (h *Handler) GetSLAReport(w http.ResponseWriter, r *http.Request) {
+	location, err := parseTimeZone(r)
+	if err != nil {
+		writeErrorResponse(w, h.translate(r, err.Error()), http.StatusBadRequest)
+		return
+	}
+	now := time.Now().In(location)
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	if value := r.URL.Query().Get("month"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01", value, now.Location())
+		if err != nil {
+			writeErrorResponse(w, h.translate(r, "Invalid month, expected YYYY-MM"), http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+	to := from.AddDate(0, 1, 0)
+	if to.After(now) {
+		to = now
+	}
+
+	samples, err := h.storage(r).GetProviderSamples(from, to)
+	if err != nil {
+		log.Printf("❌ Error getting provider samples: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get SLA report"), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, h.modelRouter.SLAReport(samples, from, to))
+}
+
+// GetSummaryText renders today's stats as aligned plain text, for curl,
+// screen readers and terminal panes; today is in the time zone of ?tz=
+func (h *Handler) GetSummaryText(w http.ResponseWriter, r *http.Request) {
+	location, err := parseTimeZone(r)
+	if err != nil {
+		http.Error(w, h.translate(r, err.Error()), http.StatusBadRequest)
+		return
+	}
+	end := time.Now().In(location)
+	start := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, end.Location())
+
+	stats, err := h.storage(r).GetStats(start, end)
+	if err != nil {
+		log.Printf("❌ Error getting stats: %v", err)
+		http.Error(w, h.translate(r, "Failed to get stats"), http.StatusInternalServerError)
+		return
+	}
+
+	language := h.catalog.Negotiate(r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Language", language)
+	io.WriteString(w, service.FormatSummary(h.catalog, language, stats, start, end))
+}
+
+// saveDeniedRequest logs a request refused by the model access lists, so the
+// stats can report how often that happens
+func (h *Handler) saveDeniedRequest(r *http.Request, requestID string, req model.AnthropicRequest, bodyBytes []byte, deniedErr *service.ModelDeniedError, errorBytes []byte, startTime time.Time) {
+	requestLog := &model.RequestLog{
+		RequestID:     requestID,
+		Timestamp:     startTime.Format(time.RFC3339),
+		Method:        r.Method,
+		Endpoint:      r.URL.Path,
+		Headers:       SanitizeHeaders(r.Header),
+		Body:          json.RawMessage(bodyBytes),
+		Model:         req.Model,
+		OriginalModel: req.Model,
+		RoutedModel:   deniedErr.Model,
+		Provider:      deniedErr.Explanation.Provider,
+		SessionID:     service.SessionID(&req),
+		Routing:       &deniedErr.Explanation,
+		UserAgent:     r.Header.Get("User-Agent"),
+		ContentType:   r.Header.Get("Content-Type"),
+
+		ConfigGeneration: h.configSnapshots.Generation(),
+		RequestWireBytes: getWireBytes(r),
+		RequestBytes:     int64(len(bodyBytes)),
+		Response: &model.ResponseLog{
+			StatusCode:   http.StatusForbidden,
+			BodyText:     string(errorBytes),
+			ResponseTime: time.Since(startTime).Milliseconds(),
+			IsStreaming:  req.Stream,
+			CompletedAt:  time.Now().Format(time.RFC3339),
+			Origin:       model.ResponseOriginSynthetic,
+		},
+	}
+	if _, err := h.storageService.SaveRequest(requestLog); err != nil {
+		log.Printf("❌ Error saving denied request: %v", err)
+		return
+	}
+	if err := h.storageService.UpdateRequestWithResponse(requestLog); err != nil {
+		log.Printf("❌ Error updating denied request: %v", err)
+	}
+}
+
+// ExportAnonymized streams the requests between the optional RFC3339 "start"
+// and "end" query parameters as JSON lines with all content stripped. Values
+// shared by fewer than "k" sessions (default 5) are generalized. Hashes use a
+// fresh salt per export unless "salt" is given.
+func (h *Handler) ExportAnonymized(w http.ResponseWriter, r *http.Request) {
+	start, end, err := parseTimeRange(r, 0)
+	if err != nil {
+		writeErrorResponse(w, h.translate(r, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	opts := service.AnonymizeOptions{K: service.DefaultAnonymityK}
+	if value := r.URL.Query().Get("k"); value != "" {
+		k, err := strconv.Atoi(value)
+		if err != nil || k < 1 {
+			writeErrorResponse(w, h.translate(r, "Invalid k, expected a positive integer"), http.StatusBadRequest)
+			return
+		}
+		opts.K = k
+	}
+	if salt := r.URL.Query().Get("salt"); salt != "" {
+		opts.Salt = []byte(salt)
+	} else {
+		opts.Salt = make([]byte, 32)
+		rand.Read(opts.Salt)
+	}
+
+	// The k-anonymity guards need every request before the first is written,
+	// so requests are reduced to their anonymized records as they stream in
+	anonymizer := service.NewAnonymizer(opts)
+	err = h.storage(r).ExportRequests(start, end, "", func(request *model.RequestLog) error {
+		anonymizer.Add(request)
+		return nil
+	})
+	if err != nil {
+		log.Printf("❌ Error getting requests for export: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to export requests"), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="claude-code-anonymized.jsonl"`)
+	encoder := json.NewEncoder(w)
+	for _, record := range anonymizer.Records() {
+		if err := encoder.Encode(record); err != nil {
+			log.Printf("❌ Error writing anonymized export: %v", err)
+			return
+		}
+	}
+}
+
+// ExportRequests streams the stored history as JSON lines or CSV, with the
+// usage and cost of each request, for analysis outside the dashboard
+func (h *Handler) ExportRequests(w http.ResponseWriter, r *http.Request) {
+	start, end, err := parseTimeRange(r, 0)
+	if err != nil {
+		writeErrorResponse(w, h.translate(r, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "jsonl"
+	}
+	var write func(model.ExportedRequest) error
+	var finish func() error
+	switch format {
+	case "jsonl":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="claude-code-requests.jsonl"`)
+		encoder := json.NewEncoder(w)
+		write = func(request model.ExportedRequest) error { return encoder.Encode(request) }
+		finish = func() error { return nil }
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="claude-code-requests.csv"`)
+		writer := csv.NewWriter(w)
+		writer.Write(service.ExportCSVColumns)
+		write = func(request model.ExportedRequest) error { return writer.Write(service.ExportCSVRow(request)) }
+		finish = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	default:
+		writeErrorResponse(w, h.translate(r, "Invalid format, expected jsonl or csv"), http.StatusBadRequest)
+		return
+	}
+
+	prices := h.modelRouter.Prices()
+	err = h.storage(r).ExportRequests(start, end, r.URL.Query().Get("model"), func(request *model.RequestLog) error {
+		return write(service.ExportRequest(request, prices))
+	})
+	if err == nil {
+		err = finish()
+	}
+	if err != nil {
+		// The export has started, so the client only sees it cut short
+		log.Printf("❌ Error exporting requests: %v", err)
+	}
+}
+
+// ImportRequests stores the requests of a JSON lines export posted as the
+// body, skipping those already stored
+func (h *Handler) ImportRequests(w http.ResponseWriter, r *http.Request) {
+	summary, err := service.ImportRequests(h.storageService, r.Body)
+	if err != nil {
+		log.Printf("❌ Error importing requests: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to import requests"), http.StatusInternalServerError)
+		return
+	}
+	if summary.Imported > 0 {
+		log.Printf("📥 Imported %d requests (%d already stored, %d invalid)", summary.Imported, summary.Duplicates, summary.Invalid)
+	}
+
+	writeJSONResponse(w, summary)
+}
+
+func (h *Handler) GetSchedules(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"schedules": h.scheduler.Status(),
+	}
+
+	writeJSONResponse(w, response)
+}
+
+func (h *Handler) GetQuotas(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"quotas": h.modelRouter.QuotaStatus(),
+	}
+
+	writeJSONResponse(w, response)
+}
+
+func (h *Handler) GetExperiments(w http.ResponseWriter, r *http.Request) {
+	experiments := h.modelRouter.Experiments()
+	for i := range experiments {
+		arms, err := h.storage(r).GetExperimentStats(experiments[i].Name)
+		if err != nil {
+			log.Printf("❌ Error getting stats for experiment %s: %v", experiments[i].Name, err)
+			writeErrorResponse(w, h.translate(r, "Failed to get experiment stats"), http.StatusInternalServerError)
+			return
+		}
+		experiments[i].Arms = arms
+	}
+
+	response := map[string]interface{}{
+		"experiments": experiments,
+	}
+
+	writeJSONResponse(w, response)
+}
+
+func (h *Handler) GetShadow(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, h.shadow.Status())
+}
+
+// SetShadow is the runtime kill switch for shadow traffic
+func (h *Handler) SetShadow(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Enabled == nil {
+		writeErrorResponse(w, h.translate(r, "Expected {\"enabled\": true|false}"), http.StatusBadRequest)
+		return
+	}
+
+	if enabled := h.shadow.SetEnabled(*body.Enabled); enabled != *body.Enabled {
+		writeErrorResponse(w, h.translate(r, "No shadow model is configured"), http.StatusBadRequest)
+		return
+	}
+	log.Printf("👥 Shadow traffic %s", map[bool]string{true: "enabled", false: "disabled"}[*body.Enabled])
+
+	writeJSONResponse(w, h.shadow.Status())
+}
+
+// GetRoutingRules lists the rules from config, which are read-only, followed by
+// the rules managed through the API
+func (h *Handler) GetRoutingRules(w http.ResponseWriter, r *http.Request) {
+	stored, err := h.storageService.GetRoutingRules()
+	if err != nil {
+		log.Printf("❌ Error getting routing rules: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get routing rules"), http.StatusInternalServerError)
+		return
+	}
+
+	rules := append(h.modelRouter.ConfigRoutingRules(), stored...)
+	response := map[string]interface{}{
+		"rules": rules,
+	}
+
+	writeJSONResponse(w, response)
+}
+
+func (h *Handler) CreateRoutingRule(w http.ResponseWriter, r *http.Request) {
+	var rule model.RoutingRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeErrorResponse(w, h.translate(r, "Invalid routing rule"), http.StatusBadRequest)
+		return
+	}
+	if err := h.modelRouter.ValidateRoutingRule(rule); err != nil {
+		writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule.ID = generateRequestID()
+	rule.Source = model.RuleSourceAPI
+	rule.CreatedAt = ""
+	if err := h.saveRoutingRule(&rule); err != nil {
+		writeErrorResponse(w, h.translate(r, "Failed to save routing rule"), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSONResponse(w, rule)
+}
+
+// UpdateRoutingRule replaces a rule created through the API; sending the rule
+// back with "enabled" flipped is how it is switched on and off
+func (h *Handler) UpdateRoutingRule(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	existing, err := h.findRoutingRule(id)
+	if err != nil {
+		writeErrorResponse(w, h.translate(r, "Failed to get routing rules"), http.StatusInternalServerError)
+		return
+	}
+	if existing == nil {
+		writeErrorResponse(w, h.translate(r, "Routing rule not found"), http.StatusNotFound)
+		return
+	}
+
+	var rule model.RoutingRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeErrorResponse(w, h.translate(r, "Invalid routing rule"), http.StatusBadRequest)
+		return
+	}
+	if err := h.modelRouter.ValidateRoutingRule(rule); err != nil {
+		writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule.ID = existing.ID
+	rule.Source = model.RuleSourceAPI
+	rule.CreatedAt = existing.CreatedAt
+	if err := h.saveRoutingRule(&rule); err != nil {
+		writeErrorResponse(w, h.translate(r, "Failed to save routing rule"), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, rule)
+}
+
+func (h *Handler) DeleteRoutingRule(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	deleted, err := h.storageService.DeleteRoutingRule(id)
+	if err != nil {
+		log.Printf("❌ Error deleting routing rule: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to delete routing rule"), http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		writeErrorResponse(w, h.translate(r, "Routing rule not found"), http.StatusNotFound)
+		return
+	}
+	h.reloadRoutingRules()
+
+	writeJSONResponse(w, map[string]interface{}{
+		"message": "Routing rule deleted",
+		"id":      id,
+	})
+}
+
+func (h *Handler) findRoutingRule(id string) (*model.RoutingRule, error) {
+	rules, err := h.storageService.GetRoutingRules()
+	if err != nil {
+		log.Printf("❌ Error getting routing rules: %v", err)
+		return nil, err
+	}
+	for i := range rules {
+		if rules[i].ID == id {
+			return &rules[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (h *Handler) saveRoutingRule(rule *model.RoutingRule) error {
+	if err := h.storageService.SaveRoutingRule(rule); err != nil {
+		log.Printf("❌ Error saving routing rule: %v", err)
+		return err
+	}
+	log.Printf("📐 Routing rule %q saved (enabled: %v)", rule.Name, rule.Enabled)
+	h.reloadRoutingRules()
+	return nil
+}
+
+// reloadRoutingRules hands the stored rules to the router so changes apply to
+// the next request
+func (h *Handler) reloadRoutingRules() {
+	rules, err := h.storageService.GetRoutingRules()
+	if err != nil {
+		log.Printf("❌ Error reloading routing rules: %v", err)
+		return
+	}
+	h.canary.Apply(rules)
+}
+
+// GetRoutingCanary reports the routing change being canaried, if any
+func (h *Handler) GetRoutingCanary(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, h.canary.Status())
+}
+
+// PromoteRoutingCanary applies the canaried routing change to all traffic
+func (h *Handler) PromoteRoutingCanary(w http.ResponseWriter, r *http.Request) {
+	if err := h.canary.Promote(); err != nil {
+		writeErrorResponse(w, h.translate(r, "No routing canary is running"), http.StatusConflict)
+		return
+	}
+	writeJSONResponse(w, h.canary.Status())
+}
+
+// RollbackRoutingCanary drops the canaried routing change and restores the
+// rules it replaced
+func (h *Handler) RollbackRoutingCanary(w http.ResponseWriter, r *http.Request) {
+	if err := h.canary.Rollback(); err != nil {
+		if errors.Is(err, service.ErrNoCanary) {
+			writeErrorResponse(w, h.translate(r, "No routing canary is running"), http.StatusConflict)
+			return
+		}
+		writeErrorResponse(w, h.translate(r, "Failed to save routing rule"), http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, h.canary.Status())
+}
+
+// GetActiveSessions lists the Claude Code sessions running right now, with
+// each one's model and burn rate
+func (h *Handler) GetActiveSessions(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, h.sessions.Active())
+}
+
+// GetIdleSessions lists the sessions running without a user message and the
+// recent idle and resume events
+func (h *Handler) GetIdleSessions(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"enabled":  h.idle.Enabled(),
+		"after":    h.idle.After().String(),
+		"pause":    h.idle.Pauses(),
+		"sessions": h.idle.Idle(),
+		"events":   h.idle.Events(),
+	}
+
+	writeJSONResponse(w, response)
+}
+
+// GetSessionRequests returns every stored request of a conversation, oldest
+// first
+func (h *Handler) GetSessionRequests(w http.ResponseWriter, r *http.Request) {
+	session := mux.Vars(r)["id"]
+	requests, err := h.storage(r).GetSessionRequests(session)
+	if err != nil {
+		log.Printf("❌ Error getting session requests: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get requests"), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, map[string]interface{}{
+		"session":  session,
+		"requests": requests,
+		"total":    len(requests),
+	})
+}
+
+// GetStorageStats reports how the database is using its space, such as what
+// deduplicating request bodies saves
+func (h *Handler) GetStorageStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.storageService.GetStorageStats()
+	if err != nil {
+		log.Printf("❌ Error getting storage stats: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get storage stats"), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, stats)
+}
+
+// MaintainStorage runs the comma-separated maintenance steps of the "steps"
+// query parameter (analyze, vacuum and checkpoint, all by default) and reports
+// the size of the database before and after
+func (h *Handler) MaintainStorage(w http.ResponseWriter, r *http.Request) {
+	steps, err := service.ParseMaintenanceSteps(r.URL.Query().Get("steps"))
+	if err != nil {
+		writeErrorResponse(w, h.translate(r, "Invalid maintenance steps, expected analyze, vacuum or checkpoint"), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.storageService.Maintain(steps)
+	if err != nil {
+		log.Printf("❌ Error maintaining storage: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to maintain storage"), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, report)
+}
+
+// GetRequest returns everything stored for one request: headers, body,
+// response with its streaming chunks, and prompt grade. A request moved to the
+// archive is 410 Gone; /api/v1/archive/requests/{id} can fetch it.
+func (h *Handler) GetRequest(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	request, err := h.storage(r).GetRequestByID(id)
+	if err != nil {
+		log.Printf("❌ Error getting request: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get request"), http.StatusInternalServerError)
+		return
+	}
+	if request != nil {
+		writeJSONResponse(w, request)
+		return
+	}
+
+	archived, err := h.storage(r).GetArchivedRequest(id)
+	if err != nil {
+		log.Printf("❌ Error getting archived request: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get request"), http.StatusInternalServerError)
+		return
+	}
+	if archived != nil {
+		writeErrorResponse(w, h.translate(r, "Request has been archived"), http.StatusGone)
+		return
+	}
+	writeErrorResponse(w, h.translate(r, "Request not found"), http.StatusNotFound)
+}
+
+// Pages of a streamed response's chunks: how many a page has unless the
+// client asks, and at most
+const (
+	defaultChunkPage = 100
+	maxChunkPage     = 1000
+)
+
+// GetRequestChunks returns a page of the raw SSE lines a streamed response was
+// stored with, ?offset= lines in and ?limit= long, with how many there are, so
+// the timeline of a huge stream can be rendered as it's scrolled through
+func (h *Handler) GetRequestChunks(w http.ResponseWriter, r *http.Request) {
+	offset, limit := 0, defaultChunkPage
+	var err error
+	if value := r.URL.Query().Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			writeErrorResponse(w, h.translate(r, "Invalid offset or limit"), http.StatusBadRequest)
+			return
+		}
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			writeErrorResponse(w, h.translate(r, "Invalid offset or limit"), http.StatusBadRequest)
+			return
+		}
+	}
+	if limit > maxChunkPage {
+		limit = maxChunkPage
+	}
+
+	id := mux.Vars(r)["id"]
+	request, err := h.storage(r).GetRequestByID(id)
+	if err != nil {
+		log.Printf("❌ Error getting request: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get request"), http.StatusInternalServerError)
+		return
+	}
+	if request == nil {
+		writeErrorResponse(w, h.translate(r, "Request not found"), http.StatusNotFound)
+		return
+	}
+
+	var chunks []string
+	if request.Response != nil {
+		chunks = request.Response.StreamingChunks
+	}
+	total := len(chunks)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	page := append([]string{}, chunks[offset:end]...)
+
+	writeJSONResponse(w, map[string]interface{}{
+		"requestId": id,
+		"offset":    offset,
+		"limit":     limit,
+		"total":     total,
+		"chunks":    page,
+	})
+}
+
+// CompareRequests diffs two requests, ?a= and ?b=: their system prompts,
+// messages, tools and responses, and how their usage differs
+func (h *Handler) CompareRequests(w http.ResponseWriter, r *http.Request) {
+	idA, idB := r.URL.Query().Get("a"), r.URL.Query().Get("b")
+	if idA == "" || idB == "" {
+		writeErrorResponse(w, h.translate(r, "Expected two request ids, a and b"), http.StatusBadRequest)
+		return
+	}
+
+	storage := h.storage(r)
+	var requests [2]*model.RequestLog
+	for i, id := range []string{idA, idB} {
+		request, err := storage.GetRequestByID(id)
+		if err != nil {
+			log.Printf("❌ Error getting request: %v", err)
+			writeErrorResponse(w, h.translate(r, "Failed to get request"), http.StatusInternalServerError)
+			return
+		}
+		if request == nil {
+			writeErrorResponse(w, h.translate(r, "Request not found"), http.StatusNotFound)
+			return
+		}
+		requests[i] = request
+	}
+
+	writeJSONResponse(w, service.CompareRequests(requests[0], requests[1]))
+}
+
+// AddRequestTags attaches the labels in {"tags": [...]} to a request and
+// returns all of its tags
+func (h *Handler) AddRequestTags(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Tags) == 0 {
+		writeErrorResponse(w, h.translate(r, "Invalid tags"), http.StatusBadRequest)
+		return
+	}
+	tags := make([]string, len(body.Tags))
+	for i, tag := range body.Tags {
+		normalized, err := service.NormalizeTag(tag)
+		if err != nil {
+			writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tags[i] = normalized
+	}
+
+	id := mux.Vars(r)["id"]
+	found, err := h.storage(r).AddRequestTags(id, tags)
+	if err != nil {
+		log.Printf("❌ Error tagging request: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to tag request"), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		writeErrorResponse(w, h.translate(r, "Request not found"), http.StatusNotFound)
+		return
+	}
+	h.writeRequestTags(w, r, id)
+}
+
+// RemoveRequestTag detaches a label from a request and returns the tags it
+// has left
+func (h *Handler) RemoveRequestTag(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	tag, err := service.NormalizeTag(mux.Vars(r)["tag"])
+	if err != nil {
+		writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	removed, err := h.storage(r).RemoveRequestTag(id, tag)
+	if err != nil {
+		log.Printf("❌ Error untagging request: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to tag request"), http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		writeErrorResponse(w, h.translate(r, "Request does not have this tag"), http.StatusNotFound)
+		return
+	}
+	h.writeRequestTags(w, r, id)
+}
+
+func (h *Handler) writeRequestTags(w http.ResponseWriter, r *http.Request, id string) {
+	request, err := h.storage(r).GetRequestByID(id)
+	if err != nil || request == nil {
+		log.Printf("❌ Error getting tagged request: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get request"), http.StatusInternalServerError)
+		return
+	}
+	tags := request.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	writeJSONResponse(w, map[string]interface{}{"requestId": id, "tags": tags})
+}
+
+// GetTags lists the tags in use and how many requests carry each
+func (h *Handler) GetTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.storage(r).GetTags()
+	if err != nil {
+		log.Printf("❌ Error getting tags: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get tags"), http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, map[string]interface{}{"tags": tags})
+}
+
+// StarRequest stars a request on PUT and unstars it on DELETE
+func (h *Handler) StarRequest(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	starred := r.Method != http.MethodDelete
+	found, err := h.storage(r).StarRequest(id, starred)
+	if err != nil {
+		log.Printf("❌ Error starring request: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to annotate request"), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		writeErrorResponse(w, h.translate(r, "Request not found"), http.StatusNotFound)
+		return
+	}
+	h.writeRequestAnnotation(w, r, id)
+}
+
+// SetRequestNote replaces a request's note with the one in {"note": "..."};
+// an empty note removes it
+func (h *Handler) SetRequestNote(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Note *string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Note == nil {
+		writeErrorResponse(w, h.translate(r, "Invalid note"), http.StatusBadRequest)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	found, err := h.storage(r).SetRequestNote(id, strings.TrimSpace(*body.Note))
+	if err != nil {
+		log.Printf("❌ Error annotating request: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to annotate request"), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		writeErrorResponse(w, h.translate(r, "Request not found"), http.StatusNotFound)
+		return
+	}
+	h.writeRequestAnnotation(w, r, id)
+}
+
+func (h *Handler) writeRequestAnnotation(w http.ResponseWriter, r *http.Request, id string) {
+	request, err := h.storage(r).GetRequestByID(id)
+	if err != nil || request == nil {
+		log.Printf("❌ Error getting annotated request: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get request"), http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, map[string]interface{}{"requestId": id, "starred": request.Starred, "note": request.Note})
+}
+
+// GradeRequest starts grading a stored request's prompt in the background with
+// the caller's credentials and answers 202; GET on the same path follows it
+func (h *Handler) GradeRequest(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	request, err := h.storage(r).GetRequestByID(id)
+	if err != nil {
+		log.Printf("❌ Error getting request: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get request"), http.StatusInternalServerError)
+		return
+	}
+	if request == nil {
+		writeErrorResponse(w, h.translate(r, "Request not found"), http.StatusNotFound)
+		return
+	}
+
+	err = h.grader.Grade(request, r.Header, h.feed.GradingCompleted)
+	switch {
+	case errors.Is(err, service.ErrNothingToGrade):
+		writeErrorResponse(w, h.translate(r, "Request has no prompt to grade"), http.StatusBadRequest)
+		return
+	case errors.Is(err, service.ErrAlreadyGrading):
+		writeErrorResponse(w, h.translate(r, "Request is already being graded"), http.StatusConflict)
+		return
+	case errors.Is(err, service.ErrNoGradingModel):
+		writeErrorResponse(w, h.translate(r, "No provider for the grading model"), http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		log.Printf("❌ Error grading request: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to grade request"), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	writeJSONResponse(w, map[string]interface{}{"requestId": id, "status": service.GradeStatusGrading})
+}
+
+// GetRequestGrade says whether a request is ungraded, being graded, graded or
+// failed to grade, with its grade
+func (h *Handler) GetRequestGrade(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	request, err := h.storage(r).GetRequestByID(id)
+	if err != nil {
+		log.Printf("❌ Error getting request: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get request"), http.StatusInternalServerError)
+		return
+	}
+	if request == nil {
+		writeErrorResponse(w, h.translate(r, "Request not found"), http.StatusNotFound)
+		return
+	}
+
+	status := h.grader.Status(request)
+	grade := request.PromptGrade
+	if status == service.GradeStatusUngraded || status == service.GradeStatusGrading {
+		grade = nil
+	}
+	writeJSONResponse(w, map[string]interface{}{"requestId": id, "status": status, "grade": grade})
+}
+
+// StartGradingJob grades the prompts of the stored requests selected by
+// {"from", "to", "model", "ungradedOnly", "concurrency"} in the background with
+// the caller's credentials. Only ungraded requests are graded unless
+// ungradedOnly is false.
+func (h *Handler) StartGradingJob(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		From         time.Time `json:"from"`
+		To           time.Time `json:"to"`
+		Model        string    `json:"model"`
+		UngradedOnly *bool     `json:"ungradedOnly"`
+		Concurrency  int       `json:"concurrency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		writeErrorResponse(w, h.translate(r, "Invalid grading job"), http.StatusBadRequest)
+		return
+	}
+	if !body.From.IsZero() && !body.To.IsZero() && !body.From.Before(body.To) {
+		writeErrorResponse(w, h.translate(r, "Invalid grading job"), http.StatusBadRequest)
+		return
+	}
+	filter := service.RequestFilter{After: body.From, Before: body.To, Model: body.Model, Ungraded: true}
+	if body.UngradedOnly != nil {
+		filter.Ungraded = *body.UngradedOnly
+	}
+
+	job, err := h.gradingJobs.Start(filter, body.Concurrency, r.Header, h.feed.GradingCompleted)
+	if errors.Is(err, service.ErrNoGradingModel) {
+		writeErrorResponse(w, h.translate(r, "No provider for the grading model"), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error starting grading job: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to start grading job"), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSONResponse(w, job)
+}
+
+// GetGradingJobs lists the grading jobs since the proxy started, newest first
+func (h *Handler) GetGradingJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, map[string]interface{}{"jobs": h.gradingJobs.List()})
+}
+
+// GetGradingJob reports a grading job's progress
+func (h *Handler) GetGradingJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.gradingJobs.Get(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorResponse(w, h.translate(r, "Grading job not found"), http.StatusNotFound)
+		return
+	}
+	writeJSONResponse(w, job)
+}
+
+// CancelGradingJob stops a running grading job
+func (h *Handler) CancelGradingJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.gradingJobs.Cancel(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorResponse(w, h.translate(r, "Grading job not found"), http.StatusNotFound)
+		return
+	}
+	writeJSONResponse(w, job)
+}
+
+// GetArchivedRequest says where a request was archived; with fetch=true the
+// request itself is read back from the archive
+func (h *Handler) GetArchivedRequest(w http.ResponseWriter, r *http.Request) {
+	archived, err := h.storageService.GetArchivedRequest(mux.Vars(r)["id"])
+	if err != nil {
+		log.Printf("❌ Error getting archived request: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get archived request"), http.StatusInternalServerError)
+		return
+	}
+	if archived == nil {
+		writeErrorResponse(w, h.translate(r, "Request is not archived"), http.StatusNotFound)
+		return
+	}
+
+	if r.URL.Query().Get("fetch") == "true" {
+		if !h.archiver.Enabled() {
+			writeErrorResponse(w, h.translate(r, "No archive is configured"), http.StatusServiceUnavailable)
+			return
+		}
+		if archived.Request, err = h.archiver.Fetch(r.Context(), archived); err != nil {
+			log.Printf("❌ Error fetching archived request: %v", err)
+			writeErrorResponse(w, h.translate(r, "Failed to fetch request from the archive"), http.StatusBadGateway)
+			return
+		}
+	}
+
+	writeJSONResponse(w, archived)
+}
+
+// ResumeIdleSession lets a paused session make requests again
+func (h *Handler) ResumeIdleSession(w http.ResponseWriter, r *http.Request) {
+	session := mux.Vars(r)["id"]
+	if err := h.idle.Resume(session); err != nil {
+		writeErrorResponse(w, h.translate(r, "Session is not paused"), http.StatusConflict)
+		return
+	}
+	writeJSONResponse(w, map[string]interface{}{"session": session, "paused": false})
+}
+
+// GetStreams lists the responses currently streaming to clients
+func (h *Handler) GetStreams(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, map[string]interface{}{"streams": h.streams.Active()})
+}
+
+// WatchStream relays a response that is still streaming to the client as
+// server-sent events: the chunks sent so far, then the rest as they arrive.
+// It ends with a "done" event, or "lagged" if the watcher fell too far behind
+// and should reconnect.
+func (h *Handler) WatchStream(w http.ResponseWriter, r *http.Request) {
+	requestID := mux.Vars(r)["id"]
+	lines, updates, cancel, ok := h.streams.Observe(requestID)
+	if !ok {
+		writeErrorResponse(w, h.translate(r, "Request is not streaming"), http.StatusNotFound)
+		return
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	for _, line := range lines {
+		fmt.Fprintf(w, "%s\n\n", line)
+	}
+	flush()
+
+	for {
+		select {
+		case line, open := <-updates:
+			if !open {
+				event := "done"
+				if h.streams.Streaming(requestID) {
+					event = "lagged"
+				}
+				fmt.Fprintf(w, "event: %s\ndata: {}\n\n", event)
+				flush()
+				return
+			}
+			fmt.Fprintf(w, "%s\n\n", line)
+			flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// webSocketEvents are the feed events WatchRequests passes on
+var webSocketEvents = map[string]bool{
+	service.FeedRequestStarted:   true,
+	service.FeedStreamProgress:   true,
+	service.FeedRequestCompleted: true,
+	service.FeedBurnRate:         true,
+}
 
-	// Use model router to determine provider and route the request
-	decision, err := h.modelRouter.DetermineRoute(&req)
-	if err != nil {
-		log.Printf("❌ Error routing request: %v", err)
-		writeErrorResponse(w, "Failed to route request", http.StatusInternalServerError)
-		return
+// eventsKeepAlive is how often an idle event stream sends a comment, so
+// proxies in between don't close it
+const eventsKeepAlive = 30 * time.Second
+
+// StreamEvents sends the events the dashboard needs to know about as
+// server-sent events, for where a WebSocket is awkward: new-request when a
+// request comes in, error when one fails, budget-threshold when a budget
+// reaches a threshold, grading-completed when a prompt has been graded, and
+// burn-rate with the burn rate and its projections after each request.
+// A client reconnecting with Last-Event-ID gets the events it missed first,
+// or a reset event when they're no longer kept and it should reload. A
+// client that falls too far behind gets a lagged event and is disconnected.
+func (h *Handler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	tenant, scoped := r.Context().Value(tenantKey{}).(string)
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
 	}
-
-	// Create request log with routing information
-	requestLog := &model.RequestLog{
-		RequestID:     requestID,
-		Timestamp:     time.Now().Format(time.RFC3339),
-		Method:        r.Method,
-		Endpoint:      r.URL.Path,
-		Headers:       SanitizeHeaders(r.Header),
-		Body:          req,
-		Model:         decision.OriginalModel,
-		OriginalModel: decision.OriginalModel,
-		RoutedModel:   decision.TargetModel,
-		UserAgent:     r.Header.Get("User-Agent"),
-		ContentType:   r.Header.Get("Content-Type"),
+	var missed []model.FeedEvent
+	var events <-chan model.FeedEvent
+	var cancel func()
+	complete := true
+	if lastEventID == "" {
+		events, cancel = h.feed.Subscribe()
+	} else {
+		lastID, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || lastID < 0 {
+			writeErrorResponse(w, h.translate(r, "Invalid Last-Event-ID, expected an event id"), http.StatusBadRequest)
+			return
+		}
+		missed, events, cancel, complete = h.feed.SubscribeSince(lastID)
 	}
+	defer cancel()
 
-	if _, err := h.storageService.SaveRequest(requestLog); err != nil {
-		log.Printf("❌ Error saving request: %v", err)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
 	}
-
-	// If the model was changed by routing, update the request body
-	if decision.TargetModel != decision.OriginalModel {
-		req.Model = decision.TargetModel
-
-		// Re-marshal the request with the updated model
-		updatedBodyBytes, err := json.Marshal(req)
+	send := func(event model.FeedEvent) {
+		name, ok := dashboardEvent(event)
+		if !ok || scoped && event.Tenant != tenant {
+			return
+		}
+		data, err := json.Marshal(event)
 		if err != nil {
-			log.Printf("❌ Error marshaling updated request: %v", err)
-			writeErrorResponse(w, "Failed to process request", http.StatusInternalServerError)
+			log.Printf("❌ Error encoding dashboard event: %v", err)
 			return
 		}
+		fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, name, data)
+	}
 
-		// Update the request body
-		r.Body = io.NopCloser(bytes.NewReader(updatedBodyBytes))
-		r.ContentLength = int64(len(updatedBodyBytes))
-		r.Header.Set("Content-Length", fmt.Sprintf("%d", len(updatedBodyBytes)))
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, event := range missed {
+		send(event)
 	}
+	flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, open := <-events:
+			if !open {
+				fmt.Fprint(w, "event: lagged\ndata: {}\n\n")
+				flush()
+				return
+			}
+			send(event)
+			flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
 
-	// Forward the request to the selected provider
-	resp, err := decision.Provider.ForwardRequest(r.Context(), r)
-	if err != nil {
-		log.Printf("❌ Error forwarding to %s API: %v", decision.Provider.Name(), err)
-		writeErrorResponse(w, "Failed to forward request", http.StatusInternalServerError)
-		return
+// dashboardEvent names the feed events StreamEvents passes on
+func dashboardEvent(event model.FeedEvent) (string, bool) {
+	switch event.Type {
+	case service.FeedRequestStarted:
+		return "new-request", true
+	case service.FeedRequestCompleted:
+		return "error", event.StatusCode >= 400
+	case service.FeedBudgetThreshold, service.FeedGradingCompleted, service.FeedBurnRate:
+		return event.Type, true
 	}
-	defer resp.Body.Close()
+	return "", false
+}
 
-	if req.Stream {
-		h.handleStreamingResponse(w, resp, requestLog, startTime)
+// WatchRequests pushes request-started, streaming-progress and
+// request-completed events over a WebSocket as requests go through the proxy,
+// a tenant seeing only their own, and a burn-rate event after each request.
+// Only the dashboard's origin may connect. The connection is closed if the
+// client falls too far behind; it should reconnect and reload the request
+// list.
+func (h *Handler) WatchRequests(w http.ResponseWriter, r *http.Request) {
+	tenant, scoped := r.Context().Value(tenantKey{}).(string)
+
+	if !websocket.IsWebSocketUpgrade(r) {
+		writeErrorResponse(w, h.translate(r, "Expected a WebSocket handshake"), http.StatusBadRequest)
+		return
+	}
+	if !dashboardOrigin(r) {
+		writeErrorResponse(w, h.translate(r, "WebSocket connections from other origins are not allowed"), http.StatusForbidden)
 		return
 	}
 
-	h.handleNonStreamingResponse(w, resp, requestLog, startTime)
-}
+	// Subscribe before the upgrade, so nothing after the handshake is missed
+	events, cancel := h.feed.Subscribe()
+	defer cancel()
 
-func (h *Handler) Models(w http.ResponseWriter, r *http.Request) {
-	// This proxy uses pattern-based routing and supports any model dynamically.
-	// Returning an empty list since the actual supported models depend on the
-	// upstream providers (Anthropic, OpenAI) and their current offerings.
-	response := &model.ModelsResponse{
-		Object: "list",
-		Data:   []model.ModelInfo{},
+	conn, err := webSocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("❌ Error upgrading to WebSocket: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		discardWebSocketMessages(conn)
+	}()
+
+	ping := time.NewTicker(webSocketPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case event, open := <-events:
+			if !open {
+				return
+			}
+			if !webSocketEvents[event.Type] || scoped && event.Tenant != tenant {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("❌ Error encoding request event: %v", err)
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(webSocketPingInterval))
+			if conn.WriteMessage(websocket.TextMessage, data) != nil {
+				return
+			}
+		case <-ping.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(webSocketPingInterval)) != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
 	}
-
-	writeJSONResponse(w, response)
 }
 
-func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
-	response := &model.HealthResponse{
-		Status:    "healthy",
-		Timestamp: time.Now(),
+// GetUnknownFields reports the request and response fields seen since startup
+// that the proxy doesn't model
+func (h *Handler) GetUnknownFields(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"fields": h.schema.Report(),
 	}
 
 	writeJSONResponse(w, response)
 }
 
-func (h *Handler) UI(w http.ResponseWriter, r *http.Request) {
-	htmlContent, err := os.ReadFile("index.html")
+// GetMetaSchema describes the stored schema, the features that decide what
+// gets recorded, and how stored data is encoded
+func (h *Handler) GetMetaSchema(w http.ResponseWriter, r *http.Request) {
+	tables, err := h.storageService.GetSchema()
 	if err != nil {
-		// Error reading index.html
-		http.Error(w, "UI not available", http.StatusNotFound)
+		log.Printf("❌ Error reading storage schema: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to read storage schema"), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/html")
-	w.Write(htmlContent)
+	features := h.modelRouter.Features()
+	if h.shadow.Status().Enabled {
+		features = append(features, "shadow")
+	}
+	if h.ingestToken != "" {
+		features = append(features, "usage_ingest")
+	}
+	if h.idle.Enabled() {
+		features = append(features, "idle_sessions")
+	}
+	if h.notifier.Enabled() {
+		features = append(features, "notifications")
+	}
+	if h.readOnly {
+		features = append(features, "read_only")
+	}
+
+	writeJSONResponse(w, &model.SchemaInfo{
+		SchemaVersion: service.SchemaVersion,
+		Tables:        tables,
+		Features:      features,
+		Formats:       service.StoredDataFormats(),
+		Changelog:     service.SchemaChangelog(),
+	})
 }
 
-func (h *Handler) GetRequests(w http.ResponseWriter, r *http.Request) {
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	if page < 1 {
-		page = 1
+func (h *Handler) GetProviderHealth(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"providers": h.modelRouter.ProviderHealth(),
 	}
 
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	if limit <= 0 {
-		limit = 10 // Default limit
+	writeJSONResponse(w, response)
+}
+
+func (h *Handler) GetProviderKeys(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"keys": h.modelRouter.KeyUsage(),
 	}
 
-	// Get model filter from query parameters
-	modelFilter := r.URL.Query().Get("model")
-	if modelFilter == "" {
-		modelFilter = "all"
+	writeJSONResponse(w, response)
+}
+
+// maxIngestEvents bounds the usage events accepted in one post
+const maxIngestEvents = 1000
+
+// IngestUsage records usage that didn't go through the proxy, so stats reflect
+// total consumption. The body is a single event or {"events": [...]}.
+func (h *Handler) IngestUsage(w http.ResponseWriter, r *http.Request) {
+	if h.ingestToken != "" {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.ingestToken)) != 1 {
+			writeErrorResponse(w, h.translate(r, "Invalid ingest token"), http.StatusUnauthorized)
+			return
+		}
 	}
 
-	// Get all requests with model filter applied at storage level
-	allRequests, err := h.storageService.GetAllRequests(modelFilter)
-	if err != nil {
-		log.Printf("Error getting requests: %v", err)
-		http.Error(w, "Failed to get requests", http.StatusInternalServerError)
+	var body struct {
+		Events []model.UsageEvent `json:"events"`
+		model.UsageEvent
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErrorResponse(w, h.translate(r, "Invalid usage events"), http.StatusBadRequest)
+		return
+	}
+	events := body.Events
+	if events == nil {
+		events = []model.UsageEvent{body.UsageEvent}
+	}
+	if len(events) == 0 || len(events) > maxIngestEvents {
+		writeErrorResponse(w, h.catalog.Sprintf(h.catalog.Negotiate(r.Header.Get("Accept-Language")), "Expected between 1 and %d usage events", maxIngestEvents), http.StatusBadRequest)
 		return
 	}
 
-	// Convert pointers to values for consistency
-	requests := make([]model.RequestLog, len(allRequests))
-	for i, req := range allRequests {
-		if req != nil {
-			requests[i] = *req
+	now := time.Now()
+	ids := make([]string, len(events))
+	for i := range events {
+		if err := service.NormalizeUsageEvent(&events[i], now); err != nil {
+			writeErrorResponse(w, fmt.Sprintf("event %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		if events[i].ID == "" {
+			events[i].ID = generateRequestID()
 		}
+		ids[i] = events[i].ID
 	}
 
-	// Calculate total before pagination
-	total := len(requests)
-
-	// Apply pagination
-	start := (page - 1) * limit
-	end := start + limit
-	if start >= len(requests) {
-		requests = []model.RequestLog{}
-	} else {
-		if end > len(requests) {
-			end = len(requests)
-		}
-		requests = requests[start:end]
+	if err := h.storageService.SaveUsageEvents(events); err != nil {
+		log.Printf("❌ Error saving usage events: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to save usage events"), http.StatusInternalServerError)
+		return
 	}
+	log.Printf("📥 Ingested %d usage event(s) from %s", len(events), events[0].Source)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(struct {
-		Requests []model.RequestLog `json:"requests"`
-		Total    int                `json:"total"`
-	}{
-		Requests: requests,
-		Total:    total,
+	w.WriteHeader(http.StatusCreated)
+	writeJSONResponse(w, map[string]interface{}{
+		"accepted": len(events),
+		"ids":      ids,
 	})
 }
 
-func (h *Handler) DeleteRequests(w http.ResponseWriter, r *http.Request) {
-
-	clearedCount, err := h.storageService.ClearRequests()
+// GetConfigSnapshots lists the recorded config generations, newest first
+func (h *Handler) GetConfigSnapshots(w http.ResponseWriter, r *http.Request) {
+	snapshots, err := h.storageService.GetConfigSnapshots()
 	if err != nil {
-		log.Printf("Error clearing requests: %v", err)
-		writeErrorResponse(w, "Error clearing request history", http.StatusInternalServerError)
+		log.Printf("❌ Error getting config snapshots: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get config snapshots"), http.StatusInternalServerError)
 		return
 	}
 
-	response := map[string]interface{}{
-		"message": "Request history cleared",
-		"deleted": clearedCount,
+	writeJSONResponse(w, map[string]interface{}{
+		"current":   h.configSnapshots.Generation(),
+		"snapshots": snapshots,
+	})
+}
+
+// GetConfigSnapshot returns the routing configuration of one generation
+func (h *Handler) GetConfigSnapshot(w http.ResponseWriter, r *http.Request) {
+	generation, err := strconv.ParseInt(mux.Vars(r)["generation"], 10, 64)
+	if err != nil || generation <= 0 {
+		writeErrorResponse(w, h.translate(r, "Invalid config generation"), http.StatusBadRequest)
+		return
 	}
 
-	writeJSONResponse(w, response)
+	snapshot, err := h.storageService.GetConfigSnapshot(generation)
+	if err != nil {
+		log.Printf("❌ Error getting config snapshot: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get config snapshots"), http.StatusInternalServerError)
+		return
+	}
+	if snapshot == nil {
+		writeErrorResponse(w, h.translate(r, "Config generation not found"), http.StatusNotFound)
+		return
+	}
+
+	writeJSONResponse(w, snapshot)
 }
 
 func (h *Handler) NotFound(w http.ResponseWriter, r *http.Request) {
-	writeErrorResponse(w, "Not found", http.StatusNotFound)
+	writeErrorResponse(w, h.translate(r, "Not found"), http.StatusNotFound)
 }
 
-func (h *Handler) handleStreamingResponse(w http.ResponseWriter, resp *http.Response, requestLog *model.RequestLog, startTime time.Time) {
+func (h *Handler) handleStreamingResponse(w http.ResponseWriter, resp *http.Response, requestLog *model.RequestLog, startTime time.Time, retryTrace *model.RetryTrace) {
 
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -259,7 +2386,11 @@ func (h *Handler) handleStreamingResponse(w http.ResponseWriter, resp *http.Resp
 			ResponseTime: time.Since(startTime).Milliseconds(),
 			IsStreaming:  true,
 			CompletedAt:  time.Now().Format(time.RFC3339),
+			Retries:      retryTrace.Attempts,
+			Failover:     retryTrace.Failover,
+			Origin:       responseOrigin(retryTrace),
 		}
+		setResponseSizes(responseLog, resp.Body, int64(len(errorBytes)))
 
 		requestLog.Response = responseLog
 		if err := h.storageService.UpdateRequestWithResponse(requestLog); err != nil {
@@ -273,24 +2404,44 @@ func (h *Handler) handleStreamingResponse(w http.ResponseWriter, resp *http.Resp
 
 	var fullResponseText strings.Builder
 	var toolCalls []model.ContentBlock
+	toolInputs := make(map[int]*strings.Builder) // content block index -> input JSON so far
+	toolCallIndex := make(map[int]int)           // content block index -> position in toolCalls
 	var streamingChunks []string
 	var finalUsage *model.AnthropicUsage
 	var messageID string
 	var modelName string
 	var stopReason string
+	var firstChunkAt, firstTokenAt, lastChunkAt, progressAt time.Time
+
+	streamModel := requestLog.RoutedModel
+	if streamModel == "" {
+		streamModel = requestLog.Model
+	}
+	live := h.streams.Start(requestLog.RequestID, streamModel)
+	defer h.streams.Finish(live)
 
-	scanner := bufio.NewScanner(resp.Body)
+	body := &countingBody{ReadCloser: resp.Body}
+	scanner := bufio.NewScanner(body)
 	for scanner.Scan() {
 		line := scanner.Text()
 		if line == "" || !strings.HasPrefix(line, "data:") {
 			continue
 		}
 
+		lastChunkAt = time.Now()
+		if firstChunkAt.IsZero() {
+			firstChunkAt = lastChunkAt
+		}
 		streamingChunks = append(streamingChunks, line)
 		fmt.Fprintf(w, "%s\n\n", line)
 		if f, ok := w.(http.Flusher); ok {
 			f.Flush()
 		}
+		live.Publish(line)
+		if lastChunkAt.Sub(progressAt) >= service.FeedProgressInterval {
+			progressAt = lastChunkAt
+			h.feed.StreamProgress(requestLog, len(streamingChunks), lastChunkAt.Sub(startTime))
+		}
 
 		jsonData := strings.TrimPrefix(line, "data: ")
 
@@ -300,6 +2451,7 @@ func (h *Handler) handleStreamingResponse(w http.ResponseWriter, resp *http.Resp
 			log.Printf("⚠️ Error unmarshalling streaming event: %v", err)
 			continue
 		}
+		h.schema.ObserveStreamEvent(requestLog.RequestID, genericEvent)
 
 		// Capture metadata from message_start event
 		if eventType, ok := genericEvent["type"].(string); ok && eventType == "message_start" {
@@ -317,8 +2469,13 @@ func (h *Handler) handleStreamingResponse(w http.ResponseWriter, resp *http.Resp
 			}
 		}
 
-		// Capture usage data from message_delta event
+		// Capture the stop reason and usage data from message_delta event
 		if eventType, ok := genericEvent["type"].(string); ok && eventType == "message_delta" {
+			if delta, ok := genericEvent["delta"].(map[string]interface{}); ok {
+				if reason, ok := delta["stop_reason"].(string); ok {
+					stopReason = reason
+				}
+			}
 			// Usage is at top level for message_delta events
 			if usage, ok := genericEvent["usage"].(map[string]interface{}); ok {
 				// Create finalUsage if it doesn't exist yet
@@ -352,17 +2509,24 @@ func (h *Handler) handleStreamingResponse(w http.ResponseWriter, resp *http.Resp
 
 		switch event.Type {
 		case "content_block_delta":
+			if firstTokenAt.IsZero() {
+				firstTokenAt = lastChunkAt
+			}
 			if event.Delta != nil {
 				if event.Delta.Type == "text_delta" {
 					fullResponseText.WriteString(event.Delta.Text)
-				} else if event.Delta.Type == "input_json_delta" {
-					if event.Index != nil && *event.Index < len(toolCalls) {
-						toolCalls[*event.Index].Input = append(toolCalls[*event.Index].Input, event.Delta.Input...)
+				} else if event.Delta.Type == "input_json_delta" && event.Index != nil {
+					if input, ok := toolInputs[*event.Index]; ok {
+						input.WriteString(event.Delta.PartialJSON)
 					}
 				}
 			}
 		case "content_block_start":
-			if event.ContentBlock != nil && event.ContentBlock.Type == "tool_use" {
+			if event.ContentBlock != nil && event.ContentBlock.Type == "tool_use" && event.Index != nil {
+				// Indexes count every content block, text included, and the
+				// input arrives in pieces after this empty placeholder
+				toolCallIndex[*event.Index] = len(toolCalls)
+				toolInputs[*event.Index] = &strings.Builder{}
 				toolCalls = append(toolCalls, *event.ContentBlock)
 			}
 		case "message_stop":
@@ -377,7 +2541,18 @@ func (h *Handler) handleStreamingResponse(w http.ResponseWriter, resp *http.Resp
 		ResponseTime:    time.Since(startTime).Milliseconds(),
 		IsStreaming:     true,
 		CompletedAt:     time.Now().Format(time.RFC3339),
+		Retries:         retryTrace.Attempts,
+		Failover:        retryTrace.Failover,
+		Origin:          responseOrigin(retryTrace),
+	}
+	setResponseSizes(responseLog, resp.Body, body.n)
+
+	for index, input := range toolInputs {
+		if input.Len() > 0 {
+			toolCalls[toolCallIndex[index]].Input = json.RawMessage(input.String())
+		}
 	}
+	h.modelRouter.ObserveToolCalls(toolCalls)
 
 	// Create a structured response body that matches Anthropic's format
 	var contentBlocks []model.AnthropicContentBlock
@@ -402,6 +2577,7 @@ func (h *Handler) handleStreamingResponse(w http.ResponseWriter, resp *http.Resp
 	if finalUsage != nil {
 		responseBody["usage"] = finalUsage
 	}
+	setStreamTiming(responseLog, startTime, firstChunkAt, firstTokenAt, lastChunkAt, len(streamingChunks), finalUsage)
 
 	// Marshal to JSON for storage
 	responseBodyBytes, err := json.Marshal(responseBody)
@@ -424,7 +2600,7 @@ func (h *Handler) handleStreamingResponse(w http.ResponseWriter, resp *http.Resp
 	}
 }
 
-func (h *Handler) handleNonStreamingResponse(w http.ResponseWriter, resp *http.Response, requestLog *model.RequestLog, startTime time.Time) {
+func (h *Handler) handleNonStreamingResponse(w http.ResponseWriter, resp *http.Response, requestLog *model.RequestLog, startTime time.Time, retryTrace *model.RetryTrace, retry *truncationRetry) {
 	responseBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Printf("❌ Error reading Anthropic response: %v", err)
@@ -438,7 +2614,11 @@ func (h *Handler) handleNonStreamingResponse(w http.ResponseWriter, resp *http.R
 		ResponseTime: time.Since(startTime).Milliseconds(),
 		IsStreaming:  false,
 		CompletedAt:  time.Now().Format(time.RFC3339),
+		Retries:      retryTrace.Attempts,
+		Failover:     retryTrace.Failover,
+		Origin:       responseOrigin(retryTrace),
 	}
+	setResponseSizes(responseLog, resp.Body, int64(len(responseBytes)))
 
 	// Parse the response as AnthropicResponse for consistent structure
 	if resp.StatusCode == http.StatusOK {
@@ -446,6 +2626,15 @@ func (h *Handler) handleNonStreamingResponse(w http.ResponseWriter, resp *http.R
 		if err := json.Unmarshal(responseBytes, &anthropicResp); err == nil {
 			// Successfully parsed - store the structured response
 			responseLog.Body = json.RawMessage(responseBytes)
+			h.schema.ObserveResponse(requestLog.RequestID, responseBytes)
+
+			// AnthropicContentBlock only keeps text, so read tool calls separately
+			var toolCalls struct {
+				Content []model.ContentBlock `json:"content"`
+			}
+			if json.Unmarshal(responseBytes, &toolCalls) == nil {
+				h.modelRouter.ObserveToolCalls(toolCalls.Content)
+			}
 		} else {
 			// If parsing fails, store as text but log the error
 			log.Printf("⚠️ Failed to parse Anthropic response: %v", err)
@@ -457,10 +2646,19 @@ func (h *Handler) handleNonStreamingResponse(w http.ResponseWriter, resp *http.R
 		responseLog.BodyText = string(responseBytes)
 	}
 
+	// A response cut off in a tool call may be replaced by a retry's
+	var continuation []byte
+	if resp.StatusCode == http.StatusOK {
+		continuation, _ = h.continueTruncated(retry, requestLog, responseBytes)
+	}
+
 	requestLog.Response = responseLog
 	if err := h.storageService.UpdateRequestWithResponse(requestLog); err != nil {
 		log.Printf("❌ Error updating request with response: %v", err)
 	}
+	if continuation != nil {
+		responseBytes = continuation
+	}
 
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("❌ Anthropic API error: %d %s", resp.StatusCode, string(responseBytes))
@@ -488,6 +2686,152 @@ func generateRequestID() string {
 	return hex.EncodeToString(bytes)
 }
 
+// parseTimeZone reads the "tz" query parameter, an IANA time zone such as
+// Europe/Berlin that days and hours are reported in, defaulting to the
+// server's. Errors are messages for the client.
+func parseTimeZone(r *http.Request) (*time.Location, error) {
+	value := firstQueryValue(r, "tz", "timezone")
+	if value == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(value)
+	if err != nil || value == "Local" {
+		return nil, errors.New("Invalid tz, expected an IANA time zone such as Europe/Berlin")
+	}
+	return location, nil
+}
+
+// parseTimeRange reads the RFC3339 "start" and "end" query parameters, in the
+// time zone of "tz". End defaults to now and start to span before end, or the
+// beginning of time when span is 0. Errors are messages for the client.
+func parseTimeRange(r *http.Request, span time.Duration) (time.Time, time.Time, error) {
+	location, err := parseTimeZone(r)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end := time.Now().In(location)
+	if value := firstQueryValue(r, "end", "to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("Invalid end time, expected RFC3339")
+		}
+		end = parsed.In(location)
+	}
+	var start time.Time
+	if span > 0 {
+		start = end.Add(-span)
+	}
+	if value := firstQueryValue(r, "start", "from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("Invalid start time, expected RFC3339")
+		}
+		start = parsed.In(location)
+	}
+	return start, end, nil
+}
+
+// parseRequestFilter reads the filters of a listing or bulk delete, reporting
+// whether any was given. Errors are messages for the client.
+func parseRequestFilter(r *http.Request) (service.RequestFilter, bool, error) {
+	query := r.URL.Query()
+	filter := service.RequestFilter{
+		Model:     query.Get("model"),
+		ErrorType: query.Get("errorType"),
+		SessionID: query.Get("session"),
+	}
+	if value := query.Get("before"); value != "" {
+		location, err := parseTimeZone(r)
+		if err != nil {
+			return filter, false, err
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			if parsed, err = time.ParseInLocation("2006-01-02", value, location); err != nil {
+				return filter, false, errors.New("Invalid before time, expected RFC3339 or YYYY-MM-DD")
+			}
+		}
+		filter.Before = parsed
+	}
+	if value := query.Get("status"); value != "" {
+		status, err := strconv.Atoi(value)
+		if err != nil || status < 100 || status > 599 {
+			return filter, false, errors.New("Invalid status, expected an HTTP status code")
+		}
+		filter.StatusCode = status
+	}
+	return filter, filter != service.RequestFilter{}, nil
+}
+
+// firstQueryValue returns the first of the named query parameters that is set
+func firstQueryValue(r *http.Request, names ...string) string {
+	for _, name := range names {
+		if value := r.URL.Query().Get(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// responseOrigin tells a response from the routed upstream apart from one
+// the request failed over to
+func responseOrigin(retryTrace *model.RetryTrace) string {
+	if retryTrace.Failover != nil {
+		return model.ResponseOriginFallback
+	}
+	return model.ResponseOriginUpstream
+}
+
+// getWireBytes returns the request body size before decoding, as recorded by
+// the middleware
+func getWireBytes(r *http.Request) int64 {
+	if wireBytes, ok := r.Context().Value(model.WireBytesKey).(int64); ok {
+		return wireBytes
+	}
+	return int64(len(getBodyBytes(r)))
+}
+
+// countingBody counts the decoded bytes read from a response body
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// setResponseSizes records the response body size after decoding and on the
+// wire; the two only differ when the provider decompressed the body
+func setResponseSizes(responseLog *model.ResponseLog, body io.ReadCloser, decoded int64) {
+	responseLog.BodyBytes = decoded
+	responseLog.WireBytes = decoded
+	if sizer, ok := body.(provider.WireSizer); ok {
+		responseLog.WireBytes = sizer.WireBytes()
+	}
+}
+
+// setStreamTiming records how a stream was delivered: the time to its first
+// token from the start of the request, its duration from the first event to
+// the last, its number of events, and the output tokens per second between
+// the first token and the last event
+func setStreamTiming(responseLog *model.ResponseLog, start, firstChunk, firstToken, lastChunk time.Time, chunks int, usage *model.AnthropicUsage) {
+	responseLog.ChunkCount = chunks
+	if firstChunk.IsZero() {
+		return
+	}
+	responseLog.StreamDuration = lastChunk.Sub(firstChunk).Milliseconds()
+	if firstToken.IsZero() {
+		return
+	}
+	responseLog.TimeToFirstToken = firstToken.Sub(start).Milliseconds()
+	if generating := lastChunk.Sub(firstToken).Seconds(); usage != nil && usage.OutputTokens > 0 && generating > 0 {
+		responseLog.TokensPerSecond = math.Round(float64(usage.OutputTokens)/generating*10) / 10
+	}
+}
+
 func getBodyBytes(r *http.Request) []byte {
 	if bodyBytes, ok := r.Context().Value(model.BodyBytesKey).([]byte); ok {
 		return bodyBytes
@@ -509,6 +2853,51 @@ func writeErrorResponse(w http.ResponseWriter, message string, statusCode int) {
 	json.NewEncoder(w).Encode(&model.ErrorResponse{Error: message})
 }
 
+// translate returns message in the language the client prefers. Only dashboard
+// API messages are translated; errors on the proxied endpoints stay in English
+// like the upstream API's.
+func (h *Handler) translate(r *http.Request, message string) string {
+	return h.catalog.Translate(h.catalog.Negotiate(r.Header.Get("Accept-Language")), message)
+}
+
+// setRequestBody replaces the body of r with the routed req, encoded from the
+// original body according to the parsing mode
+func (h *Handler) setRequestBody(r *http.Request, original []byte, req *model.AnthropicRequest, partial, modified bool) error {
+	bodyBytes, err := h.parser.Encode(original, req, partial, modified)
+	if err != nil {
+		return err
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	r.ContentLength = int64(len(bodyBytes))
+	r.Header.Set("Content-Length", fmt.Sprintf("%d", len(bodyBytes)))
+	return nil
+}
+
+// isOverloadStatus reports whether an upstream status means "try elsewhere":
+// rate limited (429) or overloaded (529)
+func isOverloadStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == 529
+}
+
+// writeAnthropicError writes an error in the Anthropic API error format so that
+// clients like Claude Code handle it the same way as an upstream error. The
+// written body is returned for logging.
+func writeAnthropicError(w http.ResponseWriter, statusCode int, errorType, message string) []byte {
+	body, _ := json.Marshal(map[string]interface{}{
+		"type": "error",
+		"error": map[string]string{
+			"type":    errorType,
+			"message": message,
+		},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+	return body
+}
+
 // extractTextFromMessage tries multiple strategies to extract text from a message
 func extractTextFromMessage(message json.RawMessage) string {
 	// Strategy 1: Direct string (simple text message)
@@ -579,7 +2968,7 @@ func (h *Handler) GetConversations(w http.ResponseWriter, r *http.Request) {
 	conversations, err := h.conversationService.GetConversations()
 	if err != nil {
 		log.Printf("❌ Error getting conversations: %v", err)
-		writeErrorResponse(w, "Failed to get conversations", http.StatusInternalServerError)
+		writeErrorResponse(w, h.translate(r, "Failed to get conversations"), http.StatusInternalServerError)
 		return
 	}
 
@@ -654,37 +3043,75 @@ func (h *Handler) GetConversationByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	sessionID, ok := vars["id"]
 	if !ok {
-		http.Error(w, "Session ID is required", http.StatusBadRequest)
+		http.Error(w, h.translate(r, "Session ID is required"), http.StatusBadRequest)
 		return
 	}
 
 	projectPath := r.URL.Query().Get("project")
 	if projectPath == "" {
-		http.Error(w, "Project path is required", http.StatusBadRequest)
+		http.Error(w, h.translate(r, "Project path is required"), http.StatusBadRequest)
 		return
 	}
 
 	conversation, err := h.conversationService.GetConversation(projectPath, sessionID)
 	if err != nil {
 		log.Printf("❌ Error getting conversation: %v", err)
-		http.Error(w, "Conversation not found", http.StatusNotFound)
+		http.Error(w, h.translate(r, "Conversation not found"), http.StatusNotFound)
 		return
 	}
+	if report, err := h.storage(r).GetConversationReport(sessionID); err != nil {
+		log.Printf("❌ Error getting conversation report: %v", err)
+	} else {
+		conversation.Report = report
+	}
 
 	writeJSONResponse(w, conversation)
 }
 
+// AnalyzeConversation reports on a whole conversation: its prompts' grades
+// turn by turn, wasted context, repeated tool calls and tool misuse, summarized
+// by the grading model with the caller's credentials. The report is stored
+// with the conversation, replacing the one it had.
+func (h *Handler) AnalyzeConversation(w http.ResponseWriter, r *http.Request) {
+	report, err := h.grader.AnalyzeConversation(r.Context(), h.storage(r), mux.Vars(r)["id"], r.Header)
+	if errors.Is(err, service.ErrUnknownConversation) {
+		writeErrorResponse(w, h.translate(r, "Conversation not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error analyzing conversation: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to analyze conversation"), http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, report)
+}
+
+// GetConversationReport returns a conversation's stored report
+func (h *Handler) GetConversationReport(w http.ResponseWriter, r *http.Request) {
+	report, err := h.storage(r).GetConversationReport(mux.Vars(r)["id"])
+	if err != nil {
+		log.Printf("❌ Error getting conversation report: %v", err)
+		writeErrorResponse(w, h.translate(r, "Failed to get conversation report"), http.StatusInternalServerError)
+		return
+	}
+	if report == nil {
+		writeErrorResponse(w, h.translate(r, "Conversation report not found"), http.StatusNotFound)
+		return
+	}
+	writeJSONResponse(w, report)
+}
+
 func (h *Handler) GetConversationsByProject(w http.ResponseWriter, r *http.Request) {
 	projectPath := r.URL.Query().Get("project")
 	if projectPath == "" {
-		http.Error(w, "Project path is required", http.StatusBadRequest)
+		http.Error(w, h.translate(r, "Project path is required"), http.StatusBadRequest)
 		return
 	}
 
 	conversations, err := h.conversationService.GetConversationsByProject(projectPath)
 	if err != nil {
 		log.Printf("❌ Error getting project conversations: %v", err)
-		writeErrorResponse(w, "Failed to get project conversations", http.StatusInternalServerError)
+		writeErrorResponse(w, h.translate(r, "Failed to get project conversations"), http.StatusInternalServerError)
 		return
 	}
 
@@ -0,0 +1,912 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/i18n"
+	"github.com/seifghazi/claude-code-monitor/internal/middleware"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+	"github.com/seifghazi/claude-code-monitor/internal/service"
+)
+
+// fakeProvider answers requests with a canned response and remembers
+// the model it was asked for
+type fakeProvider struct {
+	name        string
+	contentType string
+	body        string
+	statuses    []int // answered in turn before settling on 200
+	models      []string
+}
+
+func (p *fakeProvider) Name() string {
+	return p.name
+}
+
+func (p *fakeProvider) ForwardRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	var body struct {
+		Model string `json:"model"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	p.models = append(p.models, body.Model)
+
+	status := http.StatusOK
+	if len(p.statuses) > 0 {
+		status, p.statuses = p.statuses[0], p.statuses[1:]
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {p.contentType}},
+		Body:       io.NopCloser(strings.NewReader(p.body)),
+	}, nil
+}
+
+func newTestHandler(t *testing.T, cfg *config.Config, providers map[string]provider.Provider) (*Handler, service.StorageService) {
+	t.Helper()
+	logger := log.New(io.Discard, "", 0)
+
+	storage, err := service.NewMemoryStorageService(&config.StorageConfig{})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	router := service.NewModelRouter(cfg, providers, logger)
+	snapshots, err := service.NewConfigSnapshots(storage, router, logger)
+	if err != nil {
+		t.Fatalf("failed to load config snapshots: %v", err)
+	}
+	catalog, err := i18n.Load("en", "", logger)
+	if err != nil {
+		t.Fatalf("failed to load catalogs: %v", err)
+	}
+	archiver, err := service.NewArchiver(&cfg.Storage, storage, router.Prices())
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+
+	grader, err := service.NewPromptGrader(cfg.Grading, router, storage, logger)
+	if err != nil {
+		t.Fatalf("failed to create grader: %v", err)
+	}
+
+	h := New(nil, storage, service.NewThreadedConversationService(storage), logger, router, service.NewScheduler(logger),
+		service.NewShadowMirror(&cfg.Shadow, router, storage, logger),
+		service.NewRequestParser(cfg.Server.ParsingMode, logger), catalog, "", snapshots,
+		service.NewRoutingCanary(cfg.Routing.Canary, storage, router, logger),
+		service.NewIdleSessionMonitor(cfg.IdleSessions, logger),
+		service.NewNotifier(cfg.Notify, logger), archiver, grader, nil, false)
+	return h, storage
+}
+
+// postMessages sends body to /v1/messages the way the logging middleware
+// hands requests to the handler
+func postMessages(h *Handler, body string, header http.Header) *httptest.ResponseRecorder {
+	bodyBytes := []byte(body)
+	r := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(bodyBytes))
+	for key, values := range header {
+		for _, value := range values {
+			r.Header.Add(key, value)
+		}
+	}
+	r = r.WithContext(context.WithValue(r.Context(), model.BodyBytesKey, bodyBytes))
+
+	w := httptest.NewRecorder()
+	h.Messages(w, r)
+	return w
+}
+
+func TestMessages_Routing(t *testing.T) {
+	const message = `{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"Hi"}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":2}}`
+	const stream = "event: message_start\n" +
+		`data: {"type":"message_start","message":{"id":"msg_1","model":"gpt-4o-mini","usage":{"input_tokens":10,"output_tokens":0}}}` + "\n\n" +
+		"event: content_block_delta\n" +
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}` + "\n\n" +
+		"event: message_delta\n" +
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":2}}` + "\n\n" +
+		"event: message_stop\n" +
+		`data: {"type":"message_stop"}` + "\n\n"
+
+	tests := []struct {
+		name             string
+		model            string
+		stream           bool
+		header           http.Header
+		expectedModel    string
+		expectedProvider string
+		expectedReason   string
+	}{
+		{"Routed non-streaming", "claude-3-5-haiku-20241022", false, nil, "gpt-4o-mini", "openai", model.RouteReasonTier},
+		{"Routed streaming", "claude-3-5-haiku-20241022", true, nil, "gpt-4o-mini", "openai", model.RouteReasonTier},
+		{"Default non-streaming", "claude-sonnet-4-20250514", false, nil, "claude-sonnet-4-20250514", "anthropic", model.RouteReasonDefault},
+		{"Default streaming", "claude-sonnet-4-20250514", true, nil, "claude-sonnet-4-20250514", "anthropic", model.RouteReasonDefault},
+		{"Override", "claude-3-5-haiku-20241022", false, http.Header{service.OverrideModelHeader: {"claude-3-5-haiku-20241022"}}, "claude-3-5-haiku-20241022", "anthropic", model.RouteReasonOverride},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType, responseBody := "application/json", message
+			if tt.stream {
+				contentType, responseBody = "text/event-stream", stream
+			}
+			providers := map[string]provider.Provider{
+				"anthropic": &fakeProvider{name: "anthropic", contentType: contentType, body: responseBody},
+				"openai":    &fakeProvider{name: "openai", contentType: contentType, body: responseBody},
+			}
+			cfg := &config.Config{Routing: config.RoutingConfig{Tiers: map[string]string{"haiku": "gpt-4o-mini"}}}
+			h, storage := newTestHandler(t, cfg, providers)
+
+			body := fmt.Sprintf(`{"model":%q,"max_tokens":256,"stream":%t,"messages":[{"role":"user","content":"hello"}]}`, tt.model, tt.stream)
+			w := postMessages(h, body, tt.header)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+			}
+			if tt.stream {
+				if !strings.Contains(w.Body.String(), `"text":"Hi"`) || !strings.Contains(w.Body.String(), "message_stop") {
+					t.Errorf("client didn't get the stream: %s", w.Body.String())
+				}
+			} else if strings.TrimSpace(w.Body.String()) != message {
+				t.Errorf("client got %s, want the upstream response", w.Body.String())
+			}
+
+			called := providers[tt.expectedProvider].(*fakeProvider)
+			if len(called.models) != 1 || called.models[0] != tt.expectedModel {
+				t.Errorf("%s was asked for %v, want [%s]", tt.expectedProvider, called.models, tt.expectedModel)
+			}
+
+			requests, _, err := storage.GetRequests(1, 10)
+			if err != nil || len(requests) != 1 {
+				t.Fatalf("GetRequests() = %d requests, %v", len(requests), err)
+			}
+			stored := requests[0]
+			if stored.OriginalModel != tt.model || stored.RoutedModel != tt.expectedModel || stored.Provider != tt.expectedProvider {
+				t.Errorf("stored %s → %s on %s, want %s → %s on %s", stored.OriginalModel, stored.RoutedModel, stored.Provider, tt.model, tt.expectedModel, tt.expectedProvider)
+			}
+			if stored.SessionID != service.SessionID(&model.AnthropicRequest{Messages: []model.AnthropicMessage{{Role: "user", Content: "hello"}}}) {
+				t.Errorf("stored session %q, want the opening message's fingerprint", stored.SessionID)
+			}
+			if stored.Routing == nil || stored.Routing.Reason != tt.expectedReason {
+				t.Errorf("stored routing %+v, want reason %s", stored.Routing, tt.expectedReason)
+			}
+			if stored.Response == nil || stored.Response.StatusCode != http.StatusOK || stored.Response.IsStreaming != tt.stream {
+				t.Fatalf("stored response %+v", stored.Response)
+			}
+			if stored.Response.Origin != model.ResponseOriginUpstream {
+				t.Errorf("Origin = %q, want upstream", stored.Response.Origin)
+			}
+			if tt.stream && len(stored.Response.StreamingChunks) == 0 {
+				t.Error("stored no streaming chunks")
+			}
+		})
+	}
+}
+
+func TestMessages_Failover(t *testing.T) {
+	const message = `{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"Hi"}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":2}}`
+	anthropic := &fakeProvider{name: "anthropic", contentType: "application/json", body: message, statuses: []int{529}}
+	// The fallback shares the provider, and its single slot, with the primary
+	cfg := &config.Config{
+		Routing: config.RoutingConfig{Fallback: config.FallbackConfig{
+			Models: map[string]string{"claude-sonnet-4-20250514": "claude-3-5-haiku-20241022"},
+		}},
+		Quotas: map[string]config.QuotaConfig{"anthropic": {MaxConcurrent: 1}},
+	}
+	h, storage := newTestHandler(t, cfg, map[string]provider.Provider{"anthropic": anthropic})
+
+	w := postMessages(h, `{"model":"claude-sonnet-4-20250514","max_tokens":256,"messages":[{"role":"user","content":"hello"}]}`, nil)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+	if expected := []string{"claude-sonnet-4-20250514", "claude-3-5-haiku-20241022"}; !reflect.DeepEqual(anthropic.models, expected) {
+		t.Errorf("anthropic was asked for %v, want %v", anthropic.models, expected)
+	}
+	requests, _, err := storage.GetRequests(1, 10)
+	if err != nil || len(requests) != 1 {
+		t.Fatalf("GetRequests() = %d requests, %v", len(requests), err)
+	}
+	if failover := requests[0].Response.Failover; failover == nil || failover.StatusCode != 529 {
+		t.Errorf("stored failover %+v, want one from the 529", failover)
+	}
+}
+
+func TestMessages_FailoverPriority(t *testing.T) {
+	const message = `{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"Hi"}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":2}}`
+	anthropic := &fakeProvider{name: "anthropic", contentType: "application/json", body: message, statuses: []int{529}}
+	openai := &fakeProvider{name: "openai", contentType: "application/json", body: message}
+	cfg := &config.Config{
+		Routing: config.RoutingConfig{Fallback: config.FallbackConfig{
+			Models: map[string]string{"claude-sonnet-4-20250514": "gpt-4o-mini"},
+		}},
+		Quotas: map[string]config.QuotaConfig{"openai": {MaxConcurrent: 1, Policy: service.QuotaPolicyQueue}},
+	}
+	h, _ := newTestHandler(t, cfg, map[string]provider.Provider{"anthropic": anthropic, "openai": openai})
+
+	waitForQueue := func(interactive, background int) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			for _, status := range h.modelRouter.QuotaStatus() {
+				if status.Provider == "openai" && status.QueuedInteractive == interactive && status.QueuedBackground == background {
+					return
+				}
+			}
+		}
+		t.Fatalf("openai queue never held %d interactive and %d background requests: %+v", interactive, background, h.modelRouter.QuotaStatus())
+	}
+
+	// Take the fallback's only slot and queue background work behind it
+	route := func(priority string) *service.RoutingDecision {
+		return &service.RoutingDecision{Provider: openai, TargetModel: "gpt-4o-mini", Explanation: model.RoutingExplanation{Priority: priority}}
+	}
+	hold, err := h.modelRouter.AcquireQuota(context.Background(), route(model.PriorityInteractive))
+	if err != nil {
+		t.Fatalf("AcquireQuota() returned error: %v", err)
+	}
+	served := make(chan int, 2) // requests openai had answered when each background waiter got its slot
+	for i := 0; i < 2; i++ {
+		go func() {
+			release, err := h.modelRouter.AcquireQuota(context.Background(), route(model.PriorityBackground))
+			if err != nil {
+				served <- -1
+				return
+			}
+			served <- len(openai.models)
+			release()
+		}()
+	}
+	waitForQueue(0, 2)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- postMessages(h, `{"model":"claude-sonnet-4-20250514","max_tokens":256,"messages":[{"role":"user","content":"hello"}]}`, nil)
+	}()
+	waitForQueue(1, 2)
+	hold()
+
+	if w := <-done; w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+	for i := 0; i < 2; i++ {
+		if n := <-served; n != 1 {
+			t.Errorf("a background waiter got its slot after openai answered %d requests, want the failed over one served first", n)
+		}
+	}
+}
+
+func TestMessages_Budget(t *testing.T) {
+	tests := []struct {
+		name              string
+		outputTokens      int // of the request spending the budget, at $75 per million
+		expectedStatus    int
+		expectedErrorType string
+		expectedMessage   string
+	}{
+		{"Past the blocking threshold", 100000, http.StatusTooManyRequests, "rate_limit_error", "daily budget of $10.00 is 75% used"},
+		{"Budget used up", 150000, http.StatusForbidden, "permission_error", "daily budget of $10.00 is used up"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := fmt.Sprintf(`{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"Hi"}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":%d}}`, tt.outputTokens)
+			cfg := &config.Config{Budget: config.BudgetConfig{
+				Daily:      10,
+				Thresholds: []config.BudgetThresholdConfig{{Percent: 50, Block: true}},
+			}}
+			h, _ := newTestHandler(t, cfg, map[string]provider.Provider{
+				"anthropic": &fakeProvider{name: "anthropic", contentType: "application/json", body: message},
+			})
+			body := `{"model":"claude-opus-4-20250514","max_tokens":256,"messages":[{"role":"user","content":"hello"}]}`
+
+			if w := postMessages(h, body, nil); w.Code != http.StatusOK {
+				t.Fatalf("status of the first request = %d, body %s", w.Code, w.Body.String())
+			}
+			w := postMessages(h, body, nil)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.expectedStatus, w.Body.String())
+			}
+			var response struct {
+				Error struct {
+					Type    string `json:"type"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to decode response %s: %v", w.Body.String(), err)
+			}
+			if response.Error.Type != tt.expectedErrorType || !strings.Contains(response.Error.Message, tt.expectedMessage) {
+				t.Errorf("error = %+v, want %s naming the %s", response.Error, tt.expectedErrorType, tt.expectedMessage)
+			}
+		})
+	}
+}
+
+func TestMessages_SyntheticOrigin(t *testing.T) {
+	anthropic := &fakeProvider{name: "anthropic", contentType: "application/json", body: `{}`}
+	cfg := &config.Config{Routing: config.RoutingConfig{ModelAccess: config.ModelAccessConfig{Deny: []string{"*opus*"}}}}
+	h, storage := newTestHandler(t, cfg, map[string]provider.Provider{"anthropic": anthropic})
+
+	w := postMessages(h, `{"model":"claude-opus-4-20250514","max_tokens":256,"messages":[{"role":"user","content":"hello"}]}`, nil)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", w.Code)
+	}
+	if len(anthropic.models) != 0 {
+		t.Errorf("denied request reached the provider: %v", anthropic.models)
+	}
+
+	requests, _, err := storage.GetRequests(1, 10)
+	if err != nil || len(requests) != 1 || requests[0].Response == nil {
+		t.Fatalf("GetRequests() = %+v, %v", requests, err)
+	}
+	if origin := requests[0].Response.Origin; origin != model.ResponseOriginSynthetic {
+		t.Errorf("Origin = %q, want synthetic", origin)
+	}
+}
+
+func TestExportRequests(t *testing.T) {
+	h, storage := newTestHandler(t, &config.Config{}, map[string]provider.Provider{})
+	request := &model.RequestLog{
+		RequestID: "req-1",
+		Timestamp: "2025-03-01T10:00:00Z",
+		Method:    "POST",
+		Endpoint:  "/v1/messages",
+		Body:      map[string]string{},
+		Model:     "claude-sonnet-4",
+	}
+	if _, err := storage.SaveRequest(request); err != nil {
+		t.Fatalf("SaveRequest() returned error: %v", err)
+	}
+	request.Response = &model.ResponseLog{StatusCode: http.StatusOK, Body: json.RawMessage(`{"usage":{"input_tokens":1000,"output_tokens":100}}`)}
+	if err := storage.UpdateRequestWithResponse(request); err != nil {
+		t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedType   string
+		expectedBody   []string
+		unexpected     string
+	}{
+		{"JSON lines", "from=2025-03-01T00:00:00Z&to=2025-03-02T00:00:00Z", http.StatusOK, "application/x-ndjson", []string{`"requestId":"req-1"`, `"costUsd":0.0045`}, ""},
+		{"CSV", "format=csv&from=2025-03-01T00:00:00Z&to=2025-03-02T00:00:00Z", http.StatusOK, "text/csv; charset=utf-8", []string{"request_id,timestamp,", "req-1,2025-03-01T10:00:00Z,/v1/messages,claude-sonnet-4,", ",1000,100,0,0,0.004500,"}, ""},
+		{"Outside the range", "format=csv&from=2025-04-01T00:00:00Z", http.StatusOK, "text/csv; charset=utf-8", []string{"request_id,timestamp,"}, "req-1"},
+		{"Invalid format", "format=xlsx", http.StatusBadRequest, "application/json", []string{"Invalid format"}, ""},
+		{"Invalid time", "from=yesterday", http.StatusBadRequest, "application/json", []string{"Invalid start time"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ExportRequests(w, httptest.NewRequest(http.MethodGet, "/api/requests/export?"+tt.query, nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.expectedStatus, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.expectedType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.expectedType)
+			}
+			for _, want := range tt.expectedBody {
+				if !strings.Contains(w.Body.String(), want) {
+					t.Errorf("body %s doesn't contain %s", w.Body.String(), want)
+				}
+			}
+			if tt.unexpected != "" && strings.Contains(w.Body.String(), tt.unexpected) {
+				t.Errorf("body %s contains %s", w.Body.String(), tt.unexpected)
+			}
+		})
+	}
+}
+
+func TestGetRequest(t *testing.T) {
+	h, storage := newTestHandler(t, &config.Config{}, map[string]provider.Provider{})
+	for _, id := range []string{"req-1", "old-req-1", "archived"} {
+		request := &model.RequestLog{
+			RequestID: id,
+			Timestamp: "2025-03-01T10:00:00Z",
+			Method:    "POST",
+			Endpoint:  "/v1/messages",
+			Headers:   map[string][]string{"User-Agent": {"claude-cli/1.0"}},
+			Body:      map[string]string{"id": id},
+		}
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+	}
+	if _, err := storage.ArchiveRequests([]string{"archived"}, "archive/2025-03-01/requests-archived.jsonl.gz"); err != nil {
+		t.Fatalf("ArchiveRequests() returned error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		id             string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Exact ID", "req-1", http.StatusOK, `"body":{"id":"req-1"}`},
+		{"Headers are included", "req-1", http.StatusOK, `"claude-cli/1.0"`},
+		{"Suffix of another ID", "eq-1", http.StatusNotFound, "Request not found"},
+		{"Archived", "archived", http.StatusGone, "Request has been archived"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/requests/"+tt.id, nil), map[string]string{"id": tt.id})
+			h.GetRequest(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.expectedStatus, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.expectedBody) {
+				t.Errorf("body %s doesn't contain %s", w.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestGetRequestChunks(t *testing.T) {
+	h, storage := newTestHandler(t, &config.Config{}, map[string]provider.Provider{})
+	request := &model.RequestLog{
+		RequestID: "streamed",
+		Timestamp: "2025-03-01T10:00:00Z",
+		Method:    "POST",
+		Endpoint:  "/v1/messages",
+		Headers:   map[string][]string{},
+		Body:      map[string]string{},
+	}
+	if _, err := storage.SaveRequest(request); err != nil {
+		t.Fatalf("SaveRequest() returned error: %v", err)
+	}
+	request.Response = &model.ResponseLog{StatusCode: 200, IsStreaming: true}
+	for i := 0; i < 5; i++ {
+		request.Response.StreamingChunks = append(request.Response.StreamingChunks, fmt.Sprintf("data: {\"n\": %d}", i))
+	}
+	if err := storage.UpdateRequestWithResponse(request); err != nil {
+		t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedChunks []string
+	}{
+		{"Default page", "", http.StatusOK, []string{"0", "1", "2", "3", "4"}},
+		{"Middle page", "?offset=1&limit=2", http.StatusOK, []string{"1", "2"}},
+		{"Last page", "?offset=4&limit=2", http.StatusOK, []string{"4"}},
+		{"Past the end", "?offset=9", http.StatusOK, []string{}},
+		{"Negative offset", "?offset=-1", http.StatusBadRequest, nil},
+		{"Zero limit", "?limit=0", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/requests/streamed/chunks"+tt.query, nil), map[string]string{"id": "streamed"})
+			h.GetRequestChunks(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.expectedStatus, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var page struct {
+				Total  int      `json:"total"`
+				Chunks []string `json:"chunks"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatalf("body isn't JSON: %s", w.Body.String())
+			}
+			chunks := []string{}
+			for _, chunk := range page.Chunks {
+				chunks = append(chunks, strings.TrimSuffix(strings.TrimPrefix(chunk, `data: {"n": `), "}"))
+			}
+			if page.Total != 5 || !reflect.DeepEqual(chunks, tt.expectedChunks) {
+				t.Errorf("page = %d of %d: %v, want %v", len(page.Chunks), page.Total, chunks, tt.expectedChunks)
+			}
+		})
+	}
+}
+
+func TestSetStreamTiming(t *testing.T) {
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	tests := []struct {
+		name                   string
+		firstChunk, firstToken time.Time
+		lastChunk              time.Time
+		chunks                 int
+		usage                  *model.AnthropicUsage
+		expected               model.ResponseLog
+	}{
+		{"Stream", at(300), at(500), at(2500), 12, &model.AnthropicUsage{OutputTokens: 150},
+			model.ResponseLog{TimeToFirstToken: 500, StreamDuration: 2200, ChunkCount: 12, TokensPerSecond: 75}},
+		{"No usage", at(300), at(500), at(2500), 12, nil,
+			model.ResponseLog{TimeToFirstToken: 500, StreamDuration: 2200, ChunkCount: 12}},
+		{"No tokens", at(300), time.Time{}, at(400), 2, nil,
+			model.ResponseLog{StreamDuration: 100, ChunkCount: 2}},
+		{"No events", time.Time{}, time.Time{}, time.Time{}, 0, nil,
+			model.ResponseLog{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var responseLog model.ResponseLog
+			setStreamTiming(&responseLog, start, tt.firstChunk, tt.firstToken, tt.lastChunk, tt.chunks, tt.usage)
+			if !reflect.DeepEqual(responseLog, tt.expected) {
+				t.Errorf("setStreamTiming() = %+v, want %+v", responseLog, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTenancy(t *testing.T) {
+	cfg := &config.Config{
+		Tenancy: config.TenancyConfig{Enable: true, AdminKeys: []string{"sk-admin"}},
+		Users: []config.UserPolicyConfig{
+			{Name: "alice", APIKeys: []string{"sk-alice"}},
+			{Name: "bob", APIKeys: []string{"sk-bob"}},
+		},
+	}
+	h, storage := newTestHandler(t, cfg, map[string]provider.Provider{})
+	tenancy, err := service.NewTenancy(cfg.Tenancy, h.modelRouter)
+	if err != nil {
+		t.Fatalf("NewTenancy() returned error: %v", err)
+	}
+	h.tenancy = tenancy
+	for i, user := range []string{"alice", "alice", "bob"} {
+		request := &model.RequestLog{
+			RequestID: fmt.Sprintf("req-%d", i),
+			Timestamp: "2025-03-01T10:00:00Z",
+			Method:    "POST",
+			Endpoint:  "/v1/messages",
+			Body:      map[string]string{},
+			Routing:   &model.RoutingExplanation{User: user},
+		}
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+	}
+
+	router := mux.NewRouter()
+	router.Use(h.Tenancy)
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/requests", h.GetRequests).Methods("GET")
+	api.HandleFunc("/requests/{id}", h.GetRequest).Methods("GET")
+	api.HandleFunc("/routing/rules", h.GetRoutingRules).Methods("GET")
+	server := h.VersionedAPI(router)
+
+	tests := []struct {
+		name           string
+		path           string
+		apiKey         string
+		basicAuth      bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"No key", "/api/v1/requests", "", false, http.StatusUnauthorized, "Sign in with your API key"},
+		{"Unknown key", "/api/v1/requests", "sk-mallory", false, http.StatusUnauthorized, "Sign in with your API key"},
+		{"Own requests", "/api/v1/requests", "sk-alice", false, http.StatusOK, `"total":2`},
+		{"Basic auth", "/api/v1/requests", "sk-bob", true, http.StatusOK, `"total":1`},
+		{"Another user's request", "/api/v1/requests/req-2", "sk-alice", false, http.StatusNotFound, "Request not found"},
+		{"Admin sees everyone", "/api/v1/requests", "sk-admin", false, http.StatusOK, `"total":3`},
+		{"Admin-only endpoint", "/api/v1/routing/rules", "sk-alice", false, http.StatusForbidden, "Only admins can use this endpoint"},
+		{"Admin-only endpoint as admin", "/api/v1/routing/rules", "sk-admin", false, http.StatusOK, ""},
+		{"Unversioned path", "/api/requests", "sk-alice", false, http.StatusOK, `"total":2`},
+		{"Unversioned admin-only endpoint", "/api/routing/rules", "sk-alice", false, http.StatusForbidden, "Only admins can use this endpoint"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.basicAuth {
+				r.SetBasicAuth("", tt.apiKey)
+			} else if tt.apiKey != "" {
+				r.Header.Set("x-api-key", tt.apiKey)
+			}
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.expectedStatus, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.expectedBody) {
+				t.Errorf("body %s doesn't contain %s", w.Body.String(), tt.expectedBody)
+			}
+			if deprecated := w.Header().Get("Deprecation") != ""; deprecated != !strings.HasPrefix(tt.path, "/api/v1/") {
+				t.Errorf("Deprecation header = %q for %s", w.Header().Get("Deprecation"), tt.path)
+			}
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	h, storage := newTestHandler(t, &config.Config{}, map[string]provider.Provider{})
+	h.readOnly = true
+	request := &model.RequestLog{
+		RequestID: "req-1",
+		Timestamp: "2025-03-01T10:00:00Z",
+		Method:    "POST",
+		Endpoint:  "/v1/messages",
+		Body:      map[string]string{},
+	}
+	if _, err := storage.SaveRequest(request); err != nil {
+		t.Fatalf("SaveRequest() returned error: %v", err)
+	}
+
+	router := mux.NewRouter()
+	router.Use(h.ReadOnly)
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/requests", h.GetRequests).Methods("GET")
+	api.HandleFunc("/requests", h.DeleteRequests).Methods("DELETE")
+	api.HandleFunc("/requests/{id}/tags", h.AddRequestTags).Methods("POST")
+	api.HandleFunc("/requests/{id}/grade", h.GradeRequest).Methods("POST")
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Tag a request", http.MethodPost, "/api/v1/requests/req-1/tags", `{"tags": ["slow"]}`, http.StatusForbidden, "This proxy is read-only"},
+		{"Grade a request", http.MethodPost, "/api/v1/requests/req-1/grade", "", http.StatusForbidden, "This proxy is read-only"},
+		{"Delete requests", http.MethodDelete, "/api/v1/requests", "", http.StatusForbidden, "This proxy is read-only"},
+		{"List requests", http.MethodGet, "/api/v1/requests", "", http.StatusOK, `"total":1`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.expectedStatus, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.expectedBody) {
+				t.Errorf("body %s doesn't contain %s", w.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+
+	if tags, _ := storage.GetTags(); len(tags) != 0 {
+		t.Errorf("tags after a read-only write = %v, want none", tags)
+	}
+}
+
+func TestGetAPISpec(t *testing.T) {
+	h, _ := newTestHandler(t, &config.Config{}, map[string]provider.Provider{})
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/messages", h.Messages).Methods("POST")
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/openapi.json", h.GetAPISpec(router)).Methods("GET")
+	api.HandleFunc("/requests", h.GetRequests).Methods("GET")
+	api.HandleFunc("/requests/{id}/tags/{tag}", h.RemoveRequestTag).Methods("DELETE")
+	api.HandleFunc("/requests/{id}/star", h.StarRequest).Methods("PUT", "DELETE")
+	api.HandleFunc("/reports/sla", h.GetSLAReport).Methods("GET")
+
+	w := httptest.NewRecorder()
+	h.VersionedAPI(router).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; body %s", w.Code, w.Body.String())
+	}
+	var spec openAPIDocument
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("spec isn't JSON: %v", err)
+	}
+	if spec.OpenAPI != "3.0.3" || len(spec.Paths) != 5 || spec.Paths["/v1/messages"] != nil {
+		t.Errorf("spec %s has paths %v", spec.OpenAPI, spec.Paths)
+	}
+
+	tests := []struct {
+		path, method string
+		expected     openAPIOperation
+	}{
+		{"/api/v1/requests", "get", openAPIOperation{OperationID: "getRequests", Summary: "Get requests", Tags: []string{"requests"}}},
+		{"/api/v1/requests/{id}/tags/{tag}", "delete", openAPIOperation{OperationID: "removeRequestTag", Summary: "Remove request tag", Tags: []string{"requests"},
+			Parameters: []openAPIParameter{{Name: "id", In: "path", Required: true}, {Name: "tag", In: "path", Required: true}}}},
+		{"/api/v1/requests/{id}/star", "put", openAPIOperation{OperationID: "starRequestPut", Summary: "Star request", Tags: []string{"requests"},
+			Parameters: []openAPIParameter{{Name: "id", In: "path", Required: true}}}},
+		{"/api/v1/requests/{id}/star", "delete", openAPIOperation{OperationID: "starRequestDelete", Summary: "Star request", Tags: []string{"requests"},
+			Parameters: []openAPIParameter{{Name: "id", In: "path", Required: true}}}},
+		{"/api/v1/reports/sla", "get", openAPIOperation{OperationID: "getSLAReport", Summary: "Get SLA report", Tags: []string{"reports"}}},
+		{"/api/v1/openapi.json", "get", openAPIOperation{OperationID: "getAPISpec", Summary: "Get API spec", Tags: []string{"openapi"}, AdminOnly: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			operation := spec.Paths[tt.path][tt.method]
+			if operation == nil {
+				t.Fatalf("no operation, paths %v", spec.Paths)
+			}
+			for i := range operation.Parameters {
+				operation.Parameters[i].Schema = nil
+			}
+			operation.Responses = nil
+			if !reflect.DeepEqual(*operation, tt.expected) {
+				t.Errorf("operation = %+v, want %+v", *operation, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUI(t *testing.T) {
+	h, _ := newTestHandler(t, &config.Config{}, map[string]provider.Provider{})
+
+	w := httptest.NewRecorder()
+	h.UI(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status without an embedded dashboard = %d, want 404", w.Code)
+	}
+
+	h.ui = fstest.MapFS{
+		"index.html":          {Data: []byte("<html>dashboard</html>")},
+		"assets/entry.abc.js": {Data: []byte("console.log(1)")},
+		"favicon.ico":         {Data: []byte("icon")},
+	}
+	tests := []struct {
+		path, body, contentType string
+	}{
+		{"/", "<html>dashboard</html>", "text/html"},
+		{"/ui", "<html>dashboard</html>", "text/html"},
+		{"/assets/entry.abc.js", "console.log(1)", "javascript"},
+		{"/favicon.ico", "icon", ""},
+		// Client-side routes load the dashboard, which routes them itself
+		{"/routing", "<html>dashboard</html>", "text/html"},
+		{"/assets", "<html>dashboard</html>", "text/html"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.UI(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != tt.body || !strings.Contains(w.Header().Get("Content-Type"), tt.contentType) {
+			t.Errorf("GET %s = %d %q (%s), want %q", tt.path, w.Code, w.Body.String(), w.Header().Get("Content-Type"), tt.body)
+		}
+	}
+}
+
+func TestWatchRequests(t *testing.T) {
+	anthropic := &fakeProvider{name: "anthropic", contentType: "application/json", body: `{"usage":{"input_tokens":10,"output_tokens":5}}`}
+	h, _ := newTestHandler(t, &config.Config{}, map[string]provider.Provider{"anthropic": anthropic})
+
+	router := mux.NewRouter()
+	router.Use(middleware.Logging)
+	router.HandleFunc("/ws/requests", h.WatchRequests).Methods("GET")
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/ws/requests")
+	if err != nil {
+		t.Fatalf("GET returned error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status without a handshake = %d, want 400", resp.StatusCode)
+	}
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/requests"
+	origins := []struct {
+		name, origin string
+		status       int
+	}{
+		{"Another website", "https://evil.example", http.StatusForbidden},
+		{"Web dev server", "http://localhost:5173", http.StatusSwitchingProtocols},
+		{"Dashboard", server.URL, http.StatusSwitchingProtocols},
+		{"No browser", "", http.StatusSwitchingProtocols},
+	}
+	for _, tt := range origins {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+			conn, resp, err := websocket.DefaultDialer.Dial(wsURL, header)
+			if resp == nil || resp.StatusCode != tt.status {
+				t.Fatalf("Dial() = %v, %v, want status %d", resp, err, tt.status)
+			}
+			if conn != nil {
+				conn.Close()
+			}
+		})
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": []string{server.URL}})
+	if err != nil {
+		t.Fatalf("Dial() returned error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	postMessages(h, `{"model":"claude-sonnet-4-20250514","max_tokens":256,"messages":[{"role":"user","content":"hello"}]}`, nil)
+
+	var events []model.FeedEvent
+	for len(events) < 3 {
+		var event model.FeedEvent
+		if err := conn.ReadJSON(&event); err != nil {
+			t.Fatalf("ReadJSON() returned error: %v", err)
+		}
+		events = append(events, event)
+	}
+	if events[0].Type != service.FeedRequestStarted || events[1].Type != service.FeedRequestCompleted ||
+		events[0].RequestID != events[1].RequestID || events[1].StatusCode != http.StatusOK || events[1].OutputTokens != 5 {
+		t.Errorf("events = %+v", events)
+	}
+	if events[2].Type != service.FeedBurnRate || events[2].BurnRate == nil || events[2].BurnRate.Windows[0].Requests != 1 {
+		t.Errorf("burn rate event = %+v", events[2])
+	}
+
+	// A close from the client is answered with a close
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("reply to close = %v", err)
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	h, _ := newTestHandler(t, &config.Config{}, map[string]provider.Provider{})
+	for _, request := range []*model.RequestLog{
+		{RequestID: "req-1", Routing: &model.RoutingExplanation{User: "alice"}},
+		{RequestID: "req-2", Routing: &model.RoutingExplanation{User: "bob"}},
+	} {
+		h.feed.RequestStarted(request)
+		request.Response = &model.ResponseLog{StatusCode: http.StatusOK}
+		h.feed.RequestCompleted(request)
+	}
+	h.feed.RequestCompleted(&model.RequestLog{RequestID: "req-1", Routing: &model.RoutingExplanation{User: "alice"},
+		Response: &model.ResponseLog{StatusCode: http.StatusTooManyRequests}})
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		tenant      string
+		expected    []string
+	}{
+		{"Everything missed", "0", "", []string{"id: 1\nevent: new-request", "id: 3\nevent: new-request", "id: 5\nevent: error"}},
+		{"Some missed", "3", "", []string{"id: 5\nevent: error"}},
+		{"A tenant's own", "0", "bob", []string{"id: 3\nevent: new-request"}},
+		{"From before a restart", "9", "", []string{"event: reset", "id: 1\nevent: new-request", "id: 3\nevent: new-request", "id: 5\nevent: error"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Cancelled already, so only the missed events are sent
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if tt.tenant != "" {
+				ctx = context.WithValue(ctx, tenantKey{}, tt.tenant)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/api/events", nil).WithContext(ctx)
+			r.Header.Set("Last-Event-ID", tt.lastEventID)
+			w := httptest.NewRecorder()
+			h.StreamEvents(w, r)
+
+			body := w.Body.String()
+			if strings.Count(body, "event: ") != len(tt.expected) {
+				t.Errorf("body = %q, want %d events", body, len(tt.expected))
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(body, expected) {
+					t.Errorf("body = %q, missing %q", body, expected)
+				}
+			}
+		})
+	}
+}
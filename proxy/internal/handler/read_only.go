@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// writeRoutes are the API routes that change stored requests, grades, tags or
+// routing rules, by method and path template
+var writeRoutes = map[string]bool{
+	"DELETE /api/v1/requests":                 true,
+	"POST /api/v1/requests/import":            true,
+	"POST /api/v1/requests/{id}/tags":         true,
+	"DELETE /api/v1/requests/{id}/tags/{tag}": true,
+	"POST /api/v1/requests/{id}/grade":        true,
+	"POST /api/v1/grading/jobs":               true,
+	"PUT /api/v1/requests/{id}/star":          true,
+	"DELETE /api/v1/requests/{id}/star":       true,
+	"PUT /api/v1/requests/{id}/note":          true,
+	"DELETE /api/v1/trash":                    true,
+	"POST /api/v1/trash/restore":              true,
+	"POST /api/v1/conversations/{id}/report":  true,
+	"POST /api/v1/storage/maintenance":        true,
+	"POST /api/v1/ingest/usage":               true,
+	"POST /api/v1/routing/rules":              true,
+	"PUT /api/v1/routing/rules/{id}":          true,
+	"DELETE /api/v1/routing/rules/{id}":       true,
+	"POST /api/v1/routing/canary/promote":     true,
+	"POST /api/v1/routing/canary/rollback":    true,
+}
+
+// ReadOnly refuses the API routes that write to the database when the proxy
+// is read-only, so a replica serving a copy of it leaves the copy untouched
+func (h *Handler) ReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.readOnly {
+			template := ""
+			if route := mux.CurrentRoute(r); route != nil {
+				template, _ = route.GetPathTemplate()
+			}
+			if writeRoutes[r.Method+" "+template] {
+				writeErrorResponse(w, h.translate(r, "This proxy is read-only"), http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
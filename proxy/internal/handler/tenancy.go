@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/seifghazi/claude-code-monitor/internal/service"
+)
+
+type tenantKey struct{}
+
+// tenantRoutes are the API routes a tenant may call, by method and path
+// template; each shows only the tenant's requests. The rest of the API, which
+// covers every user or changes the proxy, is for admins.
+var tenantRoutes = map[string]bool{
+	"GET /api/v1/requests":                    true,
+	"DELETE /api/v1/requests":                 true,
+	"GET /api/v1/requests/search":             true,
+	"GET /api/v1/requests/export":             true,
+	"GET /api/v1/requests/compare":            true,
+	"GET /api/v1/requests/{id}":               true,
+	"POST /api/v1/requests/{id}/tags":         true,
+	"DELETE /api/v1/requests/{id}/tags/{tag}": true,
+	"GET /api/v1/tags":                        true,
+	"GET /api/v1/requests/{id}/chunks":        true,
+	"POST /api/v1/requests/{id}/grade":        true,
+	"GET /api/v1/requests/{id}/grade":         true,
+	"PUT /api/v1/requests/{id}/star":          true,
+	"DELETE /api/v1/requests/{id}/star":       true,
+	"PUT /api/v1/requests/{id}/note":          true,
+	"GET /api/v1/trash":                       true,
+	"DELETE /api/v1/trash":                    true,
+	"POST /api/v1/trash/restore":              true,
+	"GET /api/v1/stats":                       true,
+	"GET /api/v1/stats/summary":               true,
+	"GET /api/v1/stats/sessions":              true,
+	"GET /api/v1/stats/costs":                 true,
+	"GET /api/v1/stats/errors":                true,
+	"GET /api/v1/stats/heatmap":               true,
+	"GET /api/v1/stats/grades":                true,
+	"GET /api/v1/stats/models/compare":        true,
+	"GET /api/v1/stats/clients":               true,
+	"POST /api/v1/measure/start":              true,
+	"POST /api/v1/measure/stop":               true,
+	"GET /api/v1/measure/{id}":                true,
+	"GET /api/v1/reports/sla":                 true,
+	"GET /api/v1/summary.txt":                 true,
+	"GET /api/v1/export/anonymized":           true,
+	"GET /api/v1/experiments":                 true,
+	"GET /api/v1/sessions/{id}/requests":      true,
+	"GET /api/v1/events":                      true,
+	"GET /ws/requests":                        true,
+}
+
+// Tenancy makes callers of the dashboard and its API sign in with an API key
+// when the proxy is partitioned by user, and scopes a user's requests to their
+// own. Proxied requests, the health check and usage ingestion, which has its
+// own token, are left alone.
+func (h *Handler) Tenancy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.tenancy.Enabled() || strings.HasPrefix(r.URL.Path, "/v1/") ||
+			r.URL.Path == "/health" || r.URL.Path == "/api/v1/ingest/usage" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Browsers ask for basic auth credentials themselves, so the
+		// dashboard works without a way to enter the key
+		apiKey := service.RequestAPIKey(r.Header)
+		if apiKey == "" {
+			_, apiKey, _ = r.BasicAuth()
+		}
+		tenant, admin, ok := h.tenancy.Caller(apiKey)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Claude Code Monitor", charset="UTF-8"`)
+			writeErrorResponse(w, h.translate(r, "Sign in with your API key"), http.StatusUnauthorized)
+			return
+		}
+
+		if !admin && (strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.URL.Path, "/ws/")) {
+			template := ""
+			if route := mux.CurrentRoute(r); route != nil {
+				template, _ = route.GetPathTemplate()
+			}
+			if !tenantRoutes[r.Method+" "+template] {
+				writeErrorResponse(w, h.translate(r, "Only admins can use this endpoint"), http.StatusForbidden)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenant))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// storage returns the storage as the caller of r may see it: only their own
+// requests when they're a tenant
+func (h *Handler) storage(r *http.Request) service.StorageService {
+	if tenant, ok := r.Context().Value(tenantKey{}).(string); ok {
+		return h.storageService.ForTenant(tenant)
+	}
+	return h.storageService
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxWebSocketMessage is the largest message a client may send
+const maxWebSocketMessage = 64 << 10
+
+// webSocketPingInterval is how often an idle connection is pinged, so proxies
+// in between don't close it
+const webSocketPingInterval = 30 * time.Second
+
+// webSocketUpgrader takes over the dashboard's WebSocket connections
+var webSocketUpgrader = websocket.Upgrader{CheckOrigin: dashboardOrigin}
+
+// dashboardOrigin reports whether a WebSocket handshake comes from the
+// dashboard: a page served by the proxy itself, or by the web dev server on
+// this machine when the proxy is reached there too. Clients that aren't
+// browsers send no Origin. Other websites can't open the feed from a user's
+// browser, since it's not protected by CORS.
+func dashboardOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		host = h
+	}
+	return isLoopbackHost(u.Hostname()) && isLoopbackHost(host)
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// discardWebSocketMessages reads what the client sends, so its pings are
+// answered and its close is seen, and returns once the connection is closed
+func discardWebSocketMessages(conn *websocket.Conn) {
+	conn.SetReadLimit(maxWebSocketMessage)
+	for {
+		if _, _, err := conn.NextReader(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLanguage is the language messages are written in, and the one used
+// when nothing better matches
+const DefaultLanguage = "en"
+
+//go:embed locales/*.json
+var builtinLocales embed.FS
+
+// verbPattern matches fmt verbs, so translations can be checked against the
+// message they translate
+var verbPattern = regexp.MustCompile(`%[-+# 0]*[0-9]*(\.[0-9]*)?[a-zA-Z%]`)
+
+// Catalog translates server-generated messages. Messages are keyed by their
+// English text, gettext style, so code keeps readable strings and anything
+// missing from a catalog falls back to English. Each catalog is a JSON object
+// of English message -> translation in "<language>.json", e.g. "de.json".
+type Catalog struct {
+	language string                       // configured default
+	messages map[string]map[string]string // language -> message -> translation
+}
+
+// Load reads the built-in catalogs, then those in dir (if set), which add to
+// or override them. language is used when a request has no Accept-Language
+// header the catalog can satisfy.
+func Load(language, dir string, logger *log.Logger) (*Catalog, error) {
+	c := &Catalog{
+		language: normalize(language),
+		messages: make(map[string]map[string]string),
+	}
+	if c.language == "" {
+		c.language = DefaultLanguage
+	}
+
+	builtin, _ := builtinLocales.ReadDir("locales")
+	for _, entry := range builtin {
+		data, err := builtinLocales.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if err := c.add(entry.Name(), data, logger); err != nil {
+			return nil, err
+		}
+	}
+
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list locales: %w", err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read locale %s: %w", file, err)
+			}
+			if err := c.add(filepath.Base(file), data, logger); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if c.language != DefaultLanguage && c.messages[c.language] == nil {
+		logger.Printf("⚠️  No catalog for language %q, messages will be in English", c.language)
+	}
+	return c, nil
+}
+
+func (c *Catalog) add(fileName string, data []byte, logger *log.Logger) error {
+	var entries map[string]string
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse locale %s: %w", fileName, err)
+	}
+
+	language := normalize(strings.TrimSuffix(fileName, filepath.Ext(fileName)))
+	if c.messages[language] == nil {
+		c.messages[language] = make(map[string]string)
+	}
+	for message, translation := range entries {
+		if !sameVerbs(message, translation) {
+			logger.Printf("⚠️  Ignoring %s translation of %q: its format verbs don't match", language, message)
+			continue
+		}
+		c.messages[language][message] = translation
+	}
+	return nil
+}
+
+// Language returns the configured default language
+func (c *Catalog) Language() string {
+	return c.language
+}
+
+// Negotiate picks the language to answer in from an Accept-Language header,
+// falling back to the configured language
+func (c *Catalog) Negotiate(acceptLanguage string) string {
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		if tag == "*" {
+			break
+		}
+		if c.supports(tag) {
+			return tag
+		}
+		if base, _, ok := strings.Cut(tag, "-"); ok && c.supports(base) {
+			return base
+		}
+	}
+	return c.language
+}
+
+func (c *Catalog) supports(language string) bool {
+	return language == DefaultLanguage || c.messages[language] != nil
+}
+
+// Translate returns message in language, or message itself if there is no
+// translation
+func (c *Catalog) Translate(language, message string) string {
+	if translation, ok := c.messages[normalize(language)][message]; ok && translation != "" {
+		return translation
+	}
+	return message
+}
+
+// Sprintf translates format and formats it with args
+func (c *Catalog) Sprintf(language, format string, args ...interface{}) string {
+	return fmt.Sprintf(c.Translate(language, format), args...)
+}
+
+// parseAcceptLanguage returns the languages in an Accept-Language header, most
+// preferred first
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = normalize(tag)
+		if tag == "" {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag: tag, q: q})
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+	return result
+}
+
+func normalize(tag string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+}
+
+// sameVerbs reports whether translation uses the same fmt verbs as message, in
+// the same order
+func sameVerbs(message, translation string) bool {
+	want := verbPattern.FindAllString(message, -1)
+	got := verbPattern.FindAllString(translation, -1)
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package i18n
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCatalog_Negotiate(t *testing.T) {
+	catalog, err := Load("es", "", log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		expected       string
+	}{
+		{"No header uses the configured language", "", "es"},
+		{"Exact match", "de", "de"},
+		{"Region falls back to the base language", "de-AT", "de"},
+		{"Highest quality wins", "fr;q=0.9, de;q=0.5, en;q=0.8", "en"},
+		{"Unsupported languages are skipped", "ja, de", "de"},
+		{"Nothing supported", "ja, zh-CN", "es"},
+		{"Zero quality is excluded", "de;q=0, en", "en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := catalog.Negotiate(tt.acceptLanguage); got != tt.expected {
+				t.Errorf("Negotiate(%q) = %q, want %q", tt.acceptLanguage, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCatalog_Translate(t *testing.T) {
+	dir := t.TempDir()
+	custom := `{
+		"Routing rule not found": "Règle introuvable",
+		"Requests: %d (%d errors)": "Requêtes : %d",
+		"Usage digest for the last %s": "Résumé des dernières %s"
+	}`
+	if err := os.WriteFile(filepath.Join(dir, "fr.json"), []byte(custom), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	catalog, err := Load("en", dir, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+
+	if got := catalog.Translate("de", "Routing rule not found"); got != "Routing-Regel nicht gefunden" {
+		t.Errorf("built-in translation = %q", got)
+	}
+	if got := catalog.Translate("fr", "Routing rule not found"); got != "Règle introuvable" {
+		t.Errorf("custom translation = %q", got)
+	}
+	if got := catalog.Translate("fr", "Not found"); got != "Not found" {
+		t.Errorf("missing translations should fall back to English, got %q", got)
+	}
+	if got := catalog.Sprintf("fr", "Usage digest for the last %s", "24h"); got != "Résumé des dernières 24h" {
+		t.Errorf("Sprintf() = %q", got)
+	}
+	// The translation drops a verb, so it is ignored
+	if got := catalog.Sprintf("fr", "Requests: %d (%d errors)", 3, 1); got != "Requests: 3 (1 errors)" {
+		t.Errorf("expected a translation with mismatched verbs to be ignored, got %q", got)
+	}
+}
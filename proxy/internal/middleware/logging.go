@@ -1,12 +1,16 @@
 package middleware
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/seifghazi/claude-code-monitor/internal/model"
@@ -27,10 +31,25 @@ func Logging(next http.Handler) http.Handler {
 				return
 			}
 			r.Body.Close()
+
+			// Decode compressed bodies so handlers always see JSON, remembering
+			// the size that actually came over the wire
+			wireBytes := int64(len(bodyBytes))
+			if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+				bodyBytes, err = gunzip(bodyBytes)
+				if err != nil {
+					log.Printf("❌ Error decoding gzip request body: %v", err)
+					http.Error(w, "Error decoding request body", http.StatusBadRequest)
+					return
+				}
+				r.Header.Del("Content-Encoding")
+				r.ContentLength = int64(len(bodyBytes))
+			}
 			r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 
 			// Store raw bytes in context for handler to use
 			ctx := context.WithValue(r.Context(), model.BodyBytesKey, bodyBytes)
+			ctx = context.WithValue(ctx, model.WireBytesKey, wireBytes)
 			r = r.WithContext(ctx)
 		}
 
@@ -51,6 +70,15 @@ func Logging(next http.Handler) http.Handler {
 	})
 }
 
+func gunzip(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
@@ -61,6 +89,23 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Flush lets streamed responses through the wrapper
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSocket upgrades take over the connection through the wrapper
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer can't be hijacked")
+	}
+	rw.statusCode = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
 // ANSI color codes
 const (
 	colorReset  = "\033[0m"
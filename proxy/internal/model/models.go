@@ -9,6 +9,34 @@ type ContextKey string
 
 const BodyBytesKey ContextKey = "bodyBytes"
 
+// WireBytesKey holds the int64 size of the request body as received, before
+// any Content-Encoding was decoded
+const WireBytesKey ContextKey = "wireBytes"
+
+// RetryTraceKey holds a *RetryTrace that providers fill in while forwarding
+const RetryTraceKey ContextKey = "retryTrace"
+
+// RetryTrace collects the failed attempts made before the final upstream response
+type RetryTrace struct {
+	Attempts []RetryAttempt
+	Failover *Failover
+}
+
+// Failover records that the first upstream rejected the request with a rate
+// limit or overload and it was re-issued to a fallback model
+type Failover struct {
+	FromModel    string `json:"fromModel"`
+	FromProvider string `json:"fromProvider"`
+	StatusCode   int    `json:"statusCode"`
+}
+
+type RetryAttempt struct {
+	Attempt    int    `json:"attempt"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Delay      int64  `json:"delay"`
+}
+
 type PromptGrade struct {
 	Score            int                      `json:"score"`
 	MaxScore         int                      `json:"maxScore"`
@@ -17,6 +45,8 @@ type PromptGrade struct {
 	Criteria         map[string]CriteriaScore `json:"criteria"`
 	GradingTimestamp string                   `json:"gradingTimestamp"`
 	IsProcessing     bool                     `json:"isProcessing"`
+	// Error is why grading failed, empty for a grade
+	Error string `json:"error,omitempty"`
 }
 
 type CriteriaScore struct {
@@ -34,10 +64,46 @@ type RequestLog struct {
 	Model         string              `json:"model,omitempty"`
 	OriginalModel string              `json:"originalModel,omitempty"`
 	RoutedModel   string              `json:"routedModel,omitempty"`
+	Experiment    string              `json:"experiment,omitempty"`
+	ExperimentArm string              `json:"experimentArm,omitempty"`
+	Provider      string              `json:"provider,omitempty"`
+	SessionID     string              `json:"sessionId,omitempty"`
 	UserAgent     string              `json:"userAgent"`
 	ContentType   string              `json:"contentType"`
 	PromptGrade   *PromptGrade        `json:"promptGrade,omitempty"`
 	Response      *ResponseLog        `json:"response,omitempty"`
+	Shadow        *ShadowResponse     `json:"shadow,omitempty"`
+	Routing       *RoutingExplanation `json:"routing,omitempty"`
+	// Tags are the labels attached to the request, sorted
+	Tags []string `json:"tags,omitempty"`
+	// Starred and Note curate the request, set through the API
+	Starred bool   `json:"starred,omitempty"`
+	Note    string `json:"note,omitempty"`
+	// DeletedAt is when the request was moved to the trash, empty unless it's
+	// there
+	DeletedAt string `json:"deletedAt,omitempty"`
+	// CostUSD is what the response cost with the prices when it was stored,
+	// missing when the model's price wasn't known
+	CostUSD *float64 `json:"costUsd,omitempty"`
+	// ConfigGeneration is the config snapshot the request was routed under
+	ConfigGeneration int64 `json:"configGeneration,omitempty"`
+
+	// Request body sizes: as received from the client, and after decoding
+	RequestWireBytes int64 `json:"requestWireBytes,omitempty"`
+	RequestBytes     int64 `json:"requestBytes,omitempty"`
+}
+
+// ShadowResponse is what the shadow model answered to a mirrored copy of the
+// request. It is stored for comparison only and never sent to the client.
+type ShadowResponse struct {
+	Model        string          `json:"model"`
+	Provider     string          `json:"provider"`
+	StatusCode   int             `json:"statusCode,omitempty"`
+	Body         json.RawMessage `json:"body,omitempty"`
+	BodyText     string          `json:"bodyText,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	ResponseTime int64           `json:"responseTime"`
+	CompletedAt  string          `json:"completedAt"`
 }
 
 type ResponseLog struct {
@@ -49,8 +115,35 @@ type ResponseLog struct {
 	StreamingChunks []string            `json:"streamingChunks,omitempty"`
 	IsStreaming     bool                `json:"isStreaming"`
 	CompletedAt     string              `json:"completedAt"`
+	Retries         []RetryAttempt      `json:"retries,omitempty"`
+	Failover        *Failover           `json:"failover,omitempty"`
+	// Origin says where the response came from, one of the ResponseOrigin
+	// constants, so analytics can tell proxy-made responses from model output
+	Origin string `json:"origin,omitempty"`
+
+	// Response body sizes: as received from upstream, and after decoding
+	WireBytes int64 `json:"wireBytes,omitempty"`
+	BodyBytes int64 `json:"bodyBytes,omitempty"`
+
+	// How a stream was delivered: milliseconds from the request to the first
+	// text or tool input and from the first event to the last, the number of
+	// events, and output tokens per second after the first token
+	TimeToFirstToken int64   `json:"timeToFirstToken,omitempty"`
+	StreamDuration   int64   `json:"streamDuration,omitempty"`
+	ChunkCount       int     `json:"chunkCount,omitempty"`
+	TokensPerSecond  float64 `json:"tokensPerSecond,omitempty"`
 }
 
+// Where a response came from: the upstream the request was routed to, a
+// cache, the proxy itself (errors and rejections it made up), or the upstream
+// a request failed over to
+const (
+	ResponseOriginUpstream  = "upstream"
+	ResponseOriginCache     = "cache"
+	ResponseOriginSynthetic = "synthetic"
+	ResponseOriginFallback  = "fallback"
+)
+
 type ChatMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
@@ -145,6 +238,13 @@ type AnthropicRequest struct {
 	Stream      bool                     `json:"stream,omitempty"`
 	Tools       []Tool                   `json:"tools,omitempty"`
 	ToolChoice  interface{}              `json:"tool_choice,omitempty"`
+	Metadata    *RequestMetadata         `json:"metadata,omitempty"`
+}
+
+// RequestMetadata is the request's metadata object. Claude Code puts an
+// identifier of the form "user_<hash>_account_<uuid>_session_<uuid>" in UserID.
+type RequestMetadata struct {
+	UserID string `json:"user_id,omitempty"`
 }
 
 type ModelsResponse struct {
@@ -168,6 +268,7 @@ type GradeRequest struct {
 type HealthResponse struct {
 	Status    string    `json:"status"`
 	Timestamp time.Time `json:"timestamp"`
+	ReadOnly  bool      `json:"readOnly,omitempty"`
 }
 
 type ErrorResponse struct {
@@ -187,6 +288,9 @@ type Delta struct {
 	Text  string          `json:"text,omitempty"`
 	Name  string          `json:"name,omitempty"`
 	Input json.RawMessage `json:"input,omitempty"`
+	// PartialJSON is a piece of a tool_use block's input, sent in
+	// input_json_delta events
+	PartialJSON string `json:"partial_json,omitempty"`
 }
 
 type ContentBlock struct {
@@ -196,3 +300,1300 @@ type ContentBlock struct {
 	Input json.RawMessage `json:"input,omitempty"`
 	Text  string          `json:"text,omitempty"`
 }
+
+// UsageStats aggregates request and token counts over a time range
+type UsageStats struct {
+	From                string          `json:"from"`
+	To                  string          `json:"to"`
+	Requests            int             `json:"requests"`
+	Errors              int             `json:"errors"`
+	InputTokens         int64           `json:"inputTokens"`
+	OutputTokens        int64           `json:"outputTokens"`
+	CacheReadTokens     int64           `json:"cacheReadTokens"`
+	CacheCreationTokens int64           `json:"cacheCreationTokens"`
+	AvgResponseTime     int64           `json:"avgResponseTime"`
+	AvgTimeToFirstToken int64           `json:"avgTimeToFirstToken"`
+	AvgTokensPerSecond  float64         `json:"avgTokensPerSecond"`
+	Synthetic           int             `json:"synthetic"`
+	CostUSD             float64         `json:"costUsd"`
+	Models              []ModelUsage    `json:"models"`
+	Providers           []ProviderUsage `json:"providers"`
+	Sources             []SourceUsage   `json:"sources"`
+	// ModelAccess counts requests whose model the access lists denied
+	ModelAccess []ModelAccessUsage `json:"modelAccess"`
+	// ErrorTypes counts failed responses by status and API error type
+	ErrorTypes []ErrorTypeUsage `json:"errorTypes"`
+	Latency
+	Bandwidth
+}
+
+// StatsSummary is the totals of any time range, ingested usage included.
+// Response times are those of proxied requests answered by a provider.
+type StatsSummary struct {
+	From                string  `json:"from"`
+	To                  string  `json:"to"`
+	Requests            int     `json:"requests"`
+	Errors              int     `json:"errors"`
+	InputTokens         int64   `json:"inputTokens"`
+	OutputTokens        int64   `json:"outputTokens"`
+	CacheReadTokens     int64   `json:"cacheReadTokens"`
+	CacheCreationTokens int64   `json:"cacheCreationTokens"`
+	CostUSD             float64 `json:"costUsd"`
+	AvgResponseTime     int64   `json:"avgResponseTime"`
+	P95ResponseTime     int64   `json:"p95ResponseTime"`
+}
+
+// SessionUsage is the usage of one conversation, from the requests stored
+// with its session ID. Model is the one its latest request was sent to.
+type SessionUsage struct {
+	Session        string `json:"session"`
+	FirstRequestAt string `json:"firstRequestAt"`
+	LastRequestAt  string `json:"lastRequestAt"`
+	ModelUsage
+}
+
+// ErrorTypeUsage is how many responses failed with a status and API error
+// type. ErrorType is empty for errors that weren't API errors, such as a
+// gateway's HTML page; a stream that failed partway has its error type with
+// the status it started with.
+type ErrorTypeUsage struct {
+	StatusCode int    `json:"statusCode"`
+	ErrorType  string `json:"errorType"`
+	Requests   int    `json:"requests"`
+}
+
+// ErrorGroup counts the answered requests of one UTC hour ("2006-01-02
+// 15:00:00") with a status and error type, the type empty where there was none
+type ErrorGroup struct {
+	Hour       string
+	StatusCode int
+	ErrorType  string
+	Requests   int
+}
+
+// ErrorSeries is the error rate of a time range hour by hour, with the failed
+// requests broken down by status and error type overall and in each hour
+type ErrorSeries struct {
+	From      string           `json:"from"`
+	To        string           `json:"to"`
+	Requests  int              `json:"requests"`
+	Errors    int              `json:"errors"`
+	ErrorRate float64          `json:"errorRate"`
+	Types     []ErrorTypeUsage `json:"types"`
+	Hours     []ErrorHour      `json:"hours"`
+}
+
+// ErrorHour is one hour of an ErrorSeries, starting at Hour
+type ErrorHour struct {
+	Hour      string           `json:"hour"`
+	Requests  int              `json:"requests"`
+	Errors    int              `json:"errors"`
+	ErrorRate float64          `json:"errorRate"`
+	Types     []ErrorTypeUsage `json:"types"`
+}
+
+// HourlyUsage is the requests and tokens of one UTC hour ("2006-01-02
+// 15:00:00")
+type HourlyUsage struct {
+	Hour     string
+	Requests int
+	Tokens   int64
+}
+
+// Heatmap totals requests and tokens by weekday and hour of the day, to show
+// when usage peaks and limits tend to be hit. Requests and Tokens are indexed
+// [weekday][hour], weekdays from Sunday as in Weekdays.
+type Heatmap struct {
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	Weekdays    []string  `json:"weekdays"`
+	Requests    [][]int   `json:"requests"`
+	Tokens      [][]int64 `json:"tokens"`
+	MaxRequests int       `json:"maxRequests"`
+	MaxTokens   int64     `json:"maxTokens"`
+}
+
+// GradedPrompt is a prompt's grade and when the prompt was sent
+type GradedPrompt struct {
+	Timestamp string
+	Grade     PromptGrade
+}
+
+// GradeTrends is how prompt grades went over a time range: their average
+// score and histogram overall and for each criterion, and the averages of
+// each day or week to see whether prompting is improving
+type GradeTrends struct {
+	From         string           `json:"from"`
+	To           string           `json:"to"`
+	Interval     string           `json:"interval"`
+	Graded       int              `json:"graded"`
+	AverageScore float64          `json:"averageScore"`
+	MaxScore     int              `json:"maxScore"`
+	Scores       []ScoreCount     `json:"scores"`
+	Criteria     []CriterionTrend `json:"criteria"`
+	Periods      []GradePeriod    `json:"periods"`
+}
+
+// CriterionTrend is the average score and histogram of one grading criterion
+type CriterionTrend struct {
+	Name         string       `json:"name"`
+	Graded       int          `json:"graded"`
+	AverageScore float64      `json:"averageScore"`
+	Scores       []ScoreCount `json:"scores"`
+}
+
+// ScoreCount is how many prompts got a score
+type ScoreCount struct {
+	Score   int `json:"score"`
+	Prompts int `json:"prompts"`
+}
+
+// GradePeriod is the average scores of the prompts graded in the day or week
+// starting at Start; Criteria has the criteria that were scored in it
+type GradePeriod struct {
+	Start        string             `json:"start"`
+	Graded       int                `json:"graded"`
+	AverageScore float64            `json:"averageScore"`
+	Criteria     map[string]float64 `json:"criteria,omitempty"`
+}
+
+// ModelAccessUsage is how often requests for a denied model were blocked or
+// rewritten to another model
+type ModelAccessUsage struct {
+	Model     string `json:"model"`
+	Blocked   int    `json:"blocked"`
+	Rewritten int    `json:"rewritten"`
+}
+
+// Bandwidth is the bytes transferred for a group of requests. Wire sizes are
+// what crossed the network; they are smaller than the decoded sizes when the
+// body was compressed.
+type Bandwidth struct {
+	RequestBytes      int64 `json:"requestBytes"`
+	RequestWireBytes  int64 `json:"requestWireBytes"`
+	ResponseBytes     int64 `json:"responseBytes"`
+	ResponseWireBytes int64 `json:"responseWireBytes"`
+}
+
+// UsageSourceProxy labels usage from requests that went through the proxy
+const UsageSourceProxy = "proxy"
+
+// ExportedRequest is a stored request as exported for offline analysis, with
+// the usage of its response worked out
+type ExportedRequest struct {
+	RequestLog
+	Usage *AnthropicUsage `json:"usage,omitempty"`
+}
+
+// ImportSummary reports what an import of exported requests did. Errors
+// describes the first few invalid lines.
+type ImportSummary struct {
+	Imported   int      `json:"imported"`
+	Duplicates int      `json:"duplicates"`
+	Invalid    int      `json:"invalid"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+// DatabaseSizes is the size of the database file and its write-ahead log.
+// FreeBytes is the part of DatabaseBytes left unused by deleted rows until a
+// VACUUM.
+type DatabaseSizes struct {
+	DatabaseBytes int64 `json:"databaseBytes"`
+	FreeBytes     int64 `json:"freeBytes"`
+	WALBytes      int64 `json:"walBytes"`
+}
+
+// StorageStats reports how the database is using its space.
+// AverageRequestBytes is the stored size of a request's headers, body and
+// response. FullScans names the frequent queries that read a whole table
+// rather than use an index.
+type StorageStats struct {
+	DatabaseSizes
+	Requests            int64        `json:"requests"`
+	TrashedRequests     int64        `json:"trashedRequests"`
+	OldestRequest       string       `json:"oldestRequest,omitempty"`
+	NewestRequest       string       `json:"newestRequest,omitempty"`
+	AverageRequestBytes int64        `json:"averageRequestBytes"`
+	Tables              []TableStats `json:"tables"`
+	Indexes             []IndexStats `json:"indexes"`
+	FullScans           []string     `json:"fullScans"`
+	Dedup               DedupStats   `json:"dedup"`
+}
+
+// MaintenanceReport is what a maintenance run did, and the size of the
+// database before and after it
+type MaintenanceReport struct {
+	Steps  []MaintenanceStep `json:"steps"`
+	Before DatabaseSizes     `json:"before"`
+	After  DatabaseSizes     `json:"after"`
+}
+
+// MaintenanceStep is a maintenance step that ran and how long it took
+type MaintenanceStep struct {
+	Name       string `json:"name"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// TableStats is a table and how many rows it has
+type TableStats struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+}
+
+// IndexStats is an index and the frequent queries that use it
+type IndexStats struct {
+	Name    string   `json:"name"`
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+	Queries []string `json:"queries"`
+}
+
+// DedupStats reports the parts of request bodies stored once and shared:
+// SegmentBytes is their size, ReferencedBytes what storing them with every
+// request would take, and SavedBytes the difference. StoredBytes is their
+// size after compression.
+type DedupStats struct {
+	Segments        int64 `json:"segments"`
+	References      int64 `json:"references"`
+	SegmentBytes    int64 `json:"segmentBytes"`
+	ReferencedBytes int64 `json:"referencedBytes"`
+	StoredBytes     int64 `json:"storedBytes"`
+	SavedBytes      int64 `json:"savedBytes"`
+}
+
+// TagCount is a tag and how many stored requests carry it
+type TagCount struct {
+	Tag      string `json:"tag"`
+	Requests int    `json:"requests"`
+}
+
+// ArchivedRequest is a request the archive task moved out of the database
+// into Object, a gzip-compressed JSON lines export in the archive bucket.
+// Request is the request itself, when it was fetched from the archive.
+type ArchivedRequest struct {
+	RequestID  string      `json:"requestId"`
+	Timestamp  string      `json:"timestamp"`
+	Object     string      `json:"object"`
+	ArchivedAt string      `json:"archivedAt"`
+	Request    *RequestLog `json:"request,omitempty"`
+}
+
+// UsageEvent is usage that didn't pass through the proxy, such as another
+// machine's Claude Code or the Anthropic workbench, posted to /api/v1/ingest/usage
+// so stats reflect total consumption. Source labels where it came from.
+type UsageEvent struct {
+	ID                  string  `json:"id"`
+	Timestamp           string  `json:"timestamp"`
+	Source              string  `json:"source"`
+	Model               string  `json:"model"`
+	Requests            int     `json:"requests"`
+	InputTokens         int64   `json:"inputTokens"`
+	OutputTokens        int64   `json:"outputTokens"`
+	CacheReadTokens     int64   `json:"cacheReadTokens"`
+	CacheCreationTokens int64   `json:"cacheCreationTokens"`
+	CostUSD             float64 `json:"costUsd,omitempty"`
+}
+
+// BurnRate is how fast proxied requests are using tokens and money over
+// sliding windows, and when each spend limit runs out at the current rate
+type BurnRate struct {
+	Windows     []BurnRateWindow `json:"windows"`
+	Projections []BurnProjection `json:"projections"`
+}
+
+// BurnRateWindow is the rate over one window; per-minute figures average the
+// whole window
+type BurnRateWindow struct {
+	Window                string  `json:"window"`
+	Requests              int     `json:"requests"`
+	Tokens                int64   `json:"tokens"`
+	TokensPerMinute       float64 `json:"tokensPerMinute"`
+	OutputTokensPerMinute float64 `json:"outputTokensPerMinute"`
+	CostPerMinute         float64 `json:"costPerMinute"`
+}
+
+// BurnProjection is when a limit is used up at the rate of Window.
+// Remaining is in dollars for a budget, and in tokens or messages for a limit
+// of the usage window. ExhaustedAt is empty when that wouldn't happen before
+// the limit resets.
+type BurnProjection struct {
+	Limit       string  `json:"limit"`
+	Window      string  `json:"window"`
+	Remaining   float64 `json:"remaining"`
+	ResetsAt    string  `json:"resetsAt"`
+	ExhaustedAt string  `json:"exhaustedAt,omitempty"`
+}
+
+// BudgetReport is every budget's spend and forecast, with the burn rate of the
+// last few minutes
+type BudgetReport struct {
+	Budgets  []BudgetStatus   `json:"budgets"`
+	BurnRate []BurnRateWindow `json:"burnRate"`
+}
+
+// BudgetStatus is one budget over its current period. Model is the key of a
+// model budget, empty for the overall one. BurnRatePerHourUSD is the pace of
+// the period so far, ForecastUSD what it comes to by ResetsAt, and OverrunAt
+// when it uses the budget up, if that's before the reset.
+type BudgetStatus struct {
+	Model              string  `json:"model,omitempty"`
+	Period             string  `json:"period"`
+	BudgetUSD          float64 `json:"budgetUsd"`
+	SpentUSD           float64 `json:"spentUsd"`
+	RemainingUSD       float64 `json:"remainingUsd"`
+	Percent            float64 `json:"percent"`
+	Exceeded           bool    `json:"exceeded"`
+	StartedAt          string  `json:"startedAt"`
+	ResetsAt           string  `json:"resetsAt"`
+	BurnRatePerHourUSD float64 `json:"burnRatePerHourUsd"`
+	ForecastUSD        float64 `json:"forecastUsd"`
+	OverrunAt          string  `json:"overrunAt,omitempty"`
+}
+
+// UsageWindow is the usage of the current subscription window: the Anthropic
+// requests since it opened, and when it resets. Without a request for the
+// window's whole duration no window is open and Active is false.
+// Utilization is the share of the tighter configured limit that is used, and
+// ExhaustedAt when it runs out at the window's pace so far, if that's before
+// the reset.
+type UsageWindow struct {
+	Duration            string             `json:"duration"`
+	Active              bool               `json:"active"`
+	StartedAt           string             `json:"startedAt,omitempty"`
+	ResetsAt            string             `json:"resetsAt,omitempty"`
+	ResetsInSeconds     int64              `json:"resetsInSeconds"`
+	Messages            int                `json:"messages"`
+	Tokens              int64              `json:"tokens"`
+	InputTokens         int64              `json:"inputTokens"`
+	OutputTokens        int64              `json:"outputTokens"`
+	CacheReadTokens     int64              `json:"cacheReadTokens"`
+	CacheCreationTokens int64              `json:"cacheCreationTokens"`
+	TokensPerMinute     float64            `json:"tokensPerMinute"`
+	TokenLimit          int64              `json:"tokenLimit,omitempty"`
+	MessageLimit        int                `json:"messageLimit,omitempty"`
+	Utilization         *float64           `json:"utilization,omitempty"`
+	ExhaustedAt         string             `json:"exhaustedAt,omitempty"`
+	Models              []UsageWindowModel `json:"models"`
+}
+
+// UsageWindowModel is one model's share of a UsageWindow
+type UsageWindowModel struct {
+	Model    string `json:"model"`
+	Messages int    `json:"messages"`
+	Tokens   int64  `json:"tokens"`
+}
+
+// ProviderRateLimits is what the latest response of a provider said about
+// its rate limits in its anthropic-ratelimit-* headers. RetryAfter is the
+// seconds a rate limited response asked to wait.
+type ProviderRateLimits struct {
+	Provider   string      `json:"provider"`
+	RequestID  string      `json:"requestId"`
+	UpdatedAt  string      `json:"updatedAt"`
+	RetryAfter int         `json:"retryAfter,omitempty"`
+	Limits     []RateLimit `json:"limits"`
+}
+
+// RateLimit is one of a provider's limits, named by its header such as
+// "requests", "input-tokens" or "unified". Limit and Remaining are nil when
+// the headers didn't give them; ResetsAt is when the limit is back to full.
+type RateLimit struct {
+	Name      string `json:"name"`
+	Limit     *int64 `json:"limit,omitempty"`
+	Remaining *int64 `json:"remaining,omitempty"`
+	ResetsAt  string `json:"resetsAt,omitempty"`
+	Status    string `json:"status,omitempty"`
+}
+
+// FeedEvent is a live update about a request: when it started, how its
+// response is streaming, when it completed and when its prompt was graded;
+// or about a budget reaching one of its thresholds. Tenant is the user a
+// request was made for, so each only gets their own.
+type FeedEvent struct {
+	ID           int64   `json:"id"`
+	Type         string  `json:"type"`
+	Time         string  `json:"time"`
+	RequestID    string  `json:"requestId"`
+	Model        string  `json:"model,omitempty"`
+	Provider     string  `json:"provider,omitempty"`
+	Endpoint     string  `json:"endpoint,omitempty"`
+	StatusCode   int     `json:"statusCode,omitempty"`
+	ResponseTime int64   `json:"responseTime,omitempty"`
+	Chunks       int     `json:"chunks,omitempty"`
+	InputTokens  int64   `json:"inputTokens,omitempty"`
+	OutputTokens int64   `json:"outputTokens,omitempty"`
+	CostUSD      float64 `json:"costUsd,omitempty"`
+	Score        int     `json:"score,omitempty"`
+	MaxScore     int     `json:"maxScore,omitempty"`
+	// A budget that reached the percentage of Threshold
+	Threshold float64       `json:"threshold,omitempty"`
+	Budget    *BudgetStatus `json:"budget,omitempty"`
+	// The burn rate after a request completed
+	BurnRate *BurnRate `json:"burnRate,omitempty"`
+	Tenant   string    `json:"-"`
+}
+
+// UsageSample is the usage of one answered request, for rebuilding running
+// totals from storage
+type UsageSample struct {
+	Timestamp string
+	Provider  string
+	Model     string
+	Usage     AnthropicUsage
+}
+
+// AnonymizedRequest is a request with all content stripped, for sharing as
+// a benchmarking dataset. Session and tool names are salted hashes; Time is
+// the hour the request was made, or just its day when few sessions were
+// active that hour. Values seen in too few sessions read "other".
+type AnonymizedRequest struct {
+	Session             string   `json:"session"`
+	Time                string   `json:"time,omitempty"`
+	Client              string   `json:"client"`
+	Model               string   `json:"model"`
+	RoutedModel         string   `json:"routedModel"`
+	Provider            string   `json:"provider"`
+	RouteReason         string   `json:"routeReason,omitempty"`
+	Stream              bool     `json:"stream"`
+	Messages            int      `json:"messages"`
+	ToolsOffered        int      `json:"toolsOffered"`
+	ToolResults         int      `json:"toolResults"`
+	ToolCalls           []string `json:"toolCalls,omitempty"`
+	StatusCode          int      `json:"statusCode"`
+	StopReason          string   `json:"stopReason,omitempty"`
+	ResponseTime        int64    `json:"responseTime"`
+	RequestBytes        int64    `json:"requestBytes"`
+	InputTokens         int      `json:"inputTokens"`
+	OutputTokens        int      `json:"outputTokens"`
+	CacheReadTokens     int      `json:"cacheReadTokens"`
+	CacheCreationTokens int      `json:"cacheCreationTokens"`
+}
+
+// SourceUsage is the per-source slice of UsageStats. Proxied requests are
+// reported under UsageSourceProxy with their stored costs; for ingested
+// sources CostUSD adds up the costs the events reported.
+type SourceUsage struct {
+	Source              string  `json:"source"`
+	Requests            int     `json:"requests"`
+	InputTokens         int64   `json:"inputTokens"`
+	OutputTokens        int64   `json:"outputTokens"`
+	CacheReadTokens     int64   `json:"cacheReadTokens"`
+	CacheCreationTokens int64   `json:"cacheCreationTokens"`
+	CostUSD             float64 `json:"costUsd,omitempty"`
+}
+
+// ProviderUsage is the per-provider slice of UsageStats
+type ProviderUsage struct {
+	Provider string `json:"provider"`
+	Requests int    `json:"requests"`
+	Latency
+	Bandwidth
+}
+
+// Latency is the spread of response times and, over streamed responses, times
+// to the first token: nearest-rank percentiles in milliseconds, left out when
+// there are no timings to rank
+type Latency struct {
+	ResponseTimePercentiles     *Percentiles `json:"responseTimePercentiles,omitempty"`
+	TimeToFirstTokenPercentiles *Percentiles `json:"timeToFirstTokenPercentiles,omitempty"`
+}
+
+type Percentiles struct {
+	P50 int64 `json:"p50"`
+	P90 int64 `json:"p90"`
+	P99 int64 `json:"p99"`
+}
+
+// ModelUsage is the per-model slice of UsageStats
+type ModelUsage struct {
+	Model               string `json:"model"`
+	Requests            int    `json:"requests"`
+	Errors              int    `json:"errors"`
+	InputTokens         int64  `json:"inputTokens"`
+	OutputTokens        int64  `json:"outputTokens"`
+	CacheReadTokens     int64  `json:"cacheReadTokens"`
+	CacheCreationTokens int64  `json:"cacheCreationTokens"`
+	AvgResponseTime     int64  `json:"avgResponseTime"`
+	// Streaming averages, over the streamed responses only
+	AvgTimeToFirstToken int64   `json:"avgTimeToFirstToken,omitempty"`
+	AvgTokensPerSecond  float64 `json:"avgTokensPerSecond,omitempty"`
+	// Synthetic counts responses the proxy made up, which are included in
+	// Requests and Errors but not in response times or sizes
+	Synthetic int `json:"synthetic"`
+	// CostUSD adds up the stored costs, leaving out requests to models
+	// without a price
+	CostUSD float64 `json:"costUsd"`
+	Latency
+	Bandwidth
+}
+
+// ClientStats breaks usage down by the client requests came from and the
+// authenticated user who made them, to see who a shared proxy's tokens go to
+type ClientStats struct {
+	From    string        `json:"from"`
+	To      string        `json:"to"`
+	Tokens  int64         `json:"tokens"`
+	Clients []ClientUsage `json:"clients"`
+	Users   []ClientUsage `json:"users"`
+}
+
+// ClientUsage is the usage of one client, named by the first part of its
+// User-Agent such as "claude-cli/1.0.80", or of one user. TokenShare is its
+// percent of all the tokens in the range.
+type ClientUsage struct {
+	Name                string  `json:"name"`
+	Requests            int     `json:"requests"`
+	Errors              int     `json:"errors"`
+	InputTokens         int64   `json:"inputTokens"`
+	OutputTokens        int64   `json:"outputTokens"`
+	CacheReadTokens     int64   `json:"cacheReadTokens"`
+	CacheCreationTokens int64   `json:"cacheCreationTokens"`
+	Tokens              int64   `json:"tokens"`
+	TokenShare          float64 `json:"tokenShare"`
+	CostUSD             float64 `json:"costUsd"`
+}
+
+// ModelComparison sets models side by side over a time range, by the model
+// requests were served by, in the order they were asked for
+type ModelComparison struct {
+	From   string          `json:"from"`
+	To     string          `json:"to"`
+	Models []ComparedModel `json:"models"`
+}
+
+// ComparedModel is one model of a ModelComparison. Averages per response
+// leave out synthetic responses; AvgOutputTokens is how long its answers are.
+type ComparedModel struct {
+	Model               string  `json:"model"`
+	Requests            int     `json:"requests"`
+	Errors              int     `json:"errors"`
+	ErrorRate           float64 `json:"errorRate"`
+	InputTokens         int64   `json:"inputTokens"`
+	OutputTokens        int64   `json:"outputTokens"`
+	CacheReadTokens     int64   `json:"cacheReadTokens"`
+	CacheCreationTokens int64   `json:"cacheCreationTokens"`
+	CostUSD             float64 `json:"costUsd"`
+	CostPerRequestUSD   float64 `json:"costPerRequestUsd"`
+	AvgResponseTime     int64   `json:"avgResponseTime"`
+	AvgTimeToFirstToken int64   `json:"avgTimeToFirstToken"`
+	AvgOutputTokens     int64   `json:"avgOutputTokens"`
+	AvgResponseBytes    int64   `json:"avgResponseBytes"`
+	Latency
+}
+
+// RequestComparison sets out what changed from request A to request B: the
+// system prompt line by line, the messages after the ones both sent, the
+// tools offered and the response text. Delta is how much more B used.
+type RequestComparison struct {
+	A        ComparedRequest `json:"a"`
+	B        ComparedRequest `json:"b"`
+	System   []DiffLine      `json:"system"`
+	Messages MessagesDiff    `json:"messages"`
+	Tools    ToolsDiff       `json:"tools"`
+	Response []DiffLine      `json:"response"`
+	Delta    ComparedUsage   `json:"delta"`
+}
+
+// ComparedRequest is one side of a RequestComparison
+type ComparedRequest struct {
+	RequestID    string        `json:"requestId"`
+	Timestamp    string        `json:"timestamp"`
+	Model        string        `json:"model"`
+	SystemBlocks int           `json:"systemBlocks"`
+	Messages     int           `json:"messages"`
+	Tools        int           `json:"tools"`
+	StatusCode   int           `json:"statusCode,omitempty"`
+	StopReason   string        `json:"stopReason,omitempty"`
+	ToolCalls    []string      `json:"toolCalls"`
+	Usage        ComparedUsage `json:"usage"`
+}
+
+// ComparedUsage is what a request used: its prompt size as estimated from
+// the body, the tokens its response reported, and what it cost
+type ComparedUsage struct {
+	EstimatedTokens     int     `json:"estimatedTokens"`
+	InputTokens         int64   `json:"inputTokens"`
+	OutputTokens        int64   `json:"outputTokens"`
+	CacheReadTokens     int64   `json:"cacheReadTokens"`
+	CacheCreationTokens int64   `json:"cacheCreationTokens"`
+	CostUSD             float64 `json:"costUsd"`
+}
+
+// DiffLine is a line removed from A, numbered as in A, or added in B,
+// numbered as in B
+type DiffLine struct {
+	Op   string `json:"op"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// MessagesDiff is the messages of two requests after the Shared ones they
+// start with: those only A sent, and those only B did
+type MessagesDiff struct {
+	Shared  int              `json:"shared"`
+	Removed []MessageSummary `json:"removed"`
+	Added   []MessageSummary `json:"added"`
+}
+
+// MessageSummary is a message by its position, role, the types of its
+// content blocks and the start of its text
+type MessageSummary struct {
+	Index           int      `json:"index"`
+	Role            string   `json:"role"`
+	Blocks          []string `json:"blocks"`
+	Preview         string   `json:"preview,omitempty"`
+	EstimatedTokens int      `json:"estimatedTokens"`
+}
+
+// ToolsDiff names the tools only B offered, only A did, and those both
+// offered with different descriptions or schemas
+type ToolsDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// ExperimentStats compares the arms of an A/B experiment. For the canary of a
+// subagent mapping, Subagent is the agent, ModelA is empty because arm a keeps
+// the requested model, and Split is the mapping's canary percent.
+type ExperimentStats struct {
+	Name     string               `json:"name"`
+	Subagent string               `json:"subagent,omitempty"`
+	ModelA   string               `json:"modelA"`
+	ModelB   string               `json:"modelB"`
+	Split    int                  `json:"split"`
+	Arms     []ExperimentArmStats `json:"arms"`
+}
+
+// ExperimentArmStats is the usage of one experiment arm. Model is the model the
+// arm's requests were actually served by.
+type ExperimentArmStats struct {
+	Arm       string  `json:"arm"`
+	ErrorRate float64 `json:"errorRate"`
+	ModelUsage
+}
+
+// ScheduleStatus reports the state of a scheduled task
+type ScheduleStatus struct {
+	Name         string `json:"name"`
+	Cron         string `json:"cron"`
+	Task         string `json:"task"`
+	Running      bool   `json:"running"`
+	LastRun      string `json:"lastRun,omitempty"`
+	LastDuration int64  `json:"lastDuration,omitempty"`
+	LastStatus   string `json:"lastStatus"`
+	LastResult   string `json:"lastResult,omitempty"`
+	LastError    string `json:"lastError,omitempty"`
+	NextRun      string `json:"nextRun,omitempty"`
+	RunCount     int    `json:"runCount"`
+}
+
+// QuotaStatus reports request-count quota usage for a provider
+type QuotaStatus struct {
+	Provider          string `json:"provider"`
+	Policy            string `json:"policy"`
+	RequestsPerMinute int    `json:"requestsPerMinute,omitempty"`
+	RequestsPerDay    int    `json:"requestsPerDay,omitempty"`
+	UsedLastMinute    int    `json:"usedLastMinute"`
+	UsedLastDay       int    `json:"usedLastDay"`
+	Rejected          int    `json:"rejected"`
+	MaxConcurrent     int    `json:"maxConcurrent,omitempty"`
+	InFlight          int    `json:"inFlight"`
+	QueuedInteractive int    `json:"queuedInteractive"`
+	QueuedBackground  int    `json:"queuedBackground"`
+}
+
+// Request priorities, for queueing when a provider's concurrency cap is reached
+const (
+	PriorityInteractive = "interactive"
+	PriorityBackground  = "background"
+)
+
+// Why the router picked a request's model
+const (
+	RouteReasonSubagent   = "subagent"
+	RouteReasonRule       = "rule"
+	RouteReasonExperiment = "experiment"
+	RouteReasonSize       = "size"
+	RouteReasonTier       = "tier"
+	RouteReasonOverride   = "override"
+	RouteReasonDefault    = "default"
+	RouteReasonHook       = "hook"
+)
+
+// Outcomes of the model access lists for a denied model
+const (
+	ModelAccessBlocked   = "blocked"
+	ModelAccessRewritten = "rewritten"
+)
+
+// RoutingExplanation records why a request went to the model and provider it
+// did. PromptHash is set whenever the request looked like a subagent call, even
+// if no agent matched, so hash mismatches can be debugged from the dashboard.
+type RoutingExplanation struct {
+	Reason     string `json:"reason"`
+	Detail     string `json:"detail"`
+	Subagent   string `json:"subagent,omitempty"`
+	PromptHash string `json:"promptHash,omitempty"`
+	Rule       string `json:"rule,omitempty"`
+	Provider   string `json:"provider"`
+	// User is the user policy the request was routed under, if any
+	User string `json:"user,omitempty"`
+	// ContinuationOf is the request whose truncated response this one
+	// re-issued, ContinuedBy the request that re-issued this one
+	ContinuationOf string `json:"continuationOf,omitempty"`
+	ContinuedBy    string `json:"continuedBy,omitempty"`
+	// Canary is the arm of a routing canary the request was assigned to
+	// ("canary" or "baseline"), empty when no canary was running
+	Canary string `json:"canary,omitempty"`
+	// Access is ModelAccessBlocked or ModelAccessRewritten when the routed
+	// model was denied by the model access lists; DeniedModel is that model
+	Access      string `json:"access,omitempty"`
+	DeniedModel string `json:"deniedModel,omitempty"`
+	// Priority is PriorityInteractive or PriorityBackground, which decides the
+	// order requests are served in when a provider's concurrency cap is reached
+	Priority string `json:"priority,omitempty"`
+	// Changes made after the model was picked: health and context window
+	// fallbacks, trimming, and failover after 429/529
+	Adjustments []string `json:"adjustments,omitempty"`
+}
+
+// UnknownField is a JSON field the proxy's models don't represent, as seen in
+// requests ("request"), non-streaming responses ("response") or streaming
+// events ("stream", where Path starts with the event type)
+type UnknownField struct {
+	Source           string `json:"source"`
+	Path             string `json:"path"`
+	Count            int64  `json:"count"`
+	FirstSeen        string `json:"firstSeen"`
+	LastSeen         string `json:"lastSeen"`
+	ExampleRequestID string `json:"exampleRequestId"`
+}
+
+// RoutingRule is a routing rule as managed through the API. A rule either maps
+// a Claude Code subagent (by agent file name) to TargetModel, or, when Subagent
+// is empty, routes requests whose content matches Keywords or Pattern. Rules
+// from config.yaml are listed with Source "config" and can't be changed.
+type RoutingRule struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Subagent    string   `json:"subagent,omitempty"`
+	Keywords    []string `json:"keywords,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Scope       string   `json:"scope,omitempty"`
+	Models      []string `json:"models,omitempty"`
+	TargetModel string   `json:"targetModel"`
+	Provider    string   `json:"provider,omitempty"`
+	Enabled     bool     `json:"enabled"`
+	Position    int      `json:"position"`
+	Source      string   `json:"source"`
+	CreatedAt   string   `json:"createdAt,omitempty"`
+	UpdatedAt   string   `json:"updatedAt,omitempty"`
+}
+
+// Routing canary arms
+const (
+	CanaryArmBaseline = "baseline"
+	CanaryArmCanary   = "canary"
+)
+
+// CanaryStatus reports a routing change being rolled out to part of traffic
+type CanaryStatus struct {
+	Active    bool          `json:"active"`
+	Percent   int           `json:"percent"`
+	StartedAt string        `json:"startedAt,omitempty"`
+	PromoteAt string        `json:"promoteAt,omitempty"`
+	Baseline  CanaryArmStat `json:"baseline"`
+	Canary    CanaryArmStat `json:"canary"`
+	// Rules is the candidate rule set; only rules managed through the API
+	Rules []RoutingRule `json:"rules,omitempty"`
+	// LastOutcome says how the previous canary ended
+	LastOutcome string `json:"lastOutcome,omitempty"`
+}
+
+// CanaryArmStat is the traffic one side of a canary has served
+type CanaryArmStat struct {
+	Requests        int     `json:"requests"`
+	Errors          int     `json:"errors"`
+	ErrorRate       float64 `json:"errorRate"`
+	AvgResponseTime int64   `json:"avgResponseTime"`
+}
+
+// ConfigSnapshot is the effective routing configuration of one generation. A
+// new generation is recorded whenever the configuration changes, and requests
+// carry the generation they were routed under.
+type ConfigSnapshot struct {
+	Generation int64            `json:"generation"`
+	Hash       string           `json:"hash"`
+	CreatedAt  string           `json:"createdAt"`
+	Config     *EffectiveConfig `json:"config,omitempty"`
+}
+
+// EffectiveConfig is everything that decides where a request is routed: the
+// settings from config.yaml combined with the rules and mappings managed
+// through the API and the agent definitions on disk
+type EffectiveConfig struct {
+	SubagentsEnabled      bool              `json:"subagentsEnabled"`
+	SubagentDetection     []string          `json:"subagentDetection,omitempty"`
+	Agents                []AgentMapping    `json:"agents,omitempty"`
+	Rules                 []RoutingRule     `json:"rules,omitempty"`
+	CanaryRules           []RoutingRule     `json:"canaryRules,omitempty"`
+	CanaryPercent         int               `json:"canaryPercent,omitempty"`
+	Experiments           []ExperimentStats `json:"experiments,omitempty"`
+	Tiers                 map[string]string `json:"tiers,omitempty"`
+	SmallRequestModel     string            `json:"smallRequestModel,omitempty"`
+	SmallRequestThreshold int               `json:"smallRequestThreshold,omitempty"`
+	HealthFallbacks       map[string]string `json:"healthFallbacks,omitempty"`
+	FallbackModel         string            `json:"fallbackModel,omitempty"`
+	FallbackModels        map[string]string `json:"fallbackModels,omitempty"`
+	RoutingHook           []string          `json:"routingHook,omitempty"`
+	Users                 []UserRouting     `json:"users,omitempty"`
+}
+
+// UserRouting is the routing a user policy adds on top of the shared config
+type UserRouting struct {
+	Name     string            `json:"name"`
+	Mappings map[string]string `json:"mappings,omitempty"`
+	Tiers    map[string]string `json:"tiers,omitempty"`
+	Rules    []RoutingRule     `json:"rules,omitempty"`
+}
+
+// AgentMapping is a subagent mapping and the prompt hash of the agent
+// definition it resolved to, empty if the definition wasn't found
+type AgentMapping struct {
+	Agent         string `json:"agent"`
+	TargetModel   string `json:"targetModel"`
+	PromptHash    string `json:"promptHash,omitempty"`
+	CanaryPercent int    `json:"canaryPercent,omitempty"`
+}
+
+// Routing rule sources
+const (
+	RuleSourceConfig = "config"
+	RuleSourceAPI    = "api"
+)
+
+// ShadowStatus reports the shadow traffic mirror and what it has done since startup
+type ShadowStatus struct {
+	Enabled       bool   `json:"enabled"`
+	Model         string `json:"model,omitempty"`
+	Provider      string `json:"provider,omitempty"`
+	Percent       int    `json:"percent"`
+	MaxConcurrent int    `json:"maxConcurrent"`
+	InFlight      int    `json:"inFlight"`
+	Mirrored      int64  `json:"mirrored"`
+	Dropped       int64  `json:"dropped"`
+	Failed        int64  `json:"failed"`
+}
+
+// ProviderHealth is the last observed state of a monitored provider
+type ProviderHealth struct {
+	Provider        string        `json:"provider"`
+	Healthy         bool          `json:"healthy"`
+	LastCheck       string        `json:"lastCheck,omitempty"`
+	Error           string        `json:"error,omitempty"`
+	InFlight        int           `json:"inFlight"`
+	MaxConcurrent   int           `json:"maxConcurrent,omitempty"`
+	AvailableModels []string      `json:"availableModels"`
+	LoadedModels    []LoadedModel `json:"loadedModels"`
+}
+
+// APIKeyUsage is how much one of a provider's rotated API keys has been used
+// since startup. Key is masked.
+type APIKeyUsage struct {
+	Provider      string `json:"provider"`
+	Name          string `json:"name"`
+	Key           string `json:"key"`
+	Weight        int    `json:"weight"`
+	Requests      int64  `json:"requests"`
+	RateLimited   int64  `json:"rateLimited"`
+	LastUsed      string `json:"lastUsed,omitempty"`
+	CooldownUntil string `json:"cooldownUntil,omitempty"`
+}
+
+type LoadedModel struct {
+	Name      string `json:"name"`
+	SizeBytes int64  `json:"sizeBytes"`
+	VRAMBytes int64  `json:"vramBytes"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+}
+
+// IdleSession is a session that has kept making requests without a user
+// message for longer than the idle threshold. Requests and tokens are counted
+// since the last user message.
+type IdleSession struct {
+	Session           string `json:"session"`
+	LastUserMessageAt string `json:"lastUserMessageAt"`
+	LastRequestAt     string `json:"lastRequestAt"`
+	IdleFor           string `json:"idleFor"`
+	Requests          int    `json:"requests"`
+	InputTokens       int64  `json:"inputTokens"`
+	OutputTokens      int64  `json:"outputTokens"`
+	Paused            bool   `json:"paused"`
+}
+
+// Idle session event types
+const (
+	IdleSessionEventIdle    = "idle"
+	IdleSessionEventResumed = "resumed"
+)
+
+// IdleSessionEvent records a session going idle or being resumed
+type IdleSessionEvent struct {
+	Time     string `json:"time"`
+	Session  string `json:"session"`
+	Event    string `json:"event"`
+	Paused   bool   `json:"paused,omitempty"`
+	Requests int    `json:"requests,omitempty"`
+	Tokens   int64  `json:"tokens,omitempty"`
+	// Reason says why a session was resumed: a user message or the API
+	Reason string `json:"reason,omitempty"`
+}
+
+// RoutingHookInput is what a routing hook gets on stdin: the metadata of one
+// request. System and LastUserMessage are the text of the system prompt and of
+// the latest user message.
+type RoutingHookInput struct {
+	Model           string   `json:"model"`
+	System          string   `json:"system"`
+	LastUserMessage string   `json:"lastUserMessage"`
+	EstimatedTokens int      `json:"estimatedTokens"`
+	Session         string   `json:"session"`
+	Messages        int      `json:"messages"`
+	Tools           []string `json:"tools"`
+	Stream          bool     `json:"stream"`
+	MaxTokens       int      `json:"maxTokens"`
+}
+
+// RoutingHookOutput is a routing hook's answer. An empty Model leaves the
+// request to the other routing steps; Provider defaults to the one inferred
+// from the model.
+type RoutingHookOutput struct {
+	Model    string `json:"model"`
+	Provider string `json:"provider,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// LiveStream is a streaming response that is still being forwarded to the
+// client, which the dashboard can attach to
+type LiveStream struct {
+	RequestID string `json:"requestId"`
+	Model     string `json:"model"`
+	StartedAt string `json:"startedAt"`
+	Chunks    int    `json:"chunks"`
+	Observers int    `json:"observers"`
+}
+
+// RequestNotification is sent when a long request finishes. Text is a one-line
+// summary, which is also what Slack-compatible webhooks display.
+type RequestNotification struct {
+	Text         string `json:"text"`
+	RequestID    string `json:"requestId"`
+	Model        string `json:"model"`
+	StatusCode   int    `json:"statusCode"`
+	Duration     string `json:"duration"`
+	StopReason   string `json:"stopReason,omitempty"`
+	InputTokens  int    `json:"inputTokens"`
+	OutputTokens int    `json:"outputTokens"`
+}
+
+// Measurement is what the requests made between a measurement's start and
+// stop used, oldest first. Pending requests hadn't been answered yet when it
+// was measured and count once they have.
+type Measurement struct {
+	ID                  string            `json:"id"`
+	Label               string            `json:"label,omitempty"`
+	StartedAt           string            `json:"startedAt"`
+	StoppedAt           string            `json:"stoppedAt,omitempty"`
+	Running             bool              `json:"running"`
+	Duration            string            `json:"duration"`
+	Pending             int               `json:"pending"`
+	Errors              int               `json:"errors"`
+	Unpriced            int               `json:"unpriced"`
+	InputTokens         int64             `json:"inputTokens"`
+	OutputTokens        int64             `json:"outputTokens"`
+	CacheReadTokens     int64             `json:"cacheReadTokens"`
+	CacheCreationTokens int64             `json:"cacheCreationTokens"`
+	CostUSD             float64           `json:"costUsd"`
+	Requests            []MeasuredRequest `json:"requests"`
+}
+
+// MeasuredRequest is one request of a Measurement
+type MeasuredRequest struct {
+	RequestID           string   `json:"requestId"`
+	Timestamp           string   `json:"timestamp"`
+	Model               string   `json:"model"`
+	StatusCode          int      `json:"statusCode,omitempty"`
+	InputTokens         int64    `json:"inputTokens"`
+	OutputTokens        int64    `json:"outputTokens"`
+	CacheReadTokens     int64    `json:"cacheReadTokens"`
+	CacheCreationTokens int64    `json:"cacheCreationTokens"`
+	CostUSD             *float64 `json:"costUsd,omitempty"`
+}
+
+// UsageAlert is sent when usage crosses an alert's threshold, once per
+// Period: the day, the start of the usage window, or the start of a budget's
+// period. Budget names the budget of a budget alert, such as "daily" or
+// "opus monthly". Text is a one-line summary, which is also what
+// Slack-compatible webhooks display.
+type UsageAlert struct {
+	Text      string  `json:"text"`
+	Alert     string  `json:"alert"`
+	Budget    string  `json:"budget,omitempty"`
+	Threshold float64 `json:"threshold"`
+	Value     float64 `json:"value"`
+	Period    string  `json:"period"`
+}
+
+// SchemaInfo describes how the proxy stores requests, so exporters and other
+// tools reading the API or the database can adapt to upgrades instead of
+// breaking on them. SchemaVersion grows with every change in the changelog.
+type SchemaInfo struct {
+	SchemaVersion int            `json:"schemaVersion"`
+	Tables        []SchemaTable  `json:"tables"`
+	Features      []string       `json:"features"`
+	Formats       DataFormats    `json:"formats"`
+	Changelog     []SchemaChange `json:"changelog"`
+}
+
+type SchemaTable struct {
+	Name    string         `json:"name"`
+	Columns []SchemaColumn `json:"columns"`
+}
+
+type SchemaColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// SchemaChange is one version of the stored schema. Added lists new tables
+// and "table.column"s.
+type SchemaChange struct {
+	Version     int      `json:"version"`
+	Description string   `json:"description"`
+	Added       []string `json:"added,omitempty"`
+}
+
+// DataFormats describes how request data is encoded, in the API and in the
+// database alike
+type DataFormats struct {
+	Timestamps   string            `json:"timestamps"`
+	RequestBody  string            `json:"requestBody"`
+	ResponseBody []string          `json:"responseBody"`
+	Streaming    string            `json:"streaming"`
+	Encodings    []string          `json:"encodings"` // of body and response columns when not NULL
+	Exports      map[string]string `json:"exports"`   // path -> content type
+}
+
+// ProviderSample is the outcome of one request to a provider. Failover marks
+// an attempt the request failed over from, whose latency isn't known.
+type ProviderSample struct {
+	Provider     string          `json:"provider"`
+	Model        string          `json:"model"`
+	StatusCode   int             `json:"statusCode"`
+	ResponseTime int64           `json:"responseTime"`
+	Usage        *AnthropicUsage `json:"usage,omitempty"`
+	Failover     bool            `json:"failover,omitempty"`
+}
+
+// CostGroup is the requests of one day and project sent to one provider and
+// model for one requested model, with their tokens and stored cost. Unpriced
+// counts the answered requests that have no cost, as their model's price
+// wasn't known.
+type CostGroup struct {
+	Day                 string
+	Project             string
+	Provider            string
+	Model               string
+	RequestedModel      string
+	Requests            int
+	Unpriced            int
+	InputTokens         int64
+	OutputTokens        int64
+	CacheReadTokens     int64
+	CacheCreationTokens int64
+	CostUSD             float64
+}
+
+// CostReport is the spend over a range broken down by day, model, provider
+// and project. BaselineCostUSD is what the same tokens would have cost on the
+// models Claude Code asked for, so SavedUSD is what routing saved, or cost
+// when negative.
+type CostReport struct {
+	From            string          `json:"from"`
+	To              string          `json:"to"`
+	Requests        int             `json:"requests"`
+	Unpriced        int             `json:"unpriced"`
+	CostUSD         float64         `json:"costUsd"`
+	BaselineCostUSD float64         `json:"baselineCostUsd"`
+	SavedUSD        float64         `json:"savedUsd"`
+	Days            []CostBreakdown `json:"days"`
+	Models          []CostBreakdown `json:"models"`
+	Providers       []CostBreakdown `json:"providers"`
+	Projects        []CostBreakdown `json:"projects"`
+}
+
+// CostBreakdown is the spend of one day, model, provider or project of a
+// CostReport
+type CostBreakdown struct {
+	Key                 string  `json:"key"`
+	Requests            int     `json:"requests"`
+	InputTokens         int64   `json:"inputTokens"`
+	OutputTokens        int64   `json:"outputTokens"`
+	CacheReadTokens     int64   `json:"cacheReadTokens"`
+	CacheCreationTokens int64   `json:"cacheCreationTokens"`
+	CostUSD             float64 `json:"costUsd"`
+	BaselineCostUSD     float64 `json:"baselineCostUsd"`
+	SavedUSD            float64 `json:"savedUsd"`
+}
+
+// SLAReport compares providers over one month. A provider is available for
+// a request unless it failed with a 5xx; rate limits are counted separately.
+type SLAReport struct {
+	Month     string        `json:"month"`
+	From      string        `json:"from"`
+	To        string        `json:"to"`
+	Targets   SLATargets    `json:"targets"`
+	Providers []ProviderSLA `json:"providers"`
+}
+
+type SLATargets struct {
+	Availability float64 `json:"availability,omitempty"` // percent
+	P95Latency   int64   `json:"p95Latency,omitempty"`   // ms
+}
+
+type ProviderSLA struct {
+	Provider     string  `json:"provider"`
+	Requests     int     `json:"requests"`
+	Failures     int     `json:"failures"`
+	RateLimited  int     `json:"rateLimited"`
+	Availability float64 `json:"availability"` // percent
+	P50Latency   int64   `json:"p50Latency"`   // ms
+	P95Latency   int64   `json:"p95Latency"`   // ms
+	CostUSD      float64 `json:"costUsd"`
+	// UnpricedRequests had usage on a model with no known price
+	UnpricedRequests  int   `json:"unpricedRequests,omitempty"`
+	MeetsAvailability *bool `json:"meetsAvailability,omitempty"`
+	MeetsLatency      *bool `json:"meetsLatency,omitempty"`
+}
+
+// ActiveSessions are the Claude Code sessions with a request in flight or
+// within Window, such as one per terminal, busiest first. Top is the session
+// that burned the most tokens over the window, the usual cause of a spike.
+type ActiveSessions struct {
+	Window          string              `json:"window"`
+	Active          int                 `json:"active"`
+	TokensPerMinute float64             `json:"tokensPerMinute"`
+	CostPerMinute   float64             `json:"costPerMinute"`
+	Top             string              `json:"top,omitempty"`
+	Sessions        []SessionActivity   `json:"sessions"`
+	Workspaces      []WorkspaceActivity `json:"workspaces"`
+}
+
+// SessionActivity is one active session. Tokens and rates cover the window;
+// Share is the session's percent of all tokens burned in it.
+type SessionActivity struct {
+	Session         string  `json:"session"`
+	Workspace       string  `json:"workspace,omitempty"`
+	Model           string  `json:"model"`
+	StartedAt       string  `json:"startedAt"`
+	LastRequestAt   string  `json:"lastRequestAt"`
+	Requests        int     `json:"requests"`
+	InFlight        int     `json:"inFlight"`
+	Tokens          int64   `json:"tokens"`
+	TokensPerMinute float64 `json:"tokensPerMinute"`
+	CostPerMinute   float64 `json:"costPerMinute"`
+	Share           float64 `json:"share"`
+}
+
+// WorkspaceActivity groups the active sessions working in one directory
+type WorkspaceActivity struct {
+	Workspace       string  `json:"workspace"`
+	Sessions        int     `json:"sessions"`
+	TokensPerMinute float64 `json:"tokensPerMinute"`
+}
+
+// GradingJob is a background run grading the prompts of the stored requests
+// a filter selected. Skipped requests had no prompt or were already being
+// graded; Status is running, completed or cancelled.
+type GradingJob struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	From         string `json:"from,omitempty"`
+	To           string `json:"to,omitempty"`
+	Model        string `json:"model,omitempty"`
+	UngradedOnly bool   `json:"ungradedOnly"`
+	Concurrency  int    `json:"concurrency"`
+	Total        int    `json:"total"`
+	Graded       int    `json:"graded"`
+	Failed       int    `json:"failed"`
+	Skipped      int    `json:"skipped"`
+	StartedAt    string `json:"startedAt"`
+	FinishedAt   string `json:"finishedAt,omitempty"`
+}
+
+// ConversationReport is an analysis of a whole conversation from its stored
+// requests: how its prompts were graded turn by turn, the context it spent,
+// tool calls it repeated, and tools it used badly. Summary and
+// Recommendations are written by the grading model; Error says why they're
+// missing when it couldn't.
+type ConversationReport struct {
+	SessionID       string       `json:"sessionId"`
+	Model           string       `json:"model,omitempty"`
+	Requests        int          `json:"requests"`
+	Turns           []ReportTurn `json:"turns"`
+	AverageScore    float64      `json:"averageScore,omitempty"`
+	ScoreChange     float64      `json:"scoreChange"`
+	Context         ContextWaste `json:"context"`
+	Tools           []ToolUsage  `json:"tools"`
+	Loops           []ToolLoop   `json:"loops"`
+	Misuse          []ToolMisuse `json:"misuse"`
+	Summary         string       `json:"summary,omitempty"`
+	Recommendations []string     `json:"recommendations,omitempty"`
+	Error           string       `json:"error,omitempty"`
+	CreatedAt       string       `json:"createdAt"`
+}
+
+// ReportTurn is a prompt the user typed, with its grade when it has one
+type ReportTurn struct {
+	Turn      int    `json:"turn"`
+	RequestID string `json:"requestId"`
+	Timestamp string `json:"timestamp"`
+	Prompt    string `json:"prompt"`
+	Score     *int   `json:"score,omitempty"`
+}
+
+// ContextWaste is the context a conversation sent and how much of it was
+// spent for little: sent again without a cache hit, sent in requests that
+// failed, or taken up by very large tool results
+type ContextWaste struct {
+	InputTokens          int `json:"inputTokens"`
+	CacheReadTokens      int `json:"cacheReadTokens"`
+	PeakContextTokens    int `json:"peakContextTokens"`
+	UncachedRepeatTokens int `json:"uncachedRepeatTokens"`
+	FailedRequests       int `json:"failedRequests"`
+	FailedRequestTokens  int `json:"failedRequestTokens"`
+	LargeToolResults     int `json:"largeToolResults"`
+	LargeToolResultChars int `json:"largeToolResultChars"`
+}
+
+// ToolUsage counts the calls of a tool and how many of them failed
+type ToolUsage struct {
+	Tool   string `json:"tool"`
+	Calls  int    `json:"calls"`
+	Errors int    `json:"errors"`
+}
+
+// ToolLoop is a tool called again and again with the same input
+type ToolLoop struct {
+	Tool  string `json:"tool"`
+	Input string `json:"input"`
+	Calls int    `json:"calls"`
+}
+
+// ToolMisuse is a way a tool was used badly, and how often
+type ToolMisuse struct {
+	Tool   string `json:"tool"`
+	Calls  int    `json:"calls"`
+	Reason string `json:"reason"`
+}
@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"bytes"
 	"compress/gzip"
 	"context"
 	"fmt"
@@ -8,24 +9,53 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// ProxyHopsHeader counts the proxies a request has passed through when this
+// proxy forwards to another Anthropic-compatible proxy
+const ProxyHopsHeader = "X-Proxy-Hops"
+
+// maxProxyHops is how many proxies a request may pass through before it is
+// assumed to be looping
+const maxProxyHops = 5
+
+// Auth modes for the Anthropic upstream
+const (
+	AuthModePassthrough = "passthrough" // forward the client's x-api-key / Authorization (default)
+	AuthModeAPIKey      = "api_key"     // replace them with x-api-key: api_key
+	AuthModeBearer      = "bearer"      // replace them with Authorization: Bearer api_key (LiteLLM keys)
+	AuthModeNone        = "none"        // strip them; the upstream handles auth itself
 )
 
 type AnthropicProvider struct {
 	client *http.Client
 	config *config.AnthropicProviderConfig
+	retry  retryPolicy
+	keys   *keyPool // set in the api_key and bearer auth modes
 }
 
 func NewAnthropicProvider(cfg *config.AnthropicProviderConfig) Provider {
-	return &AnthropicProvider{
+	p := &AnthropicProvider{
 		client: &http.Client{
 			Timeout: 300 * time.Second, // 5 minutes timeout
 		},
 		config: cfg,
+		retry:  newRetryPolicy(cfg.MaxRetries, cfg.InitialBackoff, cfg.MaxBackoff),
+	}
+
+	switch cfg.AuthMode {
+	case AuthModeAPIKey, AuthModeBearer:
+		if p.keys = newKeyPool(p.Name(), cfg.APIKey, cfg.APIKeys); p.keys != nil {
+			p.client.Transport = p.keys.transport(nil, p.setKey)
+		}
 	}
+	return p
 }
 
 func (p *AnthropicProvider) Name() string {
@@ -33,6 +63,20 @@ func (p *AnthropicProvider) Name() string {
 }
 
 func (p *AnthropicProvider) ForwardRequest(ctx context.Context, originalReq *http.Request) (*http.Response, error) {
+	// Buffer the body so it can be replayed on retries
+	bodyBytes, err := io.ReadAll(originalReq.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	originalReq.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+
+	// Each proxy in a chain counts itself; a chain that loops back on itself
+	// would otherwise forward the request forever
+	hops, _ := strconv.Atoi(originalReq.Header.Get(ProxyHopsHeader))
+	if hops >= maxProxyHops {
+		return loopDetectedResponse(originalReq, hops), nil
+	}
+
 	// Clone the request to avoid modifying the original
 	proxyReq := originalReq.Clone(ctx)
 
@@ -46,10 +90,15 @@ func (p *AnthropicProvider) ForwardRequest(ctx context.Context, originalReq *htt
 		return nil, fmt.Errorf("invalid base URL, scheme and host are required: %s", p.config.BaseURL)
 	}
 
-	// Update the destination URL
+	// Update the destination URL. Base URLs are accepted with or without a
+	// trailing /v1 (LiteLLM is often configured as http://host:4000/v1)
+	basePath := strings.TrimSuffix(baseURL.Path, "/")
+	if strings.HasSuffix(basePath, "/v1") && strings.HasPrefix(originalReq.URL.Path, "/v1/") {
+		basePath = strings.TrimSuffix(basePath, "/v1")
+	}
 	proxyReq.URL.Scheme = baseURL.Scheme
 	proxyReq.URL.Host = baseURL.Host
-	proxyReq.URL.Path = path.Join(baseURL.Path, originalReq.URL.Path)
+	proxyReq.URL.Path = path.Join("/", basePath, originalReq.URL.Path)
 
 	// Preserve query parameters
 	proxyReq.URL.RawQuery = originalReq.URL.RawQuery
@@ -61,16 +110,32 @@ func (p *AnthropicProvider) ForwardRequest(ctx context.Context, originalReq *htt
 	// Remove hop-by-hop headers
 	removeHopByHopHeaders(proxyReq.Header)
 
-	// Add required headers if not present
-	if proxyReq.Header.Get("anthropic-version") == "" {
+	// Collapse repeated values that earlier hops may have appended
+	if versions := splitHeaderValues(proxyReq.Header, "anthropic-version"); len(versions) > 0 {
+		proxyReq.Header.Set("anthropic-version", versions[0])
+	}
+	if betas := splitHeaderValues(proxyReq.Header, "anthropic-beta"); len(betas) > 0 {
+		proxyReq.Header.Set("anthropic-beta", strings.Join(betas, ","))
+	}
+
+	// Add required headers if not present. A downstream proxy adds its own
+	// default, so the version is only filled in when talking to Anthropic.
+	if proxyReq.Header.Get("anthropic-version") == "" && !p.config.UpstreamProxy {
 		proxyReq.Header.Set("anthropic-version", p.config.Version)
 	}
 
+	p.applyAuth(proxyReq.Header)
+	if p.config.UpstreamProxy {
+		proxyReq.Header.Set(ProxyHopsHeader, strconv.Itoa(hops+1))
+	} else {
+		proxyReq.Header.Del(ProxyHopsHeader)
+	}
+
 	// Support gzip encoding
 	proxyReq.Header.Set("Accept-Encoding", "gzip")
 
-	// Forward the request
-	resp, err := p.client.Do(proxyReq)
+	// Forward the request, retrying transient upstream failures
+	resp, err := p.retry.do(ctx, p.client, proxyReq, bodyBytes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to forward request: %w", err)
 	}
@@ -79,7 +144,8 @@ func (p *AnthropicProvider) ForwardRequest(ctx context.Context, originalReq *htt
 	if resp.Header.Get("Content-Encoding") == "gzip" {
 		resp.Header.Del("Content-Encoding")
 		resp.Header.Del("Content-Length")
-		gzipReader, err := gzip.NewReader(resp.Body)
+		wire := &countingReader{Reader: resp.Body}
+		gzipReader, err := gzip.NewReader(wire)
 		if err != nil {
 			resp.Body.Close()
 			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
@@ -87,6 +153,7 @@ func (p *AnthropicProvider) ForwardRequest(ctx context.Context, originalReq *htt
 		resp.Body = &gzipResponseBody{
 			Reader: gzipReader,
 			closer: resp.Body,
+			wire:   wire,
 		}
 	}
 
@@ -96,6 +163,11 @@ func (p *AnthropicProvider) ForwardRequest(ctx context.Context, originalReq *htt
 type gzipResponseBody struct {
 	io.Reader
 	closer io.Closer
+	wire   *countingReader
+}
+
+func (g *gzipResponseBody) WireBytes() int64 {
+	return g.wire.n
 }
 
 func (g *gzipResponseBody) Close() error {
@@ -105,6 +177,71 @@ func (g *gzipResponseBody) Close() error {
 	return g.closer.Close()
 }
 
+// applyAuth sets the credentials sent upstream according to the configured
+// auth mode. In the api_key and bearer modes the key itself is added per
+// attempt by the key pool's transport.
+func (p *AnthropicProvider) applyAuth(header http.Header) {
+	switch p.config.AuthMode {
+	case AuthModeAPIKey:
+		header.Del("Authorization")
+		header.Del("x-api-key")
+	case AuthModeBearer:
+		header.Del("x-api-key")
+		header.Del("Authorization")
+	case AuthModeNone:
+		header.Del("Authorization")
+		header.Del("x-api-key")
+	default:
+		// Passthrough: forward whatever credentials the client sent
+	}
+}
+
+// setKey puts an upstream key on the request in the configured auth mode
+func (p *AnthropicProvider) setKey(header http.Header, key string) {
+	if p.config.AuthMode == AuthModeBearer {
+		header.Set("Authorization", "Bearer "+key)
+		return
+	}
+	header.Set("x-api-key", key)
+}
+
+// KeyUsage implements KeyBalancer
+func (p *AnthropicProvider) KeyUsage() []model.APIKeyUsage {
+	return p.keys.usage()
+}
+
+// splitHeaderValues returns the distinct comma-separated values of a header,
+// in order, across all of its lines
+func splitHeaderValues(header http.Header, name string) []string {
+	var values []string
+	seen := make(map[string]bool)
+	for _, line := range header.Values(name) {
+		for _, v := range strings.Split(line, ",") {
+			v = strings.TrimSpace(v)
+			if v != "" && !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+func loopDetectedResponse(req *http.Request, hops int) *http.Response {
+	body := []byte(fmt.Sprintf(`{"type":"error","error":{"type":"api_error","message":"request has passed through %d proxies; the upstream chain probably loops back to this proxy"}}`, hops))
+	return &http.Response{
+		StatusCode:    http.StatusLoopDetected,
+		Status:        fmt.Sprintf("%d %s", http.StatusLoopDetected, http.StatusText(http.StatusLoopDetected)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
 func removeHopByHopHeaders(header http.Header) {
 	hopByHopHeaders := []string{
 		"Connection",
@@ -117,15 +254,13 @@ func removeHopByHopHeaders(header http.Header) {
 		"Upgrade",
 	}
 
-	for _, h := range hopByHopHeaders {
+	// Remove any headers specified in the Connection header first, while it is
+	// still there to read
+	for _, h := range splitHeaderValues(header, "Connection") {
 		header.Del(h)
 	}
 
-	// Remove any headers specified in the Connection header
-	if connection := header.Get("Connection"); connection != "" {
-		for _, h := range strings.Split(connection, ",") {
-			header.Del(strings.TrimSpace(h))
-		}
-		header.Del("Connection")
+	for _, h := range hopByHopHeaders {
+		header.Del(h)
 	}
 }
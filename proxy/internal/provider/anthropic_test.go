@@ -0,0 +1,187 @@
+package provider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+func TestAnthropicProvider_Headers(t *testing.T) {
+	var received *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type":"message","content":[]}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		config        config.AnthropicProviderConfig
+		clientHeaders http.Header
+		path          string
+		want          map[string]string // header -> value ("" means absent)
+	}{
+		{
+			"Direct to Anthropic fills in the version",
+			config.AnthropicProviderConfig{BaseURL: server.URL, Version: "2023-06-01"},
+			http.Header{"X-Api-Key": {"sk-client"}},
+			"/v1/messages",
+			map[string]string{"Anthropic-Version": "2023-06-01", "X-Api-Key": "sk-client", ProxyHopsHeader: ""},
+		},
+		{
+			"Repeated version collapses to one value",
+			config.AnthropicProviderConfig{BaseURL: server.URL, Version: "2023-06-01", UpstreamProxy: true},
+			http.Header{"Anthropic-Version": {"2023-06-01", "2023-06-01"}, "Anthropic-Beta": {"a,b", "b"}},
+			"/v1/messages",
+			map[string]string{"Anthropic-Version": "2023-06-01", "Anthropic-Beta": "a,b"},
+		},
+		{
+			"Upstream proxy leaves the version to the next hop and counts hops",
+			config.AnthropicProviderConfig{BaseURL: server.URL, Version: "2023-06-01", UpstreamProxy: true},
+			http.Header{ProxyHopsHeader: {"1"}},
+			"/v1/messages",
+			map[string]string{"Anthropic-Version": "", ProxyHopsHeader: "2"},
+		},
+		{
+			"Base URL ending in /v1 is not doubled",
+			config.AnthropicProviderConfig{BaseURL: server.URL + "/litellm/v1", UpstreamProxy: true},
+			http.Header{},
+			"/v1/messages",
+			map[string]string{":path": "/litellm/v1/messages"},
+		},
+		{
+			"Bearer auth replaces client credentials",
+			config.AnthropicProviderConfig{BaseURL: server.URL, UpstreamProxy: true, AuthMode: AuthModeBearer, APIKey: "sk-litellm"},
+			http.Header{"X-Api-Key": {"sk-client"}, "Authorization": {"Bearer oauth"}},
+			"/v1/messages",
+			map[string]string{"Authorization": "Bearer sk-litellm", "X-Api-Key": ""},
+		},
+		{
+			"API key auth replaces client credentials",
+			config.AnthropicProviderConfig{BaseURL: server.URL, AuthMode: AuthModeAPIKey, APIKey: "sk-proxy"},
+			http.Header{"Authorization": {"Bearer oauth"}},
+			"/v1/messages",
+			map[string]string{"Authorization": "", "X-Api-Key": "sk-proxy"},
+		},
+		{
+			"No auth strips client credentials",
+			config.AnthropicProviderConfig{BaseURL: server.URL, AuthMode: AuthModeNone},
+			http.Header{"X-Api-Key": {"sk-client"}, "Authorization": {"Bearer oauth"}},
+			"/v1/messages",
+			map[string]string{"Authorization": "", "X-Api-Key": ""},
+		},
+		{
+			"Headers named in Connection are dropped",
+			config.AnthropicProviderConfig{BaseURL: server.URL},
+			http.Header{"Connection": {"X-Internal"}, "X-Internal": {"1"}},
+			"/v1/messages",
+			map[string]string{"X-Internal": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.config
+			p := NewAnthropicProvider(&cfg)
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader([]byte(`{"model":"claude-sonnet-4"}`)))
+			for name, values := range tt.clientHeaders {
+				req.Header[http.CanonicalHeaderKey(name)] = values
+			}
+
+			resp, err := p.ForwardRequest(context.Background(), req)
+			if err != nil {
+				t.Fatalf("ForwardRequest() returned error: %v", err)
+			}
+			resp.Body.Close()
+
+			for name, want := range tt.want {
+				if name == ":path" {
+					if received.URL.Path != want {
+						t.Errorf("path = %q, want %q", received.URL.Path, want)
+					}
+					continue
+				}
+				values := received.Header.Values(name)
+				if want == "" && len(values) != 0 {
+					t.Errorf("%s = %v, want absent", name, values)
+				}
+				if want != "" && (len(values) != 1 || values[0] != want) {
+					t.Errorf("%s = %v, want [%s]", name, values, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAnthropicProvider_LoopDetection(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	p := NewAnthropicProvider(&config.AnthropicProviderConfig{BaseURL: server.URL, UpstreamProxy: true})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader([]byte(`{}`)))
+	req.Header.Set(ProxyHopsHeader, "5")
+
+	resp, err := p.ForwardRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ForwardRequest() returned error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusLoopDetected {
+		t.Errorf("StatusCode = %d, want %d", resp.StatusCode, http.StatusLoopDetected)
+	}
+	if called {
+		t.Error("expected the looping request not to be forwarded")
+	}
+}
+
+func TestAnthropicProvider_GzipWireBytes(t *testing.T) {
+	body := bytes.Repeat([]byte(`{"type":"text","text":"hello"},`), 100)
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(body)
+	gz.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(compressed.Bytes())
+	}))
+	defer server.Close()
+
+	p := NewAnthropicProvider(&config.AnthropicProviderConfig{BaseURL: server.URL})
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader([]byte(`{}`)))
+
+	resp, err := p.ForwardRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ForwardRequest() returned error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	decoded, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	if !bytes.Equal(decoded, body) {
+		t.Errorf("decoded body differs from what was sent")
+	}
+
+	sizer, ok := resp.Body.(WireSizer)
+	if !ok {
+		t.Fatal("expected gzip response body to report its wire size")
+	}
+	if got := sizer.WireBytes(); got != int64(compressed.Len()) {
+		t.Errorf("WireBytes() = %d, want %d", got, compressed.Len())
+	}
+}
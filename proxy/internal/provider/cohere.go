@@ -0,0 +1,562 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// CohereModelPrefix routes any Cohere model explicitly, e.g. "cohere/c4ai-aya-expanse-32b";
+// Command models ("command-r-plus", "command-a-03-2025") are matched by name
+const CohereModelPrefix = "cohere/"
+
+// CohereProvider translates Anthropic Messages requests to Cohere's v2 chat API
+// so Command models can be routing targets.
+type CohereProvider struct {
+	client *http.Client
+	config *config.OpenAIProviderConfig
+	retry  retryPolicy
+}
+
+func NewCohereProvider(cfg *config.OpenAIProviderConfig) Provider {
+	return &CohereProvider{
+		client: &http.Client{
+			Timeout: 300 * time.Second, // 5 minutes timeout
+		},
+		config: cfg,
+		retry:  newRetryPolicy(cfg.MaxRetries, cfg.InitialBackoff, cfg.MaxBackoff),
+	}
+}
+
+func (p *CohereProvider) Name() string {
+	return "cohere"
+}
+
+func (p *CohereProvider) ForwardRequest(ctx context.Context, originalReq *http.Request) (*http.Response, error) {
+	bodyBytes, err := io.ReadAll(originalReq.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	originalReq.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+
+	var anthropicReq model.AnthropicRequest
+	if err := json.Unmarshal(bodyBytes, &anthropicReq); err != nil {
+		return nil, fmt.Errorf("failed to parse anthropic request: %w", err)
+	}
+
+	cohereBody, err := json.Marshal(convertAnthropicToCohere(&anthropicReq))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cohere request: %w", err)
+	}
+
+	baseURL, err := url.Parse(p.config.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse base URL '%s': %w", p.config.BaseURL, err)
+	}
+
+	proxyReq := originalReq.Clone(ctx)
+	proxyReq.URL.Scheme = baseURL.Scheme
+	proxyReq.URL.Host = baseURL.Host
+	proxyReq.URL.Path = path.Join("/", baseURL.Path, "v2/chat")
+	proxyReq.URL.RawQuery = ""
+	proxyReq.RequestURI = ""
+	proxyReq.Host = baseURL.Host
+
+	proxyReq.Header.Del("anthropic-version")
+	proxyReq.Header.Del("anthropic-beta")
+	proxyReq.Header.Del("x-api-key")
+	proxyReq.Header.Del("Accept-Encoding")
+	proxyReq.Header.Set("Authorization", "Bearer "+p.config.APIKey)
+	proxyReq.Header.Set("Content-Type", "application/json")
+	if anthropicReq.Stream {
+		proxyReq.Header.Set("Accept", "text/event-stream")
+	} else {
+		proxyReq.Header.Set("Accept", "application/json")
+	}
+
+	resp, err := p.retry.do(ctx, p.client, proxyReq, cohereBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to forward request: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		errorBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		errorJSON, _ := json.Marshal(map[string]interface{}{
+			"type": "error",
+			"error": map[string]interface{}{
+				"type":    "api_error",
+				"message": fmt.Sprintf("Cohere API error: %s", string(errorBody)),
+			},
+		})
+		resp.Body = io.NopCloser(bytes.NewReader(errorJSON))
+		resp.Header.Set("Content-Type", "application/json")
+		resp.ContentLength = int64(len(errorJSON))
+		return resp, nil
+	}
+
+	if anthropicReq.Stream {
+		pr, pw := io.Pipe()
+		upstream := resp.Body
+		go func() {
+			defer pw.Close()
+			defer upstream.Close()
+			transformCohereStreamToAnthropic(upstream, pw, anthropicReq.Model)
+		}()
+		resp.Body = pr
+		resp.Header.Set("Content-Type", "text/event-stream")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		return resp, nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	transformed := transformCohereResponseToAnthropic(respBody, anthropicReq.Model)
+	resp.Body = io.NopCloser(bytes.NewReader(transformed))
+	resp.ContentLength = int64(len(transformed))
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Set("Content-Length", fmt.Sprintf("%d", len(transformed)))
+	return resp, nil
+}
+
+func convertAnthropicToCohere(req *model.AnthropicRequest) map[string]interface{} {
+	messages := []map[string]interface{}{}
+
+	if len(req.System) > 0 {
+		var parts []string
+		for _, sys := range req.System {
+			parts = append(parts, sys.Text)
+		}
+		messages = append(messages, map[string]interface{}{
+			"role":    "system",
+			"content": strings.Join(parts, "\n\n"),
+		})
+	}
+
+	for _, msg := range req.Messages {
+		blocks, ok := msg.Content.([]interface{})
+		if !ok {
+			messages = append(messages, map[string]interface{}{
+				"role":    msg.Role,
+				"content": textOf(msg.GetContentBlocks()),
+			})
+			continue
+		}
+
+		var texts []string
+		var toolCalls []map[string]interface{}
+		for _, item := range blocks {
+			block, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			switch block["type"] {
+			case "text":
+				if text, ok := block["text"].(string); ok {
+					texts = append(texts, text)
+				}
+			case "tool_use":
+				arguments, _ := json.Marshal(block["input"])
+				toolCalls = append(toolCalls, map[string]interface{}{
+					"id":   block["id"],
+					"type": "function",
+					"function": map[string]interface{}{
+						"name":      block["name"],
+						"arguments": string(arguments),
+					},
+				})
+			case "tool_result":
+				// Cohere expects each tool result as its own "tool" message
+				messages = append(messages, map[string]interface{}{
+					"role":         "tool",
+					"tool_call_id": block["tool_use_id"],
+					"content":      toolResultText(block["content"]),
+				})
+			}
+		}
+
+		if len(texts) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+
+		cohereMsg := map[string]interface{}{"role": msg.Role}
+		if len(toolCalls) > 0 {
+			cohereMsg["tool_calls"] = toolCalls
+			if len(texts) > 0 {
+				cohereMsg["tool_plan"] = strings.Join(texts, "\n")
+			}
+		} else {
+			cohereMsg["content"] = strings.Join(texts, "\n")
+		}
+		messages = append(messages, cohereMsg)
+	}
+
+	cohereReq := map[string]interface{}{
+		"model":    strings.TrimPrefix(req.Model, CohereModelPrefix),
+		"messages": messages,
+		"stream":   req.Stream,
+	}
+	if req.MaxTokens > 0 {
+		cohereReq["max_tokens"] = req.MaxTokens
+	}
+	if req.Temperature != nil {
+		cohereReq["temperature"] = *req.Temperature
+	}
+
+	if len(req.Tools) > 0 {
+		tools := make([]map[string]interface{}, 0, len(req.Tools))
+		for _, tool := range req.Tools {
+			if tool.Name == "" {
+				continue
+			}
+			parameters := map[string]interface{}{
+				"type":       "object",
+				"properties": tool.InputSchema.Properties,
+			}
+			if tool.InputSchema.Properties == nil {
+				parameters["properties"] = map[string]interface{}{}
+			}
+			if len(tool.InputSchema.Required) > 0 {
+				parameters["required"] = tool.InputSchema.Required
+			}
+			tools = append(tools, map[string]interface{}{
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":        tool.Name,
+					"description": tool.Description,
+					"parameters":  parameters,
+				},
+			})
+		}
+		cohereReq["tools"] = tools
+
+		if choice, ok := req.ToolChoice.(map[string]interface{}); ok {
+			switch choice["type"] {
+			case "any", "tool":
+				cohereReq["tool_choice"] = "REQUIRED"
+			case "none":
+				cohereReq["tool_choice"] = "NONE"
+			}
+		}
+	}
+
+	return cohereReq
+}
+
+func textOf(blocks []model.AnthropicContentBlock) string {
+	var parts []string
+	for _, block := range blocks {
+		if block.Type == "text" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// toolResultText flattens a tool_result's content (string or blocks) to text
+func toolResultText(content interface{}) string {
+	switch v := content.(type) {
+	case string:
+		return v
+	case []interface{}:
+		var parts []string
+		for _, item := range v {
+			if block, ok := item.(map[string]interface{}); ok {
+				if text, ok := block["text"].(string); ok {
+					parts = append(parts, text)
+					continue
+				}
+			}
+			raw, _ := json.Marshal(item)
+			parts = append(parts, string(raw))
+		}
+		return strings.Join(parts, "\n")
+	case nil:
+		return ""
+	default:
+		raw, _ := json.Marshal(v)
+		return string(raw)
+	}
+}
+
+type cohereToolCall struct {
+	ID       string `json:"id"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type cohereUsage struct {
+	BilledUnits struct {
+		InputTokens  float64 `json:"input_tokens"`
+		OutputTokens float64 `json:"output_tokens"`
+	} `json:"billed_units"`
+	Tokens struct {
+		InputTokens  float64 `json:"input_tokens"`
+		OutputTokens float64 `json:"output_tokens"`
+	} `json:"tokens"`
+}
+
+func (u *cohereUsage) anthropic() map[string]interface{} {
+	input, output := u.Tokens.InputTokens, u.Tokens.OutputTokens
+	if input == 0 && output == 0 {
+		input, output = u.BilledUnits.InputTokens, u.BilledUnits.OutputTokens
+	}
+	return map[string]interface{}{
+		"input_tokens":  int(input),
+		"output_tokens": int(output),
+	}
+}
+
+func cohereStopReason(finishReason string) string {
+	switch finishReason {
+	case "MAX_TOKENS":
+		return "max_tokens"
+	case "TOOL_CALL":
+		return "tool_use"
+	case "STOP_SEQUENCE":
+		return "stop_sequence"
+	default:
+		return "end_turn"
+	}
+}
+
+func toolInput(arguments string) interface{} {
+	var input map[string]interface{}
+	if err := json.Unmarshal([]byte(arguments), &input); err != nil {
+		return map[string]interface{}{"raw": arguments}
+	}
+	return input
+}
+
+func transformCohereResponseToAnthropic(respBody []byte, requestedModel string) []byte {
+	var cohereResp struct {
+		ID           string `json:"id"`
+		FinishReason string `json:"finish_reason"`
+		Message      struct {
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+			ToolPlan  string           `json:"tool_plan"`
+			ToolCalls []cohereToolCall `json:"tool_calls"`
+		} `json:"message"`
+		Usage cohereUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(respBody, &cohereResp); err != nil {
+		return respBody // Return as-is if we can't parse
+	}
+
+	content := []map[string]interface{}{}
+	if cohereResp.Message.ToolPlan != "" && len(cohereResp.Message.Content) == 0 {
+		content = append(content, map[string]interface{}{"type": "text", "text": cohereResp.Message.ToolPlan})
+	}
+	for _, block := range cohereResp.Message.Content {
+		if block.Type == "text" {
+			content = append(content, map[string]interface{}{"type": "text", "text": block.Text})
+		}
+	}
+	for _, call := range cohereResp.Message.ToolCalls {
+		content = append(content, map[string]interface{}{
+			"type":  "tool_use",
+			"id":    call.ID,
+			"name":  call.Function.Name,
+			"input": toolInput(call.Function.Arguments),
+		})
+	}
+	if len(content) == 0 {
+		content = append(content, map[string]interface{}{"type": "text", "text": ""})
+	}
+
+	result, _ := json.Marshal(map[string]interface{}{
+		"id":            cohereResp.ID,
+		"type":          "message",
+		"role":          "assistant",
+		"model":         requestedModel,
+		"content":       content,
+		"stop_reason":   cohereStopReason(cohereResp.FinishReason),
+		"stop_sequence": nil,
+		"usage":         cohereResp.Usage.anthropic(),
+	})
+	return result
+}
+
+// cohereStreamEvent covers the fields used from Cohere v2 stream events
+type cohereStreamEvent struct {
+	Type  string `json:"type"`
+	ID    string `json:"id"`
+	Index int    `json:"index"`
+	Delta struct {
+		FinishReason string       `json:"finish_reason"`
+		Usage        *cohereUsage `json:"usage"`
+		Message      struct {
+			Content struct {
+				Text string `json:"text"`
+			} `json:"content"`
+			ToolPlan  string         `json:"tool_plan"`
+			ToolCalls cohereToolCall `json:"tool_calls"`
+		} `json:"message"`
+	} `json:"delta"`
+}
+
+// transformCohereStreamToAnthropic converts Cohere's v2 chat stream to
+// Anthropic streaming events. Cohere numbers text and tool-call blocks
+// separately; Anthropic uses one sequence, so indexes are remapped.
+func transformCohereStreamToAnthropic(cohereStream io.Reader, anthropicStream io.Writer, requestedModel string) {
+	writeEvent := func(event map[string]interface{}) {
+		data, _ := json.Marshal(event)
+		fmt.Fprintf(anthropicStream, "data: %s\n\n", data)
+	}
+
+	nextIndex := 0
+	textIndex := make(map[int]int)
+	toolIndex := make(map[int]int)
+	planIndex := -1
+
+	scanner := bufio.NewScanner(cohereStream)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var event cohereStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			continue
+		}
+
+		switch event.Type {
+		case "message-start":
+			writeEvent(map[string]interface{}{
+				"type": "message_start",
+				"message": map[string]interface{}{
+					"id":            event.ID,
+					"type":          "message",
+					"role":          "assistant",
+					"model":         requestedModel,
+					"content":       []interface{}{},
+					"stop_reason":   nil,
+					"stop_sequence": nil,
+					"usage":         map[string]interface{}{},
+				},
+			})
+
+		case "tool-plan-delta":
+			if planIndex == -1 {
+				planIndex = nextIndex
+				nextIndex++
+				writeEvent(map[string]interface{}{
+					"type":          "content_block_start",
+					"index":         planIndex,
+					"content_block": map[string]interface{}{"type": "text", "text": ""},
+				})
+			}
+			writeEvent(map[string]interface{}{
+				"type":  "content_block_delta",
+				"index": planIndex,
+				"delta": map[string]interface{}{"type": "text_delta", "text": event.Delta.Message.ToolPlan},
+			})
+
+		case "content-start":
+			textIndex[event.Index] = nextIndex
+			nextIndex++
+			writeEvent(map[string]interface{}{
+				"type":          "content_block_start",
+				"index":         textIndex[event.Index],
+				"content_block": map[string]interface{}{"type": "text", "text": ""},
+			})
+			if text := event.Delta.Message.Content.Text; text != "" {
+				writeEvent(map[string]interface{}{
+					"type":  "content_block_delta",
+					"index": textIndex[event.Index],
+					"delta": map[string]interface{}{"type": "text_delta", "text": text},
+				})
+			}
+
+		case "content-delta":
+			writeEvent(map[string]interface{}{
+				"type":  "content_block_delta",
+				"index": textIndex[event.Index],
+				"delta": map[string]interface{}{"type": "text_delta", "text": event.Delta.Message.Content.Text},
+			})
+
+		case "content-end":
+			writeEvent(map[string]interface{}{"type": "content_block_stop", "index": textIndex[event.Index]})
+
+		case "tool-call-start":
+			if planIndex != -1 {
+				writeEvent(map[string]interface{}{"type": "content_block_stop", "index": planIndex})
+				planIndex = -1
+			}
+			call := event.Delta.Message.ToolCalls
+			toolIndex[event.Index] = nextIndex
+			nextIndex++
+			writeEvent(map[string]interface{}{
+				"type":  "content_block_start",
+				"index": toolIndex[event.Index],
+				"content_block": map[string]interface{}{
+					"type":  "tool_use",
+					"id":    call.ID,
+					"name":  call.Function.Name,
+					"input": map[string]interface{}{},
+				},
+			})
+			if call.Function.Arguments != "" {
+				writeEvent(map[string]interface{}{
+					"type":  "content_block_delta",
+					"index": toolIndex[event.Index],
+					"delta": map[string]interface{}{"type": "input_json_delta", "partial_json": call.Function.Arguments},
+				})
+			}
+
+		case "tool-call-delta":
+			writeEvent(map[string]interface{}{
+				"type":  "content_block_delta",
+				"index": toolIndex[event.Index],
+				"delta": map[string]interface{}{"type": "input_json_delta", "partial_json": event.Delta.Message.ToolCalls.Function.Arguments},
+			})
+
+		case "tool-call-end":
+			writeEvent(map[string]interface{}{"type": "content_block_stop", "index": toolIndex[event.Index]})
+
+		case "message-end":
+			if planIndex != -1 {
+				writeEvent(map[string]interface{}{"type": "content_block_stop", "index": planIndex})
+			}
+			delta := map[string]interface{}{
+				"type":  "message_delta",
+				"delta": map[string]interface{}{"stop_reason": cohereStopReason(event.Delta.FinishReason), "stop_sequence": nil},
+			}
+			if event.Delta.Usage != nil {
+				delta["usage"] = event.Delta.Usage.anthropic()
+			}
+			writeEvent(delta)
+			writeEvent(map[string]interface{}{"type": "message_stop"})
+			return
+		}
+	}
+}
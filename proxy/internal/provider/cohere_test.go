@@ -0,0 +1,138 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestConvertAnthropicToCohere_ToolUse(t *testing.T) {
+	body := []byte(`{"model":"cohere/command-r-plus","max_tokens":200,
+		"system":[{"type":"text","text":"Be brief."}],
+		"tools":[{"name":"Read","description":"Read a file","input_schema":{"type":"object","properties":{"path":{"type":"string"}},"required":["path"]}}],
+		"tool_choice":{"type":"any"},
+		"messages":[
+			{"role":"user","content":"open main.go"},
+			{"role":"assistant","content":[{"type":"text","text":"Reading it."},{"type":"tool_use","id":"toolu_1","name":"Read","input":{"path":"main.go"}}]},
+			{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":[{"type":"text","text":"package main"}]},{"type":"text","text":"summarize"}]}
+		]}`)
+	var req model.AnthropicRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatal(err)
+	}
+
+	cohereReq := convertAnthropicToCohere(&req)
+	if cohereReq["model"] != "command-r-plus" || cohereReq["tool_choice"] != "REQUIRED" {
+		t.Errorf("unexpected model/tool_choice: %v/%v", cohereReq["model"], cohereReq["tool_choice"])
+	}
+
+	messages := cohereReq["messages"].([]map[string]interface{})
+	roles := []string{}
+	for _, msg := range messages {
+		roles = append(roles, msg["role"].(string))
+	}
+	if got := strings.Join(roles, ","); got != "system,user,assistant,tool,user" {
+		t.Fatalf("roles = %s", got)
+	}
+
+	assistant := messages[2]
+	if assistant["tool_plan"] != "Reading it." {
+		t.Errorf("tool_plan = %v", assistant["tool_plan"])
+	}
+	calls := assistant["tool_calls"].([]map[string]interface{})
+	if fn := calls[0]["function"].(map[string]interface{}); fn["arguments"] != `{"path":"main.go"}` {
+		t.Errorf("arguments = %v", fn["arguments"])
+	}
+	if messages[3]["tool_call_id"] != "toolu_1" || messages[3]["content"] != "package main" {
+		t.Errorf("unexpected tool message %v", messages[3])
+	}
+}
+
+func TestTransformCohereResponseToAnthropic(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     []string
+	}{
+		{
+			"text",
+			`{"id":"c1","finish_reason":"COMPLETE","message":{"role":"assistant","content":[{"type":"text","text":"Hello"}]},"usage":{"billed_units":{"input_tokens":5,"output_tokens":1},"tokens":{"input_tokens":70,"output_tokens":1}}}`,
+			[]string{`"text":"Hello"`, `"stop_reason":"end_turn"`, `"input_tokens":70`},
+		},
+		{
+			"tool call",
+			`{"id":"c2","finish_reason":"TOOL_CALL","message":{"role":"assistant","tool_plan":"I will read it.","tool_calls":[{"id":"call_1","type":"function","function":{"name":"Read","arguments":"{\"path\":\"main.go\"}"}}]},"usage":{"billed_units":{"input_tokens":9,"output_tokens":4}}}`,
+			[]string{`"text":"I will read it."`, `"type":"tool_use"`, `"input":{"path":"main.go"}`, `"stop_reason":"tool_use"`, `"input_tokens":9`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := transformCohereResponseToAnthropic([]byte(tt.response), "command-r")
+			for _, want := range tt.want {
+				if !bytes.Contains(got, []byte(want)) {
+					t.Errorf("response missing %s:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCohereProvider_Streaming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/chat" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer co_test" {
+			t.Errorf("Authorization = %q", got)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{
+			`{"type":"message-start","id":"m1","delta":{"message":{"role":"assistant"}}}`,
+			`{"type":"tool-plan-delta","delta":{"message":{"tool_plan":"Checking."}}}`,
+			`{"type":"tool-call-start","index":0,"delta":{"message":{"tool_calls":{"id":"call_1","type":"function","function":{"name":"Read","arguments":""}}}}}`,
+			`{"type":"tool-call-delta","index":0,"delta":{"message":{"tool_calls":{"function":{"arguments":"{\"path\":\"a\"}"}}}}}`,
+			`{"type":"tool-call-end","index":0}`,
+			`{"type":"message-end","delta":{"finish_reason":"TOOL_CALL","usage":{"tokens":{"input_tokens":20,"output_tokens":8}}}}`,
+		} {
+			io.WriteString(w, "event: x\ndata: "+event+"\n\n")
+		}
+	}))
+	defer server.Close()
+
+	p := NewCohereProvider(&config.OpenAIProviderConfig{BaseURL: server.URL, APIKey: "co_test"})
+
+	body := []byte(`{"model":"command-r","max_tokens":100,"stream":true,"messages":[{"role":"user","content":"read a"}]}`)
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body))
+
+	resp, err := p.ForwardRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ForwardRequest() returned error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	stream, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		`"type":"message_start"`,
+		`{"delta":{"text":"Checking.","type":"text_delta"},"index":0,"type":"content_block_delta"}`,
+		`{"index":0,"type":"content_block_stop"}`,
+		`"index":1,"type":"content_block_start"`,
+		`"partial_json":"{\"path\":\"a\"}"`,
+		`"stop_reason":"tool_use"`,
+		`"output_tokens":8`,
+		`"type":"message_stop"`,
+	} {
+		if !bytes.Contains(stream, []byte(want)) {
+			t.Errorf("stream missing %s:\n%s", want, stream)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// HuggingFaceModelPrefix routes a model to a configured Inference Endpoint,
+// e.g. "hf/reviewer-7b"
+const HuggingFaceModelPrefix = "hf/"
+
+// HuggingFaceProvider forwards to Hugging Face Inference Endpoints running
+// TGI's OpenAI-compatible Messages API. Each endpoint serves a single model, so
+// requests are dispatched by the name after the "hf/" prefix.
+type HuggingFaceProvider struct {
+	endpoints map[string]*hfEndpoint
+}
+
+type hfEndpoint struct {
+	*OpenAIProvider
+	config config.HFEndpointConfig
+}
+
+func NewHuggingFaceProvider(cfg *config.HuggingFaceProviderConfig) *HuggingFaceProvider {
+	p := &HuggingFaceProvider{endpoints: make(map[string]*hfEndpoint)}
+
+	for name, endpointCfg := range cfg.Endpoints {
+		endpointCfg := endpointCfg
+		openAICfg := &config.OpenAIProviderConfig{
+			BaseURL:        endpointCfg.URL,
+			APIKey:         cfg.Token,
+			MaxRetries:     cfg.MaxRetries,
+			InitialBackoff: cfg.InitialBackoff,
+			MaxBackoff:     cfg.MaxBackoff,
+		}
+
+		endpoint := &hfEndpoint{
+			OpenAIProvider: newOpenAICompatibleProvider("huggingface", openAICfg, HuggingFaceModelPrefix),
+			config:         endpointCfg,
+		}
+		endpoint.transform = func(openAIReq map[string]interface{}) {
+			// TGI serves whatever model the endpoint was deployed with
+			openAIReq["model"] = "tgi"
+			openAIReq["max_tokens"] = openAIReq["max_completion_tokens"]
+			delete(openAIReq, "max_completion_tokens")
+
+			if endpointCfg.DisableSystem {
+				mergeSystemIntoFirstUser(openAIReq)
+			}
+		}
+		p.endpoints[name] = endpoint
+	}
+
+	return p
+}
+
+func (p *HuggingFaceProvider) Name() string {
+	return "huggingface"
+}
+
+func (p *HuggingFaceProvider) ForwardRequest(ctx context.Context, originalReq *http.Request) (*http.Response, error) {
+	bodyBytes, err := io.ReadAll(originalReq.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	var anthropicReq model.AnthropicRequest
+	if err := json.Unmarshal(bodyBytes, &anthropicReq); err != nil {
+		return nil, fmt.Errorf("failed to parse anthropic request: %w", err)
+	}
+
+	name := strings.TrimPrefix(anthropicReq.Model, HuggingFaceModelPrefix)
+	endpoint, ok := p.endpoints[name]
+	if !ok {
+		return nil, fmt.Errorf("no Hugging Face endpoint configured for model %s", anthropicReq.Model)
+	}
+
+	// Drop what the endpoint's model can't handle rather than letting TGI reject it
+	modified := false
+	if !endpoint.config.Tools && (len(anthropicReq.Tools) > 0 || anthropicReq.ToolChoice != nil) {
+		anthropicReq.Tools = nil
+		anthropicReq.ToolChoice = nil
+		modified = true
+	}
+	// Tool calls are only translated from complete responses, so requests with
+	// tools are also fetched whole and replayed as a stream
+	wantStream := anthropicReq.Stream
+	if wantStream && (endpoint.config.DisableStreaming || len(anthropicReq.Tools) > 0) {
+		anthropicReq.Stream = false
+		modified = true
+	}
+	if modified {
+		if bodyBytes, err = json.Marshal(anthropicReq); err != nil {
+			return nil, fmt.Errorf("failed to marshal anthropic request: %w", err)
+		}
+	}
+	originalReq.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	originalReq.ContentLength = int64(len(bodyBytes))
+
+	resp, err := endpoint.ForwardRequest(ctx, originalReq)
+	if err != nil || !wantStream || anthropicReq.Stream || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	// The client asked for a stream the endpoint can't produce; replay the
+	// complete message as Anthropic streaming events
+	message, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	stream := anthropicMessageToStream(message)
+	resp.Body = io.NopCloser(bytes.NewReader(stream))
+	resp.ContentLength = int64(len(stream))
+	resp.Header.Set("Content-Type", "text/event-stream")
+	resp.Header.Set("Content-Length", fmt.Sprintf("%d", len(stream)))
+	return resp, nil
+}
+
+// mergeSystemIntoFirstUser folds a leading system message into the first user
+// message, for chat templates that reject the system role (Gemma, Mistral v0.1)
+func mergeSystemIntoFirstUser(openAIReq map[string]interface{}) {
+	messages, ok := openAIReq["messages"].([]map[string]interface{})
+	if !ok || len(messages) < 2 || messages[0]["role"] != "system" {
+		return
+	}
+
+	system, _ := messages[0]["content"].(string)
+	for _, msg := range messages[1:] {
+		if msg["role"] == "user" {
+			content, _ := msg["content"].(string)
+			msg["content"] = system + "\n\n" + content
+			break
+		}
+	}
+	openAIReq["messages"] = messages[1:]
+}
+
+// anthropicMessageToStream renders a complete Anthropic message as the
+// sequence of streaming events a streaming response would have produced
+func anthropicMessageToStream(message []byte) []byte {
+	var msg map[string]interface{}
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return message
+	}
+
+	var buf bytes.Buffer
+	writeEvent := func(event map[string]interface{}) {
+		data, _ := json.Marshal(event)
+		fmt.Fprintf(&buf, "data: %s\n\n", data)
+	}
+
+	content, _ := msg["content"].([]interface{})
+	usage := msg["usage"]
+
+	writeEvent(map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id":            msg["id"],
+			"type":          "message",
+			"role":          "assistant",
+			"model":         msg["model"],
+			"content":       []interface{}{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         map[string]interface{}{},
+		},
+	})
+
+	stopReason := "end_turn"
+	for i, item := range content {
+		block, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		switch block["type"] {
+		case "tool_use":
+			stopReason = "tool_use"
+			input, _ := json.Marshal(block["input"])
+			writeEvent(map[string]interface{}{
+				"type":  "content_block_start",
+				"index": i,
+				"content_block": map[string]interface{}{
+					"type":  "tool_use",
+					"id":    block["id"],
+					"name":  block["name"],
+					"input": map[string]interface{}{},
+				},
+			})
+			writeEvent(map[string]interface{}{
+				"type":  "content_block_delta",
+				"index": i,
+				"delta": map[string]interface{}{"type": "input_json_delta", "partial_json": string(input)},
+			})
+		default:
+			contentBlock := map[string]interface{}{"type": "text", "text": ""}
+			citations, _ := block["citations"].([]interface{})
+			if len(citations) > 0 {
+				contentBlock["citations"] = []interface{}{}
+			}
+			writeEvent(map[string]interface{}{
+				"type":          "content_block_start",
+				"index":         i,
+				"content_block": contentBlock,
+			})
+			for _, citation := range citations {
+				writeEvent(map[string]interface{}{
+					"type":  "content_block_delta",
+					"index": i,
+					"delta": map[string]interface{}{"type": "citations_delta", "citation": citation},
+				})
+			}
+			writeEvent(map[string]interface{}{
+				"type":  "content_block_delta",
+				"index": i,
+				"delta": map[string]interface{}{"type": "text_delta", "text": block["text"]},
+			})
+		}
+		writeEvent(map[string]interface{}{"type": "content_block_stop", "index": i})
+	}
+
+	if reason, ok := msg["stop_reason"].(string); ok && reason != "" {
+		stopReason = reason
+	}
+	delta := map[string]interface{}{
+		"type":  "message_delta",
+		"delta": map[string]interface{}{"stop_reason": stopReason, "stop_sequence": nil},
+	}
+	if usage != nil {
+		delta["usage"] = usage
+	}
+	writeEvent(delta)
+	writeEvent(map[string]interface{}{"type": "message_stop"})
+
+	return buf.Bytes()
+}
@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+func TestHuggingFaceProvider_Capabilities(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer hf_test" {
+			t.Errorf("Authorization = %q", got)
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","model":"tgi","choices":[{"message":{"role":"assistant","content":"LGTM"}}],"usage":{"prompt_tokens":12,"completion_tokens":3}}`))
+	}))
+	defer server.Close()
+
+	p := NewHuggingFaceProvider(&config.HuggingFaceProviderConfig{
+		Token: "hf_test",
+		Endpoints: map[string]config.HFEndpointConfig{
+			"reviewer": {URL: server.URL, DisableSystem: true, DisableStreaming: true},
+		},
+	})
+
+	body := []byte(`{"model":"hf/reviewer","max_tokens":100,"stream":true,
+		"system":[{"type":"text","text":"You review code."}],
+		"tools":[{"name":"Read","input_schema":{"type":"object"}}],
+		"messages":[{"role":"user","content":"check this"}]}`)
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body))
+
+	resp, err := p.ForwardRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ForwardRequest() returned error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if received["stream"] != false {
+		t.Errorf("expected upstream request without streaming, got %v", received["stream"])
+	}
+	if _, ok := received["tools"]; ok {
+		t.Error("expected tools to be dropped for an endpoint without tool support")
+	}
+	if received["model"] != "tgi" || received["max_tokens"] != float64(100) {
+		t.Errorf("unexpected model/max_tokens: %v/%v", received["model"], received["max_tokens"])
+	}
+	messages, _ := received["messages"].([]interface{})
+	if len(messages) != 1 {
+		t.Fatalf("expected system merged into the user message, got %v", messages)
+	}
+	if content := messages[0].(map[string]interface{})["content"].(string); !strings.HasPrefix(content, "You review code.") {
+		t.Errorf("unexpected merged content %q", content)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+	stream, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{`"type":"message_start"`, `"text":"LGTM"`, `"output_tokens":3`, `"type":"message_stop"`} {
+		if !bytes.Contains(stream, []byte(want)) {
+			t.Errorf("stream missing %s:\n%s", want, stream)
+		}
+	}
+}
+
+func TestHuggingFaceProvider_UnknownEndpoint(t *testing.T) {
+	p := NewHuggingFaceProvider(&config.HuggingFaceProviderConfig{})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"hf/missing","messages":[]}`))
+	if _, err := p.ForwardRequest(context.Background(), req); err == nil {
+		t.Error("expected an error for an unconfigured endpoint")
+	}
+}
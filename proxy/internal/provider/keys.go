@@ -0,0 +1,186 @@
+package provider
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// defaultKeyCooldown is how long a rate limited key sits out when the upstream
+// doesn't say how long to wait
+const defaultKeyCooldown = 30 * time.Second
+
+// KeyBalancer is implemented by providers that rotate across several API keys
+type KeyBalancer interface {
+	// KeyUsage reports per-key usage since startup, or nil if the provider
+	// has no keys configured
+	KeyUsage() []model.APIKeyUsage
+}
+
+// keyPool spreads requests across a provider's API keys with smooth weighted
+// round-robin, so even with uneven weights the keys are interleaved rather
+// than used in bursts. Keys that answered 429 are skipped until their cooldown
+// ends, unless every key is cooling down.
+type keyPool struct {
+	provider string
+	mu       sync.Mutex
+	keys     []*pooledKey
+}
+
+type pooledKey struct {
+	name    string
+	key     string
+	weight  int
+	current int // smooth weighted round-robin state
+
+	cooldownUntil time.Time
+	requests      int64
+	rateLimited   int64
+	lastUsed      time.Time
+}
+
+// newKeyPool returns a pool of keys, or of the single key if keys is empty,
+// or nil if there are none
+func newKeyPool(provider, single string, keys []config.APIKeyConfig) *keyPool {
+	if len(keys) == 0 && single != "" {
+		keys = []config.APIKeyConfig{{Name: "default", Key: single}}
+	}
+
+	pool := &keyPool{provider: provider}
+	for i, k := range keys {
+		if k.Key == "" {
+			continue
+		}
+		name := k.Name
+		if name == "" {
+			name = fmt.Sprintf("key-%d", i+1)
+		}
+		weight := k.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		pool.keys = append(pool.keys, &pooledKey{name: name, key: k.Key, weight: weight})
+	}
+	if len(pool.keys) == 0 {
+		return nil
+	}
+	return pool
+}
+
+// next picks the key for the next request
+func (p *keyPool) next() *pooledKey {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	candidates := make([]*pooledKey, 0, len(p.keys))
+	for _, k := range p.keys {
+		if now.After(k.cooldownUntil) {
+			candidates = append(candidates, k)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = p.keys
+	}
+
+	var best *pooledKey
+	total := 0
+	for _, k := range candidates {
+		k.current += k.weight
+		total += k.weight
+		if best == nil || k.current > best.current {
+			best = k
+		}
+	}
+	best.current -= total
+	best.requests++
+	best.lastUsed = now
+	return best
+}
+
+// record notes the upstream's answer to a request made with k
+func (p *keyPool) record(k *pooledKey, resp *http.Response) {
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+
+	cooldown := defaultKeyCooldown
+	if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+		cooldown = retryAfter
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	k.rateLimited++
+	k.cooldownUntil = time.Now().Add(cooldown)
+}
+
+func (p *keyPool) usage() []model.APIKeyUsage {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	usage := make([]model.APIKeyUsage, 0, len(p.keys))
+	for _, k := range p.keys {
+		u := model.APIKeyUsage{
+			Provider:    p.provider,
+			Name:        k.name,
+			Key:         maskKey(k.key),
+			Weight:      k.weight,
+			Requests:    k.requests,
+			RateLimited: k.rateLimited,
+		}
+		if !k.lastUsed.IsZero() {
+			u.LastUsed = k.lastUsed.Format(time.RFC3339)
+		}
+		if k.cooldownUntil.After(now) {
+			u.CooldownUntil = k.cooldownUntil.Format(time.RFC3339)
+		}
+		usage = append(usage, u)
+	}
+	return usage
+}
+
+// transport wraps base so every upstream attempt, retries included, is sent
+// with the next key from the pool. setKey puts the key on the request headers.
+func (p *keyPool) transport(base http.RoundTripper, setKey func(header http.Header, key string)) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &keyTransport{base: base, pool: p, setKey: setKey}
+}
+
+type keyTransport struct {
+	base   http.RoundTripper
+	pool   *keyPool
+	setKey func(header http.Header, key string)
+}
+
+func (t *keyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	k := t.pool.next()
+
+	// A RoundTripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	t.setKey(req.Header, k.key)
+
+	resp, err := t.base.RoundTrip(req)
+	t.pool.record(k, resp)
+	return resp, err
+}
+
+// maskKey keeps just enough of a key to tell keys apart
+func maskKey(key string) string {
+	if len(key) <= 12 {
+		// Too short to show a prefix without giving most of it away
+		return "…"
+	}
+	return key[:7] + "…" + key[len(key)-4:]
+}
@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+func TestKeyPool_Weights(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []config.APIKeyConfig
+		expected string // key picked for each of the first requests
+	}{
+		{
+			"Equal weights take turns",
+			[]config.APIKeyConfig{{Key: "a"}, {Key: "b"}, {Key: "c"}},
+			"abcabc",
+		},
+		{
+			"Weighted keys are interleaved",
+			[]config.APIKeyConfig{{Key: "a", Weight: 2}, {Key: "b", Weight: 1}},
+			"abaaba",
+		},
+		{
+			"Empty keys are skipped",
+			[]config.APIKeyConfig{{Key: "a"}, {Key: ""}, {Key: "b"}},
+			"abab",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := newKeyPool("openai", "", tt.keys)
+			var got strings.Builder
+			for range tt.expected {
+				got.WriteString(pool.next().key)
+			}
+			if got.String() != tt.expected {
+				t.Errorf("picked %q, want %q", got.String(), tt.expected)
+			}
+		})
+	}
+
+	if pool := newKeyPool("openai", "", nil); pool != nil {
+		t.Error("expected no pool without keys")
+	}
+	if pool := newKeyPool("openai", "sk-single", nil); pool == nil || pool.next().key != "sk-single" {
+		t.Error("expected the single api_key to be used when no api_keys are set")
+	}
+}
+
+func TestKeyPool_RateLimitedKeySitsOut(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("x-api-key")
+		mu.Lock()
+		seen = append(seen, key)
+		mu.Unlock()
+
+		if key == "sk-ant-busy-0000000000" {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	p := NewAnthropicProvider(&config.AnthropicProviderConfig{
+		BaseURL:  server.URL,
+		AuthMode: AuthModeAPIKey,
+		APIKeys: []config.APIKeyConfig{
+			{Name: "busy", Key: "sk-ant-busy-0000000000"},
+			{Name: "idle", Key: "sk-ant-idle-1111111111"},
+		},
+	})
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader([]byte(`{}`)))
+		resp, err := p.ForwardRequest(context.Background(), req)
+		if err != nil {
+			t.Fatalf("ForwardRequest() returned error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	// The first request hits the busy key and is rejected (retries are off);
+	// after that only the idle key is used
+	want := []string{"sk-ant-busy-0000000000", "sk-ant-idle-1111111111", "sk-ant-idle-1111111111"}
+	if strings.Join(seen, ",") != strings.Join(want, ",") {
+		t.Errorf("keys sent = %v, want %v", seen, want)
+	}
+
+	usage := p.(KeyBalancer).KeyUsage()
+	if len(usage) != 2 {
+		t.Fatalf("expected usage for 2 keys, got %+v", usage)
+	}
+	busy, idle := usage[0], usage[1]
+	if busy.RateLimited != 1 || busy.CooldownUntil == "" || busy.Requests != 1 {
+		t.Errorf("unexpected usage for the busy key: %+v", busy)
+	}
+	if idle.Requests != 2 || idle.RateLimited != 0 {
+		t.Errorf("unexpected usage for the idle key: %+v", idle)
+	}
+	if busy.Key != "sk-ant-…0000" {
+		t.Errorf("expected a masked key, got %q", busy.Key)
+	}
+}
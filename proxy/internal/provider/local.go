@@ -0,0 +1,207 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+const (
+	LMStudioModelPrefix = "lmstudio/"
+	LlamaCppModelPrefix = "llamacpp/"
+
+	contextCacheTTL = 5 * time.Minute
+)
+
+// ContextLimiter is implemented by providers whose models run with a small,
+// server-configured context window that requests must fit into
+type ContextLimiter interface {
+	// ContextWindow returns the model's context size in tokens, or 0 if unknown
+	ContextWindow(model string) int
+}
+
+// LocalProvider serves OpenAI-compatible local inference servers (LM Studio,
+// llama.cpp server) and knows how to discover their context size.
+type LocalProvider struct {
+	*OpenAIProvider
+	config     *config.LocalProviderConfig
+	httpClient *http.Client
+	detect     func(p *LocalProvider, model string) (int, error)
+
+	mu           sync.Mutex
+	contextSizes map[string]cachedContextSize
+}
+
+type cachedContextSize struct {
+	tokens    int
+	checkedAt time.Time
+}
+
+// NewLMStudioProvider targets LM Studio's server (default http://localhost:1234)
+func NewLMStudioProvider(cfg *config.LocalProviderConfig) *LocalProvider {
+	return newLocalProvider("lmstudio", LMStudioModelPrefix, cfg, detectLMStudioContext)
+}
+
+// NewLlamaCppProvider targets llama.cpp's llama-server (default http://localhost:8080)
+func NewLlamaCppProvider(cfg *config.LocalProviderConfig) *LocalProvider {
+	return newLocalProvider("llamacpp", LlamaCppModelPrefix, cfg, detectLlamaCppContext)
+}
+
+func newLocalProvider(name, prefix string, cfg *config.LocalProviderConfig, detect func(*LocalProvider, string) (int, error)) *LocalProvider {
+	p := &LocalProvider{
+		OpenAIProvider: newOpenAICompatibleProvider(name, &cfg.OpenAIProviderConfig, prefix),
+		config:         cfg,
+		httpClient:     &http.Client{Timeout: 2 * time.Second},
+		detect:         detect,
+		contextSizes:   make(map[string]cachedContextSize),
+	}
+
+	// Both servers predate max_completion_tokens in some versions; send max_tokens as well
+	p.OpenAIProvider.transform = func(openAIReq map[string]interface{}) {
+		openAIReq["max_tokens"] = openAIReq["max_completion_tokens"]
+	}
+	return p
+}
+
+func (p *LocalProvider) ForwardRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	bodyBytes, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+
+	var requested struct {
+		Model string `json:"model"`
+	}
+	json.Unmarshal(bodyBytes, &requested)
+
+	resp, err := p.OpenAIProvider.ForwardRequest(ctx, req)
+	if err != nil || resp.StatusCode < 400 {
+		return resp, err
+	}
+
+	// Local servers report context overflow as an opaque 400/500; translate it to
+	// the error Anthropic returns so clients like Claude Code compact and retry.
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if isContextOverflowError(body) {
+		body, _ = json.Marshal(map[string]interface{}{
+			"type": "error",
+			"error": map[string]interface{}{
+				"type":    "invalid_request_error",
+				"message": fmt.Sprintf("prompt is too long for the %s context window (%d tokens)", p.Name(), p.ContextWindow(requested.Model)),
+			},
+		})
+		resp.StatusCode = http.StatusBadRequest
+		resp.Status = http.StatusText(http.StatusBadRequest)
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	return resp, nil
+}
+
+func isContextOverflowError(body []byte) bool {
+	msg := strings.ToLower(string(body))
+	if !strings.Contains(msg, "context") {
+		return false
+	}
+	for _, marker := range []string{"exceed", "overflow", "too long", "too many tokens", "context length", "context size"} {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// ContextWindow implements ContextLimiter. A configured context_size wins;
+// otherwise the server is asked and the answer cached for a few minutes.
+func (p *LocalProvider) ContextWindow(modelName string) int {
+	if p.config.ContextSize > 0 {
+		return p.config.ContextSize
+	}
+
+	modelName = strings.TrimPrefix(modelName, p.modelPrefix)
+
+	p.mu.Lock()
+	cached, ok := p.contextSizes[modelName]
+	p.mu.Unlock()
+	if ok && time.Since(cached.checkedAt) < contextCacheTTL {
+		return cached.tokens
+	}
+
+	tokens, err := p.detect(p, modelName)
+	if err != nil {
+		tokens = 0
+	}
+
+	p.mu.Lock()
+	p.contextSizes[modelName] = cachedContextSize{tokens: tokens, checkedAt: time.Now()}
+	p.mu.Unlock()
+	return tokens
+}
+
+// serverURL resolves an endpoint against the server root (base URL without /v1)
+func (p *LocalProvider) serverURL(endpoint string) string {
+	base := strings.TrimSuffix(strings.TrimSuffix(p.config.BaseURL, "/"), "/v1")
+	return base + endpoint
+}
+
+func (p *LocalProvider) getJSON(endpoint string, out interface{}) error {
+	resp, err := p.httpClient.Get(p.serverURL(endpoint))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// detectLlamaCppContext reads the per-slot context size from llama-server's /props.
+// The server splits --ctx-size across --parallel slots, so n_ctx here is what a
+// single request actually gets.
+func detectLlamaCppContext(p *LocalProvider, _ string) (int, error) {
+	var props struct {
+		DefaultGenerationSettings struct {
+			NCtx int `json:"n_ctx"`
+		} `json:"default_generation_settings"`
+		NCtx int `json:"n_ctx"`
+	}
+	if err := p.getJSON("/props", &props); err != nil {
+		return 0, err
+	}
+	if props.DefaultGenerationSettings.NCtx > 0 {
+		return props.DefaultGenerationSettings.NCtx, nil
+	}
+	return props.NCtx, nil
+}
+
+// detectLMStudioContext uses LM Studio's REST API, preferring the context length
+// the model was loaded with over the maximum it supports.
+func detectLMStudioContext(p *LocalProvider, modelName string) (int, error) {
+	var info struct {
+		MaxContextLength    int `json:"max_context_length"`
+		LoadedContextLength int `json:"loaded_context_length"`
+	}
+	if err := p.getJSON("/api/v0/models/"+url.PathEscape(modelName), &info); err != nil {
+		return 0, err
+	}
+	if info.LoadedContextLength > 0 {
+		return info.LoadedContextLength, nil
+	}
+	return info.MaxContextLength, nil
+}
@@ -0,0 +1,104 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+func TestLocalProvider_ContextWindow(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/props":
+			w.Write([]byte(`{"default_generation_settings":{"n_ctx":8192},"total_slots":2}`))
+		case "/api/v0/models/qwen2.5-7b-instruct":
+			w.Write([]byte(`{"id":"qwen2.5-7b-instruct","max_context_length":32768,"loaded_context_length":4096}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		provider *LocalProvider
+		model    string
+		expected int
+	}{
+		{
+			"llama.cpp per-slot context",
+			NewLlamaCppProvider(&config.LocalProviderConfig{OpenAIProviderConfig: config.OpenAIProviderConfig{BaseURL: server.URL}}),
+			"llamacpp/whatever",
+			8192,
+		},
+		{
+			"LM Studio prefers loaded context",
+			NewLMStudioProvider(&config.LocalProviderConfig{OpenAIProviderConfig: config.OpenAIProviderConfig{BaseURL: server.URL + "/v1"}}),
+			"lmstudio/qwen2.5-7b-instruct",
+			4096,
+		},
+		{
+			"LM Studio unknown model",
+			NewLMStudioProvider(&config.LocalProviderConfig{OpenAIProviderConfig: config.OpenAIProviderConfig{BaseURL: server.URL}}),
+			"lmstudio/missing",
+			0,
+		},
+		{
+			"Configured size wins",
+			NewLlamaCppProvider(&config.LocalProviderConfig{OpenAIProviderConfig: config.OpenAIProviderConfig{BaseURL: server.URL}, ContextSize: 2048}),
+			"llamacpp/whatever",
+			2048,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.provider.ContextWindow(tt.model); got != tt.expected {
+				t.Errorf("ContextWindow(%q) = %d, want %d", tt.model, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLocalProvider_TranslatesContextOverflow(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["max_tokens"] == nil {
+			t.Errorf("expected max_tokens to be sent alongside max_completion_tokens")
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":{"code":500,"message":"the request exceeds the available context size, try increasing it","type":"exceed_context_size_error"}}`))
+	}))
+	defer server.Close()
+
+	p := NewLlamaCppProvider(&config.LocalProviderConfig{
+		OpenAIProviderConfig: config.OpenAIProviderConfig{BaseURL: server.URL},
+		ContextSize:          4096,
+	})
+
+	body := []byte(`{"model":"llamacpp/qwen","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`)
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body))
+
+	resp, err := p.ForwardRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ForwardRequest() returned error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("StatusCode = %d, want 400", resp.StatusCode)
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(respBody), "prompt is too long") || !strings.Contains(string(respBody), "invalid_request_error") {
+		t.Errorf("unexpected error body %s", respBody)
+	}
+}
@@ -0,0 +1,304 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// OllamaModelPrefix routes a model to Ollama, e.g. "ollama/qwen2.5-coder:32b"
+const OllamaModelPrefix = "ollama/"
+
+// HealthChecker is implemented by providers that can tell, before a request is
+// sent, whether they are able to serve a model right now
+type HealthChecker interface {
+	// Available returns a non-nil error describing why model cannot be served
+	Available(model string) error
+	// Health reports the provider's last observed state
+	Health() model.ProviderHealth
+}
+
+// OllamaProvider forwards to Ollama's OpenAI-compatible endpoint and monitors
+// the local server (/api/ps, /api/tags) so the router can avoid sending work to
+// a box that is down, busy, or missing the model.
+type OllamaProvider struct {
+	*OpenAIProvider
+	config     *config.OllamaProviderConfig
+	httpClient *http.Client
+	logger     *log.Logger
+
+	mu              sync.RWMutex
+	polled          bool
+	lastCheck       time.Time
+	lastErr         error
+	availableModels map[string]bool
+	loadedModels    map[string]ollamaLoadedModel
+	inFlight        int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type ollamaLoadedModel struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	SizeVRAM  int64     `json:"size_vram"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func NewOllamaProvider(cfg *config.OllamaProviderConfig, logger *log.Logger) *OllamaProvider {
+	return &OllamaProvider{
+		OpenAIProvider:  newOpenAICompatibleProvider("ollama", &cfg.OpenAIProviderConfig, OllamaModelPrefix),
+		config:          cfg,
+		httpClient:      &http.Client{Timeout: 10 * time.Second},
+		logger:          logger,
+		availableModels: make(map[string]bool),
+		loadedModels:    make(map[string]ollamaLoadedModel),
+	}
+}
+
+func (p *OllamaProvider) ForwardRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	p.mu.Lock()
+	p.inFlight++
+	p.mu.Unlock()
+
+	resp, err := p.OpenAIProvider.ForwardRequest(ctx, req)
+	if err != nil {
+		p.release()
+		return nil, err
+	}
+
+	// The request occupies the GPU until the (possibly streaming) body is consumed
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: p.release}
+	return resp, nil
+}
+
+func (p *OllamaProvider) release() {
+	p.mu.Lock()
+	p.inFlight--
+	p.mu.Unlock()
+}
+
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	b.once.Do(b.release)
+	return b.ReadCloser.Close()
+}
+
+// Start begins polling the Ollama server and pre-pulls configured models
+func (p *OllamaProvider) Start() {
+	if !p.config.Enable {
+		return
+	}
+
+	interval := 15 * time.Second
+	if d, err := time.ParseDuration(p.config.PollInterval); err == nil && d > 0 {
+		interval = d
+	}
+
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+
+	go func() {
+		defer close(p.done)
+
+		p.poll()
+		if p.config.PrePull {
+			p.prePull()
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.poll()
+			}
+		}
+	}()
+
+	p.logger.Printf("🦙 Monitoring Ollama at %s every %s", p.config.BaseURL, interval)
+}
+
+// Stop ends health polling
+func (p *OllamaProvider) Stop() {
+	if p.stop == nil {
+		return
+	}
+	close(p.stop)
+	<-p.done
+}
+
+func (p *OllamaProvider) poll() {
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	var ps struct {
+		Models []ollamaLoadedModel `json:"models"`
+	}
+
+	err := p.getJSON("/api/tags", &tags)
+	if err == nil {
+		err = p.getJSON("/api/ps", &ps)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	wasHealthy := p.polled && p.lastErr == nil
+	p.polled = true
+	p.lastCheck = time.Now()
+	p.lastErr = err
+	if err != nil {
+		if wasHealthy {
+			p.logger.Printf("⚠️  Ollama became unreachable: %v", err)
+		}
+		return
+	}
+
+	p.availableModels = make(map[string]bool, len(tags.Models))
+	for _, m := range tags.Models {
+		p.availableModels[normalizeOllamaModel(m.Name)] = true
+	}
+	p.loadedModels = make(map[string]ollamaLoadedModel, len(ps.Models))
+	for _, m := range ps.Models {
+		p.loadedModels[normalizeOllamaModel(m.Name)] = m
+	}
+}
+
+// prePull downloads configured models that the server doesn't have yet
+func (p *OllamaProvider) prePull() {
+	for _, name := range p.config.Models {
+		name = normalizeOllamaModel(name)
+
+		p.mu.RLock()
+		present := p.availableModels[name]
+		p.mu.RUnlock()
+		if present {
+			continue
+		}
+
+		p.logger.Printf("🦙 Pulling Ollama model %s...", name)
+		body, _ := json.Marshal(map[string]interface{}{"model": name, "stream": false})
+		// Pulls can take a long time, so don't use the polling client's timeout
+		resp, err := http.Post(p.apiURL("/api/pull"), "application/json", bytes.NewReader(body))
+		if err != nil {
+			p.logger.Printf("❌ Failed to pull Ollama model %s: %v", name, err)
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			p.logger.Printf("❌ Failed to pull Ollama model %s: status %d", name, resp.StatusCode)
+			continue
+		}
+		p.logger.Printf("✅ Pulled Ollama model %s", name)
+	}
+	p.poll()
+}
+
+func (p *OllamaProvider) getJSON(endpoint string, out interface{}) error {
+	resp, err := p.httpClient.Get(p.apiURL(endpoint))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (p *OllamaProvider) apiURL(endpoint string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(p.config.BaseURL, "/"), "/v1") + endpoint
+}
+
+// Available implements HealthChecker
+func (p *OllamaProvider) Available(modelName string) error {
+	name := normalizeOllamaModel(strings.TrimPrefix(modelName, OllamaModelPrefix))
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if !p.polled {
+		// Monitoring disabled or not run yet; nothing to go on
+		return nil
+	}
+	if p.lastErr != nil {
+		return fmt.Errorf("ollama is unreachable: %v", p.lastErr)
+	}
+	if p.config.MaxConcurrent > 0 && p.inFlight >= p.config.MaxConcurrent {
+		return fmt.Errorf("ollama is busy (%d requests in flight)", p.inFlight)
+	}
+	if !p.availableModels[name] {
+		return fmt.Errorf("model %s is not pulled on the ollama server", name)
+	}
+	if _, loaded := p.loadedModels[name]; p.config.RequireLoaded && !loaded {
+		return fmt.Errorf("model %s is not loaded into memory", name)
+	}
+	return nil
+}
+
+// Health implements HealthChecker
+func (p *OllamaProvider) Health() model.ProviderHealth {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	health := model.ProviderHealth{
+		Provider:      p.Name(),
+		Healthy:       p.polled && p.lastErr == nil,
+		InFlight:      p.inFlight,
+		MaxConcurrent: p.config.MaxConcurrent,
+	}
+	if !p.lastCheck.IsZero() {
+		health.LastCheck = p.lastCheck.Format(time.RFC3339)
+	}
+	if p.lastErr != nil {
+		health.Error = p.lastErr.Error()
+	}
+	for name := range p.availableModels {
+		health.AvailableModels = append(health.AvailableModels, name)
+	}
+	for _, m := range p.loadedModels {
+		health.LoadedModels = append(health.LoadedModels, model.LoadedModel{
+			Name:      normalizeOllamaModel(m.Name),
+			SizeBytes: m.Size,
+			VRAMBytes: m.SizeVRAM,
+			ExpiresAt: m.ExpiresAt.Format(time.RFC3339),
+		})
+	}
+	sort.Strings(health.AvailableModels)
+	sort.Slice(health.LoadedModels, func(i, j int) bool {
+		return health.LoadedModels[i].Name < health.LoadedModels[j].Name
+	})
+	return health
+}
+
+// normalizeOllamaModel applies Ollama's implicit ":latest" tag
+func normalizeOllamaModel(name string) string {
+	if !strings.Contains(name, ":") {
+		return name + ":latest"
+	}
+	return name
+}
@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+func TestOllamaProvider_Available(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			w.Write([]byte(`{"models":[{"name":"llama3.1:8b"},{"name":"qwen2.5-coder:latest"}]}`))
+		case "/api/ps":
+			w.Write([]byte(`{"models":[{"name":"llama3.1:8b","size":5000,"size_vram":5000}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.OllamaProviderConfig{
+		OpenAIProviderConfig: config.OpenAIProviderConfig{BaseURL: server.URL},
+		Enable:               true,
+		RequireLoaded:        true,
+		MaxConcurrent:        1,
+	}
+	p := NewOllamaProvider(cfg, log.New(io.Discard, "", 0))
+
+	if err := p.Available("ollama/qwen2.5-coder"); err != nil {
+		t.Errorf("expected availability before the first poll, got %v", err)
+	}
+
+	p.poll()
+
+	tests := []struct {
+		model     string
+		available bool
+	}{
+		{"ollama/llama3.1:8b", true},
+		{"ollama/qwen2.5-coder", false}, // pulled but not loaded
+		{"ollama/mistral", false},       // not pulled
+	}
+	for _, tt := range tests {
+		if err := p.Available(tt.model); (err == nil) != tt.available {
+			t.Errorf("Available(%q) = %v, want available=%v", tt.model, err, tt.available)
+		}
+	}
+
+	p.inFlight = 1
+	if err := p.Available("ollama/llama3.1:8b"); err == nil {
+		t.Error("expected busy error when max_concurrent is reached")
+	}
+	p.inFlight = 0
+
+	server.Close()
+	p.poll()
+	if err := p.Available("ollama/llama3.1:8b"); err == nil {
+		t.Error("expected unreachable error after the server went away")
+	}
+	if p.Health().Healthy {
+		t.Error("expected Health() to report unhealthy")
+	}
+}
+
+func TestChatCompletionsPath(t *testing.T) {
+	tests := map[string]string{
+		"":        "/v1/chat/completions",
+		"/":       "/v1/chat/completions",
+		"/v1":     "/v1/chat/completions",
+		"/v1/":    "/v1/chat/completions",
+		"/openai": "/openai/v1/chat/completions",
+		"/api/v1": "/api/v1/chat/completions",
+	}
+	for base, expected := range tests {
+		if got := chatCompletionsPath(base); got != expected {
+			t.Errorf("chatCompletionsPath(%q) = %q, want %q", base, got, expected)
+		}
+	}
+}
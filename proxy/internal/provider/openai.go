@@ -10,6 +10,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"path"
 	"strings"
 	"time"
 
@@ -18,21 +19,55 @@ import (
 )
 
 type OpenAIProvider struct {
-	client *http.Client
-	config *config.OpenAIProviderConfig
+	name        string
+	client      *http.Client
+	config      *config.OpenAIProviderConfig
+	retry       retryPolicy
+	modelPrefix string // routing prefix stripped before forwarding, e.g. "ollama/"
+
+	// transform, if set, adjusts the converted request for backend quirks
+	transform func(openAIReq map[string]interface{})
+	// transformResponse, if set, post-processes a converted non-streaming
+	// response using fields of the raw one that the conversion drops
+	transformResponse func(openAIResp, anthropicResp []byte) []byte
+	// chatPath, if set, replaces the default /v1/chat/completions path
+	chatPath string
+	// keys rotates the configured API keys, sent as a bearer token
+	keys *keyPool
 }
 
 func NewOpenAIProvider(cfg *config.OpenAIProviderConfig) Provider {
-	return &OpenAIProvider{
+	return newOpenAICompatibleProvider("openai", cfg, "")
+}
+
+// newOpenAICompatibleProvider builds a provider for any backend that speaks the
+// OpenAI chat completions API (Ollama, LM Studio, vLLM, ...)
+func newOpenAICompatibleProvider(name string, cfg *config.OpenAIProviderConfig, modelPrefix string) *OpenAIProvider {
+	p := &OpenAIProvider{
+		name: name,
 		client: &http.Client{
 			Timeout: 300 * time.Second, // 5 minutes timeout
 		},
-		config: cfg,
+		config:      cfg,
+		retry:       newRetryPolicy(cfg.MaxRetries, cfg.InitialBackoff, cfg.MaxBackoff),
+		modelPrefix: modelPrefix,
+		keys:        newKeyPool(name, cfg.APIKey, cfg.APIKeys),
+	}
+	if p.keys != nil {
+		p.client.Transport = p.keys.transport(nil, func(header http.Header, key string) {
+			header.Set("Authorization", "Bearer "+key)
+		})
 	}
+	return p
+}
+
+// KeyUsage implements KeyBalancer
+func (p *OpenAIProvider) KeyUsage() []model.APIKeyUsage {
+	return p.keys.usage()
 }
 
 func (p *OpenAIProvider) Name() string {
-	return "openai"
+	return p.name
 }
 
 func (p *OpenAIProvider) ForwardRequest(ctx context.Context, originalReq *http.Request) (*http.Response, error) {
@@ -48,8 +83,15 @@ func (p *OpenAIProvider) ForwardRequest(ctx context.Context, originalReq *http.R
 		return nil, fmt.Errorf("failed to parse anthropic request: %w", err)
 	}
 
+	if p.modelPrefix != "" {
+		anthropicReq.Model = strings.TrimPrefix(anthropicReq.Model, p.modelPrefix)
+	}
+
 	// Convert to OpenAI format
 	openAIReq := convertAnthropicToOpenAI(&anthropicReq)
+	if p.transform != nil {
+		p.transform(openAIReq)
+	}
 	newBodyBytes, err := json.Marshal(openAIReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal openai request: %w", err)
@@ -69,7 +111,10 @@ func (p *OpenAIProvider) ForwardRequest(ctx context.Context, originalReq *http.R
 	// Update the destination URL for OpenAI
 	proxyReq.URL.Scheme = baseURL.Scheme
 	proxyReq.URL.Host = baseURL.Host
-	proxyReq.URL.Path = "/v1/chat/completions" // OpenAI endpoint
+	proxyReq.URL.Path = chatCompletionsPath(baseURL.Path) // OpenAI endpoint
+	if p.chatPath != "" {
+		proxyReq.URL.Path = path.Join("/", baseURL.Path, p.chatPath)
+	}
 
 	// Update request headers
 	proxyReq.RequestURI = ""
@@ -79,14 +124,11 @@ func (p *OpenAIProvider) ForwardRequest(ctx context.Context, originalReq *http.R
 	proxyReq.Header.Del("anthropic-version")
 	proxyReq.Header.Del("x-api-key")
 
-	// Add OpenAI headers
-	if p.config.APIKey != "" {
-		proxyReq.Header.Set("Authorization", "Bearer "+p.config.APIKey)
-	}
+	// Add OpenAI headers; the API key is set by the key pool's transport
 	proxyReq.Header.Set("Content-Type", "application/json")
 
-	// Forward the request
-	resp, err := p.client.Do(proxyReq)
+	// Forward the request, retrying transient upstream failures
+	resp, err := p.retry.do(ctx, p.client, proxyReq, newBodyBytes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to forward request: %w", err)
 	}
@@ -156,6 +198,9 @@ func (p *OpenAIProvider) ForwardRequest(ctx context.Context, originalReq *http.R
 
 		// Convert OpenAI response back to Anthropic format
 		transformedBody := transformOpenAIResponseToAnthropic(respBody)
+		if p.transformResponse != nil {
+			transformedBody = p.transformResponse(respBody, transformedBody)
+		}
 		resp.Body = io.NopCloser(bytes.NewReader(transformedBody))
 		resp.ContentLength = int64(len(transformedBody))
 		resp.Header.Set("Content-Length", fmt.Sprintf("%d", len(transformedBody)))
@@ -164,6 +209,16 @@ func (p *OpenAIProvider) ForwardRequest(ctx context.Context, originalReq *http.R
 	return resp, nil
 }
 
+// chatCompletionsPath appends the chat completions endpoint to a base path,
+// accepting base URLs configured with or without a trailing /v1
+func chatCompletionsPath(basePath string) string {
+	basePath = strings.TrimSuffix(basePath, "/")
+	if strings.HasSuffix(basePath, "/v1") {
+		return basePath + "/chat/completions"
+	}
+	return path.Join("/", basePath, "v1/chat/completions")
+}
+
 func convertAnthropicToOpenAI(req *model.AnthropicRequest) map[string]interface{} {
 	messages := []map[string]interface{}{}
 
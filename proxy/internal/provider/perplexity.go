@@ -0,0 +1,203 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// PerplexityModelPrefix routes a model to Perplexity explicitly, e.g.
+// "perplexity/sonar-pro"; bare "sonar*" model names are matched too
+const PerplexityModelPrefix = "perplexity/"
+
+// maxCitedText caps cited_text the way Anthropic's web search citations do
+const maxCitedText = 150
+
+// citationMarkers matches runs of Perplexity's numbered references, e.g. "[1][3]"
+var citationMarkers = regexp.MustCompile(`(?:\[\d+\])+`)
+
+// PerplexityProvider forwards to Perplexity's Sonar models, which answer from a
+// live web search. Sonar has no tool calling, so tool definitions are dropped
+// and earlier tool traffic is flattened to text. Its numbered references are
+// translated into Anthropic web_search_result_location citations.
+type PerplexityProvider struct {
+	*OpenAIProvider
+}
+
+func NewPerplexityProvider(cfg *config.OpenAIProviderConfig) *PerplexityProvider {
+	p := &PerplexityProvider{
+		OpenAIProvider: newOpenAICompatibleProvider("perplexity", cfg, PerplexityModelPrefix),
+	}
+	p.chatPath = "chat/completions"
+	p.transform = func(openAIReq map[string]interface{}) {
+		delete(openAIReq, "tools")
+		delete(openAIReq, "tool_choice")
+		delete(openAIReq, "stream_options")
+		openAIReq["max_tokens"] = openAIReq["max_completion_tokens"]
+		delete(openAIReq, "max_completion_tokens")
+		if openAIReq["temperature"] == (*float64)(nil) {
+			delete(openAIReq, "temperature")
+		}
+		mergeConsecutiveRoles(openAIReq)
+	}
+	p.transformResponse = addPerplexityCitations
+	return p
+}
+
+func (p *PerplexityProvider) ForwardRequest(ctx context.Context, originalReq *http.Request) (*http.Response, error) {
+	bodyBytes, err := io.ReadAll(originalReq.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	var anthropicReq model.AnthropicRequest
+	if err := json.Unmarshal(bodyBytes, &anthropicReq); err != nil {
+		return nil, fmt.Errorf("failed to parse anthropic request: %w", err)
+	}
+
+	// Citations only arrive complete at the end of a response, so streams are
+	// fetched whole and replayed
+	wantStream := anthropicReq.Stream
+	if wantStream {
+		anthropicReq.Stream = false
+		if bodyBytes, err = json.Marshal(anthropicReq); err != nil {
+			return nil, fmt.Errorf("failed to marshal anthropic request: %w", err)
+		}
+	}
+	originalReq.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	originalReq.ContentLength = int64(len(bodyBytes))
+
+	resp, err := p.OpenAIProvider.ForwardRequest(ctx, originalReq)
+	if err != nil || !wantStream || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	message, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	stream := anthropicMessageToStream(message)
+	resp.Body = io.NopCloser(bytes.NewReader(stream))
+	resp.ContentLength = int64(len(stream))
+	resp.Header.Set("Content-Type", "text/event-stream")
+	resp.Header.Set("Content-Length", fmt.Sprintf("%d", len(stream)))
+	return resp, nil
+}
+
+// mergeConsecutiveRoles joins adjacent messages from the same role, since
+// Sonar requires user and assistant turns to strictly alternate
+func mergeConsecutiveRoles(openAIReq map[string]interface{}) {
+	messages, ok := openAIReq["messages"].([]map[string]interface{})
+	if !ok {
+		return
+	}
+
+	merged := make([]map[string]interface{}, 0, len(messages))
+	for _, msg := range messages {
+		if n := len(merged); n > 0 && merged[n-1]["role"] == msg["role"] {
+			prev, _ := merged[n-1]["content"].(string)
+			content, _ := msg["content"].(string)
+			merged[n-1]["content"] = prev + "\n\n" + content
+			continue
+		}
+		merged = append(merged, msg)
+	}
+	openAIReq["messages"] = merged
+}
+
+// addPerplexityCitations splits each text block at Perplexity's "[n]"
+// reference markers, attaching the referenced search results as citations to
+// the text they follow
+func addPerplexityCitations(openAIResp, anthropicResp []byte) []byte {
+	var sources struct {
+		Citations     []string `json:"citations"`
+		SearchResults []struct {
+			Title string `json:"title"`
+			URL   string `json:"url"`
+		} `json:"search_results"`
+	}
+	if err := json.Unmarshal(openAIResp, &sources); err != nil {
+		return anthropicResp
+	}
+
+	type source struct{ url, title string }
+	var results []source
+	for _, r := range sources.SearchResults {
+		results = append(results, source{r.URL, r.Title})
+	}
+	if len(results) == 0 {
+		for _, url := range sources.Citations {
+			results = append(results, source{url, url})
+		}
+	}
+	if len(results) == 0 {
+		return anthropicResp
+	}
+
+	var msg map[string]interface{}
+	if err := json.Unmarshal(anthropicResp, &msg); err != nil {
+		return anthropicResp
+	}
+	content, _ := msg["content"].([]interface{})
+
+	var blocks []interface{}
+	for _, item := range content {
+		block, ok := item.(map[string]interface{})
+		text, isText := block["text"].(string)
+		if !ok || block["type"] != "text" || !isText {
+			blocks = append(blocks, item)
+			continue
+		}
+
+		last := 0
+		for _, loc := range citationMarkers.FindAllStringIndex(text, -1) {
+			segment := text[last:loc[0]]
+			last = loc[1]
+
+			cited := []rune(strings.TrimSpace(segment))
+			if len(cited) > maxCitedText {
+				cited = cited[len(cited)-maxCitedText:]
+			}
+			var citations []interface{}
+			for _, ref := range strings.FieldsFunc(text[loc[0]:loc[1]], func(r rune) bool { return r == '[' || r == ']' }) {
+				n, _ := strconv.Atoi(ref)
+				if n < 1 || n > len(results) {
+					continue
+				}
+				citations = append(citations, map[string]interface{}{
+					"type":       "web_search_result_location",
+					"url":        results[n-1].url,
+					"title":      results[n-1].title,
+					"cited_text": string(cited),
+				})
+			}
+
+			citedBlock := map[string]interface{}{"type": "text", "text": segment}
+			if len(citations) > 0 {
+				citedBlock["citations"] = citations
+			}
+			blocks = append(blocks, citedBlock)
+		}
+		if last < len(text) || last == 0 {
+			blocks = append(blocks, map[string]interface{}{"type": "text", "text": text[last:]})
+		}
+	}
+	msg["content"] = blocks
+
+	result, err := json.Marshal(msg)
+	if err != nil {
+		return anthropicResp
+	}
+	return result
+}
@@ -0,0 +1,129 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+func TestAddPerplexityCitations(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     []map[string]interface{} // text and citation count of each block
+	}{
+		{
+			"search results",
+			`{"search_results":[{"title":"Go 1.23","url":"https://go.dev/doc/go1.23"},{"title":"Blog","url":"https://go.dev/blog"}],
+				"choices":[{"message":{"content":"Go 1.23 added iterators.[1][2] It shipped in August."}}]}`,
+			[]map[string]interface{}{
+				{"text": "Go 1.23 added iterators.", "citations": 2},
+				{"text": " It shipped in August.", "citations": 0},
+			},
+		},
+		{
+			"bare citations fall back to URLs",
+			`{"citations":["https://example.com"],"choices":[{"message":{"content":"Example[1]"}}]}`,
+			[]map[string]interface{}{
+				{"text": "Example", "citations": 1},
+			},
+		},
+		{
+			"out of range reference",
+			`{"citations":["https://example.com"],"choices":[{"message":{"content":"Claim[7]"}}]}`,
+			[]map[string]interface{}{
+				{"text": "Claim", "citations": 0},
+			},
+		},
+		{
+			"no sources",
+			`{"choices":[{"message":{"content":"No refs [1]"}}]}`,
+			[]map[string]interface{}{
+				{"text": "No refs [1]", "citations": 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openAIResp := []byte(tt.response)
+			got := addPerplexityCitations(openAIResp, transformOpenAIResponseToAnthropic(openAIResp))
+
+			var msg struct {
+				Content []struct {
+					Text      string                   `json:"text"`
+					Citations []map[string]interface{} `json:"citations"`
+				} `json:"content"`
+			}
+			if err := json.Unmarshal(got, &msg); err != nil {
+				t.Fatalf("invalid response %s: %v", got, err)
+			}
+			if len(msg.Content) != len(tt.want) {
+				t.Fatalf("got %d blocks, want %d: %s", len(msg.Content), len(tt.want), got)
+			}
+			for i, want := range tt.want {
+				block := msg.Content[i]
+				if block.Text != want["text"] || len(block.Citations) != want["citations"] {
+					t.Errorf("block %d = %q with %d citations, want %q with %d", i, block.Text, len(block.Citations), want["text"], want["citations"])
+				}
+			}
+		})
+	}
+}
+
+func TestPerplexityProvider_Streaming(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"p1","model":"sonar","citations":["https://go.dev"],
+			"choices":[{"message":{"role":"assistant","content":"Go is fast.[1]"}}],"usage":{"prompt_tokens":10,"completion_tokens":4}}`))
+	}))
+	defer server.Close()
+
+	p := NewPerplexityProvider(&config.OpenAIProviderConfig{BaseURL: server.URL, APIKey: "pplx"})
+
+	body := []byte(`{"model":"perplexity/sonar","max_tokens":100,"stream":true,
+		"tools":[{"name":"WebFetch","input_schema":{"type":"object"}}],
+		"messages":[
+			{"role":"user","content":"research go"},
+			{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"WebFetch","input":{}}]},
+			{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"page"}]},
+			{"role":"user","content":"and summarize"}
+		]}`)
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body))
+
+	resp, err := p.ForwardRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ForwardRequest() returned error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if _, ok := received["tools"]; ok {
+		t.Error("expected tools to be dropped")
+	}
+	if received["stream"] != false || received["model"] != "sonar" {
+		t.Errorf("unexpected stream/model: %v/%v", received["stream"], received["model"])
+	}
+	messages, _ := received["messages"].([]interface{})
+	if len(messages) != 3 {
+		t.Errorf("expected consecutive user turns merged into 3 messages, got %d", len(messages))
+	}
+
+	stream, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{`"type":"citations_delta"`, `"url":"https://go.dev"`, `"text":"Go is fast."`, `"type":"message_stop"`} {
+		if !bytes.Contains(stream, []byte(want)) {
+			t.Errorf("stream missing %s:\n%s", want, stream)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package provider
 
 import (
 	"context"
+	"io"
 	"net/http"
 )
 
@@ -13,3 +14,22 @@ type Provider interface {
 	// ForwardRequest forwards a request to the provider's API
 	ForwardRequest(ctx context.Context, req *http.Request) (*http.Response, error)
 }
+
+// WireSizer is implemented by response bodies a provider decoded (for example
+// gunzipped) before handing them back. WireBytes reports how many bytes were
+// read from the upstream connection so far.
+type WireSizer interface {
+	WireBytes() int64
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
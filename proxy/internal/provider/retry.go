@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+const (
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// retryPolicy retries upstream calls that failed in a way that is safe to repeat:
+// rate limits and overloads (429, 503, 529) and connections that dropped before
+// any response was received.
+type retryPolicy struct {
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+func newRetryPolicy(maxRetries int, initialBackoff, maxBackoff string) retryPolicy {
+	policy := retryPolicy{
+		maxRetries:     maxRetries,
+		initialBackoff: defaultInitialBackoff,
+		maxBackoff:     defaultMaxBackoff,
+	}
+	if d, err := time.ParseDuration(initialBackoff); err == nil && d > 0 {
+		policy.initialBackoff = d
+	}
+	if d, err := time.ParseDuration(maxBackoff); err == nil && d > 0 {
+		policy.maxBackoff = d
+	}
+	return policy
+}
+
+// do sends req, replaying body on every attempt. Failed attempts are appended to
+// the *model.RetryTrace stored in ctx, if any.
+func (p retryPolicy) do(ctx context.Context, client *http.Client, req *http.Request, body []byte) (*http.Response, error) {
+	trace, _ := ctx.Value(model.RetryTraceKey).(*model.RetryTrace)
+
+	for attempt := 0; ; attempt++ {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+		req.ContentLength = int64(len(body))
+
+		resp, err := client.Do(req)
+
+		if attempt >= p.maxRetries || !isRetryable(resp, err) {
+			return resp, err
+		}
+
+		delay := p.backoff(attempt)
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				if retryAfter > p.maxBackoff {
+					// The upstream wants us to wait longer than we are willing to; surface it
+					return resp, nil
+				}
+				delay = retryAfter
+			}
+		}
+
+		if trace != nil {
+			record := model.RetryAttempt{Attempt: attempt + 1, Delay: delay.Milliseconds()}
+			if resp != nil {
+				record.StatusCode = resp.StatusCode
+			}
+			if err != nil {
+				record.Error = err.Error()
+			}
+			trace.Attempts = append(trace.Attempts, record)
+		}
+
+		if resp != nil {
+			// Drain so the connection can be reused
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns an exponentially growing delay with jitter in [d/2, d)
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := p.initialBackoff << uint(attempt)
+	if d <= 0 || d > p.maxBackoff {
+		d = p.maxBackoff
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		// Only retry failures where the upstream cannot have produced a response
+		return errors.Is(err, syscall.ECONNRESET) ||
+			errors.Is(err, syscall.ECONNREFUSED) ||
+			errors.Is(err, io.EOF) ||
+			errors.Is(err, io.ErrUnexpectedEOF)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable, 529:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter understands both delta-seconds and HTTP-date forms
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
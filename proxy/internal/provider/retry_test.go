@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestRetryPolicy_RetriesOverloadAndReplaysBody(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"model":"claude"}` {
+			t.Errorf("attempt %d got body %q", atomic.LoadInt32(&calls)+1, body)
+		}
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(529)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	policy := newRetryPolicy(3, "1ms", "10ms")
+	trace := &model.RetryTrace{}
+	ctx := context.WithValue(context.Background(), model.RetryTraceKey, trace)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, nil)
+	resp, err := policy.do(ctx, server.Client(), req, []byte(`{"model":"claude"}`))
+	if err != nil {
+		t.Fatalf("do() returned error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+	if len(trace.Attempts) != 2 || trace.Attempts[0].StatusCode != 529 {
+		t.Errorf("unexpected retry trace: %+v", trace.Attempts)
+	}
+}
+
+func TestRetryPolicy_DoesNotRetryClientErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	policy := newRetryPolicy(3, "1ms", "10ms")
+	req, _ := http.NewRequest(http.MethodPost, server.URL, nil)
+	resp, err := policy.do(context.Background(), server.Client(), req, nil)
+	if err != nil {
+		t.Fatalf("do() returned error: %v", err)
+	}
+	resp.Body.Close()
+
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestRetryPolicy_RetryAfterBeyondMaxIsSurfaced(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	policy := newRetryPolicy(3, "1ms", "10ms")
+	req, _ := http.NewRequest(http.MethodPost, server.URL, nil)
+	resp, err := policy.do(context.Background(), server.Client(), req, nil)
+	if err != nil {
+		t.Fatalf("do() returned error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTooManyRequests || calls != 1 {
+		t.Errorf("status = %d, calls = %d; want 429 after a single call", resp.StatusCode, calls)
+	}
+}
+
+func TestRetryPolicy_BackoffBounds(t *testing.T) {
+	policy := newRetryPolicy(5, "100ms", "1s")
+
+	for attempt := 0; attempt < 10; attempt++ {
+		d := policy.backoff(attempt)
+		ceiling := policy.initialBackoff << uint(attempt)
+		if ceiling > policy.maxBackoff {
+			ceiling = policy.maxBackoff
+		}
+		if d < ceiling/2 || d > ceiling {
+			t.Errorf("backoff(%d) = %v, want within [%v, %v]", attempt, d, ceiling/2, ceiling)
+		}
+	}
+
+	if d, ok := parseRetryAfter("2"); !ok || d != 2*time.Second {
+		t.Errorf("parseRetryAfter(\"2\") = %v, %v", d, ok)
+	}
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// agentReloadDelay coalesces the burst of events a single save produces
+// (editors often write a temp file and rename it over the original)
+const agentReloadDelay = 250 * time.Millisecond
+
+// AgentWatcher reloads subagent definitions when files in the agent
+// directories change, so edits take effect without restarting the proxy and
+// prompt hashes keep matching what Claude Code sends.
+type AgentWatcher struct {
+	router  *ModelRouter
+	watcher *fsnotify.Watcher
+	dirs    []string
+	logger  *log.Logger
+
+	mu    sync.Mutex
+	timer *time.Timer
+	done  chan struct{}
+}
+
+func NewAgentWatcher(router *ModelRouter, logger *log.Logger) (*AgentWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+
+	var dirs []string
+	for _, dir := range agentDirs() {
+		dirs = append(dirs, filepath.Clean(dir))
+	}
+
+	return &AgentWatcher{
+		router:  router,
+		watcher: watcher,
+		dirs:    dirs,
+		logger:  logger,
+		done:    make(chan struct{}),
+	}, nil
+}
+
+func (w *AgentWatcher) Start() {
+	w.addWatches()
+	go w.run()
+}
+
+func (w *AgentWatcher) Stop() {
+	close(w.done)
+	w.watcher.Close()
+
+	w.mu.Lock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+}
+
+// addWatches watches each agent directory, or its nearest existing parent so
+// the directory is noticed once it is created
+func (w *AgentWatcher) addWatches() {
+	for _, dir := range w.dirs {
+		for d := dir; ; {
+			if _, err := os.Stat(d); err == nil {
+				if err := w.watcher.Add(d); err != nil {
+					w.logger.Printf("⚠️  Can't watch %s for agent changes: %v", d, err)
+				}
+				break
+			}
+			parent := filepath.Dir(d)
+			if parent == d {
+				break
+			}
+			d = parent
+		}
+	}
+}
+
+// relevant reports whether a change at path can affect agent definitions: a
+// markdown file in an agent directory, or the directory or one of its parents
+// appearing or disappearing
+func (w *AgentWatcher) relevant(path string) bool {
+	path = filepath.Clean(path)
+	for _, dir := range w.dirs {
+		if path == dir || strings.HasPrefix(dir, path+string(filepath.Separator)) {
+			return true
+		}
+		if filepath.Dir(path) == dir && strings.HasSuffix(path, ".md") {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *AgentWatcher) run() {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if !w.relevant(event.Name) {
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				w.addWatches()
+			}
+			w.scheduleReload()
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Printf("⚠️  Agent watcher error: %v", err)
+
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *AgentWatcher) scheduleReload() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timer != nil {
+		w.timer.Reset(agentReloadDelay)
+		return
+	}
+	w.timer = time.AfterFunc(agentReloadDelay, func() {
+		w.logger.Println("🔄 Agent definitions changed, reloading")
+		w.router.loadCustomAgents()
+		w.router.configChanged()
+	})
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func TestAgentWatcher_ReloadsOnChange(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	agentsDir := filepath.Join(home, ".claude", "agents")
+
+	cfg := &config.Config{
+		Subagents: config.SubagentsConfig{
+			Enable:   true,
+			Mappings: map[string]string{"reviewer": "gpt-4o"},
+		},
+	}
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+		"openai":    &stubProvider{name: "openai"},
+	}
+	logger := log.New(os.Stdout, "test: ", log.LstdFlags)
+	router := NewModelRouter(cfg, providers, logger)
+
+	watcher, err := NewAgentWatcher(router, logger)
+	if err != nil {
+		t.Fatalf("NewAgentWatcher() returned error: %v", err)
+	}
+	watcher.Start()
+	defer watcher.Stop()
+
+	subagentRequest := func(prompt string) *model.AnthropicRequest {
+		return &model.AnthropicRequest{
+			Model: "claude-sonnet-4",
+			System: []model.AnthropicSystemMessage{
+				{Text: "You are Claude Code, Anthropic's official CLI for Claude."},
+				{Text: prompt},
+			},
+		}
+	}
+	waitForMatch := func(prompt string, want bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			_, matched := router.matchSubagent(subagentRequest(prompt))
+			if matched == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("matchSubagent(%q) = %v, want %v", prompt, matched, want)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	writeAgent := func(prompt string) {
+		t.Helper()
+		content := "---\nname: reviewer\n---\n" + prompt + "\n"
+		if err := os.WriteFile(filepath.Join(agentsDir, "reviewer.md"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The agents directory doesn't exist yet; creating it is noticed
+	if err := os.MkdirAll(agentsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Give the watcher a moment to start watching the new directory
+	time.Sleep(100 * time.Millisecond)
+	writeAgent("You review code carefully.")
+	waitForMatch("You review code carefully.", true)
+
+	// Editing the prompt replaces the old hash
+	writeAgent("You review code quickly.")
+	waitForMatch("You review code quickly.", true)
+	waitForMatch("You review code carefully.", false)
+}
+
+func TestAgentWatcher_Relevant(t *testing.T) {
+	w := &AgentWatcher{dirs: []string{".claude/agents", "/home/me/.claude/agents"}}
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{".claude/agents/reviewer.md", true},
+		{"/home/me/.claude/agents/planner.md", true},
+		{".claude/agents", true},
+		{".claude", true},
+		{"/home/me/.claude", true},
+		{".claude/agents/.reviewer.md.swp", false},
+		{".claude/settings.json", false},
+		{"main.go", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := w.relevant(tt.path); got != tt.expected {
+				t.Errorf("relevant(%q) = %v, want %v", tt.path, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// Usage alerts
+const (
+	AlertDailyTokens = "dailyTokens"
+	AlertDailyCost   = "dailyCost"
+	AlertUsageWindow = "usageWindow"
+	AlertBudget      = "budget"
+)
+
+const defaultAlertInterval = time.Minute
+
+// alertRule is one alert and the threshold it fires at
+type alertRule struct {
+	alert     string
+	threshold float64
+}
+
+// Alerter checks usage against the configured thresholds in the background
+// and posts an alert to a webhook when one is crossed. Each alert fires once
+// per day, usage window or budget period; one whose post failed is tried
+// again on the next check.
+type Alerter struct {
+	mu         sync.Mutex
+	rules      []alertRule
+	webhookURL string
+	interval   time.Duration
+	storage    StorageService
+	router     *ModelRouter
+	client     *http.Client
+	logger     *log.Logger
+	fired      map[string]string // alert and budget -> the period it last fired for
+	now        func() time.Time
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// NewAlerter sets up the alerts in cfg, posting to notify's webhook unless
+// they have their own
+func NewAlerter(cfg config.AlertsConfig, notify config.NotifyConfig, storage StorageService, router *ModelRouter, logger *log.Logger) *Alerter {
+	a := &Alerter{
+		webhookURL: cfg.WebhookURL,
+		interval:   defaultAlertInterval,
+		storage:    storage,
+		router:     router,
+		client:     &http.Client{Timeout: notifyTimeout},
+		logger:     logger,
+		fired:      make(map[string]string),
+		now:        time.Now,
+	}
+	if a.webhookURL == "" {
+		a.webhookURL = notify.WebhookURL
+	}
+	if cfg.Interval != "" {
+		interval, err := time.ParseDuration(cfg.Interval)
+		if err != nil || interval <= 0 {
+			logger.Printf("⚠️  Invalid alert interval %q, using %s", cfg.Interval, defaultAlertInterval)
+		} else {
+			a.interval = interval
+		}
+	}
+
+	for _, rule := range []alertRule{
+		{AlertDailyTokens, float64(cfg.DailyTokens)},
+		{AlertDailyCost, cfg.DailyCost},
+		{AlertUsageWindow, cfg.WindowPercent},
+		{AlertBudget, cfg.BudgetPercent},
+	} {
+		if rule.threshold > 0 {
+			a.rules = append(a.rules, rule)
+		}
+	}
+	if cfg.WindowPercent > 0 && router.window.tokenLimit == 0 && router.window.messageLimit == 0 {
+		logger.Printf("⚠️  The usage window alert needs a usage_window token_limit or message_limit to measure against")
+	}
+	if cfg.BudgetPercent > 0 && !router.budget.Enabled() {
+		logger.Printf("⚠️  The budget alert needs a budget to measure against")
+	}
+	if len(a.rules) > 0 && a.webhookURL == "" {
+		logger.Printf("⚠️  Alerts need a webhook_url, alerts are off")
+		a.rules = nil
+	}
+	return a
+}
+
+// Enabled reports whether any alert is set
+func (a *Alerter) Enabled() bool {
+	return len(a.rules) > 0
+}
+
+// Interval returns how often usage is checked
+func (a *Alerter) Interval() time.Duration {
+	return a.interval
+}
+
+// Start checks usage every interval until Stop
+func (a *Alerter) Start() {
+	if !a.Enabled() {
+		return
+	}
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+
+	go func() {
+		defer close(a.done)
+
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+		for {
+			a.check()
+			select {
+			case <-a.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (a *Alerter) Stop() {
+	if a.stop == nil {
+		return
+	}
+	close(a.stop)
+	<-a.done
+}
+
+func (a *Alerter) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	if _, err := a.Check(ctx); err != nil {
+		a.logger.Printf("⚠️  Failed to check usage alerts: %v", err)
+	}
+}
+
+// Check compares usage with every alert's threshold and posts the alerts
+// crossed that haven't fired for the current period, returning those posted
+func (a *Alerter) Check(ctx context.Context) ([]model.UsageAlert, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	alerts, err := a.crossed()
+	if err != nil {
+		return nil, err
+	}
+	var sent []model.UsageAlert
+	for _, alert := range alerts {
+		if err := postWebhook(ctx, a.client, a.webhookURL, alert); err != nil {
+			return sent, fmt.Errorf("failed to send %s alert: %w", alert.Alert, err)
+		}
+		a.fired[alert.Alert+alert.Budget] = alert.Period
+		a.logger.Printf("🚨 %s", alert.Text)
+		sent = append(sent, alert)
+	}
+	return sent, nil
+}
+
+// crossed returns the alerts whose threshold usage has reached and that
+// haven't fired for the current period yet; a.mu must be held
+func (a *Alerter) crossed() ([]model.UsageAlert, error) {
+	now := a.now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	var stats *model.UsageStats
+	var alerts []model.UsageAlert
+	for _, rule := range a.rules {
+		alert := model.UsageAlert{Alert: rule.alert, Threshold: rule.threshold, Period: day.Format("2006-01-02")}
+		switch rule.alert {
+		case AlertDailyTokens, AlertDailyCost:
+			if stats == nil {
+				var err error
+				if stats, err = a.storage.GetStats(day, day.AddDate(0, 0, 1)); err != nil {
+					return nil, err
+				}
+			}
+			if rule.alert == AlertDailyTokens {
+				alert.Value = float64(stats.InputTokens + stats.OutputTokens + stats.CacheReadTokens + stats.CacheCreationTokens)
+				alert.Text = fmt.Sprintf("%.0f tokens used today, over the %.0f token alert", alert.Value, alert.Threshold)
+			} else {
+				alert.Value = roundTo(stats.CostUSD, 2)
+				alert.Text = fmt.Sprintf("$%.2f spent today, over the $%.2f alert", alert.Value, alert.Threshold)
+			}
+		case AlertUsageWindow:
+			window := a.router.UsageWindow()
+			if !window.Active || window.Utilization == nil {
+				continue
+			}
+			alert.Value = *window.Utilization
+			alert.Period = window.StartedAt
+			alert.Text = fmt.Sprintf("%.0f%% of the usage window used, over the %.0f%% alert; it resets at %s",
+				alert.Value, alert.Threshold, window.ResetsAt)
+		case AlertBudget:
+			// One alert for each budget, fired once per period
+			for _, status := range a.router.Budget().Report() {
+				alert := alert
+				alert.Budget = strings.TrimSpace(status.Model + " " + status.Period)
+				alert.Value = status.Percent
+				alert.Period = status.StartedAt
+				alert.Text = fmt.Sprintf("%.0f%% of the %s budget used ($%.2f of $%.2f), over the %.0f%% alert",
+					alert.Value, alert.Budget, status.SpentUSD, status.BudgetUSD, alert.Threshold)
+				if alert.Value >= alert.Threshold && a.fired[alert.Alert+alert.Budget] != alert.Period {
+					alerts = append(alerts, alert)
+				}
+			}
+			continue
+		}
+
+		if alert.Value >= alert.Threshold && a.fired[alert.Alert] != alert.Period {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts, nil
+}
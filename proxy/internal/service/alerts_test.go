@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func TestAlerter_Check(t *testing.T) {
+	var received []model.UsageAlert
+	failing := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var alert model.UsageAlert
+		json.NewDecoder(r.Body).Decode(&alert)
+		received = append(received, alert)
+	}))
+	defer server.Close()
+
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	if err := storage.SetPrices(NewPriceTable(nil)); err != nil {
+		t.Fatalf("SetPrices() returned error: %v", err)
+	}
+	logger := log.New(io.Discard, "", 0)
+	cfg := &config.Config{
+		UsageWindow: config.UsageWindowConfig{TokenLimit: 2000000},
+		Budget:      config.BudgetConfig{Models: map[string]config.ModelBudgetConfig{"sonnet": {Daily: 5}}},
+	}
+	router := NewModelRouter(cfg, map[string]provider.Provider{"anthropic": &stubProvider{name: "anthropic"}}, logger)
+	alerter := NewAlerter(config.AlertsConfig{DailyTokens: 1500000, DailyCost: 5, WindowPercent: 80, BudgetPercent: 100},
+		config.NotifyConfig{WebhookURL: server.URL}, storage, router, logger)
+
+	// Each request is 1M sonnet input tokens, $3
+	request := func(id string) {
+		t.Helper()
+		log := testRequestLog(id)
+		log.Provider = "anthropic"
+		log.RoutedModel = log.Model
+		if _, err := storage.SaveRequest(log); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		log.Response = &model.ResponseLog{StatusCode: 200, Body: []byte(`{"usage":{"input_tokens":1000000}}`)}
+		if err := storage.UpdateRequestWithResponse(log); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+		router.RecordSpend(log)
+	}
+
+	tests := []struct {
+		name     string
+		request  string
+		failing  bool
+		expected []string
+	}{
+		{"Below every threshold", "first", false, nil},
+		{"Webhook down", "second", true, nil},
+		{"Retried once the webhook is back", "", false, []string{AlertDailyTokens, AlertDailyCost, AlertUsageWindow, AlertBudget}},
+		{"Fired once per period", "third", false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.request != "" {
+				request(tt.request)
+			}
+			failing, received = tt.failing, nil
+
+			sent, err := alerter.Check(context.Background())
+			if (err != nil) != tt.failing {
+				t.Fatalf("Check() error = %v, want error %v", err, tt.failing)
+			}
+			if len(sent) != len(tt.expected) || len(received) != len(tt.expected) {
+				t.Fatalf("Check() sent %+v, webhook received %+v, want %v", sent, received, tt.expected)
+			}
+			for i, alert := range tt.expected {
+				if sent[i].Alert != alert || received[i].Text == "" || sent[i].Value < sent[i].Threshold {
+					t.Errorf("alert %d = %+v, want %s over its threshold", i, sent[i], alert)
+				}
+			}
+		})
+	}
+
+	if today := time.Now().Format("2006-01-02"); alerter.fired[AlertDailyCost] != today {
+		t.Errorf("daily cost alert fired for %q, want %q", alerter.fired[AlertDailyCost], today)
+	}
+	if fired := alerter.fired[AlertBudget+"sonnet daily"]; fired == "" {
+		t.Errorf("sonnet daily budget alert didn't fire, fired %v", alerter.fired)
+	}
+}
+
+func TestNewAlerter(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	router := NewModelRouter(&config.Config{}, map[string]provider.Provider{}, logger)
+
+	tests := []struct {
+		name     string
+		cfg      config.AlertsConfig
+		notify   config.NotifyConfig
+		enabled  bool
+		interval time.Duration
+	}{
+		{"No thresholds", config.AlertsConfig{WebhookURL: "http://localhost/hook"}, config.NotifyConfig{}, false, time.Minute},
+		{"No webhook", config.AlertsConfig{DailyCost: 10}, config.NotifyConfig{}, false, time.Minute},
+		{"Notify's webhook", config.AlertsConfig{DailyCost: 10}, config.NotifyConfig{WebhookURL: "http://localhost/hook"}, true, time.Minute},
+		{"Interval", config.AlertsConfig{DailyTokens: 1000, WebhookURL: "http://localhost/hook", Interval: "5m"}, config.NotifyConfig{}, true, 5 * time.Minute},
+		{"Invalid interval", config.AlertsConfig{DailyTokens: 1000, WebhookURL: "http://localhost/hook", Interval: "often"}, config.NotifyConfig{}, true, time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alerter := NewAlerter(tt.cfg, tt.notify, nil, router, logger)
+			if alerter.Enabled() != tt.enabled || alerter.Interval() != tt.interval {
+				t.Errorf("Enabled(), Interval() = %v, %s, want %v, %s", alerter.Enabled(), alerter.Interval(), tt.enabled, tt.interval)
+			}
+		})
+	}
+}
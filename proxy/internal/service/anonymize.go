@@ -0,0 +1,234 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// DefaultAnonymityK is how many sessions must share a value before an
+// anonymized export shows it
+const DefaultAnonymityK = 5
+
+// anonymizedOther replaces values seen in fewer than K sessions
+const anonymizedOther = "other"
+
+// AnonymizeOptions configures an Anonymizer. Salt keys the hashes, so
+// without it hashed names can't be matched against a list of known ones;
+// exports made with the same salt can be joined on them.
+type AnonymizeOptions struct {
+	K    int
+	Salt []byte
+}
+
+type anonymizedRecord struct {
+	model.AnonymizedRequest
+	at time.Time
+}
+
+// Anonymizer strips requests down to what they say about Claude Code's
+// behavior: timings, token counts, models, message and tool counts, with
+// sessions and tool names hashed and no text at all. Requests are reduced as
+// they're added, so a long history can be streamed through it; the values
+// that would single out fewer than K sessions (a rare model, client version or
+// tool, or a quiet hour) can only be generalized or replaced with "other" once
+// all are in.
+type Anonymizer struct {
+	opts    AnonymizeOptions
+	records []*anonymizedRecord
+}
+
+func NewAnonymizer(opts AnonymizeOptions) *Anonymizer {
+	if opts.K <= 0 {
+		opts.K = DefaultAnonymityK
+	}
+	return &Anonymizer{opts: opts}
+}
+
+// Add anonymizes a request, keeping none of its content
+func (a *Anonymizer) Add(request *model.RequestLog) {
+	a.records = append(a.records, anonymizeRequest(request, a.hash))
+}
+
+func (a *Anonymizer) hash(value string) string {
+	mac := hmac.New(sha256.New, a.opts.Salt)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// AnonymizeRequests anonymizes requests with an Anonymizer
+func AnonymizeRequests(requests []*model.RequestLog, opts AnonymizeOptions) []model.AnonymizedRequest {
+	anonymizer := NewAnonymizer(opts)
+	for _, request := range requests {
+		anonymizer.Add(request)
+	}
+	return anonymizer.Records()
+}
+
+// Records returns the requests added, oldest first, with the values too few
+// sessions share generalized
+func (a *Anonymizer) Records() []model.AnonymizedRequest {
+	records, k := a.records, a.opts.K
+	sort.SliceStable(records, func(i, j int) bool { return records[i].at.Before(records[j].at) })
+
+	guardValues(records, k, func(r *anonymizedRecord) *string { return &r.Client })
+	guardValues(records, k, func(r *anonymizedRecord) *string { return &r.Model })
+	guardValues(records, k, func(r *anonymizedRecord) *string { return &r.RoutedModel })
+	guardValues(records, k, func(r *anonymizedRecord) *string { return &r.Provider })
+	guardValues(records, k, func(r *anonymizedRecord) *string { return &r.RouteReason })
+	guardValues(records, k, func(r *anonymizedRecord) *string { return &r.StopReason })
+	guardToolCalls(records, k)
+	guardTimes(records, k)
+
+	anonymized := make([]model.AnonymizedRequest, len(records))
+	for i, record := range records {
+		anonymized[i] = record.AnonymizedRequest
+	}
+	return anonymized
+}
+
+func anonymizeRequest(request *model.RequestLog, hash func(string) string) *anonymizedRecord {
+	record := &anonymizedRecord{}
+	record.at, _ = time.Parse(time.RFC3339, request.Timestamp)
+	record.Client, _, _ = strings.Cut(request.UserAgent, " ")
+	record.Model = request.Model
+	record.RoutedModel = request.RoutedModel
+	record.Provider = request.Provider
+	record.RequestBytes = request.RequestBytes
+	if request.Routing != nil {
+		record.RouteReason = request.Routing.Reason
+	}
+
+	session := request.RequestID
+	var req model.AnthropicRequest
+	if body, err := json.Marshal(request.Body); err == nil && json.Unmarshal(body, &req) == nil {
+		if key := sessionKey(&req); key != "" {
+			session = key
+		}
+		record.Stream = req.Stream
+		record.Messages = len(req.Messages)
+		record.ToolsOffered = len(req.Tools)
+		if len(req.Messages) > 0 {
+			record.ToolResults = countBlocks(req.Messages[len(req.Messages)-1].Content, "tool_result")
+		}
+	}
+	record.Session = hash("session:" + session)
+
+	if resp := request.Response; resp != nil {
+		record.StatusCode = resp.StatusCode
+		record.ResponseTime = resp.ResponseTime
+		var body struct {
+			Content    []model.ContentBlock  `json:"content"`
+			StopReason string                `json:"stop_reason"`
+			Usage      *model.AnthropicUsage `json:"usage"`
+		}
+		if json.Unmarshal(resp.Body, &body) == nil {
+			record.StopReason = body.StopReason
+			if body.Usage != nil {
+				record.InputTokens = body.Usage.InputTokens
+				record.OutputTokens = body.Usage.OutputTokens
+				record.CacheReadTokens = body.Usage.CacheReadInputTokens
+				record.CacheCreationTokens = body.Usage.CacheCreationInputTokens
+			}
+			for _, block := range body.Content {
+				if block.Type == "tool_use" {
+					record.ToolCalls = append(record.ToolCalls, hash("tool:"+block.Name))
+				}
+			}
+		}
+	}
+	return record
+}
+
+// countBlocks counts the content blocks of a message with the given type
+func countBlocks(content interface{}, blockType string) int {
+	blocks, ok := content.([]interface{})
+	if !ok {
+		return 0
+	}
+	n := 0
+	for _, item := range blocks {
+		if block, ok := item.(map[string]interface{}); ok && block["type"] == blockType {
+			n++
+		}
+	}
+	return n
+}
+
+// guardValues replaces the values of a field that fewer than k sessions have
+// with "other"
+func guardValues(records []*anonymizedRecord, k int, field func(*anonymizedRecord) *string) {
+	sessions := make(map[string]map[string]bool)
+	for _, r := range records {
+		value := *field(r)
+		if sessions[value] == nil {
+			sessions[value] = make(map[string]bool)
+		}
+		sessions[value][r.Session] = true
+	}
+	for _, r := range records {
+		if value := field(r); *value != "" && len(sessions[*value]) < k {
+			*value = anonymizedOther
+		}
+	}
+}
+
+// guardToolCalls does the same as guardValues for each hashed tool name
+func guardToolCalls(records []*anonymizedRecord, k int) {
+	sessions := make(map[string]map[string]bool)
+	for _, r := range records {
+		for _, tool := range r.ToolCalls {
+			if sessions[tool] == nil {
+				sessions[tool] = make(map[string]bool)
+			}
+			sessions[tool][r.Session] = true
+		}
+	}
+	for _, r := range records {
+		for i, tool := range r.ToolCalls {
+			if len(sessions[tool]) < k {
+				r.ToolCalls[i] = anonymizedOther
+			}
+		}
+	}
+}
+
+// guardTimes gives each request the hour it was made in if at least k
+// sessions were active that hour, otherwise its day if k were active that
+// day, otherwise no time at all
+func guardTimes(records []*anonymizedRecord, k int) {
+	hours := make(map[string]map[string]bool)
+	days := make(map[string]map[string]bool)
+	for _, r := range records {
+		if r.at.IsZero() {
+			continue
+		}
+		hour, day := r.at.UTC().Format("2006-01-02T15:00Z"), r.at.UTC().Format("2006-01-02")
+		if hours[hour] == nil {
+			hours[hour] = make(map[string]bool)
+		}
+		if days[day] == nil {
+			days[day] = make(map[string]bool)
+		}
+		hours[hour][r.Session] = true
+		days[day][r.Session] = true
+	}
+	for _, r := range records {
+		if r.at.IsZero() {
+			continue
+		}
+		hour, day := r.at.UTC().Format("2006-01-02T15:00Z"), r.at.UTC().Format("2006-01-02")
+		switch {
+		case len(hours[hour]) >= k:
+			r.Time = hour
+		case len(days[day]) >= k:
+			r.Time = day
+		}
+	}
+}
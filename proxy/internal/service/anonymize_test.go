@@ -0,0 +1,93 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestAnonymizeRequests(t *testing.T) {
+	base := time.Date(2025, 6, 15, 14, 0, 0, 0, time.UTC)
+	secret := "the password is hunter2"
+
+	// Six sessions on sonnet at 14:xx, one on a rare model late at night
+	var requests []*model.RequestLog
+	addRequest := func(session int, modelName, tool string, at time.Time) {
+		body := map[string]interface{}{
+			"model":    modelName,
+			"stream":   true,
+			"metadata": map[string]string{"user_id": fmt.Sprintf("user_abc_account_x_session_s%d", session)},
+			"messages": []interface{}{
+				map[string]interface{}{"role": "user", "content": secret},
+				map[string]interface{}{"role": "assistant", "content": "ok"},
+				map[string]interface{}{"role": "user", "content": []interface{}{
+					map[string]interface{}{"type": "tool_result", "tool_use_id": "t1", "content": secret},
+				}},
+			},
+		}
+		responseBody, _ := json.Marshal(map[string]interface{}{
+			"content":     []interface{}{map[string]interface{}{"type": "text", "text": secret}, map[string]interface{}{"type": "tool_use", "id": "t2", "name": tool, "input": map[string]string{"command": secret}}},
+			"stop_reason": "tool_use",
+			"usage":       model.AnthropicUsage{InputTokens: 10, OutputTokens: 20, CacheReadInputTokens: 3000},
+		})
+		requests = append(requests, &model.RequestLog{
+			RequestID: fmt.Sprintf("r%d", len(requests)),
+			Timestamp: at.Format(time.RFC3339),
+			Body:      body,
+			Model:     modelName, RoutedModel: modelName, Provider: "anthropic",
+			UserAgent: "claude-cli/1.0.80 (external, cli)",
+			Routing:   &model.RoutingExplanation{Reason: model.RouteReasonDefault},
+			Response:  &model.ResponseLog{StatusCode: 200, ResponseTime: 1500, Body: responseBody},
+		})
+	}
+	for session := 0; session < 6; session++ {
+		tool := "Bash"
+		if session == 0 {
+			tool = "mcp__acme_internal__deploy"
+		}
+		addRequest(session, "claude-sonnet-4-20250514", tool, base.Add(time.Duration(session)*time.Minute))
+	}
+	addRequest(99, "claude-secret-preview", "Bash", base.Add(9*time.Hour))
+
+	records := AnonymizeRequests(requests, AnonymizeOptions{K: 5, Salt: []byte("salt")})
+	if len(records) != len(requests) {
+		t.Fatalf("got %d records, want %d", len(records), len(requests))
+	}
+
+	exported, _ := json.Marshal(records)
+	for _, leak := range []string{secret, "hunter2", "mcp__acme_internal__deploy", "Bash", "claude-secret-preview", "s99"} {
+		if strings.Contains(string(exported), leak) {
+			t.Errorf("export contains %q", leak)
+		}
+	}
+
+	first, rare := records[0], records[len(records)-1]
+	if first.Model != "claude-sonnet-4-20250514" || first.Client != "claude-cli/1.0.80" {
+		t.Errorf("common values were generalized: model %q, client %q", first.Model, first.Client)
+	}
+	if first.Time != "2025-06-15T14:00Z" {
+		t.Errorf("Time = %q, want the hour", first.Time)
+	}
+	if first.Messages != 3 || first.ToolResults != 1 || !first.Stream || first.OutputTokens != 20 || first.CacheReadTokens != 3000 || first.StopReason != "tool_use" {
+		t.Errorf("counts not kept: %+v", first)
+	}
+	if len(first.ToolCalls) != 1 || first.ToolCalls[0] != anonymizedOther {
+		t.Errorf("ToolCalls = %v, want the rare tool replaced with %q", first.ToolCalls, anonymizedOther)
+	}
+	if second := records[1]; len(second.ToolCalls) != 1 || second.ToolCalls[0] == anonymizedOther || second.ToolCalls[0] == "Bash" {
+		t.Errorf("ToolCalls = %v, want a hashed common tool", second.ToolCalls)
+	}
+	if rare.Model != anonymizedOther || rare.RoutedModel != anonymizedOther {
+		t.Errorf("rare model kept: %q / %q", rare.Model, rare.RoutedModel)
+	}
+	if rare.Time != "2025-06-15" {
+		t.Errorf("Time = %q, want the hour generalized to the day", rare.Time)
+	}
+	if first.Session == records[1].Session || first.Session != AnonymizeRequests(requests[:1], AnonymizeOptions{Salt: []byte("salt")})[0].Session {
+		t.Error("session hashes should differ per session and be stable for a salt")
+	}
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// archiveMaxRequests is the most requests written to one archive object
+var archiveMaxRequests = 10000
+
+// archiveEncryptedSuffix ends the names of objects encrypted with the storage
+// encryption key
+const archiveEncryptedSuffix = ".aes-gcm"
+
+// Archiver moves old requests out of the database into an S3 or Cloud Storage
+// bucket, as gzip-compressed JSON lines in the format of the export, and
+// fetches them back one at a time. Each object holds requests of one UTC day.
+// With a storage encryption key, objects are encrypted with it like the
+// payloads in the database, so requests don't leave it in the clear.
+type Archiver struct {
+	storage   StorageService
+	store     objectStore
+	prefix    string
+	prices    *PriceTable
+	afterDays int
+	codec     payloadCodec
+}
+
+// NewArchiver opens the bucket of cfg.Archive; without an archive URL the
+// archiver is disabled
+func NewArchiver(cfg *config.StorageConfig, storage StorageService, prices *PriceTable) (*Archiver, error) {
+	aead, err := newPayloadCipher(cfg.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	archiver := &Archiver{storage: storage, prices: prices, afterDays: cfg.Archive.AfterDays, codec: payloadCodec{aead: aead}}
+	if cfg.Archive.URL == "" {
+		return archiver, nil
+	}
+	store, prefix, err := newObjectStore(cfg.Archive)
+	if err != nil {
+		return nil, err
+	}
+	archiver.store = store
+	archiver.prefix = prefix
+	return archiver, nil
+}
+
+func (a *Archiver) Enabled() bool {
+	return a.store != nil
+}
+
+// archiveObject collects the requests of one object before it's uploaded
+type archiveObject struct {
+	day  string
+	data bytes.Buffer
+	gz   *gzip.Writer
+	ids  []string
+}
+
+// Archive uploads the requests stored before cutoff and removes them from the
+// database, object by object, so a failure leaves the requests of objects not
+// yet uploaded in place. Requests that can't be read, such as encrypted ones
+// without the key, are left in the database.
+func (a *Archiver) Archive(ctx context.Context, cutoff time.Time) (requests, objects int, err error) {
+	if !a.Enabled() {
+		return 0, 0, fmt.Errorf("no archive is configured")
+	}
+
+	var current *archiveObject
+	flush := func() error {
+		if current == nil {
+			return nil
+		}
+		object := current
+		current = nil
+		if err := object.gz.Close(); err != nil {
+			return fmt.Errorf("failed to compress archive: %w", err)
+		}
+		key := fmt.Sprintf("%s/requests-%s.jsonl.gz", object.day, object.ids[0])
+		if a.prefix != "" {
+			key = a.prefix + "/" + key
+		}
+		data, contentType := object.data.Bytes(), "application/gzip"
+		if a.codec.aead != nil {
+			encrypted, err := a.codec.encrypt(data)
+			if err != nil {
+				return err
+			}
+			data, contentType = encrypted, "application/octet-stream"
+			key += archiveEncryptedSuffix
+		}
+		if err := a.store.put(ctx, key, data, contentType); err != nil {
+			return err
+		}
+		archived, err := a.storage.ArchiveRequests(object.ids, key)
+		if err != nil {
+			return err
+		}
+		requests += archived
+		objects++
+		return nil
+	}
+
+	err = a.storage.ExportRequests(time.Time{}, cutoff, "", func(request *model.RequestLog) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		day := "undated"
+		if timestamp, err := time.Parse(time.RFC3339, request.Timestamp); err == nil {
+			day = timestamp.UTC().Format("2006-01-02")
+		}
+		if current != nil && (current.day != day || len(current.ids) >= archiveMaxRequests) {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if current == nil {
+			current = &archiveObject{day: day}
+			current.gz = gzip.NewWriter(&current.data)
+		}
+
+		line, err := json.Marshal(ExportRequest(request, a.prices))
+		if err != nil {
+			return fmt.Errorf("failed to marshal request %s: %w", request.RequestID, err)
+		}
+		if _, err := current.gz.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to compress archive: %w", err)
+		}
+		current.ids = append(current.ids, request.RequestID)
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	return requests, objects, err
+}
+
+// Fetch reads an archived request back from its object in the bucket,
+// decrypting the object if it was encrypted
+func (a *Archiver) Fetch(ctx context.Context, archived *model.ArchivedRequest) (*model.RequestLog, error) {
+	if !a.Enabled() {
+		return nil, fmt.Errorf("no archive is configured")
+	}
+	data, err := a.store.get(ctx, archived.Object)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(archived.Object, archiveEncryptedSuffix) {
+		if data, err = a.codec.decrypt(data); err != nil {
+			return nil, err
+		}
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress archive: %w", err)
+	}
+	defer reader.Close()
+
+	lines := bufio.NewReader(reader)
+	for {
+		line, readErr := lines.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, fmt.Errorf("failed to read archive: %w", readErr)
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			var request model.RequestLog
+			if err := json.Unmarshal(line, &request); err == nil && request.RequestID == archived.RequestID {
+				return &request, nil
+			}
+		}
+		if readErr == io.EOF {
+			return nil, fmt.Errorf("request %s not found in %s", archived.RequestID, archived.Object)
+		}
+	}
+}
+
+// NewArchiveTask archives requests older than the "after_days" arg, by
+// default storage.archive.after_days
+func NewArchiveTask(archiver *Archiver) ScheduledTask {
+	return func(ctx context.Context, args map[string]string) (string, error) {
+		days := argInt(args, "after_days", archiver.afterDays)
+		if days <= 0 {
+			return "", fmt.Errorf("after_days must be positive, got %d", days)
+		}
+
+		requests, objects, err := archiver.Archive(ctx, time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			return "", fmt.Errorf("archived %d request(s) before failing: %w", requests, err)
+		}
+		return fmt.Sprintf("archived %d request(s) older than %d day(s) to %d object(s)", requests, days, objects), nil
+	}
+}
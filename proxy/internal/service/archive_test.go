@@ -0,0 +1,257 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// fakeBucket is an S3-compatible server keeping objects in memory
+type fakeBucket struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	fail    bool
+}
+
+func (b *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") ||
+		r.Header.Get("X-Amz-Content-Sha256") == "" {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		if b.fail {
+			http.Error(w, "<Error><Code>InternalError</Code></Error>", http.StatusInternalServerError)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		b.objects[r.URL.Path] = data
+	case http.MethodGet:
+		data, ok := b.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	}
+}
+
+func (b *fakeBucket) setFailing(fail bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fail = fail
+}
+
+func (b *fakeBucket) object(path string) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.objects[path]
+}
+
+func TestArchiver_Archive(t *testing.T) {
+	bucket := &fakeBucket{objects: map[string][]byte{}}
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	archiver, err := NewArchiver(&config.StorageConfig{Archive: config.ArchiveConfig{
+		URL:             "s3://claude-logs/archive",
+		Endpoint:        server.URL,
+		AccessKeyID:     "test-key",
+		SecretAccessKey: "test-secret",
+	}}, storage, NewPriceTable(nil))
+	if err != nil {
+		t.Fatalf("NewArchiver() returned error: %v", err)
+	}
+
+	now := time.Now().UTC()
+	requests := []struct {
+		id        string
+		timestamp time.Time
+	}{
+		{"old-a", time.Date(2026, 1, 15, 9, 0, 0, 0, time.UTC)},
+		{"old-b", time.Date(2026, 1, 15, 18, 0, 0, 0, time.UTC)},
+		{"old-c", time.Date(2026, 1, 16, 9, 0, 0, 0, time.UTC)},
+		{"recent", now},
+	}
+	for _, r := range requests {
+		request := testRequestLog(r.id)
+		request.Timestamp = r.timestamp.Format(time.RFC3339)
+		request.Body = map[string]string{"prompt": "request " + r.id}
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+	}
+
+	cutoff := now.AddDate(0, 0, -1)
+	bucket.setFailing(true)
+	if archived, _, err := archiver.Archive(context.Background(), cutoff); err == nil || !strings.Contains(err.Error(), "InternalError") || archived != 0 {
+		t.Fatalf("Archive() with a failing bucket = %d, %v, want an error and nothing archived", archived, err)
+	}
+	if _, total, _ := storage.GetRequests(1, 10); total != 4 {
+		t.Fatalf("requests after a failed archive = %d, want all 4 kept", total)
+	}
+
+	bucket.setFailing(false)
+	archived, objects, err := archiver.Archive(context.Background(), cutoff)
+	if err != nil || archived != 3 || objects != 2 {
+		t.Fatalf("Archive() = %d, %d, %v, want 3 requests in 2 objects", archived, objects, err)
+	}
+	if _, total, _ := storage.GetRequests(1, 10); total != 1 {
+		t.Errorf("requests left = %d, want only the recent one", total)
+	}
+
+	object := bucket.object("/claude-logs/archive/2026-01-15/requests-old-a.jsonl.gz")
+	if object == nil {
+		t.Fatal("no object for 2026-01-15, want one per day named by its first request")
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(object))
+	if err != nil {
+		t.Fatalf("object isn't gzip-compressed: %v", err)
+	}
+	lines, _ := io.ReadAll(reader)
+	if got := bytes.Count(lines, []byte("\n")); got != 2 {
+		t.Errorf("object holds %d line(s), want the 2 requests of its day", got)
+	}
+
+	tests := []struct {
+		name           string
+		id             string
+		expectArchived bool
+	}{
+		{"Archived request", "old-b", true},
+		{"Request still stored", "recent", false},
+		{"Unknown request", "missing", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, err := storage.GetArchivedRequest(tt.id)
+			if err != nil {
+				t.Fatalf("GetArchivedRequest() returned error: %v", err)
+			}
+			if (status != nil) != tt.expectArchived {
+				t.Fatalf("GetArchivedRequest() = %+v, want archived %v", status, tt.expectArchived)
+			}
+			if status == nil {
+				return
+			}
+
+			request, err := archiver.Fetch(context.Background(), status)
+			if err != nil {
+				t.Fatalf("Fetch() returned error: %v", err)
+			}
+			if request.RequestID != tt.id || request.Body.(map[string]interface{})["prompt"] != "request "+tt.id {
+				t.Errorf("Fetch() = %+v, want the archived request", request)
+			}
+		})
+	}
+
+	missing := &model.ArchivedRequest{RequestID: "old-c", Object: "archive/2026-01-15/requests-old-a.jsonl.gz"}
+	if _, err := archiver.Fetch(context.Background(), missing); err == nil {
+		t.Error("Fetch() from an object without the request returned no error")
+	}
+}
+
+func TestArchiver_Encrypted(t *testing.T) {
+	bucket := &fakeBucket{objects: map[string][]byte{}}
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+
+	cfg := &config.StorageConfig{
+		DBPath:        filepath.Join(t.TempDir(), "requests.db"),
+		EncryptionKey: testEncryptionKey,
+		Archive: config.ArchiveConfig{
+			URL:             "s3://claude-logs/archive",
+			Endpoint:        server.URL,
+			AccessKeyID:     "test-key",
+			SecretAccessKey: "test-secret",
+		},
+	}
+	storage, err := NewSQLiteStorageService(cfg)
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	archiver, err := NewArchiver(cfg, storage, NewPriceTable(nil))
+	if err != nil {
+		t.Fatalf("NewArchiver() returned error: %v", err)
+	}
+
+	request := testRequestLog("secret")
+	request.Timestamp = time.Date(2026, 1, 15, 9, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	request.Body = map[string]string{"prompt": "the database password"}
+	if _, err := storage.SaveRequest(request); err != nil {
+		t.Fatalf("SaveRequest() returned error: %v", err)
+	}
+	if archived, _, err := archiver.Archive(context.Background(), time.Now()); err != nil || archived != 1 {
+		t.Fatalf("Archive() = %d, %v, want the request archived", archived, err)
+	}
+
+	object := bucket.object("/claude-logs/archive/2026-01-15/requests-secret.jsonl.gz.aes-gcm")
+	if object == nil {
+		t.Fatalf("no encrypted object, bucket holds %v", bucket.objects)
+	}
+	if _, err := gzip.NewReader(bytes.NewReader(object)); err == nil {
+		t.Error("object is plain gzip, want it encrypted")
+	}
+
+	status, err := storage.GetArchivedRequest("secret")
+	if err != nil || status == nil {
+		t.Fatalf("GetArchivedRequest() = %+v, %v", status, err)
+	}
+	fetched, err := archiver.Fetch(context.Background(), status)
+	if err != nil || fetched.Body.(map[string]interface{})["prompt"] != "the database password" {
+		t.Errorf("Fetch() = %+v, %v, want the decrypted request", fetched, err)
+	}
+
+	// Without the key the object can't be read back
+	withoutKey, err := NewArchiver(&config.StorageConfig{Archive: cfg.Archive}, storage, NewPriceTable(nil))
+	if err != nil {
+		t.Fatalf("NewArchiver() returned error: %v", err)
+	}
+	if _, err := withoutKey.Fetch(context.Background(), status); err == nil {
+		t.Error("Fetch() without the encryption key returned no error")
+	}
+}
+
+func TestNewArchiver_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.StorageConfig
+	}{
+		{"Unsupported scheme", config.StorageConfig{Archive: config.ArchiveConfig{URL: "ftp://bucket/prefix", AccessKeyID: "key", SecretAccessKey: "secret"}}},
+		{"No bucket", config.StorageConfig{Archive: config.ArchiveConfig{URL: "s3:///prefix", AccessKeyID: "key", SecretAccessKey: "secret"}}},
+		{"No keys", config.StorageConfig{Archive: config.ArchiveConfig{URL: "gs://bucket/prefix"}}},
+		{"Invalid encryption key", config.StorageConfig{EncryptionKey: "short", Archive: config.ArchiveConfig{URL: "s3://bucket/prefix", AccessKeyID: "key", SecretAccessKey: "secret"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewArchiver(&tt.cfg, nil, nil); err == nil {
+				t.Error("NewArchiver() returned no error")
+			}
+		})
+	}
+
+	archiver, err := NewArchiver(&config.StorageConfig{}, nil, nil)
+	if err != nil || archiver.Enabled() {
+		t.Errorf("NewArchiver() without a URL = %v, enabled %v, want a disabled archiver", err, archiver.Enabled())
+	}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// blobStore holds payloads too large to keep in the database, under keys
+// chosen when they're stored
+type blobStore interface {
+	put(data []byte) (string, error)
+	get(key string) ([]byte, error)
+	remove(key string) error
+}
+
+// fileBlobStore keeps each blob in its own file under dir, spread over
+// subdirectories named by the first two characters of the key
+type fileBlobStore struct {
+	dir string
+}
+
+func newFileBlobStore(dir string) (*fileBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &fileBlobStore{dir: dir}, nil
+}
+
+func (f *fileBlobStore) put(data []byte) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to name blob: %w", err)
+	}
+	key := hex.EncodeToString(id)
+
+	path, err := f.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	// Written to a temporary name first so a crash never leaves a partial blob
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("failed to write blob: %w", err)
+	}
+	return key, nil
+}
+
+func (f *fileBlobStore) get(key string) ([]byte, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob: %w", err)
+	}
+	return data, nil
+}
+
+func (f *fileBlobStore) remove(key string) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return nil
+}
+
+// path rejects keys that aren't ones put made, so a tampered reference can't
+// read or delete files outside dir
+func (f *fileBlobStore) path(key string) (string, error) {
+	if len(key) != 32 || strings.Trim(key, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(f.dir, key[:2], key), nil
+}
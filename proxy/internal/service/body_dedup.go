@@ -0,0 +1,110 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// payloadEncodingDedup is the first encoding step of a body whose large parts
+// were moved to body_segments, leaving segment markers in their place
+const payloadEncodingDedup = "dedup"
+
+// segmentMarker stands in a stored body for a part kept in body_segments
+type segmentMarker struct {
+	Segment string `json:"$segment"`
+}
+
+var segmentMarkerPrefix = []byte(`{"$segment":`)
+
+// dedupBody moves the parts of a request body that Claude Code resends on
+// every call out of it: the system prompt, the tool definitions and each
+// message, when at least minBytes long. It returns the body with markers in
+// their place and the parts keyed by the SHA-256 of their JSON, or the body
+// unchanged and no parts when there's nothing to move.
+func dedupBody(body []byte, minBytes int) ([]byte, map[string][]byte) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body, nil
+	}
+
+	segments := make(map[string][]byte)
+	split := func(value json.RawMessage) json.RawMessage {
+		if len(value) < minBytes {
+			return value
+		}
+		sum := sha256.Sum256(value)
+		hash := hex.EncodeToString(sum[:])
+		segments[hash] = value
+		marker, _ := json.Marshal(segmentMarker{Segment: hash})
+		return marker
+	}
+
+	for _, key := range []string{"system", "tools"} {
+		if value, ok := fields[key]; ok {
+			fields[key] = split(value)
+		}
+	}
+	var messages []json.RawMessage
+	if err := json.Unmarshal(fields["messages"], &messages); err == nil {
+		for i := range messages {
+			messages[i] = split(messages[i])
+		}
+		fields["messages"], _ = json.Marshal(messages)
+	}
+
+	if len(segments) == 0 {
+		return body, nil
+	}
+	deduped, err := json.Marshal(fields)
+	if err != nil {
+		return body, nil
+	}
+	return deduped, segments
+}
+
+// expandBody puts the parts dedupBody moved out of a body back, loading each
+// one by its hash
+func expandBody(body []byte, load func(hash string) ([]byte, error)) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("failed to read deduplicated body: %w", err)
+	}
+
+	expand := func(value json.RawMessage) (json.RawMessage, error) {
+		if !bytes.HasPrefix(value, segmentMarkerPrefix) {
+			return value, nil
+		}
+		var marker segmentMarker
+		if err := json.Unmarshal(value, &marker); err != nil || marker.Segment == "" {
+			return value, nil
+		}
+		return load(marker.Segment)
+	}
+
+	var err error
+	for _, key := range []string{"system", "tools"} {
+		if value, ok := fields[key]; ok {
+			if fields[key], err = expand(value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var messages []json.RawMessage
+	if json.Unmarshal(fields["messages"], &messages) == nil {
+		for i := range messages {
+			if messages[i], err = expand(messages[i]); err != nil {
+				return nil, err
+			}
+		}
+		fields["messages"], _ = json.Marshal(messages)
+	}
+
+	expanded, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rebuild deduplicated body: %w", err)
+	}
+	return expanded, nil
+}
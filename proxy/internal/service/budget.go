@@ -0,0 +1,518 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// Budget periods
+const (
+	BudgetDaily   = "daily"
+	BudgetMonthly = "monthly"
+)
+
+// defaultBudgetThresholds apply when a budget is set without thresholds: from
+// 80% opus and sonnet calls go one tier down, at 100% requests are blocked
+var defaultBudgetThresholds = []config.BudgetThresholdConfig{
+	{Percent: 80, Downgrade: map[string]string{
+		"opus":   "claude-sonnet-4-20250514",
+		"sonnet": "claude-3-5-haiku-20241022",
+	}},
+	{Percent: 100, Block: true},
+}
+
+// BudgetExceededError is returned when a request is blocked because the budget
+// is used up, or past a threshold that blocks before it is. Model is the key of
+// a model budget, empty for the overall one.
+type BudgetExceededError struct {
+	Period string
+	Budget float64
+	Spent  float64
+	Model  string
+}
+
+func (e *BudgetExceededError) Error() string {
+	budget := fmt.Sprintf("%s budget of $%.2f", e.Period, e.Budget)
+	if e.Model != "" {
+		budget += fmt.Sprintf(" for %q models", e.Model)
+	}
+	if !e.HardCap() {
+		return fmt.Sprintf("%s is %.0f%% used ($%.2f spent), past its blocking threshold", budget, e.Spent/e.Budget*100, e.Spent)
+	}
+	return fmt.Sprintf("%s is used up ($%.2f spent)", budget, e.Spent)
+}
+
+// HardCap reports whether the budget itself is spent, rather than a threshold
+// short of it reached
+func (e *BudgetExceededError) HardCap() bool {
+	return e.Spent >= e.Budget
+}
+
+// BudgetTracker keeps a running total of what proxied requests cost this day
+// and this month, and says what the budget thresholds call for
+type BudgetTracker struct {
+	daily      float64
+	monthly    float64
+	thresholds []budgetThreshold // ascending by percent
+	prices     *PriceTable
+	now        func() time.Time
+
+	mu         sync.Mutex
+	day        time.Time // start of the day being counted
+	month      time.Time // start of the month being counted
+	daySpent   float64
+	monthSpent float64
+	models     []*modelBudget  // longest key first
+	unpriced   map[string]bool // models already warned about
+}
+
+// modelBudget is the budget of the models matching key, and what they have
+// spent this day and month
+type modelBudget struct {
+	key        string
+	daily      float64
+	monthly    float64
+	downgrade  string
+	daySpent   float64
+	monthSpent float64
+}
+
+type budgetThreshold struct {
+	percent   float64
+	block     bool
+	keys      []string // downgrade keys, longest first
+	downgrade map[string]string
+}
+
+// target returns the model that modelName is downgraded to, or ""
+func (t *budgetThreshold) target(modelName string) string {
+	lower := strings.ToLower(modelName)
+	for _, key := range t.keys {
+		if strings.Contains(lower, key) && t.downgrade[key] != modelName {
+			return t.downgrade[key]
+		}
+	}
+	return ""
+}
+
+// budgetUsage is how much of the tighter budget has been spent
+type budgetUsage struct {
+	period  string
+	budget  float64
+	spent   float64
+	percent float64
+}
+
+func NewBudgetTracker(cfg config.BudgetConfig, prices *PriceTable) *BudgetTracker {
+	b := &BudgetTracker{
+		daily:    cfg.Daily,
+		monthly:  cfg.Monthly,
+		prices:   prices,
+		now:      time.Now,
+		unpriced: make(map[string]bool),
+	}
+
+	thresholds := cfg.Thresholds
+	if len(thresholds) == 0 {
+		thresholds = defaultBudgetThresholds
+	}
+	for _, t := range thresholds {
+		threshold := budgetThreshold{percent: t.Percent, block: t.Block, downgrade: make(map[string]string)}
+		for key, target := range t.Downgrade {
+			if key = strings.ToLower(key); key != "" && target != "" {
+				threshold.downgrade[key] = target
+				threshold.keys = append(threshold.keys, key)
+			}
+		}
+		sort.Slice(threshold.keys, func(i, j int) bool {
+			if len(threshold.keys[i]) != len(threshold.keys[j]) {
+				return len(threshold.keys[i]) > len(threshold.keys[j])
+			}
+			return threshold.keys[i] < threshold.keys[j]
+		})
+		b.thresholds = append(b.thresholds, threshold)
+	}
+	sort.SliceStable(b.thresholds, func(i, j int) bool { return b.thresholds[i].percent < b.thresholds[j].percent })
+
+	for key, budget := range cfg.Models {
+		if key = strings.ToLower(key); key != "" && (budget.Daily > 0 || budget.Monthly > 0) {
+			b.models = append(b.models, &modelBudget{key: key, daily: budget.Daily, monthly: budget.Monthly, downgrade: budget.Downgrade})
+		}
+	}
+	sort.Slice(b.models, func(i, j int) bool {
+		if len(b.models[i].key) != len(b.models[j].key) {
+			return len(b.models[i].key) > len(b.models[j].key)
+		}
+		return b.models[i].key < b.models[j].key
+	})
+
+	b.day, b.month = periodStarts(b.now())
+	return b
+}
+
+// Enabled reports whether a daily or monthly budget is set, overall or for
+// any model
+func (b *BudgetTracker) Enabled() bool {
+	return b.daily > 0 || b.monthly > 0 || len(b.models) > 0
+}
+
+// modelBudget returns the budget of the models modelName matches, or nil; the
+// longest key wins
+func (b *BudgetTracker) modelBudget(modelName string) *modelBudget {
+	lower := strings.ToLower(modelName)
+	for _, m := range b.models {
+		if strings.Contains(lower, m.key) {
+			return m
+		}
+	}
+	return nil
+}
+
+func periodStarts(now time.Time) (time.Time, time.Time) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return day, month
+}
+
+// rollover starts a new day or month once the current one is over; b.mu must
+// be held
+func (b *BudgetTracker) rollover() {
+	day, month := periodStarts(b.now())
+	if !day.Equal(b.day) {
+		b.day, b.daySpent = day, 0
+		for _, m := range b.models {
+			m.daySpent = 0
+		}
+	}
+	if !month.Equal(b.month) {
+		b.month, b.monthSpent = month, 0
+		for _, m := range b.models {
+			m.monthSpent = 0
+		}
+	}
+}
+
+// Load seeds the running totals with what requests stored earlier today and
+// this month cost, so a restart doesn't reset the budget
+func (b *BudgetTracker) Load(storage StorageService) error {
+	if !b.Enabled() {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollover()
+
+	now := b.now()
+	month, err := storage.GetRoutedUsage(b.month, now)
+	if err != nil {
+		return err
+	}
+	day, err := storage.GetRoutedUsage(b.day, now)
+	if err != nil {
+		return err
+	}
+
+	// Stored costs keep the prices requests were made at
+	b.monthSpent, b.daySpent = 0, 0
+	for _, m := range b.models {
+		m.monthSpent, m.daySpent = 0, 0
+	}
+	for _, u := range month {
+		b.monthSpent += u.CostUSD
+		if m := b.modelBudget(u.Model); m != nil {
+			m.monthSpent += u.CostUSD
+		}
+	}
+	for _, u := range day {
+		b.daySpent += u.CostUSD
+		if m := b.modelBudget(u.Model); m != nil {
+			m.daySpent += u.CostUSD
+		}
+	}
+	return nil
+}
+
+// Record adds the cost of a completed request to the running totals. It
+// returns false when the model's price isn't known, in which case the request
+// isn't counted.
+func (b *BudgetTracker) Record(modelName string, usage *model.AnthropicUsage) bool {
+	if !b.Enabled() || usage == nil {
+		return true
+	}
+	cost, ok := b.prices.Cost(modelName, usage)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !ok {
+		if b.unpriced[modelName] {
+			return true
+		}
+		b.unpriced[modelName] = true
+		return false
+	}
+	b.rollover()
+	b.daySpent += cost
+	b.monthSpent += cost
+	if m := b.modelBudget(modelName); m != nil {
+		m.daySpent += cost
+		m.monthSpent += cost
+	}
+	return true
+}
+
+// budgetLimit is one budget and what has been spent against it
+type budgetLimit struct {
+	name     string
+	budget   float64
+	spent    float64
+	resetsAt time.Time
+}
+
+// limits returns the budgets that are set
+func (b *BudgetTracker) limits() []budgetLimit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollover()
+
+	var limits []budgetLimit
+	if b.daily > 0 {
+		limits = append(limits, budgetLimit{name: BurnLimitDailyBudget, budget: b.daily, spent: b.daySpent, resetsAt: b.day.AddDate(0, 0, 1)})
+	}
+	if b.monthly > 0 {
+		limits = append(limits, budgetLimit{name: BurnLimitMonthlyBudget, budget: b.monthly, spent: b.monthSpent, resetsAt: b.month.AddDate(0, 1, 0)})
+	}
+	return limits
+}
+
+// usage returns the budget that is most used up
+func (b *BudgetTracker) usage() budgetUsage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollover()
+
+	var used budgetUsage
+	if b.daily > 0 {
+		used = budgetUsage{period: BudgetDaily, budget: b.daily, spent: b.daySpent, percent: b.daySpent / b.daily * 100}
+	}
+	if b.monthly > 0 {
+		if percent := b.monthSpent / b.monthly * 100; percent > used.percent || used.period == "" {
+			used = budgetUsage{period: BudgetMonthly, budget: b.monthly, spent: b.monthSpent, percent: percent}
+		}
+	}
+	return used
+}
+
+// threshold returns the highest threshold of the overall budget reached, if
+// any
+func (b *BudgetTracker) threshold() (*budgetThreshold, budgetUsage) {
+	if b.daily <= 0 && b.monthly <= 0 {
+		return nil, budgetUsage{}
+	}
+	used := b.usage()
+	for i := len(b.thresholds) - 1; i >= 0; i-- {
+		if used.percent >= b.thresholds[i].percent {
+			return &b.thresholds[i], used
+		}
+	}
+	return nil, used
+}
+
+// modelExceeded returns the budget of the models modelName matches if either
+// of its periods is used up
+func (b *BudgetTracker) modelExceeded(modelName string) (budgetUsage, modelBudget, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m := b.modelBudget(modelName)
+	if m == nil {
+		return budgetUsage{}, modelBudget{}, false
+	}
+	b.rollover()
+
+	if m.daily > 0 && m.daySpent >= m.daily {
+		return budgetUsage{period: BudgetDaily, budget: m.daily, spent: m.daySpent, percent: m.daySpent / m.daily * 100}, *m, true
+	}
+	if m.monthly > 0 && m.monthSpent >= m.monthly {
+		return budgetUsage{period: BudgetMonthly, budget: m.monthly, spent: m.monthSpent, percent: m.monthSpent / m.monthly * 100}, *m, true
+	}
+	return budgetUsage{}, modelBudget{}, false
+}
+
+// Report sets out every budget's spend this period, the pace it has been
+// spent at so far, and what that pace comes to by the time it resets
+func (b *BudgetTracker) Report() []model.BudgetStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollover()
+
+	now := b.now()
+	statuses := []model.BudgetStatus{}
+	add := func(key string, daily, monthly, daySpent, monthSpent float64) {
+		if daily > 0 {
+			statuses = append(statuses, budgetStatus(key, BudgetDaily, daily, daySpent, b.day, b.day.AddDate(0, 0, 1), now))
+		}
+		if monthly > 0 {
+			statuses = append(statuses, budgetStatus(key, BudgetMonthly, monthly, monthSpent, b.month, b.month.AddDate(0, 1, 0), now))
+		}
+	}
+	add("", b.daily, b.monthly, b.daySpent, b.monthSpent)
+	models := append([]*modelBudget(nil), b.models...)
+	sort.Slice(models, func(i, j int) bool { return models[i].key < models[j].key })
+	for _, m := range models {
+		add(m.key, m.daily, m.monthly, m.daySpent, m.monthSpent)
+	}
+	return statuses
+}
+
+// budgetStatus works out the pace and forecast of a budget that has spent
+// spent since start. The pace averages at least an hour, so the first
+// requests of a period don't project it running out at once.
+func budgetStatus(key, period string, budget, spent float64, start, resetsAt, now time.Time) model.BudgetStatus {
+	status := model.BudgetStatus{
+		Model:     key,
+		Period:    period,
+		BudgetUSD: budget,
+		SpentUSD:  roundTo(spent, 4),
+		Percent:   roundTo(spent/budget*100, 1),
+		StartedAt: start.Format(time.RFC3339),
+		ResetsAt:  resetsAt.Format(time.RFC3339),
+		Exceeded:  spent >= budget,
+	}
+	if !status.Exceeded {
+		status.RemainingUSD = roundTo(budget-spent, 4)
+	}
+
+	elapsed := now.Sub(start)
+	if elapsed < time.Hour {
+		elapsed = time.Hour
+	}
+	perHour := spent / elapsed.Hours()
+	status.BurnRatePerHourUSD = roundTo(perHour, 4)
+	status.ForecastUSD = roundTo(spent+perHour*resetsAt.Sub(now).Hours(), 4)
+	if !status.Exceeded && perHour > 0 {
+		if at := now.Add(time.Duration((budget - spent) / perHour * float64(time.Hour))); at.Before(resetsAt) {
+			status.OverrunAt = at.Format(time.RFC3339)
+		}
+	}
+	return status
+}
+
+// BudgetReport sets out the budgets and the current burn rate
+func (r *ModelRouter) BudgetReport() model.BudgetReport {
+	return model.BudgetReport{
+		Budgets:  r.budget.Report(),
+		BurnRate: r.burn.windows(),
+	}
+}
+
+// applyBudget downgrades decision to a cheaper model, or blocks it, when the
+// overall budget's thresholds or the budget of its model say so
+func (r *ModelRouter) applyBudget(decision *RoutingDecision) error {
+	if err := r.applyOverallBudget(decision); err != nil {
+		return err
+	}
+	return r.applyModelBudget(decision)
+}
+
+// applyOverallBudget downgrades decision to a cheaper model, or blocks it,
+// when the budget thresholds say so. Overrides are only ever blocked: the
+// client asked for that model explicitly.
+func (r *ModelRouter) applyOverallBudget(decision *RoutingDecision) error {
+	threshold, used := r.budget.threshold()
+	if threshold == nil {
+		return nil
+	}
+	if threshold.block {
+		return &BudgetExceededError{Period: used.period, Budget: used.budget, Spent: used.spent}
+	}
+	if decision.Explanation.Reason == model.RouteReasonOverride {
+		return nil
+	}
+
+	target := threshold.target(decision.TargetModel)
+	if target == "" {
+		return nil
+	}
+	targetProvider := r.providers[r.getProviderNameForModel(target)]
+	if targetProvider == nil {
+		r.logger.Printf("⚠️  No provider found for budget downgrade model %s, keeping %s", target, decision.TargetModel)
+		return nil
+	}
+
+	r.logger.Printf("💸 %s budget %.0f%% used, downgrading \033[36m%s\033[0m → \033[32m%s\033[0m",
+		used.period, used.percent, decision.TargetModel, target)
+	decision.adjust("%s budget %.0f%% used ($%.2f of $%.2f), downgraded from %s to %s",
+		used.period, used.percent, used.spent, used.budget, decision.TargetModel, target)
+	decision.TargetModel = target
+	decision.Provider = targetProvider
+	return nil
+}
+
+// applyModelBudget sends decision to the downgrade model of its model's budget
+// once that is used up, or blocks it when there is none, it's over its own
+// budget, or the request is an override
+func (r *ModelRouter) applyModelBudget(decision *RoutingDecision) error {
+	used, budget, exceeded := r.budget.modelExceeded(decision.TargetModel)
+	if !exceeded {
+		return nil
+	}
+	blocked := &BudgetExceededError{Period: used.period, Budget: used.budget, Spent: used.spent, Model: budget.key}
+	if budget.downgrade == "" || decision.Explanation.Reason == model.RouteReasonOverride {
+		return blocked
+	}
+	if _, _, over := r.budget.modelExceeded(budget.downgrade); over {
+		return blocked
+	}
+	targetProvider := r.providers[r.getProviderNameForModel(budget.downgrade)]
+	if targetProvider == nil {
+		r.logger.Printf("⚠️  No provider found for budget downgrade model %s, blocking %s", budget.downgrade, decision.TargetModel)
+		return blocked
+	}
+
+	r.logger.Printf("💸 %s %s budget used up, downgrading \033[36m%s\033[0m → \033[32m%s\033[0m",
+		budget.key, used.period, decision.TargetModel, budget.downgrade)
+	decision.adjust("%s %s budget used up ($%.2f of $%.2f), downgraded from %s to %s",
+		budget.key, used.period, used.spent, used.budget, decision.TargetModel, budget.downgrade)
+	decision.TargetModel = budget.downgrade
+	decision.Provider = targetProvider
+	return nil
+}
+
+// RecordSpend counts what a completed request cost against the budget and
+// the burn rate, and what it used against the subscription's usage window.
+// The rate limits its response reported are kept whatever its status.
+func (r *ModelRouter) RecordSpend(request *model.RequestLog) {
+	r.rateLimits.record(request)
+	if request.Response == nil || request.Response.StatusCode >= 400 {
+		return
+	}
+	usage := responseUsage(request.Response)
+	if usage == nil {
+		return
+	}
+	cost, _ := r.budget.prices.Cost(request.RoutedModel, usage)
+	r.burn.record(usage, cost, request.Provider == usageWindowProvider)
+	if request.Provider == usageWindowProvider {
+		r.window.record(r.window.now(), request.RoutedModel, *usage)
+	}
+
+	if !r.budget.Record(request.RoutedModel, usage) {
+		r.logger.Printf("⚠️  No price known for %s, its requests don't count against the budget (add it under pricing)", request.RoutedModel)
+	}
+}
+
+// Prices returns the price table requests are costed with
+func (r *ModelRouter) Prices() *PriceTable {
+	return r.budget.prices
+}
+
+// Budget returns the router's budget tracker
+func (r *ModelRouter) Budget() *BudgetTracker {
+	return r.budget
+}
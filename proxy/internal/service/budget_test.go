@@ -0,0 +1,276 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func TestPriceTable_Cost(t *testing.T) {
+	prices := NewPriceTable(map[string]config.PriceConfig{
+		"my-finetune": {Input: 1, Output: 2},
+		"Sonnet":      {Input: 6, Output: 30},
+	})
+	usage := &model.AnthropicUsage{InputTokens: 1_000_000, OutputTokens: 100_000, CacheReadInputTokens: 1_000_000}
+
+	tests := []struct {
+		model    string
+		expected float64
+		known    bool
+	}{
+		{"claude-opus-4-20250514", 15 + 7.5 + 1.5, true},
+		{"claude-opus-4-5-20251101", 5 + 2.5 + 0.5, true},
+		{"claude-3-5-haiku-20241022", 0.8 + 0.4 + 0.08, true},
+		{"claude-sonnet-4-20250514", 6 + 3, true}, // overridden, no cache price
+		{"gpt-4o-mini", 0.15 + 0.06 + 0.075, true},
+		{"my-finetune-v2", 1 + 0.2, true},
+		{provider.OllamaModelPrefix + "qwen2.5-coder", 0, true},
+		{"mystery-model", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			cost, known := prices.Cost(tt.model, usage)
+			if known != tt.known {
+				t.Fatalf("known = %v, want %v", known, tt.known)
+			}
+			if math.Abs(cost-tt.expected) > 1e-9 {
+				t.Errorf("Cost() = %f, want %f", cost, tt.expected)
+			}
+		})
+	}
+}
+
+func TestModelRouter_Budget(t *testing.T) {
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+	}
+	// spend records opus output tokens worth the given amount
+	spend := func(router *ModelRouter, dollars float64) {
+		router.budget.Record("claude-opus-4-20250514", &model.AnthropicUsage{OutputTokens: int(dollars * 1e6 / 75)})
+	}
+
+	tests := []struct {
+		name          string
+		spent         float64
+		override      bool
+		requested     string
+		expectedModel string
+		expectBlock   bool
+	}{
+		{"Under the first threshold", 7, false, "claude-opus-4-20250514", "claude-opus-4-20250514", false},
+		{"Opus downgraded at 80%", 8.5, false, "claude-opus-4-20250514", "claude-sonnet-4-20250514", false},
+		{"Sonnet downgraded at 80%", 8.5, false, "claude-sonnet-4-20250514", "claude-3-5-haiku-20241022", false},
+		{"Haiku left alone", 8.5, false, "claude-3-5-haiku-20241022", "claude-3-5-haiku-20241022", false},
+		{"Overrides aren't downgraded", 8.5, true, "claude-opus-4-20250514", "claude-opus-4-20250514", false},
+		{"Blocked at 100%", 10.5, false, "claude-3-5-haiku-20241022", "", true},
+		{"Overrides are blocked too", 10.5, true, "claude-3-5-haiku-20241022", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Budget: config.BudgetConfig{Daily: 10}}
+			router := NewModelRouter(cfg, providers, log.New(io.Discard, "", 0))
+			spend(router, tt.spent)
+
+			req := &model.AnthropicRequest{
+				Model:    tt.requested,
+				Messages: []model.AnthropicMessage{{Role: "user", Content: "hello"}},
+			}
+			var decision *RoutingDecision
+			var err error
+			if tt.override {
+				decision, err = router.OverrideRoute(req, tt.requested, "")
+			} else {
+				decision, err = router.DetermineRoute(req)
+			}
+
+			var budgetErr *BudgetExceededError
+			if tt.expectBlock {
+				if !errors.As(err, &budgetErr) {
+					t.Fatalf("err = %v, want *BudgetExceededError", err)
+				}
+				if budgetErr.Period != BudgetDaily {
+					t.Errorf("Period = %q, want %q", budgetErr.Period, BudgetDaily)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("routing returned error: %v", err)
+			}
+			if decision.TargetModel != tt.expectedModel {
+				t.Errorf("TargetModel = %q, want %q", decision.TargetModel, tt.expectedModel)
+			}
+			downgraded := decision.TargetModel != tt.requested
+			if recorded := len(decision.Explanation.Adjustments) == 1 && strings.Contains(decision.Explanation.Adjustments[0], "daily budget"); recorded != downgraded {
+				t.Errorf("Adjustments = %v, want a budget downgrade recorded: %v", decision.Explanation.Adjustments, downgraded)
+			}
+		})
+	}
+}
+
+func TestBudgetTracker_Periods(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	if err := storage.SetPrices(NewPriceTable(nil)); err != nil {
+		t.Fatalf("SetPrices() returned error: %v", err)
+	}
+
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	body, _ := json.Marshal(map[string]interface{}{"usage": model.AnthropicUsage{OutputTokens: 100_000}}) // $7.50 on opus
+	for i, at := range []time.Time{now.Add(-time.Hour), now.AddDate(0, 0, -3), now.AddDate(0, -1, 0)} {
+		request := &model.RequestLog{
+			RequestID:   "req" + string(rune('a'+i)),
+			Timestamp:   at.Format(time.RFC3339),
+			Model:       "claude-sonnet-4-20250514",
+			RoutedModel: "claude-opus-4-20250514",
+			Response:    &model.ResponseLog{StatusCode: 200, Body: body},
+		}
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		if err := storage.UpdateRequestWithResponse(request); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+	}
+
+	budget := NewBudgetTracker(config.BudgetConfig{Daily: 10, Monthly: 100}, NewPriceTable(nil))
+	budget.now = func() time.Time { return now }
+	budget.day, budget.month = periodStarts(now)
+	if err := budget.Load(storage); err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+
+	// Priced by the routed model, last month's request left out
+	if math.Abs(budget.daySpent-7.5) > 1e-9 || math.Abs(budget.monthSpent-15) > 1e-9 {
+		t.Fatalf("spent = %.2f/day, %.2f/month, want 7.50 and 15.00", budget.daySpent, budget.monthSpent)
+	}
+	if used := budget.usage(); used.period != BudgetDaily || math.Abs(used.percent-75) > 1e-9 {
+		t.Errorf("usage() = %+v, want 75%% of the daily budget", used)
+	}
+
+	// A new day starts the daily budget over but keeps the month's spend
+	now = now.AddDate(0, 0, 1)
+	if used := budget.usage(); used.period != BudgetMonthly || math.Abs(used.percent-15) > 1e-9 {
+		t.Errorf("usage() after midnight = %+v, want 15%% of the monthly budget", used)
+	}
+}
+
+func TestModelRouter_ModelBudget(t *testing.T) {
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+	}
+	budgets := map[string]config.ModelBudgetConfig{
+		"opus":   {Daily: 10, Downgrade: "claude-sonnet-4-20250514"},
+		"sonnet": {Monthly: 5},
+		"haiku":  {Daily: 1},
+	}
+	// spend records output tokens worth the given amount at the model's
+	// output price per million
+	spend := func(router *ModelRouter, modelName string, price, dollars float64) {
+		router.budget.Record(modelName, &model.AnthropicUsage{OutputTokens: int(dollars * 1e6 / price)})
+	}
+
+	tests := []struct {
+		name          string
+		opusSpent     float64
+		sonnetSpent   float64
+		override      bool
+		requested     string
+		expectedModel string
+		expectBlock   string // key of the budget blocking the request
+	}{
+		{"Under the model budget", 9, 0, false, "claude-opus-4-20250514", "claude-opus-4-20250514", ""},
+		{"Downgraded once used up", 10.5, 0, false, "claude-opus-4-20250514", "claude-sonnet-4-20250514", ""},
+		{"Overrides are blocked", 10.5, 0, true, "claude-opus-4-20250514", "", "opus"},
+		{"Blocked when the downgrade is used up too", 10.5, 6, false, "claude-opus-4-20250514", "", "opus"},
+		{"Blocked without a downgrade", 0, 6, false, "claude-sonnet-4-20250514", "", "sonnet"},
+		{"Other budgets left alone", 10.5, 6, false, "claude-3-5-haiku-20241022", "claude-3-5-haiku-20241022", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Budget: config.BudgetConfig{Models: budgets}}
+			router := NewModelRouter(cfg, providers, log.New(io.Discard, "", 0))
+			spend(router, "claude-opus-4-20250514", 75, tt.opusSpent)
+			spend(router, "claude-sonnet-4-20250514", 15, tt.sonnetSpent)
+
+			req := &model.AnthropicRequest{
+				Model:    tt.requested,
+				Messages: []model.AnthropicMessage{{Role: "user", Content: "hello"}},
+			}
+			var decision *RoutingDecision
+			var err error
+			if tt.override {
+				decision, err = router.OverrideRoute(req, tt.requested, "")
+			} else {
+				decision, err = router.DetermineRoute(req)
+			}
+
+			var budgetErr *BudgetExceededError
+			if tt.expectBlock != "" {
+				if !errors.As(err, &budgetErr) {
+					t.Fatalf("err = %v, want *BudgetExceededError", err)
+				}
+				if budgetErr.Model != tt.expectBlock {
+					t.Errorf("Model = %q, want %q", budgetErr.Model, tt.expectBlock)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("routing returned error: %v", err)
+			}
+			if decision.TargetModel != tt.expectedModel {
+				t.Errorf("TargetModel = %q, want %q", decision.TargetModel, tt.expectedModel)
+			}
+		})
+	}
+}
+
+func TestBudgetTracker_Report(t *testing.T) {
+	budget := NewBudgetTracker(config.BudgetConfig{
+		Daily:  24,
+		Models: map[string]config.ModelBudgetConfig{"opus": {Monthly: 30}},
+	}, NewPriceTable(nil))
+	now := time.Date(2025, 6, 11, 6, 0, 0, 0, time.UTC)
+	budget.now = func() time.Time { return now }
+	budget.day, budget.month = periodStarts(now)
+	// $12 of opus output by 6am on the 11th: $2 an hour over the 6 hours of
+	// today, $12 over the 246 hours of the month
+	budget.Record("claude-opus-4-20250514", &model.AnthropicUsage{OutputTokens: 160_000})
+
+	expected := []model.BudgetStatus{
+		{
+			Period: BudgetDaily, BudgetUSD: 24, SpentUSD: 12, RemainingUSD: 12, Percent: 50,
+			StartedAt: "2025-06-11T00:00:00Z", ResetsAt: "2025-06-12T00:00:00Z",
+			BurnRatePerHourUSD: 2, ForecastUSD: 48, OverrunAt: "2025-06-11T12:00:00Z",
+		},
+		{
+			Model: "opus", Period: BudgetMonthly, BudgetUSD: 30, SpentUSD: 12, RemainingUSD: 18, Percent: 40,
+			StartedAt: "2025-06-01T00:00:00Z", ResetsAt: "2025-07-01T00:00:00Z",
+			BurnRatePerHourUSD: 0.0488, ForecastUSD: 35.122, OverrunAt: "2025-06-26T15:00:00Z",
+		},
+	}
+	if report := budget.Report(); !reflect.DeepEqual(report, expected) {
+		t.Errorf("Report() = %+v, want %+v", report, expected)
+	}
+
+	// Used up, it's exceeded with nothing left and no overrun to come
+	budget.Record("claude-opus-4-20250514", &model.AnthropicUsage{OutputTokens: 160_000})
+	if status := budget.Report()[0]; !status.Exceeded || status.RemainingUSD != 0 || status.OverrunAt != "" {
+		t.Errorf("Report()[0] = %+v, want exceeded", status)
+	}
+}
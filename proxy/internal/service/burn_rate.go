@@ -0,0 +1,173 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// burnRateWindows are the sliding windows rates are reported over
+var burnRateWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// burnProjectionWindow is the window whose rate projections use: long enough
+// to smooth over single large requests, short enough to follow a change of pace
+const burnProjectionWindow = 5 * time.Minute
+
+// Burn projection limits
+const (
+	BurnLimitDailyBudget         = "dailyBudget"
+	BurnLimitMonthlyBudget       = "monthlyBudget"
+	BurnLimitUsageWindowTokens   = "usageWindowTokens"
+	BurnLimitUsageWindowMessages = "usageWindowMessages"
+)
+
+type burnSample struct {
+	at     time.Time
+	tokens int64
+	output int64
+	cost   float64
+	// subscription is set for requests that count against the usage window
+	subscription bool
+}
+
+// burnRateMeter keeps the usage of the requests completed within the longest
+// window
+type burnRateMeter struct {
+	mu      sync.Mutex
+	samples []burnSample // oldest first
+	now     func() time.Time
+}
+
+func newBurnRateMeter() *burnRateMeter {
+	return &burnRateMeter{now: time.Now}
+}
+
+func (m *burnRateMeter) record(usage *model.AnthropicUsage, cost float64, subscription bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune()
+	m.samples = append(m.samples, burnSample{
+		at: m.now(),
+		tokens: int64(usage.InputTokens + usage.OutputTokens +
+			usage.CacheReadInputTokens + usage.CacheCreationInputTokens),
+		output:       int64(usage.OutputTokens),
+		cost:         cost,
+		subscription: subscription,
+	})
+}
+
+// prune drops samples older than the longest window; m.mu must be held
+func (m *burnRateMeter) prune() {
+	cutoff := m.now().Add(-burnRateWindows[len(burnRateWindows)-1])
+	i := 0
+	for i < len(m.samples) && !m.samples[i].at.After(cutoff) {
+		i++
+	}
+	m.samples = m.samples[i:]
+}
+
+func (m *burnRateMeter) windows() []model.BurnRateWindow {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune()
+	now := m.now()
+	windows := make([]model.BurnRateWindow, 0, len(burnRateWindows))
+	for _, window := range burnRateWindows {
+		rate := model.BurnRateWindow{Window: formatWindow(window)}
+		var output int64
+		var cost float64
+		for _, sample := range m.samples {
+			if !sample.at.After(now.Add(-window)) {
+				continue
+			}
+			rate.Requests++
+			rate.Tokens += sample.tokens
+			output += sample.output
+			cost += sample.cost
+		}
+		minutes := window.Minutes()
+		rate.TokensPerMinute = float64(rate.Tokens) / minutes
+		rate.OutputTokensPerMinute = float64(output) / minutes
+		rate.CostPerMinute = cost / minutes
+		windows = append(windows, rate)
+	}
+	return windows
+}
+
+// subscriptionRate is the tokens and requests per minute over window of the
+// requests that count against the usage window
+func (m *burnRateMeter) subscriptionRate(window time.Duration) (tokensPerMinute, requestsPerMinute float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune()
+	cutoff := m.now().Add(-window)
+	var tokens int64
+	var requests int
+	for _, sample := range m.samples {
+		if sample.subscription && sample.at.After(cutoff) {
+			tokens += sample.tokens
+			requests++
+		}
+	}
+	return float64(tokens) / window.Minutes(), float64(requests) / window.Minutes()
+}
+
+func formatWindow(d time.Duration) string {
+	return fmt.Sprintf("%dm", int(d.Minutes()))
+}
+
+// BurnRate reports the current rates and, for each budget and each limit of
+// the subscription's usage window, when it runs out if use continues at the
+// rate of the last few minutes
+func (r *ModelRouter) BurnRate() model.BurnRate {
+	burn := model.BurnRate{
+		Windows:     r.burn.windows(),
+		Projections: []model.BurnProjection{},
+	}
+
+	var costPerMinute float64
+	for _, window := range burn.Windows {
+		if window.Window == formatWindow(burnProjectionWindow) {
+			costPerMinute = window.CostPerMinute
+		}
+	}
+
+	now := r.burn.now()
+	project := func(limit string, remaining, perMinute float64, resetsAt time.Time) {
+		projection := model.BurnProjection{
+			Limit:     limit,
+			Window:    formatWindow(burnProjectionWindow),
+			Remaining: remaining,
+			ResetsAt:  resetsAt.Format(time.RFC3339),
+		}
+		if projection.Remaining < 0 {
+			projection.Remaining = 0
+		}
+		if perMinute > 0 {
+			exhausted := now.Add(time.Duration(projection.Remaining / perMinute * float64(time.Minute)))
+			if exhausted.Before(resetsAt) {
+				projection.ExhaustedAt = exhausted.Format(time.RFC3339)
+			}
+		}
+		burn.Projections = append(burn.Projections, projection)
+	}
+
+	for _, limit := range r.budget.limits() {
+		project(limit.name, limit.budget-limit.spent, costPerMinute, limit.resetsAt)
+	}
+
+	tokensPerMinute, requestsPerMinute := r.burn.subscriptionRate(burnProjectionWindow)
+	tokens, messages, resetsAt := r.window.used(now)
+	if r.window.tokenLimit > 0 {
+		project(BurnLimitUsageWindowTokens, float64(r.window.tokenLimit-tokens), tokensPerMinute, resetsAt)
+	}
+	if r.window.messageLimit > 0 {
+		project(BurnLimitUsageWindowMessages, float64(r.window.messageLimit-messages), requestsPerMinute, resetsAt)
+	}
+	return burn
+}
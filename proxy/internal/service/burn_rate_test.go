@@ -0,0 +1,129 @@
+package service
+
+import (
+	"io"
+	"log"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func TestModelRouter_BurnRate(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	cfg := &config.Config{Budget: config.BudgetConfig{Daily: 10, Monthly: 100000}}
+	router := NewModelRouter(cfg, map[string]provider.Provider{"anthropic": &stubProvider{name: "anthropic"}}, log.New(io.Discard, "", 0))
+	router.burn.now = clock
+	router.budget.now = clock
+	router.budget.day, router.budget.month = periodStarts(now)
+
+	// $0.75 of opus output each; the first is outside every window
+	record := func(ago time.Duration) {
+		at := now
+		now = now.Add(-ago)
+		router.RecordSpend(&model.RequestLog{
+			RoutedModel: "claude-opus-4-20250514",
+			Response:    &model.ResponseLog{StatusCode: 200, Body: []byte(`{"usage":{"input_tokens":0,"output_tokens":10000}}`)},
+		})
+		now = at
+	}
+	for _, ago := range []time.Duration{20 * time.Minute, 12 * time.Minute, 4 * time.Minute, 3 * time.Minute, 30 * time.Second} {
+		record(ago)
+	}
+
+	burn := router.BurnRate()
+	expected := map[string]struct {
+		requests      int
+		tokensPerMin  float64
+		costPerMinute float64
+	}{
+		"1m":  {1, 10000, 0.75},
+		"5m":  {3, 6000, 0.45},
+		"15m": {4, 40000.0 / 15, 3.0 / 15},
+	}
+	if len(burn.Windows) != len(expected) {
+		t.Fatalf("got %d windows, want %d", len(burn.Windows), len(expected))
+	}
+	for _, window := range burn.Windows {
+		want := expected[window.Window]
+		if window.Requests != want.requests || math.Abs(window.TokensPerMinute-want.tokensPerMin) > 1e-6 || math.Abs(window.CostPerMinute-want.costPerMinute) > 1e-9 {
+			t.Errorf("window %s = %+v, want %+v", window.Window, window, want)
+		}
+	}
+
+	// $3.75 of the daily $10 spent; $6.25 left at $0.45/min lasts ~13.9 minutes
+	if len(burn.Projections) != 2 {
+		t.Fatalf("got %d projections, want 2", len(burn.Projections))
+	}
+	daily := burn.Projections[0]
+	if daily.Limit != BurnLimitDailyBudget || math.Abs(daily.Remaining-6.25) > 1e-9 {
+		t.Errorf("daily projection = %+v, want $6.25 remaining", daily)
+	}
+	minutesLeft := daily.Remaining / 0.45
+	if want := now.Add(time.Duration(minutesLeft * float64(time.Minute))).Format(time.RFC3339); daily.ExhaustedAt != want {
+		t.Errorf("daily ExhaustedAt = %q, want %q", daily.ExhaustedAt, want)
+	}
+	// The monthly budget resets before it would run out at this pace
+	if monthly := burn.Projections[1]; monthly.ExhaustedAt != "" || monthly.ResetsAt != "2025-07-01T00:00:00Z" {
+		t.Errorf("monthly projection = %+v, want no exhaustion before the reset on July 1st", monthly)
+	}
+}
+
+func TestModelRouter_BurnRate_UsageWindow(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	cfg := &config.Config{UsageWindow: config.UsageWindowConfig{TokenLimit: 100000, MessageLimit: 20}}
+	router := NewModelRouter(cfg, map[string]provider.Provider{"anthropic": &stubProvider{name: "anthropic"}}, log.New(io.Discard, "", 0))
+	router.burn.now = clock
+	router.window.now = clock
+
+	// 10000 tokens each; the first opens the window but is outside the rate's
+	// five minutes, and the OpenAI request doesn't count against the window
+	record := func(ago time.Duration, providerName string) {
+		at := now
+		now = now.Add(-ago)
+		router.RecordSpend(&model.RequestLog{
+			RoutedModel: "claude-sonnet-4-20250514",
+			Provider:    providerName,
+			Response:    &model.ResponseLog{StatusCode: 200, Body: []byte(`{"usage":{"input_tokens":0,"output_tokens":10000}}`)},
+		})
+		now = at
+	}
+	record(10*time.Minute, "anthropic")
+	record(4*time.Minute, "anthropic")
+	record(2*time.Minute, "anthropic")
+	record(time.Minute, "openai")
+
+	burn := router.BurnRate()
+	resetsAt := now.Add(-10 * time.Minute).Add(5 * time.Hour).Format(time.RFC3339)
+	expected := []model.BurnProjection{
+		// 70000 tokens left at 20000 per five minutes
+		{Limit: BurnLimitUsageWindowTokens, Window: "5m", Remaining: 70000, ResetsAt: resetsAt,
+			ExhaustedAt: now.Add(17*time.Minute + 30*time.Second).Format(time.RFC3339)},
+		// 17 messages left at 2 per five minutes
+		{Limit: BurnLimitUsageWindowMessages, Window: "5m", Remaining: 17, ResetsAt: resetsAt,
+			ExhaustedAt: now.Add(42*time.Minute + 30*time.Second).Format(time.RFC3339)},
+	}
+	if len(burn.Projections) != len(expected) {
+		t.Fatalf("projections = %+v, want %+v", burn.Projections, expected)
+	}
+	for i, projection := range burn.Projections {
+		if projection != expected[i] {
+			t.Errorf("projection %d = %+v, want %+v", i, projection, expected[i])
+		}
+	}
+
+	// Once the window is over, a new one opens with the next request
+	now = now.Add(5 * time.Hour)
+	burn = router.BurnRate()
+	if tokens := burn.Projections[0]; tokens.Remaining != 100000 || tokens.ExhaustedAt != "" ||
+		tokens.ResetsAt != now.Add(5*time.Hour).Format(time.RFC3339) {
+		t.Errorf("projection without an open window = %+v, want the whole limit left", tokens)
+	}
+}
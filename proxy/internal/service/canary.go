@@ -0,0 +1,366 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// Routing canary defaults
+const (
+	defaultCanaryPercent              = 10
+	defaultCanaryMinRequests          = 20
+	defaultCanaryMaxErrorRateIncrease = 0.05
+	defaultCanaryMaxLatencyIncrease   = 0.5
+	defaultCanaryDuration             = 30 * time.Minute
+)
+
+// ErrNoCanary is returned when promoting or rolling back without a canary running
+var ErrNoCanary = errors.New("no routing canary is running")
+
+// canaryRules is a candidate rule set the router applies to part of traffic
+type canaryRules struct {
+	id      string
+	percent int
+	rules   []routingRule
+	stored  []model.RoutingRule
+}
+
+// assign buckets a session into an arm, so a conversation sees the same rules
+// for the whole canary
+func (c *canaryRules) assign(req *model.AnthropicRequest) string {
+	h := fnv.New32a()
+	h.Write([]byte(c.id + ":" + sessionKey(req)))
+	if int(h.Sum32()%100) < c.percent {
+		return model.CanaryArmCanary
+	}
+	return model.CanaryArmBaseline
+}
+
+// StartCanary applies stored to the share of traffic given by percent, leaving
+// the current rules in place for the rest. Subagent mappings can't be split
+// this way and apply to all traffic straight away.
+func (r *ModelRouter) StartCanary(id string, stored []model.RoutingRule, percent int) {
+	rules, mappings := r.compileStoredRules(stored)
+
+	r.rulesMu.Lock()
+	r.canary = &canaryRules{id: id, percent: percent, rules: rules, stored: stored}
+	r.rulesMu.Unlock()
+
+	r.setMappings(mappings)
+	r.configChanged()
+}
+
+// EndCanary stops splitting traffic, either applying the candidate rules to
+// all of it or dropping them
+func (r *ModelRouter) EndCanary(promote bool) {
+	r.rulesMu.Lock()
+	canary := r.canary
+	r.canary = nil
+	if canary != nil && promote {
+		r.rules = canary.rules
+		r.storedRules = canary.stored
+	}
+	r.rulesMu.Unlock()
+
+	if canary != nil {
+		r.configChanged()
+	}
+}
+
+// StoredRules returns the rules managed through the API that apply to all
+// traffic, i.e. not counting a canary
+func (r *ModelRouter) StoredRules() []model.RoutingRule {
+	r.rulesMu.RLock()
+	defer r.rulesMu.RUnlock()
+	return r.storedRules
+}
+
+// RoutingCanary rolls changes to the routing rules managed through the API out
+// gradually. A change first applies to a share of sessions; it is rolled back,
+// in the database too, if those sessions see more errors or slower responses
+// than the rest, and promoted to all traffic once it has run long enough
+// without regressing.
+type RoutingCanary struct {
+	cfg      config.CanaryConfig
+	duration time.Duration
+	storage  StorageService
+	router   *ModelRouter
+	logger   *log.Logger
+
+	mu          sync.Mutex
+	active      *canaryRollout
+	lastOutcome string
+}
+
+type canaryRollout struct {
+	id        string
+	started   time.Time
+	baseline  []model.RoutingRule // the stored rules before the change
+	candidate []model.RoutingRule
+	arms      map[string]*canaryArm
+}
+
+type canaryArm struct {
+	requests     int
+	errors       int
+	responseTime int64
+}
+
+func (a *canaryArm) errorRate() float64 {
+	if a.requests == 0 {
+		return 0
+	}
+	return float64(a.errors) / float64(a.requests)
+}
+
+func (a *canaryArm) avgResponseTime() int64 {
+	if a.requests == 0 {
+		return 0
+	}
+	return a.responseTime / int64(a.requests)
+}
+
+func (a *canaryArm) stat() model.CanaryArmStat {
+	return model.CanaryArmStat{
+		Requests:        a.requests,
+		Errors:          a.errors,
+		ErrorRate:       a.errorRate(),
+		AvgResponseTime: a.avgResponseTime(),
+	}
+}
+
+func NewRoutingCanary(cfg config.CanaryConfig, storage StorageService, router *ModelRouter, logger *log.Logger) *RoutingCanary {
+	if cfg.Percent <= 0 || cfg.Percent >= 100 {
+		if cfg.Enable && cfg.Percent != 0 {
+			logger.Printf("⚠️  Canary percent %d is out of range (1-99), using %d", cfg.Percent, defaultCanaryPercent)
+		}
+		cfg.Percent = defaultCanaryPercent
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = defaultCanaryMinRequests
+	}
+	if cfg.MaxErrorRateIncrease <= 0 {
+		cfg.MaxErrorRateIncrease = defaultCanaryMaxErrorRateIncrease
+	}
+	if cfg.MaxLatencyIncrease <= 0 {
+		cfg.MaxLatencyIncrease = defaultCanaryMaxLatencyIncrease
+	}
+	duration, err := time.ParseDuration(cfg.Duration)
+	if err != nil || duration <= 0 {
+		if cfg.Duration != "" {
+			logger.Printf("⚠️  Invalid canary duration %q, using %s", cfg.Duration, defaultCanaryDuration)
+		}
+		duration = defaultCanaryDuration
+	}
+
+	return &RoutingCanary{
+		cfg:      cfg,
+		duration: duration,
+		storage:  storage,
+		router:   router,
+		logger:   logger,
+	}
+}
+
+// Apply puts a new set of stored rules into effect: straight away when canaries
+// are off or the change doesn't touch content rules, otherwise as a canary. A
+// change made while a canary is running replaces its candidate and restarts
+// the comparison against the same baseline.
+func (c *RoutingCanary) Apply(stored []model.RoutingRule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	baseline := c.router.StoredRules()
+	if c.active != nil {
+		baseline = c.active.baseline
+	}
+
+	if !c.cfg.Enable || sameContentRules(baseline, stored) {
+		if c.active != nil {
+			c.active = nil
+			c.lastOutcome = "replaced by a change that needs no canary"
+		}
+		c.router.SetStoredRules(stored)
+		return
+	}
+
+	now := time.Now()
+	c.active = &canaryRollout{
+		id:        strconv.FormatInt(now.UnixNano(), 36),
+		started:   now,
+		baseline:  baseline,
+		candidate: stored,
+		arms: map[string]*canaryArm{
+			model.CanaryArmBaseline: {},
+			model.CanaryArmCanary:   {},
+		},
+	}
+	c.router.StartCanary(c.active.id, stored, c.cfg.Percent)
+	c.logger.Printf("🐤 Routing change canaried on %d%% of sessions", c.cfg.Percent)
+}
+
+// Record counts the outcome of a request routed while a canary was running,
+// and promotes or rolls back the canary when the numbers say so
+func (c *RoutingCanary) Record(request *model.RequestLog) {
+	if request.Routing == nil || request.Routing.Canary == "" || request.Response == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.active == nil {
+		return
+	}
+	arm := c.active.arms[request.Routing.Canary]
+	if arm == nil {
+		return
+	}
+	arm.requests++
+	if request.Response.StatusCode >= 500 || request.Response.StatusCode == 429 {
+		arm.errors++
+	}
+	arm.responseTime += request.Response.ResponseTime
+
+	c.evaluate()
+}
+
+// evaluate compares the arms; c.mu must be held
+func (c *RoutingCanary) evaluate() {
+	baseline := c.active.arms[model.CanaryArmBaseline]
+	canary := c.active.arms[model.CanaryArmCanary]
+	if canary.requests < c.cfg.MinRequests {
+		return
+	}
+
+	if baseline.requests >= c.cfg.MinRequests {
+		if canary.errorRate()-baseline.errorRate() > c.cfg.MaxErrorRateIncrease {
+			c.rollback(fmt.Sprintf("error rate %.1f%% vs %.1f%%", canary.errorRate()*100, baseline.errorRate()*100))
+			return
+		}
+		if float64(canary.avgResponseTime()) > float64(baseline.avgResponseTime())*(1+c.cfg.MaxLatencyIncrease) {
+			c.rollback(fmt.Sprintf("average response time %dms vs %dms", canary.avgResponseTime(), baseline.avgResponseTime()))
+			return
+		}
+	}
+
+	if time.Since(c.active.started) >= c.duration {
+		c.promote("ran without regressing")
+	}
+}
+
+// Promote applies the canaried change to all traffic now
+func (c *RoutingCanary) Promote() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.active == nil {
+		return ErrNoCanary
+	}
+	c.promote("promoted manually")
+	return nil
+}
+
+// Rollback drops the canaried change and restores the rules it replaced
+func (c *RoutingCanary) Rollback() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.active == nil {
+		return ErrNoCanary
+	}
+	return c.rollback("rolled back manually")
+}
+
+func (c *RoutingCanary) promote(reason string) {
+	c.router.EndCanary(true)
+	c.active = nil
+	c.lastOutcome = "promoted: " + reason
+	c.logger.Printf("🐤 Routing canary promoted to all traffic (%s)", reason)
+}
+
+func (c *RoutingCanary) rollback(reason string) error {
+	baseline := c.active.baseline
+	c.router.EndCanary(false)
+	c.active = nil
+	c.lastOutcome = "rolled back: " + reason
+	c.logger.Printf("🐤 Routing canary rolled back (%s)", reason)
+
+	// The change was already saved; put the previous rules back so the
+	// database matches what is being routed
+	if err := c.restore(baseline); err != nil {
+		c.logger.Printf("❌ Error restoring routing rules after canary rollback: %v", err)
+		return err
+	}
+	c.router.SetStoredRules(baseline)
+	return nil
+}
+
+func (c *RoutingCanary) restore(rules []model.RoutingRule) error {
+	current, err := c.storage.GetRoutingRules()
+	if err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		keep[rule.ID] = true
+	}
+	for _, rule := range current {
+		if !keep[rule.ID] {
+			if _, err := c.storage.DeleteRoutingRule(rule.ID); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range rules {
+		rule := rules[i]
+		if err := c.storage.SaveRoutingRule(&rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Status reports the running canary, if any
+func (c *RoutingCanary) Status() model.CanaryStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := model.CanaryStatus{Percent: c.cfg.Percent, LastOutcome: c.lastOutcome}
+	if c.active == nil {
+		return status
+	}
+	status.Active = true
+	status.StartedAt = c.active.started.Format(time.RFC3339)
+	status.PromoteAt = c.active.started.Add(c.duration).Format(time.RFC3339)
+	status.Baseline = c.active.arms[model.CanaryArmBaseline].stat()
+	status.Canary = c.active.arms[model.CanaryArmCanary].stat()
+	status.Rules = c.active.candidate
+	return status
+}
+
+// sameContentRules reports whether two stored rule sets route content the same
+// way, ignoring subagent mappings, disabled rules and timestamps
+func sameContentRules(a, b []model.RoutingRule) bool {
+	return reflect.DeepEqual(contentRules(a), contentRules(b))
+}
+
+func contentRules(stored []model.RoutingRule) []model.RoutingRule {
+	var rules []model.RoutingRule
+	for _, rule := range stored {
+		if !rule.Enabled || rule.Subagent != "" {
+			continue
+		}
+		rule.CreatedAt, rule.UpdatedAt = "", ""
+		rules = append(rules, rule)
+	}
+	return rules
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func TestRoutingCanary(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	logger := log.New(io.Discard, "", 0)
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+		"openai":    &stubProvider{name: "openai"},
+	}
+	router := NewModelRouter(&config.Config{}, providers, logger)
+	canary := NewRoutingCanary(config.CanaryConfig{Enable: true, Percent: 50, MinRequests: 3, Duration: "1h"}, storage, router, logger)
+
+	rule := model.RoutingRule{ID: "tests", Name: "tests", Keywords: []string{"unit test"}, TargetModel: "gpt-4o-mini", Enabled: true}
+	saveAndApply := func() {
+		if err := storage.SaveRoutingRule(&rule); err != nil {
+			t.Fatalf("SaveRoutingRule() returned error: %v", err)
+		}
+		stored, _ := storage.GetRoutingRules()
+		canary.Apply(stored)
+	}
+
+	// route sends one request for session and feeds the canary the status the
+	// arm it was assigned to answers with
+	ok := func(string) int { return 200 }
+	route := func(session int, status func(arm string) int) string {
+		req := &model.AnthropicRequest{
+			Model:    "claude-sonnet-4",
+			Metadata: &model.RequestMetadata{UserID: fmt.Sprintf("user_session_%d", session)},
+			Messages: []model.AnthropicMessage{{Role: "user", Content: "write a unit test " + strings.Repeat("please ", 50)}},
+		}
+		decision, err := router.DetermineRoute(req)
+		if err != nil {
+			t.Fatalf("DetermineRoute() returned error: %v", err)
+		}
+		arm := decision.Explanation.Canary
+		if (arm == model.CanaryArmCanary) != (decision.TargetModel == "gpt-4o-mini") {
+			t.Fatalf("arm %q routed to %s", arm, decision.TargetModel)
+		}
+		canary.Record(&model.RequestLog{
+			Routing:  &decision.Explanation,
+			Response: &model.ResponseLog{StatusCode: status(arm), ResponseTime: 1000},
+		})
+		return arm
+	}
+
+	t.Run("Regression rolls back", func(t *testing.T) {
+		saveAndApply()
+		if !canary.Status().Active || len(router.StoredRules()) != 0 {
+			t.Fatal("expected the new rule to be canaried, not applied to all traffic")
+		}
+
+		// The canaried rule sends its sessions to a failing model
+		failing := func(arm string) int {
+			if arm == model.CanaryArmCanary {
+				return 529
+			}
+			return 200
+		}
+		for session := 0; canary.Status().Active && session < 200; session++ {
+			route(session, failing)
+		}
+
+		status := canary.Status()
+		if status.Active || !strings.HasPrefix(status.LastOutcome, "rolled back: error rate") {
+			t.Fatalf("expected the canary to be rolled back for its error rate, got %+v", status)
+		}
+		if stored, _ := storage.GetRoutingRules(); len(stored) != 0 {
+			t.Errorf("rollback should remove the rule from the database, got %+v", stored)
+		}
+		if route(0, ok) != "" {
+			t.Error("requests after a rollback shouldn't be assigned to an arm")
+		}
+	})
+
+	t.Run("Healthy canary is promoted", func(t *testing.T) {
+		saveAndApply()
+		canary.mu.Lock()
+		canary.active.started = time.Now().Add(-2 * time.Hour)
+		canary.mu.Unlock()
+
+		for session := 0; canary.Status().Active && session < 200; session++ {
+			route(session, ok)
+		}
+
+		status := canary.Status()
+		if status.Active || !strings.HasPrefix(status.LastOutcome, "promoted") {
+			t.Fatalf("expected the canary to be promoted, got %+v", status)
+		}
+		if len(router.StoredRules()) != 1 {
+			t.Errorf("expected the rule to apply to all traffic, got %+v", router.StoredRules())
+		}
+		if err := canary.Rollback(); err != ErrNoCanary {
+			t.Errorf("Rollback() without a canary = %v, want ErrNoCanary", err)
+		}
+	})
+
+	t.Run("Changes without content rules skip the canary", func(t *testing.T) {
+		mapping := model.RoutingRule{ID: "reviewer", Name: "reviewer", Subagent: "reviewer", TargetModel: "gpt-4o", Enabled: true}
+		stored := append(router.StoredRules(), mapping)
+		canary.Apply(stored)
+		if canary.Status().Active || len(router.StoredRules()) != 2 {
+			t.Errorf("a subagent mapping change should apply straight away")
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// ConfigSnapshots records a snapshot of the effective routing configuration
+// whenever it changes, so each request can be tied to the configuration it was
+// routed under. Snapshots are numbered by generation; an unchanged
+// configuration keeps its generation across restarts.
+type ConfigSnapshots struct {
+	storage StorageService
+	router  *ModelRouter
+	logger  *log.Logger
+
+	mu         sync.Mutex // serializes Record
+	hash       string
+	generation atomic.Int64
+}
+
+// NewConfigSnapshots picks up the latest generation from storage
+func NewConfigSnapshots(storage StorageService, router *ModelRouter, logger *log.Logger) (*ConfigSnapshots, error) {
+	s := &ConfigSnapshots{storage: storage, router: router, logger: logger}
+
+	latest, err := storage.GetConfigSnapshot(0)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil {
+		s.hash = latest.Hash
+		s.generation.Store(latest.Generation)
+	}
+	return s, nil
+}
+
+// Generation is the current config generation, 0 until one has been recorded
+func (s *ConfigSnapshots) Generation() int64 {
+	return s.generation.Load()
+}
+
+// Record snapshots the router's configuration and stores it as a new
+// generation if it differs from the current one
+func (s *ConfigSnapshots) Record() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg := s.router.EffectiveConfig()
+	// Maps are marshaled with sorted keys, so equal configs hash the same
+	configJSON, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config snapshot: %w", err)
+	}
+	sum := sha256.Sum256(configJSON)
+	hash := hex.EncodeToString(sum[:])
+	if hash == s.hash {
+		return nil
+	}
+
+	snapshot := &model.ConfigSnapshot{Hash: hash, Config: cfg}
+	if err := s.storage.SaveConfigSnapshot(snapshot); err != nil {
+		return err
+	}
+	s.hash = hash
+	s.generation.Store(snapshot.Generation)
+	s.logger.Printf("🗂️  Config generation %d recorded", snapshot.Generation)
+	return nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func TestConfigSnapshots(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	logger := log.New(io.Discard, "", 0)
+
+	cfg := &config.Config{
+		Routing: config.RoutingConfig{
+			Rules: []config.RoutingRuleConfig{{Name: "tests", Keywords: []string{"unit test"}, TargetModel: "gpt-4o-mini"}},
+		},
+	}
+	router := NewModelRouter(cfg, map[string]provider.Provider{"openai": &stubProvider{name: "openai"}}, logger)
+
+	snapshots, err := NewConfigSnapshots(storage, router, logger)
+	if err != nil {
+		t.Fatalf("NewConfigSnapshots() returned error: %v", err)
+	}
+	router.OnConfigChange(func() {
+		if err := snapshots.Record(); err != nil {
+			t.Errorf("Record() returned error: %v", err)
+		}
+	})
+
+	if snapshots.Generation() != 0 {
+		t.Fatalf("expected no generation before the first snapshot, got %d", snapshots.Generation())
+	}
+	snapshots.Record()
+	snapshots.Record()
+	if snapshots.Generation() != 1 {
+		t.Fatalf("an unchanged config should keep generation 1, got %d", snapshots.Generation())
+	}
+
+	rule := model.RoutingRule{ID: "docs", Name: "docs", Keywords: []string{"readme"}, TargetModel: "gpt-4o", Enabled: true, UpdatedAt: "2025-03-04T10:00:00Z"}
+	router.SetStoredRules([]model.RoutingRule{rule})
+	if snapshots.Generation() != 2 {
+		t.Fatalf("adding a rule should record generation 2, got %d", snapshots.Generation())
+	}
+
+	// Saving the rule again only touches its timestamp
+	rule.UpdatedAt = "2025-03-04T11:00:00Z"
+	router.SetStoredRules([]model.RoutingRule{rule})
+	if snapshots.Generation() != 2 {
+		t.Errorf("a timestamp change shouldn't record a generation, got %d", snapshots.Generation())
+	}
+
+	first, err := storage.GetConfigSnapshot(1)
+	if err != nil || first == nil {
+		t.Fatalf("GetConfigSnapshot(1) = %v, %v", first, err)
+	}
+	if len(first.Config.Rules) != 1 || first.Config.Rules[0].Name != "tests" {
+		t.Errorf("generation 1 should only have the config rule, got %+v", first.Config.Rules)
+	}
+	if missing, err := storage.GetConfigSnapshot(99); err != nil || missing != nil {
+		t.Errorf("GetConfigSnapshot(99) = %v, %v, want nil", missing, err)
+	}
+
+	// A restart with the same config carries on with the same generation
+	restarted, err := NewConfigSnapshots(storage, router, logger)
+	if err != nil {
+		t.Fatalf("NewConfigSnapshots() returned error: %v", err)
+	}
+	restarted.Record()
+	if restarted.Generation() != 2 {
+		t.Errorf("expected generation 2 after a restart, got %d", restarted.Generation())
+	}
+
+	request := &model.RequestLog{RequestID: "r1", Method: "POST", Endpoint: "/v1/messages", Body: map[string]string{}, ConfigGeneration: 2}
+	if _, err := storage.SaveRequest(request); err != nil {
+		t.Fatalf("SaveRequest() returned error: %v", err)
+	}
+	saved, _, err := storage.GetRequestByShortID("r1")
+	if err != nil || saved.ConfigGeneration != 2 {
+		t.Errorf("config generation not stored on the request: %+v, %v", saved, err)
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+// What to do with a request that doesn't fit a local model's context window
+const (
+	OverflowReject   = "reject"
+	OverflowTrim     = "trim"
+	OverflowFallback = "fallback"
+
+	// minOutputTokens is the least room for a reply worth sending the request for
+	minOutputTokens = 256
+)
+
+// ContextOverflowError is returned when a request is too large for the target
+// model's context window and the provider's overflow policy is to reject it
+type ContextOverflowError struct {
+	Provider  string
+	Estimated int
+	Limit     int
+}
+
+// Error mirrors Anthropic's wording so clients such as Claude Code recognise it
+// and compact the conversation
+func (e *ContextOverflowError) Error() string {
+	return fmt.Sprintf("prompt is too long: %d tokens > %d maximum", e.Estimated, e.Limit)
+}
+
+// contextPolicy is the overflow handling configured for a local provider
+type contextPolicy struct {
+	overflow      string
+	fallbackModel string
+}
+
+func newContextPolicy(cfg config.LocalProviderConfig) contextPolicy {
+	policy := contextPolicy{overflow: cfg.Overflow, fallbackModel: cfg.FallbackModel}
+	switch policy.overflow {
+	case OverflowTrim, OverflowFallback:
+	default:
+		policy.overflow = OverflowReject
+	}
+	return policy
+}
+
+// applyContextLimit makes sure req fits the context window of the provider it
+// is routed to. Depending on policy it trims the oldest turns (modifying req),
+// reroutes to a fallback model, or returns a *ContextOverflowError.
+func (r *ModelRouter) applyContextLimit(req *model.AnthropicRequest, decision *RoutingDecision) error {
+	limiter, ok := decision.Provider.(provider.ContextLimiter)
+	if !ok {
+		return nil
+	}
+	limit := limiter.ContextWindow(decision.TargetModel)
+	if limit <= 0 {
+		return nil
+	}
+
+	estimated := estimateTokens(req)
+	if estimated+minOutputTokens <= limit {
+		decision.RequestModified = clampMaxTokens(req, limit-estimated) || decision.RequestModified
+		return nil
+	}
+
+	providerName := decision.Provider.Name()
+	policy := r.contextPolicies[providerName]
+
+	switch policy.overflow {
+	case OverflowTrim:
+		if dropped := trimToContext(req, limit); dropped > 0 {
+			r.logger.Printf("✂️  Trimmed %d oldest message(s) to fit %s context (%d tokens)", dropped, providerName, limit)
+			decision.RequestModified = true
+			decision.adjust("trimmed %d oldest message(s) to fit the %s context window (%d tokens)", dropped, providerName, limit)
+			return nil
+		}
+
+	case OverflowFallback:
+		fallbackModel := policy.fallbackModel
+		if fallbackModel == "" {
+			fallbackModel = decision.OriginalModel
+		}
+		fallbackProvider := r.providers[r.getProviderNameForModel(fallbackModel)]
+		if fallbackProvider != nil && fallbackProvider.Name() != providerName {
+			r.logger.Printf("⚠️  ~%d tokens exceeds %s context (%d), falling back \033[36m%s\033[0m → \033[32m%s\033[0m",
+				estimated, providerName, limit, decision.TargetModel, fallbackModel)
+			decision.adjust("~%d tokens exceeds the %s context window (%d), fell back from %s to %s",
+				estimated, providerName, limit, decision.TargetModel, fallbackModel)
+			decision.TargetModel = fallbackModel
+			decision.Provider = fallbackProvider
+			return nil
+		}
+	}
+
+	return &ContextOverflowError{Provider: providerName, Estimated: estimated, Limit: limit}
+}
+
+// clampMaxTokens lowers max_tokens so prompt and reply fit together
+func clampMaxTokens(req *model.AnthropicRequest, available int) bool {
+	if req.MaxTokens <= available {
+		return false
+	}
+	req.MaxTokens = available
+	return true
+}
+
+// trimToContext drops the oldest turns until the request fits limit, always
+// cutting at a user message that starts a turn so tool_use/tool_result pairs
+// stay together. It returns how many messages were dropped, or 0 if even the
+// final turn alone is too large.
+func trimToContext(req *model.AnthropicRequest, limit int) int {
+	original := req.Messages
+	messages := original
+
+	for {
+		next := -1
+		for i := 1; i < len(messages); i++ {
+			if messages[i].Role == "user" && !hasToolResult(&messages[i]) {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			req.Messages = original
+			return 0
+		}
+
+		messages = messages[next:]
+		req.Messages = messages
+		estimated := estimateTokens(req)
+		if estimated+minOutputTokens <= limit {
+			clampMaxTokens(req, limit-estimated)
+			return len(original) - len(messages)
+		}
+	}
+}
+
+func hasToolResult(msg *model.AnthropicMessage) bool {
+	blocks, ok := msg.Content.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, item := range blocks {
+		if block, ok := item.(map[string]interface{}); ok && block["type"] == "tool_result" {
+			return true
+		}
+	}
+	return false
+}
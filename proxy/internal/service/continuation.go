@@ -0,0 +1,79 @@
+package service
+
+import (
+	"encoding/json"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// defaultContinuationMaxTokens caps the doubled max_tokens of a continuation
+// when none is configured
+const defaultContinuationMaxTokens = 32000
+
+// truncatedToolCall reports whether a response stopped at max_tokens while
+// the model was writing a tool call
+func truncatedToolCall(responseBody []byte) bool {
+	var response struct {
+		StopReason string `json:"stop_reason"`
+		Content    []struct {
+			Type string `json:"type"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return false
+	}
+	if response.StopReason != "max_tokens" || len(response.Content) == 0 {
+		return false
+	}
+	last := response.Content[len(response.Content)-1].Type
+	return last == "tool_use" || last == "server_tool_use"
+}
+
+// Continuation decides whether a non-streaming response truncated in the
+// middle of a tool call is re-issued. It returns the request to send, with a
+// larger max_tokens, and its route, or false when the response is left as is.
+func (r *ModelRouter) Continuation(req *model.AnthropicRequest, decision *RoutingDecision, responseBody []byte) (*model.AnthropicRequest, *RoutingDecision, bool) {
+	cfg := r.config.Routing.Continuation
+	if !cfg.Enable || req.Stream || !truncatedToolCall(responseBody) {
+		return nil, nil, false
+	}
+
+	maxTokens := cfg.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 2 * req.MaxTokens
+		if maxTokens > defaultContinuationMaxTokens {
+			maxTokens = defaultContinuationMaxTokens
+		}
+	}
+	if maxTokens <= req.MaxTokens {
+		r.logger.Printf("⚠️  Response was cut off in a tool call at max_tokens %d, but continuation max_tokens is %d; not retrying", req.MaxTokens, maxTokens)
+		return nil, nil, false
+	}
+
+	continuation := *decision
+	continuation.Explanation.Adjustments = append([]string(nil), decision.Explanation.Adjustments...)
+	continuation.RequestModified = true
+	if cfg.Model != "" && cfg.Model != decision.TargetModel {
+		p := r.providers[r.getProviderNameForModel(cfg.Model)]
+		if p == nil {
+			r.logger.Printf("⚠️  No provider for continuation model %s; not retrying", cfg.Model)
+			return nil, nil, false
+		}
+		continuation.TargetModel = cfg.Model
+		continuation.Provider = p
+	}
+	if err := r.applyModelAccess(&continuation); err != nil {
+		r.logger.Printf("⚠️  Not retrying truncated response: %v", err)
+		return nil, nil, false
+	}
+	continuation.adjust("re-issued on %s with max_tokens %d after the response was cut off in a tool call at max_tokens %d",
+		continuation.TargetModel, maxTokens, req.MaxTokens)
+	continuation.Explanation.Provider = continuation.Provider.Name()
+	r.logger.Printf("✂️  Response cut off in a tool call, re-issuing \033[36m%s\033[0m → \033[32m%s\033[0m with max_tokens %d",
+		decision.TargetModel, continuation.TargetModel, maxTokens)
+
+	retry := *req
+	retry.Model = continuation.TargetModel
+	retry.MaxTokens = maxTokens
+	return &retry, &continuation, true
+}
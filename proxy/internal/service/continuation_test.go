@@ -0,0 +1,95 @@
+package service
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func TestTruncatedToolCall(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected bool
+	}{
+		{"Cut off in a tool call", `{"stop_reason":"max_tokens","content":[{"type":"text"},{"type":"tool_use"}]}`, true},
+		{"Cut off in a server tool call", `{"stop_reason":"max_tokens","content":[{"type":"server_tool_use"}]}`, true},
+		{"Cut off in text", `{"stop_reason":"max_tokens","content":[{"type":"tool_use"},{"type":"text"}]}`, false},
+		{"Finished tool call", `{"stop_reason":"tool_use","content":[{"type":"tool_use"}]}`, false},
+		{"No content", `{"stop_reason":"max_tokens","content":[]}`, false},
+		{"Not JSON", `upstream error`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncatedToolCall([]byte(tt.body)); got != tt.expected {
+				t.Errorf("truncatedToolCall() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestModelRouter_Continuation(t *testing.T) {
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+		"openai":    &stubProvider{name: "openai"},
+	}
+	truncated := []byte(`{"stop_reason":"max_tokens","content":[{"type":"tool_use"}]}`)
+
+	tests := []struct {
+		name              string
+		cfg               config.ContinuationConfig
+		stream            bool
+		maxTokens         int
+		body              []byte
+		expectRetry       bool
+		expectedModel     string
+		expectedProvider  string
+		expectedMaxTokens int
+	}{
+		{"Doubles max_tokens", config.ContinuationConfig{Enable: true}, false, 4096, truncated, true, "claude-sonnet-4-20250514", "anthropic", 8192},
+		{"Default cap", config.ContinuationConfig{Enable: true}, false, 20000, truncated, true, "claude-sonnet-4-20250514", "anthropic", 32000},
+		{"Cheaper model", config.ContinuationConfig{Enable: true, Model: "gpt-4o-mini", MaxTokens: 16000}, false, 4096, truncated, true, "gpt-4o-mini", "openai", 16000},
+		{"Disabled", config.ContinuationConfig{}, false, 4096, truncated, false, "", "", 0},
+		{"Streaming", config.ContinuationConfig{Enable: true}, true, 4096, truncated, false, "", "", 0},
+		{"Not truncated", config.ContinuationConfig{Enable: true}, false, 4096, []byte(`{"stop_reason":"end_turn","content":[{"type":"text"}]}`), false, "", "", 0},
+		{"No larger budget", config.ContinuationConfig{Enable: true, MaxTokens: 4096}, false, 4096, truncated, false, "", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewModelRouter(&config.Config{Routing: config.RoutingConfig{Continuation: tt.cfg}}, providers, log.New(io.Discard, "", 0))
+			req := &model.AnthropicRequest{
+				Model:     "claude-sonnet-4-20250514",
+				MaxTokens: tt.maxTokens,
+				Stream:    tt.stream,
+				Messages:  []model.AnthropicMessage{{Role: "user", Content: "write the file"}},
+			}
+			decision, err := router.DetermineRoute(req)
+			if err != nil {
+				t.Fatalf("DetermineRoute() returned error: %v", err)
+			}
+
+			retry, route, ok := router.Continuation(req, decision, tt.body)
+			if ok != tt.expectRetry {
+				t.Fatalf("Continuation() = %v, want %v", ok, tt.expectRetry)
+			}
+			if !ok {
+				return
+			}
+			if retry.Model != tt.expectedModel || retry.MaxTokens != tt.expectedMaxTokens {
+				t.Errorf("retry asks %s for %d tokens, want %s for %d", retry.Model, retry.MaxTokens, tt.expectedModel, tt.expectedMaxTokens)
+			}
+			if route.TargetModel != tt.expectedModel || route.Provider.Name() != tt.expectedProvider {
+				t.Errorf("retry routed to %s on %s, want %s on %s", route.TargetModel, route.Provider.Name(), tt.expectedModel, tt.expectedProvider)
+			}
+			if req.MaxTokens != tt.maxTokens || len(decision.Explanation.Adjustments) == len(route.Explanation.Adjustments) {
+				t.Error("Continuation() changed the original request or decision")
+			}
+		})
+	}
+}
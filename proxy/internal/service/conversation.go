@@ -9,6 +9,8 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
 )
 
 type ConversationService interface {
@@ -53,6 +55,8 @@ type Conversation struct {
 	EndTime      time.Time              `json:"endTime"`
 	MessageCount int                    `json:"messageCount"`
 	FileModTime  time.Time              `json:"-"` // Used for sorting, not exported
+	// Report is the conversation's stored analysis, if it was analyzed
+	Report *model.ConversationReport `json:"report,omitempty"`
 }
 
 // GetConversations returns all conversations organized by project
@@ -0,0 +1,403 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// What a conversation report flags: the same tool call made loopCalls times
+// is a loop, and a tool result over largeToolResultChars takes up context
+// for little
+const (
+	loopCalls            = 3
+	largeToolResultChars = 25000
+)
+
+// How much of a conversation a report keeps: the start of each prompt and of
+// a looping call's input, and the latest prompts shown to the grading model
+const (
+	maxReportPromptChars = 300
+	maxReportInputChars  = 200
+	maxReportTurnsShown  = 50
+)
+
+// Why a tool was used badly
+const (
+	misuseNotOffered  = "called though it wasn't among the tools offered"
+	misuseShellReads  = "read or searched files through the shell where Read, Grep or Glob would do"
+	misuseMostlyFails = "failed in most of its calls"
+)
+
+var (
+	ErrUnknownConversation = errors.New("no requests stored for the conversation")
+	errUnreadableReport    = errors.New("grading model didn't answer with a summary")
+)
+
+// shellReadCommand matches shell commands that only read or search files
+var shellReadCommand = regexp.MustCompile(`^\s*(cat|head|tail|less|grep|rg|find|ls)\b`)
+
+// conversationReportPrompt is the instructions for summarizing a conversation
+const conversationReportPrompt = `You review how a developer worked with an AI coding assistant over a whole session, so they learn to use it better. You're given the prompts the developer typed, in order and with their grades where they were graded, and measurements of the session: the context it sent and how much of it was sent again without a cache hit, sent in requests that failed, or taken up by large tool results; the tools called and how often they failed; calls repeated with the same input; and tools used badly.
+
+Summarize in a few sentences how the session went: whether the prompts got better or worse over the turns, where context was wasted, whether the assistant went in loops, and how it used its tools. Then recommend at most five concrete things to do differently.
+
+Answer with only JSON, no prose around it:
+{"summary": "...", "recommendations": ["...", "..."]}`
+
+// AnalyzeConversation reports on a whole conversation from the requests
+// storage has for it, has the grading model summarize the report with the
+// credentials in header, and stores the report with the conversation. A
+// report the grading model couldn't summarize is stored with why.
+func (g *PromptGrader) AnalyzeConversation(ctx context.Context, storage StorageService, sessionID string, header http.Header) (*model.ConversationReport, error) {
+	requests, err := storage.GetAllRequests(RequestFilter{SessionID: sessionID})
+	if err != nil {
+		return nil, err
+	}
+	report := analyzeConversation(sessionID, requests)
+	if report == nil {
+		return nil, ErrUnknownConversation
+	}
+
+	if g.provider == nil {
+		report.Error = ErrNoGradingModel.Error()
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, gradingTimeout)
+		defer cancel()
+		report.Model = g.model
+		if err := g.summarize(ctx, report, gradingCredentials(header)); err != nil {
+			g.logger.Printf("⚠️ Summarizing conversation %s failed: %v", sessionID, err)
+			report.Error = err.Error()
+		}
+	}
+	report.CreatedAt = time.Now().Format(time.RFC3339)
+
+	if err := storage.SaveConversationReport(report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// summarize has the grading model write the summary and recommendations of a
+// report
+func (g *PromptGrader) summarize(ctx context.Context, report *model.ConversationReport, header http.Header) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The session made %d requests.\n\n<prompts>\n", report.Requests)
+	turns := report.Turns
+	if len(turns) > maxReportTurnsShown {
+		fmt.Fprintf(&b, "(%d earlier prompts left out)\n", len(turns)-maxReportTurnsShown)
+		turns = turns[len(turns)-maxReportTurnsShown:]
+	}
+	for _, turn := range turns {
+		grade := "ungraded"
+		if turn.Score != nil {
+			grade = fmt.Sprintf("graded %d/%d", *turn.Score, gradeMaxScore)
+		}
+		fmt.Fprintf(&b, "%d. (%s) %s\n", turn.Turn, grade, turn.Prompt)
+	}
+	measurements, err := json.MarshalIndent(struct {
+		Context model.ContextWaste `json:"context"`
+		Tools   []model.ToolUsage  `json:"tools"`
+		Loops   []model.ToolLoop   `json:"loops"`
+		Misuse  []model.ToolMisuse `json:"misuse"`
+	}{report.Context, report.Tools, report.Loops, report.Misuse}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(&b, "</prompts>\n\n<measurements>\n%s\n</measurements>\n", measurements)
+
+	text, err := g.ask(ctx, conversationReportPrompt, b.String(), header)
+	if err != nil {
+		return err
+	}
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return errUnreadableReport
+	}
+	var answer struct {
+		Summary         string   `json:"summary"`
+		Recommendations []string `json:"recommendations"`
+	}
+	if err := json.Unmarshal([]byte(text[start:end+1]), &answer); err != nil || strings.TrimSpace(answer.Summary) == "" {
+		return errUnreadableReport
+	}
+	report.Summary = strings.TrimSpace(answer.Summary)
+	report.Recommendations = answer.Recommendations
+	return nil
+}
+
+// reportedCall is a tool call of a conversation, seen once however many
+// requests repeat it
+type reportedCall struct {
+	name  string
+	input string
+	// offered is whether the request it was made in offered the tool, and
+	// readTools whether it offered tools for reading and searching files
+	offered   bool
+	readTools bool
+}
+
+// analyzeConversation measures a conversation from its stored requests, or
+// returns nil when none of them are Messages requests
+func analyzeConversation(sessionID string, requests []*model.RequestLog) *model.ConversationReport {
+	sort.SliceStable(requests, func(i, j int) bool { return requests[i].Timestamp < requests[j].Timestamp })
+
+	report := &model.ConversationReport{
+		SessionID: sessionID,
+		Turns:     []model.ReportTurn{},
+	}
+	prompts := make(map[string]bool)
+	calls := make(map[string]*reportedCall)
+	var order []string
+	failedCalls := make(map[string]bool)
+	results := make(map[string]bool)
+
+	for _, request := range requests {
+		if request.Endpoint != messagesEndpoint {
+			continue
+		}
+		req := requestBody(request)
+		if len(req.Messages) == 0 {
+			continue
+		}
+		report.Requests++
+
+		// Context: a failed request sent its context for nothing, and after
+		// the first request what isn't read from the cache is sent again
+		if request.Response != nil && request.Response.StatusCode >= 400 {
+			report.Context.FailedRequests++
+			report.Context.FailedRequestTokens += estimateTokens(req)
+		} else if usage := responseUsage(request.Response); usage != nil {
+			sent := usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens
+			report.Context.InputTokens += sent
+			report.Context.CacheReadTokens += usage.CacheReadInputTokens
+			if sent > report.Context.PeakContextTokens {
+				report.Context.PeakContextTokens = sent
+			}
+			if report.Requests > 1 {
+				report.Context.UncachedRepeatTokens += usage.InputTokens
+			}
+		}
+
+		// A turn is a prompt the user typed, the latest message of the first
+		// request to send it
+		last := &req.Messages[len(req.Messages)-1]
+		if text := strings.TrimSpace(messageText(last)); last.Role == "user" && text != "" && !hasToolResult(last) {
+			if key := messageKey(last); !prompts[key] {
+				prompts[key] = true
+				turn := model.ReportTurn{
+					Turn:      len(report.Turns) + 1,
+					RequestID: request.RequestID,
+					Timestamp: request.Timestamp,
+					Prompt:    truncateRunes(text, maxReportPromptChars),
+				}
+				if grade := request.PromptGrade; grade != nil && !grade.IsProcessing && grade.Error == "" {
+					score := grade.Score
+					turn.Score = &score
+				}
+				report.Turns = append(report.Turns, turn)
+			}
+		}
+
+		// Tool calls and their results, each counted once by its ID
+		offered := make(map[string]bool)
+		for _, tool := range req.Tools {
+			offered[tool.Name] = true
+		}
+		note := func(id, name string, input interface{}) {
+			if id == "" || calls[id] != nil {
+				return
+			}
+			calls[id] = &reportedCall{
+				name:      name,
+				input:     canonicalInput(input),
+				offered:   len(req.Tools) == 0 || offered[name],
+				readTools: offered["Read"] || offered["Grep"] || offered["Glob"],
+			}
+			order = append(order, id)
+		}
+		for m := range req.Messages {
+			blocks, _ := req.Messages[m].Content.([]interface{})
+			for _, item := range blocks {
+				block, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				switch block["type"] {
+				case "tool_use":
+					id, _ := block["id"].(string)
+					name, _ := block["name"].(string)
+					note(id, name, block["input"])
+				case "tool_result":
+					id, _ := block["tool_use_id"].(string)
+					if id == "" || results[id] {
+						continue
+					}
+					results[id] = true
+					if isError, _ := block["is_error"].(bool); isError {
+						failedCalls[id] = true
+					}
+					if chars, _ := contentSize(block["content"]); chars > largeToolResultChars {
+						report.Context.LargeToolResults++
+						report.Context.LargeToolResultChars += chars
+					}
+				}
+			}
+		}
+		for _, block := range responseContent(request.Response) {
+			if block.Type == "tool_use" {
+				note(block.ID, block.Name, block.Input)
+			}
+		}
+	}
+	if report.Requests == 0 {
+		return nil
+	}
+
+	scoreTurns(report)
+	reportTools(report, calls, order, failedCalls)
+	return report
+}
+
+// scoreTurns averages the grades of a report's turns, and how much better the
+// later half of them were graded than the earlier half
+func scoreTurns(report *model.ConversationReport) {
+	var scores []float64
+	for _, turn := range report.Turns {
+		if turn.Score != nil {
+			scores = append(scores, float64(*turn.Score))
+		}
+	}
+	if len(scores) == 0 {
+		return
+	}
+	average := func(scores []float64) float64 {
+		total := 0.0
+		for _, score := range scores {
+			total += score
+		}
+		return total / float64(len(scores))
+	}
+	report.AverageScore = roundTo(average(scores), 2)
+	if half := len(scores) / 2; half > 0 {
+		report.ScoreChange = roundTo(average(scores[len(scores)-half:])-average(scores[:half]), 2)
+	}
+}
+
+// reportTools counts a conversation's tool calls by tool, the calls it
+// repeated, and the tools it used badly
+func reportTools(report *model.ConversationReport, calls map[string]*reportedCall, order []string, failed map[string]bool) {
+	usage := make(map[string]*model.ToolUsage)
+	loops := make(map[string]*model.ToolLoop)
+	notOffered := make(map[string]int)
+	shellReads := 0
+	for _, id := range order {
+		call := calls[id]
+		tool, ok := usage[call.name]
+		if !ok {
+			tool = &model.ToolUsage{Tool: call.name}
+			usage[call.name] = tool
+		}
+		tool.Calls++
+		if failed[id] {
+			tool.Errors++
+		}
+
+		key := call.name + "\x00" + call.input
+		loop, ok := loops[key]
+		if !ok {
+			loop = &model.ToolLoop{Tool: call.name, Input: truncateRunes(call.input, maxReportInputChars)}
+			loops[key] = loop
+		}
+		loop.Calls++
+
+		if !call.offered {
+			notOffered[call.name]++
+		}
+		if call.name == "Bash" && call.readTools && shellReadCommand.MatchString(shellCommand(call.input)) {
+			shellReads++
+		}
+	}
+
+	report.Tools = []model.ToolUsage{}
+	report.Misuse = []model.ToolMisuse{}
+	for _, tool := range usage {
+		report.Tools = append(report.Tools, *tool)
+		if tool.Calls >= 2 && tool.Errors*2 > tool.Calls {
+			report.Misuse = append(report.Misuse, model.ToolMisuse{Tool: tool.Tool, Calls: tool.Errors, Reason: misuseMostlyFails})
+		}
+	}
+	for name, count := range notOffered {
+		report.Misuse = append(report.Misuse, model.ToolMisuse{Tool: name, Calls: count, Reason: misuseNotOffered})
+	}
+	if shellReads > 0 {
+		report.Misuse = append(report.Misuse, model.ToolMisuse{Tool: "Bash", Calls: shellReads, Reason: misuseShellReads})
+	}
+	report.Loops = []model.ToolLoop{}
+	for _, loop := range loops {
+		if loop.Calls >= loopCalls {
+			report.Loops = append(report.Loops, *loop)
+		}
+	}
+
+	sort.Slice(report.Tools, func(i, j int) bool {
+		if report.Tools[i].Calls != report.Tools[j].Calls {
+			return report.Tools[i].Calls > report.Tools[j].Calls
+		}
+		return report.Tools[i].Tool < report.Tools[j].Tool
+	})
+	sort.Slice(report.Loops, func(i, j int) bool {
+		a, b := report.Loops[i], report.Loops[j]
+		if a.Calls != b.Calls {
+			return a.Calls > b.Calls
+		}
+		if a.Tool != b.Tool {
+			return a.Tool < b.Tool
+		}
+		return a.Input < b.Input
+	})
+	sort.Slice(report.Misuse, func(i, j int) bool {
+		a, b := report.Misuse[i], report.Misuse[j]
+		if a.Calls != b.Calls {
+			return a.Calls > b.Calls
+		}
+		if a.Tool != b.Tool {
+			return a.Tool < b.Tool
+		}
+		return a.Reason < b.Reason
+	})
+}
+
+// canonicalInput is a tool call's input as JSON with its keys sorted, so the
+// same input reads the same wherever it was seen
+func canonicalInput(input interface{}) string {
+	if raw, ok := input.(json.RawMessage); ok {
+		var decoded interface{}
+		if err := json.Unmarshal(raw, &decoded); err != nil {
+			return string(raw)
+		}
+		input = decoded
+	}
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
+
+// shellCommand is the command of a Bash call's input
+func shellCommand(input string) string {
+	var call struct {
+		Command string `json:"command"`
+	}
+	json.Unmarshal([]byte(input), &call)
+	return call.Command
+}
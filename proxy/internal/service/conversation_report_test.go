@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func TestAnalyzeConversation(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	save := func(id string, minute int, messages string, score int, status int, response string) {
+		t.Helper()
+		var decoded interface{}
+		body := `{"tools": [{"name": "Read"}, {"name": "Grep"}, {"name": "Bash"}], "messages": [` + messages + `]}`
+		if err := json.Unmarshal([]byte(body), &decoded); err != nil {
+			t.Fatalf("bad body %s: %v", body, err)
+		}
+		request := testRequestLog(id)
+		request.Timestamp = start.Add(time.Duration(minute) * time.Minute).Format(time.RFC3339)
+		request.SessionID = "sess-1"
+		request.Body = decoded
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		if score > 0 {
+			storage.UpdateRequestWithGrading(id, &model.PromptGrade{Score: score, MaxScore: gradeMaxScore})
+		}
+		request.Response = &model.ResponseLog{StatusCode: status, Body: []byte(response)}
+		if err := storage.UpdateRequestWithResponse(request); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+	}
+	usage := func(input, cacheRead int) string {
+		return `"usage": {"input_tokens": ` + strconv.Itoa(input) + `, "output_tokens": 10, "cache_read_input_tokens": ` + strconv.Itoa(cacheRead) + `}`
+	}
+
+	// The assistant reads a file through the shell, then fails to read
+	// another three times running, retrying after an overloaded error, and
+	// calls a tool it wasn't offered
+	const (
+		prompt = `{"role": "user", "content": "Fix the bug"}`
+		shell  = `{"role": "assistant", "content": [{"type": "tool_use", "id": "t1", "name": "Bash", "input": {"command": "cat main.go"}}]}`
+		read1  = `{"role": "assistant", "content": [{"type": "tool_use", "id": "t2", "name": "Read", "input": {"offset": 0, "file_path": "a.go"}}]}`
+		read2  = `{"role": "assistant", "content": [{"type": "tool_use", "id": "t3", "name": "Read", "input": {"file_path": "a.go", "offset": 0}}]}`
+		read3  = `{"role": "assistant", "content": [{"type": "tool_use", "id": "t4", "name": "Read", "input": {"file_path": "a.go", "offset": 0}},` +
+			` {"type": "tool_use", "id": "t5", "name": "Deploy", "input": {}}]}`
+		failed2 = `{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "t2", "is_error": true, "content": "no such file"}]}`
+		failed3 = `{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "t3", "is_error": true, "content": "no such file"}]}`
+		failed4 = `{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "t4", "is_error": true, "content": "no such file"},` +
+			` {"type": "tool_result", "tool_use_id": "t5", "content": "deployed"}]}`
+		done = `{"role": "assistant", "content": "Done."}`
+		next = `{"role": "user", "content": [{"type": "text", "text": "Now add a test for it"}]}`
+	)
+	large := `{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "t1", "content": "` + strings.Repeat("x", 30000) + `"}]}`
+	history := []string{prompt}
+	turn := func(messages ...string) string {
+		history = append(history, messages...)
+		return strings.Join(history, ",")
+	}
+	save("req-1", 0, turn(), 2, 200, `{"content": [{"type": "tool_use", "id": "t1", "name": "Bash", "input": {"command": "cat main.go"}}], `+usage(1000, 0)+`}`)
+	save("req-2", 1, turn(shell, large), 0, 200, `{"content": [{"type": "tool_use", "id": "t2", "name": "Read", "input": {"file_path": "a.go", "offset": 0}}], `+usage(9000, 1000)+`}`)
+	save("req-3", 2, turn(read1, failed2), 0, 200, `{"content": [], `+usage(100, 10000)+`}`)
+	save("req-4", 3, turn(read2, failed3), 0, 529, `{"type": "error", "error": {"type": "overloaded_error"}}`)
+	save("req-5", 4, turn(), 0, 200, `{"content": [], `+usage(100, 10100)+`}`)
+	save("req-6", 5, turn(read3, failed4), 0, 200, `{"content": [{"type": "text", "text": "Done."}], `+usage(100, 10200)+`}`)
+	save("req-7", 6, turn(done, next), 4, 200, `{"content": [], `+usage(100, 10300)+`}`)
+
+	grading := &gradingProvider{
+		release:  make(chan struct{}),
+		requests: make(chan *http.Request, 1),
+		status:   http.StatusOK,
+		answer: `{"content": [{"type": "text", "text": "Here you go: {\"summary\": \"The prompts got clearer.\",` +
+			` \"recommendations\": [\"Name the file to read.\"]}"}]}`,
+	}
+	close(grading.release)
+	router := NewModelRouter(&config.Config{}, map[string]provider.Provider{"anthropic": grading}, log.New(io.Discard, "", 0))
+	grader, err := NewPromptGrader(config.GradingConfig{}, router, storage, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("NewPromptGrader() returned error: %v", err)
+	}
+
+	report, err := grader.AnalyzeConversation(context.Background(), storage, "sess-1", http.Header{"X-Api-Key": []string{"sk-caller"}})
+	if err != nil {
+		t.Fatalf("AnalyzeConversation() returned error: %v", err)
+	}
+
+	if report.Requests != 7 || len(report.Turns) != 2 || report.Turns[0].RequestID != "req-1" || report.Turns[1].RequestID != "req-7" ||
+		report.Turns[1].Prompt != "Now add a test for it" || report.Turns[1].Score == nil || *report.Turns[1].Score != 4 {
+		t.Errorf("%d requests, turns %+v", report.Requests, report.Turns)
+	}
+	if report.AverageScore != 3 || report.ScoreChange != 2 {
+		t.Errorf("average score %v, change %v, want 3 and 2", report.AverageScore, report.ScoreChange)
+	}
+	expectedContext := model.ContextWaste{
+		InputTokens:          1000 + 10000 + 10100 + 10200 + 10300 + 10400,
+		CacheReadTokens:      1000 + 10000 + 10100 + 10200 + 10300,
+		PeakContextTokens:    10400,
+		UncachedRepeatTokens: 9000 + 100*4,
+		FailedRequests:       1,
+		FailedRequestTokens:  report.Context.FailedRequestTokens,
+		LargeToolResults:     1,
+		LargeToolResultChars: 30000,
+	}
+	if report.Context != expectedContext || report.Context.FailedRequestTokens == 0 {
+		t.Errorf("context = %+v, want %+v", report.Context, expectedContext)
+	}
+	expectedTools := []model.ToolUsage{{Tool: "Read", Calls: 3, Errors: 3}, {Tool: "Bash", Calls: 1}, {Tool: "Deploy", Calls: 1}}
+	if !reflect.DeepEqual(report.Tools, expectedTools) {
+		t.Errorf("tools = %+v, want %+v", report.Tools, expectedTools)
+	}
+	expectedLoops := []model.ToolLoop{{Tool: "Read", Input: `{"file_path":"a.go","offset":0}`, Calls: 3}}
+	if !reflect.DeepEqual(report.Loops, expectedLoops) {
+		t.Errorf("loops = %+v, want %+v", report.Loops, expectedLoops)
+	}
+	expectedMisuse := []model.ToolMisuse{
+		{Tool: "Read", Calls: 3, Reason: misuseMostlyFails},
+		{Tool: "Bash", Calls: 1, Reason: misuseShellReads},
+		{Tool: "Deploy", Calls: 1, Reason: misuseNotOffered},
+	}
+	if !reflect.DeepEqual(report.Misuse, expectedMisuse) {
+		t.Errorf("misuse = %+v, want %+v", report.Misuse, expectedMisuse)
+	}
+	if report.Summary != "The prompts got clearer." || !reflect.DeepEqual(report.Recommendations, []string{"Name the file to read."}) ||
+		report.Model != gradingModel || report.Error != "" {
+		t.Errorf("summary %q, recommendations %v by %s, error %q", report.Summary, report.Recommendations, report.Model, report.Error)
+	}
+
+	sent := <-grading.requests
+	body, _ := io.ReadAll(sent.Body)
+	if !strings.Contains(string(body), "1. (graded 2/5) Fix the bug") || !strings.Contains(string(body), "uncachedRepeatTokens") {
+		t.Errorf("summary request body = %s", body)
+	}
+
+	// The report is stored with the conversation until its requests are gone
+	stored, err := storage.GetConversationReport("sess-1")
+	if err != nil || stored == nil || !reflect.DeepEqual(stored.Loops, report.Loops) || stored.Summary != report.Summary {
+		t.Errorf("GetConversationReport() = %+v, %v", stored, err)
+	}
+	if _, err := grader.AnalyzeConversation(context.Background(), storage, "no-such-session", http.Header{}); err != ErrUnknownConversation {
+		t.Errorf("AnalyzeConversation() of an unknown session = %v, want ErrUnknownConversation", err)
+	}
+	if _, err := storage.DeleteRequestsBefore(start.Add(time.Hour)); err != nil {
+		t.Fatalf("DeleteRequestsBefore() returned error: %v", err)
+	}
+	if stored, err := storage.GetConversationReport("sess-1"); err != nil || stored != nil {
+		t.Errorf("GetConversationReport() after deleting the requests = %+v, %v", stored, err)
+	}
+}
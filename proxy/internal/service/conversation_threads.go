@@ -0,0 +1,307 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// Where conversations are read from
+const (
+	ConversationSourceAuto  = "auto"
+	ConversationSourceFiles = "files"
+	ConversationSourceProxy = "proxy"
+)
+
+// messagesEndpoint is the endpoint whose requests make up conversations
+const messagesEndpoint = "/v1/messages"
+
+// unknownProject holds the conversations of clients that don't say what
+// directory they work in and don't send a user agent
+const unknownProject = "unknown"
+
+// projectPathPattern matches what Claude Code replaces in a working directory
+// to name its project directory
+var projectPathPattern = regexp.MustCompile(`[^A-Za-z0-9]`)
+
+// NewConversationSource returns the conversations cfg asks for, reading
+// Claude Code's files or threading the requests in storage
+func NewConversationSource(cfg config.ConversationsConfig, storage StorageService, logger *log.Logger) ConversationService {
+	files := NewConversationService()
+	switch cfg.Source {
+	case ConversationSourceFiles:
+		return files
+	case ConversationSourceProxy:
+		return NewThreadedConversationService(storage)
+	case "", ConversationSourceAuto:
+	default:
+		logger.Printf("⚠️  Unknown conversation source %q, using %s", cfg.Source, ConversationSourceAuto)
+	}
+
+	if info, err := os.Stat(files.(*conversationService).claudeProjectsPath); err == nil && info.IsDir() {
+		return files
+	}
+	logger.Printf("💬 No Claude Code projects directory, conversations are rebuilt from the logged requests")
+	return NewThreadedConversationService(storage)
+}
+
+// threadedConversationService rebuilds conversations from the logged
+// /v1/messages requests. The requests of a session are threaded by their
+// messages: a request continues the thread whose latest request's messages
+// it starts with. The longest thread is the conversation; the others, such
+// as subagents and title generation, are its side chains.
+type threadedConversationService struct {
+	storage StorageService
+}
+
+func NewThreadedConversationService(storage StorageService) ConversationService {
+	return &threadedConversationService{storage: storage}
+}
+
+// GetConversations returns every conversation by project
+func (cs *threadedConversationService) GetConversations() (map[string][]*Conversation, error) {
+	conversations, err := cs.build(RequestFilter{})
+	if err != nil {
+		return nil, err
+	}
+	projects := make(map[string][]*Conversation)
+	for _, conv := range conversations {
+		projects[conv.ProjectPath] = append(projects[conv.ProjectPath], conv)
+	}
+	return projects, nil
+}
+
+// GetConversation returns a session's conversation
+func (cs *threadedConversationService) GetConversation(projectPath, sessionID string) (*Conversation, error) {
+	conversations, err := cs.build(RequestFilter{SessionID: sessionID})
+	if err != nil {
+		return nil, err
+	}
+	for _, conv := range conversations {
+		if conv.ProjectPath == projectPath {
+			return conv, nil
+		}
+	}
+	return nil, fmt.Errorf("no conversation %s in %s", sessionID, projectPath)
+}
+
+// GetConversationsByProject returns a project's conversations
+func (cs *threadedConversationService) GetConversationsByProject(projectPath string) ([]*Conversation, error) {
+	conversations, err := cs.build(RequestFilter{})
+	if err != nil {
+		return nil, err
+	}
+	var project []*Conversation
+	for _, conv := range conversations {
+		if conv.ProjectPath == projectPath {
+			project = append(project, conv)
+		}
+	}
+	return project, nil
+}
+
+// build threads the requests filter selects into conversations, most
+// recently active first
+func (cs *threadedConversationService) build(filter RequestFilter) ([]*Conversation, error) {
+	requests, err := cs.storage.GetAllRequests(filter)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(requests, func(i, j int) bool { return requests[i].Timestamp < requests[j].Timestamp })
+
+	sessions := make(map[string][]*thread)
+	var order []string
+	for _, request := range requests {
+		if request.Endpoint != messagesEndpoint {
+			continue
+		}
+		req := requestBody(request)
+		if len(req.Messages) == 0 {
+			continue
+		}
+		session := request.SessionID
+		if session == "" {
+			session = SessionID(req)
+		}
+		if _, ok := sessions[session]; !ok {
+			order = append(order, session)
+		}
+		sessions[session] = threadRequest(sessions[session], request, req)
+	}
+
+	conversations := make([]*Conversation, 0, len(order))
+	for _, session := range order {
+		conversations = append(conversations, sessionConversation(session, sessions[session]))
+	}
+	sort.SliceStable(conversations, func(i, j int) bool { return conversations[i].EndTime.After(conversations[j].EndTime) })
+	return conversations, nil
+}
+
+// thread is a run of requests each continuing the one before
+type thread struct {
+	requests []*model.RequestLog
+	bodies   []*model.AnthropicRequest
+	keys     []string // messageKey of the latest request's messages
+	// firstSeen is the request each message was first sent in
+	firstSeen []int
+}
+
+// threadRequest adds a request to the thread it continues, the one with the
+// most messages it starts with, or to a thread of its own
+func threadRequest(threads []*thread, request *model.RequestLog, req *model.AnthropicRequest) []*thread {
+	keys := make([]string, len(req.Messages))
+	for i := range req.Messages {
+		keys[i] = messageKey(&req.Messages[i])
+	}
+
+	var continued *thread
+	for _, t := range threads {
+		if len(t.keys) > len(keys) || continued != nil && len(t.keys) <= len(continued.keys) {
+			continue
+		}
+		prefix := true
+		for i, key := range t.keys {
+			if keys[i] != key {
+				prefix = false
+				break
+			}
+		}
+		if prefix {
+			continued = t
+		}
+	}
+	if continued == nil {
+		continued = &thread{}
+		threads = append(threads, continued)
+	}
+
+	for len(continued.firstSeen) < len(keys) {
+		continued.firstSeen = append(continued.firstSeen, len(continued.requests))
+	}
+	continued.requests = append(continued.requests, request)
+	continued.bodies = append(continued.bodies, req)
+	continued.keys = keys
+	return threads
+}
+
+// sessionConversation turns the threads of a session into a conversation in
+// the shape of Claude Code's session logs
+func sessionConversation(session string, threads []*thread) *Conversation {
+	main := threads[0]
+	for _, t := range threads[1:] {
+		if len(t.keys) > len(main.keys) {
+			main = t
+		}
+	}
+
+	conv := &Conversation{SessionID: session, Messages: []*ConversationMessage{}}
+	for n, t := range threads {
+		last := t.bodies[len(t.bodies)-1]
+		if t == main {
+			conv.ProjectName = requestWorkspace(last)
+			conv.ProjectPath = projectPathPattern.ReplaceAllString(conv.ProjectName, "-")
+			if conv.ProjectName == "" {
+				conv.ProjectName = requestClient(t.requests[0])
+				conv.ProjectPath = conv.ProjectName
+			}
+		}
+		conv.Messages = append(conv.Messages, threadMessages(session, n, t, t != main)...)
+	}
+
+	sort.SliceStable(conv.Messages, func(i, j int) bool { return conv.Messages[i].ParsedTime.Before(conv.Messages[j].ParsedTime) })
+	for _, msg := range conv.Messages {
+		if msg.ParsedTime.IsZero() {
+			continue
+		}
+		if conv.StartTime.IsZero() || msg.ParsedTime.Before(conv.StartTime) {
+			conv.StartTime = msg.ParsedTime
+		}
+		if msg.ParsedTime.After(conv.EndTime) {
+			conv.EndTime = msg.ParsedTime
+		}
+	}
+	conv.MessageCount = len(conv.Messages)
+	conv.FileModTime = conv.EndTime
+	return conv
+}
+
+// threadMessages lists the messages of a thread's latest request and the
+// answer to it, each timed by the request it was first sent in. An
+// assistant message is timed by when the request it answered completed.
+func threadMessages(session string, n int, t *thread, sidechain bool) []*ConversationMessage {
+	last := len(t.requests) - 1
+	workspace := requestWorkspace(t.bodies[last])
+
+	var messages []*ConversationMessage
+	var parent *string
+	add := func(role string, message interface{}, at string) {
+		raw, _ := json.Marshal(message)
+		msg := &ConversationMessage{
+			ParentUUID:  parent,
+			IsSidechain: sidechain,
+			CWD:         workspace,
+			SessionID:   session,
+			Type:        role,
+			Message:     raw,
+			UUID:        fmt.Sprintf("%s-%d-%d", session, n, len(messages)),
+			Timestamp:   at,
+		}
+		msg.ParsedTime, _ = time.Parse(time.RFC3339Nano, at)
+		uuid := msg.UUID
+		parent = &uuid
+		messages = append(messages, msg)
+	}
+
+	for i, message := range t.bodies[last].Messages {
+		sent := t.requests[t.firstSeen[i]]
+		at := sent.Timestamp
+		if message.Role == "assistant" && t.firstSeen[i] > 0 {
+			at = completedAt(t.requests[t.firstSeen[i]-1], at)
+		}
+		add(message.Role, message, at)
+	}
+
+	request := t.requests[last]
+	if response := request.Response; response != nil && response.StatusCode < 400 && len(response.Body) > 0 {
+		var body struct {
+			Model   string          `json:"model"`
+			Content json.RawMessage `json:"content"`
+		}
+		if json.Unmarshal(response.Body, &body) == nil && len(body.Content) > 0 && string(body.Content) != "null" {
+			add("assistant", map[string]interface{}{"role": "assistant", "model": body.Model, "content": body.Content},
+				completedAt(request, request.Timestamp))
+		}
+	}
+	return messages
+}
+
+// completedAt is when a request's response completed, or fallback
+func completedAt(request *model.RequestLog, fallback string) string {
+	if request.Response == nil || request.Response.CompletedAt == "" {
+		return fallback
+	}
+	if at, err := time.Parse(time.RFC3339Nano, request.Response.CompletedAt); err == nil {
+		return at.UTC().Format(time.RFC3339Nano)
+	}
+	return fallback
+}
+
+// requestClient names the client that sent a request by its user agent
+func requestClient(request *model.RequestLog) string {
+	client := strings.Fields(request.UserAgent)
+	if len(client) == 0 {
+		return unknownProject
+	}
+	if name, _, ok := strings.Cut(client[0], "/"); ok && name != "" {
+		return name
+	}
+	return client[0]
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestThreadedConversations(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	save := func(id string, minute int, userAgent, body, response string) {
+		t.Helper()
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(body), &decoded); err != nil {
+			t.Fatalf("bad body %s: %v", body, err)
+		}
+		request := testRequestLog(id)
+		request.Timestamp = start.Add(time.Duration(minute) * time.Minute).Format(time.RFC3339)
+		request.UserAgent = userAgent
+		request.Body = decoded
+		request.SessionID = SessionID(requestBody(request))
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		if response != "" {
+			request.Response = &model.ResponseLog{
+				StatusCode:  200,
+				Body:        []byte(response),
+				CompletedAt: start.Add(time.Duration(minute)*time.Minute + 30*time.Second).Format(time.RFC3339),
+			}
+			if err := storage.UpdateRequestWithResponse(request); err != nil {
+				t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+			}
+		}
+	}
+
+	// A Claude Code session: two turns of the conversation, and a title
+	// generated on the side
+	const claudeCode = `"metadata": {"user_id": "user_abc_account_def_session_sess-1"},
+		"system": [{"type": "text", "text": "You are Claude Code.\nWorking directory: /work/app"}]`
+	save("req-1", 0, "claude-cli/1.0.0 (external, cli)", `{`+claudeCode+`,
+		"messages": [{"role": "user", "content": "Fix the bug"}]}`,
+		`{"model": "claude-sonnet-4", "content": [{"type": "text", "text": "Let me look."}, {"type": "tool_use", "name": "Read"}]}`)
+	save("req-title", 1, "claude-cli/1.0.0 (external, cli)", `{`+claudeCode+`,
+		"messages": [{"role": "user", "content": "Write a title for: Fix the bug"}]}`,
+		`{"model": "claude-haiku-4", "content": [{"type": "text", "text": "Bug fix"}]}`)
+	save("req-2", 2, "claude-cli/1.0.0 (external, cli)", `{`+claudeCode+`,
+		"messages": [
+			{"role": "user", "content": [{"type": "text", "text": "Fix the bug", "cache_control": {"type": "ephemeral"}}]},
+			{"role": "assistant", "content": [{"type": "text", "text": "Let me look."}, {"type": "tool_use", "name": "Read"}]},
+			{"role": "user", "content": [{"type": "tool_result", "content": "package main"}]}
+		]}`,
+		`{"model": "claude-sonnet-4", "content": [{"type": "text", "text": "Fixed."}]}`)
+
+	// Another client, without Claude Code's session or working directory
+	save("req-3", 5, "python-requests/2.31", `{"messages": [{"role": "user", "content": "Hello"}]}`,
+		`{"content": [{"type": "text", "text": "Hi!"}]}`)
+	save("req-4", 6, "python-requests/2.31", `{"messages": [
+			{"role": "user", "content": "Hello"},
+			{"role": "assistant", "content": "Hi!"},
+			{"role": "user", "content": "How are you?"}
+		]}`, "")
+
+	conversations := NewThreadedConversationService(storage)
+	projects, err := conversations.GetConversations()
+	if err != nil {
+		t.Fatalf("GetConversations() returned error: %v", err)
+	}
+	if len(projects) != 2 || len(projects["-work-app"]) != 1 || len(projects["python-requests"]) != 1 {
+		t.Fatalf("projects = %v, want one conversation in -work-app and python-requests", projects)
+	}
+
+	conv, err := conversations.GetConversation("-work-app", "sess-1")
+	if err != nil {
+		t.Fatalf("GetConversation() returned error: %v", err)
+	}
+	if conv.ProjectName != "/work/app" || conv.MessageCount != 6 ||
+		!conv.StartTime.Equal(start) || !conv.EndTime.Equal(start.Add(150*time.Second)) {
+		t.Errorf("conversation = %s in %s, %d messages from %s to %s", conv.SessionID, conv.ProjectName, conv.MessageCount, conv.StartTime, conv.EndTime)
+	}
+
+	type message struct {
+		role      string
+		sidechain bool
+		at        int // seconds after start
+		text      string
+	}
+	expected := []message{
+		{"user", false, 0, "Fix the bug"},
+		{"assistant", false, 30, "Let me look."},
+		{"user", true, 60, "Write a title for: Fix the bug"},
+		{"assistant", true, 90, "Bug fix"},
+		{"user", false, 120, ""},
+		{"assistant", false, 150, "Fixed."},
+	}
+	var main []string
+	for i, msg := range conv.Messages {
+		var body struct {
+			Role    string      `json:"role"`
+			Content interface{} `json:"content"`
+		}
+		if err := json.Unmarshal(msg.Message, &body); err != nil {
+			t.Fatalf("message %d isn't JSON: %s", i, msg.Message)
+		}
+		got := message{msg.Type, msg.IsSidechain, int(msg.ParsedTime.Sub(start).Seconds()), firstText(body.Content)}
+		if got.role == "user" && got.text == "package main" {
+			got.text = ""
+		}
+		if i < len(expected) && got != expected[i] {
+			t.Errorf("message %d = %+v, want %+v", i, got, expected[i])
+		}
+		if body.Role != msg.Type || msg.SessionID != "sess-1" || msg.CWD != "/work/app" {
+			t.Errorf("message %d = %+v", i, msg)
+		}
+		if !msg.IsSidechain {
+			if len(main) > 0 && (msg.ParentUUID == nil || *msg.ParentUUID != main[len(main)-1]) {
+				t.Errorf("message %d follows %v, want %s", i, msg.ParentUUID, main[len(main)-1])
+			}
+			main = append(main, msg.UUID)
+		}
+	}
+
+	other := projects["python-requests"][0]
+	if other.MessageCount != 3 || other.Messages[2].Type != "user" || other.Messages[2].IsSidechain {
+		t.Errorf("python-requests conversation = %d messages, %+v", other.MessageCount, other.Messages)
+	}
+	if _, err := conversations.GetConversation("-work-app", "no-such-session"); err == nil {
+		t.Error("GetConversation() of an unknown session returned no error")
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"sort"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// BuildCostReport totals the stored cost of the groups by day, model, provider
+// and project. The baseline prices each group's tokens at the model Claude Code
+// asked for; where either model has no price the group's cost is its own
+// baseline, so unknown prices never show up as savings.
+func BuildCostReport(groups []model.CostGroup, prices *PriceTable, from, to time.Time) *model.CostReport {
+	report := &model.CostReport{
+		From: from.Format(time.RFC3339),
+		To:   to.Format(time.RFC3339),
+	}
+
+	days := make(map[string]*model.CostBreakdown)
+	models := make(map[string]*model.CostBreakdown)
+	providers := make(map[string]*model.CostBreakdown)
+	projects := make(map[string]*model.CostBreakdown)
+	for _, group := range groups {
+		baseline := group.CostUSD
+		if group.RequestedModel != group.Model && group.Unpriced == 0 {
+			_, served := prices.Price(group.Model)
+			if requested, ok := prices.Price(group.RequestedModel); ok && served {
+				baseline = tokenCost(requested, group.InputTokens, group.OutputTokens, group.CacheReadTokens, group.CacheCreationTokens)
+			}
+		}
+
+		report.Requests += group.Requests
+		report.Unpriced += group.Unpriced
+		report.CostUSD += group.CostUSD
+		report.BaselineCostUSD += baseline
+		addCost(days, group.Day, group, baseline)
+		addCost(models, group.Model, group, baseline)
+		addCost(providers, group.Provider, group, baseline)
+		addCost(projects, group.Project, group, baseline)
+	}
+
+	report.SavedUSD = roundTo(report.BaselineCostUSD-report.CostUSD, 4)
+	report.CostUSD = roundTo(report.CostUSD, 4)
+	report.BaselineCostUSD = roundTo(report.BaselineCostUSD, 4)
+	report.Days = sortedCosts(days)
+	sort.Slice(report.Days, func(i, j int) bool { return report.Days[i].Key < report.Days[j].Key })
+	report.Models = sortedCosts(models)
+	report.Providers = sortedCosts(providers)
+	report.Projects = sortedCosts(projects)
+	return report
+}
+
+// CostReport builds the report for the range with the configured prices
+func (r *ModelRouter) CostReport(groups []model.CostGroup, from, to time.Time) *model.CostReport {
+	return BuildCostReport(groups, r.budget.prices, from, to)
+}
+
+// addCost adds a group to the breakdown under key
+func addCost(breakdowns map[string]*model.CostBreakdown, key string, group model.CostGroup, baseline float64) {
+	breakdown, ok := breakdowns[key]
+	if !ok {
+		breakdown = &model.CostBreakdown{Key: key}
+		breakdowns[key] = breakdown
+	}
+	breakdown.Requests += group.Requests
+	breakdown.InputTokens += group.InputTokens
+	breakdown.OutputTokens += group.OutputTokens
+	breakdown.CacheReadTokens += group.CacheReadTokens
+	breakdown.CacheCreationTokens += group.CacheCreationTokens
+	breakdown.CostUSD += group.CostUSD
+	breakdown.BaselineCostUSD += baseline
+}
+
+// sortedCosts rounds the breakdowns and orders them by cost, most first
+func sortedCosts(breakdowns map[string]*model.CostBreakdown) []model.CostBreakdown {
+	sorted := make([]model.CostBreakdown, 0, len(breakdowns))
+	for _, breakdown := range breakdowns {
+		b := *breakdown
+		b.SavedUSD = roundTo(b.BaselineCostUSD-b.CostUSD, 4)
+		b.CostUSD = roundTo(b.CostUSD, 4)
+		b.BaselineCostUSD = roundTo(b.BaselineCostUSD, 4)
+		sorted = append(sorted, b)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].CostUSD != sorted[j].CostUSD {
+			return sorted[i].CostUSD > sorted[j].CostUSD
+		}
+		return sorted[i].Key < sorted[j].Key
+	})
+	return sorted
+}
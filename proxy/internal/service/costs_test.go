@@ -0,0 +1,60 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestBuildCostReport(t *testing.T) {
+	from := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	groups := []model.CostGroup{
+		// Routed from sonnet to gpt-4o: 1M input tokens cost 2.5 rather than 3
+		{Day: "2026-09-02", Project: "/src/api", Provider: "openai", Model: "gpt-4o", RequestedModel: "claude-sonnet-4-20250514",
+			Requests: 4, InputTokens: 1000000, CostUSD: 2.5},
+		{Day: "2026-09-01", Project: "/src/api", Provider: "anthropic", Model: "claude-sonnet-4-20250514", RequestedModel: "claude-sonnet-4-20250514",
+			Requests: 2, InputTokens: 1000000, CostUSD: 3},
+		// Without a price for the served model nothing can be saved
+		{Day: "2026-09-02", Project: "/src/web", Provider: "openai", Model: "gpt-5-preview", RequestedModel: "claude-opus-4-20250514",
+			Requests: 1, Unpriced: 1, InputTokens: 1000000},
+	}
+
+	report := BuildCostReport(groups, NewPriceTable(nil), from, from.AddDate(0, 1, 0))
+
+	if report.Requests != 7 || report.Unpriced != 1 || report.CostUSD != 5.5 || report.BaselineCostUSD != 6 || report.SavedUSD != 0.5 {
+		t.Errorf("unexpected totals %+v", report)
+	}
+
+	tests := []struct {
+		name       string
+		breakdowns []model.CostBreakdown
+		expected   []string
+		saved      float64
+	}{
+		{"Days in order", report.Days, []string{"2026-09-01", "2026-09-02"}, 0},
+		{"Models by cost", report.Models, []string{"claude-sonnet-4-20250514", "gpt-4o", "gpt-5-preview"}, 0},
+		{"Providers by cost", report.Providers, []string{"anthropic", "openai"}, 0},
+		{"Projects by cost", report.Projects, []string{"/src/api", "/src/web"}, 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.breakdowns) != len(tt.expected) {
+				t.Fatalf("got %d rows, want %d: %+v", len(tt.breakdowns), len(tt.expected), tt.breakdowns)
+			}
+			for i, key := range tt.expected {
+				if tt.breakdowns[i].Key != key {
+					t.Errorf("row %d = %q, want %q", i, tt.breakdowns[i].Key, key)
+				}
+			}
+			if tt.breakdowns[0].SavedUSD != tt.saved {
+				t.Errorf("first row saved %v, want %v", tt.breakdowns[0].SavedUSD, tt.saved)
+			}
+		})
+	}
+
+	if gpt := report.Models[1]; gpt.BaselineCostUSD != 3 || gpt.SavedUSD != 0.5 || gpt.InputTokens != 1000000 {
+		t.Errorf("unexpected gpt-4o row %+v", gpt)
+	}
+}
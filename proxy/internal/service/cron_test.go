@@ -0,0 +1,98 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron_Next(t *testing.T) {
+	base := time.Date(2025, time.March, 14, 10, 30, 0, 0, time.UTC) // Friday
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected time.Time
+	}{
+		{
+			name:     "Every minute",
+			expr:     "* * * * *",
+			expected: time.Date(2025, time.March, 14, 10, 31, 0, 0, time.UTC),
+		},
+		{
+			name:     "Daily at 03:00",
+			expr:     "0 3 * * *",
+			expected: time.Date(2025, time.March, 15, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Every 15 minutes",
+			expr:     "*/15 * * * *",
+			expected: time.Date(2025, time.March, 14, 10, 45, 0, 0, time.UTC),
+		},
+		{
+			name:     "Weekdays at 09:00 using names",
+			expr:     "0 9 * * mon-fri",
+			expected: time.Date(2025, time.March, 17, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Sunday as 7",
+			expr:     "0 0 * * 7",
+			expected: time.Date(2025, time.March, 16, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Monthly macro",
+			expr:     "@monthly",
+			expected: time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Day of month or day of week",
+			expr:     "0 0 1 * sat",
+			expected: time.Date(2025, time.March, 15, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Every duration",
+			expr:     "@every 90s",
+			expected: time.Date(2025, time.March, 14, 10, 31, 30, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q) returned error: %v", tt.expr, err)
+			}
+			if next := schedule.Next(base); !next.Equal(tt.expected) {
+				t.Errorf("Next() = %v, want %v", next, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"@every 10ms",
+		"0 0 * foo *",
+	}
+
+	for _, expr := range invalid {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) expected error, got nil", expr)
+		}
+	}
+}
+
+func TestParseCron_NeverFires(t *testing.T) {
+	schedule, err := ParseCron("0 0 31 2 *")
+	if err != nil {
+		t.Fatalf("ParseCron returned error: %v", err)
+	}
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		t.Errorf("Next() = %v, want zero time", next)
+	}
+}
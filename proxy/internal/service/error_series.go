@@ -0,0 +1,97 @@
+package service
+
+import (
+	"sort"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// maxErrorSeriesHours caps how many hours a series lists, so a range of years
+// doesn't build a list nobody can chart; longer ranges list their last hours
+const maxErrorSeriesHours = 24 * 93
+
+// BuildErrorSeries works out the error rate of every hour from from to to,
+// hours without requests included so a chart has no gaps. A request failed
+// when its status is 400 or over or the API reported an error type.
+func BuildErrorSeries(groups []model.ErrorGroup, from, to time.Time) *model.ErrorSeries {
+	series := &model.ErrorSeries{
+		From:  from.Format(time.RFC3339),
+		To:    to.Format(time.RFC3339),
+		Types: []model.ErrorTypeUsage{},
+		Hours: []model.ErrorHour{},
+	}
+
+	type errorKey struct {
+		status    int
+		errorType string
+	}
+	hours := make(map[int64]*model.ErrorHour)
+	hourTypes := make(map[int64]map[errorKey]int)
+	types := make(map[errorKey]int)
+	for _, group := range groups {
+		at, err := time.Parse("2006-01-02 15:04:05", group.Hour)
+		if err != nil {
+			continue
+		}
+		hour, ok := hours[at.Unix()]
+		if !ok {
+			hour = &model.ErrorHour{}
+			hours[at.Unix()] = hour
+			hourTypes[at.Unix()] = make(map[errorKey]int)
+		}
+		hour.Requests += group.Requests
+		series.Requests += group.Requests
+		if group.StatusCode < 400 && group.ErrorType == "" {
+			continue
+		}
+		hour.Errors += group.Requests
+		series.Errors += group.Requests
+		key := errorKey{group.StatusCode, group.ErrorType}
+		hourTypes[at.Unix()][key] += group.Requests
+		types[key] += group.Requests
+	}
+
+	sortedTypes := func(counts map[errorKey]int) []model.ErrorTypeUsage {
+		usage := make([]model.ErrorTypeUsage, 0, len(counts))
+		for key, requests := range counts {
+			usage = append(usage, model.ErrorTypeUsage{StatusCode: key.status, ErrorType: key.errorType, Requests: requests})
+		}
+		sort.Slice(usage, func(i, j int) bool {
+			if usage[i].Requests != usage[j].Requests {
+				return usage[i].Requests > usage[j].Requests
+			}
+			if usage[i].StatusCode != usage[j].StatusCode {
+				return usage[i].StatusCode < usage[j].StatusCode
+			}
+			return usage[i].ErrorType < usage[j].ErrorType
+		})
+		return usage
+	}
+
+	first := from.Truncate(time.Hour)
+	if to.Sub(first) > maxErrorSeriesHours*time.Hour {
+		first = to.Add(-maxErrorSeriesHours * time.Hour).Truncate(time.Hour)
+	}
+	for at := first; at.Before(to); at = at.Add(time.Hour) {
+		hour := model.ErrorHour{Types: []model.ErrorTypeUsage{}}
+		if counted, ok := hours[at.Unix()]; ok {
+			hour = *counted
+			hour.Types = sortedTypes(hourTypes[at.Unix()])
+		}
+		hour.Hour = at.In(from.Location()).Format(time.RFC3339)
+		hour.ErrorRate = errorRate(hour.Errors, hour.Requests)
+		series.Hours = append(series.Hours, hour)
+	}
+	series.ErrorRate = errorRate(series.Errors, series.Requests)
+	series.Types = sortedTypes(types)
+	return series
+}
+
+// errorRate is the fraction of requests that failed
+func errorRate(errors, requests int) float64 {
+	if requests == 0 {
+		return 0
+	}
+	return roundTo(float64(errors)/float64(requests), 4)
+}
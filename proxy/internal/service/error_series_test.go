@@ -0,0 +1,100 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestBuildErrorSeries(t *testing.T) {
+	from := time.Date(2025, 3, 1, 10, 30, 0, 0, time.UTC)
+	overloaded := model.ErrorTypeUsage{StatusCode: 529, ErrorType: "overloaded_error", Requests: 3}
+
+	tests := []struct {
+		name     string
+		groups   []model.ErrorGroup
+		to       time.Time
+		expected *model.ErrorSeries
+	}{
+		{
+			name: "empty hours are filled in",
+			to:   from.Add(2 * time.Hour),
+			expected: &model.ErrorSeries{
+				From:  "2025-03-01T10:30:00Z",
+				To:    "2025-03-01T12:30:00Z",
+				Types: []model.ErrorTypeUsage{},
+				Hours: []model.ErrorHour{
+					{Hour: "2025-03-01T10:00:00Z", Types: []model.ErrorTypeUsage{}},
+					{Hour: "2025-03-01T11:00:00Z", Types: []model.ErrorTypeUsage{}},
+					{Hour: "2025-03-01T12:00:00Z", Types: []model.ErrorTypeUsage{}},
+				},
+			},
+		},
+		{
+			name: "errors by status and type",
+			to:   from.Add(2 * time.Hour),
+			groups: []model.ErrorGroup{
+				{Hour: "2025-03-01 10:00:00", StatusCode: 200, Requests: 10},
+				{Hour: "2025-03-01 12:00:00", StatusCode: 200, Requests: 5},
+				{Hour: "2025-03-01 12:00:00", StatusCode: 404, Requests: 2},
+				{Hour: "2025-03-01 12:00:00", StatusCode: 529, ErrorType: "overloaded_error", Requests: 3},
+			},
+			expected: &model.ErrorSeries{
+				From:      "2025-03-01T10:30:00Z",
+				To:        "2025-03-01T12:30:00Z",
+				Requests:  20,
+				Errors:    5,
+				ErrorRate: 0.25,
+				Types:     []model.ErrorTypeUsage{overloaded, {StatusCode: 404, Requests: 2}},
+				Hours: []model.ErrorHour{
+					{Hour: "2025-03-01T10:00:00Z", Requests: 10, Types: []model.ErrorTypeUsage{}},
+					{Hour: "2025-03-01T11:00:00Z", Types: []model.ErrorTypeUsage{}},
+					{Hour: "2025-03-01T12:00:00Z", Requests: 10, Errors: 5, ErrorRate: 0.5,
+						Types: []model.ErrorTypeUsage{overloaded, {StatusCode: 404, Requests: 2}}},
+				},
+			},
+		},
+		{
+			name: "an error type on a success counts as an error",
+			to:   from.Add(30 * time.Minute),
+			groups: []model.ErrorGroup{
+				{Hour: "2025-03-01 10:00:00", StatusCode: 200, ErrorType: "overloaded_error", Requests: 1},
+				{Hour: "2025-03-01 10:00:00", StatusCode: 200, Requests: 3},
+			},
+			expected: &model.ErrorSeries{
+				From:      "2025-03-01T10:30:00Z",
+				To:        "2025-03-01T11:00:00Z",
+				Requests:  4,
+				Errors:    1,
+				ErrorRate: 0.25,
+				Types:     []model.ErrorTypeUsage{{StatusCode: 200, ErrorType: "overloaded_error", Requests: 1}},
+				Hours: []model.ErrorHour{
+					{Hour: "2025-03-01T10:00:00Z", Requests: 4, Errors: 1, ErrorRate: 0.25,
+						Types: []model.ErrorTypeUsage{{StatusCode: 200, ErrorType: "overloaded_error", Requests: 1}}},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series := BuildErrorSeries(tt.groups, from, tt.to)
+			if !reflect.DeepEqual(series, tt.expected) {
+				t.Errorf("BuildErrorSeries() = %+v, want %+v", series, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBuildErrorSeries_LongRange(t *testing.T) {
+	to := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	series := BuildErrorSeries(nil, to.AddDate(-1, 0, 0), to)
+	if len(series.Hours) != maxErrorSeriesHours {
+		t.Fatalf("len(Hours) = %d, want %d", len(series.Hours), maxErrorSeriesHours)
+	}
+	if last := series.Hours[len(series.Hours)-1].Hour; last != "2025-03-01T09:00:00Z" {
+		t.Errorf("last hour = %s, want 2025-03-01T09:00:00Z", last)
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// Experiment arms
+const (
+	ArmA = "a"
+	ArmB = "b"
+)
+
+// mappingCanaryPrefix starts the experiment name of a subagent mapping's
+// canary, followed by the agent name
+const mappingCanaryPrefix = "subagent:"
+
+// experiment is a validated A/B experiment from config
+type experiment struct {
+	name   string
+	models []string // lowercased substrings of the requested model
+	modelA string
+	modelB string
+	split  int
+}
+
+func compileExperiment(cfg config.ExperimentConfig) (experiment, error) {
+	exp := experiment{
+		name:   cfg.Name,
+		modelA: cfg.ModelA,
+		modelB: cfg.ModelB,
+		split:  cfg.Split,
+	}
+
+	if exp.name == "" {
+		return exp, fmt.Errorf("experiment has no name")
+	}
+	if exp.modelA == "" || exp.modelB == "" {
+		return exp, fmt.Errorf("experiment %q needs model_a and model_b", cfg.Name)
+	}
+	if exp.split < 0 || exp.split > 100 {
+		return exp, fmt.Errorf("experiment %q has split %d, want 0-100", cfg.Name, cfg.Split)
+	}
+	for _, m := range cfg.Models {
+		exp.models = append(exp.models, strings.ToLower(m))
+	}
+
+	return exp, nil
+}
+
+func (e *experiment) applies(req *model.AnthropicRequest) bool {
+	if len(e.models) == 0 {
+		return true
+	}
+	requested := strings.ToLower(req.Model)
+	for _, m := range e.models {
+		if strings.Contains(requested, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// assign deterministically buckets a session into an arm, so a conversation
+// stays on one model for its whole lifetime
+func (e *experiment) assign(sessionKey string) (string, string) {
+	h := fnv.New32a()
+	h.Write([]byte(e.name + ":" + sessionKey))
+	if int(h.Sum32()%100) < e.split {
+		return ArmB, e.modelB
+	}
+	return ArmA, e.modelA
+}
+
+// sessionKey identifies the conversation a request belongs to: the session
+// from Claude Code's metadata.user_id when present, otherwise the opening user
+// message, which stays the same for every turn of a conversation
+func sessionKey(req *model.AnthropicRequest) string {
+	if req.Metadata != nil && req.Metadata.UserID != "" {
+		userID := req.Metadata.UserID
+		if i := strings.LastIndex(userID, "_session_"); i != -1 {
+			return userID[i+len("_session_"):]
+		}
+		return userID
+	}
+
+	for i := range req.Messages {
+		if req.Messages[i].Role == "user" {
+			return messageText(&req.Messages[i])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"strconv"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// ExportCSVColumns heads the columns of a CSV export. Bodies and headers are
+// left out; the JSON lines export has them.
+var ExportCSVColumns = []string{
+	"request_id",
+	"timestamp",
+	"endpoint",
+	"model",
+	"routed_model",
+	"provider",
+	"route_reason",
+	"user_agent",
+	"status_code",
+	"origin",
+	"streaming",
+	"response_ms",
+	"input_tokens",
+	"output_tokens",
+	"cache_read_tokens",
+	"cache_creation_tokens",
+	"cost_usd",
+	"request_bytes",
+	"response_bytes",
+	"experiment",
+	"experiment_arm",
+	"session_id",
+}
+
+// ExportRequest adds the usage of a request's response, and its cost when
+// none was stored, priced by the model it was routed to
+func ExportRequest(request *model.RequestLog, prices *PriceTable) model.ExportedRequest {
+	exported := model.ExportedRequest{RequestLog: *request}
+	if request.Response == nil || request.Response.Origin == model.ResponseOriginSynthetic {
+		return exported
+	}
+
+	exported.Usage = responseUsage(request.Response)
+	if exported.Usage != nil && exported.CostUSD == nil {
+		modelName := request.RoutedModel
+		if modelName == "" {
+			modelName = request.Model
+		}
+		if cost, ok := prices.Cost(modelName, exported.Usage); ok {
+			exported.CostUSD = &cost
+		}
+	}
+	return exported
+}
+
+// ExportCSVRow lays out an exported request in the order of ExportCSVColumns,
+// leaving what it doesn't have empty
+func ExportCSVRow(request model.ExportedRequest) []string {
+	row := make([]string, len(ExportCSVColumns))
+	row[0] = request.RequestID
+	row[1] = request.Timestamp
+	row[2] = request.Endpoint
+	row[3] = request.Model
+	row[4] = request.RoutedModel
+	row[5] = request.Provider
+	if request.Routing != nil {
+		row[6] = request.Routing.Reason
+	}
+	row[7] = request.UserAgent
+	if resp := request.Response; resp != nil {
+		row[8] = strconv.Itoa(resp.StatusCode)
+		row[9] = resp.Origin
+		row[10] = strconv.FormatBool(resp.IsStreaming)
+		row[11] = strconv.FormatInt(resp.ResponseTime, 10)
+		row[18] = strconv.FormatInt(resp.BodyBytes, 10)
+	}
+	if usage := request.Usage; usage != nil {
+		row[12] = strconv.Itoa(usage.InputTokens)
+		row[13] = strconv.Itoa(usage.OutputTokens)
+		row[14] = strconv.Itoa(usage.CacheReadInputTokens)
+		row[15] = strconv.Itoa(usage.CacheCreationInputTokens)
+	}
+	if request.CostUSD != nil {
+		row[16] = strconv.FormatFloat(*request.CostUSD, 'f', 6, 64)
+	}
+	row[17] = strconv.FormatInt(request.RequestBytes, 10)
+	row[19] = request.Experiment
+	row[20] = request.ExperimentArm
+	row[21] = request.SessionID
+	return row
+}
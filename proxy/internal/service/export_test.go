@@ -0,0 +1,70 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestExportRequest(t *testing.T) {
+	prices := NewPriceTable(map[string]config.PriceConfig{
+		"claude-sonnet-4": {Input: 3, Output: 15},
+	})
+	usageBody := json.RawMessage(`{"usage":{"input_tokens":1000000,"output_tokens":100000}}`)
+
+	tests := []struct {
+		name         string
+		request      model.RequestLog
+		expectedCost string
+		expectedIn   string
+	}{
+		{"Priced by routed model", model.RequestLog{Model: "claude-3-5-haiku", RoutedModel: "claude-sonnet-4", Response: &model.ResponseLog{StatusCode: 200, Body: usageBody}}, "4.500000", "1000000"},
+		{"Unknown price", model.RequestLog{Model: "llama3", Response: &model.ResponseLog{StatusCode: 200, Body: usageBody}}, "", "1000000"},
+		{"Synthetic", model.RequestLog{Model: "claude-sonnet-4", Response: &model.ResponseLog{StatusCode: 429, Origin: model.ResponseOriginSynthetic, Body: usageBody}}, "", ""},
+		{"No response", model.RequestLog{Model: "claude-sonnet-4"}, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := ExportCSVRow(ExportRequest(&tt.request, prices))
+			if len(row) != len(ExportCSVColumns) {
+				t.Fatalf("row has %d columns, want %d", len(row), len(ExportCSVColumns))
+			}
+			columns := make(map[string]string)
+			for i, name := range ExportCSVColumns {
+				columns[name] = row[i]
+			}
+			if columns["cost_usd"] != tt.expectedCost || columns["input_tokens"] != tt.expectedIn {
+				t.Errorf("cost_usd = %q, input_tokens = %q, want %q and %q", columns["cost_usd"], columns["input_tokens"], tt.expectedCost, tt.expectedIn)
+			}
+		})
+	}
+}
+
+func TestExportRequest_JSON(t *testing.T) {
+	request := model.RequestLog{
+		RequestID: "abc",
+		Model:     "claude-sonnet-4",
+		Response:  &model.ResponseLog{StatusCode: 200, Body: json.RawMessage(`{"usage":{"input_tokens":10,"output_tokens":2}}`)},
+	}
+	prices := NewPriceTable(map[string]config.PriceConfig{"claude-sonnet-4": {Input: 3, Output: 15}})
+
+	encoded, err := json.Marshal(ExportRequest(&request, prices))
+	if err != nil {
+		t.Fatalf("failed to marshal export: %v", err)
+	}
+	for _, want := range []string{`"requestId":"abc"`, `"usage":{"input_tokens":10,"output_tokens":2}`, `"costUsd":0.00006`} {
+		if !strings.Contains(string(encoded), want) {
+			t.Errorf("export %s doesn't contain %s", encoded, want)
+		}
+	}
+
+	// The export reads back as the stored request
+	var restored model.RequestLog
+	if err := json.Unmarshal(encoded, &restored); err != nil || restored.RequestID != "abc" || restored.Response.StatusCode != 200 {
+		t.Errorf("export didn't read back as a request: %+v, %v", restored, err)
+	}
+}
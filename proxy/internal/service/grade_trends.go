@@ -0,0 +1,140 @@
+package service
+
+import (
+	"sort"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// Intervals grade trends are averaged over
+const (
+	GradeIntervalDay  = "day"
+	GradeIntervalWeek = "week"
+)
+
+// maxGradePeriods caps how many days or weeks a trend lists; longer ranges
+// list their last ones
+const maxGradePeriods = 366
+
+// gradeSums adds up the scores of a set of prompts
+type gradeSums struct {
+	graded int
+	total  int
+	scores map[int]int
+}
+
+func (g *gradeSums) add(score int) {
+	if g.scores == nil {
+		g.scores = make(map[int]int)
+	}
+	g.graded++
+	g.total += score
+	g.scores[score]++
+}
+
+func (g *gradeSums) average() float64 {
+	if g.graded == 0 {
+		return 0
+	}
+	return roundTo(float64(g.total)/float64(g.graded), 2)
+}
+
+// histogram lists the scores given, lowest first
+func (g *gradeSums) histogram() []model.ScoreCount {
+	counts := make([]model.ScoreCount, 0, len(g.scores))
+	for score, prompts := range g.scores {
+		counts = append(counts, model.ScoreCount{Score: score, Prompts: prompts})
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Score < counts[j].Score })
+	return counts
+}
+
+// BuildGradeTrends averages the grades of prompts overall, by criterion and
+// for every day or week from from to to, in from's location. Days and weeks
+// without graded prompts are listed too so a chart has no gaps.
+func BuildGradeTrends(prompts []model.GradedPrompt, from, to time.Time, interval string) *model.GradeTrends {
+	trends := &model.GradeTrends{
+		From:     from.Format(time.RFC3339),
+		To:       to.Format(time.RFC3339),
+		Interval: interval,
+		Criteria: []model.CriterionTrend{},
+		Periods:  []model.GradePeriod{},
+	}
+	days := 1
+	if interval == GradeIntervalWeek {
+		days = 7
+	}
+	first := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+
+	var overall gradeSums
+	criteria := make(map[string]*gradeSums)
+	periods := make(map[int]*gradeSums)
+	periodCriteria := make(map[int]map[string]*gradeSums)
+	for _, prompt := range prompts {
+		at, err := time.Parse(time.RFC3339, prompt.Timestamp)
+		if err != nil {
+			continue
+		}
+		overall.add(prompt.Grade.Score)
+		if prompt.Grade.MaxScore > trends.MaxScore {
+			trends.MaxScore = prompt.Grade.MaxScore
+		}
+
+		at = at.In(from.Location())
+		day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, from.Location())
+		// Calendar days, so a daylight saving change doesn't shift the periods
+		index := int(day.Sub(first).Round(24*time.Hour)/(24*time.Hour)) / days
+		if periods[index] == nil {
+			periods[index] = &gradeSums{}
+			periodCriteria[index] = make(map[string]*gradeSums)
+		}
+		periods[index].add(prompt.Grade.Score)
+
+		for name, score := range prompt.Grade.Criteria {
+			if criteria[name] == nil {
+				criteria[name] = &gradeSums{}
+			}
+			criteria[name].add(score.Score)
+			if periodCriteria[index][name] == nil {
+				periodCriteria[index][name] = &gradeSums{}
+			}
+			periodCriteria[index][name].add(score.Score)
+		}
+	}
+
+	trends.Graded = overall.graded
+	trends.AverageScore = overall.average()
+	trends.Scores = overall.histogram()
+	for name, sums := range criteria {
+		trends.Criteria = append(trends.Criteria, model.CriterionTrend{
+			Name:         name,
+			Graded:       sums.graded,
+			AverageScore: sums.average(),
+			Scores:       sums.histogram(),
+		})
+	}
+	sort.Slice(trends.Criteria, func(i, j int) bool { return trends.Criteria[i].Name < trends.Criteria[j].Name })
+
+	var starts []time.Time
+	for start := first; start.Before(to); start = start.AddDate(0, 0, days) {
+		starts = append(starts, start)
+	}
+	skipped := 0
+	if len(starts) > maxGradePeriods {
+		skipped = len(starts) - maxGradePeriods
+	}
+	for index := skipped; index < len(starts); index++ {
+		period := model.GradePeriod{Start: starts[index].Format(time.RFC3339)}
+		if sums, ok := periods[index]; ok {
+			period.Graded = sums.graded
+			period.AverageScore = sums.average()
+			period.Criteria = make(map[string]float64, len(periodCriteria[index]))
+			for name, criterion := range periodCriteria[index] {
+				period.Criteria[name] = criterion.average()
+			}
+		}
+		trends.Periods = append(trends.Periods, period)
+	}
+	return trends
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestBuildGradeTrends(t *testing.T) {
+	from := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	graded := func(at string, score, clarity, context int) model.GradedPrompt {
+		return model.GradedPrompt{Timestamp: at, Grade: model.PromptGrade{
+			Score:    score,
+			MaxScore: 10,
+			Criteria: map[string]model.CriteriaScore{
+				"clarity": {Score: clarity},
+				"context": {Score: context},
+			},
+		}}
+	}
+	prompts := []model.GradedPrompt{
+		graded("2025-03-01T14:00:00Z", 4, 2, 3),
+		graded("2025-03-01T18:00:00Z", 6, 3, 3),
+		graded("2025-03-03T09:00:00Z", 8, 4, 5),
+		graded("2025-03-09T09:00:00Z", 9, 5, 4),
+	}
+
+	daily := BuildGradeTrends(prompts, from, from.AddDate(0, 0, 3), GradeIntervalDay)
+	expected := &model.GradeTrends{
+		From:         "2025-03-01T12:00:00Z",
+		To:           "2025-03-04T12:00:00Z",
+		Interval:     GradeIntervalDay,
+		Graded:       4,
+		AverageScore: 6.75,
+		MaxScore:     10,
+		Scores:       []model.ScoreCount{{Score: 4, Prompts: 1}, {Score: 6, Prompts: 1}, {Score: 8, Prompts: 1}, {Score: 9, Prompts: 1}},
+		Criteria: []model.CriterionTrend{
+			{Name: "clarity", Graded: 4, AverageScore: 3.5, Scores: []model.ScoreCount{{Score: 2, Prompts: 1}, {Score: 3, Prompts: 1}, {Score: 4, Prompts: 1}, {Score: 5, Prompts: 1}}},
+			{Name: "context", Graded: 4, AverageScore: 3.75, Scores: []model.ScoreCount{{Score: 3, Prompts: 2}, {Score: 4, Prompts: 1}, {Score: 5, Prompts: 1}}},
+		},
+		Periods: []model.GradePeriod{
+			{Start: "2025-03-01T00:00:00Z", Graded: 2, AverageScore: 5, Criteria: map[string]float64{"clarity": 2.5, "context": 3}},
+			{Start: "2025-03-02T00:00:00Z"},
+			{Start: "2025-03-03T00:00:00Z", Graded: 1, AverageScore: 8, Criteria: map[string]float64{"clarity": 4, "context": 5}},
+			{Start: "2025-03-04T00:00:00Z"},
+		},
+	}
+	if !reflect.DeepEqual(daily, expected) {
+		t.Errorf("BuildGradeTrends() by day = %+v, want %+v", daily, expected)
+	}
+
+	weekly := BuildGradeTrends(prompts, from, from.AddDate(0, 0, 10), GradeIntervalWeek)
+	expectedPeriods := []model.GradePeriod{
+		{Start: "2025-03-01T00:00:00Z", Graded: 3, AverageScore: 6, Criteria: map[string]float64{"clarity": 3, "context": 3.67}},
+		{Start: "2025-03-08T00:00:00Z", Graded: 1, AverageScore: 9, Criteria: map[string]float64{"clarity": 5, "context": 4}},
+	}
+	if !reflect.DeepEqual(weekly.Periods, expectedPeriods) {
+		t.Errorf("BuildGradeTrends() by week = %+v, want %+v", weekly.Periods, expectedPeriods)
+	}
+
+	empty := BuildGradeTrends(nil, from, from.Add(time.Hour), GradeIntervalDay)
+	if empty.Graded != 0 || len(empty.Scores) != 0 || empty.Scores == nil || len(empty.Periods) != 1 {
+		t.Errorf("BuildGradeTrends() without grades = %+v, want one empty day", empty)
+	}
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// maxGradingJobs is how many jobs are kept to be looked up again; the oldest
+// finished ones are forgotten first
+const maxGradingJobs = 50
+
+// Grading job concurrency: how many prompts a job grades at once unless it
+// asks, and at most unless grading.max_concurrent says otherwise
+const (
+	defaultGradingConcurrency = 2
+	maxGradingConcurrency     = 4
+)
+
+// States of a grading job
+const (
+	GradingJobRunning   = "running"
+	GradingJobCompleted = "completed"
+	GradingJobCancelled = "cancelled"
+)
+
+var ErrUnknownGradingJob = errors.New("unknown grading job")
+
+// gradingJob is a job's progress and how to stop it
+type gradingJob struct {
+	status model.GradingJob
+	cancel context.CancelFunc
+}
+
+// GradingJobs grades the prompts of many stored requests in the background,
+// such as all of last month's ungraded ones, a few at a time. Jobs can be
+// followed and cancelled until the proxy stops; a cancelled job stops
+// grading at once and leaves the requests it didn't get to as they were.
+type GradingJobs struct {
+	grader        *PromptGrader
+	storage       StorageService
+	maxConcurrent int
+
+	mu    sync.Mutex
+	jobs  map[string]*gradingJob
+	order []string // oldest first
+}
+
+func NewGradingJobs(grader *PromptGrader, storage StorageService) *GradingJobs {
+	maxConcurrent := grader.maxConcurrent
+	if maxConcurrent <= 0 {
+		maxConcurrent = maxGradingConcurrency
+	}
+	return &GradingJobs{
+		grader:        grader,
+		storage:       storage,
+		maxConcurrent: maxConcurrent,
+		jobs:          make(map[string]*gradingJob),
+	}
+}
+
+// Start grades the /v1/messages requests filter selects, concurrency at a
+// time, with the credentials in header. onGraded is called with each grade
+// once it's stored.
+func (j *GradingJobs) Start(filter RequestFilter, concurrency int, header http.Header, onGraded func(*model.RequestLog, *model.PromptGrade)) (model.GradingJob, error) {
+	if j.grader.provider == nil {
+		return model.GradingJob{}, ErrNoGradingModel
+	}
+	if concurrency <= 0 {
+		concurrency = defaultGradingConcurrency
+	}
+	if concurrency > j.maxConcurrent {
+		concurrency = j.maxConcurrent
+	}
+
+	requests, err := j.storage.GetAllRequests(filter)
+	if err != nil {
+		return model.GradingJob{}, err
+	}
+	// Grade the oldest first, and only hold on to what to look up
+	var ids []string
+	for i := len(requests) - 1; i >= 0; i-- {
+		if requests[i].Endpoint == messagesEndpoint {
+			ids = append(ids, requests[i].RequestID)
+		}
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &gradingJob{
+		status: model.GradingJob{
+			ID:           hex.EncodeToString(id),
+			Status:       GradingJobRunning,
+			Model:        filter.Model,
+			UngradedOnly: filter.Ungraded,
+			Concurrency:  concurrency,
+			Total:        len(ids),
+			StartedAt:    time.Now().Format(time.RFC3339),
+		},
+		cancel: cancel,
+	}
+	if !filter.After.IsZero() {
+		job.status.From = filter.After.Format(time.RFC3339)
+	}
+	if !filter.Before.IsZero() {
+		job.status.To = filter.Before.Format(time.RFC3339)
+	}
+
+	j.mu.Lock()
+	j.jobs[job.status.ID] = job
+	j.order = append(j.order, job.status.ID)
+	j.prune()
+	status := job.status
+	j.mu.Unlock()
+
+	go j.run(ctx, job, ids, gradingCredentials(header), onGraded)
+	return status, nil
+}
+
+// prune forgets the oldest finished jobs beyond maxGradingJobs. j.mu must be
+// held.
+func (j *GradingJobs) prune() {
+	for i := 0; len(j.order) > maxGradingJobs && i < len(j.order); {
+		id := j.order[i]
+		if j.jobs[id].status.FinishedAt == "" {
+			i++
+			continue
+		}
+		delete(j.jobs, id)
+		j.order = append(j.order[:i], j.order[i+1:]...)
+	}
+}
+
+func (j *GradingJobs) run(ctx context.Context, job *gradingJob, ids []string, header http.Header, onGraded func(*model.RequestLog, *model.PromptGrade)) {
+	defer job.cancel()
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < job.status.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range work {
+				j.gradeOne(ctx, job, id, header, onGraded)
+			}
+		}()
+	}
+send:
+	for _, id := range ids {
+		select {
+		case work <- id:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if job.status.Status == GradingJobRunning {
+		job.status.Status = GradingJobCompleted
+	}
+	job.status.FinishedAt = time.Now().Format(time.RFC3339)
+	j.prune()
+}
+
+// gradeOne grades one request of a job and counts how it went
+func (j *GradingJobs) gradeOne(ctx context.Context, job *gradingJob, id string, header http.Header, onGraded func(*model.RequestLog, *model.PromptGrade)) {
+	request, err := j.storage.GetRequestByID(id)
+	if err != nil || request == nil {
+		// Deleted since the job started
+		j.count(job, &job.status.Skipped)
+		return
+	}
+
+	grade, err := j.grader.gradeNow(ctx, request, header)
+	switch {
+	case err == nil:
+		j.count(job, &job.status.Graded)
+		if onGraded != nil {
+			onGraded(request, grade)
+		}
+	case ctx.Err() != nil:
+		// Cancelled, so not counted
+	case errors.Is(err, ErrNothingToGrade), errors.Is(err, ErrAlreadyGrading):
+		j.count(job, &job.status.Skipped)
+	default:
+		j.count(job, &job.status.Failed)
+	}
+}
+
+func (j *GradingJobs) count(job *gradingJob, counter *int) {
+	j.mu.Lock()
+	*counter++
+	j.mu.Unlock()
+}
+
+// Get returns a job's progress
+func (j *GradingJobs) Get(id string) (model.GradingJob, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return model.GradingJob{}, ErrUnknownGradingJob
+	}
+	return job.status, nil
+}
+
+// List returns the jobs kept, newest first
+func (j *GradingJobs) List() []model.GradingJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	jobs := make([]model.GradingJob, 0, len(j.order))
+	for i := len(j.order) - 1; i >= 0; i-- {
+		jobs = append(jobs, j.jobs[j.order[i]].status)
+	}
+	return jobs
+}
+
+// Cancel stops a running job; cancelling a finished one leaves it as it was
+func (j *GradingJobs) Cancel(id string) (model.GradingJob, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return model.GradingJob{}, ErrUnknownGradingJob
+	}
+	if job.status.Status == GradingJobRunning {
+		job.status.Status = GradingJobCancelled
+		job.cancel()
+	}
+	return job.status, nil
+}
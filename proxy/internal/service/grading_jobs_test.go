@@ -0,0 +1,129 @@
+package service
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func TestGradingJobs(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	grading := &gradingProvider{
+		release:  make(chan struct{}),
+		requests: make(chan *http.Request, 10),
+		status:   http.StatusOK,
+		answer:   `{"content": [{"type": "text", "text": "{\"score\": 4}"}]}`,
+	}
+	router := NewModelRouter(&config.Config{}, map[string]provider.Provider{"anthropic": grading}, log.New(io.Discard, "", 0))
+	grader, err := NewPromptGrader(config.GradingConfig{MaxConcurrent: 2}, router, storage, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("NewPromptGrader() returned error: %v", err)
+	}
+	jobs := NewGradingJobs(grader, storage)
+
+	prompt := model.AnthropicRequest{Messages: []model.AnthropicMessage{{Role: "user", Content: "Fix the bug"}}}
+	for _, id := range []string{"a", "b", "c", "graded", "failed", "empty"} {
+		request := testRequestLog(id)
+		if id != "empty" {
+			request.Body = prompt
+		}
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+	}
+	storage.UpdateRequestWithGrading("graded", &model.PromptGrade{Score: 2, MaxScore: gradeMaxScore})
+	storage.UpdateRequestWithGrading("failed", &model.PromptGrade{MaxScore: gradeMaxScore, Error: "401"})
+
+	wait := func(id string) model.GradingJob {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			job, err := jobs.Get(id)
+			if err != nil {
+				t.Fatalf("Get() returned error: %v", err)
+			}
+			if job.FinishedAt != "" {
+				return job
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("job didn't finish: %+v", job)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Ungraded requests, and those whose grading failed, graded at most two at
+	// a time however many are asked for
+	job, err := jobs.Start(RequestFilter{Ungraded: true}, 10, http.Header{}, nil)
+	if err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	if job.Status != GradingJobRunning || job.Total != 5 || job.Concurrency != 2 || !job.UngradedOnly {
+		t.Errorf("started job = %+v", job)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-grading.requests:
+		case <-time.After(time.Second):
+			t.Fatal("grading requests were not sent")
+		}
+	}
+	select {
+	case <-grading.requests:
+		t.Error("more than two prompts graded at once")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(grading.release)
+	job = wait(job.ID)
+	if job.Status != GradingJobCompleted || job.Graded != 4 || job.Skipped != 1 || job.Failed != 0 {
+		t.Errorf("finished job = %+v", job)
+	}
+	graded, _ := storage.GetRequestByID("graded")
+	if graded.PromptGrade.Score != 2 {
+		t.Errorf("already graded request regraded: %+v", graded.PromptGrade)
+	}
+	for _, id := range []string{"a", "failed"} {
+		if stored, _ := storage.GetRequestByID(id); grader.Status(stored) != GradeStatusGraded || stored.PromptGrade.Score != 4 {
+			t.Errorf("request %s grade = %+v", id, stored.PromptGrade)
+		}
+	}
+
+	// A cancelled job stops, leaving the request it was grading as it was
+	grading.release = make(chan struct{})
+	cancelled, err := jobs.Start(RequestFilter{}, 1, http.Header{}, nil)
+	if err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	<-grading.requests
+	if job, err := jobs.Cancel(cancelled.ID); err != nil || job.Status != GradingJobCancelled {
+		t.Errorf("Cancel() = %+v, %v", job, err)
+	}
+	close(grading.release)
+	cancelled = wait(cancelled.ID)
+	if cancelled.Status != GradingJobCancelled || cancelled.Graded+cancelled.Failed != 0 {
+		t.Errorf("cancelled job = %+v", cancelled)
+	}
+	for _, id := range []string{"a", "b", "c", "graded", "failed"} {
+		if stored, _ := storage.GetRequestByID(id); stored.PromptGrade == nil || stored.PromptGrade.IsProcessing {
+			t.Errorf("request %s grade after cancelling = %+v", id, stored.PromptGrade)
+		}
+	}
+
+	if list := jobs.List(); len(list) != 2 || list[0].ID != cancelled.ID {
+		t.Errorf("List() = %+v, want the newest job first", list)
+	}
+	if _, err := jobs.Cancel("no-such-job"); err != ErrUnknownGradingJob {
+		t.Errorf("Cancel() of an unknown job = %v, want ErrUnknownGradingJob", err)
+	}
+}
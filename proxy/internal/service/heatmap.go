@@ -0,0 +1,43 @@
+package service
+
+import (
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// BuildHeatmap totals hourly usage by weekday and hour of the day in from's
+// location. Hours are UTC hours, so in a location whose offset isn't whole
+// hours each lands on the local hour it starts in.
+func BuildHeatmap(hours []model.HourlyUsage, from, to time.Time) *model.Heatmap {
+	heatmap := &model.Heatmap{
+		From:     from.Format(time.RFC3339),
+		To:       to.Format(time.RFC3339),
+		Weekdays: make([]string, 7),
+		Requests: make([][]int, 7),
+		Tokens:   make([][]int64, 7),
+	}
+	for day := range heatmap.Weekdays {
+		heatmap.Weekdays[day] = time.Weekday(day).String()
+		heatmap.Requests[day] = make([]int, 24)
+		heatmap.Tokens[day] = make([]int64, 24)
+	}
+
+	for _, hour := range hours {
+		at, err := time.Parse("2006-01-02 15:04:05", hour.Hour)
+		if err != nil {
+			continue
+		}
+		at = at.In(from.Location())
+		day, h := int(at.Weekday()), at.Hour()
+		heatmap.Requests[day][h] += hour.Requests
+		heatmap.Tokens[day][h] += hour.Tokens
+		if heatmap.Requests[day][h] > heatmap.MaxRequests {
+			heatmap.MaxRequests = heatmap.Requests[day][h]
+		}
+		if heatmap.Tokens[day][h] > heatmap.MaxTokens {
+			heatmap.MaxTokens = heatmap.Tokens[day][h]
+		}
+	}
+	return heatmap
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestBuildHeatmap(t *testing.T) {
+	eastern := time.FixedZone("UTC-5", -5*60*60)
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, eastern)
+
+	heatmap := BuildHeatmap([]model.HourlyUsage{
+		// Saturday evenings a week apart, which are Sunday morning in UTC
+		{Hour: "2025-03-02 03:00:00", Requests: 4, Tokens: 4000},
+		{Hour: "2025-03-09 03:00:00", Requests: 2, Tokens: 1000},
+		// A Monday morning
+		{Hour: "2025-03-03 15:00:00", Requests: 1, Tokens: 8000},
+	}, from, from.AddDate(0, 0, 14))
+
+	if heatmap.From != "2025-03-01T00:00:00-05:00" || heatmap.To != "2025-03-15T00:00:00-05:00" {
+		t.Errorf("range = %s to %s", heatmap.From, heatmap.To)
+	}
+	if len(heatmap.Weekdays) != 7 || heatmap.Weekdays[0] != "Sunday" || heatmap.Weekdays[6] != "Saturday" {
+		t.Errorf("Weekdays = %v, want Sunday to Saturday", heatmap.Weekdays)
+	}
+	for day := 0; day < 7; day++ {
+		if len(heatmap.Requests[day]) != 24 || len(heatmap.Tokens[day]) != 24 {
+			t.Fatalf("%s has %d and %d hours, want 24", heatmap.Weekdays[day], len(heatmap.Requests[day]), len(heatmap.Tokens[day]))
+		}
+	}
+
+	tests := []struct {
+		weekday  time.Weekday
+		hour     int
+		requests int
+		tokens   int64
+	}{
+		{time.Saturday, 22, 6, 5000},
+		{time.Monday, 10, 1, 8000},
+		{time.Sunday, 3, 0, 0},
+	}
+	for _, tt := range tests {
+		if requests, tokens := heatmap.Requests[tt.weekday][tt.hour], heatmap.Tokens[tt.weekday][tt.hour]; requests != tt.requests || tokens != tt.tokens {
+			t.Errorf("%s %02d:00 = %d requests and %d tokens, want %d and %d", tt.weekday, tt.hour, requests, tokens, tt.requests, tt.tokens)
+		}
+	}
+	if heatmap.MaxRequests != 6 || heatmap.MaxTokens != 8000 {
+		t.Errorf("maximums = %d requests and %d tokens, want 6 and 8000", heatmap.MaxRequests, heatmap.MaxTokens)
+	}
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+const (
+	defaultIdleSessionAfter = 30 * time.Minute
+	// idleSessionExpiry is how long a session is remembered after its last request
+	idleSessionExpiry = 24 * time.Hour
+	// maxIdleSessionEvents bounds the events kept for the API
+	maxIdleSessionEvents = 100
+)
+
+// Resume reasons recorded on IdleSessionEventResumed events
+const (
+	idleResumedByMessage = "user message"
+	idleResumedByAPI     = "api"
+)
+
+// ErrSessionNotPaused is returned when resuming a session that isn't paused
+var ErrSessionNotPaused = errors.New("session is not paused")
+
+// SessionPausedError is returned for requests of a session that was paused
+// for running too long without a user message
+type SessionPausedError struct {
+	Session string
+	IdleFor time.Duration
+}
+
+func (e *SessionPausedError) Error() string {
+	return fmt.Sprintf("session %s was paused after %s of requests without a user message; send a message to resume it",
+		e.Session, e.IdleFor.Round(time.Minute))
+}
+
+// IdleSessionMonitor notices sessions that keep making requests with nobody
+// typing, usually an agent loop left running, and raises an event once they
+// have gone on for the configured time. It can also pause such sessions until
+// the user comes back. Sessions are keyed by Claude Code's session metadata;
+// requests without it aren't tracked.
+type IdleSessionMonitor struct {
+	enabled bool
+	after   time.Duration
+	pause   bool
+	logger  *log.Logger
+	now     func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*idleSessionState
+	events   []model.IdleSessionEvent // oldest first
+}
+
+type idleSessionState struct {
+	lastUser     time.Time
+	lastRequest  time.Time
+	requests     int
+	inputTokens  int64
+	outputTokens int64
+	idle         bool // an idle event was raised
+	paused       bool
+}
+
+func NewIdleSessionMonitor(cfg config.IdleSessionsConfig, logger *log.Logger) *IdleSessionMonitor {
+	after, err := time.ParseDuration(cfg.After)
+	if err != nil || after <= 0 {
+		if cfg.After != "" {
+			logger.Printf("⚠️  Invalid idle session threshold %q, using %s", cfg.After, defaultIdleSessionAfter)
+		}
+		after = defaultIdleSessionAfter
+	}
+
+	return &IdleSessionMonitor{
+		enabled:  cfg.Enable,
+		after:    after,
+		pause:    cfg.Pause,
+		logger:   logger,
+		now:      time.Now,
+		sessions: make(map[string]*idleSessionState),
+	}
+}
+
+// Enabled reports whether idle sessions are being watched
+func (m *IdleSessionMonitor) Enabled() bool {
+	return m.enabled
+}
+
+// Observe notes a request before it is routed. It returns a
+// *SessionPausedError if the request's session is paused.
+func (m *IdleSessionMonitor) Observe(req *model.AnthropicRequest) error {
+	key := m.sessionKey(req)
+	if key == "" {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.expire(now)
+
+	state, seen := m.sessions[key]
+	if !seen {
+		// A new session starts with the user's first message
+		state = &idleSessionState{lastUser: now}
+		m.sessions[key] = state
+	}
+
+	if seen && userTurn(req) {
+		if state.idle {
+			m.addEvent(model.IdleSessionEvent{
+				Time:    now.Format(time.RFC3339),
+				Session: key,
+				Event:   model.IdleSessionEventResumed,
+				Reason:  idleResumedByMessage,
+			})
+			m.logger.Printf("💤 Session %s is active again after a user message", key)
+		}
+		*state = idleSessionState{lastUser: now}
+	}
+
+	state.lastRequest = now
+	if state.paused {
+		return &SessionPausedError{Session: key, IdleFor: now.Sub(state.lastUser)}
+	}
+
+	if !state.idle && now.Sub(state.lastUser) >= m.after {
+		state.idle = true
+		state.paused = m.pause
+		m.addEvent(model.IdleSessionEvent{
+			Time:     now.Format(time.RFC3339),
+			Session:  key,
+			Event:    model.IdleSessionEventIdle,
+			Paused:   state.paused,
+			Requests: state.requests,
+			Tokens:   state.inputTokens + state.outputTokens,
+		})
+		m.logger.Printf("💤 Session %s has made %d requests (%d tokens) over %s without a user message",
+			key, state.requests, state.inputTokens+state.outputTokens, now.Sub(state.lastUser).Round(time.Minute))
+		if state.paused {
+			m.logger.Printf("⏸️  Paused session %s until the user sends a message", key)
+			return &SessionPausedError{Session: key, IdleFor: now.Sub(state.lastUser)}
+		}
+	}
+	state.requests++
+	return nil
+}
+
+// Record adds the tokens of a completed request to its session
+func (m *IdleSessionMonitor) Record(req *model.AnthropicRequest, request *model.RequestLog) {
+	key := m.sessionKey(req)
+	if key == "" || request.Response == nil {
+		return
+	}
+	usage := responseUsage(request.Response)
+	if usage == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if state := m.sessions[key]; state != nil {
+		state.inputTokens += int64(usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens)
+		state.outputTokens += int64(usage.OutputTokens)
+	}
+}
+
+// Resume unpauses a session, giving it a fresh idle period
+func (m *IdleSessionMonitor) Resume(session string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state := m.sessions[session]
+	if state == nil || !state.paused {
+		return ErrSessionNotPaused
+	}
+	now := m.now()
+	*state = idleSessionState{lastUser: now, lastRequest: state.lastRequest}
+	m.addEvent(model.IdleSessionEvent{
+		Time:    now.Format(time.RFC3339),
+		Session: session,
+		Event:   model.IdleSessionEventResumed,
+		Reason:  idleResumedByAPI,
+	})
+	m.logger.Printf("▶️  Resumed session %s", session)
+	return nil
+}
+
+// Idle returns the sessions that have gone idle, longest idle first
+func (m *IdleSessionMonitor) Idle() []model.IdleSession {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.expire(now)
+
+	sessions := make([]model.IdleSession, 0)
+	for key, state := range m.sessions {
+		if !state.idle {
+			continue
+		}
+		sessions = append(sessions, model.IdleSession{
+			Session:           key,
+			LastUserMessageAt: state.lastUser.Format(time.RFC3339),
+			LastRequestAt:     state.lastRequest.Format(time.RFC3339),
+			IdleFor:           now.Sub(state.lastUser).Round(time.Second).String(),
+			Requests:          state.requests,
+			InputTokens:       state.inputTokens,
+			OutputTokens:      state.outputTokens,
+			Paused:            state.paused,
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].LastUserMessageAt != sessions[j].LastUserMessageAt {
+			return sessions[i].LastUserMessageAt < sessions[j].LastUserMessageAt
+		}
+		return sessions[i].Session < sessions[j].Session
+	})
+	return sessions
+}
+
+// Events returns the recent idle and resume events, newest first
+func (m *IdleSessionMonitor) Events() []model.IdleSessionEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := make([]model.IdleSessionEvent, len(m.events))
+	for i, event := range m.events {
+		events[len(m.events)-1-i] = event
+	}
+	return events
+}
+
+// After returns how long a session may go without a user message
+func (m *IdleSessionMonitor) After() time.Duration {
+	return m.after
+}
+
+// Pauses reports whether idle sessions are paused
+func (m *IdleSessionMonitor) Pauses() bool {
+	return m.pause
+}
+
+func (m *IdleSessionMonitor) sessionKey(req *model.AnthropicRequest) string {
+	if !m.enabled || req.Metadata == nil || req.Metadata.UserID == "" {
+		return ""
+	}
+	return sessionKey(req)
+}
+
+// expire forgets sessions with no recent requests; m.mu must be held
+func (m *IdleSessionMonitor) expire(now time.Time) {
+	for key, state := range m.sessions {
+		if now.Sub(state.lastRequest) > idleSessionExpiry {
+			delete(m.sessions, key)
+		}
+	}
+}
+
+// addEvent records an event, dropping the oldest past the limit; m.mu must be held
+func (m *IdleSessionMonitor) addEvent(event model.IdleSessionEvent) {
+	m.events = append(m.events, event)
+	if len(m.events) > maxIdleSessionEvents {
+		m.events = m.events[len(m.events)-maxIdleSessionEvents:]
+	}
+}
+
+// userTurn reports whether req continues a conversation with something the
+// user typed, as opposed to tool results the agent is feeding back. Single
+// message requests within a session are subagents or background calls, so
+// they don't count.
+func userTurn(req *model.AnthropicRequest) bool {
+	if len(req.Messages) < 2 {
+		return false
+	}
+	last := &req.Messages[len(req.Messages)-1]
+	if last.Role != "user" {
+		return false
+	}
+	for _, block := range last.GetContentBlocks() {
+		text := strings.TrimSpace(block.Text)
+		if block.Type == "text" && text != "" && !strings.HasPrefix(text, "<system-reminder>") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestUserTurn(t *testing.T) {
+	toolResult := []interface{}{map[string]interface{}{"type": "tool_result", "tool_use_id": "t1", "content": "ok"}}
+	reminder := []interface{}{
+		map[string]interface{}{"type": "tool_result", "tool_use_id": "t1", "content": "ok"},
+		map[string]interface{}{"type": "text", "text": "<system-reminder>Todo list changed</system-reminder>"},
+	}
+
+	tests := []struct {
+		name     string
+		messages []model.AnthropicMessage
+		expected bool
+	}{
+		{"First message", []model.AnthropicMessage{{Role: "user", Content: "fix the tests"}}, false},
+		{"Follow-up from the user", []model.AnthropicMessage{{Role: "user", Content: "fix the tests"}, {Role: "assistant", Content: "Done."}, {Role: "user", Content: "now lint"}}, true},
+		{"Tool result", []model.AnthropicMessage{{Role: "user", Content: "fix the tests"}, {Role: "assistant", Content: "Running"}, {Role: "user", Content: toolResult}}, false},
+		{"System reminder", []model.AnthropicMessage{{Role: "user", Content: "fix the tests"}, {Role: "assistant", Content: "Running"}, {Role: "user", Content: reminder}}, false},
+		{"Assistant prefill", []model.AnthropicMessage{{Role: "user", Content: "fix the tests"}, {Role: "assistant", Content: "{"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := userTurn(&model.AnthropicRequest{Messages: tt.messages}); got != tt.expected {
+				t.Errorf("userTurn() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIdleSessionMonitor(t *testing.T) {
+	start := time.Date(2025, 3, 4, 22, 0, 0, 0, time.UTC)
+
+	session := func(id string, userTyped bool) *model.AnthropicRequest {
+		last := model.AnthropicMessage{Role: "user", Content: []interface{}{map[string]interface{}{"type": "tool_result", "tool_use_id": "t1"}}}
+		if userTyped {
+			last = model.AnthropicMessage{Role: "user", Content: "keep going"}
+		}
+		return &model.AnthropicRequest{
+			Model:    "claude-sonnet-4-20250514",
+			Metadata: &model.RequestMetadata{UserID: "user_abc_account__session_" + id},
+			Messages: []model.AnthropicMessage{{Role: "user", Content: "refactor"}, {Role: "assistant", Content: "ok"}, last},
+		}
+	}
+	completed := func(outputTokens int) *model.RequestLog {
+		body, _ := json.Marshal(map[string]interface{}{"usage": map[string]int{"input_tokens": 100, "output_tokens": outputTokens}})
+		return &model.RequestLog{Response: &model.ResponseLog{StatusCode: 200, Body: body}}
+	}
+
+	t.Run("Alerts once without pausing", func(t *testing.T) {
+		now := start
+		monitor := NewIdleSessionMonitor(config.IdleSessionsConfig{Enable: true, After: "30m"}, log.New(io.Discard, "", 0))
+		monitor.now = func() time.Time { return now }
+
+		for i := 0; i < 5; i++ {
+			if err := monitor.Observe(session("a", false)); err != nil {
+				t.Fatalf("Observe() returned error: %v", err)
+			}
+			monitor.Record(session("a", false), completed(50))
+			now = now.Add(10 * time.Minute)
+		}
+
+		idle := monitor.Idle()
+		if len(idle) != 1 || idle[0].Session != "a" || idle[0].Paused {
+			t.Fatalf("Idle() = %+v, want session a idle and not paused", idle)
+		}
+		if idle[0].Requests != 5 || idle[0].OutputTokens != 250 {
+			t.Errorf("Requests = %d, OutputTokens = %d, want 5 and 250", idle[0].Requests, idle[0].OutputTokens)
+		}
+		events := monitor.Events()
+		if len(events) != 1 || events[0].Event != model.IdleSessionEventIdle || events[0].Requests != 3 {
+			t.Errorf("Events() = %+v, want one idle event after 3 requests", events)
+		}
+
+		// The user coming back clears it
+		if err := monitor.Observe(session("a", true)); err != nil {
+			t.Fatalf("Observe() returned error: %v", err)
+		}
+		if idle := monitor.Idle(); len(idle) != 0 {
+			t.Errorf("Idle() = %+v after a user message, want none", idle)
+		}
+		if events := monitor.Events(); len(events) != 2 || events[0].Event != model.IdleSessionEventResumed || events[0].Reason != idleResumedByMessage {
+			t.Errorf("Events() = %+v, want a resumed event first", events)
+		}
+	})
+
+	t.Run("Pauses until resumed", func(t *testing.T) {
+		now := start
+		monitor := NewIdleSessionMonitor(config.IdleSessionsConfig{Enable: true, After: "30m", Pause: true}, log.New(io.Discard, "", 0))
+		monitor.now = func() time.Time { return now }
+
+		if err := monitor.Observe(session("b", false)); err != nil {
+			t.Fatalf("Observe() returned error: %v", err)
+		}
+		// Other sessions aren't affected
+		now = now.Add(45 * time.Minute)
+		if err := monitor.Observe(session("c", false)); err != nil {
+			t.Fatalf("Observe() for another session returned error: %v", err)
+		}
+
+		var pausedErr *SessionPausedError
+		if err := monitor.Observe(session("b", false)); !errors.As(err, &pausedErr) || pausedErr.Session != "b" {
+			t.Fatalf("err = %v, want *SessionPausedError for b", err)
+		}
+		if err := monitor.Observe(session("b", false)); !errors.As(err, &pausedErr) {
+			t.Fatalf("err = %v, want the session to stay paused", err)
+		}
+
+		if err := monitor.Resume("c"); !errors.Is(err, ErrSessionNotPaused) {
+			t.Errorf("Resume() of a running session = %v, want ErrSessionNotPaused", err)
+		}
+		if err := monitor.Resume("b"); err != nil {
+			t.Fatalf("Resume() returned error: %v", err)
+		}
+		if err := monitor.Observe(session("b", false)); err != nil {
+			t.Errorf("Observe() after resuming returned error: %v", err)
+		}
+	})
+
+	t.Run("Requests without session metadata are ignored", func(t *testing.T) {
+		now := start
+		monitor := NewIdleSessionMonitor(config.IdleSessionsConfig{Enable: true, After: "1m", Pause: true}, log.New(io.Discard, "", 0))
+		monitor.now = func() time.Time { return now }
+
+		req := session("d", false)
+		req.Metadata = nil
+		for i := 0; i < 3; i++ {
+			if err := monitor.Observe(req); err != nil {
+				t.Fatalf("Observe() returned error: %v", err)
+			}
+			now = now.Add(time.Hour)
+		}
+		if idle := monitor.Idle(); len(idle) != 0 {
+			t.Errorf("Idle() = %+v, want none", idle)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// maxImportErrors is how many invalid lines an import describes
+const maxImportErrors = 20
+
+// ImportRequests stores the requests of a JSON lines export, one per line,
+// skipping those already stored and reporting lines that aren't valid
+// requests. It stops at the first storage error, with what it imported so far.
+func ImportRequests(storage StorageService, r io.Reader) (*model.ImportSummary, error) {
+	summary := &model.ImportSummary{}
+	reader := bufio.NewReader(r)
+	for number := 1; ; number++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return summary, fmt.Errorf("failed to read line %d: %w", number, readErr)
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var request model.RequestLog
+			err := json.Unmarshal(line, &request)
+			if err == nil {
+				err = validateImportedRequest(&request)
+			}
+			if err != nil {
+				summary.Invalid++
+				if len(summary.Errors) < maxImportErrors {
+					summary.Errors = append(summary.Errors, fmt.Sprintf("line %d: %v", number, err))
+				}
+			} else {
+				imported, err := storage.ImportRequest(&request)
+				if err != nil {
+					return summary, fmt.Errorf("line %d: %w", number, err)
+				}
+				if imported {
+					summary.Imported++
+				} else {
+					summary.Duplicates++
+				}
+			}
+		}
+
+		if readErr == io.EOF {
+			return summary, nil
+		}
+	}
+}
+
+func validateImportedRequest(request *model.RequestLog) error {
+	if request.RequestID == "" {
+		return errors.New("missing requestId")
+	}
+	if _, err := time.Parse(time.RFC3339, request.Timestamp); err != nil {
+		return fmt.Errorf("invalid timestamp %q, expected RFC3339", request.Timestamp)
+	}
+	if request.Method == "" || request.Endpoint == "" {
+		return errors.New("missing method or endpoint")
+	}
+	if request.Body == nil {
+		return errors.New("missing body")
+	}
+	if request.Response != nil && (request.Response.StatusCode < 100 || request.Response.StatusCode > 599) {
+		return fmt.Errorf("invalid response status %d", request.Response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestImportRequests(t *testing.T) {
+	source, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "source.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	target, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "target.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	for i, id := range []string{"a", "b"} {
+		request := &model.RequestLog{
+			RequestID: id,
+			Timestamp: time.Date(2025, 3, 1, 10, i, 0, 0, time.UTC).Format(time.RFC3339),
+			Method:    "POST",
+			Endpoint:  "/v1/messages",
+			Headers:   map[string][]string{"User-Agent": {"claude-cli/1.0"}},
+			Body:      map[string]interface{}{"messages": []map[string]string{{"role": "user", "content": "fix the flaky test " + id}}},
+			Model:     "claude-sonnet-4",
+			Provider:  "anthropic",
+		}
+		if _, err := source.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		request.Response = &model.ResponseLog{StatusCode: 200, ResponseTime: 100, Body: json.RawMessage(`{"usage":{"input_tokens":10,"output_tokens":5}}`)}
+		if err := source.UpdateRequestWithResponse(request); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+	}
+	if err := source.UpdateRequestWithGrading("a", &model.PromptGrade{Score: 4}); err != nil {
+		t.Fatalf("UpdateRequestWithGrading() returned error: %v", err)
+	}
+
+	var export bytes.Buffer
+	encoder := json.NewEncoder(&export)
+	err = source.ExportRequests(time.Time{}, time.Now(), "", func(request *model.RequestLog) error {
+		return encoder.Encode(ExportRequest(request, NewPriceTable(nil)))
+	})
+	if err != nil {
+		t.Fatalf("ExportRequests() returned error: %v", err)
+	}
+
+	summary, err := ImportRequests(target, strings.NewReader(export.String()))
+	if err != nil {
+		t.Fatalf("ImportRequests() returned error: %v", err)
+	}
+	if summary.Imported != 2 || summary.Duplicates != 0 || summary.Invalid != 0 {
+		t.Errorf("first import = %+v, want 2 imported", summary)
+	}
+
+	imported, _, err := target.GetRequestByShortID("a")
+	if err != nil || imported == nil {
+		t.Fatalf("GetRequestByShortID() = %v, %v", imported, err)
+	}
+	if imported.Response == nil || imported.Response.StatusCode != 200 || imported.PromptGrade == nil || imported.PromptGrade.Score != 4 || imported.Provider != "anthropic" {
+		t.Errorf("imported request lost data: %+v", imported)
+	}
+	stats, err := target.GetStats(time.Time{}, time.Now())
+	if err != nil || stats.Requests != 2 || stats.InputTokens != 20 {
+		t.Errorf("stats after import = %+v, %v; want 2 requests and 20 input tokens", stats, err)
+	}
+	if found, _, err := target.SearchRequests("flaky", 1, 10); err != nil || len(found) != 2 {
+		t.Errorf("SearchRequests(flaky) = %d requests, %v; want both imported requests", len(found), err)
+	}
+
+	// Importing the same file again, with a few broken lines, adds nothing
+	withInvalid := export.String() + "\n" + `{"requestId":"c","timestamp":"yesterday","method":"POST","endpoint":"/v1/messages","body":{}}` + "\n" + "not json\n" +
+		`{"timestamp":"2025-03-01T10:00:00Z","method":"POST","endpoint":"/v1/messages","body":{}}`
+	summary, err = ImportRequests(target, strings.NewReader(withInvalid))
+	if err != nil {
+		t.Fatalf("ImportRequests() returned error: %v", err)
+	}
+	if summary.Imported != 0 || summary.Duplicates != 2 || summary.Invalid != 3 || len(summary.Errors) != 3 {
+		t.Errorf("second import = %+v, want 2 duplicates and 3 invalid", summary)
+	}
+	if !strings.HasPrefix(summary.Errors[0], "line 4: invalid timestamp") {
+		t.Errorf("first error = %q, want it to name line 4 and the timestamp", summary.Errors[0])
+	}
+}
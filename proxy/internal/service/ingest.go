@@ -0,0 +1,94 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// maxIngestSkew is how far in the future an ingested event may be dated, to
+// allow for clock differences between machines
+const maxIngestSkew = 5 * time.Minute
+
+// NormalizeUsageEvent checks an ingested usage event and fills in defaults: a
+// missing timestamp is now and a missing request count is 1. Timestamps are
+// rewritten as RFC3339 in UTC.
+func NormalizeUsageEvent(event *model.UsageEvent, now time.Time) error {
+	event.Source = strings.TrimSpace(event.Source)
+	if event.Source == "" {
+		return fmt.Errorf("source is required")
+	}
+	if strings.EqualFold(event.Source, model.UsageSourceProxy) {
+		return fmt.Errorf("source %q is reserved for proxied requests", model.UsageSourceProxy)
+	}
+
+	timestamp := now
+	if event.Timestamp != "" {
+		parsed, err := time.Parse(time.RFC3339, event.Timestamp)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q, expected RFC3339", event.Timestamp)
+		}
+		if parsed.After(now.Add(maxIngestSkew)) {
+			return fmt.Errorf("timestamp %q is in the future", event.Timestamp)
+		}
+		timestamp = parsed
+	}
+	event.Timestamp = timestamp.UTC().Format(time.RFC3339)
+
+	if event.Requests == 0 {
+		event.Requests = 1
+	}
+	if event.Requests < 0 || event.InputTokens < 0 || event.OutputTokens < 0 ||
+		event.CacheReadTokens < 0 || event.CacheCreationTokens < 0 || event.CostUSD < 0 {
+		return fmt.Errorf("requests, token counts and cost must not be negative")
+	}
+	if event.InputTokens+event.OutputTokens+event.CacheReadTokens+event.CacheCreationTokens == 0 && event.CostUSD == 0 {
+		return fmt.Errorf("event reports no tokens or cost")
+	}
+	return nil
+}
+
+// sourceAccumulator totals usage for one source
+type sourceAccumulator struct {
+	usage model.SourceUsage
+}
+
+func (a *sourceAccumulator) addUsage(usage model.ModelUsage) {
+	a.usage.Requests += usage.Requests
+	a.usage.InputTokens += usage.InputTokens
+	a.usage.OutputTokens += usage.OutputTokens
+	a.usage.CacheReadTokens += usage.CacheReadTokens
+	a.usage.CacheCreationTokens += usage.CacheCreationTokens
+	a.usage.CostUSD += usage.CostUSD
+}
+
+func (a *sourceAccumulator) addEvent(event model.UsageEvent) {
+	a.addUsage(eventUsage(event))
+}
+
+// addEvent counts an ingested event's requests, tokens and reported cost.
+// Ingested events carry no responses, so errors and response times are left
+// alone.
+func (a *modelAccumulator) addEvent(event model.UsageEvent) {
+	usage := eventUsage(event)
+	a.usage.Requests += usage.Requests
+	a.usage.InputTokens += usage.InputTokens
+	a.usage.OutputTokens += usage.OutputTokens
+	a.usage.CacheReadTokens += usage.CacheReadTokens
+	a.usage.CacheCreationTokens += usage.CacheCreationTokens
+	a.usage.CostUSD += usage.CostUSD
+}
+
+func eventUsage(event model.UsageEvent) model.ModelUsage {
+	return model.ModelUsage{
+		Model:               event.Model,
+		Requests:            event.Requests,
+		InputTokens:         event.InputTokens,
+		OutputTokens:        event.OutputTokens,
+		CacheReadTokens:     event.CacheReadTokens,
+		CacheCreationTokens: event.CacheCreationTokens,
+		CostUSD:             event.CostUSD,
+	}
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestNormalizeUsageEvent(t *testing.T) {
+	now := time.Date(2025, 3, 4, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name              string
+		event             model.UsageEvent
+		expectedErr       string
+		expectedTimestamp string
+		expectedRequests  int
+	}{
+		{"Defaults", model.UsageEvent{Source: "laptop", InputTokens: 10}, "", "2025-03-04T12:00:00Z", 1},
+		{"Timestamp converted to UTC", model.UsageEvent{Source: "laptop", Timestamp: "2025-03-04T09:30:00-02:00", Requests: 4, OutputTokens: 1}, "", "2025-03-04T11:30:00Z", 4},
+		{"Cost without tokens", model.UsageEvent{Source: "workbench", CostUSD: 0.5}, "", "2025-03-04T12:00:00Z", 1},
+		{"Missing source", model.UsageEvent{InputTokens: 10}, "source is required", "", 0},
+		{"Reserved source", model.UsageEvent{Source: "Proxy", InputTokens: 10}, "reserved", "", 0},
+		{"Bad timestamp", model.UsageEvent{Source: "laptop", Timestamp: "yesterday", InputTokens: 10}, "expected RFC3339", "", 0},
+		{"Future timestamp", model.UsageEvent{Source: "laptop", Timestamp: "2025-03-04T13:00:00Z", InputTokens: 10}, "in the future", "", 0},
+		{"Negative tokens", model.UsageEvent{Source: "laptop", InputTokens: -1}, "must not be negative", "", 0},
+		{"Nothing to count", model.UsageEvent{Source: "laptop"}, "no tokens or cost", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := tt.event
+			err := NormalizeUsageEvent(&event, now)
+			if tt.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+					t.Fatalf("NormalizeUsageEvent() error = %v, want it to contain %q", err, tt.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizeUsageEvent() returned error: %v", err)
+			}
+			if event.Timestamp != tt.expectedTimestamp {
+				t.Errorf("Timestamp = %q, want %q", event.Timestamp, tt.expectedTimestamp)
+			}
+			if event.Requests != tt.expectedRequests {
+				t.Errorf("Requests = %d, want %d", event.Requests, tt.expectedRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// maxMeasurements is how many measurements are kept to be looked up again;
+// the oldest are forgotten first
+const maxMeasurements = 100
+
+var ErrUnknownMeasurement = errors.New("unknown measurement")
+
+// measurement is when a measurement was started and, once it has been,
+// stopped
+type measurement struct {
+	id      string
+	label   string
+	started time.Time
+	stopped time.Time
+}
+
+// Stopwatch brackets windows of time so what the requests made within them
+// used can be measured, such as a single Claude Code action
+type Stopwatch struct {
+	mu           sync.Mutex
+	measurements map[string]*measurement
+	order        []string // oldest first
+	now          func() time.Time
+}
+
+func NewStopwatch() *Stopwatch {
+	return &Stopwatch{measurements: make(map[string]*measurement), now: time.Now}
+}
+
+// Start begins a measurement, returning its ID
+func (s *Stopwatch) Start(label string) string {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := &measurement{id: hex.EncodeToString(id), label: label, started: s.now()}
+	s.measurements[m.id] = m
+	s.order = append(s.order, m.id)
+	if len(s.order) > maxMeasurements {
+		delete(s.measurements, s.order[0])
+		s.order = s.order[1:]
+	}
+	return m.id
+}
+
+// Stop ends a measurement; stopping it again leaves it as it was
+func (s *Stopwatch) Stop(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.measurements[id]
+	if !ok {
+		return ErrUnknownMeasurement
+	}
+	if m.stopped.IsZero() {
+		m.stopped = s.now()
+	}
+	return nil
+}
+
+// Measure totals the requests made between a measurement's start and its
+// stop, or now while it's running. Stored timestamps are to the second, so
+// requests made in the seconds it started and stopped are counted.
+func (s *Stopwatch) Measure(id string, storage StorageService) (*model.Measurement, error) {
+	s.mu.Lock()
+	m, ok := s.measurements[id]
+	var copied measurement
+	if ok {
+		copied = *m
+	}
+	now := s.now()
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrUnknownMeasurement
+	}
+
+	end := copied.stopped
+	if end.IsZero() {
+		end = now
+	}
+	requests, err := storage.GetAllRequests(RequestFilter{
+		After:  copied.started.Truncate(time.Second),
+		Before: end.Truncate(time.Second).Add(time.Second),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.Measurement{
+		ID:        copied.id,
+		Label:     copied.label,
+		StartedAt: copied.started.Format(time.RFC3339),
+		Running:   copied.stopped.IsZero(),
+		Duration:  end.Sub(copied.started).Round(time.Millisecond).String(),
+		Requests:  []model.MeasuredRequest{},
+	}
+	if !result.Running {
+		result.StoppedAt = copied.stopped.Format(time.RFC3339)
+	}
+	// Oldest first, in the order the action made them
+	for i := len(requests) - 1; i >= 0; i-- {
+		addMeasuredRequest(result, requests[i])
+	}
+	result.CostUSD = roundTo(result.CostUSD, 6)
+	return result, nil
+}
+
+// addMeasuredRequest adds a request to a measurement's totals
+func addMeasuredRequest(result *model.Measurement, request *model.RequestLog) {
+	measured := model.MeasuredRequest{
+		RequestID: request.RequestID,
+		Timestamp: request.Timestamp,
+		Model:     request.RoutedModel,
+		CostUSD:   request.CostUSD,
+	}
+	if measured.Model == "" {
+		measured.Model = request.Model
+	}
+
+	switch {
+	case request.Response == nil:
+		result.Pending++
+	case request.Response.StatusCode >= 400:
+		result.Errors++
+	}
+	if request.Response != nil {
+		measured.StatusCode = request.Response.StatusCode
+		if usage := responseUsage(request.Response); usage != nil {
+			measured.InputTokens = int64(usage.InputTokens)
+			measured.OutputTokens = int64(usage.OutputTokens)
+			measured.CacheReadTokens = int64(usage.CacheReadInputTokens)
+			measured.CacheCreationTokens = int64(usage.CacheCreationInputTokens)
+		}
+		if request.CostUSD == nil {
+			result.Unpriced++
+		}
+	}
+
+	result.InputTokens += measured.InputTokens
+	result.OutputTokens += measured.OutputTokens
+	result.CacheReadTokens += measured.CacheReadTokens
+	result.CacheCreationTokens += measured.CacheCreationTokens
+	if request.CostUSD != nil {
+		result.CostUSD += *request.CostUSD
+	}
+	result.Requests = append(result.Requests, measured)
+}
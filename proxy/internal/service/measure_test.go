@@ -0,0 +1,91 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestStopwatch_Measure(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	if err := storage.SetPrices(NewPriceTable(nil)); err != nil {
+		t.Fatalf("SetPrices() returned error: %v", err)
+	}
+
+	start := time.Date(2025, 6, 15, 12, 0, 0, 500000000, time.UTC)
+	save := func(id string, after time.Duration, response *model.ResponseLog) {
+		t.Helper()
+		request := testRequestLog(id)
+		request.Timestamp = start.Add(after).Format(time.RFC3339)
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		if response != nil {
+			request.Response = response
+			if err := storage.UpdateRequestWithResponse(request); err != nil {
+				t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+			}
+		}
+	}
+	answered := &model.ResponseLog{StatusCode: 200, Body: []byte(`{"usage":{"input_tokens":1000,"output_tokens":200,"cache_read_input_tokens":5000}}`)}
+
+	save("before", -2*time.Second, answered)
+	save("first", 0, answered)
+	save("failed", 10*time.Second, &model.ResponseLog{StatusCode: 529, Body: []byte(`{"type":"error","error":{"type":"overloaded_error"}}`)})
+	save("running", 20*time.Second, nil)
+	save("after", 40*time.Second, answered)
+
+	stopwatch := NewStopwatch()
+	now := start
+	stopwatch.now = func() time.Time { return now }
+	id := stopwatch.Start("refactor")
+
+	now = start.Add(30 * time.Second)
+	running, err := stopwatch.Measure(id, storage)
+	if err != nil {
+		t.Fatalf("Measure() returned error: %v", err)
+	}
+	if !running.Running || len(running.Requests) != 3 {
+		t.Errorf("running measurement = %+v, want 3 requests so far", running)
+	}
+
+	if err := stopwatch.Stop(id); err != nil {
+		t.Fatalf("Stop() returned error: %v", err)
+	}
+	now = start.Add(time.Minute)
+	measured, err := stopwatch.Measure(id, storage)
+	if err != nil {
+		t.Fatalf("Measure() returned error: %v", err)
+	}
+
+	var ids []string
+	for _, request := range measured.Requests {
+		ids = append(ids, request.RequestID)
+	}
+	if len(ids) != 3 || ids[0] != "first" || ids[1] != "failed" || ids[2] != "running" {
+		t.Errorf("measured requests = %v, want first, failed and running", ids)
+	}
+	if measured.Running || measured.Label != "refactor" || measured.Duration != "30s" || measured.StoppedAt != "2025-06-15T12:00:30Z" {
+		t.Errorf("measurement = %+v, want refactor stopped after 30s", measured)
+	}
+	if measured.Pending != 1 || measured.Errors != 1 || measured.InputTokens != 1000 || measured.OutputTokens != 200 || measured.CacheReadTokens != 5000 {
+		t.Errorf("measured totals = %+v", measured)
+	}
+	// 1000 input, 200 output and 5000 cache read tokens of sonnet
+	if measured.CostUSD != 0.0075 {
+		t.Errorf("CostUSD = %v, want 0.0075", measured.CostUSD)
+	}
+
+	if _, err := stopwatch.Measure("unknown", storage); err != ErrUnknownMeasurement {
+		t.Errorf("Measure() of an unknown ID returned %v, want ErrUnknownMeasurement", err)
+	}
+	if err := stopwatch.Stop("unknown"); err != ErrUnknownMeasurement {
+		t.Errorf("Stop() of an unknown ID returned %v, want ErrUnknownMeasurement", err)
+	}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// postgresSchema creates the tables MigrateToPostgres copies into. Bodies and
+// responses are decoded into JSONB, so the copy doesn't depend on compression,
+// encryption, blob files or shared segments of the SQLite database.
+var postgresSchema = []string{`
+	CREATE TABLE IF NOT EXISTS requests (
+		id TEXT PRIMARY KEY,
+		timestamp TIMESTAMPTZ NOT NULL,
+		method TEXT NOT NULL,
+		endpoint TEXT NOT NULL,
+		headers JSONB,
+		body JSONB,
+		model TEXT,
+		user_agent TEXT,
+		content_type TEXT,
+		prompt_grade JSONB,
+		response JSONB,
+		original_model TEXT,
+		routed_model TEXT,
+		experiment TEXT,
+		experiment_arm TEXT,
+		shadow JSONB,
+		provider TEXT,
+		request_bytes BIGINT,
+		request_wire_bytes BIGINT,
+		routing JSONB,
+		config_generation BIGINT,
+		session_id TEXT,
+		cost_usd DOUBLE PRECISION,
+		status_code INTEGER,
+		response_ms BIGINT,
+		error_type TEXT,
+		tags JSONB,
+		deleted_at TIMESTAMPTZ,
+		tenant TEXT,
+		project TEXT
+	)`,
+	"CREATE INDEX IF NOT EXISTS idx_requests_timestamp ON requests(timestamp)",
+	"CREATE INDEX IF NOT EXISTS idx_requests_session_id ON requests(session_id)",
+	`CREATE TABLE IF NOT EXISTS migration_progress (
+		source TEXT PRIMARY KEY,
+		last_id TEXT NOT NULL,
+		copied BIGINT NOT NULL
+	)`,
+}
+
+var postgresRequestColumns = []string{
+	"id", "timestamp", "method", "endpoint", "headers", "body", "model", "user_agent", "content_type",
+	"prompt_grade", "response", "original_model", "routed_model", "experiment", "experiment_arm", "shadow",
+	"provider", "request_bytes", "request_wire_bytes", "routing", "config_generation", "session_id",
+	"cost_usd", "status_code", "response_ms", "error_type", "tags", "deleted_at", "tenant", "project",
+}
+
+// MigrationProgress is how far a migration has got: the requests copied so far,
+// of the total in the source, and the ID of the last one
+type MigrationProgress struct {
+	Copied int
+	Total  int
+	LastID string
+}
+
+// MigrateToPostgres copies every request of a SQLite storage, trashed ones
+// included, into the Postgres database dst with their IDs and timestamps. Each
+// batch is committed along with the ID it ended at under source, so running it
+// again resumes after the last batch copied; requests dst already has are left
+// as they are. progress is called after every batch.
+func MigrateToPostgres(storage StorageService, dst *sql.DB, source string, batchSize int, progress func(MigrationProgress)) (MigrationProgress, error) {
+	s, ok := storage.(*sqliteStorageService)
+	if !ok {
+		return MigrationProgress{}, fmt.Errorf("only SQLite storage can be migrated")
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	for _, statement := range postgresSchema {
+		if _, err := dst.Exec(statement); err != nil {
+			return MigrationProgress{}, fmt.Errorf("failed to create Postgres schema: %w", err)
+		}
+	}
+
+	var state MigrationProgress
+	err := dst.QueryRow("SELECT last_id, copied FROM migration_progress WHERE source = $1", source).Scan(&state.LastID, &state.Copied)
+	if err != nil && err != sql.ErrNoRows {
+		return state, fmt.Errorf("failed to read migration progress: %w", err)
+	}
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM requests").Scan(&state.Total); err != nil {
+		return state, fmt.Errorf("failed to count requests: %w", err)
+	}
+
+	placeholders := make([]string, len(postgresRequestColumns))
+	for i := range placeholders {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	insert := "INSERT INTO requests (" + strings.Join(postgresRequestColumns, ", ") + ") VALUES (" +
+		strings.Join(placeholders, ", ") + ") ON CONFLICT (id) DO NOTHING"
+
+	for {
+		requests, err := s.requestsAfter(state.LastID, batchSize)
+		if err != nil {
+			return state, err
+		}
+		if len(requests) == 0 {
+			return state, nil
+		}
+
+		tx, err := dst.Begin()
+		if err != nil {
+			return state, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		for i := range requests {
+			values, err := postgresRequestValues(&requests[i])
+			if err != nil {
+				tx.Rollback()
+				return state, fmt.Errorf("failed to encode request %s: %w", requests[i].RequestID, err)
+			}
+			if _, err := tx.Exec(insert, values...); err != nil {
+				tx.Rollback()
+				return state, fmt.Errorf("failed to copy request %s: %w", requests[i].RequestID, err)
+			}
+		}
+		next := MigrationProgress{Copied: state.Copied + len(requests), Total: state.Total, LastID: requests[len(requests)-1].RequestID}
+		_, err = tx.Exec(`
+			INSERT INTO migration_progress (source, last_id, copied) VALUES ($1, $2, $3)
+			ON CONFLICT (source) DO UPDATE SET last_id = excluded.last_id, copied = excluded.copied
+		`, source, next.LastID, next.Copied)
+		if err != nil {
+			tx.Rollback()
+			return state, fmt.Errorf("failed to record migration progress: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return state, fmt.Errorf("failed to commit batch: %w", err)
+		}
+
+		state = next
+		if progress != nil {
+			progress(state)
+		}
+	}
+}
+
+// requestsAfter returns up to limit stored requests, trashed ones included,
+// with IDs after id in ID order
+func (s *sqliteStorageService) requestsAfter(id string, limit int) ([]model.RequestLog, error) {
+	rows, err := s.db.Query("SELECT "+requestColumns+" FROM requests WHERE id > ? ORDER BY id LIMIT ?", id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query requests: %w", err)
+	}
+	defer rows.Close()
+
+	var requests []model.RequestLog
+	for rows.Next() {
+		req, err := s.scanRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request: %w", err)
+		}
+		requests = append(requests, *req)
+	}
+	return requests, rows.Err()
+}
+
+// postgresRequestValues are the values of postgresRequestColumns for request
+func postgresRequestValues(request *model.RequestLog) ([]interface{}, error) {
+	var jsonValues [7]interface{}
+	for i, value := range []interface{}{request.Headers, request.Body, request.PromptGrade, request.Response, request.Shadow, request.Routing, request.Tags} {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		if string(encoded) != "null" {
+			jsonValues[i] = string(encoded)
+		}
+	}
+
+	var cost, statusCode, responseMs, errorType, deletedAt, project interface{}
+	if request.CostUSD != nil {
+		cost = *request.CostUSD
+	}
+	if request.Response != nil {
+		statusCode = request.Response.StatusCode
+		responseMs = request.Response.ResponseTime
+		if value := responseErrorType(request.Response); value != "" {
+			errorType = value
+		}
+	}
+	if request.DeletedAt != "" {
+		deletedAt = request.DeletedAt
+	}
+	if body, ok := jsonValues[1].(string); ok {
+		project = requestProject([]byte(body))
+	}
+
+	return []interface{}{
+		request.RequestID, request.Timestamp, request.Method, request.Endpoint, jsonValues[0], jsonValues[1],
+		request.Model, request.UserAgent, request.ContentType, jsonValues[2], jsonValues[3],
+		request.OriginalModel, request.RoutedModel, request.Experiment, request.ExperimentArm, jsonValues[4],
+		request.Provider, request.RequestBytes, request.RequestWireBytes, jsonValues[5], request.ConfigGeneration,
+		request.SessionID, cost, statusCode, responseMs, errorType, jsonValues[6], deletedAt, requestTenant(request), project,
+	}, nil
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestMigrateToPostgres(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db"), TrashDays: 7})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	save := func(from, to int) {
+		for i := from; i < to; i++ {
+			request := testRequestLog(fmt.Sprintf("req-%d", i))
+			request.Timestamp = fmt.Sprintf("2025-03-01T10:0%d:00Z", i)
+			request.Body = map[string]interface{}{"messages": []string{"hello"}}
+			if i == 0 {
+				request.Routing = &model.RoutingExplanation{User: "alice"}
+			}
+			if _, err := storage.SaveRequest(request); err != nil {
+				t.Fatalf("SaveRequest() returned error: %v", err)
+			}
+		}
+	}
+	save(0, 2)
+	if err := storage.UpdateRequestWithResponse(&model.RequestLog{RequestID: "req-1", Response: &model.ResponseLog{StatusCode: 429, ResponseTime: 120}}); err != nil {
+		t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+	}
+
+	// The statements are plain enough for SQLite to stand in for Postgres
+	dst, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "postgres.db"))
+	if err != nil {
+		t.Fatalf("failed to open destination: %v", err)
+	}
+	defer dst.Close()
+
+	if progress, err := MigrateToPostgres(storage, dst, "requests.db", 2, nil); err != nil || progress.Copied != 2 || progress.LastID != "req-1" {
+		t.Fatalf("MigrateToPostgres() = %+v, %v, want 2 requests copied up to req-1", progress, err)
+	}
+
+	// A later run carries on after the last request copied
+	save(2, 5)
+	if _, err := storage.DeleteRequests(RequestFilter{Model: "sonnet"}); err != nil {
+		t.Fatalf("DeleteRequests() returned error: %v", err)
+	}
+	if _, err := storage.RestoreRequests([]string{"req-0", "req-1", "req-2", "req-3"}); err != nil {
+		t.Fatalf("RestoreRequests() returned error: %v", err)
+	}
+	var batches []MigrationProgress
+	progress, err := MigrateToPostgres(storage, dst, "requests.db", 2, func(progress MigrationProgress) {
+		batches = append(batches, progress)
+	})
+	if err != nil || progress.Copied != 5 || progress.Total != 5 || len(batches) != 2 || batches[0].LastID != "req-3" {
+		t.Fatalf("resumed migration = %+v after %+v, %v, want the other 3 requests in 2 batches", progress, batches, err)
+	}
+
+	var count int
+	dst.QueryRow("SELECT COUNT(*) FROM requests").Scan(&count)
+	if count != 5 {
+		t.Errorf("requests copied = %d, want 5", count)
+	}
+	var timestamp, tenant, body string
+	dst.QueryRow("SELECT timestamp, tenant, body FROM requests WHERE id = 'req-0'").Scan(&timestamp, &tenant, &body)
+	if timestamp != "2025-03-01T10:00:00Z" || tenant != "alice" || body != `{"messages":["hello"]}` {
+		t.Errorf("req-0 copied as %s, %s, %s, want its timestamp, tenant and decoded body", timestamp, tenant, body)
+	}
+	var statusCode, responseMs int
+	dst.QueryRow("SELECT status_code, response_ms FROM requests WHERE id = 'req-1'").Scan(&statusCode, &responseMs)
+	if statusCode != 429 || responseMs != 120 {
+		t.Errorf("req-1 response copied as %d in %dms, want 429 in 120ms", statusCode, responseMs)
+	}
+	var deletedAt sql.NullString
+	dst.QueryRow("SELECT deleted_at FROM requests WHERE id = 'req-4'").Scan(&deletedAt)
+	if !deletedAt.Valid {
+		t.Error("trashed req-4 copied without its deletion time")
+	}
+
+	if progress, err := MigrateToPostgres(storage, dst, "requests.db", 2, nil); err != nil || progress.Copied != 5 {
+		t.Errorf("MigrateToPostgres() after finishing = %+v, %v, want nothing more copied", progress, err)
+	}
+}
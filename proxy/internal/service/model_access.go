@@ -0,0 +1,122 @@
+package service
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// Actions for denied models (see config.ModelAccessConfig)
+const (
+	ModelAccessReject  = "reject"
+	ModelAccessRewrite = "rewrite"
+)
+
+// ModelDeniedError is returned when routing ends on a model the access lists
+// deny and the action is to reject. Explanation is the route that was refused.
+type ModelDeniedError struct {
+	Model       string
+	Explanation model.RoutingExplanation
+}
+
+func (e *ModelDeniedError) Error() string {
+	return fmt.Sprintf("model %s is not allowed through this proxy", e.Model)
+}
+
+// modelAccess is the compiled allow and deny lists
+type modelAccess struct {
+	allow     []string // lowercased globs
+	deny      []string
+	action    string
+	rewriteTo string
+}
+
+func newModelAccess(cfg config.ModelAccessConfig) (*modelAccess, []error) {
+	access := &modelAccess{action: cfg.Action, rewriteTo: cfg.RewriteTo}
+	var errs []error
+
+	compile := func(patterns []string) []string {
+		var globs []string
+		for _, pattern := range patterns {
+			pattern = strings.ToLower(strings.TrimSpace(pattern))
+			if pattern == "" {
+				continue
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs = append(errs, fmt.Errorf("invalid model pattern %q: %w", pattern, err))
+				continue
+			}
+			globs = append(globs, pattern)
+		}
+		return globs
+	}
+	access.allow = compile(cfg.Allow)
+	access.deny = compile(cfg.Deny)
+
+	switch access.action {
+	case "":
+		access.action = ModelAccessReject
+	case ModelAccessReject:
+	case ModelAccessRewrite:
+		if access.rewriteTo == "" {
+			errs = append(errs, fmt.Errorf("model_access action %q needs rewrite_to, rejecting instead", ModelAccessRewrite))
+			access.action = ModelAccessReject
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown model_access action %q, rejecting instead", cfg.Action))
+		access.action = ModelAccessReject
+	}
+	return access, errs
+}
+
+func (a *modelAccess) enabled() bool {
+	return len(a.allow) > 0 || len(a.deny) > 0
+}
+
+// allowed reports whether modelName may be sent upstream
+func (a *modelAccess) allowed(modelName string) bool {
+	lower := strings.ToLower(modelName)
+	for _, pattern := range a.deny {
+		if ok, _ := path.Match(pattern, lower); ok {
+			return false
+		}
+	}
+	if len(a.allow) == 0 {
+		return true
+	}
+	for _, pattern := range a.allow {
+		if ok, _ := path.Match(pattern, lower); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// applyModelAccess rejects decision, or rewrites it to the configured model,
+// when its target model is denied. It is the last step of routing, so it sees
+// the model that would actually be sent upstream.
+func (r *ModelRouter) applyModelAccess(decision *RoutingDecision) error {
+	if !r.access.enabled() || r.access.allowed(decision.TargetModel) {
+		return nil
+	}
+
+	denied := decision.TargetModel
+	decision.Explanation.DeniedModel = denied
+	if r.access.action == ModelAccessRewrite && r.access.allowed(r.access.rewriteTo) {
+		if p := r.providerFor(r.access.rewriteTo, ""); p != nil {
+			r.logger.Printf("⛔ %s is denied, rewriting \033[36m%s\033[0m → \033[32m%s\033[0m", denied, denied, r.access.rewriteTo)
+			decision.adjust("%s is denied by the model access lists, rewrote to %s", denied, r.access.rewriteTo)
+			decision.Explanation.Access = model.ModelAccessRewritten
+			decision.TargetModel = r.access.rewriteTo
+			decision.Provider = p
+			return nil
+		}
+	}
+
+	decision.Explanation.Access = model.ModelAccessBlocked
+	decision.Explanation.Provider = decision.Provider.Name()
+	return &ModelDeniedError{Model: denied, Explanation: decision.Explanation}
+}
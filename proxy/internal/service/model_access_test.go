@@ -0,0 +1,128 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func TestModelRouter_ModelAccess(t *testing.T) {
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+	}
+
+	tests := []struct {
+		name          string
+		access        config.ModelAccessConfig
+		override      bool
+		requested     string
+		expectedModel string
+		expectBlock   bool
+	}{
+		{"No lists", config.ModelAccessConfig{}, false, "claude-opus-4-20250514", "claude-opus-4-20250514", false},
+		{"Denied model rejected", config.ModelAccessConfig{Deny: []string{"*opus*"}}, false, "claude-opus-4-20250514", "", true},
+		{"Other models pass", config.ModelAccessConfig{Deny: []string{"*opus*"}}, false, "claude-sonnet-4-20250514", "claude-sonnet-4-20250514", false},
+		{"Patterns ignore case", config.ModelAccessConfig{Deny: []string{"*OPUS*"}}, false, "claude-opus-4-20250514", "", true},
+		{"Denied model rewritten", config.ModelAccessConfig{Deny: []string{"*opus*"}, Action: ModelAccessRewrite, RewriteTo: "claude-sonnet-4-20250514"}, false, "claude-opus-4-20250514", "claude-sonnet-4-20250514", false},
+		{"Overrides are rewritten too", config.ModelAccessConfig{Deny: []string{"*opus*"}, Action: ModelAccessRewrite, RewriteTo: "claude-sonnet-4-20250514"}, true, "claude-opus-4-20250514", "claude-sonnet-4-20250514", false},
+		{"Rewrite without a target rejects", config.ModelAccessConfig{Deny: []string{"*opus*"}, Action: ModelAccessRewrite}, false, "claude-opus-4-20250514", "", true},
+		{"Rewrite to a denied model rejects", config.ModelAccessConfig{Deny: []string{"claude-*"}, Action: ModelAccessRewrite, RewriteTo: "claude-sonnet-4-20250514"}, false, "claude-opus-4-20250514", "", true},
+		{"Model outside the allowlist rejected", config.ModelAccessConfig{Allow: []string{"*sonnet*", "*haiku*"}}, false, "claude-opus-4-20250514", "", true},
+		{"Model in the allowlist passes", config.ModelAccessConfig{Allow: []string{"*sonnet*", "*haiku*"}}, false, "claude-3-5-haiku-20241022", "claude-3-5-haiku-20241022", false},
+		{"Deny wins over allow", config.ModelAccessConfig{Allow: []string{"claude-*"}, Deny: []string{"*opus*"}}, true, "claude-opus-4-20250514", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Routing: config.RoutingConfig{ModelAccess: tt.access}}
+			router := NewModelRouter(cfg, providers, log.New(io.Discard, "", 0))
+
+			req := &model.AnthropicRequest{
+				Model:    tt.requested,
+				Messages: []model.AnthropicMessage{{Role: "user", Content: "hello"}},
+			}
+			var decision *RoutingDecision
+			var err error
+			if tt.override {
+				decision, err = router.OverrideRoute(req, tt.requested, "")
+			} else {
+				decision, err = router.DetermineRoute(req)
+			}
+
+			var deniedErr *ModelDeniedError
+			if tt.expectBlock {
+				if !errors.As(err, &deniedErr) {
+					t.Fatalf("err = %v, want *ModelDeniedError", err)
+				}
+				if deniedErr.Model != tt.requested || deniedErr.Explanation.Access != model.ModelAccessBlocked {
+					t.Errorf("unexpected denial %+v", deniedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("routing returned error: %v", err)
+			}
+			if decision.TargetModel != tt.expectedModel {
+				t.Errorf("TargetModel = %q, want %q", decision.TargetModel, tt.expectedModel)
+			}
+			rewritten := decision.TargetModel != tt.requested
+			if got := decision.Explanation.Access == model.ModelAccessRewritten; got != rewritten {
+				t.Errorf("Access = %q, want rewritten: %v", decision.Explanation.Access, rewritten)
+			}
+		})
+	}
+}
+
+func TestSQLiteStorage_GetStatsModelAccess(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	requests := []struct {
+		id, routed, access, denied string
+		status                     int
+	}{
+		{"a", "claude-opus-4-20250514", model.ModelAccessBlocked, "claude-opus-4-20250514", 403},
+		{"b", "claude-opus-4-20250514", model.ModelAccessBlocked, "claude-opus-4-20250514", 403},
+		{"c", "claude-sonnet-4-20250514", model.ModelAccessRewritten, "claude-opus-4-20250514", 200},
+		{"d", "claude-sonnet-4-20250514", "", "", 200},
+	}
+	now := time.Now()
+	for _, r := range requests {
+		log := &model.RequestLog{
+			RequestID:   r.id,
+			Timestamp:   now.Format(time.RFC3339),
+			Method:      "POST",
+			Endpoint:    "/v1/messages",
+			Body:        map[string]string{"model": "claude-opus-4-20250514"},
+			Model:       "claude-opus-4-20250514",
+			RoutedModel: r.routed,
+			Routing:     &model.RoutingExplanation{Reason: model.RouteReasonDefault, Access: r.access, DeniedModel: r.denied},
+		}
+		if _, err := storage.SaveRequest(log); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		log.Response = &model.ResponseLog{StatusCode: r.status}
+		if err := storage.UpdateRequestWithResponse(log); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+	}
+
+	stats, err := storage.GetStats(now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetStats() returned error: %v", err)
+	}
+
+	want := model.ModelAccessUsage{Model: "claude-opus-4-20250514", Blocked: 2, Rewritten: 1}
+	if len(stats.ModelAccess) != 1 || stats.ModelAccess[0] != want {
+		t.Errorf("ModelAccess = %+v, want [%+v]", stats.ModelAccess, want)
+	}
+}
@@ -1,12 +1,18 @@
 package service
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/seifghazi/claude-code-monitor/internal/config"
 	"github.com/seifghazi/claude-code-monitor/internal/model"
@@ -18,6 +24,29 @@ type RoutingDecision struct {
 	Provider      provider.Provider
 	OriginalModel string
 	TargetModel   string
+	// RequestModified is set when routing changed the request beyond its model
+	// (e.g. trimmed it to fit a local context window) and it must be re-encoded
+	RequestModified bool
+	// Experiment and ExperimentArm are set when an A/B experiment picked the model
+	Experiment    string
+	ExperimentArm string
+	// Explanation says why this route was picked, for the request log
+	Explanation model.RoutingExplanation
+}
+
+// Request headers that override routing for a single request
+const (
+	OverrideModelHeader    = "X-CCProxy-Model"
+	OverrideProviderHeader = "X-CCProxy-Provider"
+)
+
+// ErrUnknownProvider is returned when a routing override names a provider that
+// isn't configured
+var ErrUnknownProvider = errors.New("unknown provider")
+
+// adjust records a change made to the decision after the model was picked
+func (d *RoutingDecision) adjust(format string, args ...interface{}) {
+	d.Explanation.Adjustments = append(d.Explanation.Adjustments, fmt.Sprintf(format, args...))
 }
 
 type ModelRouter struct {
@@ -25,6 +54,29 @@ type ModelRouter struct {
 	providers          map[string]provider.Provider
 	subagentMappings   map[string]string             // agentName -> targetModel
 	customAgentPrompts map[string]SubagentDefinition // promptHash -> definition
+	agentsMu           sync.RWMutex                  // guards subagentMappings and customAgentPrompts, which change at runtime
+	detection          []string                      // subagent detection strategies, in order
+	taskPrompts        *taskPromptCache
+	configRules        []routingRule
+	rules              []routingRule // configRules followed by the enabled rules managed through the API
+	storedRules        []model.RoutingRule
+	canary             *canaryRules // candidate rules tried on part of traffic, if any
+	rulesMu            sync.RWMutex // guards the routing config that changes at runtime: rules, storedRules, canary and users
+	onConfigChange     func()
+	experiments        []experiment
+	mappingCanaries    map[string]*experiment // agentName -> split between the requested and the mapped model
+	users              []userPolicy
+	tiers              map[string]string // model family -> target model
+	healthFallbacks    map[string]string // provider -> model to use while it is unavailable
+	contextPolicies    map[string]contextPolicy
+	quotas             *QuotaLimiter
+	budget             *BudgetTracker
+	burn               *burnRateMeter
+	window             *usageWindowTracker
+	rateLimits         *rateLimitTracker
+	access             *modelAccess
+	hook               *routingHook
+	slaTargets         model.SLATargets
 	logger             *log.Logger
 }
 
@@ -38,9 +90,17 @@ type providerPattern struct {
 // Order matters - first match wins.
 var providerPatterns = []providerPattern{
 	{"gpt-", "openai"},
-	{"o1", "openai"},  // o1, o1-mini, o1-pro
-	{"o3", "openai"},  // o3, o3-mini, o3-pro
+	{"o1", "openai"}, // o1, o1-mini, o1-pro
+	{"o3", "openai"}, // o3, o3-mini, o3-pro
 	{"claude-", "anthropic"},
+	{provider.OllamaModelPrefix, "ollama"},
+	{provider.LMStudioModelPrefix, "lmstudio"},
+	{provider.LlamaCppModelPrefix, "llamacpp"},
+	{provider.HuggingFaceModelPrefix, "huggingface"},
+	{"command-", "cohere"}, // command-r, command-r-plus, command-a
+	{provider.CohereModelPrefix, "cohere"},
+	{"sonar", "perplexity"}, // sonar, sonar-pro, sonar-reasoning-pro, sonar-deep-research
+	{provider.PerplexityModelPrefix, "perplexity"},
 }
 
 type SubagentDefinition struct {
@@ -48,15 +108,129 @@ type SubagentDefinition struct {
 	TargetModel    string
 	TargetProvider string
 	FullPrompt     string // Store for debugging
+	// AgentName is the name in the agent file's frontmatter, which is what
+	// Claude Code's Task tool calls subagent_type
+	AgentName string
 }
 
 func NewModelRouter(cfg *config.Config, providers map[string]provider.Provider, logger *log.Logger) *ModelRouter {
 	router := &ModelRouter{
 		config:             cfg,
 		providers:          providers,
-		subagentMappings:   cfg.Subagents.Mappings,
+		subagentMappings:   copyMappings(cfg.Subagents.Mappings),
 		customAgentPrompts: make(map[string]SubagentDefinition),
-		logger:             logger,
+		taskPrompts:        newTaskPromptCache(),
+		quotas:             NewQuotaLimiter(cfg.Quotas),
+		budget:             NewBudgetTracker(cfg.Budget, NewPriceTable(cfg.Pricing)),
+		burn:               newBurnRateMeter(),
+		window:             newUsageWindowTracker(cfg.UsageWindow, logger),
+		rateLimits:         newRateLimitTracker(),
+		healthFallbacks: map[string]string{
+			"ollama": cfg.Providers.Ollama.FallbackModel,
+		},
+		contextPolicies: map[string]contextPolicy{
+			"lmstudio": newContextPolicy(cfg.Providers.LMStudio),
+			"llamacpp": newContextPolicy(cfg.Providers.LlamaCpp),
+		},
+		logger: logger,
+	}
+
+	var accessErrs []error
+	router.access, accessErrs = newModelAccess(cfg.Routing.ModelAccess)
+	for _, err := range accessErrs {
+		logger.Printf("⚠️  %v", err)
+	}
+	var hookErr error
+	if router.hook, hookErr = newRoutingHook(cfg.Routing.Hook); hookErr != nil {
+		logger.Printf("⚠️  %v", hookErr)
+	}
+	if router.hook != nil {
+		logger.Printf("🪝 Routing hook: %s", strings.Join(router.hook.command, " "))
+	}
+	var slaErrs []error
+	router.slaTargets, slaErrs = newSLATargets(cfg.SLA)
+	for _, err := range slaErrs {
+		logger.Printf("⚠️  %v", err)
+	}
+	if router.access.enabled() {
+		logger.Printf("⛔ Model access lists: %d allowed, %d denied pattern(s), denied requests are %sed",
+			len(router.access.allow), len(router.access.deny), router.access.action)
+	}
+
+	var unknown []string
+	router.detection, unknown = compileDetection(cfg.Subagents.Detection)
+	for _, strategy := range unknown {
+		logger.Printf("⚠️  Ignoring unknown subagent detection strategy %q (expected hash, prefix or subagent_type)", strategy)
+	}
+
+	for _, ruleCfg := range cfg.Routing.Rules {
+		rule, err := compileRoutingRule(ruleCfg)
+		if err != nil {
+			logger.Printf("⚠️  Skipping routing rule: %v", err)
+			continue
+		}
+		router.configRules = append(router.configRules, rule)
+	}
+	router.rules = router.configRules
+	if len(router.rules) > 0 {
+		logger.Printf("📐 Loaded %d content routing rule(s)", len(router.rules))
+	}
+
+	for _, userCfg := range cfg.Users {
+		policy, errs := compileUserPolicy(userCfg)
+		for _, err := range errs {
+			logger.Printf("⚠️  %v", err)
+		}
+		if policy.name == "" || len(policy.apiKeys)+len(policy.accounts) == 0 {
+			continue
+		}
+		router.users = append(router.users, policy)
+		logger.Printf("👤 User %s: %d mapping(s), %d tier(s), %d rule(s)", policy.name, len(policy.mappings), len(policy.tiers), len(policy.rules))
+	}
+
+	router.tiers = make(map[string]string)
+	for tier, targetModel := range cfg.Routing.Tiers {
+		tier = strings.ToLower(tier)
+		if !isModelTier(tier) {
+			logger.Printf("⚠️  Skipping unknown model tier %q (expected haiku, sonnet or opus)", tier)
+			continue
+		}
+		if targetModel == "" {
+			continue
+		}
+		router.tiers[tier] = targetModel
+		logger.Printf("🎚️  Tier %s → %s", tier, targetModel)
+	}
+
+	for _, expCfg := range cfg.Experiments {
+		exp, err := compileExperiment(expCfg)
+		if err != nil {
+			logger.Printf("⚠️  Skipping experiment: %v", err)
+			continue
+		}
+		router.experiments = append(router.experiments, exp)
+		logger.Printf("🧪 Experiment %s: %s / %s (%d%% to B)", exp.name, exp.modelA, exp.modelB, exp.split)
+	}
+
+	router.mappingCanaries = make(map[string]*experiment)
+	for agent, percent := range cfg.Subagents.CanaryPercent {
+		if percent < 1 || percent > 100 {
+			logger.Printf("⚠️  Ignoring canary_percent %d of subagent %s, want 1-100", percent, agent)
+			continue
+		}
+		if percent == 100 {
+			continue
+		}
+		router.mappingCanaries[agent] = &experiment{
+			name:   mappingCanaryPrefix + agent,
+			modelB: cfg.Subagents.Mappings[agent],
+			split:  percent,
+		}
+		logger.Printf("🐤 Subagent %s: %d%% of sessions to %s", agent, percent, cfg.Subagents.Mappings[agent])
+	}
+
+	if router.budget.Enabled() {
+		logger.Printf("💸 Budget: $%.2f/day, $%.2f/month (0 = no limit)", cfg.Budget.Daily, cfg.Budget.Monthly)
 	}
 
 	// Only load custom agents if subagents are enabled
@@ -88,43 +262,40 @@ func (r *ModelRouter) extractStaticPrompt(systemPrompt string) string {
 	return strings.TrimSpace(systemPrompt)
 }
 
-func (r *ModelRouter) loadCustomAgents() {
-	for agentName, targetModel := range r.subagentMappings {
-		// Try loading from project level first, then user level
-		paths := []string{
-			fmt.Sprintf(".claude/agents/%s.md", agentName),
-			fmt.Sprintf("%s/.claude/agents/%s.md", os.Getenv("HOME"), agentName),
-		}
-
-		found := false
-		for _, path := range paths {
-			content, err := os.ReadFile(path)
-			if err != nil {
-				continue
-			}
-
-			// Parse agent file: metadata\n---\nsystem prompt
-			parts := strings.Split(string(content), "\n---\n")
+// agentDirs are the directories Claude Code reads agent definitions from,
+// project level first
+func agentDirs() []string {
+	return []string{
+		".claude/agents",
+		filepath.Join(os.Getenv("HOME"), ".claude", "agents"),
+	}
+}
 
-			if len(parts) >= 2 {
-				systemPrompt := strings.TrimSpace(parts[1])
+// loadCustomAgents reads the definitions of the mapped subagents and replaces
+// the prompt hashes requests are matched against
+func (r *ModelRouter) loadCustomAgents() {
+	prompts := make(map[string]SubagentDefinition)
 
-				// Extract only the static part (before "Notes:" if it exists)
-				staticPrompt := r.extractStaticPrompt(systemPrompt)
-				hash := r.hashString(staticPrompt)
+	r.agentsMu.RLock()
+	mappings := copyMappings(r.subagentMappings)
+	r.agentsMu.RUnlock()
+	// Agents only mapped by user policies are loaded without a shared target
+	for _, agentName := range r.userMappedAgents(mappings) {
+		mappings[agentName] = ""
+	}
 
-				// Determine provider for the target model
-				providerName := r.getProviderNameForModel(targetModel)
+	for agentName, targetModel := range mappings {
+		// Try loading from project level first, then user level
+		var paths []string
+		for _, dir := range agentDirs() {
+			paths = append(paths, filepath.Join(dir, agentName+".md"))
+		}
 
-				r.customAgentPrompts[hash] = SubagentDefinition{
-					Name:           agentName,
-					TargetModel:    targetModel,
-					TargetProvider: providerName,
-					FullPrompt:     staticPrompt,
-				}
-				found = true
-				break
-			}
+		definition, found := loadAgentFile(paths, agentName)
+		if !found {
+			// The mapping may use the agent's frontmatter name rather than
+			// its file name
+			definition, found = findAgentByName(agentName)
 		}
 
 		// Log warning if subagent is mapped but definition not found
@@ -133,16 +304,32 @@ func (r *ModelRouter) loadCustomAgents() {
 			for _, path := range paths {
 				r.logger.Printf("      - %s\n", path)
 			}
+			continue
 		}
+
+		// Extract only the static part (before "Notes:" if it exists)
+		definition.FullPrompt = r.extractStaticPrompt(definition.FullPrompt)
+		definition.Name = agentName
+		definition.TargetModel = targetModel
+		definition.TargetProvider = r.getProviderNameForModel(targetModel)
+		prompts[r.hashString(definition.FullPrompt)] = definition
 	}
 
+	r.agentsMu.Lock()
+	r.customAgentPrompts = prompts
+	r.agentsMu.Unlock()
+
 	// Pretty print loaded subagents
-	if len(r.customAgentPrompts) > 0 {
+	if len(prompts) > 0 {
 		r.logger.Println("")
 		r.logger.Println("🤖 Subagent Model Mappings:")
 		r.logger.Println("──────────────────────────────────────")
 
-		for _, def := range r.customAgentPrompts {
+		for _, def := range prompts {
+			if def.TargetModel == "" {
+				r.logger.Printf("   \033[36m%s\033[0m → (per user)", def.Name)
+				continue
+			}
 			r.logger.Printf("   \033[36m%s\033[0m → \033[32m%s\033[0m",
 				def.Name, def.TargetModel)
 		}
@@ -152,57 +339,240 @@ func (r *ModelRouter) loadCustomAgents() {
 	}
 }
 
-// DetermineRoute analyzes the request and returns routing information without modifying the request
+// DetermineRoute analyzes the request and returns routing information. The
+// request is only modified when it has to be trimmed to fit a local model's
+// context window, in which case decision.RequestModified is set.
 func (r *ModelRouter) DetermineRoute(req *model.AnthropicRequest) (*RoutingDecision, error) {
+	return r.DetermineRouteForKey(req, "")
+}
+
+// DetermineRouteForKey is DetermineRoute for a client that authenticated with
+// apiKey, which may put the request under a user policy
+func (r *ModelRouter) DetermineRouteForKey(req *model.AnthropicRequest, apiKey string) (*RoutingDecision, error) {
+	decision, err := r.selectRoute(req, r.userPolicy(apiKey, req))
+	if err != nil {
+		return nil, err
+	}
+	if err := r.applyBudget(decision); err != nil {
+		return nil, err
+	}
+
+	decision = r.applyHealthFallback(decision)
+	if err := r.applyModelAccess(decision); err != nil {
+		return nil, err
+	}
+	if err := r.applyContextLimit(req, decision); err != nil {
+		return nil, err
+	}
+	decision.Explanation.Provider = decision.Provider.Name()
+	return decision, nil
+}
+
+// OverrideRoute sends req to the model and/or provider the client asked for in
+// the override headers, skipping mappings, rules, experiments, budget
+// downgrades, health fallback and overload failover. Without a model the
+// requested one is kept; without a provider it is inferred from the model.
+// Context window limits, budget blocks and the model access lists still apply.
+func (r *ModelRouter) OverrideRoute(req *model.AnthropicRequest, targetModel, providerName string) (*RoutingDecision, error) {
+	var requested []string
+	if targetModel != "" {
+		requested = append(requested, fmt.Sprintf("%s: %s", OverrideModelHeader, targetModel))
+	}
+	if providerName != "" {
+		requested = append(requested, fmt.Sprintf("%s: %s", OverrideProviderHeader, providerName))
+	}
+
+	if targetModel == "" {
+		targetModel = req.Model
+	}
+	if providerName == "" {
+		providerName = r.getProviderNameForModel(targetModel)
+	}
+
+	p := r.providers[providerName]
+	if p == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownProvider, providerName)
+	}
+
+	r.logger.Printf("\033[36m%s\033[0m → \033[32m%s\033[0m (override: %s)",
+		req.Model, targetModel, providerName)
+
+	decision := &RoutingDecision{
+		Provider:      p,
+		OriginalModel: req.Model,
+		TargetModel:   targetModel,
+	}
+	decision.Explanation.Reason = model.RouteReasonOverride
+	decision.Explanation.Detail = "client sent " + strings.Join(requested, ", ")
+
+	if err := r.applyBudget(decision); err != nil {
+		return nil, err
+	}
+	if err := r.applyModelAccess(decision); err != nil {
+		return nil, err
+	}
+	if err := r.applyContextLimit(req, decision); err != nil {
+		return nil, err
+	}
+	decision.Explanation.Provider = decision.Provider.Name()
+	return decision, nil
+}
+
+// selectRoute picks the target model and provider. Subagent mappings take
+// precedence over content rules, then A/B experiments, then size-based routing,
+// then tier remapping and finally the requested model.
+func (r *ModelRouter) selectRoute(req *model.AnthropicRequest, user *userPolicy) (*RoutingDecision, error) {
 	decision := &RoutingDecision{
 		OriginalModel: req.Model,
 		TargetModel:   req.Model, // default to original
 	}
+	if user != nil {
+		decision.Explanation.User = user.name
+	}
 
-	// Check if subagents are enabled
-	if !r.config.Subagents.Enable {
-		// Subagents disabled, use default provider
-		providerName := r.getProviderNameForModel(decision.TargetModel)
-		decision.Provider = r.providers[providerName]
-		if decision.Provider == nil {
-			return nil, fmt.Errorf("no provider found for model %s", decision.TargetModel)
+	// While a routing change is canaried, the sessions in its share of
+	// traffic get the candidate rules
+	r.rulesMu.RLock()
+	rules, canary := r.rules, r.canary
+	r.rulesMu.RUnlock()
+	if canary != nil {
+		decision.Explanation.Canary = canary.assign(req)
+		if decision.Explanation.Canary == model.CanaryArmCanary {
+			rules = canary.rules
 		}
+	}
+
+	if r.hook != nil && r.routeByHook(req, decision) {
 		return decision, nil
 	}
 
-	// Claude Code pattern: Check if we have exactly 2 system messages
-	if len(req.System) == 2 {
+	if r.config.Subagents.Enable {
+		if hash, ok := r.subagentPromptHash(req); ok {
+			decision.Explanation.PromptHash = hash
+		}
+		definition, detail, ok := r.detectSubagent(req, decision.Explanation.PromptHash)
+		if ok && user != nil {
+			if targetModel, mapped := user.mappings[definition.Name]; mapped {
+				definition.TargetModel = targetModel
+				definition.TargetProvider = r.getProviderNameForModel(targetModel)
+				detail += fmt.Sprintf(", mapped for user %q", user.name)
+			}
+		}
+		if ok && definition.TargetModel == "" {
+			// Mapped for other users only
+			decision.Explanation.Subagent = definition.Name
+			ok = false
+		}
+		if ok {
+			decision.Explanation.Reason = model.RouteReasonSubagent
+			decision.Explanation.Subagent = definition.Name
+			decision.Explanation.Detail = detail
 
-		// First should be "You are Claude Code..."
-		if strings.Contains(req.System[0].Text, "You are Claude Code") {
-			// Second message could be either:
-			// 1. A regular Claude Code prompt (no Notes: section)
-			// 2. A subagent prompt (may have Notes: section)
+			if canary := r.mappingCanary(definition); canary != nil {
+				arm, _ := canary.assign(sessionKey(req))
+				decision.Experiment = canary.name
+				decision.ExperimentArm = arm
+				if arm == ArmA {
+					r.logger.Printf("\033[36m%s\033[0m → \033[32m%s\033[0m (subagent %s canary, arm a)",
+						req.Model, req.Model, definition.Name)
+					decision.Explanation.Detail += fmt.Sprintf("; canary at %d%% kept the requested model", canary.split)
+					decision.Provider = r.providers[r.getProviderNameForModel(req.Model)]
+					if decision.Provider == nil {
+						return nil, fmt.Errorf("no provider found for model %s", req.Model)
+					}
+					return decision, nil
+				}
+				decision.Explanation.Detail += fmt.Sprintf("; canary at %d%% sent it to the mapped model", canary.split)
+			}
 
-			fullPrompt := req.System[1].Text
+			r.logger.Printf("\033[36m%s\033[0m → \033[32m%s\033[0m",
+				req.Model, definition.TargetModel)
+			decision.TargetModel = definition.TargetModel
+			decision.Provider = r.providers[definition.TargetProvider]
+			if decision.Provider == nil {
+				return nil, fmt.Errorf("provider %s not found for model %s",
+					definition.TargetProvider, definition.TargetModel)
+			}
 
-			// Extract static portion (before "Notes:" if it exists)
-			staticPrompt := r.extractStaticPrompt(fullPrompt)
-			promptHash := r.hashString(staticPrompt)
+			return decision, nil
+		}
+	}
 
-			// Check if this matches a known custom agent
-			if definition, exists := r.customAgentPrompts[promptHash]; exists {
-				r.logger.Printf("\033[36m%s\033[0m → \033[32m%s\033[0m",
-					req.Model, definition.TargetModel)
+	if user != nil {
+		rules = append(append([]routingRule(nil), user.rules...), rules...)
+	}
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.matches(req) {
+			continue
+		}
 
-				decision.TargetModel = definition.TargetModel
-				decision.Provider = r.providers[definition.TargetProvider]
-				if decision.Provider == nil {
-					return nil, fmt.Errorf("provider %s not found for model %s",
-						definition.TargetProvider, definition.TargetModel)
-				}
+		r.logger.Printf("\033[36m%s\033[0m → \033[32m%s\033[0m (rule: %s)",
+			req.Model, rule.targetModel, rule.name)
 
-				return decision, nil
-			}
+		providerName := rule.provider
+		if providerName == "" {
+			providerName = r.getProviderNameForModel(rule.targetModel)
+		}
+
+		decision.Explanation.Reason = model.RouteReasonRule
+		decision.Explanation.Rule = rule.name
+		decision.Explanation.Detail = fmt.Sprintf("content matches rule %q", rule.name)
+		decision.TargetModel = rule.targetModel
+		decision.Provider = r.providers[providerName]
+		if decision.Provider == nil {
+			return nil, fmt.Errorf("provider %s not found for rule %s", providerName, rule.name)
 		}
+
+		return decision, nil
 	}
 
-	// Default: use the original model and its provider
+	for i := range r.experiments {
+		exp := &r.experiments[i]
+		if !exp.applies(req) {
+			continue
+		}
+
+		arm, armModel := exp.assign(sessionKey(req))
+		r.logger.Printf("\033[36m%s\033[0m → \033[32m%s\033[0m (experiment: %s, arm %s)",
+			req.Model, armModel, exp.name, arm)
+
+		decision.Explanation.Reason = model.RouteReasonExperiment
+		decision.Explanation.Detail = fmt.Sprintf("experiment %q assigned arm %s", exp.name, arm)
+		decision.TargetModel = armModel
+		decision.Experiment = exp.name
+		decision.ExperimentArm = arm
+		decision.Provider = r.providers[r.getProviderNameForModel(armModel)]
+		if decision.Provider == nil {
+			return nil, fmt.Errorf("no provider found for model %s in experiment %s", armModel, exp.name)
+		}
+
+		return decision, nil
+	}
+
+	decision.Explanation.Reason = model.RouteReasonDefault
+	decision.Explanation.Detail = "no mapping or rule matched, using the requested model"
+	if decision.Explanation.Subagent != "" {
+		decision.Explanation.Detail = fmt.Sprintf("agent %q isn't mapped for this user, using the requested model", decision.Explanation.Subagent)
+	} else if decision.Explanation.PromptHash != "" {
+		decision.Explanation.Detail = fmt.Sprintf("subagent prompt hash %s matches no agent, using the requested model", decision.Explanation.PromptHash)
+	}
+
+	if sizeModel, reason := r.routeBySize(req); sizeModel != "" {
+		r.logger.Printf("\033[36m%s\033[0m → \033[32m%s\033[0m (%s)",
+			req.Model, sizeModel, reason)
+		decision.Explanation.Reason = model.RouteReasonSize
+		decision.Explanation.Detail = "estimated size " + reason
+		decision.TargetModel = sizeModel
+	} else if tier, tierModel := r.routeByTier(req.Model, user); tierModel != "" {
+		r.logger.Printf("\033[36m%s\033[0m → \033[32m%s\033[0m (tier: %s)",
+			req.Model, tierModel, tier)
+		decision.Explanation.Reason = model.RouteReasonTier
+		decision.Explanation.Detail = fmt.Sprintf("%s tier is remapped", tier)
+		decision.TargetModel = tierModel
+	}
+
+	// Default: use the target model and its provider
 	providerName := r.getProviderNameForModel(decision.TargetModel)
 	decision.Provider = r.providers[providerName]
 	if decision.Provider == nil {
@@ -212,6 +582,442 @@ func (r *ModelRouter) DetermineRoute(req *model.AnthropicRequest) (*RoutingDecis
 	return decision, nil
 }
 
+// routeBySize returns the model a request should use based on its estimated
+// input tokens, or "" if the size thresholds don't apply
+func (r *ModelRouter) routeBySize(req *model.AnthropicRequest) (string, string) {
+	routing := r.config.Routing
+	if routing.LongContextModel == "" && routing.SmallRequestModel == "" {
+		return "", ""
+	}
+
+	tokens := estimateTokens(req)
+	switch {
+	case routing.LongContextModel != "" && routing.LongContextThreshold > 0 &&
+		tokens >= routing.LongContextThreshold && req.Model != routing.LongContextModel:
+		return routing.LongContextModel, fmt.Sprintf("~%d tokens ≥ %d", tokens, routing.LongContextThreshold)
+	case routing.SmallRequestModel != "" && routing.SmallRequestThreshold > 0 &&
+		tokens <= routing.SmallRequestThreshold && req.Model != routing.SmallRequestModel:
+		return routing.SmallRequestModel, fmt.Sprintf("~%d tokens ≤ %d", tokens, routing.SmallRequestThreshold)
+	}
+	return "", ""
+}
+
+// modelTiers are the Claude model families routing.tiers can remap
+var modelTiers = []string{"haiku", "sonnet", "opus"}
+
+func isModelTier(tier string) bool {
+	for _, t := range modelTiers {
+		if t == tier {
+			return true
+		}
+	}
+	return false
+}
+
+// routeByTier returns the tier of a Claude model and the model it is remapped
+// to, or "" if the model's tier isn't remapped
+func (r *ModelRouter) routeByTier(requestedModel string, user *userPolicy) (string, string) {
+	if len(r.tiers) == 0 && (user == nil || len(user.tiers) == 0) {
+		return "", ""
+	}
+
+	lower := strings.ToLower(requestedModel)
+	if !strings.HasPrefix(lower, "claude") {
+		return "", ""
+	}
+	for _, tier := range modelTiers {
+		if !strings.Contains(lower, tier) {
+			continue
+		}
+		target := r.tiers[tier]
+		if user != nil {
+			if userTarget, ok := user.tiers[tier]; ok {
+				target = userTarget
+			}
+		}
+		if target != "" && target != requestedModel {
+			return tier, target
+		}
+		return "", ""
+	}
+	return "", ""
+}
+
+// applyHealthFallback reroutes away from a provider that reports it cannot serve
+// the target model right now (e.g. a local Ollama box that is down or busy)
+func (r *ModelRouter) applyHealthFallback(decision *RoutingDecision) *RoutingDecision {
+	checker, ok := decision.Provider.(provider.HealthChecker)
+	if !ok {
+		return decision
+	}
+
+	reason := checker.Available(decision.TargetModel)
+	if reason == nil {
+		return decision
+	}
+
+	unavailable := decision.Provider.Name()
+	fallbackModel := r.healthFallbacks[unavailable]
+	if fallbackModel == "" {
+		fallbackModel = decision.OriginalModel
+	}
+
+	fallbackProvider := r.providers[r.getProviderNameForModel(fallbackModel)]
+	if fallbackProvider == nil || fallbackProvider.Name() == unavailable {
+		r.logger.Printf("⚠️  %s unavailable (%v) and no usable fallback, trying anyway", unavailable, reason)
+		return decision
+	}
+
+	r.logger.Printf("⚠️  %s unavailable (%v), falling back \033[36m%s\033[0m → \033[32m%s\033[0m",
+		unavailable, reason, decision.TargetModel, fallbackModel)
+	decision.adjust("%s unavailable (%v), fell back from %s to %s", unavailable, reason, decision.TargetModel, fallbackModel)
+
+	decision.TargetModel = fallbackModel
+	decision.Provider = fallbackProvider
+	return decision
+}
+
+// OverloadFallback returns the route to re-issue a request on after decision's
+// provider answered 429/529, or nil if no (different) fallback is configured
+func (r *ModelRouter) OverloadFallback(decision *RoutingDecision) *RoutingDecision {
+	if decision.Explanation.Reason == model.RouteReasonOverride {
+		return nil
+	}
+
+	fallbackCfg := r.config.Routing.Fallback
+	fallbackModel := fallbackCfg.Models[decision.TargetModel]
+	providerName := ""
+	if fallbackModel == "" {
+		fallbackModel = fallbackCfg.Model
+		providerName = fallbackCfg.Provider
+	}
+	if fallbackModel == "" {
+		return nil
+	}
+
+	if r.access.enabled() && !r.access.allowed(fallbackModel) {
+		return nil
+	}
+
+	fallbackProvider := r.providerFor(fallbackModel, providerName)
+	if fallbackProvider == nil {
+		return nil
+	}
+	if fallbackModel == decision.TargetModel && fallbackProvider.Name() == decision.Provider.Name() {
+		return nil
+	}
+
+	fallback := &RoutingDecision{
+		Provider:        fallbackProvider,
+		OriginalModel:   decision.OriginalModel,
+		TargetModel:     fallbackModel,
+		RequestModified: decision.RequestModified,
+		Explanation:     decision.Explanation,
+	}
+	fallback.Explanation.Adjustments = append([]string(nil), decision.Explanation.Adjustments...)
+	fallback.adjust("%s was overloaded or rate limited, failed over from %s to %s", decision.Provider.Name(), decision.TargetModel, fallbackModel)
+	fallback.Explanation.Provider = fallbackProvider.Name()
+	return fallback
+}
+
+// SetStoredRules applies the rules managed through the API on top of those from
+// config. Enabled content rules are evaluated after the config rules, in order;
+// enabled subagent rules add to, or override, the config mappings.
+func (r *ModelRouter) SetStoredRules(stored []model.RoutingRule) {
+	rules, mappings := r.compileStoredRules(stored)
+
+	r.rulesMu.Lock()
+	r.rules = rules
+	r.storedRules = stored
+	r.canary = nil
+	r.rulesMu.Unlock()
+
+	r.setMappings(mappings)
+	r.configChanged()
+}
+
+// compileStoredRules returns the content rules and subagent mappings that
+// result from adding stored to the config
+func (r *ModelRouter) compileStoredRules(stored []model.RoutingRule) ([]routingRule, map[string]string) {
+	rules := append([]routingRule(nil), r.configRules...)
+	mappings := copyMappings(r.config.Subagents.Mappings)
+
+	for _, storedRule := range stored {
+		if !storedRule.Enabled {
+			continue
+		}
+		if storedRule.Subagent != "" {
+			mappings[storedRule.Subagent] = storedRule.TargetModel
+			continue
+		}
+
+		rule, err := compileRoutingRule(ruleConfig(storedRule))
+		if err != nil {
+			r.logger.Printf("⚠️  Skipping routing rule: %v", err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules, mappings
+}
+
+// setMappings replaces the subagent mappings, reloading the agent definitions
+// if they changed
+func (r *ModelRouter) setMappings(mappings map[string]string) {
+	r.agentsMu.Lock()
+	changed := !reflect.DeepEqual(r.subagentMappings, mappings)
+	r.subagentMappings = mappings
+	r.agentsMu.Unlock()
+
+	if changed && r.config.Subagents.Enable {
+		r.loadCustomAgents()
+	}
+}
+
+// OnConfigChange registers fn to be called after the routing configuration
+// changes at runtime. It must be set before the router is in use.
+func (r *ModelRouter) OnConfigChange(fn func()) {
+	r.onConfigChange = fn
+}
+
+func (r *ModelRouter) configChanged() {
+	if r.onConfigChange != nil {
+		r.onConfigChange()
+	}
+}
+
+// EffectiveConfig describes the routing configuration in force right now.
+// Timestamps are left out of rules so that only changes to what they do count.
+func (r *ModelRouter) EffectiveConfig() *model.EffectiveConfig {
+	cfg := &model.EffectiveConfig{
+		SubagentsEnabled:      r.config.Subagents.Enable,
+		SubagentDetection:     r.detection,
+		Experiments:           r.Experiments(),
+		Tiers:                 r.tiers,
+		SmallRequestModel:     r.config.Routing.SmallRequestModel,
+		SmallRequestThreshold: r.config.Routing.SmallRequestThreshold,
+		FallbackModel:         r.config.Routing.Fallback.Model,
+		FallbackModels:        r.config.Routing.Fallback.Models,
+		HealthFallbacks:       make(map[string]string),
+	}
+	for providerName, fallbackModel := range r.healthFallbacks {
+		if fallbackModel != "" {
+			cfg.HealthFallbacks[providerName] = fallbackModel
+		}
+	}
+
+	r.agentsMu.RLock()
+	hashes := make(map[string]string, len(r.customAgentPrompts))
+	for hash, definition := range r.customAgentPrompts {
+		hashes[definition.Name] = hash
+	}
+	for agent, targetModel := range r.subagentMappings {
+		mapping := model.AgentMapping{Agent: agent, TargetModel: targetModel, PromptHash: hashes[agent]}
+		if canary := r.mappingCanaries[agent]; canary != nil && canary.modelB == targetModel {
+			mapping.CanaryPercent = canary.split
+		}
+		cfg.Agents = append(cfg.Agents, mapping)
+	}
+	r.agentsMu.RUnlock()
+	sort.Slice(cfg.Agents, func(i, j int) bool { return cfg.Agents[i].Agent < cfg.Agents[j].Agent })
+
+	r.rulesMu.RLock()
+	stored, canary := r.storedRules, r.canary
+	r.rulesMu.RUnlock()
+	cfg.Rules = append(contentRules(r.ConfigRoutingRules()), contentRules(stored)...)
+	if canary != nil {
+		cfg.CanaryRules = contentRules(canary.stored)
+		cfg.CanaryPercent = canary.percent
+	}
+	if r.hook != nil {
+		cfg.RoutingHook = r.hook.command
+	}
+	for i := range r.users {
+		cfg.Users = append(cfg.Users, r.users[i].routing())
+	}
+
+	return cfg
+}
+
+// ValidateRoutingRule checks a rule submitted through the API
+func (r *ModelRouter) ValidateRoutingRule(rule model.RoutingRule) error {
+	if rule.Provider != "" && r.providers[rule.Provider] == nil {
+		return fmt.Errorf("rule %q has unknown provider %q", rule.Name, rule.Provider)
+	}
+
+	if rule.Subagent == "" {
+		_, err := compileRoutingRule(ruleConfig(rule))
+		return err
+	}
+
+	if rule.TargetModel == "" {
+		return fmt.Errorf("rule %q has no target model", rule.Name)
+	}
+	if len(rule.Keywords) > 0 || rule.Pattern != "" || rule.Provider != "" {
+		return fmt.Errorf("subagent rule %q can't have keywords, a pattern or a provider", rule.Name)
+	}
+	return nil
+}
+
+// ConfigRoutingRules lists the subagent mappings and content rules from config
+// in the same shape as rules managed through the API
+func (r *ModelRouter) ConfigRoutingRules() []model.RoutingRule {
+	var rules []model.RoutingRule
+
+	agents := make([]string, 0, len(r.config.Subagents.Mappings))
+	for agent := range r.config.Subagents.Mappings {
+		agents = append(agents, agent)
+	}
+	sort.Strings(agents)
+	for _, agent := range agents {
+		rules = append(rules, model.RoutingRule{
+			ID:          "config-subagent-" + agent,
+			Name:        agent,
+			Subagent:    agent,
+			TargetModel: r.config.Subagents.Mappings[agent],
+			Enabled:     r.config.Subagents.Enable,
+			Source:      model.RuleSourceConfig,
+		})
+	}
+
+	for i, ruleCfg := range r.config.Routing.Rules {
+		rules = append(rules, model.RoutingRule{
+			ID:          fmt.Sprintf("config-rule-%d", i),
+			Name:        ruleCfg.Name,
+			Keywords:    ruleCfg.Keywords,
+			Pattern:     ruleCfg.Pattern,
+			Scope:       ruleCfg.Scope,
+			Models:      ruleCfg.Models,
+			TargetModel: ruleCfg.TargetModel,
+			Provider:    ruleCfg.Provider,
+			Enabled:     true,
+			Position:    i,
+			Source:      model.RuleSourceConfig,
+		})
+	}
+
+	return rules
+}
+
+func copyMappings(mappings map[string]string) map[string]string {
+	copied := make(map[string]string, len(mappings))
+	for agent, targetModel := range mappings {
+		copied[agent] = targetModel
+	}
+	return copied
+}
+
+// Experiments describes the configured A/B experiments (without arm stats)
+func (r *ModelRouter) Experiments() []model.ExperimentStats {
+	experiments := make([]model.ExperimentStats, 0, len(r.experiments))
+	for _, exp := range r.experiments {
+		experiments = append(experiments, model.ExperimentStats{
+			Name:   exp.name,
+			ModelA: exp.modelA,
+			ModelB: exp.modelB,
+			Split:  exp.split,
+		})
+	}
+	agents := make([]string, 0, len(r.mappingCanaries))
+	for agent := range r.mappingCanaries {
+		agents = append(agents, agent)
+	}
+	sort.Strings(agents)
+	for _, agent := range agents {
+		canary := r.mappingCanaries[agent]
+		experiments = append(experiments, model.ExperimentStats{
+			Name:     canary.name,
+			Subagent: agent,
+			ModelB:   canary.modelB,
+			Split:    canary.split,
+		})
+	}
+	return experiments
+}
+
+// mappingCanary returns the canary of a subagent mapping from config.yaml, or
+// nil if the mapping is fully rolled out. A mapping made through the API
+// replaces the config one along with its canary.
+func (r *ModelRouter) mappingCanary(definition SubagentDefinition) *experiment {
+	canary := r.mappingCanaries[definition.Name]
+	if canary == nil || canary.modelB != definition.TargetModel {
+		return nil
+	}
+	return canary
+}
+
+// ProviderHealth reports the state of every provider that monitors its own health
+func (r *ModelRouter) ProviderHealth() []model.ProviderHealth {
+	var health []model.ProviderHealth
+	for _, p := range r.providers {
+		if checker, ok := p.(provider.HealthChecker); ok {
+			health = append(health, checker.Health())
+		}
+	}
+	sort.Slice(health, func(i, j int) bool {
+		return health[i].Provider < health[j].Provider
+	})
+	return health
+}
+
+// KeyUsage reports per-key usage for providers that rotate API keys
+func (r *ModelRouter) KeyUsage() []model.APIKeyUsage {
+	var usage []model.APIKeyUsage
+	for _, p := range r.providers {
+		if balancer, ok := p.(provider.KeyBalancer); ok {
+			usage = append(usage, balancer.KeyUsage()...)
+		}
+	}
+	sort.SliceStable(usage, func(i, j int) bool {
+		return usage[i].Provider < usage[j].Provider
+	})
+	return usage
+}
+
+// matchSubagent finds the mapped agent a request comes from, using the
+// configured detection strategies
+func (r *ModelRouter) matchSubagent(req *model.AnthropicRequest) (SubagentDefinition, bool) {
+	hash, _ := r.subagentPromptHash(req)
+	definition, _, ok := r.detectSubagent(req, hash)
+	return definition, ok
+}
+
+// subagentPromptHash hashes the static part of the second system message if
+// the request has the Claude Code subagent shape
+func (r *ModelRouter) subagentPromptHash(req *model.AnthropicRequest) (string, bool) {
+	if len(req.System) != 2 || !strings.Contains(req.System[0].Text, "You are Claude Code") {
+		return "", false
+	}
+
+	// Second message could be either:
+	// 1. A regular Claude Code prompt (no Notes: section)
+	// 2. A subagent prompt (may have Notes: section)
+	staticPrompt := r.extractStaticPrompt(req.System[1].Text)
+	return r.hashString(staticPrompt), true
+}
+
+func (r *ModelRouter) agentForHash(hash string) (SubagentDefinition, bool) {
+	r.agentsMu.RLock()
+	defer r.agentsMu.RUnlock()
+	definition, exists := r.customAgentPrompts[hash]
+	return definition, exists
+}
+
+// AcquireQuota enforces the request-count quota and concurrency cap of the
+// provider chosen by routing. The returned func frees the concurrency slot and
+// must be called once the request is done.
+func (r *ModelRouter) AcquireQuota(ctx context.Context, decision *RoutingDecision) (func(), error) {
+	if err := r.quotas.Acquire(ctx, decision.Provider.Name()); err != nil {
+		return nil, err
+	}
+	return r.quotas.AcquireSlot(ctx, decision.Provider.Name(), decision.Explanation.Priority)
+}
+
+// QuotaStatus reports usage against every configured provider quota
+func (r *ModelRouter) QuotaStatus() []model.QuotaStatus {
+	return r.quotas.Status()
+}
+
 func (r *ModelRouter) hashString(s string) string {
 	h := sha256.New()
 	h.Write([]byte(s))
@@ -220,6 +1026,19 @@ func (r *ModelRouter) hashString(s string) string {
 	return shortHash
 }
 
+// providerFor returns the provider named providerName, or the one inferred from
+// model when no name is given. It logs and returns nil if there is none.
+func (r *ModelRouter) providerFor(model, providerName string) provider.Provider {
+	if providerName == "" {
+		providerName = r.getProviderNameForModel(model)
+	}
+	p := r.providers[providerName]
+	if p == nil {
+		r.logger.Printf("⚠️  Provider %s not found for model %s", providerName, model)
+	}
+	return p
+}
+
 func (r *ModelRouter) getProviderNameForModel(model string) string {
 	for _, pattern := range providerPatterns {
 		if strings.HasPrefix(model, pattern.prefix) {
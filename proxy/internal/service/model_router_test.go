@@ -1,8 +1,14 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/seifghazi/claude-code-monitor/internal/config"
@@ -130,6 +136,722 @@ func TestModelRouter_ExtractStaticPrompt(t *testing.T) {
 	}
 }
 
+func TestModelRouter_ContentRules(t *testing.T) {
+	cfg := &config.Config{
+		Routing: config.RoutingConfig{
+			Rules: []config.RoutingRuleConfig{
+				{Name: "tests", Keywords: []string{"write unit tests"}, TargetModel: "gpt-4o-mini"},
+				{Name: "docs", Pattern: `(?i)\bdocstrings?\b`, TargetModel: "claude-3-5-haiku-20241022"},
+				{Name: "opus-only", Keywords: []string{"refactor"}, Models: []string{"opus"}, TargetModel: "o3"},
+				{Name: "broken", Pattern: "("},
+			},
+		},
+	}
+
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+		"openai":    &stubProvider{name: "openai"},
+	}
+	router := NewModelRouter(cfg, providers, log.New(os.Stdout, "test: ", log.LstdFlags))
+
+	if len(router.rules) != 3 {
+		t.Fatalf("expected invalid rule to be skipped, got %d rules", len(router.rules))
+	}
+
+	userMessage := func(modelName, text string) *model.AnthropicRequest {
+		return &model.AnthropicRequest{
+			Model:    modelName,
+			Messages: []model.AnthropicMessage{{Role: "user", Content: text}},
+		}
+	}
+
+	tests := []struct {
+		name             string
+		request          *model.AnthropicRequest
+		expectedModel    string
+		expectedProvider string
+	}{
+		{"Keyword match is case-insensitive", userMessage("claude-sonnet-4", "Please WRITE UNIT TESTS for foo"), "gpt-4o-mini", "openai"},
+		{"Pattern match", userMessage("claude-sonnet-4", "add docstrings everywhere"), "claude-3-5-haiku-20241022", "anthropic"},
+		{"Model filter excludes", userMessage("claude-sonnet-4", "refactor this"), "claude-sonnet-4", "anthropic"},
+		{"Model filter includes", userMessage("claude-opus-4", "refactor this"), "o3", "openai"},
+		{"No match keeps original", userMessage("claude-sonnet-4", "hello"), "claude-sonnet-4", "anthropic"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := router.DetermineRoute(tt.request)
+			if err != nil {
+				t.Fatalf("DetermineRoute() returned error: %v", err)
+			}
+			if decision.TargetModel != tt.expectedModel {
+				t.Errorf("TargetModel = %q, want %q", decision.TargetModel, tt.expectedModel)
+			}
+			if decision.Provider.Name() != tt.expectedProvider {
+				t.Errorf("Provider = %q, want %q", decision.Provider.Name(), tt.expectedProvider)
+			}
+		})
+	}
+}
+
+func TestModelRouter_StoredRules(t *testing.T) {
+	cfg := &config.Config{
+		Routing: config.RoutingConfig{
+			Rules: []config.RoutingRuleConfig{
+				{Name: "tests", Keywords: []string{"write unit tests"}, TargetModel: "gpt-4o-mini"},
+			},
+		},
+		Subagents: config.SubagentsConfig{
+			Mappings: map[string]string{"reviewer": "gpt-4o"},
+		},
+	}
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+		"openai":    &stubProvider{name: "openai"},
+	}
+	router := NewModelRouter(cfg, providers, log.New(os.Stdout, "test: ", log.LstdFlags))
+
+	router.SetStoredRules([]model.RoutingRule{
+		{Name: "shadowed", Keywords: []string{"unit tests"}, TargetModel: "o3", Enabled: true},
+		{Name: "docs", Keywords: []string{"docstring"}, TargetModel: "gpt-4o", Enabled: true},
+		{Name: "off", Keywords: []string{"hello"}, TargetModel: "o3", Enabled: false},
+		{Name: "broken", Pattern: "(", TargetModel: "o3", Enabled: true},
+		{Name: "planner", Subagent: "planner", TargetModel: "o3", Enabled: true},
+	})
+
+	userMessage := func(text string) *model.AnthropicRequest {
+		return &model.AnthropicRequest{
+			Model:    "claude-sonnet-4",
+			Messages: []model.AnthropicMessage{{Role: "user", Content: text}},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		request       *model.AnthropicRequest
+		expectedModel string
+	}{
+		{"Config rules are evaluated first", userMessage("write unit tests"), "gpt-4o-mini"},
+		{"Stored rule applies", userMessage("add a docstring"), "gpt-4o"},
+		{"Disabled rule is ignored", userMessage("hello"), "claude-sonnet-4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := router.DetermineRoute(tt.request)
+			if err != nil {
+				t.Fatalf("DetermineRoute() returned error: %v", err)
+			}
+			if decision.TargetModel != tt.expectedModel {
+				t.Errorf("TargetModel = %q, want %q", decision.TargetModel, tt.expectedModel)
+			}
+		})
+	}
+
+	if len(router.rules) != 3 {
+		t.Errorf("expected disabled and invalid rules to be skipped, got %d rules", len(router.rules))
+	}
+	if router.subagentMappings["planner"] != "o3" || router.subagentMappings["reviewer"] != "gpt-4o" {
+		t.Errorf("unexpected subagent mappings %v", router.subagentMappings)
+	}
+
+	// Clearing the stored rules restores config
+	router.SetStoredRules(nil)
+	if len(router.rules) != 1 || len(router.subagentMappings) != 1 {
+		t.Errorf("expected only config rules, got %d rules and mappings %v", len(router.rules), router.subagentMappings)
+	}
+
+	if err := router.ValidateRoutingRule(model.RoutingRule{Name: "x", Subagent: "planner"}); err == nil {
+		t.Error("expected subagent rule without a target model to be rejected")
+	}
+	if err := router.ValidateRoutingRule(model.RoutingRule{Name: "x", Keywords: []string{"a"}, TargetModel: "o3", Provider: "nope"}); err == nil {
+		t.Error("expected unknown provider to be rejected")
+	}
+}
+
+func TestModelRouter_SizeRouting(t *testing.T) {
+	cfg := &config.Config{
+		Routing: config.RoutingConfig{
+			Rules: []config.RoutingRuleConfig{
+				{Name: "tests", Keywords: []string{"write unit tests"}, TargetModel: "gpt-4o-mini"},
+			},
+			LongContextModel:      "claude-sonnet-4-1m",
+			LongContextThreshold:  1000,
+			SmallRequestModel:     "claude-3-5-haiku-20241022",
+			SmallRequestThreshold: 50,
+		},
+	}
+
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+		"openai":    &stubProvider{name: "openai"},
+	}
+	router := NewModelRouter(cfg, providers, log.New(os.Stdout, "test: ", log.LstdFlags))
+
+	request := func(text string) *model.AnthropicRequest {
+		return &model.AnthropicRequest{
+			Model:    "claude-sonnet-4",
+			Messages: []model.AnthropicMessage{{Role: "user", Content: text}},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		request       *model.AnthropicRequest
+		expectedModel string
+	}{
+		{"Small request goes to cheap model", request("hi"), "claude-3-5-haiku-20241022"},
+		{"Medium request keeps model", request(strings.Repeat("word ", 200)), "claude-sonnet-4"},
+		{"Large request goes to long-context model", request(strings.Repeat("word ", 1000)), "claude-sonnet-4-1m"},
+		{"Rules take precedence", request("write unit tests"), "gpt-4o-mini"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := router.DetermineRoute(tt.request)
+			if err != nil {
+				t.Fatalf("DetermineRoute() returned error: %v", err)
+			}
+			if decision.TargetModel != tt.expectedModel {
+				t.Errorf("TargetModel = %q, want %q", decision.TargetModel, tt.expectedModel)
+			}
+		})
+	}
+}
+
+func TestModelRouter_Tiers(t *testing.T) {
+	cfg := &config.Config{
+		Routing: config.RoutingConfig{
+			Rules: []config.RoutingRuleConfig{
+				{Name: "tests", Keywords: []string{"write unit tests"}, TargetModel: "claude-sonnet-4"},
+			},
+			Tiers: map[string]string{
+				"haiku":  "gpt-4o-mini",
+				"Opus":   "o3",
+				"sonnet": "",
+				"gpt":    "claude-sonnet-4",
+			},
+		},
+	}
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+		"openai":    &stubProvider{name: "openai"},
+	}
+	router := NewModelRouter(cfg, providers, log.New(os.Stdout, "test: ", log.LstdFlags))
+
+	request := func(modelName, text string) *model.AnthropicRequest {
+		return &model.AnthropicRequest{
+			Model:    modelName,
+			Messages: []model.AnthropicMessage{{Role: "user", Content: text}},
+		}
+	}
+
+	tests := []struct {
+		name             string
+		request          *model.AnthropicRequest
+		expectedModel    string
+		expectedProvider string
+	}{
+		{"Haiku is remapped", request("claude-3-5-haiku-20241022", "hi"), "gpt-4o-mini", "openai"},
+		{"New haiku naming", request("claude-haiku-4-5", "hi"), "gpt-4o-mini", "openai"},
+		{"Tier names are case-insensitive", request("claude-opus-4-1", "hi"), "o3", "openai"},
+		{"Empty target leaves the tier alone", request("claude-sonnet-4", "hi"), "claude-sonnet-4", "anthropic"},
+		{"Unknown tiers are ignored", request("gpt-4o", "hi"), "gpt-4o", "openai"},
+		{"Rules take precedence", request("claude-3-5-haiku-20241022", "write unit tests"), "claude-sonnet-4", "anthropic"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := router.DetermineRoute(tt.request)
+			if err != nil {
+				t.Fatalf("DetermineRoute() returned error: %v", err)
+			}
+			if decision.TargetModel != tt.expectedModel {
+				t.Errorf("TargetModel = %q, want %q", decision.TargetModel, tt.expectedModel)
+			}
+			if decision.Provider.Name() != tt.expectedProvider {
+				t.Errorf("Provider = %q, want %q", decision.Provider.Name(), tt.expectedProvider)
+			}
+		})
+	}
+}
+
+func TestModelRouter_Override(t *testing.T) {
+	cfg := &config.Config{
+		Routing: config.RoutingConfig{
+			Rules: []config.RoutingRuleConfig{
+				{Name: "tests", Keywords: []string{"write unit tests"}, TargetModel: "gpt-4o"},
+			},
+			Fallback: config.FallbackConfig{Model: "gpt-4o"},
+		},
+	}
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+		"openai":    &stubProvider{name: "openai"},
+	}
+	router := NewModelRouter(cfg, providers, log.New(os.Stdout, "test: ", log.LstdFlags))
+
+	tests := []struct {
+		name             string
+		overrideModel    string
+		overrideProvider string
+		expectedModel    string
+		expectedProvider string
+		expectedErr      error
+	}{
+		{"Model only infers the provider", "claude-opus-4", "", "claude-opus-4", "anthropic", nil},
+		{"Provider only keeps the model", "", "openai", "claude-sonnet-4", "openai", nil},
+		{"Model and provider", "my-finetune", "openai", "my-finetune", "openai", nil},
+		{"Unknown provider", "", "ollama", "", "", ErrUnknownProvider},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &model.AnthropicRequest{
+				Model:    "claude-sonnet-4",
+				Messages: []model.AnthropicMessage{{Role: "user", Content: "write unit tests"}},
+			}
+			decision, err := router.OverrideRoute(req, tt.overrideModel, tt.overrideProvider)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("error = %v, want %v", err, tt.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("OverrideRoute() returned error: %v", err)
+			}
+			if decision.TargetModel != tt.expectedModel || decision.Provider.Name() != tt.expectedProvider {
+				t.Errorf("route = %s via %s, want %s via %s",
+					decision.TargetModel, decision.Provider.Name(), tt.expectedModel, tt.expectedProvider)
+			}
+			if decision.Explanation.Reason != model.RouteReasonOverride || decision.Explanation.Provider != tt.expectedProvider {
+				t.Errorf("unexpected explanation %+v", decision.Explanation)
+			}
+			if fallback := router.OverloadFallback(decision); fallback != nil {
+				t.Errorf("expected no failover for an overridden route, got %s", fallback.TargetModel)
+			}
+		})
+	}
+}
+
+func TestModelRouter_Explanation(t *testing.T) {
+	cfg := &config.Config{
+		Routing: config.RoutingConfig{
+			Rules: []config.RoutingRuleConfig{
+				{Name: "tests", Keywords: []string{"write unit tests"}, TargetModel: "gpt-4o-mini"},
+			},
+			SmallRequestModel:     "claude-3-5-haiku-20241022",
+			SmallRequestThreshold: 50,
+			Fallback:              config.FallbackConfig{Model: "gpt-4o"},
+		},
+		Subagents: config.SubagentsConfig{Enable: true},
+	}
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+		"openai":    &stubProvider{name: "openai"},
+	}
+	router := NewModelRouter(cfg, providers, log.New(os.Stdout, "test: ", log.LstdFlags))
+
+	reviewerPrompt := "You review code."
+	router.customAgentPrompts = map[string]SubagentDefinition{
+		router.hashString(reviewerPrompt): {Name: "reviewer", TargetModel: "gpt-4o", TargetProvider: "openai"},
+	}
+
+	request := func(system []string, text string) *model.AnthropicRequest {
+		req := &model.AnthropicRequest{
+			Model:    "claude-sonnet-4",
+			Messages: []model.AnthropicMessage{{Role: "user", Content: text}},
+		}
+		for _, s := range system {
+			req.System = append(req.System, model.AnthropicSystemMessage{Text: s})
+		}
+		return req
+	}
+	long := strings.Repeat("word ", 200)
+
+	tests := []struct {
+		name           string
+		request        *model.AnthropicRequest
+		expectedReason string
+		expectedDetail string
+	}{
+		{"Subagent match", request([]string{"You are Claude Code.", reviewerPrompt}, long), model.RouteReasonSubagent, `matches agent "reviewer"`},
+		{"Subagent hash without agent", request([]string{"You are Claude Code.", "You plan."}, long), model.RouteReasonDefault, "matches no agent"},
+		{"Content rule", request(nil, "write unit tests "+long), model.RouteReasonRule, `rule "tests"`},
+		{"Size", request(nil, "hi"), model.RouteReasonSize, "estimated size"},
+		{"Default", request(nil, long), model.RouteReasonDefault, "no mapping or rule matched"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := router.DetermineRoute(tt.request)
+			if err != nil {
+				t.Fatalf("DetermineRoute() returned error: %v", err)
+			}
+			explanation := decision.Explanation
+			if explanation.Reason != tt.expectedReason {
+				t.Errorf("Reason = %q, want %q", explanation.Reason, tt.expectedReason)
+			}
+			if !strings.Contains(explanation.Detail, tt.expectedDetail) {
+				t.Errorf("Detail = %q, want it to contain %q", explanation.Detail, tt.expectedDetail)
+			}
+			if explanation.Provider != decision.Provider.Name() {
+				t.Errorf("Provider = %q, want %q", explanation.Provider, decision.Provider.Name())
+			}
+			if len(tt.request.System) == 2 && explanation.PromptHash == "" {
+				t.Error("expected the subagent prompt hash to be recorded")
+			}
+		})
+	}
+
+	decision, _ := router.DetermineRoute(request(nil, long))
+	fallback := router.OverloadFallback(decision)
+	if fallback == nil || len(fallback.Explanation.Adjustments) != 1 || fallback.Explanation.Provider != "openai" {
+		t.Fatalf("expected failover to be explained, got %+v", fallback)
+	}
+	if len(decision.Explanation.Adjustments) != 0 {
+		t.Error("failover should not change the original decision's explanation")
+	}
+}
+
+func TestModelRouter_OverloadFallback(t *testing.T) {
+	cfg := &config.Config{
+		Routing: config.RoutingConfig{
+			Fallback: config.FallbackConfig{
+				Model: "gpt-4o",
+				Models: map[string]string{
+					"claude-opus-4": "claude-sonnet-4",
+				},
+			},
+		},
+	}
+
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+		"openai":    &stubProvider{name: "openai"},
+	}
+	router := NewModelRouter(cfg, providers, log.New(os.Stdout, "test: ", log.LstdFlags))
+
+	tests := []struct {
+		name             string
+		targetModel      string
+		providerName     string
+		expectedModel    string
+		expectedProvider string
+	}{
+		{"Per-model fallback", "claude-opus-4", "anthropic", "claude-sonnet-4", "anthropic"},
+		{"Default fallback", "claude-sonnet-4", "anthropic", "gpt-4o", "openai"},
+		{"No fallback to itself", "gpt-4o", "openai", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := &RoutingDecision{
+				Provider:      providers[tt.providerName],
+				OriginalModel: tt.targetModel,
+				TargetModel:   tt.targetModel,
+			}
+
+			fallback := router.OverloadFallback(decision)
+			if tt.expectedModel == "" {
+				if fallback != nil {
+					t.Fatalf("expected no fallback, got %s", fallback.TargetModel)
+				}
+				return
+			}
+			if fallback == nil {
+				t.Fatal("expected a fallback route")
+			}
+			if fallback.TargetModel != tt.expectedModel || fallback.Provider.Name() != tt.expectedProvider {
+				t.Errorf("fallback = %s via %s, want %s via %s",
+					fallback.TargetModel, fallback.Provider.Name(), tt.expectedModel, tt.expectedProvider)
+			}
+			if fallback.OriginalModel != tt.targetModel {
+				t.Errorf("OriginalModel = %q, want %q", fallback.OriginalModel, tt.targetModel)
+			}
+		})
+	}
+}
+
+func TestModelRouter_Experiments(t *testing.T) {
+	cfg := &config.Config{
+		Experiments: []config.ExperimentConfig{
+			{Name: "sonnet-vs-gpt", Models: []string{"sonnet"}, ModelA: "claude-sonnet-4", ModelB: "gpt-4o", Split: 30},
+			{Name: "invalid", ModelA: "claude-sonnet-4"},
+		},
+	}
+
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+		"openai":    &stubProvider{name: "openai"},
+	}
+	router := NewModelRouter(cfg, providers, log.New(io.Discard, "", 0))
+
+	if len(router.experiments) != 1 {
+		t.Fatalf("expected invalid experiment to be skipped, got %d", len(router.experiments))
+	}
+
+	request := func(modelName, session string) *model.AnthropicRequest {
+		return &model.AnthropicRequest{
+			Model:    modelName,
+			Metadata: &model.RequestMetadata{UserID: "user_abc_account_def_session_" + session},
+			Messages: []model.AnthropicMessage{{Role: "user", Content: "hello"}},
+		}
+	}
+
+	armB := 0
+	for i := 0; i < 1000; i++ {
+		session := fmt.Sprintf("session-%d", i)
+		first, err := router.DetermineRoute(request("claude-sonnet-4", session))
+		if err != nil {
+			t.Fatalf("DetermineRoute() returned error: %v", err)
+		}
+		second, _ := router.DetermineRoute(request("claude-sonnet-4", session))
+		if first.ExperimentArm != second.ExperimentArm {
+			t.Fatalf("session %s switched arms between requests", session)
+		}
+		if first.Experiment != "sonnet-vs-gpt" {
+			t.Fatalf("Experiment = %q", first.Experiment)
+		}
+
+		switch first.ExperimentArm {
+		case ArmB:
+			armB++
+			if first.TargetModel != "gpt-4o" || first.Provider.Name() != "openai" {
+				t.Errorf("arm B routed to %s via %s", first.TargetModel, first.Provider.Name())
+			}
+		case ArmA:
+			if first.TargetModel != "claude-sonnet-4" {
+				t.Errorf("arm A routed to %s", first.TargetModel)
+			}
+		}
+	}
+	if armB < 250 || armB > 350 {
+		t.Errorf("expected ~30%% of sessions in arm B, got %d/1000", armB)
+	}
+
+	decision, _ := router.DetermineRoute(request("claude-opus-4", "x"))
+	if decision.Experiment != "" {
+		t.Errorf("expected opus requests to be outside the experiment, got %q", decision.Experiment)
+	}
+}
+
+func TestModelRouter_MappingCanary(t *testing.T) {
+	cfg := &config.Config{
+		Subagents: config.SubagentsConfig{
+			Enable:        true,
+			Mappings:      map[string]string{"reviewer": "gpt-4o", "planner": "o3"},
+			CanaryPercent: map[string]int{"reviewer": 10, "planner": 150},
+		},
+	}
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+		"openai":    &stubProvider{name: "openai"},
+	}
+	router := NewModelRouter(cfg, providers, log.New(io.Discard, "", 0))
+
+	reviewerPrompt := "You review code."
+	router.customAgentPrompts = map[string]SubagentDefinition{
+		router.hashString(reviewerPrompt): {Name: "reviewer", TargetModel: "gpt-4o", TargetProvider: "openai"},
+	}
+	if len(router.mappingCanaries) != 1 {
+		t.Fatalf("expected the out of range canary to be ignored, got %d canaries", len(router.mappingCanaries))
+	}
+
+	request := func(session string) *model.AnthropicRequest {
+		return &model.AnthropicRequest{
+			Model:    "claude-sonnet-4",
+			Metadata: &model.RequestMetadata{UserID: "user_abc_account_def_session_" + session},
+			System:   []model.AnthropicSystemMessage{{Text: "You are Claude Code."}, {Text: reviewerPrompt}},
+			Messages: []model.AnthropicMessage{{Role: "user", Content: "review this"}},
+		}
+	}
+
+	canaried := 0
+	for i := 0; i < 1000; i++ {
+		session := fmt.Sprintf("session-%d", i)
+		decision, err := router.DetermineRoute(request(session))
+		if err != nil {
+			t.Fatalf("DetermineRoute() returned error: %v", err)
+		}
+		if decision.Experiment != "subagent:reviewer" || decision.Explanation.Subagent != "reviewer" {
+			t.Fatalf("Experiment = %q, Subagent = %q", decision.Experiment, decision.Explanation.Subagent)
+		}
+		again, _ := router.DetermineRoute(request(session))
+		if again.ExperimentArm != decision.ExperimentArm {
+			t.Fatalf("session %s switched arms between requests", session)
+		}
+
+		switch decision.ExperimentArm {
+		case ArmB:
+			canaried++
+			if decision.TargetModel != "gpt-4o" || decision.Provider.Name() != "openai" {
+				t.Errorf("canary arm routed to %s via %s", decision.TargetModel, decision.Provider.Name())
+			}
+		case ArmA:
+			if decision.TargetModel != "claude-sonnet-4" || decision.Provider.Name() != "anthropic" {
+				t.Errorf("baseline arm routed to %s via %s", decision.TargetModel, decision.Provider.Name())
+			}
+		}
+	}
+	if canaried < 60 || canaried > 140 {
+		t.Errorf("expected ~10%% of sessions on the mapped model, got %d/1000", canaried)
+	}
+
+	experiments := router.Experiments()
+	if len(experiments) != 1 || experiments[0].Subagent != "reviewer" || experiments[0].ModelB != "gpt-4o" || experiments[0].Split != 10 {
+		t.Errorf("Experiments() = %+v", experiments)
+	}
+
+	// A mapping changed through the API replaces the canaried one
+	router.setMappings(map[string]string{"reviewer": "claude-opus-4"})
+	router.customAgentPrompts = map[string]SubagentDefinition{
+		router.hashString(reviewerPrompt): {Name: "reviewer", TargetModel: "claude-opus-4", TargetProvider: "anthropic"},
+	}
+	decision, _ := router.DetermineRoute(request("session-0"))
+	if decision.Experiment != "" || decision.TargetModel != "claude-opus-4" {
+		t.Errorf("routed to %s in %q, want claude-opus-4 without a canary", decision.TargetModel, decision.Experiment)
+	}
+}
+
+func TestSessionKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  *model.AnthropicRequest
+		expected string
+	}{
+		{
+			"Claude Code session",
+			&model.AnthropicRequest{Metadata: &model.RequestMetadata{UserID: "user_1a2b_account_3c4d_session_5e6f"}},
+			"5e6f",
+		},
+		{
+			"Other user id",
+			&model.AnthropicRequest{Metadata: &model.RequestMetadata{UserID: "alice"}},
+			"alice",
+		},
+		{
+			"First user message",
+			&model.AnthropicRequest{Messages: []model.AnthropicMessage{
+				{Role: "user", Content: "start"},
+				{Role: "assistant", Content: "ok"},
+				{Role: "user", Content: "more"},
+			}},
+			"start",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sessionKey(tt.request); got != tt.expected {
+				t.Errorf("sessionKey() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestModelRouter_ContextLimit(t *testing.T) {
+	cfg := &config.Config{
+		Providers: config.ProvidersConfig{
+			LMStudio: config.LocalProviderConfig{Overflow: OverflowTrim},
+			LlamaCpp: config.LocalProviderConfig{Overflow: OverflowFallback, FallbackModel: "claude-3-5-haiku-20241022"},
+		},
+	}
+
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+		"ollama":    &stubProvider{name: "ollama", contextWindow: 1000},
+		"lmstudio":  &stubProvider{name: "lmstudio", contextWindow: 1000},
+		"llamacpp":  &stubProvider{name: "llamacpp", contextWindow: 1000},
+	}
+	router := NewModelRouter(cfg, providers, log.New(os.Stdout, "test: ", log.LstdFlags))
+
+	// Four turns of ~300 tokens each; only the last turn fits in 1000 tokens
+	conversation := func(modelName string) *model.AnthropicRequest {
+		filler := strings.Repeat("word ", 210)
+		req := &model.AnthropicRequest{Model: modelName, MaxTokens: 4096}
+		for i := 0; i < 4; i++ {
+			req.Messages = append(req.Messages,
+				model.AnthropicMessage{Role: "user", Content: filler},
+				model.AnthropicMessage{Role: "assistant", Content: "ok"},
+			)
+		}
+		req.Messages = append(req.Messages, model.AnthropicMessage{Role: "user", Content: "and now?"})
+		return req
+	}
+
+	t.Run("Small request only clamps max_tokens", func(t *testing.T) {
+		req := &model.AnthropicRequest{
+			Model:     "lmstudio/qwen",
+			MaxTokens: 4096,
+			Messages:  []model.AnthropicMessage{{Role: "user", Content: "hi"}},
+		}
+		decision, err := router.DetermineRoute(req)
+		if err != nil {
+			t.Fatalf("DetermineRoute() returned error: %v", err)
+		}
+		if !decision.RequestModified || req.MaxTokens >= 1000 {
+			t.Errorf("expected max_tokens clamped below the window, got %d", req.MaxTokens)
+		}
+	})
+
+	t.Run("Reject is the default policy", func(t *testing.T) {
+		_, err := router.DetermineRoute(conversation("ollama/llama3"))
+		var overflowErr *ContextOverflowError
+		if !errors.As(err, &overflowErr) {
+			t.Fatalf("expected ContextOverflowError, got %v", err)
+		}
+		if !strings.HasPrefix(overflowErr.Error(), "prompt is too long") {
+			t.Errorf("unexpected message %q", overflowErr.Error())
+		}
+	})
+
+	t.Run("Trim drops whole turns", func(t *testing.T) {
+		req := conversation("lmstudio/qwen")
+		decision, err := router.DetermineRoute(req)
+		if err != nil {
+			t.Fatalf("DetermineRoute() returned error: %v", err)
+		}
+		if !decision.RequestModified {
+			t.Error("expected RequestModified")
+		}
+		if req.Messages[0].Role != "user" || estimateTokens(req)+req.MaxTokens > 1000 {
+			t.Errorf("trimmed request does not fit: %d messages, max_tokens %d", len(req.Messages), req.MaxTokens)
+		}
+		if len(req.Messages) >= 9 {
+			t.Errorf("expected messages to be dropped, still have %d", len(req.Messages))
+		}
+	})
+
+	t.Run("Fallback reroutes", func(t *testing.T) {
+		decision, err := router.DetermineRoute(conversation("llamacpp/any"))
+		if err != nil {
+			t.Fatalf("DetermineRoute() returned error: %v", err)
+		}
+		if decision.TargetModel != "claude-3-5-haiku-20241022" || decision.Provider.Name() != "anthropic" {
+			t.Errorf("expected fallback to anthropic haiku, got %s via %s", decision.TargetModel, decision.Provider.Name())
+		}
+	})
+}
+
+type stubProvider struct {
+	name          string
+	contextWindow int
+}
+
+func (p *stubProvider) Name() string {
+	return p.name
+}
+
+func (p *stubProvider) ContextWindow(model string) int {
+	return p.contextWindow
+}
+
+func (p *stubProvider) ForwardRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	return nil, nil
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
 		(len(s) > 0 && len(substr) > 0 && s[0:len(substr)] == substr) ||
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+const notifyTimeout = 10 * time.Second
+
+// Notifier tells the user when a long request finishes, by webhook and/or
+// desktop notification. Notifications are sent in the background so they
+// never hold up the response.
+type Notifier struct {
+	after      time.Duration
+	webhookURL string
+	desktop    bool
+	client     *http.Client
+	logger     *log.Logger
+	// run starts a desktop notification command; replaced in tests
+	run func(ctx context.Context, name string, args ...string) error
+}
+
+func NewNotifier(cfg config.NotifyConfig, logger *log.Logger) *Notifier {
+	n := &Notifier{
+		webhookURL: cfg.WebhookURL,
+		desktop:    cfg.Desktop,
+		client:     &http.Client{Timeout: notifyTimeout},
+		logger:     logger,
+		run: func(ctx context.Context, name string, args ...string) error {
+			return exec.CommandContext(ctx, name, args...).Run()
+		},
+	}
+	if cfg.After == "" {
+		return n
+	}
+	after, err := time.ParseDuration(cfg.After)
+	if err != nil || after <= 0 {
+		logger.Printf("⚠️  Invalid notification threshold %q, notifications are off", cfg.After)
+		return n
+	}
+	if cfg.WebhookURL == "" && !cfg.Desktop {
+		logger.Printf("⚠️  Notifications need a webhook_url or desktop: true, notifications are off")
+		return n
+	}
+	n.after = after
+	return n
+}
+
+// Enabled reports whether long requests are notified
+func (n *Notifier) Enabled() bool {
+	return n.after > 0
+}
+
+// After returns how long a request must run to be notified
+func (n *Notifier) After() time.Duration {
+	return n.after
+}
+
+// Record notifies about a finished request if it ran long enough
+func (n *Notifier) Record(request *model.RequestLog) {
+	notification, ok := n.notification(request)
+	if !ok {
+		return
+	}
+	go n.send(notification)
+}
+
+// notification describes a finished request, reporting false if it doesn't
+// need one
+func (n *Notifier) notification(request *model.RequestLog) (model.RequestNotification, bool) {
+	if !n.Enabled() || request.Response == nil {
+		return model.RequestNotification{}, false
+	}
+	duration := time.Duration(request.Response.ResponseTime) * time.Millisecond
+	if duration < n.after {
+		return model.RequestNotification{}, false
+	}
+
+	notification := model.RequestNotification{
+		RequestID:  request.RequestID,
+		Model:      request.RoutedModel,
+		StatusCode: request.Response.StatusCode,
+		Duration:   duration.Round(time.Second).String(),
+		StopReason: responseStopReason(request.Response),
+	}
+	if notification.Model == "" {
+		notification.Model = request.Model
+	}
+	if usage := responseUsage(request.Response); usage != nil {
+		notification.InputTokens = usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens
+		notification.OutputTokens = usage.OutputTokens
+	}
+
+	outcome := notification.StopReason
+	if notification.StatusCode >= 400 {
+		outcome = fmt.Sprintf("failed with %d", notification.StatusCode)
+	} else if outcome == "" {
+		outcome = "done"
+	}
+	notification.Text = fmt.Sprintf("%s finished after %s (%s): %d input / %d output tokens",
+		notification.Model, notification.Duration, outcome, notification.InputTokens, notification.OutputTokens)
+	return notification, true
+}
+
+func (n *Notifier) send(notification model.RequestNotification) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	if n.webhookURL != "" {
+		if err := n.postWebhook(ctx, notification); err != nil {
+			n.logger.Printf("⚠️  Failed to send notification: %v", err)
+		}
+	}
+	if n.desktop {
+		if err := n.showDesktop(ctx, notification.Text); err != nil {
+			n.logger.Printf("⚠️  Failed to show desktop notification: %v", err)
+		}
+	}
+	n.logger.Printf("🔔 %s", notification.Text)
+}
+
+func (n *Notifier) postWebhook(ctx context.Context, notification model.RequestNotification) error {
+	return postWebhook(ctx, n.client, n.webhookURL, notification)
+}
+
+// postWebhook posts payload as JSON to a notification webhook
+func postWebhook(ctx context.Context, client *http.Client, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post notification: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (n *Notifier) showDesktop(ctx context.Context, text string) error {
+	const title = "Claude Code Proxy"
+	switch runtime.GOOS {
+	case "linux":
+		return n.run(ctx, "notify-send", title, text)
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(text), appleScriptString(title))
+		return n.run(ctx, "osascript", "-e", script)
+	default:
+		return fmt.Errorf("desktop notifications aren't supported on %s", runtime.GOOS)
+	}
+}
+
+// appleScriptString quotes s as an AppleScript string literal
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// responseStopReason extracts the stop reason from a stored response, if any
+func responseStopReason(resp *model.ResponseLog) string {
+	if resp == nil || len(resp.Body) == 0 {
+		return ""
+	}
+	var body struct {
+		StopReason string `json:"stop_reason"`
+	}
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return ""
+	}
+	return body.StopReason
+}
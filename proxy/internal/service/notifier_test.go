@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestNotifier_Notification(t *testing.T) {
+	notifier := NewNotifier(config.NotifyConfig{After: "2m", WebhookURL: "http://localhost/hook"}, log.New(io.Discard, "", 0))
+
+	finished := func(ms int64, status int, body string) *model.RequestLog {
+		return &model.RequestLog{
+			RequestID:   "req_1",
+			Model:       "claude-opus-4-20250514",
+			RoutedModel: "claude-opus-4-20250514",
+			Response:    &model.ResponseLog{StatusCode: status, ResponseTime: ms, Body: json.RawMessage(body)},
+		}
+	}
+	done := `{"stop_reason":"end_turn","usage":{"input_tokens":1200,"cache_read_input_tokens":800,"output_tokens":4000}}`
+
+	tests := []struct {
+		name         string
+		request      *model.RequestLog
+		expectNotify bool
+		expectedText string
+	}{
+		{"Long request", finished(150000, 200, done), true, "claude-opus-4-20250514 finished after 2m30s (end_turn): 2000 input / 4000 output tokens"},
+		{"Short request", finished(90000, 200, done), false, ""},
+		{"Long failure", finished(130000, 529, `{}`), true, "failed with 529"},
+		{"No response", &model.RequestLog{RequestID: "req_2"}, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notification, ok := notifier.notification(tt.request)
+			if ok != tt.expectNotify {
+				t.Fatalf("notify = %v, want %v", ok, tt.expectNotify)
+			}
+			if ok && !strings.Contains(notification.Text, tt.expectedText) {
+				t.Errorf("Text = %q, want it to contain %q", notification.Text, tt.expectedText)
+			}
+		})
+	}
+
+	disabled := []config.NotifyConfig{
+		{WebhookURL: "http://localhost/hook"},
+		{After: "soon", WebhookURL: "http://localhost/hook"},
+		{After: "2m"},
+	}
+	for _, cfg := range disabled {
+		if NewNotifier(cfg, log.New(io.Discard, "", 0)).Enabled() {
+			t.Errorf("expected notifications to be off for %+v", cfg)
+		}
+	}
+}
+
+func TestNotifier_Send(t *testing.T) {
+	var received model.RequestNotification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	notifier := NewNotifier(config.NotifyConfig{After: "1m", WebhookURL: server.URL, Desktop: true}, log.New(io.Discard, "", 0))
+	var command []string
+	notifier.run = func(ctx context.Context, name string, args ...string) error {
+		command = append([]string{name}, args...)
+		return nil
+	}
+
+	notifier.send(model.RequestNotification{Text: `opus finished "quickly"`, RequestID: "req_1", StopReason: "max_tokens"})
+
+	if received.RequestID != "req_1" || received.Text != `opus finished "quickly"` || received.StopReason != "max_tokens" {
+		t.Errorf("webhook received %+v", received)
+	}
+	switch runtime.GOOS {
+	case "linux":
+		if len(command) != 3 || command[0] != "notify-send" || command[2] != `opus finished "quickly"` {
+			t.Errorf("ran %q", command)
+		}
+	case "darwin":
+		if len(command) != 3 || command[0] != "osascript" || !strings.Contains(command[2], `"opus finished \"quickly\""`) {
+			t.Errorf("ran %q", command)
+		}
+	}
+}
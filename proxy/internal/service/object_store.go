@@ -0,0 +1,217 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+// objectStore is a bucket that archives are written to and read back from
+type objectStore interface {
+	put(ctx context.Context, key string, data []byte, contentType string) error
+	get(ctx context.Context, key string) ([]byte, error)
+}
+
+// s3ObjectStore talks to S3, or any service with its API such as Cloud
+// Storage's interoperability endpoint, signing requests with Signature V4
+type s3ObjectStore struct {
+	client    *http.Client
+	endpoint  *url.URL
+	bucket    string
+	pathStyle bool // bucket in the path rather than the host
+	region    string
+	accessKey string
+	secretKey string
+	now       func() time.Time
+}
+
+// newObjectStore opens the bucket of an s3:// or gs:// URL, returning it and
+// the prefix keys go under
+func newObjectStore(cfg config.ArchiveConfig) (*s3ObjectStore, string, error) {
+	parsed, err := url.Parse(cfg.URL)
+	if err != nil || parsed.Host == "" {
+		return nil, "", fmt.Errorf("invalid archive URL %q, expected s3://bucket/prefix or gs://bucket/prefix", cfg.URL)
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, "", errors.New("archive access key ID and secret access key are required")
+	}
+
+	store := &s3ObjectStore{
+		client:    &http.Client{Timeout: 5 * time.Minute},
+		bucket:    parsed.Host,
+		region:    cfg.Region,
+		accessKey: cfg.AccessKeyID,
+		secretKey: cfg.SecretAccessKey,
+		now:       time.Now,
+	}
+	endpoint := cfg.Endpoint
+	switch parsed.Scheme {
+	case "s3":
+		if store.region == "" {
+			store.region = "us-east-1"
+		}
+		if endpoint == "" {
+			endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", store.bucket, store.region)
+		} else {
+			store.pathStyle = true
+		}
+	case "gs":
+		if store.region == "" {
+			store.region = "auto"
+		}
+		if endpoint == "" {
+			endpoint = "https://storage.googleapis.com"
+		}
+		store.pathStyle = true
+	default:
+		return nil, "", fmt.Errorf("unsupported archive URL scheme %q, expected s3 or gs", parsed.Scheme)
+	}
+	if store.endpoint, err = url.Parse(endpoint); err != nil || store.endpoint.Host == "" {
+		return nil, "", fmt.Errorf("invalid archive endpoint %q", endpoint)
+	}
+
+	return store, strings.Trim(parsed.Path, "/"), nil
+}
+
+func (s *s3ObjectStore) put(ctx context.Context, key string, data []byte, contentType string) error {
+	req, err := s.request(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to upload %s: %s", key, objectStoreError(resp))
+	}
+	return nil
+}
+
+func (s *s3ObjectStore) get(ctx context.Context, key string) ([]byte, error) {
+	req, err := s.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("failed to download %s: %s", key, objectStoreError(resp))
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// request builds a signed request for an object
+func (s *s3ObjectStore) request(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	target := *s.endpoint
+	path := "/" + key
+	if s.pathStyle {
+		path = "/" + s.bucket + path
+	}
+	target.Path = strings.TrimRight(s.endpoint.Path, "/") + path
+	target.RawPath = strings.TrimRight(s.endpoint.EscapedPath(), "/") + s3EscapePath(path)
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	s.sign(req, body)
+	return req, nil
+}
+
+// sign adds AWS Signature Version 4 headers to req
+func (s *s3ObjectStore) sign(req *http.Request, body []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	for _, part := range []string{s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// s3EscapePath escapes each segment of an object path the way Signature V4
+// expects: everything but unreserved characters is percent-encoded
+func s3EscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		var b strings.Builder
+		for _, c := range []byte(segment) {
+			if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+				c == '-' || c == '_' || c == '.' || c == '~' {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, "%%%02X", c)
+			}
+		}
+		segments[i] = b.String()
+	}
+	return strings.Join(segments, "/")
+}
+
+// objectStoreError describes a failed response by its status and the error
+// code in its XML body, if there is one
+func objectStoreError(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if start := bytes.Index(body, []byte("<Code>")); start >= 0 {
+		if end := bytes.Index(body[start:], []byte("</Code>")); end >= 0 {
+			return fmt.Sprintf("%s (%s)", resp.Status, body[start+len("<Code>"):start+end])
+		}
+	}
+	return resp.Status
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
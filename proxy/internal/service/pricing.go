@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+// defaultPrices are list prices in USD per million tokens, keyed by a
+// substring of the model name. Where several keys match, the longest wins, so
+// "opus-4-5" is priced apart from older opus models.
+var defaultPrices = map[string]config.PriceConfig{
+	"opus-4-5":       {Input: 5, Output: 25, CacheRead: 0.5, CacheWrite: 6.25},
+	"opus-4-6":       {Input: 5, Output: 25, CacheRead: 0.5, CacheWrite: 6.25},
+	"opus":           {Input: 15, Output: 75, CacheRead: 1.5, CacheWrite: 18.75},
+	"sonnet":         {Input: 3, Output: 15, CacheRead: 0.3, CacheWrite: 3.75},
+	"haiku-4-5":      {Input: 1, Output: 5, CacheRead: 0.1, CacheWrite: 1.25},
+	"3-5-haiku":      {Input: 0.8, Output: 4, CacheRead: 0.08, CacheWrite: 1},
+	"haiku":          {Input: 0.25, Output: 1.25, CacheRead: 0.03, CacheWrite: 0.3},
+	"gpt-4o-mini":    {Input: 0.15, Output: 0.6, CacheRead: 0.075},
+	"gpt-4o":         {Input: 2.5, Output: 10, CacheRead: 1.25},
+	"gpt-4.1-nano":   {Input: 0.1, Output: 0.4, CacheRead: 0.025},
+	"gpt-4.1-mini":   {Input: 0.4, Output: 1.6, CacheRead: 0.1},
+	"gpt-4.1":        {Input: 2, Output: 8, CacheRead: 0.5},
+	"o1-mini":        {Input: 1.1, Output: 4.4, CacheRead: 0.55},
+	"o1":             {Input: 15, Output: 60, CacheRead: 7.5},
+	"o3-mini":        {Input: 1.1, Output: 4.4, CacheRead: 0.55},
+	"o3":             {Input: 2, Output: 8, CacheRead: 0.5},
+	"command-r-plus": {Input: 2.5, Output: 10},
+	"command-r":      {Input: 0.15, Output: 0.6},
+	"sonar-pro":      {Input: 3, Output: 15},
+	"sonar":          {Input: 1, Output: 1},
+}
+
+// freeModelPrefixes are the models served locally, which cost nothing
+var freeModelPrefixes = []string{
+	provider.OllamaModelPrefix,
+	provider.LMStudioModelPrefix,
+	provider.LlamaCppModelPrefix,
+}
+
+// PriceTable works out what requests cost from their token usage
+type PriceTable struct {
+	mu        sync.RWMutex
+	keys      []string // longest first
+	prices    map[string]config.PriceConfig
+	overrides map[string]config.PriceConfig
+}
+
+// NewPriceTable builds the table from the defaults and the pricing overrides
+// in config
+func NewPriceTable(overrides map[string]config.PriceConfig) *PriceTable {
+	t := &PriceTable{overrides: overrides}
+	t.Refresh(nil)
+	return t
+}
+
+// Refresh rebuilds the table with refreshed prices on top of the defaults,
+// keyed like them; the pricing overrides in config still win
+func (t *PriceTable) Refresh(refreshed map[string]config.PriceConfig) {
+	prices := make(map[string]config.PriceConfig, len(defaultPrices)+len(refreshed)+len(t.overrides))
+	for key, price := range defaultPrices {
+		prices[key] = price
+	}
+	for key, price := range refreshed {
+		prices[strings.ToLower(key)] = price
+	}
+	for key, price := range t.overrides {
+		prices[strings.ToLower(key)] = price
+	}
+
+	keys := make([]string, 0, len(prices))
+	for key := range prices {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.keys, t.prices = keys, prices
+}
+
+// Price returns the price of modelName, and false if it isn't known
+func (t *PriceTable) Price(modelName string) (config.PriceConfig, bool) {
+	for _, prefix := range freeModelPrefixes {
+		if strings.HasPrefix(modelName, prefix) {
+			return config.PriceConfig{}, true
+		}
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	lower := strings.ToLower(modelName)
+	for _, key := range t.keys {
+		if strings.Contains(lower, key) {
+			return t.prices[key], true
+		}
+	}
+	return config.PriceConfig{}, false
+}
+
+// Cost returns what usage on modelName costs in USD, and false if the model's
+// price isn't known
+func (t *PriceTable) Cost(modelName string, usage *model.AnthropicUsage) (float64, bool) {
+	price, ok := t.Price(modelName)
+	if !ok || usage == nil {
+		return 0, ok
+	}
+	return tokenCost(price, int64(usage.InputTokens), int64(usage.OutputTokens),
+		int64(usage.CacheReadInputTokens), int64(usage.CacheCreationInputTokens)), true
+}
+
+func tokenCost(price config.PriceConfig, input, output, cacheRead, cacheWrite int64) float64 {
+	return (float64(input)*price.Input +
+		float64(output)*price.Output +
+		float64(cacheRead)*price.CacheRead +
+		float64(cacheWrite)*price.CacheWrite) / 1e6
+}
+
+// pricingFeedPrice is a price in a pricing feed, in USD per million tokens
+type pricingFeedPrice struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheRead  float64 `json:"cache_read"`
+	CacheWrite float64 `json:"cache_write"`
+}
+
+// NewPricingRefreshTask fetches current prices from the "url" arg, a JSON
+// object of prices keyed by a substring of the model name like the pricing
+// config, and refreshes the table with them. A failed fetch keeps the prices
+// in use.
+func NewPricingRefreshTask(prices *PriceTable) ScheduledTask {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	return func(ctx context.Context, args map[string]string) (string, error) {
+		url := argString(args, "url", "")
+		if url == "" {
+			return "", fmt.Errorf("url is required")
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to create pricing request: %w", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch prices: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return "", fmt.Errorf("pricing feed returned %d", resp.StatusCode)
+		}
+
+		var feed map[string]pricingFeedPrice
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&feed); err != nil {
+			return "", fmt.Errorf("invalid pricing feed: %w", err)
+		}
+		if len(feed) == 0 {
+			return "", fmt.Errorf("pricing feed has no prices")
+		}
+		refreshed := make(map[string]config.PriceConfig, len(feed))
+		for key, price := range feed {
+			if price.Input < 0 || price.Output < 0 || price.CacheRead < 0 || price.CacheWrite < 0 {
+				return "", fmt.Errorf("invalid pricing feed: negative price for %s", key)
+			}
+			refreshed[key] = config.PriceConfig(price)
+		}
+
+		prices.Refresh(refreshed)
+		return fmt.Sprintf("refreshed %d price(s)", len(refreshed)), nil
+	}
+}
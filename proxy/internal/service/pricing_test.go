@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+func TestPricingRefreshTask(t *testing.T) {
+	feed := `{"sonnet": {"input": 4, "output": 20, "cache_read": 0.4, "cache_write": 5}, "claude-next": {"input": 10, "output": 50}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/prices.json":
+			w.Write([]byte(feed))
+		case "/negative.json":
+			w.Write([]byte(`{"sonnet": {"input": -1}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	prices := NewPriceTable(map[string]config.PriceConfig{"claude-next": {Input: 8, Output: 40}})
+	task := NewPricingRefreshTask(prices)
+
+	tests := []struct {
+		name        string
+		url         string
+		expectError bool
+	}{
+		{"No URL", "", true},
+		{"Missing feed", server.URL + "/missing.json", true},
+		{"Negative price", server.URL + "/negative.json", true},
+		{"Feed", server.URL + "/prices.json", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := task(context.Background(), map[string]string{"url": tt.url})
+			if (err != nil) != tt.expectError {
+				t.Fatalf("task() error = %v, want error %v", err, tt.expectError)
+			}
+			sonnet, _ := prices.Price("claude-sonnet-4-20250514")
+			if tt.expectError && sonnet != defaultPrices["sonnet"] {
+				t.Errorf("sonnet price after a failed refresh = %+v, want the one in use kept", sonnet)
+			}
+		})
+	}
+
+	expected := map[string]config.PriceConfig{
+		"claude-sonnet-4-20250514": {Input: 4, Output: 20, CacheRead: 0.4, CacheWrite: 5},
+		// The pricing config still overrides the feed
+		"claude-next-1": {Input: 8, Output: 40},
+		// Models missing from the feed keep their built-in price
+		"claude-opus-4-20250514": defaultPrices["opus"],
+	}
+	for modelName, want := range expected {
+		if price, ok := prices.Price(modelName); !ok || price != want {
+			t.Errorf("Price(%s) = %+v, %v, want %+v", modelName, price, ok, want)
+		}
+	}
+}
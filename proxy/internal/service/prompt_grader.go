@@ -0,0 +1,391 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+// gradingModel is the model prompts are graded with unless another is
+// configured
+const gradingModel = "claude-3-5-sonnet-20240620"
+
+// gradingMaxTokens bounds the grading model's answer unless configured
+const gradingMaxTokens = 2000
+
+// gradeMaxScore is the score of a prompt that meets every criterion
+const gradeMaxScore = 5
+
+// gradingTimeout bounds how long grading one prompt may take
+const gradingTimeout = 2 * time.Minute
+
+// How much of a request is shown to the grading model: the middles of a long
+// system prompt and long messages are left out, and so are all but the latest
+// messages
+const (
+	maxGradedSystemChars  = 4000
+	maxGradedMessageChars = 4000
+	maxGradedMessages     = 20
+)
+
+// maxGradingResponse bounds how much of the grading model's answer is read
+const maxGradingResponse = 1 << 20
+
+// Grading states of a request
+const (
+	GradeStatusUngraded = "ungraded"
+	GradeStatusGrading  = "grading"
+	GradeStatusGraded   = "graded"
+	GradeStatusFailed   = "failed"
+)
+
+var (
+	ErrNothingToGrade  = errors.New("request has no user prompt to grade")
+	ErrAlreadyGrading  = errors.New("request is already being graded")
+	ErrNoGradingModel  = errors.New("no provider for the grading model")
+	errUnreadableGrade = errors.New("grading model didn't answer with a grade")
+)
+
+// defaultGradingCriteria are what prompts are scored on unless others are
+// configured
+var defaultGradingCriteria = []config.GradingCriterion{
+	{Name: "clarity", Description: "the task is stated unambiguously"},
+	{Name: "specificity", Description: "requirements, constraints and the expected result are spelled out"},
+	{Name: "context", Description: "the model is given the code, files and background it needs"},
+	{Name: "structure", Description: "the prompt is organized so what matters stands out"},
+}
+
+// defaultGradingPrompt is the grading instructions unless others are
+// configured
+const defaultGradingPrompt = `You review the prompts developers send to an AI coding assistant and grade how well written they are, so they learn to write better ones. Grade the latest user prompt of the conversation you're given, using the earlier messages only as context.
+
+Score it from 1 to {{.MaxScore}} overall and on each of these criteria:
+{{range .Criteria}}- {{.Name}}: {{.Description}}
+{{end}}
+Answer with only a JSON object, no other text, of this shape:
+{"score": 4, "feedback": "what works and what to improve, in two or three sentences", "improvedPrompt": "the prompt rewritten to score {{.MaxScore}}", "criteria": {"{{(index .Criteria 0).Name}}": {"score": 4, "feedback": "one sentence"}{{range slice .Criteria 1}}, "{{.Name}}": {...}{{end}}}}`
+
+// PromptGrader grades the prompts of stored requests with a model on
+// request, in the background, and stores each grade on its request. While a
+// grade is worked out the request carries one marked as processing; a failed
+// grade keeps the error. A request is graded once at a time.
+type PromptGrader struct {
+	model     string
+	provider  provider.Provider
+	maxTokens int
+	// maxConcurrent caps how many prompts a grading job grades at once
+	maxConcurrent int
+	criteria      []config.GradingCriterion
+	prompt        string // the grading instructions, rendered
+	storage       StorageService
+	logger        *log.Logger
+
+	mu      sync.Mutex
+	grading map[string]bool // IDs of the requests being graded
+}
+
+// NewPromptGrader grades with the model, instructions and criteria cfg sets,
+// or the defaults; it fails on instructions that aren't a valid template
+func NewPromptGrader(cfg config.GradingConfig, router *ModelRouter, storage StorageService, logger *log.Logger) (*PromptGrader, error) {
+	g := &PromptGrader{
+		model:         cfg.Model,
+		maxTokens:     cfg.MaxTokens,
+		maxConcurrent: cfg.MaxConcurrent,
+		storage:       storage,
+		logger:        logger,
+		grading:       make(map[string]bool),
+	}
+	if g.model == "" {
+		g.model = gradingModel
+	}
+	if g.maxTokens <= 0 {
+		g.maxTokens = gradingMaxTokens
+	}
+	for _, criterion := range cfg.Criteria {
+		if name := strings.TrimSpace(criterion.Name); name != "" {
+			g.criteria = append(g.criteria, config.GradingCriterion{Name: name, Description: strings.TrimSpace(criterion.Description)})
+		}
+	}
+	if len(g.criteria) == 0 {
+		g.criteria = defaultGradingCriteria
+	}
+
+	prompt := cfg.Prompt
+	if strings.TrimSpace(prompt) == "" {
+		prompt = defaultGradingPrompt
+	}
+	tmpl, err := template.New("grading").Parse(prompt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid grading prompt: %w", err)
+	}
+	var rendered strings.Builder
+	data := struct {
+		MaxScore int
+		Criteria []config.GradingCriterion
+	}{gradeMaxScore, g.criteria}
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return nil, fmt.Errorf("invalid grading prompt: %w", err)
+	}
+	g.prompt = rendered.String()
+
+	g.provider = router.providerFor(g.model, cfg.Provider)
+	return g, nil
+}
+
+// Model is the model prompts are graded with
+func (g *PromptGrader) Model() string {
+	return g.model
+}
+
+// Grade starts grading a stored request's prompt with the credentials in
+// header, which the provider replaces when it has keys of its own. It returns
+// at once; done is called with the grade once it's stored, unless grading
+// failed.
+func (g *PromptGrader) Grade(request *model.RequestLog, header http.Header, done func(*model.RequestLog, *model.PromptGrade)) error {
+	req, err := g.begin(request)
+	if err != nil {
+		return err
+	}
+	header = gradingCredentials(header)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), gradingTimeout)
+		defer cancel()
+		if grade, err := g.complete(ctx, request, req, header); err == nil && done != nil {
+			done(request, grade)
+		}
+	}()
+	return nil
+}
+
+// gradeNow grades a stored request's prompt like Grade, but waits for the grade
+func (g *PromptGrader) gradeNow(ctx context.Context, request *model.RequestLog, header http.Header) (*model.PromptGrade, error) {
+	req, err := g.begin(request)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, gradingTimeout)
+	defer cancel()
+	return g.complete(ctx, request, req, header)
+}
+
+// begin marks a request as being graded, here and in storage
+func (g *PromptGrader) begin(request *model.RequestLog) (*model.AnthropicRequest, error) {
+	if g.provider == nil {
+		return nil, ErrNoGradingModel
+	}
+	req := requestBody(request)
+	if !hasUserPrompt(req) {
+		return nil, ErrNothingToGrade
+	}
+
+	g.mu.Lock()
+	if g.grading[request.RequestID] {
+		g.mu.Unlock()
+		return nil, ErrAlreadyGrading
+	}
+	g.grading[request.RequestID] = true
+	g.mu.Unlock()
+
+	processing := &model.PromptGrade{MaxScore: gradeMaxScore, IsProcessing: true, GradingTimestamp: time.Now().Format(time.RFC3339)}
+	if err := g.storage.UpdateRequestWithGrading(request.RequestID, processing); err != nil {
+		g.finish(request.RequestID)
+		return nil, err
+	}
+	return req, nil
+}
+
+// complete grades a request begin marked and stores the grade, or why it
+// failed. Grading cancelled through ctx puts back the grade the request had.
+func (g *PromptGrader) complete(ctx context.Context, request *model.RequestLog, req *model.AnthropicRequest, header http.Header) (*model.PromptGrade, error) {
+	defer g.finish(request.RequestID)
+
+	grade, err := g.GradePrompt(ctx, req, header)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		if request.PromptGrade != nil {
+			if err := g.storage.UpdateRequestWithGrading(request.RequestID, request.PromptGrade); err != nil {
+				g.logger.Printf("❌ Error saving grade: %v", err)
+			}
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		g.logger.Printf("⚠️ Grading request %s failed: %v", request.RequestID, err)
+		grade = &model.PromptGrade{MaxScore: gradeMaxScore, Error: err.Error(), GradingTimestamp: time.Now().Format(time.RFC3339)}
+	}
+	if err := g.storage.UpdateRequestWithGrading(request.RequestID, grade); err != nil {
+		g.logger.Printf("❌ Error saving grade: %v", err)
+		return nil, err
+	}
+	return grade, err
+}
+
+func (g *PromptGrader) finish(requestID string) {
+	g.mu.Lock()
+	delete(g.grading, requestID)
+	g.mu.Unlock()
+}
+
+// Status says where a stored request is in being graded. A grade left
+// processing by a proxy that stopped before it finished counts as ungraded.
+func (g *PromptGrader) Status(request *model.RequestLog) string {
+	g.mu.Lock()
+	grading := g.grading[request.RequestID]
+	g.mu.Unlock()
+
+	grade := request.PromptGrade
+	switch {
+	case grading:
+		return GradeStatusGrading
+	case grade == nil || grade.IsProcessing:
+		return GradeStatusUngraded
+	case grade.Error != "":
+		return GradeStatusFailed
+	}
+	return GradeStatusGraded
+}
+
+// GradePrompt asks the grading model to grade the latest user prompt of req
+func (g *PromptGrader) GradePrompt(ctx context.Context, req *model.AnthropicRequest, header http.Header) (*model.PromptGrade, error) {
+	text, err := g.ask(ctx, g.prompt, gradedConversation(req), header)
+	if err != nil {
+		return nil, err
+	}
+	return parseGrade(text, g.criteria)
+}
+
+// ask sends the grading model instructions and content, returning the text
+// of its answer
+func (g *PromptGrader) ask(ctx context.Context, instructions, content string, header http.Header) (string, error) {
+	gradingReq := model.AnthropicRequest{
+		Model:     g.model,
+		MaxTokens: g.maxTokens,
+		System:    []model.AnthropicSystemMessage{{Type: "text", Text: instructions}},
+		Messages:  []model.AnthropicMessage{{Role: "user", Content: content}},
+	}
+	body, err := json.Marshal(gradingReq)
+	if err != nil {
+		return "", err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header = header.Clone()
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := g.provider.ForwardRequest(ctx, httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxGradingResponse))
+	if err != nil {
+		return "", err
+	}
+	response := &model.ResponseLog{StatusCode: resp.StatusCode, Body: respBody}
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("grading model answered %d: %s", resp.StatusCode, truncateRunes(string(respBody), 200))
+	}
+	return responseText(response), nil
+}
+
+// parseGrade reads the grade out of the grading model's answer, keeping
+// scores within range and only the criteria asked for
+func parseGrade(text string, criteria []config.GradingCriterion) (*model.PromptGrade, error) {
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return nil, errUnreadableGrade
+	}
+	var grade model.PromptGrade
+	if err := json.Unmarshal([]byte(text[start:end+1]), &grade); err != nil || grade.Score == 0 {
+		return nil, errUnreadableGrade
+	}
+	grade.Score = clampScore(grade.Score)
+	scored := grade.Criteria
+	grade.Criteria = make(map[string]model.CriteriaScore, len(criteria))
+	for _, criterion := range criteria {
+		if score, ok := scored[criterion.Name]; ok && score.Score != 0 {
+			score.Score = clampScore(score.Score)
+			grade.Criteria[criterion.Name] = score
+		}
+	}
+	grade.MaxScore = gradeMaxScore
+	grade.GradingTimestamp = time.Now().Format(time.RFC3339)
+	return &grade, nil
+}
+
+func clampScore(score int) int {
+	if score < 1 {
+		return 1
+	}
+	if score > gradeMaxScore {
+		return gradeMaxScore
+	}
+	return score
+}
+
+// hasUserPrompt says whether a request has a user message with text to grade
+func hasUserPrompt(req *model.AnthropicRequest) bool {
+	for i := range req.Messages {
+		if req.Messages[i].Role == "user" && strings.TrimSpace(messageText(&req.Messages[i])) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// gradedConversation is the text of a request as the grading model is shown
+// it: the start of its system prompt and its latest messages
+func gradedConversation(req *model.AnthropicRequest) string {
+	var b strings.Builder
+	if system := strings.TrimSpace(systemText(req)); system != "" {
+		fmt.Fprintf(&b, "<system>\n%s\n</system>\n\n", clipText(system, maxGradedSystemChars))
+	}
+	messages := req.Messages
+	if len(messages) > maxGradedMessages {
+		fmt.Fprintf(&b, "(%d earlier messages left out)\n\n", len(messages)-maxGradedMessages)
+		messages = messages[len(messages)-maxGradedMessages:]
+	}
+	for i := range messages {
+		text := strings.TrimSpace(messageText(&messages[i]))
+		if text == "" {
+			text = "(" + strings.Join(summarizeMessage(i, &messages[i]).Blocks, ", ") + ")"
+		}
+		fmt.Fprintf(&b, "<%s>\n%s\n</%s>\n\n", messages[i].Role, clipText(text, maxGradedMessageChars), messages[i].Role)
+	}
+	return b.String()
+}
+
+// clipText shortens text to about limit characters by leaving out its middle
+func clipText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit/2]) + "\n[…]\n" + string(runes[len(runes)-limit/2:])
+}
+
+// gradingCredentials keeps the credentials of a header, those a provider in
+// passthrough mode sends upstream
+func gradingCredentials(header http.Header) http.Header {
+	credentials := http.Header{}
+	for _, name := range []string{"X-Api-Key", "Authorization", "Anthropic-Version"} {
+		if value := header.Get(name); value != "" {
+			credentials.Set(name, value)
+		}
+	}
+	return credentials
+}
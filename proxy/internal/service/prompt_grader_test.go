@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+// gradingProvider answers grading requests with a fixed answer once release
+// is closed, passing on the requests it gets
+type gradingProvider struct {
+	release  chan struct{}
+	requests chan *http.Request
+	status   int
+	answer   string
+}
+
+func (p *gradingProvider) Name() string {
+	return "anthropic"
+}
+
+func (p *gradingProvider) ForwardRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	p.requests <- req
+	<-p.release
+	return &http.Response{
+		StatusCode: p.status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(p.answer)),
+	}, nil
+}
+
+func TestParseGrade(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		expectedScore int
+		expectedError bool
+	}{
+		{"Plain JSON", `{"score": 4, "feedback": "Clear"}`, 4, false},
+		{"Wrapped in prose", "Here is the grade:\n```json\n{\"score\": 2, \"criteria\": {\"clarity\": {\"score\": 9}, \"tone\": {\"score\": 1}}}\n```", 2, false},
+		{"Out of range", `{"score": 7}`, gradeMaxScore, false},
+		{"No score", `{"feedback": "Clear"}`, 0, true},
+		{"Not JSON", "I can't grade this", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grade, err := parseGrade(tt.text, defaultGradingCriteria)
+			if tt.expectedError {
+				if err == nil {
+					t.Errorf("parseGrade() = %+v, want an error", grade)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseGrade() returned error: %v", err)
+			}
+			if grade.Score != tt.expectedScore || grade.MaxScore != gradeMaxScore {
+				t.Errorf("score = %d/%d, want %d/%d", grade.Score, grade.MaxScore, tt.expectedScore, gradeMaxScore)
+			}
+			for name, criterion := range grade.Criteria {
+				if criterion.Score > gradeMaxScore || name != "clarity" {
+					t.Errorf("criterion %s scored %d, want only known criteria within range", name, criterion.Score)
+				}
+			}
+		})
+	}
+}
+
+func TestPromptGrader(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	grading := &gradingProvider{
+		release:  make(chan struct{}),
+		requests: make(chan *http.Request, 10),
+		status:   http.StatusOK,
+		answer: `{"content": [{"type": "text", "text": "{\"score\": 3, \"feedback\": \"Say which file.\", \"improvedPrompt\": \"Fix the nil check in main.go\",` +
+			` \"criteria\": {\"clarity\": {\"score\": 4, \"feedback\": \"Clear\"}}}"}]}`,
+	}
+	router := NewModelRouter(&config.Config{}, map[string]provider.Provider{"anthropic": grading}, log.New(io.Discard, "", 0))
+	grader, err := NewPromptGrader(config.GradingConfig{}, router, storage, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("NewPromptGrader() returned error: %v", err)
+	}
+
+	save := func(id string, body interface{}) *model.RequestLog {
+		t.Helper()
+		request := testRequestLog(id)
+		request.Body = body
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		return request
+	}
+	prompt := save("prompt", model.AnthropicRequest{
+		Model:    "claude-sonnet-4",
+		System:   []model.AnthropicSystemMessage{{Type: "text", Text: "You are Claude Code."}},
+		Messages: []model.AnthropicMessage{{Role: "user", Content: "Fix the bug"}},
+	})
+	empty := save("empty", model.AnthropicRequest{Model: "claude-sonnet-4"})
+
+	if err := grader.Grade(empty, http.Header{}, nil); err != ErrNothingToGrade {
+		t.Errorf("Grade() of a request without a prompt = %v, want ErrNothingToGrade", err)
+	}
+
+	graded := make(chan *model.PromptGrade, 1)
+	done := func(request *model.RequestLog, grade *model.PromptGrade) { graded <- grade }
+	header := http.Header{"X-Api-Key": []string{"sk-caller"}, "Cookie": []string{"session=1"}}
+	if err := grader.Grade(prompt, header, done); err != nil {
+		t.Fatalf("Grade() returned error: %v", err)
+	}
+
+	var sent *http.Request
+	select {
+	case sent = <-grading.requests:
+	case <-time.After(time.Second):
+		t.Fatal("grading request was not sent")
+	}
+	body, _ := io.ReadAll(sent.Body)
+	if !strings.Contains(string(body), `"model":"`+gradingModel+`"`) || !strings.Contains(string(body), "Fix the bug") {
+		t.Errorf("grading request body = %s", body)
+	}
+	if sent.Header.Get("X-Api-Key") != "sk-caller" || sent.Header.Get("Cookie") != "" {
+		t.Errorf("grading request headers = %v, want only the caller's credentials", sent.Header)
+	}
+
+	// While it's graded the request says so, and isn't graded twice
+	if err := grader.Grade(prompt, header, done); err != ErrAlreadyGrading {
+		t.Errorf("Grade() of a request being graded = %v, want ErrAlreadyGrading", err)
+	}
+	stored, _ := storage.GetRequestByID("prompt")
+	if status := grader.Status(stored); status != GradeStatusGrading || stored.PromptGrade == nil || !stored.PromptGrade.IsProcessing {
+		t.Errorf("status while grading = %s, grade %+v", status, stored.PromptGrade)
+	}
+
+	close(grading.release)
+	select {
+	case grade := <-graded:
+		if grade.Score != 3 || grade.ImprovedPrompt != "Fix the nil check in main.go" || grade.Criteria["clarity"].Score != 4 {
+			t.Errorf("grade = %+v", grade)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("grading didn't finish")
+	}
+	deadline := time.Now().Add(time.Second)
+	for stored, _ = storage.GetRequestByID("prompt"); grader.Status(stored) != GradeStatusGraded && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		stored, _ = storage.GetRequestByID("prompt")
+	}
+	if status := grader.Status(stored); status != GradeStatusGraded || stored.PromptGrade.Score != 3 {
+		t.Errorf("status after grading = %s, grade %+v", status, stored.PromptGrade)
+	}
+
+	// A failed grade is stored with why
+	grading.status = http.StatusUnauthorized
+	grading.answer = `{"type": "error", "error": {"type": "authentication_error"}}`
+	if err := grader.Grade(prompt, http.Header{}, done); err != nil {
+		t.Fatalf("Grade() returned error: %v", err)
+	}
+	<-grading.requests
+	deadline = time.Now().Add(time.Second)
+	for stored, _ = storage.GetRequestByID("prompt"); grader.Status(stored) != GradeStatusFailed && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		stored, _ = storage.GetRequestByID("prompt")
+	}
+	if status := grader.Status(stored); status != GradeStatusFailed || !strings.Contains(stored.PromptGrade.Error, "401") {
+		t.Errorf("status after failing = %s, grade %+v", status, stored.PromptGrade)
+	}
+}
+
+func TestNewPromptGrader_Config(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+		"ollama":    &stubProvider{name: "ollama"},
+	}
+	router := NewModelRouter(&config.Config{}, providers, logger)
+
+	tests := []struct {
+		name             string
+		cfg              config.GradingConfig
+		expectedModel    string
+		expectedProvider string
+		expectedPrompt   []string
+		expectedError    bool
+	}{
+		{
+			name:             "Defaults",
+			expectedModel:    gradingModel,
+			expectedProvider: "anthropic",
+			expectedPrompt:   []string{"from 1 to 5", "- clarity: the task", `"clarity": {"score": 4`, `"structure": {...}}}`},
+		},
+		{
+			name: "Local model and own rubric",
+			cfg: config.GradingConfig{
+				Model:    "ollama/qwen2.5-coder:7b",
+				Prompt:   "Rate 1-{{.MaxScore}} on{{range .Criteria}} {{.Name}}{{end}}. Reply in JSON.",
+				Criteria: []config.GradingCriterion{{Name: " brevity ", Description: "short"}, {Name: ""}, {Name: "tests"}},
+			},
+			expectedModel:    "ollama/qwen2.5-coder:7b",
+			expectedProvider: "ollama",
+			expectedPrompt:   []string{"Rate 1-5 on brevity tests. Reply in JSON."},
+		},
+		{name: "Invalid template", cfg: config.GradingConfig{Prompt: "Rate {{.Scale"}, expectedError: true},
+		{name: "Unknown field", cfg: config.GradingConfig{Prompt: "Rate {{.Scale}}"}, expectedError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grader, err := NewPromptGrader(tt.cfg, router, nil, logger)
+			if tt.expectedError {
+				if err == nil {
+					t.Errorf("NewPromptGrader() = %+v, want an error", grader)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewPromptGrader() returned error: %v", err)
+			}
+			if grader.Model() != tt.expectedModel || grader.provider == nil || grader.provider.Name() != tt.expectedProvider {
+				t.Errorf("grading with %s on %v, want %s on %s", grader.Model(), grader.provider, tt.expectedModel, tt.expectedProvider)
+			}
+			for _, part := range tt.expectedPrompt {
+				if !strings.Contains(grader.prompt, part) {
+					t.Errorf("prompt %q doesn't contain %q", grader.prompt, part)
+				}
+			}
+		})
+	}
+}
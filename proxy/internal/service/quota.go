@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+const (
+	QuotaPolicyReject = "reject"
+	QuotaPolicyQueue  = "queue"
+
+	defaultQuotaMaxWait = 30 * time.Second
+
+	// concurrencyRetryAfter is suggested to clients turned away for lack of a
+	// concurrency slot; slots free up as soon as a response completes
+	concurrencyRetryAfter = time.Second
+)
+
+// PriorityHeader lets a client say whether a request is interactive or
+// background work; without it the priority is inferred from the request
+const PriorityHeader = "X-Priority"
+
+// QuotaExceededError is returned when a provider's request quota is exhausted
+type QuotaExceededError struct {
+	Provider   string
+	Window     string
+	RetryAfter time.Duration
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("request quota for provider %s exceeded (%s limit), retry in %s",
+		e.Provider, e.Window, e.RetryAfter.Round(time.Second))
+}
+
+// QuotaLimiter enforces per-provider request-count limits over sliding windows,
+// and caps on the requests in flight at once. Requests waiting for one of
+// those slots are served interactive first.
+type QuotaLimiter struct {
+	mu     sync.Mutex
+	quotas map[string]*providerQuota
+}
+
+type providerQuota struct {
+	perMinute int
+	perDay    int
+	policy    string
+	maxWait   time.Duration
+
+	// Start times of admitted requests within the last 24h, oldest first
+	admitted []time.Time
+	rejected int
+
+	maxConcurrent int
+	inFlight      int
+	waiting       []*slotWaiter // interactive first, then in arrival order
+}
+
+// slotWaiter is a request queued for a concurrency slot. ready is closed when
+// a finishing request hands its slot over.
+type slotWaiter struct {
+	priority string
+	ready    chan struct{}
+}
+
+func NewQuotaLimiter(cfg map[string]config.QuotaConfig) *QuotaLimiter {
+	limiter := &QuotaLimiter{quotas: make(map[string]*providerQuota)}
+
+	for providerName, q := range cfg {
+		if q.RequestsPerMinute <= 0 && q.RequestsPerDay <= 0 && q.MaxConcurrent <= 0 {
+			continue
+		}
+
+		quota := &providerQuota{
+			perMinute:     q.RequestsPerMinute,
+			perDay:        q.RequestsPerDay,
+			policy:        q.Policy,
+			maxWait:       defaultQuotaMaxWait,
+			maxConcurrent: q.MaxConcurrent,
+		}
+		if quota.policy != QuotaPolicyQueue {
+			quota.policy = QuotaPolicyReject
+		}
+		if d, err := time.ParseDuration(q.MaxWait); err == nil && d > 0 {
+			quota.maxWait = d
+		}
+		limiter.quotas[providerName] = quota
+	}
+
+	return limiter
+}
+
+// Acquire admits one request to the provider. With the queue policy it waits
+// (up to max_wait) for a slot; with the reject policy it fails immediately.
+func (l *QuotaLimiter) Acquire(ctx context.Context, providerName string) error {
+	l.mu.Lock()
+	quota, ok := l.quotas[providerName]
+	l.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	deadline := time.Now().Add(quota.maxWait)
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		wait, window := quota.waitTime(now)
+		if wait == 0 {
+			quota.admitted = append(quota.admitted, now)
+			l.mu.Unlock()
+			return nil
+		}
+
+		if quota.policy == QuotaPolicyReject || now.Add(wait).After(deadline) {
+			quota.rejected++
+			l.mu.Unlock()
+			return &QuotaExceededError{Provider: providerName, Window: window, RetryAfter: wait}
+		}
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// AcquireSlot takes one of the provider's concurrency slots, returning a func
+// that gives it back once the request is done. When all are taken, the queue
+// policy waits (up to max_wait) behind interactive requests and earlier ones
+// of the same priority; the reject policy fails immediately.
+func (l *QuotaLimiter) AcquireSlot(ctx context.Context, providerName, priority string) (func(), error) {
+	l.mu.Lock()
+	quota, ok := l.quotas[providerName]
+	if !ok || quota.maxConcurrent <= 0 {
+		l.mu.Unlock()
+		return func() {}, nil
+	}
+
+	if quota.inFlight < quota.maxConcurrent && len(quota.waiting) == 0 {
+		quota.inFlight++
+		l.mu.Unlock()
+		return l.releaser(quota), nil
+	}
+	if quota.policy == QuotaPolicyReject {
+		quota.rejected++
+		l.mu.Unlock()
+		return nil, &QuotaExceededError{Provider: providerName, Window: "concurrency", RetryAfter: concurrencyRetryAfter}
+	}
+
+	waiter := &slotWaiter{priority: priority, ready: make(chan struct{})}
+	quota.enqueue(waiter)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(quota.maxWait)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-waiter.ready:
+		return l.releaser(quota), nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timer.C:
+		err = &QuotaExceededError{Provider: providerName, Window: "concurrency", RetryAfter: concurrencyRetryAfter}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !quota.dequeue(waiter) {
+		// The slot was handed over as we gave up; take it after all
+		return l.releaser(quota), nil
+	}
+	if ctx.Err() == nil {
+		quota.rejected++
+	}
+	return nil, err
+}
+
+// releaser returns the func that frees a slot, handing it to the first waiter
+func (l *QuotaLimiter) releaser(quota *providerQuota) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if len(quota.waiting) > 0 {
+				next := quota.waiting[0]
+				quota.waiting = quota.waiting[1:]
+				close(next.ready)
+				return
+			}
+			quota.inFlight--
+		})
+	}
+}
+
+// enqueue adds a waiter behind every waiter of the same or higher priority.
+// Must be called with the limiter lock held.
+func (q *providerQuota) enqueue(waiter *slotWaiter) {
+	i := len(q.waiting)
+	if waiter.priority == model.PriorityInteractive {
+		for i > 0 && q.waiting[i-1].priority != model.PriorityInteractive {
+			i--
+		}
+	}
+	q.waiting = append(q.waiting, nil)
+	copy(q.waiting[i+1:], q.waiting[i:])
+	q.waiting[i] = waiter
+}
+
+// dequeue removes a waiter that gave up, reporting whether it was still
+// queued. Must be called with the limiter lock held.
+func (q *providerQuota) dequeue(waiter *slotWaiter) bool {
+	for i, w := range q.waiting {
+		if w == waiter {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// waitTime prunes expired entries and reports how long until a slot frees up.
+// Must be called with the limiter lock held.
+func (q *providerQuota) waitTime(now time.Time) (time.Duration, string) {
+	dayAgo := now.Add(-24 * time.Hour)
+	expired := 0
+	for expired < len(q.admitted) && !q.admitted[expired].After(dayAgo) {
+		expired++
+	}
+	q.admitted = q.admitted[expired:]
+
+	if q.perDay > 0 && len(q.admitted) >= q.perDay {
+		oldest := q.admitted[len(q.admitted)-q.perDay]
+		return oldest.Add(24 * time.Hour).Sub(now), "daily"
+	}
+
+	if q.perMinute > 0 {
+		minuteAgo := now.Add(-time.Minute)
+		inLastMinute := len(q.admitted) - sort.Search(len(q.admitted), func(i int) bool {
+			return q.admitted[i].After(minuteAgo)
+		})
+		if inLastMinute >= q.perMinute {
+			oldest := q.admitted[len(q.admitted)-q.perMinute]
+			return oldest.Add(time.Minute).Sub(now), "per-minute"
+		}
+	}
+
+	return 0, ""
+}
+
+// Status reports current usage for every provider with a quota
+func (l *QuotaLimiter) Status() []model.QuotaStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	minuteAgo := now.Add(-time.Minute)
+	statuses := make([]model.QuotaStatus, 0, len(l.quotas))
+	for providerName, quota := range l.quotas {
+		quota.waitTime(now)
+
+		lastMinute := 0
+		for _, t := range quota.admitted {
+			if t.After(minuteAgo) {
+				lastMinute++
+			}
+		}
+
+		status := model.QuotaStatus{
+			Provider:          providerName,
+			Policy:            quota.policy,
+			RequestsPerMinute: quota.perMinute,
+			RequestsPerDay:    quota.perDay,
+			UsedLastMinute:    lastMinute,
+			UsedLastDay:       len(quota.admitted),
+			Rejected:          quota.rejected,
+			MaxConcurrent:     quota.maxConcurrent,
+			InFlight:          quota.inFlight,
+		}
+		for _, w := range quota.waiting {
+			if w.priority == model.PriorityInteractive {
+				status.QueuedInteractive++
+			} else {
+				status.QueuedBackground++
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Provider < statuses[j].Provider
+	})
+	return statuses
+}
+
+// RequestPriority decides whether a request is interactive or background
+// work. An X-Priority header of interactive/high or background/low wins;
+// otherwise requests for a haiku model that offer no tools, which is what
+// Claude Code's own title, topic and summary calls look like, are background.
+func RequestPriority(header string, req *model.AnthropicRequest) string {
+	switch strings.ToLower(strings.TrimSpace(header)) {
+	case model.PriorityInteractive, "high":
+		return model.PriorityInteractive
+	case model.PriorityBackground, "low":
+		return model.PriorityBackground
+	}
+	if len(req.Tools) == 0 && strings.Contains(strings.ToLower(req.Model), "haiku") {
+		return model.PriorityBackground
+	}
+	return model.PriorityInteractive
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestQuotaLimiter_RejectPolicy(t *testing.T) {
+	limiter := NewQuotaLimiter(map[string]config.QuotaConfig{
+		"openai": {RequestsPerMinute: 2},
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := limiter.Acquire(ctx, "openai"); err != nil {
+			t.Fatalf("request %d rejected: %v", i+1, err)
+		}
+	}
+
+	err := limiter.Acquire(ctx, "openai")
+	var quotaErr *QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		t.Fatalf("expected QuotaExceededError, got %v", err)
+	}
+	if quotaErr.RetryAfter <= 0 || quotaErr.RetryAfter > time.Minute {
+		t.Errorf("RetryAfter = %v, want within (0, 1m]", quotaErr.RetryAfter)
+	}
+
+	// Providers without a quota are never limited
+	if err := limiter.Acquire(ctx, "anthropic"); err != nil {
+		t.Errorf("unlimited provider rejected: %v", err)
+	}
+
+	status := limiter.Status()
+	if len(status) != 1 || status[0].UsedLastMinute != 2 || status[0].Rejected != 1 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestQuotaLimiter_QueueGivesUpAfterMaxWait(t *testing.T) {
+	limiter := NewQuotaLimiter(map[string]config.QuotaConfig{
+		"ollama": {RequestsPerDay: 1, Policy: QuotaPolicyQueue, MaxWait: "10ms"},
+	})
+
+	ctx := context.Background()
+	if err := limiter.Acquire(ctx, "ollama"); err != nil {
+		t.Fatalf("first request rejected: %v", err)
+	}
+
+	// The daily slot frees in ~24h, far beyond max_wait, so queueing is pointless
+	var quotaErr *QuotaExceededError
+	if err := limiter.Acquire(ctx, "ollama"); !errors.As(err, &quotaErr) || quotaErr.Window != "daily" {
+		t.Errorf("expected daily QuotaExceededError, got %v", err)
+	}
+}
+
+func TestProviderQuota_WaitTime(t *testing.T) {
+	now := time.Now()
+	quota := &providerQuota{
+		perMinute: 2,
+		admitted: []time.Time{
+			now.Add(-25 * time.Hour), // expired
+			now.Add(-50 * time.Second),
+			now.Add(-10 * time.Second),
+		},
+	}
+
+	wait, window := quota.waitTime(now)
+	if window != "per-minute" || wait != 10*time.Second {
+		t.Errorf("waitTime() = %v, %q; want 10s, per-minute", wait, window)
+	}
+	if len(quota.admitted) != 2 {
+		t.Errorf("expired entries not pruned: %d remaining", len(quota.admitted))
+	}
+}
+
+func TestQuotaLimiter_SlotsServeInteractiveFirst(t *testing.T) {
+	limiter := NewQuotaLimiter(map[string]config.QuotaConfig{
+		"ollama": {MaxConcurrent: 1, Policy: QuotaPolicyQueue, MaxWait: "5s"},
+	})
+	ctx := context.Background()
+
+	release, err := limiter.AcquireSlot(ctx, "ollama", model.PriorityInteractive)
+	if err != nil {
+		t.Fatalf("first request rejected: %v", err)
+	}
+
+	// Queue two background requests, then an interactive one
+	served := make(chan string, 3)
+	queue := func(name, priority string) {
+		go func() {
+			release, err := limiter.AcquireSlot(ctx, "ollama", priority)
+			if err != nil {
+				served <- "error: " + err.Error()
+				return
+			}
+			served <- name
+			release()
+		}()
+		waitForQueued(t, limiter)
+	}
+	queue("background 1", model.PriorityBackground)
+	queue("background 2", model.PriorityBackground)
+	queue("interactive", model.PriorityInteractive)
+
+	status := limiter.Status()
+	if status[0].InFlight != 1 || status[0].QueuedInteractive != 1 || status[0].QueuedBackground != 2 {
+		t.Errorf("unexpected status: %+v", status[0])
+	}
+
+	release()
+	release() // releasing twice frees one slot
+	want := []string{"interactive", "background 1", "background 2"}
+	for _, name := range want {
+		if got := <-served; got != name {
+			t.Errorf("served %q, want %q", got, name)
+		}
+	}
+	if status := limiter.Status(); status[0].InFlight != 0 {
+		t.Errorf("InFlight = %d after every request finished, want 0", status[0].InFlight)
+	}
+}
+
+func TestQuotaLimiter_SlotRejectPolicy(t *testing.T) {
+	limiter := NewQuotaLimiter(map[string]config.QuotaConfig{
+		"ollama": {MaxConcurrent: 1},
+	})
+	ctx := context.Background()
+
+	if _, err := limiter.AcquireSlot(ctx, "ollama", model.PriorityInteractive); err != nil {
+		t.Fatalf("first request rejected: %v", err)
+	}
+	var quotaErr *QuotaExceededError
+	if _, err := limiter.AcquireSlot(ctx, "ollama", model.PriorityInteractive); !errors.As(err, &quotaErr) || quotaErr.Window != "concurrency" {
+		t.Errorf("expected concurrency QuotaExceededError, got %v", err)
+	}
+}
+
+// waitForQueued waits until one more request is queued for a slot
+func waitForQueued(t *testing.T, limiter *QuotaLimiter) {
+	t.Helper()
+	queued := func() int {
+		status := limiter.Status()[0]
+		return status.QueuedInteractive + status.QueuedBackground
+	}
+	before := queued()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if queued() > before {
+			return
+		}
+	}
+	t.Fatal("request was never queued")
+}
+
+func TestRequestPriority(t *testing.T) {
+	tools := []model.Tool{{Name: "Bash"}}
+
+	tests := []struct {
+		name     string
+		header   string
+		req      model.AnthropicRequest
+		expected string
+	}{
+		{"Agent loop", "", model.AnthropicRequest{Model: "claude-sonnet-4-20250514", Tools: tools}, model.PriorityInteractive},
+		{"Haiku with tools", "", model.AnthropicRequest{Model: "claude-3-5-haiku-20241022", Tools: tools}, model.PriorityInteractive},
+		{"Haiku summary", "", model.AnthropicRequest{Model: "claude-3-5-haiku-20241022"}, model.PriorityBackground},
+		{"Header wins", "interactive", model.AnthropicRequest{Model: "claude-3-5-haiku-20241022"}, model.PriorityInteractive},
+		{"Low header", "Low", model.AnthropicRequest{Model: "claude-sonnet-4-20250514", Tools: tools}, model.PriorityBackground},
+		{"Unknown header ignored", "urgent", model.AnthropicRequest{Model: "claude-3-5-haiku-20241022"}, model.PriorityBackground},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RequestPriority(tt.header, &tt.req); got != tt.expected {
+				t.Errorf("RequestPriority() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// rateLimitHeaderPrefix starts the headers Anthropic reports its rate limits
+// in, such as anthropic-ratelimit-input-tokens-remaining
+const rateLimitHeaderPrefix = "anthropic-ratelimit-"
+
+// rateLimitLoadRequests is how many of the latest stored requests are read
+// for the providers' rate limits at startup
+const rateLimitLoadRequests = 100
+
+// rateLimitTracker keeps the rate limits each provider's latest response
+// reported
+type rateLimitTracker struct {
+	mu     sync.Mutex
+	latest map[string]model.ProviderRateLimits // provider -> its limits
+}
+
+func newRateLimitTracker() *rateLimitTracker {
+	return &rateLimitTracker{latest: make(map[string]model.ProviderRateLimits)}
+}
+
+// record keeps the rate limits of a request's response, if it reported any
+func (t *rateLimitTracker) record(request *model.RequestLog) {
+	limits, ok := requestRateLimits(request)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.latest[limits.Provider] = limits
+}
+
+// load fills in the providers no response has reported on since startup from
+// the latest stored requests
+func (t *rateLimitTracker) load(storage StorageService) error {
+	requests, _, err := storage.GetRequests(1, rateLimitLoadRequests)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Most recent first, so a provider's first is its latest
+	for i := range requests {
+		limits, ok := requestRateLimits(&requests[i])
+		if _, known := t.latest[limits.Provider]; !ok || known {
+			continue
+		}
+		t.latest[limits.Provider] = limits
+	}
+	return nil
+}
+
+// report lists the providers' latest rate limits by provider
+func (t *rateLimitTracker) report() []model.ProviderRateLimits {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	providers := make([]model.ProviderRateLimits, 0, len(t.latest))
+	for _, limits := range t.latest {
+		providers = append(providers, limits)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].Provider < providers[j].Provider })
+	return providers
+}
+
+// requestRateLimits reads the rate limits from a request's response headers,
+// reporting whether there were any
+func requestRateLimits(request *model.RequestLog) (model.ProviderRateLimits, bool) {
+	if request.Response == nil || request.Provider == "" {
+		return model.ProviderRateLimits{}, false
+	}
+	limits := parseRateLimits(request.Response.Headers)
+	if len(limits) == 0 {
+		return model.ProviderRateLimits{}, false
+	}
+
+	updatedAt := request.Response.CompletedAt
+	if updatedAt == "" {
+		updatedAt = request.Timestamp
+	}
+	reported := model.ProviderRateLimits{
+		Provider:  request.Provider,
+		RequestID: request.RequestID,
+		UpdatedAt: updatedAt,
+		Limits:    limits,
+	}
+	for name, values := range request.Response.Headers {
+		if strings.EqualFold(name, "Retry-After") && len(values) > 0 {
+			reported.RetryAfter, _ = strconv.Atoi(values[0])
+		}
+	}
+	return reported, true
+}
+
+// parseRateLimits reads the anthropic-ratelimit-<name>-limit, -remaining,
+// -reset and -status headers into a limit for each name, by name. Resets are
+// RFC3339 or, for the subscription's unified limit, Unix seconds.
+func parseRateLimits(headers map[string][]string) []model.RateLimit {
+	byName := make(map[string]*model.RateLimit)
+	for header, values := range headers {
+		header = strings.ToLower(header)
+		if !strings.HasPrefix(header, rateLimitHeaderPrefix) || len(values) == 0 {
+			continue
+		}
+		rest := strings.TrimPrefix(header, rateLimitHeaderPrefix)
+		dash := strings.LastIndex(rest, "-")
+		if dash <= 0 {
+			continue
+		}
+		name, field, value := rest[:dash], rest[dash+1:], strings.TrimSpace(values[0])
+
+		limit := byName[name]
+		if limit == nil {
+			limit = &model.RateLimit{Name: name}
+		}
+		switch field {
+		case "limit", "remaining":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			if field == "limit" {
+				limit.Limit = &n
+			} else {
+				limit.Remaining = &n
+			}
+		case "reset":
+			if at, err := time.Parse(time.RFC3339, value); err == nil {
+				limit.ResetsAt = at.UTC().Format(time.RFC3339)
+			} else if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+				limit.ResetsAt = time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+			} else {
+				continue
+			}
+		case "status":
+			limit.Status = value
+		default:
+			continue
+		}
+		byName[name] = limit
+	}
+
+	limits := make([]model.RateLimit, 0, len(byName))
+	for _, limit := range byName {
+		limits = append(limits, *limit)
+	}
+	sort.Slice(limits, func(i, j int) bool { return limits[i].Name < limits[j].Name })
+	return limits
+}
+
+// LoadRateLimits seeds the providers' rate limits from the latest stored
+// responses
+func (r *ModelRouter) LoadRateLimits(storage StorageService) error {
+	return r.rateLimits.load(storage)
+}
+
+// RateLimits reports the rate limits each provider's latest response gave
+func (r *ModelRouter) RateLimits() []model.ProviderRateLimits {
+	return r.rateLimits.report()
+}
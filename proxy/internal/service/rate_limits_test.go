@@ -0,0 +1,108 @@
+package service
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	count := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name     string
+		headers  map[string][]string
+		expected []model.RateLimit
+	}{
+		{"No rate limit headers", map[string][]string{"Content-Type": {"application/json"}}, []model.RateLimit{}},
+		{
+			name: "API limits",
+			headers: map[string][]string{
+				"Anthropic-Ratelimit-Requests-Limit":           {"50"},
+				"Anthropic-Ratelimit-Requests-Remaining":       {"49"},
+				"Anthropic-Ratelimit-Requests-Reset":           {"2025-06-15T09:00:01Z"},
+				"Anthropic-Ratelimit-Input-Tokens-Limit":       {"40000"},
+				"Anthropic-Ratelimit-Input-Tokens-Remaining":   {"38000"},
+				"Anthropic-Ratelimit-Input-Tokens-Reset":       {"2025-06-15T11:00:02+02:00"},
+				"Anthropic-Ratelimit-Output-Tokens-Remaining":  {"not a number"},
+				"Anthropic-Ratelimit-Output-Tokens-Unexpected": {"1"},
+			},
+			expected: []model.RateLimit{
+				{Name: "input-tokens", Limit: count(40000), Remaining: count(38000), ResetsAt: "2025-06-15T09:00:02Z"},
+				{Name: "requests", Limit: count(50), Remaining: count(49), ResetsAt: "2025-06-15T09:00:01Z"},
+			},
+		},
+		{
+			name: "Subscription limit",
+			headers: map[string][]string{
+				"Anthropic-Ratelimit-Unified-Status": {"allowed_warning"},
+				"Anthropic-Ratelimit-Unified-Reset":  {"1749978000"},
+			},
+			expected: []model.RateLimit{{Name: "unified", ResetsAt: "2025-06-15T09:00:00Z", Status: "allowed_warning"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if limits := parseRateLimits(tt.headers); !reflect.DeepEqual(limits, tt.expected) {
+				t.Errorf("parseRateLimits() = %+v, want %+v", limits, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRateLimitTracker(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	save := func(id, timestamp, provider, remaining string) {
+		request := testRequestLog(id)
+		request.Timestamp = timestamp
+		request.Provider = provider
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		request.Response = &model.ResponseLog{StatusCode: 200, CompletedAt: request.Timestamp, Headers: map[string][]string{}}
+		if remaining != "" {
+			request.Response.Headers["Anthropic-Ratelimit-Requests-Remaining"] = []string{remaining}
+		}
+		if err := storage.UpdateRequestWithResponse(request); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+	}
+	save("older", "2025-06-15T08:00:00Z", "anthropic", "10")
+	save("latest", "2025-06-15T08:30:00Z", "anthropic", "9")
+	save("openai", "2025-06-15T08:40:00Z", "openai", "")
+
+	tracker := newRateLimitTracker()
+	if err := tracker.load(storage); err != nil {
+		t.Fatalf("load() returned error: %v", err)
+	}
+	if providers := tracker.report(); len(providers) != 1 || providers[0].RequestID != "latest" || *providers[0].Limits[0].Remaining != 9 {
+		t.Fatalf("report() after load = %+v, want the latest anthropic response", providers)
+	}
+
+	// A rate limited response is kept too, with how long it asked to wait
+	limited := testRequestLog("limited")
+	limited.Provider = "anthropic"
+	limited.Response = &model.ResponseLog{StatusCode: 429, CompletedAt: "2025-06-15T09:00:00Z", Headers: map[string][]string{
+		"Anthropic-Ratelimit-Requests-Remaining": {"0"},
+		"Retry-After":                            {"12"},
+	}}
+	tracker.record(limited)
+	zero := int64(0)
+	expected := []model.ProviderRateLimits{{
+		Provider:   "anthropic",
+		RequestID:  "limited",
+		UpdatedAt:  "2025-06-15T09:00:00Z",
+		RetryAfter: 12,
+		Limits:     []model.RateLimit{{Name: "requests", Remaining: &zero}},
+	}}
+	if providers := tracker.report(); !reflect.DeepEqual(providers, expected) {
+		t.Errorf("report() = %+v, want %+v", providers, expected)
+	}
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// Diff line operations
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+)
+
+// maxDiffCells bounds the table a line diff is worked out with; texts whose
+// changed middles are bigger are shown as all of A's lines removed and all
+// of B's added
+const maxDiffCells = 4 << 20
+
+// messagePreviewChars is how much of a message's text a summary shows
+const messagePreviewChars = 200
+
+// CompareRequests works out what changed from request a to request b, to
+// see what context grew between two calls of the same session. Messages are
+// compared without their cache_control markers, which Claude Code moves to
+// the latest messages on every call.
+func CompareRequests(a, b *model.RequestLog) *model.RequestComparison {
+	reqA, reqB := requestBody(a), requestBody(b)
+	comparison := &model.RequestComparison{
+		A:        comparedRequest(a, reqA),
+		B:        comparedRequest(b, reqB),
+		System:   diffLines(systemText(reqA), systemText(reqB)),
+		Messages: diffMessages(reqA.Messages, reqB.Messages),
+		Tools:    diffTools(reqA.Tools, reqB.Tools),
+		Response: diffLines(responseText(a.Response), responseText(b.Response)),
+	}
+
+	usageA, usageB := comparison.A.Usage, comparison.B.Usage
+	comparison.Delta = model.ComparedUsage{
+		EstimatedTokens:     usageB.EstimatedTokens - usageA.EstimatedTokens,
+		InputTokens:         usageB.InputTokens - usageA.InputTokens,
+		OutputTokens:        usageB.OutputTokens - usageA.OutputTokens,
+		CacheReadTokens:     usageB.CacheReadTokens - usageA.CacheReadTokens,
+		CacheCreationTokens: usageB.CacheCreationTokens - usageA.CacheCreationTokens,
+		CostUSD:             roundTo(usageB.CostUSD-usageA.CostUSD, 6),
+	}
+	return comparison
+}
+
+// requestBody decodes a logged request's body; one that isn't a Messages
+// request comes back empty
+func requestBody(request *model.RequestLog) *model.AnthropicRequest {
+	var req model.AnthropicRequest
+	if body, err := json.Marshal(request.Body); err == nil {
+		json.Unmarshal(body, &req)
+	}
+	return &req
+}
+
+func comparedRequest(request *model.RequestLog, req *model.AnthropicRequest) model.ComparedRequest {
+	compared := model.ComparedRequest{
+		RequestID:    request.RequestID,
+		Timestamp:    request.Timestamp,
+		Model:        request.RoutedModel,
+		SystemBlocks: len(req.System),
+		Messages:     len(req.Messages),
+		Tools:        len(req.Tools),
+		ToolCalls:    []string{},
+		Usage:        model.ComparedUsage{EstimatedTokens: estimateTokens(req)},
+	}
+	if compared.Model == "" {
+		compared.Model = request.Model
+	}
+	if request.CostUSD != nil {
+		compared.Usage.CostUSD = roundTo(*request.CostUSD, 6)
+	}
+	if response := request.Response; response != nil {
+		compared.StatusCode = response.StatusCode
+		compared.StopReason = responseStopReason(response)
+		for _, block := range responseContent(response) {
+			if block.Type == "tool_use" {
+				compared.ToolCalls = append(compared.ToolCalls, block.Name)
+			}
+		}
+		if usage := responseUsage(response); usage != nil {
+			compared.Usage.InputTokens = int64(usage.InputTokens)
+			compared.Usage.OutputTokens = int64(usage.OutputTokens)
+			compared.Usage.CacheReadTokens = int64(usage.CacheReadInputTokens)
+			compared.Usage.CacheCreationTokens = int64(usage.CacheCreationInputTokens)
+		}
+	}
+	return compared
+}
+
+// systemText is the system prompt with its blocks one after the other
+func systemText(req *model.AnthropicRequest) string {
+	texts := make([]string, len(req.System))
+	for i, block := range req.System {
+		texts[i] = block.Text
+	}
+	return strings.Join(texts, "\n")
+}
+
+// responseContent decodes the content blocks of a stored response
+func responseContent(response *model.ResponseLog) []model.ContentBlock {
+	if response == nil || len(response.Body) == 0 {
+		return nil
+	}
+	var body struct {
+		Content []model.ContentBlock `json:"content"`
+	}
+	if err := json.Unmarshal(response.Body, &body); err != nil {
+		return nil
+	}
+	return body.Content
+}
+
+// responseText is the text a response answered with
+func responseText(response *model.ResponseLog) string {
+	var texts []string
+	for _, block := range responseContent(response) {
+		if block.Type == "text" {
+			texts = append(texts, block.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// diffLines lists the lines removed from a and added in b, as few as a
+// longest common subsequence allows
+func diffLines(a, b string) []model.DiffLine {
+	diff := []model.DiffLine{}
+	if a == b {
+		return diff
+	}
+	linesA, linesB := splitLines(a), splitLines(b)
+
+	// Most changes are in the middle of long texts that otherwise match
+	prefix := 0
+	for prefix < len(linesA) && prefix < len(linesB) && linesA[prefix] == linesB[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(linesA)-prefix && suffix < len(linesB)-prefix &&
+		linesA[len(linesA)-1-suffix] == linesB[len(linesB)-1-suffix] {
+		suffix++
+	}
+	midA, midB := linesA[prefix:len(linesA)-suffix], linesB[prefix:len(linesB)-suffix]
+
+	removed := func(i int) {
+		diff = append(diff, model.DiffLine{Op: DiffRemoved, Line: prefix + i + 1, Text: midA[i]})
+	}
+	added := func(j int) {
+		diff = append(diff, model.DiffLine{Op: DiffAdded, Line: prefix + j + 1, Text: midB[j]})
+	}
+	if len(midA)*len(midB) > maxDiffCells {
+		for i := range midA {
+			removed(i)
+		}
+		for j := range midB {
+			added(j)
+		}
+		return diff
+	}
+
+	// common[i][j] is the length of the longest common subsequence of
+	// midA[i:] and midB[j:]
+	common := make([][]int, len(midA)+1)
+	for i := range common {
+		common[i] = make([]int, len(midB)+1)
+	}
+	for i := len(midA) - 1; i >= 0; i-- {
+		for j := len(midB) - 1; j >= 0; j-- {
+			switch {
+			case midA[i] == midB[j]:
+				common[i][j] = common[i+1][j+1] + 1
+			case common[i+1][j] >= common[i][j+1]:
+				common[i][j] = common[i+1][j]
+			default:
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(midA) || j < len(midB) {
+		switch {
+		case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+			i++
+			j++
+		case j == len(midB) || i < len(midA) && common[i+1][j] >= common[i][j+1]:
+			removed(i)
+			i++
+		default:
+			added(j)
+			j++
+		}
+	}
+	return diff
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// diffMessages finds the messages both requests start with and summarizes
+// the ones after
+func diffMessages(a, b []model.AnthropicMessage) model.MessagesDiff {
+	diff := model.MessagesDiff{Removed: []model.MessageSummary{}, Added: []model.MessageSummary{}}
+	for diff.Shared < len(a) && diff.Shared < len(b) && messageKey(&a[diff.Shared]) == messageKey(&b[diff.Shared]) {
+		diff.Shared++
+	}
+	for i := diff.Shared; i < len(a); i++ {
+		diff.Removed = append(diff.Removed, summarizeMessage(i, &a[i]))
+	}
+	for i := diff.Shared; i < len(b); i++ {
+		diff.Added = append(diff.Added, summarizeMessage(i, &b[i]))
+	}
+	return diff
+}
+
+// messageKey identifies a message by its role and content, cache_control
+// markers left out and text content the same as a single text block
+func messageKey(msg *model.AnthropicMessage) string {
+	content := msg.Content
+	if text, ok := content.(string); ok {
+		content = []interface{}{map[string]interface{}{"type": "text", "text": text}}
+	}
+	key, _ := json.Marshal([]interface{}{msg.Role, withoutCacheControl(content)})
+	return string(key)
+}
+
+func withoutCacheControl(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		stripped := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if key != "cache_control" {
+				stripped[key] = withoutCacheControl(item)
+			}
+		}
+		return stripped
+	case []interface{}:
+		stripped := make([]interface{}, len(v))
+		for i, item := range v {
+			stripped[i] = withoutCacheControl(item)
+		}
+		return stripped
+	}
+	return value
+}
+
+func summarizeMessage(index int, msg *model.AnthropicMessage) model.MessageSummary {
+	chars, tokens := contentSize(msg.Content)
+	summary := model.MessageSummary{
+		Index:           index,
+		Role:            msg.Role,
+		Blocks:          []string{},
+		EstimatedTokens: perMessageTokens + tokens + int(float64(chars)/charsPerToken+0.5),
+	}
+
+	switch content := msg.Content.(type) {
+	case string:
+		summary.Blocks = append(summary.Blocks, "text")
+	case []interface{}:
+		for _, item := range content {
+			if block, ok := item.(map[string]interface{}); ok {
+				blockType, _ := block["type"].(string)
+				summary.Blocks = append(summary.Blocks, blockType)
+			}
+		}
+	}
+	if preview := strings.TrimSpace(firstText(msg.Content)); preview != "" {
+		summary.Preview = truncateRunes(preview, messagePreviewChars)
+		if len(summary.Preview) < len(preview) {
+			summary.Preview += "…"
+		}
+	}
+	return summary
+}
+
+// firstText is the first text of a message's content: its first text block,
+// the name of a tool it calls or the text of a tool result
+func firstText(content interface{}) string {
+	switch v := content.(type) {
+	case string:
+		return v
+	case []interface{}:
+		for _, item := range v {
+			block, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			var text string
+			switch block["type"] {
+			case "text":
+				text, _ = block["text"].(string)
+			case "tool_use":
+				text, _ = block["name"].(string)
+			case "tool_result":
+				text = firstText(block["content"])
+			}
+			if text != "" {
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+// diffTools compares the tools two requests offered by name
+func diffTools(a, b []model.Tool) model.ToolsDiff {
+	diff := model.ToolsDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	toolsA := make(map[string]string, len(a))
+	for _, tool := range a {
+		definition, _ := json.Marshal(tool)
+		toolsA[tool.Name] = string(definition)
+	}
+	seen := make(map[string]bool, len(b))
+	for _, tool := range b {
+		seen[tool.Name] = true
+		definition, _ := json.Marshal(tool)
+		previous, ok := toolsA[tool.Name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, tool.Name)
+		case previous != string(definition):
+			diff.Changed = append(diff.Changed, tool.Name)
+		}
+	}
+	for name := range toolsA {
+		if !seen[name] {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
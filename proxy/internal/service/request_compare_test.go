@@ -0,0 +1,119 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestDiffLines(t *testing.T) {
+	removed := func(line int, text string) model.DiffLine {
+		return model.DiffLine{Op: DiffRemoved, Line: line, Text: text}
+	}
+	added := func(line int, text string) model.DiffLine {
+		return model.DiffLine{Op: DiffAdded, Line: line, Text: text}
+	}
+
+	tests := []struct {
+		name     string
+		a, b     string
+		expected []model.DiffLine
+	}{
+		{"Same", "one\ntwo", "one\ntwo", []model.DiffLine{}},
+		{"Added at the end", "one", "one\ntwo", []model.DiffLine{added(2, "two")}},
+		{"From nothing", "", "one\ntwo", []model.DiffLine{added(1, "one"), added(2, "two")}},
+		{"Changed in the middle", "one\ntwo\nthree", "one\n2\nthree", []model.DiffLine{removed(2, "two"), added(2, "2")}},
+		{"Moved", "a\nb\nc\nd", "a\nc\nd\nb", []model.DiffLine{removed(2, "b"), added(4, "b")}},
+		{"Interleaved", "a\nx\nb\ny\nc", "a\nb\nz\nc", []model.DiffLine{removed(2, "x"), removed(4, "y"), added(3, "z")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := diffLines(tt.a, tt.b); !reflect.DeepEqual(diff, tt.expected) {
+				t.Errorf("diffLines() = %+v, want %+v", diff, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCompareRequests(t *testing.T) {
+	// Two consecutive calls of a session, as read back from storage: the
+	// second has the first's answer and a tool result, the cache marker moved
+	// along, and a tool more
+	logged := func(id, body, response string, cost float64) *model.RequestLog {
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(body), &decoded); err != nil {
+			t.Fatalf("bad body %s: %v", body, err)
+		}
+		return &model.RequestLog{
+			RequestID: id,
+			Model:     "claude-sonnet-4-20250514",
+			Body:      decoded,
+			CostUSD:   &cost,
+			Response:  &model.ResponseLog{StatusCode: 200, Body: []byte(response)},
+		}
+	}
+	a := logged("req-a", `{
+		"system": [{"type": "text", "text": "You are Claude Code.\nBe brief."}],
+		"tools": [{"name": "Read", "description": "Reads a file", "input_schema": {"type": "object"}}],
+		"messages": [
+			{"role": "user", "content": [{"type": "text", "text": "Fix the bug", "cache_control": {"type": "ephemeral"}}]}
+		]
+	}`, `{"content": [{"type": "text", "text": "Let me look."}, {"type": "tool_use", "name": "Read"}], "stop_reason": "tool_use",
+		"usage": {"input_tokens": 100, "output_tokens": 20, "cache_creation_input_tokens": 1000}}`, 0.01)
+	b := logged("req-b", `{
+		"system": [{"type": "text", "text": "You are Claude Code.\nBe brief.\nToday is Monday."}],
+		"tools": [
+			{"name": "Read", "description": "Reads a file", "input_schema": {"type": "object"}},
+			{"name": "Edit", "description": "Edits a file", "input_schema": {"type": "object"}}
+		],
+		"messages": [
+			{"role": "user", "content": [{"type": "text", "text": "Fix the bug"}]},
+			{"role": "assistant", "content": [{"type": "text", "text": "Let me look."}, {"type": "tool_use", "name": "Read"}]},
+			{"role": "user", "content": [{"type": "tool_result", "content": "package main", "cache_control": {"type": "ephemeral"}}]}
+		]
+	}`, `{"content": [{"type": "text", "text": "Found it."}], "stop_reason": "end_turn",
+		"usage": {"input_tokens": 150, "output_tokens": 10, "cache_read_input_tokens": 1000}}`, 0.004)
+
+	comparison := CompareRequests(a, b)
+
+	if expected := []model.DiffLine{{Op: DiffAdded, Line: 3, Text: "Today is Monday."}}; !reflect.DeepEqual(comparison.System, expected) {
+		t.Errorf("System = %+v, want %+v", comparison.System, expected)
+	}
+	messages := comparison.Messages
+	if messages.Shared != 1 || len(messages.Removed) != 0 || len(messages.Added) != 2 {
+		t.Fatalf("Messages = %+v, want 1 shared and 2 added", messages)
+	}
+	if added := messages.Added[1]; added.Index != 2 || added.Role != "user" ||
+		!reflect.DeepEqual(added.Blocks, []string{"tool_result"}) || added.Preview != "package main" || added.EstimatedTokens == 0 {
+		t.Errorf("added message = %+v", added)
+	}
+	if expected := (model.ToolsDiff{Added: []string{"Edit"}, Removed: []string{}, Changed: []string{}}); !reflect.DeepEqual(comparison.Tools, expected) {
+		t.Errorf("Tools = %+v, want %+v", comparison.Tools, expected)
+	}
+	if len(comparison.Response) != 2 || comparison.Response[0].Text != "Let me look." || comparison.Response[1].Text != "Found it." {
+		t.Errorf("Response = %+v", comparison.Response)
+	}
+	if !reflect.DeepEqual(comparison.A.ToolCalls, []string{"Read"}) || comparison.A.StopReason != "tool_use" || comparison.B.Messages != 3 {
+		t.Errorf("A = %+v, B = %+v", comparison.A, comparison.B)
+	}
+
+	delta := comparison.Delta
+	if delta.InputTokens != 50 || delta.OutputTokens != -10 || delta.CacheReadTokens != 1000 ||
+		delta.CacheCreationTokens != -1000 || delta.CostUSD != -0.006 || delta.EstimatedTokens <= 0 {
+		t.Errorf("Delta = %+v", delta)
+	}
+}
+
+func TestSummarizeMessage_Preview(t *testing.T) {
+	long := strings.Repeat("é", messagePreviewChars+10)
+	summary := summarizeMessage(0, &model.AnthropicMessage{Role: "user", Content: long})
+	if summary.Preview != strings.Repeat("é", messagePreviewChars)+"…" {
+		t.Errorf("Preview = %q", summary.Preview)
+	}
+	if !reflect.DeepEqual(summary.Blocks, []string{"text"}) {
+		t.Errorf("Blocks = %v, want [text]", summary.Blocks)
+	}
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// Request feed events
+const (
+	FeedRequestStarted   = "request-started"
+	FeedStreamProgress   = "streaming-progress"
+	FeedRequestCompleted = "request-completed"
+	FeedBudgetThreshold  = "budget-threshold"
+	FeedGradingCompleted = "grading-completed"
+	FeedBurnRate         = "burn-rate"
+)
+
+// FeedProgressInterval is how often a streaming response reports progress
+const FeedProgressInterval = time.Second
+
+// feedSubscriberBuffer is how many events a subscriber may fall behind
+// before it is dropped
+const feedSubscriberBuffer = 256
+
+// feedReplayEvents is how many recent events are kept for clients catching up
+// after a reconnect
+const feedReplayEvents = 1000
+
+// RequestFeed fans live request events out to the dashboard. Like the
+// StreamHub, it never holds up a request: a subscriber that falls too far
+// behind is disconnected. The latest events are kept so a subscriber can
+// pick up where it left off.
+type RequestFeed struct {
+	mu          sync.Mutex
+	lastID      int64
+	recent      []model.FeedEvent // the last feedReplayEvents, oldest first
+	subscribers map[chan model.FeedEvent]struct{}
+	budgetFired map[string]float64 // budget and period -> the highest threshold announced
+	prices      *PriceTable
+	now         func() time.Time
+}
+
+func NewRequestFeed(prices *PriceTable) *RequestFeed {
+	return &RequestFeed{
+		subscribers: make(map[chan model.FeedEvent]struct{}),
+		budgetFired: make(map[string]float64),
+		prices:      prices,
+		now:         time.Now,
+	}
+}
+
+// Subscribe returns a channel with the events published from now on, which
+// is closed if the subscriber falls behind; cancel unsubscribes
+func (f *RequestFeed) Subscribe() (events <-chan model.FeedEvent, cancel func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.subscribe()
+}
+
+// SubscribeSince is Subscribe for a subscriber that last saw the event
+// lastID: it also returns the events it missed since. complete is false when
+// some of them are no longer kept, or lastID is from before a restart, and
+// the subscriber should reload instead.
+func (f *RequestFeed) SubscribeSince(lastID int64) (missed []model.FeedEvent, events <-chan model.FeedEvent, cancel func(), complete bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	complete = lastID <= f.lastID
+	if complete && lastID < f.lastID && (len(f.recent) == 0 || f.recent[0].ID > lastID+1) {
+		complete = false
+	}
+	for _, event := range f.recent {
+		if event.ID > lastID || !complete {
+			missed = append(missed, event)
+		}
+	}
+	events, cancel = f.subscribe()
+	return missed, events, cancel, complete
+}
+
+// subscribe adds a subscriber; f.mu must be held
+func (f *RequestFeed) subscribe() (<-chan model.FeedEvent, func()) {
+	ch := make(chan model.FeedEvent, feedSubscriberBuffer)
+	f.subscribers[ch] = struct{}{}
+
+	cancel := func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.subscribers[ch]; ok {
+			delete(f.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+// Publish numbers an event and sends it to every subscriber
+func (f *RequestFeed) Publish(event model.FeedEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.publish(event)
+}
+
+// publish is Publish with f.mu held
+func (f *RequestFeed) publish(event model.FeedEvent) {
+	f.lastID++
+	event.ID = f.lastID
+	event.Time = f.now().UTC().Format(time.RFC3339Nano)
+	if len(f.recent) == feedReplayEvents {
+		f.recent = append(f.recent[:0], f.recent[1:]...)
+	}
+	f.recent = append(f.recent, event)
+	for ch := range f.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(f.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// RequestStarted announces a request on its way upstream
+func (f *RequestFeed) RequestStarted(request *model.RequestLog) {
+	event := feedEvent(FeedRequestStarted, request)
+	f.Publish(event)
+}
+
+// StreamProgress reports how many chunks a streaming response has sent
+func (f *RequestFeed) StreamProgress(request *model.RequestLog, chunks int, elapsed time.Duration) {
+	event := feedEvent(FeedStreamProgress, request)
+	event.Chunks = chunks
+	event.ResponseTime = elapsed.Milliseconds()
+	f.Publish(event)
+}
+
+// RequestCompleted announces a request's response with its usage and cost
+func (f *RequestFeed) RequestCompleted(request *model.RequestLog) {
+	event := feedEvent(FeedRequestCompleted, request)
+	if response := request.Response; response != nil {
+		event.StatusCode = response.StatusCode
+		event.ResponseTime = response.ResponseTime
+		event.Chunks = len(response.StreamingChunks)
+		if usage := responseUsage(response); usage != nil {
+			event.InputTokens = int64(usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens)
+			event.OutputTokens = int64(usage.OutputTokens)
+			if cost, ok := f.prices.Cost(event.Model, usage); ok {
+				event.CostUSD = roundTo(cost, 6)
+			}
+		}
+	}
+	f.Publish(event)
+}
+
+// BudgetChecked announces every budget that has reached a threshold it
+// hadn't in its current period: one of the overall budget's thresholds, or
+// 100% for a model budget
+func (f *RequestFeed) BudgetChecked(budget *BudgetTracker) {
+	if !budget.Enabled() {
+		return
+	}
+	statuses := budget.Report()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range statuses {
+		status := statuses[i]
+		thresholds := []float64{100}
+		if status.Model == "" {
+			thresholds = thresholds[:0]
+			for _, t := range budget.thresholds {
+				thresholds = append(thresholds, t.percent)
+			}
+		}
+
+		var reached float64
+		for _, threshold := range thresholds {
+			if status.Percent >= threshold && threshold > reached {
+				reached = threshold
+			}
+		}
+		key := status.Model + " " + status.Period + " " + status.StartedAt
+		if reached == 0 || f.budgetFired[key] >= reached {
+			continue
+		}
+		for fired := range f.budgetFired {
+			if strings.HasPrefix(fired, status.Model+" "+status.Period+" ") {
+				delete(f.budgetFired, fired) // an earlier period
+			}
+		}
+		f.budgetFired[key] = reached
+		f.publish(model.FeedEvent{Type: FeedBudgetThreshold, Threshold: reached, Budget: &status})
+	}
+}
+
+// BurnRateChanged announces the burn rate and its projections after a request
+// has been counted in them
+func (f *RequestFeed) BurnRateChanged(burn model.BurnRate) {
+	f.Publish(model.FeedEvent{Type: FeedBurnRate, BurnRate: &burn})
+}
+
+// GradingCompleted announces that a request's prompt has been graded
+func (f *RequestFeed) GradingCompleted(request *model.RequestLog, grade *model.PromptGrade) {
+	event := feedEvent(FeedGradingCompleted, request)
+	event.Score = grade.Score
+	event.MaxScore = grade.MaxScore
+	f.Publish(event)
+}
+
+// feedEvent is an event about a request, with what identifies it
+func feedEvent(eventType string, request *model.RequestLog) model.FeedEvent {
+	event := model.FeedEvent{
+		Type:      eventType,
+		RequestID: request.RequestID,
+		Model:     request.RoutedModel,
+		Provider:  request.Provider,
+		Endpoint:  request.Endpoint,
+	}
+	if event.Model == "" {
+		event.Model = request.Model
+	}
+	if request.Routing != nil {
+		event.Tenant = request.Routing.User
+	}
+	return event
+}
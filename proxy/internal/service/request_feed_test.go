@@ -0,0 +1,160 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestRequestFeed(t *testing.T) {
+	t.Run("Subscribers get numbered events", func(t *testing.T) {
+		feed := NewRequestFeed(NewPriceTable(nil))
+		feed.now = func() time.Time { return time.Date(2025, 3, 1, 10, 0, 0, 0, time.FixedZone("CET", 3600)) }
+		events, cancel := feed.Subscribe()
+		defer cancel()
+
+		request := &model.RequestLog{
+			RequestID:   "req_1",
+			Endpoint:    "/v1/messages",
+			Model:       "claude-sonnet-4-20250514",
+			RoutedModel: "claude-3-5-haiku-20241022",
+			Provider:    "anthropic",
+			Routing:     &model.RoutingExplanation{User: "alice"},
+		}
+		feed.RequestStarted(request)
+		feed.StreamProgress(request, 12, 1500*time.Millisecond)
+
+		started := <-events
+		if started.ID != 1 || started.Type != FeedRequestStarted || started.RequestID != "req_1" ||
+			started.Model != "claude-3-5-haiku-20241022" || started.Tenant != "alice" || started.Time != "2025-03-01T09:00:00Z" {
+			t.Errorf("started = %+v", started)
+		}
+		progress := <-events
+		if progress.ID != 2 || progress.Type != FeedStreamProgress || progress.Chunks != 12 || progress.ResponseTime != 1500 {
+			t.Errorf("progress = %+v", progress)
+		}
+
+		cancel()
+		if _, open := <-events; open {
+			t.Error("events still open after cancel()")
+		}
+		feed.RequestStarted(request) // no subscribers left to send to
+	})
+
+	t.Run("Completed requests carry usage and cost", func(t *testing.T) {
+		feed := NewRequestFeed(NewPriceTable(map[string]config.PriceConfig{"my-model": {Input: 3, Output: 15}}))
+		events, cancel := feed.Subscribe()
+		defer cancel()
+
+		feed.RequestCompleted(&model.RequestLog{
+			RequestID: "req_2",
+			Model:     "my-model",
+			Response: &model.ResponseLog{
+				StatusCode:      200,
+				ResponseTime:    2400,
+				StreamingChunks: []string{"data: {}", "data: {}"},
+				Body:            []byte(`{"usage":{"input_tokens":1000,"cache_read_input_tokens":500,"output_tokens":200}}`),
+			},
+		})
+
+		completed := <-events
+		expected := model.FeedEvent{
+			ID:           1,
+			Type:         FeedRequestCompleted,
+			Time:         completed.Time,
+			RequestID:    "req_2",
+			Model:        "my-model",
+			StatusCode:   200,
+			ResponseTime: 2400,
+			Chunks:       2,
+			InputTokens:  1500,
+			OutputTokens: 200,
+			CostUSD:      0.006, // the override has no cache read price
+		}
+		if completed != expected {
+			t.Errorf("completed = %+v, want %+v", completed, expected)
+		}
+	})
+
+	t.Run("Slow subscribers are dropped", func(t *testing.T) {
+		feed := NewRequestFeed(NewPriceTable(nil))
+		events, cancel := feed.Subscribe()
+		defer cancel()
+
+		// Nobody reads, so publishing past the buffer must not block
+		for i := 0; i < feedSubscriberBuffer+1; i++ {
+			feed.Publish(model.FeedEvent{Type: FeedRequestStarted})
+		}
+		received := 0
+		for range events {
+			received++
+		}
+		if received != feedSubscriberBuffer {
+			t.Errorf("received %d events before being dropped, want %d", received, feedSubscriberBuffer)
+		}
+	})
+	t.Run("Reconnecting subscribers catch up", func(t *testing.T) {
+		feed := NewRequestFeed(NewPriceTable(nil))
+		for i := 0; i < feedReplayEvents+10; i++ {
+			feed.Publish(model.FeedEvent{Type: FeedRequestStarted})
+		}
+
+		tests := []struct {
+			name     string
+			lastID   int64
+			missed   int
+			complete bool
+		}{
+			{"Up to date", feedReplayEvents + 10, 0, true},
+			{"A few behind", feedReplayEvents + 5, 5, true},
+			{"Oldest kept is next", 10, feedReplayEvents, true},
+			{"Events no longer kept", 5, feedReplayEvents, false},
+			{"From before a restart", feedReplayEvents + 50, feedReplayEvents, false},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				missed, _, cancel, complete := feed.SubscribeSince(tt.lastID)
+				defer cancel()
+				if len(missed) != tt.missed || complete != tt.complete {
+					t.Errorf("SubscribeSince(%d) = %d events, complete %v; want %d, %v", tt.lastID, len(missed), complete, tt.missed, tt.complete)
+				}
+				if tt.complete && len(missed) > 0 && missed[0].ID != tt.lastID+1 {
+					t.Errorf("first missed event = %d, want %d", missed[0].ID, tt.lastID+1)
+				}
+			})
+		}
+	})
+
+	t.Run("Budget thresholds are announced once a period", func(t *testing.T) {
+		now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+		budget := NewBudgetTracker(config.BudgetConfig{Daily: 10}, NewPriceTable(nil))
+		budget.now = func() time.Time { return now }
+		feed := NewRequestFeed(budget.prices)
+		events, cancel := feed.Subscribe()
+		defer cancel()
+
+		spend := func(dollars float64) {
+			budget.Record("claude-opus-4-20250514", &model.AnthropicUsage{OutputTokens: int(dollars * 1e6 / 75)})
+			feed.BudgetChecked(budget)
+		}
+		var thresholds []float64
+		for _, dollars := range []float64{5, 3.5, 0, 0.5, 2} {
+			spend(dollars)
+		}
+		now = now.AddDate(0, 0, 1)
+		spend(9)
+		for len(events) > 0 {
+			event := <-events
+			if event.Type != FeedBudgetThreshold || event.Budget == nil || event.Budget.Period != BudgetDaily {
+				t.Fatalf("event = %+v", event)
+			}
+			thresholds = append(thresholds, event.Threshold)
+		}
+		if expected := []float64{80, 100, 80}; !reflect.DeepEqual(thresholds, expected) {
+			t.Errorf("thresholds announced = %v, want %v", thresholds, expected)
+		}
+	})
+}
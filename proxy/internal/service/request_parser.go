@@ -0,0 +1,164 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// Parsing modes for /v1/messages request bodies
+const (
+	ParsingLenient = "lenient" // log what the models can't represent and forward it untouched (default)
+	ParsingStrict  = "strict"  // reject it with a description of every problem
+)
+
+// RequestParseError describes why a request body was rejected
+type RequestParseError struct {
+	Problems []string
+}
+
+func (e *RequestParseError) Error() string {
+	return "invalid request body: " + strings.Join(e.Problems, "; ")
+}
+
+// RequestParser decodes /v1/messages bodies and encodes them again after
+// routing. Bodies that aren't valid JSON are always rejected. Beyond that,
+// strict mode rejects unknown fields and values of the wrong type, while
+// lenient mode forwards them untouched: routed requests are re-encoded by
+// patching only the fields routing changed into the original body.
+type RequestParser struct {
+	mode   string
+	logger *log.Logger
+}
+
+func NewRequestParser(mode string, logger *log.Logger) *RequestParser {
+	switch mode {
+	case ParsingLenient, ParsingStrict:
+	case "":
+		mode = ParsingLenient
+	default:
+		logger.Printf("⚠️  Unknown parsing mode %q, using %s", mode, ParsingLenient)
+		mode = ParsingLenient
+	}
+	return &RequestParser{mode: mode, logger: logger}
+}
+
+// Mode returns the parsing mode in effect
+func (p *RequestParser) Mode() string {
+	return p.mode
+}
+
+// Parse decodes body. partial is set when lenient mode let through values the
+// request model couldn't hold; those requests are only ever forwarded with
+// their model changed, since the decoded fields are incomplete.
+func (p *RequestParser) Parse(requestID string, body []byte) (req model.AnthropicRequest, partial bool, err error) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return req, false, &RequestParseError{Problems: []string{describeJSONError(err)}}
+	}
+	if _, ok := value.(map[string]interface{}); !ok {
+		return req, false, &RequestParseError{Problems: []string{"body must be a JSON object"}}
+	}
+
+	var problems []string
+	if err := json.Unmarshal(body, &req); err != nil {
+		// The decoder carries on past type mismatches, so req still holds
+		// everything else
+		problems = append(problems, describeJSONError(err))
+		partial = true
+	}
+
+	if p.mode == ParsingStrict {
+		var unknown []string
+		findUnknownFields("", value, requestSchemaType, func(path string) {
+			unknown = append(unknown, path)
+		})
+		sort.Strings(unknown)
+		for _, path := range unknown {
+			problems = append(problems, fmt.Sprintf("unknown field %q", path))
+		}
+		if len(problems) > 0 {
+			return req, false, &RequestParseError{Problems: problems}
+		}
+		return req, false, nil
+	}
+
+	if partial {
+		p.logger.Printf("⚠️  Request %s has values the proxy can't parse, forwarding them untouched: %s",
+			requestID, strings.Join(problems, "; "))
+	}
+	return req, partial, nil
+}
+
+// Encode returns the body to forward for req, which was decoded from original
+// and then routed. modified reports whether routing changed more than the
+// model (see RoutingDecision.RequestModified).
+func (p *RequestParser) Encode(original []byte, req *model.AnthropicRequest, partial, modified bool) ([]byte, error) {
+	if p.mode == ParsingStrict {
+		// Strict parsing guarantees the model holds the whole request
+		return json.Marshal(req)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(original, &fields); err != nil {
+		return nil, fmt.Errorf("failed to decode original request: %w", err)
+	}
+
+	patch := map[string]interface{}{"model": req.Model}
+	if modified {
+		if partial {
+			p.logger.Printf("⚠️  Not applying routing changes beyond the model to a partially parsed request")
+		} else {
+			patch["messages"] = req.Messages
+			patch["max_tokens"] = req.MaxTokens
+		}
+	}
+	for key, value := range patch {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", key, err)
+		}
+		fields[key] = encoded
+	}
+	return json.Marshal(fields)
+}
+
+// describeJSONError turns a decoding error into a message that points at the
+// problem in the body
+func describeJSONError(err error) string {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return fmt.Sprintf("malformed JSON at byte %d: %v", syntaxErr.Offset, syntaxErr)
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		if typeErr.Field == "" {
+			return fmt.Sprintf("expected %s, got %s", jsonKind(typeErr.Type.String()), typeErr.Value)
+		}
+		return fmt.Sprintf("field %q: expected %s, got %s", typeErr.Field, jsonKind(typeErr.Type.String()), typeErr.Value)
+	}
+	return err.Error()
+}
+
+// jsonKind names the JSON value a Go type decodes from
+func jsonKind(goType string) string {
+	goType = strings.TrimLeft(goType, "*")
+	switch {
+	case strings.HasPrefix(goType, "[]"):
+		return "array"
+	case strings.HasPrefix(goType, "map[") || strings.Contains(goType, "."):
+		return "object"
+	case goType == "string":
+		return "string"
+	case goType == "bool":
+		return "boolean"
+	case strings.HasPrefix(goType, "int") || strings.HasPrefix(goType, "uint") || strings.HasPrefix(goType, "float"):
+		return "number"
+	}
+	return goType
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestRequestParser_Parse(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		body        string
+		wantErr     []string // substrings of the error, if it should fail
+		wantPartial bool
+	}{
+		{
+			name: "valid request",
+			mode: ParsingStrict,
+			body: `{"model": "claude-sonnet-4", "max_tokens": 10, "messages": [{"role": "user", "content": "hi"}]}`,
+		},
+		{
+			name:    "malformed JSON is rejected in lenient mode",
+			mode:    ParsingLenient,
+			body:    `{"model": "claude-sonnet-4",}`,
+			wantErr: []string{"malformed JSON at byte"},
+		},
+		{
+			name:    "non-object body",
+			mode:    ParsingLenient,
+			body:    `[1, 2]`,
+			wantErr: []string{"must be a JSON object"},
+		},
+		{
+			name:        "type mismatch passes in lenient mode",
+			mode:        ParsingLenient,
+			body:        `{"model": "claude-sonnet-4", "system": "be brief", "messages": []}`,
+			wantPartial: true,
+		},
+		{
+			name:    "type mismatch is rejected in strict mode",
+			mode:    ParsingStrict,
+			body:    `{"model": "claude-sonnet-4", "system": "be brief", "messages": []}`,
+			wantErr: []string{`field "system": expected array, got string`},
+		},
+		{
+			name: "unknown fields pass in lenient mode",
+			mode: ParsingLenient,
+			body: `{"model": "claude-sonnet-4", "thinking": {"type": "enabled"}, "messages": []}`,
+		},
+		{
+			name:    "strict mode lists every problem",
+			mode:    ParsingStrict,
+			body:    `{"model": "claude-sonnet-4", "max_tokens": "10", "thinking": {}, "messages": [{"role": "user", "content": "hi", "cache": 1}]}`,
+			wantErr: []string{`field "max_tokens": expected number, got string`, `unknown field "messages[].cache"`, `unknown field "thinking"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := NewRequestParser(tt.mode, log.New(io.Discard, "", 0))
+			req, partial, err := parser.Parse("req-1", []byte(tt.body))
+
+			if len(tt.wantErr) > 0 {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("error %q does not mention %q", err, want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() returned error: %v", err)
+			}
+			if partial != tt.wantPartial {
+				t.Errorf("partial = %v, want %v", partial, tt.wantPartial)
+			}
+			if req.Model != "claude-sonnet-4" {
+				t.Errorf("model = %q, want claude-sonnet-4", req.Model)
+			}
+		})
+	}
+}
+
+func TestRequestParser_Encode(t *testing.T) {
+	body := []byte(`{"model": "claude-opus-4", "max_tokens": 4000, "system": "be brief", "thinking": {"type": "enabled"}, "messages": [{"role": "user", "content": "a"}, {"role": "user", "content": "b"}]}`)
+
+	t.Run("lenient mode keeps what the model can't hold", func(t *testing.T) {
+		parser := NewRequestParser(ParsingLenient, log.New(io.Discard, "", 0))
+		req, partial, err := parser.Parse("req-1", body)
+		if err != nil {
+			t.Fatalf("Parse() returned error: %v", err)
+		}
+
+		req.Model = "qwen"
+		req.Messages = req.Messages[1:]
+		req.MaxTokens = 100
+		encoded, err := parser.Encode(body, &req, partial, true)
+		if err != nil {
+			t.Fatalf("Encode() returned error: %v", err)
+		}
+
+		var got map[string]interface{}
+		json.Unmarshal(encoded, &got)
+		if got["model"] != "qwen" || got["system"] != "be brief" || got["thinking"] == nil {
+			t.Errorf("unexpected body %s", encoded)
+		}
+		// The request was only partially parsed, so trimming isn't applied
+		if len(got["messages"].([]interface{})) != 2 || got["max_tokens"] != float64(4000) {
+			t.Errorf("expected messages and max_tokens untouched, got %s", encoded)
+		}
+	})
+
+	t.Run("lenient mode applies routing changes to fully parsed requests", func(t *testing.T) {
+		complete := []byte(`{"model": "claude-opus-4", "max_tokens": 4000, "thinking": {"type": "enabled"}, "messages": [{"role": "user", "content": "a"}, {"role": "user", "content": "b"}]}`)
+		parser := NewRequestParser(ParsingLenient, log.New(io.Discard, "", 0))
+		req, partial, err := parser.Parse("req-1", complete)
+		if err != nil {
+			t.Fatalf("Parse() returned error: %v", err)
+		}
+
+		req.Messages = req.Messages[1:]
+		req.MaxTokens = 100
+		encoded, err := parser.Encode(complete, &req, partial, true)
+		if err != nil {
+			t.Fatalf("Encode() returned error: %v", err)
+		}
+
+		var got map[string]interface{}
+		json.Unmarshal(encoded, &got)
+		if len(got["messages"].([]interface{})) != 1 || got["max_tokens"] != float64(100) || got["thinking"] == nil {
+			t.Errorf("unexpected body %s", encoded)
+		}
+	})
+}
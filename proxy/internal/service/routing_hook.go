@@ -0,0 +1,163 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+const (
+	defaultRoutingHookTimeout = 500 * time.Millisecond
+	// maxRoutingHookOutput bounds what is read from a hook's stdout
+	maxRoutingHookOutput = 64 * 1024
+)
+
+// routingHook is a user-provided command that picks the model for a request
+type routingHook struct {
+	command []string
+	timeout time.Duration
+}
+
+// newRoutingHook returns nil when no hook is configured
+func newRoutingHook(cfg config.RoutingHookConfig) (*routingHook, error) {
+	if len(cfg.Command) == 0 {
+		return nil, nil
+	}
+	hook := &routingHook{command: cfg.Command, timeout: defaultRoutingHookTimeout}
+	if cfg.Timeout != "" {
+		timeout, err := time.ParseDuration(cfg.Timeout)
+		if err != nil || timeout <= 0 {
+			return hook, fmt.Errorf("invalid routing hook timeout %q, using %s", cfg.Timeout, defaultRoutingHookTimeout)
+		}
+		hook.timeout = timeout
+	}
+	if _, err := exec.LookPath(cfg.Command[0]); err != nil {
+		return hook, fmt.Errorf("routing hook command %s not found: %w", cfg.Command[0], err)
+	}
+	return hook, nil
+}
+
+// run asks the hook to route req. It returns nil when the hook leaves the
+// request to the other routing steps.
+func (h *routingHook) run(req *model.AnthropicRequest) (*model.RoutingHookOutput, error) {
+	input, err := json.Marshal(routingHookInput(req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal routing hook input: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, h.command[0], h.command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &limitedBuffer{buf: &stdout, limit: maxRoutingHookOutput}
+	cmd.Stderr = &limitedBuffer{buf: &stderr, limit: maxRoutingHookOutput}
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("routing hook timed out after %s", h.timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("routing hook failed: %w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("routing hook failed: %w", err)
+	}
+
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return nil, nil
+	}
+	var output model.RoutingHookOutput
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return nil, fmt.Errorf("failed to parse routing hook output: %w", err)
+	}
+	if output.Model == "" {
+		return nil, nil
+	}
+	return &output, nil
+}
+
+func routingHookInput(req *model.AnthropicRequest) model.RoutingHookInput {
+	input := model.RoutingHookInput{
+		Model:           req.Model,
+		EstimatedTokens: estimateTokens(req),
+		Session:         sessionKey(req),
+		Messages:        len(req.Messages),
+		Tools:           make([]string, 0, len(req.Tools)),
+		Stream:          req.Stream,
+		MaxTokens:       req.MaxTokens,
+	}
+	var system []string
+	for _, sys := range req.System {
+		system = append(system, sys.Text)
+	}
+	input.System = strings.Join(system, "\n")
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == "user" {
+			input.LastUserMessage = messageText(&req.Messages[i])
+			break
+		}
+	}
+	for _, tool := range req.Tools {
+		input.Tools = append(input.Tools, tool.Name)
+	}
+	return input
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the
+// rest, so a runaway hook can't fill memory
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// routeByHook routes req as the hook says, reporting false when the hook
+// leaves it to the other routing steps or fails
+func (r *ModelRouter) routeByHook(req *model.AnthropicRequest, decision *RoutingDecision) bool {
+	output, err := r.hook.run(req)
+	if err != nil {
+		r.logger.Printf("⚠️  %v, routing normally", err)
+		return false
+	}
+	if output == nil {
+		return false
+	}
+
+	providerName := output.Provider
+	if providerName == "" {
+		providerName = r.getProviderNameForModel(output.Model)
+	}
+	p := r.providers[providerName]
+	if p == nil {
+		r.logger.Printf("⚠️  Routing hook picked %s on unknown provider %s, routing normally", output.Model, providerName)
+		return false
+	}
+
+	r.logger.Printf("\033[36m%s\033[0m → \033[32m%s\033[0m (hook)", req.Model, output.Model)
+	decision.Explanation.Reason = model.RouteReasonHook
+	decision.Explanation.Detail = "routing hook picked the model"
+	if output.Reason != "" {
+		decision.Explanation.Detail = "routing hook: " + output.Reason
+	}
+	decision.TargetModel = output.Model
+	decision.Provider = p
+	return true
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func TestRoutingHook_Run(t *testing.T) {
+	req := &model.AnthropicRequest{
+		Model:    "claude-sonnet-4-20250514",
+		Messages: []model.AnthropicMessage{{Role: "user", Content: "hello"}},
+	}
+
+	tests := []struct {
+		name        string
+		script      string
+		expected    *model.RoutingHookOutput
+		expectedErr string
+	}{
+		{"Decision", `echo '{"model":"gpt-4o","reason":"cheap"}'`, &model.RoutingHookOutput{Model: "gpt-4o", Reason: "cheap"}, ""},
+		{"Reads the request", `grep -q '"model":"claude-sonnet-4-20250514"' && echo '{"model":"claude-3-5-haiku-20241022"}'`, &model.RoutingHookOutput{Model: "claude-3-5-haiku-20241022"}, ""},
+		{"No output", `true`, nil, ""},
+		{"No model", `echo '{"model":""}'`, nil, ""},
+		{"Failure", `echo 'no rules loaded' >&2; exit 1`, nil, "no rules loaded"},
+		{"Timeout", `sleep 1`, nil, "timed out"},
+		{"Invalid JSON", `echo 'gpt-4o'`, nil, "failed to parse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := &routingHook{command: []string{"sh", "-c", tt.script}, timeout: 200 * time.Millisecond}
+			output, err := hook.run(req)
+			if tt.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("run() returned error: %v", err)
+			}
+			if (output == nil) != (tt.expected == nil) || (output != nil && *output != *tt.expected) {
+				t.Errorf("run() = %+v, want %+v", output, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRoutingHookInput(t *testing.T) {
+	req := &model.AnthropicRequest{
+		Model:     "claude-sonnet-4-20250514",
+		MaxTokens: 1024,
+		Stream:    true,
+		System:    []model.AnthropicSystemMessage{{Type: "text", Text: "You are Claude Code"}},
+		Messages: []model.AnthropicMessage{
+			{Role: "user", Content: "fix the tests"},
+			{Role: "assistant", Content: "Done."},
+			{Role: "user", Content: "now lint"},
+		},
+		Tools: []model.Tool{{Name: "Bash"}, {Name: "Edit"}},
+	}
+
+	input := routingHookInput(req)
+	if input.Model != req.Model || input.System != "You are Claude Code" || input.LastUserMessage != "now lint" {
+		t.Errorf("unexpected input %+v", input)
+	}
+	if input.Messages != 3 || !input.Stream || input.MaxTokens != 1024 || input.EstimatedTokens == 0 {
+		t.Errorf("unexpected input %+v", input)
+	}
+	if strings.Join(input.Tools, ",") != "Bash,Edit" {
+		t.Errorf("Tools = %v, want [Bash Edit]", input.Tools)
+	}
+}
+
+func TestModelRouter_RoutingHook(t *testing.T) {
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+		"openai":    &stubProvider{name: "openai"},
+	}
+
+	tests := []struct {
+		name             string
+		script           string
+		expectedModel    string
+		expectedProvider string
+		expectedReason   string
+	}{
+		{"Hook picks the model", `echo '{"model":"gpt-4o","reason":"short question"}'`, "gpt-4o", "openai", model.RouteReasonHook},
+		{"Hook passes", `true`, "claude-sonnet-4-20250514", "anthropic", model.RouteReasonDefault},
+		{"Unknown provider", `echo '{"model":"gpt-4o","provider":"azure"}'`, "claude-sonnet-4-20250514", "anthropic", model.RouteReasonDefault},
+		{"Failing hook", `exit 2`, "claude-sonnet-4-20250514", "anthropic", model.RouteReasonDefault},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Routing: config.RoutingConfig{Hook: config.RoutingHookConfig{Command: []string{"sh", "-c", tt.script}}}}
+			router := NewModelRouter(cfg, providers, log.New(io.Discard, "", 0))
+
+			decision, err := router.DetermineRoute(&model.AnthropicRequest{
+				Model:    "claude-sonnet-4-20250514",
+				Messages: []model.AnthropicMessage{{Role: "user", Content: "what does this regex do?"}},
+			})
+			if err != nil {
+				t.Fatalf("DetermineRoute() returned error: %v", err)
+			}
+			if decision.TargetModel != tt.expectedModel || decision.Provider.Name() != tt.expectedProvider {
+				t.Errorf("routed to %s on %s, want %s on %s", decision.TargetModel, decision.Provider.Name(), tt.expectedModel, tt.expectedProvider)
+			}
+			if decision.Explanation.Reason != tt.expectedReason {
+				t.Errorf("Reason = %q, want %q", decision.Explanation.Reason, tt.expectedReason)
+			}
+		})
+	}
+}
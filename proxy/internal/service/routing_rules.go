@@ -0,0 +1,157 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// Scopes a routing rule can inspect
+const (
+	RuleScopeLastUser = "last_user"
+	RuleScopeMessages = "messages"
+	RuleScopeSystem   = "system"
+	RuleScopeAll      = "all"
+)
+
+// routingRule is a compiled content-based routing rule from config
+type routingRule struct {
+	name        string
+	keywords    []string // lowercased
+	pattern     *regexp.Regexp
+	scope       string
+	models      []string // lowercased substrings of the requested model
+	targetModel string
+	provider    string
+}
+
+// compileRoutingRule validates a rule from config
+func compileRoutingRule(cfg config.RoutingRuleConfig) (routingRule, error) {
+	rule := routingRule{
+		name:        cfg.Name,
+		scope:       cfg.Scope,
+		targetModel: cfg.TargetModel,
+		provider:    cfg.Provider,
+	}
+
+	if rule.targetModel == "" {
+		return rule, fmt.Errorf("rule %q has no target_model", cfg.Name)
+	}
+	if len(cfg.Keywords) == 0 && cfg.Pattern == "" {
+		return rule, fmt.Errorf("rule %q needs keywords or a pattern", cfg.Name)
+	}
+
+	switch rule.scope {
+	case "":
+		rule.scope = RuleScopeLastUser
+	case RuleScopeLastUser, RuleScopeMessages, RuleScopeSystem, RuleScopeAll:
+	default:
+		return rule, fmt.Errorf("rule %q has unknown scope %q", cfg.Name, cfg.Scope)
+	}
+
+	if cfg.Pattern != "" {
+		pattern, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return rule, fmt.Errorf("rule %q has invalid pattern: %w", cfg.Name, err)
+		}
+		rule.pattern = pattern
+	}
+
+	for _, keyword := range cfg.Keywords {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			rule.keywords = append(rule.keywords, strings.ToLower(keyword))
+		}
+	}
+	for _, m := range cfg.Models {
+		rule.models = append(rule.models, strings.ToLower(m))
+	}
+
+	return rule, nil
+}
+
+// ruleConfig converts a rule managed through the API to its config form
+func ruleConfig(rule model.RoutingRule) config.RoutingRuleConfig {
+	return config.RoutingRuleConfig{
+		Name:        rule.Name,
+		Keywords:    rule.Keywords,
+		Pattern:     rule.Pattern,
+		Scope:       rule.Scope,
+		Models:      rule.Models,
+		TargetModel: rule.TargetModel,
+		Provider:    rule.Provider,
+	}
+}
+
+// matches reports whether the request's text (within the rule's scope) contains
+// any of the rule's keywords or matches its pattern
+func (rule *routingRule) matches(req *model.AnthropicRequest) bool {
+	if len(rule.models) > 0 {
+		requested := strings.ToLower(req.Model)
+		found := false
+		for _, m := range rule.models {
+			if strings.Contains(requested, m) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	text := requestText(req, rule.scope)
+	if text == "" {
+		return false
+	}
+
+	if len(rule.keywords) > 0 {
+		lower := strings.ToLower(text)
+		for _, keyword := range rule.keywords {
+			if strings.Contains(lower, keyword) {
+				return true
+			}
+		}
+	}
+
+	return rule.pattern != nil && rule.pattern.MatchString(text)
+}
+
+// requestText gathers the text blocks a rule with the given scope looks at
+func requestText(req *model.AnthropicRequest, scope string) string {
+	var parts []string
+
+	if scope == RuleScopeSystem || scope == RuleScopeAll {
+		for _, sys := range req.System {
+			parts = append(parts, sys.Text)
+		}
+	}
+
+	switch scope {
+	case RuleScopeLastUser:
+		for i := len(req.Messages) - 1; i >= 0; i-- {
+			if req.Messages[i].Role == "user" {
+				parts = append(parts, messageText(&req.Messages[i]))
+				break
+			}
+		}
+	case RuleScopeMessages, RuleScopeAll:
+		for i := range req.Messages {
+			parts = append(parts, messageText(&req.Messages[i]))
+		}
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+func messageText(msg *model.AnthropicMessage) string {
+	var parts []string
+	for _, block := range msg.GetContentBlocks() {
+		if block.Type == "text" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// ScheduledTask is a unit of recurring work. It receives the schedule's args
+// from config and returns a short human-readable result.
+type ScheduledTask func(ctx context.Context, args map[string]string) (string, error)
+
+type scheduledJob struct {
+	config   config.ScheduleConfig
+	schedule *CronSchedule
+	task     ScheduledTask
+
+	running      bool
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastResult   string
+	lastErr      error
+	nextRun      time.Time
+	runCount     int
+}
+
+// Scheduler runs registered tasks according to cron expressions from config
+type Scheduler struct {
+	mu     sync.Mutex
+	tasks  map[string]ScheduledTask
+	jobs   []*scheduledJob
+	logger *log.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewScheduler(logger *log.Logger) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		tasks:  make(map[string]ScheduledTask),
+		logger: logger,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// RegisterTask makes a task available to schedules under the given name
+func (s *Scheduler) RegisterTask(name string, task ScheduledTask) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[name] = task
+}
+
+// AddSchedule validates a schedule from config and queues it for Start
+func (s *Scheduler) AddSchedule(cfg config.ScheduleConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cfg.Name == "" {
+		cfg.Name = cfg.Task
+	}
+
+	task, ok := s.tasks[cfg.Task]
+	if !ok {
+		return fmt.Errorf("schedule %q: unknown task %q", cfg.Name, cfg.Task)
+	}
+
+	schedule, err := ParseCron(cfg.Cron)
+	if err != nil {
+		return fmt.Errorf("schedule %q: %w", cfg.Name, err)
+	}
+
+	for _, job := range s.jobs {
+		if job.config.Name == cfg.Name {
+			return fmt.Errorf("schedule %q is defined more than once", cfg.Name)
+		}
+	}
+
+	s.jobs = append(s.jobs, &scheduledJob{
+		config:   cfg,
+		schedule: schedule,
+		task:     task,
+		nextRun:  schedule.Next(time.Now()),
+	})
+	return nil
+}
+
+// Start launches one goroutine per schedule
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.run(job)
+	}
+
+	if len(s.jobs) > 0 {
+		s.logger.Printf("⏰ Scheduler started with %d schedule(s)", len(s.jobs))
+	}
+}
+
+// Stop cancels pending runs and waits for in-flight tasks to finish
+func (s *Scheduler) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *Scheduler) run(job *scheduledJob) {
+	defer s.wg.Done()
+
+	for {
+		s.mu.Lock()
+		next := job.nextRun
+		s.mu.Unlock()
+
+		if next.IsZero() {
+			s.logger.Printf("⚠️  Schedule '%s' will never fire, stopping it", job.config.Name)
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.execute(job)
+
+		s.mu.Lock()
+		job.nextRun = job.schedule.Next(time.Now())
+		s.mu.Unlock()
+	}
+}
+
+func (s *Scheduler) execute(job *scheduledJob) {
+	s.mu.Lock()
+	if job.running {
+		s.mu.Unlock()
+		s.logger.Printf("⚠️  Schedule '%s' is still running, skipping this run", job.config.Name)
+		return
+	}
+	job.running = true
+	s.mu.Unlock()
+
+	start := time.Now()
+	result, err := s.safeRun(job)
+	duration := time.Since(start)
+
+	s.mu.Lock()
+	job.running = false
+	job.lastRun = start
+	job.lastDuration = duration
+	job.lastResult = result
+	job.lastErr = err
+	job.runCount++
+	s.mu.Unlock()
+
+	if err != nil {
+		s.logger.Printf("❌ Scheduled task '%s' failed: %v", job.config.Name, err)
+		return
+	}
+	s.logger.Printf("⏰ Scheduled task '%s' completed in %s: %s", job.config.Name, duration.Round(time.Millisecond), result)
+}
+
+// safeRun keeps a panicking task from taking down the scheduler
+func (s *Scheduler) safeRun(job *scheduledJob) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("task panicked: %v", r)
+		}
+	}()
+	return job.task(s.ctx, job.config.Args)
+}
+
+// Status returns the state of every schedule, ordered by next run
+func (s *Scheduler) Status() []model.ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]model.ScheduleStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		status := model.ScheduleStatus{
+			Name:       job.config.Name,
+			Cron:       job.config.Cron,
+			Task:       job.config.Task,
+			Running:    job.running,
+			LastStatus: "never",
+			LastResult: job.lastResult,
+			RunCount:   job.runCount,
+		}
+		if !job.lastRun.IsZero() {
+			status.LastRun = job.lastRun.Format(time.RFC3339)
+			status.LastDuration = job.lastDuration.Milliseconds()
+			status.LastStatus = "ok"
+			if job.lastErr != nil {
+				status.LastStatus = "error"
+				status.LastError = job.lastErr.Error()
+			}
+		}
+		if !job.nextRun.IsZero() {
+			status.NextRun = job.nextRun.Format(time.RFC3339)
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].NextRun < statuses[j].NextRun
+	})
+
+	return statuses
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/i18n"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// NewPruneTask deletes requests older than the "retention_days" arg (default 30)
+func NewPruneTask(storage StorageService) ScheduledTask {
+	return func(ctx context.Context, args map[string]string) (string, error) {
+		days := argInt(args, "retention_days", 30)
+		if days <= 0 {
+			return "", fmt.Errorf("retention_days must be positive, got %d", days)
+		}
+
+		cutoff := time.Now().AddDate(0, 0, -days)
+		deleted, err := storage.DeleteRequestsBefore(cutoff)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("deleted %d request(s) older than %d day(s)", deleted, days), nil
+	}
+}
+
+// NewPurgeTrashTask deletes requests that have been in the trash for longer
+// than the "trash_days" arg, by default storage.trash_days
+func NewPurgeTrashTask(storage StorageService, trashDays int) ScheduledTask {
+	return func(ctx context.Context, args map[string]string) (string, error) {
+		days := argInt(args, "trash_days", trashDays)
+		if days <= 0 {
+			return "", fmt.Errorf("trash_days must be positive, got %d", days)
+		}
+
+		purged, err := storage.PurgeTrash(time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("purged %d request(s) in the trash for over %d day(s)", purged, days), nil
+	}
+}
+
+// NewBackupTask writes a timestamped copy of the database into the "dir" arg
+// (default "backups") and keeps the newest "keep" copies (default 7).
+func NewBackupTask(storage StorageService) ScheduledTask {
+	return func(ctx context.Context, args map[string]string) (string, error) {
+		dir := argString(args, "dir", "backups")
+		keep := argInt(args, "keep", 7)
+
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", fmt.Errorf("failed to create backup directory: %w", err)
+		}
+
+		dest := filepath.Join(dir, fmt.Sprintf("requests-%s.db", time.Now().Format("20060102-150405")))
+		if err := storage.Backup(dest); err != nil {
+			return "", err
+		}
+
+		removed := 0
+		if keep > 0 {
+			matches, _ := filepath.Glob(filepath.Join(dir, "requests-*.db"))
+			// Timestamped names sort chronologically
+			sort.Strings(matches)
+			for len(matches) > keep {
+				if err := os.Remove(matches[0]); err == nil {
+					removed++
+				}
+				matches = matches[1:]
+			}
+		}
+
+		return fmt.Sprintf("wrote %s (removed %d old backup(s))", dest, removed), nil
+	}
+}
+
+// NewDigestTask summarizes usage over the "period" arg (default 24h), logs it,
+// and optionally posts it to "webhook_url" as a Slack-compatible {"text": ...} payload.
+// The digest is written in the "language" arg, or the configured language.
+func NewDigestTask(storage StorageService, logger *log.Logger, catalog *i18n.Catalog) ScheduledTask {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	return func(ctx context.Context, args map[string]string) (string, error) {
+		period, err := time.ParseDuration(argString(args, "period", "24h"))
+		if err != nil {
+			return "", fmt.Errorf("invalid period: %w", err)
+		}
+
+		end := time.Now()
+		stats, err := storage.GetStats(end.Add(-period), end)
+		if err != nil {
+			return "", err
+		}
+
+		language := argString(args, "language", catalog.Language())
+		digest := formatDigest(catalog, language, stats, period)
+		for _, line := range strings.Split(digest, "\n") {
+			logger.Printf("📰 %s", line)
+		}
+
+		webhookURL := argString(args, "webhook_url", "")
+		if webhookURL == "" {
+			return fmt.Sprintf("%d request(s) summarized", stats.Requests), nil
+		}
+
+		payload, _ := json.Marshal(map[string]string{"text": digest})
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(payload))
+		if err != nil {
+			return "", fmt.Errorf("failed to create webhook request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("failed to post digest: %w", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return "", fmt.Errorf("digest webhook returned %d", resp.StatusCode)
+		}
+
+		return fmt.Sprintf("%d request(s) summarized and posted", stats.Requests), nil
+	}
+}
+
+func formatDigest(catalog *i18n.Catalog, language string, stats *model.UsageStats, period time.Duration) string {
+	var b strings.Builder
+	b.WriteString(catalog.Sprintf(language, "Usage digest for the last %s", period) + "\n")
+	b.WriteString(catalog.Sprintf(language, "Requests: %d (%d errors)", stats.Requests, stats.Errors) + "\n")
+	b.WriteString(catalog.Sprintf(language, "Tokens: %d in / %d out / %d cache read / %d cache write",
+		stats.InputTokens, stats.OutputTokens, stats.CacheReadTokens, stats.CacheCreationTokens) + "\n")
+	b.WriteString(catalog.Sprintf(language, "Transferred: %s sent / %s received on the wire",
+		formatBytes(stats.RequestWireBytes), formatBytes(stats.ResponseWireBytes)) + "\n")
+	for _, m := range stats.Models {
+		name := m.Model
+		if name == "" {
+			name = catalog.Translate(language, "(unknown)")
+		}
+		b.WriteString("  " + catalog.Sprintf(language, "%s: %d request(s), %d in / %d out", name, m.Requests, m.InputTokens, m.OutputTokens) + "\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// evalMaxTokens bounds each eval case's answer unless the "max_tokens" arg
+// sets another limit
+const evalMaxTokens = 1024
+
+// evalCase is one prompt of an eval suite and what its answer must contain
+type evalCase struct {
+	Name   string `json:"name"`
+	Model  string `json:"model"`
+	System string `json:"system"`
+	Prompt string `json:"prompt"`
+	Expect string `json:"expect"` // text the answer must contain, ignoring case
+	Match  string `json:"match"`  // regular expression the answer must match
+}
+
+// NewEvalSuiteTask runs the eval suite in the "suite" arg, a JSON array of
+// cases, through the providers requests are routed to. Each case sends its
+// prompt to its model, or the "model" arg (by default the grading model), and
+// passes when the answer contains its "expect" text and matches its "match"
+// expression. Providers answer with keys of their own, as nothing calls the
+// task with credentials. The run fails when any case does.
+func NewEvalSuiteTask(router *ModelRouter) ScheduledTask {
+	return func(ctx context.Context, args map[string]string) (string, error) {
+		path := argString(args, "suite", "")
+		if path == "" {
+			return "", fmt.Errorf("suite is required")
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read eval suite: %w", err)
+		}
+		var cases []evalCase
+		if err := json.Unmarshal(data, &cases); err != nil {
+			return "", fmt.Errorf("invalid eval suite: %w", err)
+		}
+		if len(cases) == 0 {
+			return "", fmt.Errorf("eval suite has no cases")
+		}
+		defaultModel := argString(args, "model", gradingModel)
+		maxTokens := argInt(args, "max_tokens", evalMaxTokens)
+
+		var failed []string
+		for i, c := range cases {
+			if c.Name == "" {
+				c.Name = fmt.Sprintf("case %d", i+1)
+			}
+			if c.Model == "" {
+				c.Model = defaultModel
+			}
+			if err := runEvalCase(ctx, router, c, maxTokens); err != nil {
+				if ctx.Err() != nil {
+					return "", ctx.Err()
+				}
+				failed = append(failed, fmt.Sprintf("%s (%v)", c.Name, err))
+			}
+		}
+
+		result := fmt.Sprintf("%d/%d eval case(s) passed", len(cases)-len(failed), len(cases))
+		if len(failed) > 0 {
+			return result, fmt.Errorf("failed: %s", strings.Join(failed, "; "))
+		}
+		return result, nil
+	}
+}
+
+// runEvalCase sends an eval case's prompt and checks the answer against it
+func runEvalCase(ctx context.Context, router *ModelRouter, c evalCase, maxTokens int) error {
+	var pattern *regexp.Regexp
+	if c.Match != "" {
+		var err error
+		if pattern, err = regexp.Compile(c.Match); err != nil {
+			return fmt.Errorf("invalid match: %w", err)
+		}
+	}
+	p := router.providerFor(c.Model, "")
+	if p == nil {
+		return fmt.Errorf("no provider for %s", c.Model)
+	}
+
+	req := model.AnthropicRequest{
+		Model:     c.Model,
+		MaxTokens: maxTokens,
+		Messages:  []model.AnthropicMessage{{Role: "user", Content: c.Prompt}},
+	}
+	if c.System != "" {
+		req.System = []model.AnthropicSystemMessage{{Type: "text", Text: c.System}}
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.ForwardRequest(ctx, httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxGradingResponse))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("model answered %d", resp.StatusCode)
+	}
+
+	answer := responseText(&model.ResponseLog{StatusCode: resp.StatusCode, Body: respBody})
+	if c.Expect != "" && !strings.Contains(strings.ToLower(answer), strings.ToLower(c.Expect)) {
+		return fmt.Errorf("answer doesn't contain %q", c.Expect)
+	}
+	if pattern != nil && !pattern.MatchString(answer) {
+		return fmt.Errorf("answer doesn't match %q", c.Match)
+	}
+	return nil
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. "1.5 MiB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func argString(args map[string]string, key, defaultValue string) string {
+	if value, ok := args[key]; ok && value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func argInt(args map[string]string, key string, defaultValue int) int {
+	value, err := strconv.Atoi(argString(args, key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+// evalProvider answers every request with the text it's configured with for
+// the requested model
+type evalProvider struct {
+	answers map[string]string
+}
+
+func (p *evalProvider) Name() string {
+	return "anthropic"
+}
+
+func (p *evalProvider) ForwardRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	var body model.AnthropicRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	answer, ok := p.answers[body.Model]
+	if !ok {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader(`{"type": "error"}`))}, nil
+	}
+	content, _ := json.Marshal(map[string]interface{}{"content": []map[string]string{{"type": "text", "text": answer}}})
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(string(content)))}, nil
+}
+
+func TestEvalSuiteTask(t *testing.T) {
+	p := &evalProvider{answers: map[string]string{
+		"claude-sonnet-4": "The capital of France is Paris.",
+		"claude-haiku-4":  "Sorry, I don't know.",
+	}}
+	router := NewModelRouter(&config.Config{}, map[string]provider.Provider{"anthropic": p}, log.New(io.Discard, "", 0))
+	task := NewEvalSuiteTask(router)
+
+	dir := t.TempDir()
+	writeSuite := func(name, suite string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(suite), 0644); err != nil {
+			t.Fatalf("failed to write suite: %v", err)
+		}
+		return path
+	}
+	passing := writeSuite("passing.json", `[
+		{"name": "capital", "prompt": "What is the capital of France?", "expect": "paris"},
+		{"name": "sentence", "prompt": "Answer in a sentence", "match": "\\.$"}
+	]`)
+	failing := writeSuite("failing.json", `[
+		{"name": "capital", "prompt": "What is the capital of France?", "expect": "Paris"},
+		{"name": "small model", "model": "claude-haiku-4", "prompt": "What is the capital of France?", "expect": "Paris"},
+		{"name": "unknown model", "model": "claude-next", "prompt": "Hi"}
+	]`)
+
+	tests := []struct {
+		name           string
+		args           map[string]string
+		expectedResult string
+		expectedError  string
+	}{
+		{"No suite", map[string]string{}, "", "suite is required"},
+		{"Missing suite", map[string]string{"suite": filepath.Join(dir, "missing.json")}, "", "failed to read eval suite"},
+		{"Empty suite", map[string]string{"suite": writeSuite("empty.json", "[]")}, "", "no cases"},
+		{"Invalid suite", map[string]string{"suite": writeSuite("invalid.json", "{")}, "", "invalid eval suite"},
+		{"Passing", map[string]string{"suite": passing, "model": "claude-sonnet-4"}, "2/2 eval case(s) passed", ""},
+		{"Failing", map[string]string{"suite": failing, "model": "claude-sonnet-4"}, "1/3 eval case(s) passed", "small model"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := task(context.Background(), tt.args)
+			if result != tt.expectedResult {
+				t.Errorf("result = %q, want %q", result, tt.expectedResult)
+			}
+			if tt.expectedError == "" && err != nil {
+				t.Errorf("task() returned error: %v", err)
+			}
+			if tt.expectedError != "" && (err == nil || !strings.Contains(err.Error(), tt.expectedError)) {
+				t.Errorf("task() error = %v, want one mentioning %q", err, tt.expectedError)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// maxUnknownFields bounds how many distinct unknown fields are remembered, in
+// case a client sends keys that are really data
+const maxUnknownFields = 500
+
+// Where an unknown field was seen
+const (
+	SchemaSourceRequest  = "request"
+	SchemaSourceResponse = "response"
+	SchemaSourceStream   = "stream"
+)
+
+// responseSchema is a non-streaming response as the proxy models it. Content
+// blocks are read with the richer streaming ContentBlock.
+type responseSchema struct {
+	model.AnthropicResponse
+	Content []model.ContentBlock `json:"content"`
+}
+
+// streamEventSchema is a streaming event as the proxy models it: the structured
+// StreamingEvent plus the message and usage it reads from message_start and
+// message_delta
+type streamEventSchema struct {
+	model.StreamingEvent
+	Message *responseSchema       `json:"message,omitempty"`
+	Usage   *model.AnthropicUsage `json:"usage,omitempty"`
+}
+
+var (
+	requestSchemaType     = reflect.TypeOf(model.AnthropicRequest{})
+	responseSchemaType    = reflect.TypeOf(responseSchema{})
+	streamEventSchemaType = reflect.TypeOf(streamEventSchema{})
+	rawMessageType        = reflect.TypeOf(json.RawMessage{})
+)
+
+// SchemaTracker notices JSON fields in requests and upstream responses that the
+// proxy's models don't represent, which usually means the API gained a feature
+// the proxy doesn't know about yet. Each one is logged the first time it shows
+// up and counted for the unknown fields report.
+// Free-form values (message content, tool input, JSON schemas) aren't checked.
+type SchemaTracker struct {
+	mu     sync.Mutex
+	fields map[string]*model.UnknownField // source + path -> field
+	logger *log.Logger
+}
+
+func NewSchemaTracker(logger *log.Logger) *SchemaTracker {
+	return &SchemaTracker{
+		fields: make(map[string]*model.UnknownField),
+		logger: logger,
+	}
+}
+
+// ObserveRequest checks a /v1/messages request body
+func (t *SchemaTracker) ObserveRequest(requestID string, body []byte) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return
+	}
+	t.walk(SchemaSourceRequest, requestID, "", value, requestSchemaType)
+}
+
+// ObserveResponse checks a successful non-streaming response body
+func (t *SchemaTracker) ObserveResponse(requestID string, body []byte) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return
+	}
+	t.walk(SchemaSourceResponse, requestID, "", value, responseSchemaType)
+}
+
+// ObserveStreamEvent checks one decoded streaming event. Paths are prefixed
+// with the event type, since each type carries different fields.
+func (t *SchemaTracker) ObserveStreamEvent(requestID string, event map[string]interface{}) {
+	eventType, _ := event["type"].(string)
+	if eventType == "" {
+		eventType = "unknown"
+	}
+	t.walk(SchemaSourceStream, requestID, eventType, event, streamEventSchemaType)
+}
+
+// Report lists the unknown fields seen since startup, most frequent first
+func (t *SchemaTracker) Report() []model.UnknownField {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := make([]model.UnknownField, 0, len(t.fields))
+	for _, field := range t.fields {
+		report = append(report, *field)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Count != report[j].Count {
+			return report[i].Count > report[j].Count
+		}
+		if report[i].Source != report[j].Source {
+			return report[i].Source < report[j].Source
+		}
+		return report[i].Path < report[j].Path
+	})
+	return report
+}
+
+func (t *SchemaTracker) walk(source, requestID, path string, value interface{}, typ reflect.Type) {
+	findUnknownFields(path, value, typ, func(fieldPath string) {
+		t.record(source, requestID, fieldPath)
+	})
+}
+
+// findUnknownFields calls found with the path of every key in value that typ
+// has no JSON field for, descending into known fields
+func findUnknownFields(path string, value interface{}, typ reflect.Type, found func(path string)) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := jsonFields(typ)
+		for key, v := range obj {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+			fieldType, known := fields[key]
+			if !known {
+				found(fieldPath)
+				continue
+			}
+			findUnknownFields(fieldPath, v, fieldType, found)
+		}
+
+	case reflect.Slice, reflect.Array:
+		if typ == rawMessageType {
+			return
+		}
+		items, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+		for _, item := range items {
+			findUnknownFields(path+"[]", item, typ.Elem(), found)
+		}
+	}
+	// Maps and interface{} fields accept anything
+}
+
+// structFields caches jsonFields by struct type
+var structFields sync.Map
+
+// jsonFields maps the JSON names of typ's fields to their types. Fields of
+// embedded structs are included unless the outer struct declares the same name.
+func jsonFields(typ reflect.Type) map[string]reflect.Type {
+	if cached, ok := structFields.Load(typ); ok {
+		return cached.(map[string]reflect.Type)
+	}
+
+	fields := make(map[string]reflect.Type)
+	var embedded []reflect.Type
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			embedded = append(embedded, field.Type)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	for _, embeddedType := range embedded {
+		for name, fieldType := range jsonFields(embeddedType) {
+			if _, ok := fields[name]; !ok {
+				fields[name] = fieldType
+			}
+		}
+	}
+
+	structFields.Store(typ, fields)
+	return fields
+}
+
+func (t *SchemaTracker) record(source, requestID, path string) {
+	now := time.Now().Format(time.RFC3339)
+	key := source + ":" + path
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if field, ok := t.fields[key]; ok {
+		field.Count++
+		field.LastSeen = now
+		return
+	}
+	if len(t.fields) >= maxUnknownFields {
+		return
+	}
+
+	t.fields[key] = &model.UnknownField{
+		Source:           source,
+		Path:             path,
+		Count:            1,
+		FirstSeen:        now,
+		LastSeen:         now,
+		ExampleRequestID: requestID,
+	}
+	t.logger.Printf("🔎 Unknown %s field %q (first seen in request %s)", source, path, requestID)
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"testing"
+)
+
+func TestSchemaTracker(t *testing.T) {
+	tracker := NewSchemaTracker(log.New(io.Discard, "", 0))
+
+	tracker.ObserveRequest("req-1", []byte(`{
+		"model": "claude-sonnet-4",
+		"max_tokens": 1024,
+		"thinking": {"type": "enabled", "budget_tokens": 2048},
+		"system": [{"type": "text", "text": "hi", "citations": []}],
+		"messages": [{"role": "user", "content": [{"type": "text", "text": "hello", "anything": 1}]}],
+		"tools": [{"name": "Read", "input_schema": {"type": "object", "properties": {"path": {"type": "string"}}, "additionalProperties": false}}],
+		"metadata": {"user_id": "u"}
+	}`))
+	tracker.ObserveRequest("req-2", []byte(`{"model": "claude-sonnet-4", "thinking": {"type": "enabled"}}`))
+
+	tracker.ObserveResponse("req-1", []byte(`{
+		"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-sonnet-4",
+		"content": [{"type": "tool_use", "id": "t1", "name": "Read", "input": {"path": "a"}}, {"type": "text", "text": "x", "citations": []}],
+		"usage": {"input_tokens": 1, "output_tokens": 1, "server_tool_use": {"web_search_requests": 1}}
+	}`))
+
+	var event map[string]interface{}
+	json.Unmarshal([]byte(`{"type": "content_block_delta", "index": 0, "delta": {"type": "signature_delta", "signature": "abc"}}`), &event)
+	tracker.ObserveStreamEvent("req-3", event)
+
+	got := make(map[string]int64)
+	for _, field := range tracker.Report() {
+		got[field.Source+":"+field.Path] = field.Count
+	}
+
+	want := map[string]int64{
+		"request:thinking":                                  2,
+		"request:system[].citations":                        1,
+		"request:tools[].input_schema.additionalProperties": 1,
+		"response:content[].citations":                      1,
+		"response:usage.server_tool_use":                    1,
+		"stream:content_block_delta.delta.signature":        1,
+	}
+	for key, count := range want {
+		if got[key] != count {
+			t.Errorf("%s count = %d, want %d", key, got[key], count)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("unexpected unknown fields %v", got)
+	}
+
+	if report := tracker.Report(); report[0].Path != "thinking" || report[0].ExampleRequestID != "req-1" {
+		t.Errorf("expected the most frequent field first, got %+v", report[0])
+	}
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// searchSkippedKeys are JSON fields whose values are identifiers, markers or
+// encoded data rather than text anyone would search for
+var searchSkippedKeys = map[string]bool{
+	"type":          true,
+	"id":            true,
+	"tool_use_id":   true,
+	"signature":     true,
+	"cache_control": true,
+	"source":        true,
+	"data":          true,
+}
+
+// requestSearchText extracts the searchable text of a request body: what was
+// said in its messages, including tool calls and results. The system prompt
+// and tool definitions are left out since they're the same in every request.
+func requestSearchText(body []byte) string {
+	var request struct {
+		Messages []struct {
+			Content interface{} `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return ""
+	}
+
+	var parts []string
+	for _, message := range request.Messages {
+		collectSearchText(message.Content, &parts)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// responseSearchText extracts the searchable text of a response: the content
+// of a JSON body, including tool calls and error messages, or a text body
+func responseSearchText(response *model.ResponseLog) string {
+	if response == nil {
+		return ""
+	}
+	if len(response.Body) > 0 {
+		var body interface{}
+		if err := json.Unmarshal(response.Body, &body); err == nil {
+			var parts []string
+			collectSearchText(body, &parts)
+			return strings.Join(parts, "\n")
+		}
+	}
+	return response.BodyText
+}
+
+func collectSearchText(value interface{}, parts *[]string) {
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			*parts = append(*parts, v)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectSearchText(item, parts)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			if !searchSkippedKeys[key] {
+				collectSearchText(item, parts)
+			}
+		}
+	}
+}
+
+// searchTerms splits a search query into words, keeping "quoted phrases"
+// together. Every term must match for a request to be found.
+func searchTerms(query string) []string {
+	var terms []string
+	for i, part := range strings.Split(query, `"`) {
+		if i%2 == 1 {
+			if phrase := strings.Join(strings.Fields(part), " "); phrase != "" {
+				terms = append(terms, phrase)
+			}
+			continue
+		}
+		terms = append(terms, strings.Fields(part)...)
+	}
+	return terms
+}
+
+// ftsQuery turns search terms into an FTS5 query matching all of them, with
+// each one quoted so operators and punctuation in the query are taken literally
+func ftsQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// likePattern matches term anywhere in a column, escaping LIKE's wildcards
+func likePattern(term string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+	return "%" + escaped + "%"
+}
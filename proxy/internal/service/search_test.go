@@ -0,0 +1,85 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{"Words", "auth  middleware", []string{"auth", "middleware"}},
+		{"Phrase", `rewrote "auth   middleware" today`, []string{"rewrote", "auth middleware", "today"}},
+		{"Unclosed quote", `"auth middleware`, []string{"auth middleware"}},
+		{"Empty phrase", `"" auth`, []string{"auth"}},
+		{"Blank", "   ", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := searchTerms(tt.query); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("searchTerms(%q) = %q, want %q", tt.query, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFTSQuery(t *testing.T) {
+	got := ftsQuery([]string{"auth middleware", `say "hi"`, "NOT"})
+	want := `"auth middleware" "say ""hi""" "NOT"`
+	if got != want {
+		t.Errorf("ftsQuery() = %s, want %s", got, want)
+	}
+}
+
+func TestRequestSearchText(t *testing.T) {
+	body := `{
+		"system": [{"type": "text", "text": "You are Claude Code"}],
+		"tools": [{"name": "Edit", "description": "Edits files"}],
+		"messages": [
+			{"role": "user", "content": "Rewrite the auth middleware"},
+			{"role": "assistant", "content": [{"type": "tool_use", "id": "toolu_1", "name": "Edit", "input": {"file_path": "middleware/auth.go"}}]},
+			{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "toolu_1", "content": "File updated"}, {"type": "image", "source": {"type": "base64", "data": "iVBORw0KGgo"}}]}
+		]
+	}`
+
+	text := requestSearchText([]byte(body))
+	for _, want := range []string{"Rewrite the auth middleware", "middleware/auth.go", "File updated"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("search text %q doesn't contain %q", text, want)
+		}
+	}
+	for _, unwanted := range []string{"You are Claude Code", "Edits files", "toolu_1", "iVBORw0KGgo"} {
+		if strings.Contains(text, unwanted) {
+			t.Errorf("search text %q contains %q", text, unwanted)
+		}
+	}
+}
+
+func TestResponseSearchText(t *testing.T) {
+	tests := []struct {
+		name     string
+		response *model.ResponseLog
+		expected string
+	}{
+		{"Content", &model.ResponseLog{Body: json.RawMessage(`{"id":"msg_1","type":"message","content":[{"type":"text","text":"Done"}]}`)}, "Done"},
+		{"Error", &model.ResponseLog{Body: json.RawMessage(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)}, "Overloaded"},
+		{"Text body", &model.ResponseLog{BodyText: "Bad Gateway"}, "Bad Gateway"},
+		{"None", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := responseSearchText(tt.response); got != tt.expected {
+				t.Errorf("responseSearchText() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+const (
+	// sessionActiveWindow is how recently a session must have made a request
+	// to count as active, and the window its burn rate is measured over
+	sessionActiveWindow = 5 * time.Minute
+	// sessionExpiry is how long a session is remembered after its last request
+	sessionExpiry = time.Hour
+)
+
+// workingDirectoryPattern finds the working directory in the environment
+// block Claude Code puts in its system prompt
+var workingDirectoryPattern = regexp.MustCompile(`(?m)^\s*Working directory:\s*(\S.*?)\s*$`)
+
+// SessionTracker follows Claude Code sessions running at the same time, such
+// as one per terminal, so their requests can be told apart. Sessions are keyed
+// by Claude Code's session metadata; requests without it aren't tracked.
+type SessionTracker struct {
+	prices *PriceTable
+	now    func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*sessionActivity
+}
+
+type sessionActivity struct {
+	workspace   string
+	model       string
+	startedAt   time.Time
+	lastRequest time.Time
+	requests    int
+	inFlight    int
+	samples     []burnSample // within sessionActiveWindow, oldest first
+}
+
+func NewSessionTracker(prices *PriceTable) *SessionTracker {
+	return &SessionTracker{
+		prices:   prices,
+		now:      time.Now,
+		sessions: make(map[string]*sessionActivity),
+	}
+}
+
+// Start notes a request of a session that is about to be forwarded
+func (t *SessionTracker) Start(req *model.AnthropicRequest, routedModel string) {
+	key := trackedSession(req)
+	if key == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.expire(now)
+	session, ok := t.sessions[key]
+	if !ok {
+		session = &sessionActivity{startedAt: now}
+		t.sessions[key] = session
+	}
+	if workspace := requestWorkspace(req); workspace != "" {
+		session.workspace = workspace
+	}
+	session.model = routedModel
+	session.lastRequest = now
+	session.requests++
+	session.inFlight++
+}
+
+// Finish records what a request started with Start used
+func (t *SessionTracker) Finish(req *model.AnthropicRequest, request *model.RequestLog) {
+	key := trackedSession(req)
+	if key == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	session, ok := t.sessions[key]
+	if !ok {
+		return
+	}
+	if session.inFlight > 0 {
+		session.inFlight--
+	}
+
+	now := t.now()
+	session.lastRequest = now
+	session.prune(now)
+	if request.Response == nil || request.Response.StatusCode >= 400 {
+		return
+	}
+	if usage := responseUsage(request.Response); usage != nil {
+		cost, _ := t.prices.Cost(request.RoutedModel, usage)
+		session.samples = append(session.samples, burnSample{
+			at: now,
+			tokens: int64(usage.InputTokens + usage.OutputTokens +
+				usage.CacheReadInputTokens + usage.CacheCreationInputTokens),
+			output: int64(usage.OutputTokens),
+			cost:   cost,
+		})
+	}
+}
+
+// Active lists the sessions with a request in flight or within the last few
+// minutes, busiest first, with each one's share of the tokens burned
+func (t *SessionTracker) Active() model.ActiveSessions {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.expire(now)
+	minutes := sessionActiveWindow.Minutes()
+	active := model.ActiveSessions{
+		Window:     formatWindow(sessionActiveWindow),
+		Sessions:   []model.SessionActivity{},
+		Workspaces: []model.WorkspaceActivity{},
+	}
+
+	var totalTokens int64
+	workspaces := make(map[string]*model.WorkspaceActivity)
+	for key, session := range t.sessions {
+		if session.inFlight == 0 && now.Sub(session.lastRequest) > sessionActiveWindow {
+			continue
+		}
+		session.prune(now)
+
+		activity := model.SessionActivity{
+			Session:       key,
+			Workspace:     session.workspace,
+			Model:         session.model,
+			StartedAt:     session.startedAt.Format(time.RFC3339),
+			LastRequestAt: session.lastRequest.Format(time.RFC3339),
+			Requests:      session.requests,
+			InFlight:      session.inFlight,
+		}
+		var cost float64
+		for _, sample := range session.samples {
+			activity.Tokens += sample.tokens
+			cost += sample.cost
+		}
+		activity.TokensPerMinute = float64(activity.Tokens) / minutes
+		activity.CostPerMinute = cost / minutes
+		totalTokens += activity.Tokens
+		active.TokensPerMinute += activity.TokensPerMinute
+		active.CostPerMinute += activity.CostPerMinute
+		active.Sessions = append(active.Sessions, activity)
+
+		workspace, ok := workspaces[session.workspace]
+		if !ok {
+			workspace = &model.WorkspaceActivity{Workspace: session.workspace}
+			workspaces[session.workspace] = workspace
+		}
+		workspace.Sessions++
+		workspace.TokensPerMinute += activity.TokensPerMinute
+	}
+	active.Active = len(active.Sessions)
+
+	for i := range active.Sessions {
+		if totalTokens > 0 {
+			active.Sessions[i].Share = roundTo(100*float64(active.Sessions[i].Tokens)/float64(totalTokens), 1)
+		}
+	}
+	sort.Slice(active.Sessions, func(i, j int) bool {
+		if active.Sessions[i].Tokens != active.Sessions[j].Tokens {
+			return active.Sessions[i].Tokens > active.Sessions[j].Tokens
+		}
+		return active.Sessions[i].LastRequestAt > active.Sessions[j].LastRequestAt
+	})
+	if len(active.Sessions) > 0 && active.Sessions[0].Tokens > 0 {
+		active.Top = active.Sessions[0].Session
+	}
+
+	for _, workspace := range workspaces {
+		active.Workspaces = append(active.Workspaces, *workspace)
+	}
+	sort.Slice(active.Workspaces, func(i, j int) bool {
+		if active.Workspaces[i].TokensPerMinute != active.Workspaces[j].TokensPerMinute {
+			return active.Workspaces[i].TokensPerMinute > active.Workspaces[j].TokensPerMinute
+		}
+		return active.Workspaces[i].Workspace < active.Workspaces[j].Workspace
+	})
+	return active
+}
+
+// prune drops samples older than the active window
+func (s *sessionActivity) prune(now time.Time) {
+	cutoff := now.Add(-sessionActiveWindow)
+	i := 0
+	for i < len(s.samples) && !s.samples[i].at.After(cutoff) {
+		i++
+	}
+	s.samples = s.samples[i:]
+}
+
+// expire forgets sessions with no recent requests; t.mu must be held
+func (t *SessionTracker) expire(now time.Time) {
+	for key, session := range t.sessions {
+		if session.inFlight == 0 && now.Sub(session.lastRequest) > sessionExpiry {
+			delete(t.sessions, key)
+		}
+	}
+}
+
+// SessionID is the conversation a request is stored under: the session in
+// Claude Code's metadata.user_id, or for clients that don't send one, "fp-"
+// and a fingerprint of the opening user message, which every turn repeats
+func SessionID(req *model.AnthropicRequest) string {
+	key := sessionKey(req)
+	if key == "" || (req.Metadata != nil && req.Metadata.UserID != "") {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "fp-" + hex.EncodeToString(sum[:8])
+}
+
+// bodySessionID is the SessionID of a stored request body, or "" when it
+// isn't a Messages request
+func bodySessionID(body []byte) string {
+	var req model.AnthropicRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+	return SessionID(&req)
+}
+
+// bodyProject returns the working directory Claude Code reports in a stored
+// request body, the project the request was made for
+func bodyProject(body []byte) string {
+	var req model.AnthropicRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+	return requestWorkspace(&req)
+}
+
+func trackedSession(req *model.AnthropicRequest) string {
+	if req.Metadata == nil || req.Metadata.UserID == "" {
+		return ""
+	}
+	return sessionKey(req)
+}
+
+// requestWorkspace returns the working directory Claude Code reports in the
+// system prompt, or in the first user message's reminders
+func requestWorkspace(req *model.AnthropicRequest) string {
+	var texts []string
+	for _, system := range req.System {
+		texts = append(texts, system.Text)
+	}
+	for i := range req.Messages {
+		if req.Messages[i].Role == "user" {
+			texts = append(texts, messageText(&req.Messages[i]))
+			break
+		}
+	}
+	for _, text := range texts {
+		if !strings.Contains(text, "Working directory:") {
+			continue
+		}
+		if match := workingDirectoryPattern.FindStringSubmatch(text); match != nil {
+			return match[1]
+		}
+	}
+	return ""
+}
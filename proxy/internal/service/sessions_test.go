@@ -0,0 +1,126 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestSessionTracker(t *testing.T) {
+	now := time.Date(2025, 3, 4, 10, 0, 0, 0, time.UTC)
+	tracker := NewSessionTracker(NewPriceTable(nil))
+	tracker.now = func() time.Time { return now }
+
+	request := func(session, workspace string) *model.AnthropicRequest {
+		req := &model.AnthropicRequest{
+			Model:    "claude-sonnet-4-20250514",
+			Metadata: &model.RequestMetadata{UserID: "user_abc_account__session_" + session},
+			Messages: []model.AnthropicMessage{{Role: "user", Content: "fix it"}},
+		}
+		if workspace != "" {
+			req.System = []model.AnthropicSystemMessage{{Text: "You are Claude Code.\n<env>\nWorking directory: " + workspace + "\nIs directory a git repo: Yes\n</env>"}}
+		}
+		return req
+	}
+	completed := func(routedModel string, inputTokens int) *model.RequestLog {
+		body, _ := json.Marshal(map[string]interface{}{"usage": map[string]int{"input_tokens": inputTokens}})
+		return &model.RequestLog{RoutedModel: routedModel, Response: &model.ResponseLog{StatusCode: 200, Body: body}}
+	}
+
+	// Two terminals in one repo and one in another; b burns the most
+	for _, r := range []struct {
+		session, workspace string
+		tokens             int
+	}{
+		{"a", "/src/api", 1000},
+		{"b", "/src/api", 8000},
+		{"c", "/src/web", 1000},
+	} {
+		req := request(r.session, r.workspace)
+		tracker.Start(req, "claude-sonnet-4-20250514")
+		tracker.Finish(req, completed("claude-sonnet-4-20250514", r.tokens))
+	}
+	// A request still in flight, and one without session metadata
+	tracker.Start(request("c", ""), "gpt-4o")
+	tracker.Start(&model.AnthropicRequest{Model: "claude-sonnet-4-20250514"}, "claude-sonnet-4-20250514")
+
+	active := tracker.Active()
+	if active.Active != 3 || active.Top != "b" {
+		t.Fatalf("Active() = %d sessions, top %q, want 3 and b", active.Active, active.Top)
+	}
+	top := active.Sessions[0]
+	if top.Session != "b" || top.Workspace != "/src/api" || top.Tokens != 8000 || top.Share != 80 || top.TokensPerMinute != 1600 {
+		t.Errorf("unexpected top session %+v", top)
+	}
+	for _, session := range active.Sessions {
+		if session.Session == "c" && (session.InFlight != 1 || session.Model != "gpt-4o" || session.Workspace != "/src/web") {
+			t.Errorf("unexpected session c %+v", session)
+		}
+	}
+	if len(active.Workspaces) != 2 || active.Workspaces[0].Workspace != "/src/api" || active.Workspaces[0].Sessions != 2 {
+		t.Errorf("unexpected workspaces %+v", active.Workspaces)
+	}
+
+	// Later, only the session with a request in flight is still active
+	now = now.Add(10 * time.Minute)
+	active = tracker.Active()
+	if active.Active != 1 || active.Sessions[0].Session != "c" || active.Sessions[0].Tokens != 0 || active.Top != "" {
+		t.Errorf("after the window: %+v", active)
+	}
+}
+
+func TestRequestWorkspace(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      *model.AnthropicRequest
+		expected string
+	}{
+		{"System prompt", &model.AnthropicRequest{System: []model.AnthropicSystemMessage{{Text: "<env>\nWorking directory: /home/me/my project\n</env>"}}}, "/home/me/my project"},
+		{"First user message", &model.AnthropicRequest{Messages: []model.AnthropicMessage{{Role: "user", Content: "<system-reminder>\nWorking directory: /tmp/x\n</system-reminder>"}}}, "/tmp/x"},
+		{"None", &model.AnthropicRequest{Messages: []model.AnthropicMessage{{Role: "user", Content: "hello"}}}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := requestWorkspace(tt.req); got != tt.expected {
+				t.Errorf("requestWorkspace() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSessionID(t *testing.T) {
+	opening := model.AnthropicMessage{Role: "user", Content: "fix the flaky test"}
+	firstTurn := &model.AnthropicRequest{Messages: []model.AnthropicMessage{opening}}
+	laterTurn := &model.AnthropicRequest{Messages: []model.AnthropicMessage{
+		opening,
+		{Role: "assistant", Content: "Looking at it"},
+		{Role: "user", Content: "thanks"},
+	}}
+
+	tests := []struct {
+		name     string
+		req      *model.AnthropicRequest
+		expected string
+	}{
+		{"Claude Code session", &model.AnthropicRequest{Metadata: &model.RequestMetadata{UserID: "user_abc_account_123_session_4f2e"}}, "4f2e"},
+		{"User without a session", &model.AnthropicRequest{Metadata: &model.RequestMetadata{UserID: "user_abc"}}, "user_abc"},
+		{"Fingerprint", firstTurn, SessionID(laterTurn)},
+		{"No user message", &model.AnthropicRequest{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SessionID(tt.req); got != tt.expected {
+				t.Errorf("SessionID() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+
+	if got := SessionID(firstTurn); !strings.HasPrefix(got, "fp-") || len(got) != 19 {
+		t.Errorf("SessionID() = %q, want fp- and 16 hex digits", got)
+	}
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+// maxShadowBody bounds how much of a shadow response is kept
+const maxShadowBody = 1 << 20
+
+// ShadowMirror sends copies of live requests to a shadow model in the
+// background and stores what it answers next to the primary response. Copies
+// never delay or affect the client's request: they are dropped when
+// MaxConcurrent shadow requests are already in flight or the mirror is disabled.
+type ShadowMirror struct {
+	model    string
+	provider provider.Provider
+	models   []string // lowercased substrings of the requested model
+	percent  int
+	timeout  time.Duration
+	slots    chan struct{}
+
+	enabled  atomic.Bool
+	mirrored atomic.Int64
+	dropped  atomic.Int64
+	failed   atomic.Int64
+
+	storage StorageService
+	logger  *log.Logger
+}
+
+func NewShadowMirror(cfg *config.ShadowConfig, router *ModelRouter, storage StorageService, logger *log.Logger) *ShadowMirror {
+	maxConcurrent := cfg.MaxConcurrent
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+	timeout, err := time.ParseDuration(cfg.Timeout)
+	if err != nil || timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+
+	s := &ShadowMirror{
+		model:   cfg.Model,
+		percent: cfg.Percent,
+		timeout: timeout,
+		slots:   make(chan struct{}, maxConcurrent),
+		storage: storage,
+		logger:  logger,
+	}
+	for _, m := range cfg.Models {
+		s.models = append(s.models, strings.ToLower(m))
+	}
+
+	if cfg.Model != "" {
+		s.provider = router.providerFor(cfg.Model, cfg.Provider)
+	}
+	if cfg.Enable && s.provider != nil {
+		s.enabled.Store(true)
+		logger.Printf("👥 Shadowing %d%% of traffic to %s (%s)", s.percent, s.model, s.provider.Name())
+	}
+
+	return s
+}
+
+// SetEnabled flips the kill switch. Enabling has no effect without a shadow model.
+func (s *ShadowMirror) SetEnabled(enabled bool) bool {
+	if s.provider == nil {
+		enabled = false
+	}
+	s.enabled.Store(enabled)
+	return enabled
+}
+
+func (s *ShadowMirror) Status() model.ShadowStatus {
+	status := model.ShadowStatus{
+		Enabled:       s.enabled.Load(),
+		Model:         s.model,
+		Percent:       s.percent,
+		MaxConcurrent: cap(s.slots),
+		InFlight:      len(s.slots),
+		Mirrored:      s.mirrored.Load(),
+		Dropped:       s.dropped.Load(),
+		Failed:        s.failed.Load(),
+	}
+	if s.provider != nil {
+		status.Provider = s.provider.Name()
+	}
+	return status
+}
+
+// Mirror sends a copy of req to the shadow model unless the mirror is off, the
+// request isn't selected, or it is already going to the shadow model. It
+// returns immediately; the shadow response is saved on requestID when it lands.
+func (s *ShadowMirror) Mirror(requestID string, decision *RoutingDecision, req model.AnthropicRequest, header http.Header) {
+	if !s.enabled.Load() || !s.applies(requestID, decision.OriginalModel) {
+		return
+	}
+	if decision.TargetModel == s.model {
+		return
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		s.dropped.Add(1)
+		return
+	}
+	s.mirrored.Add(1)
+
+	header = header.Clone()
+	go func() {
+		defer func() { <-s.slots }()
+		s.send(requestID, req, header)
+	}()
+}
+
+func (s *ShadowMirror) applies(requestID, requestedModel string) bool {
+	if len(s.models) > 0 {
+		requested := strings.ToLower(requestedModel)
+		matched := false
+		for _, m := range s.models {
+			if strings.Contains(requested, m) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(requestID))
+	return int(h.Sum32()%100) < s.percent
+}
+
+func (s *ShadowMirror) send(requestID string, req model.AnthropicRequest, header http.Header) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	shadow := &model.ShadowResponse{
+		Model:    s.model,
+		Provider: s.provider.Name(),
+	}
+	startTime := time.Now()
+
+	// Shadow responses are compared offline, so there is nothing to stream to
+	req.Model = s.model
+	req.Stream = false
+	resp, err := s.forward(ctx, &req, header)
+	if err == nil {
+		defer resp.Body.Close()
+		shadow.StatusCode = resp.StatusCode
+
+		var body []byte
+		body, err = io.ReadAll(io.LimitReader(resp.Body, maxShadowBody))
+		if json.Valid(body) {
+			shadow.Body = body
+		} else {
+			shadow.BodyText = string(body)
+		}
+	}
+	if err != nil {
+		s.failed.Add(1)
+		shadow.Error = err.Error()
+		s.logger.Printf("⚠️ Shadow request to %s failed: %v", s.model, err)
+	}
+
+	shadow.ResponseTime = time.Since(startTime).Milliseconds()
+	shadow.CompletedAt = time.Now().Format(time.RFC3339)
+
+	if err := s.storage.UpdateRequestWithShadow(requestID, shadow); err != nil {
+		s.logger.Printf("❌ Error saving shadow response: %v", err)
+	}
+}
+
+func (s *ShadowMirror) forward(ctx context.Context, req *model.AnthropicRequest, header http.Header) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header = header
+	httpReq.Header.Del("Content-Length")
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	return s.provider.ForwardRequest(ctx, httpReq)
+}
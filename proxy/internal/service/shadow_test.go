@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+// shadowProvider answers every request with a fixed message once release is closed
+type shadowProvider struct {
+	release chan struct{}
+	models  chan string
+}
+
+func (p *shadowProvider) Name() string {
+	return "openai"
+}
+
+func (p *shadowProvider) ForwardRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	p.models <- string(body)
+	<-p.release
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"type":"message","content":[{"type":"text","text":"shadow says hi"}]}`)),
+	}, nil
+}
+
+func TestShadowMirror(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	shadowP := &shadowProvider{release: make(chan struct{}), models: make(chan string, 10)}
+	cfg := &config.Config{
+		Shadow: config.ShadowConfig{
+			Enable:        true,
+			Model:         "gpt-4o",
+			Models:        []string{"sonnet"},
+			Percent:       100,
+			MaxConcurrent: 1,
+		},
+	}
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+		"openai":    shadowP,
+	}
+	logger := log.New(os.Stdout, "test: ", log.LstdFlags)
+	router := NewModelRouter(cfg, providers, logger)
+	mirror := NewShadowMirror(&cfg.Shadow, router, storage, logger)
+
+	newRequest := func(id, modelName string) (*RoutingDecision, model.AnthropicRequest) {
+		req := model.AnthropicRequest{
+			Model:    modelName,
+			Stream:   true,
+			Messages: []model.AnthropicMessage{{Role: "user", Content: "hello"}},
+		}
+		if _, err := storage.SaveRequest(&model.RequestLog{RequestID: id, Timestamp: time.Now().Format(time.RFC3339), Body: req}); err != nil {
+			t.Fatalf("failed to save request: %v", err)
+		}
+		decision, err := router.DetermineRoute(&req)
+		if err != nil {
+			t.Fatalf("DetermineRoute() returned error: %v", err)
+		}
+		return decision, req
+	}
+
+	decision, req := newRequest("req-1", "claude-sonnet-4")
+	mirror.Mirror("req-1", decision, req, http.Header{"X-Api-Key": []string{"secret"}})
+
+	select {
+	case body := <-shadowP.models:
+		if !strings.Contains(body, `"model":"gpt-4o"`) || strings.Contains(body, `"stream":true`) {
+			t.Errorf("unexpected shadow request body %s", body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("shadow request was not sent")
+	}
+
+	// The only slot is busy, so this copy is dropped
+	decision, req = newRequest("req-2", "claude-sonnet-4")
+	mirror.Mirror("req-2", decision, req, http.Header{})
+	// Not a shadowed model
+	decision, req = newRequest("req-3", "claude-3-5-haiku")
+	mirror.Mirror("req-3", decision, req, http.Header{})
+
+	close(shadowP.release)
+	deadline := time.Now().Add(time.Second)
+	for mirror.Status().InFlight > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status := mirror.Status()
+	if status.Mirrored != 1 || status.Dropped != 1 || status.Failed != 0 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	saved, _, err := storage.GetRequestByShortID("req-1")
+	if err != nil {
+		t.Fatalf("GetRequestByShortID() returned error: %v", err)
+	}
+	if saved.Shadow == nil || saved.Shadow.StatusCode != http.StatusOK || !strings.Contains(string(saved.Shadow.Body), "shadow says hi") {
+		t.Errorf("shadow response not stored: %+v", saved.Shadow)
+	}
+	if saved.Shadow != nil && saved.Shadow.Model != "gpt-4o" {
+		t.Errorf("shadow model = %q, want gpt-4o", saved.Shadow.Model)
+	}
+
+	// Kill switch
+	mirror.SetEnabled(false)
+	decision, req = newRequest("req-4", "claude-sonnet-4")
+	mirror.Mirror("req-4", decision, req, http.Header{})
+	if status := mirror.Status(); status.Enabled || status.Mirrored != 1 {
+		t.Errorf("expected disabled mirror to skip requests, got %+v", status)
+	}
+}
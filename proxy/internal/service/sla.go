@@ -0,0 +1,137 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// slaAccumulator collects one provider's samples for the report
+type slaAccumulator struct {
+	sla       model.ProviderSLA
+	latencies []int64
+}
+
+// BuildSLAReport works out each provider's availability, latency percentiles
+// and cost from the month's samples, and checks them against the targets
+func BuildSLAReport(samples []model.ProviderSample, prices *PriceTable, targets model.SLATargets, from, to time.Time) *model.SLAReport {
+	report := &model.SLAReport{
+		Month:     from.Format("2006-01"),
+		From:      from.Format(time.RFC3339),
+		To:        to.Format(time.RFC3339),
+		Targets:   targets,
+		Providers: []model.ProviderSLA{},
+	}
+
+	byProvider := make(map[string]*slaAccumulator)
+	for _, sample := range samples {
+		acc, ok := byProvider[sample.Provider]
+		if !ok {
+			acc = &slaAccumulator{sla: model.ProviderSLA{Provider: sample.Provider}}
+			byProvider[sample.Provider] = acc
+		}
+
+		acc.sla.Requests++
+		switch {
+		case sample.StatusCode >= 500:
+			acc.sla.Failures++
+		case sample.StatusCode == http.StatusTooManyRequests:
+			acc.sla.RateLimited++
+		}
+		if !sample.Failover {
+			acc.latencies = append(acc.latencies, sample.ResponseTime)
+		}
+		if sample.Usage != nil {
+			if cost, ok := prices.Cost(sample.Model, sample.Usage); ok {
+				acc.sla.CostUSD += cost
+			} else {
+				acc.sla.UnpricedRequests++
+			}
+		}
+	}
+
+	for _, acc := range byProvider {
+		sla := acc.sla
+		sla.Availability = roundTo(100*float64(sla.Requests-sla.Failures)/float64(sla.Requests), 3)
+		sort.Slice(acc.latencies, func(i, j int) bool { return acc.latencies[i] < acc.latencies[j] })
+		sla.P50Latency = percentile(acc.latencies, 50)
+		sla.P95Latency = percentile(acc.latencies, 95)
+		sla.CostUSD = roundTo(sla.CostUSD, 4)
+
+		if report.Targets.Availability > 0 {
+			meets := sla.Availability >= report.Targets.Availability
+			sla.MeetsAvailability = &meets
+		}
+		if report.Targets.P95Latency > 0 {
+			meets := sla.P95Latency <= report.Targets.P95Latency
+			sla.MeetsLatency = &meets
+		}
+		report.Providers = append(report.Providers, sla)
+	}
+	sort.Slice(report.Providers, func(i, j int) bool {
+		if report.Providers[i].Requests != report.Providers[j].Requests {
+			return report.Providers[i].Requests > report.Providers[j].Requests
+		}
+		return report.Providers[i].Provider < report.Providers[j].Provider
+	})
+	return report
+}
+
+// SLAReport builds the report for the month starting at from, with the
+// configured prices and targets
+func (r *ModelRouter) SLAReport(samples []model.ProviderSample, from, to time.Time) *model.SLAReport {
+	return BuildSLAReport(samples, r.budget.prices, r.slaTargets, from, to)
+}
+
+func newSLATargets(cfg config.SLAConfig) (model.SLATargets, []error) {
+	var targets model.SLATargets
+	var errs []error
+	if cfg.Availability >= 0 && cfg.Availability <= 100 {
+		targets.Availability = cfg.Availability
+	} else {
+		errs = append(errs, fmt.Errorf("invalid SLA availability %v, want a percent; availability isn't checked", cfg.Availability))
+	}
+	if cfg.P95Latency != "" {
+		latency, err := time.ParseDuration(cfg.P95Latency)
+		if err == nil && latency > 0 {
+			targets.P95Latency = latency.Milliseconds()
+		} else {
+			errs = append(errs, fmt.Errorf("invalid SLA p95_latency %q; latency isn't checked", cfg.P95Latency))
+		}
+	}
+	return targets, errs
+}
+
+// percentile returns the nearest-rank percentile p of sorted values
+func percentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// percentiles ranks sorted timings, nil when there are none
+func percentiles(sorted []int64) *model.Percentiles {
+	if len(sorted) == 0 {
+		return nil
+	}
+	return &model.Percentiles{
+		P50: percentile(sorted, 50),
+		P90: percentile(sorted, 90),
+		P99: percentile(sorted, 99),
+	}
+}
+
+func roundTo(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
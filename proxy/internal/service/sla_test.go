@@ -0,0 +1,77 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestBuildSLAReport(t *testing.T) {
+	from := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	usage := &model.AnthropicUsage{InputTokens: 1000000}
+
+	var samples []model.ProviderSample
+	for i := 1; i <= 20; i++ {
+		samples = append(samples, model.ProviderSample{Provider: "anthropic", Model: "claude-sonnet-4-20250514", StatusCode: 200, ResponseTime: int64(i * 100), Usage: usage})
+	}
+	samples = append(samples,
+		model.ProviderSample{Provider: "anthropic", Model: "claude-sonnet-4-20250514", StatusCode: 529, Failover: true},
+		model.ProviderSample{Provider: "anthropic", Model: "claude-sonnet-4-20250514", StatusCode: 429, ResponseTime: 50},
+		model.ProviderSample{Provider: "openai", Model: "gpt-4o", StatusCode: 200, ResponseTime: 900, Usage: usage},
+		model.ProviderSample{Provider: "openai", Model: "gpt-5-preview", StatusCode: 200, ResponseTime: 1100, Usage: usage},
+	)
+
+	targets, errs := newSLATargets(config.SLAConfig{Availability: 99, P95Latency: "2s"})
+	if len(errs) != 0 {
+		t.Fatalf("newSLATargets() returned errors: %v", errs)
+	}
+	report := BuildSLAReport(samples, NewPriceTable(nil), targets, from, from.AddDate(0, 1, 0))
+
+	if report.Month != "2026-09" || len(report.Providers) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	anthropic, openai := report.Providers[0], report.Providers[1]
+
+	if anthropic.Requests != 22 || anthropic.Failures != 1 || anthropic.RateLimited != 1 {
+		t.Errorf("anthropic counted %d requests, %d failures, %d rate limited", anthropic.Requests, anthropic.Failures, anthropic.RateLimited)
+	}
+	if anthropic.Availability != 95.455 || *anthropic.MeetsAvailability {
+		t.Errorf("anthropic availability = %v (meets %v), want 95.455 (false)", anthropic.Availability, *anthropic.MeetsAvailability)
+	}
+	// The failed-over attempt has no latency; the rate-limited one is fastest
+	if anthropic.P50Latency != 1000 || anthropic.P95Latency != 1900 || !*anthropic.MeetsLatency {
+		t.Errorf("anthropic latency p50 %d, p95 %d (meets %v), want 1000, 1900 (true)", anthropic.P50Latency, anthropic.P95Latency, *anthropic.MeetsLatency)
+	}
+	if anthropic.CostUSD != 60 {
+		t.Errorf("anthropic cost = %v, want 60", anthropic.CostUSD)
+	}
+
+	if openai.Availability != 100 || openai.CostUSD != 2.5 || openai.UnpricedRequests != 1 {
+		t.Errorf("unexpected openai row %+v", openai)
+	}
+}
+
+func TestNewSLATargets(t *testing.T) {
+	tests := []struct {
+		name           string
+		cfg            config.SLAConfig
+		expected       model.SLATargets
+		expectedErrors int
+	}{
+		{"None", config.SLAConfig{}, model.SLATargets{}, 0},
+		{"Both", config.SLAConfig{Availability: 99.9, P95Latency: "45s"}, model.SLATargets{Availability: 99.9, P95Latency: 45000}, 0},
+		{"Invalid latency", config.SLAConfig{Availability: 99, P95Latency: "fast"}, model.SLATargets{Availability: 99}, 1},
+		{"Both invalid", config.SLAConfig{Availability: 120, P95Latency: "-1s"}, model.SLATargets{}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, errs := newSLATargets(tt.cfg)
+			if targets != tt.expected || len(errs) != tt.expectedErrors {
+				t.Errorf("newSLATargets() = %+v, %d errors, want %+v, %d errors", targets, len(errs), tt.expected, tt.expectedErrors)
+			}
+		})
+	}
+}
@@ -1,18 +1,80 @@
 package service
 
 import (
+	"time"
+
 	"github.com/seifghazi/claude-code-monitor/internal/config"
 	"github.com/seifghazi/claude-code-monitor/internal/model"
 )
 
 type StorageService interface {
 	SaveRequest(request *model.RequestLog) (string, error)
+	ImportRequest(request *model.RequestLog) (bool, error)
 	GetRequests(page, limit int) ([]model.RequestLog, int, error)
+	SearchRequests(query string, page, limit int) ([]model.RequestLog, int, error)
 	ClearRequests() (int, error)
 	UpdateRequestWithGrading(requestID string, grade *model.PromptGrade) error
 	UpdateRequestWithResponse(request *model.RequestLog) error
+	UpdateRequestWithShadow(requestID string, shadow *model.ShadowResponse) error
 	EnsureDirectoryExists() error
 	GetRequestByShortID(shortID string) (*model.RequestLog, string, error)
+	GetRequestByID(id string) (*model.RequestLog, error)
 	GetConfig() *config.StorageConfig
-	GetAllRequests(modelFilter string) ([]*model.RequestLog, error)
+	GetAllRequests(filter RequestFilter) ([]*model.RequestLog, error)
+	ExportRequests(start, end time.Time, modelFilter string, fn func(*model.RequestLog) error) error
+	GetStats(start, end time.Time) (*model.UsageStats, error)
+	GetStatsSummary(start, end time.Time) (*model.StatsSummary, error)
+	GetRoutedUsage(start, end time.Time) ([]model.ModelUsage, error)
+	GetModelComparison(models []string, start, end time.Time) (*model.ModelComparison, error)
+	GetClientStats(start, end time.Time) (*model.ClientStats, error)
+	GetSessionRequests(sessionID string) ([]model.RequestLog, error)
+	GetSessionUsage(start, end time.Time) ([]model.SessionUsage, error)
+	GetProviderSamples(start, end time.Time) ([]model.ProviderSample, error)
+	GetCostGroups(start, end time.Time) ([]model.CostGroup, error)
+	GetErrorGroups(start, end time.Time) ([]model.ErrorGroup, error)
+	GetHourlyUsage(start, end time.Time) ([]model.HourlyUsage, error)
+	GetGradedPrompts(start, end time.Time) ([]model.GradedPrompt, error)
+	GetUsageSamples(start, end time.Time) ([]model.UsageSample, error)
+	DeleteRequestsBefore(cutoff time.Time) (int, error)
+	DeleteRequests(filter RequestFilter) (int, error)
+	GetTrash(page, limit int) ([]model.RequestLog, int, error)
+	RestoreRequests(ids []string) (int, error)
+	PurgeTrash(cutoff time.Time) (int, error)
+	ArchiveRequests(ids []string, object string) (int, error)
+	GetArchivedRequest(id string) (*model.ArchivedRequest, error)
+	AddRequestTags(id string, tags []string) (bool, error)
+	RemoveRequestTag(id, tag string) (bool, error)
+	GetTags() ([]model.TagCount, error)
+	StarRequest(id string, starred bool) (bool, error)
+	SetRequestNote(id, note string) (bool, error)
+	SaveConversationReport(report *model.ConversationReport) error
+	GetConversationReport(sessionID string) (*model.ConversationReport, error)
+	Backup(destPath string) error
+	GetExperimentStats(name string) ([]model.ExperimentArmStats, error)
+	GetRoutingRules() ([]model.RoutingRule, error)
+	SaveRoutingRule(rule *model.RoutingRule) error
+	DeleteRoutingRule(id string) (bool, error)
+	SaveUsageEvents(events []model.UsageEvent) error
+	SaveConfigSnapshot(snapshot *model.ConfigSnapshot) error
+	GetConfigSnapshots() ([]model.ConfigSnapshot, error)
+	GetConfigSnapshot(generation int64) (*model.ConfigSnapshot, error)
+	GetSchema() ([]model.SchemaTable, error)
+	GetStorageStats() (*model.StorageStats, error)
+	Maintain(steps []string) (*model.MaintenanceReport, error)
+	SetPrices(prices *PriceTable) error
+	ForTenant(tenant string) StorageService
+}
+
+// RequestFilter selects stored requests by every field that is set
+type RequestFilter struct {
+	After      time.Time // stored at or after this time
+	Before     time.Time // stored before this time
+	Model      string    // model contains this, ignoring case
+	StatusCode int       // response status
+	ErrorType  string    // type of the API error in the response
+	SessionID  string
+	Tag        string
+	Starred    bool // only starred requests
+	Annotated  bool // only requests with a note
+	Ungraded   bool // only requests without a grade, or whose grading failed
 }
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"log"
+	"sync"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+type storageWriteKind int
+
+const (
+	writeRequest storageWriteKind = iota
+	writeResponse
+	writeGrade
+	writeShadow
+)
+
+// storageWrite is a queued SaveRequest or UpdateRequestWith call, or, with
+// flushed set, a marker closed once the writes queued before it are stored
+type storageWrite struct {
+	kind      storageWriteKind
+	request   *model.RequestLog
+	requestID string
+	grade     *model.PromptGrade
+	shadow    *model.ShadowResponse
+	flushed   chan struct{}
+}
+
+// batchWriter is implemented by storage that can store several writes in one
+// transaction
+type batchWriter interface {
+	writeBatch(writes []storageWrite) error
+}
+
+// AsyncStorage takes request logging off the request path. SaveRequest and
+// the UpdateRequestWith methods queue their writes and return at once, and a
+// single writer stores them in order, in batches of whatever has queued up
+// and in one transaction when the storage supports it. Reads go straight to
+// the storage, so they can miss writes that are still queued.
+type AsyncStorage struct {
+	StorageService
+	batchSize int
+	logger    *log.Logger
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan storageWrite
+	done   chan struct{}
+}
+
+func NewAsyncStorage(storage StorageService, cfg config.WriteQueueConfig, logger *log.Logger) *AsyncStorage {
+	size := cfg.Size
+	if size <= 0 {
+		size = 1000
+	}
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	a := &AsyncStorage{
+		StorageService: storage,
+		batchSize:      batchSize,
+		logger:         logger,
+		queue:          make(chan storageWrite, size),
+		done:           make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *AsyncStorage) SaveRequest(request *model.RequestLog) (string, error) {
+	// The handler keeps filling in the log, so the queue gets it as it is now
+	copied := *request
+	return request.RequestID, a.enqueue(storageWrite{kind: writeRequest, request: &copied})
+}
+
+func (a *AsyncStorage) UpdateRequestWithResponse(request *model.RequestLog) error {
+	copied := *request
+	return a.enqueue(storageWrite{kind: writeResponse, request: &copied})
+}
+
+func (a *AsyncStorage) UpdateRequestWithGrading(requestID string, grade *model.PromptGrade) error {
+	return a.enqueue(storageWrite{kind: writeGrade, requestID: requestID, grade: grade})
+}
+
+func (a *AsyncStorage) UpdateRequestWithShadow(requestID string, shadow *model.ShadowResponse) error {
+	return a.enqueue(storageWrite{kind: writeShadow, requestID: requestID, shadow: shadow})
+}
+
+// Flush waits until the writes queued so far are stored
+func (a *AsyncStorage) Flush() {
+	flushed := make(chan struct{})
+	a.enqueue(storageWrite{flushed: flushed})
+	<-flushed
+}
+
+// Close stores the writes still queued and stops the writer. Writes made
+// after it, such as by shadow requests still finishing, go straight to the
+// storage.
+func (a *AsyncStorage) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+	<-a.done
+}
+
+func (a *AsyncStorage) enqueue(write storageWrite) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return a.apply(write)
+	}
+
+	select {
+	case a.queue <- write:
+	default:
+		// Waiting slows the request down, but dropping it would lose the log
+		a.logger.Printf("⚠️  Storage write queue is full, waiting for the database")
+		a.queue <- write
+	}
+	return nil
+}
+
+func (a *AsyncStorage) run() {
+	defer close(a.done)
+	for write := range a.queue {
+		batch := []storageWrite{write}
+	collect:
+		for len(batch) < a.batchSize {
+			select {
+			case next, ok := <-a.queue:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, next)
+			default:
+				break collect
+			}
+		}
+		a.store(batch)
+	}
+}
+
+func (a *AsyncStorage) store(batch []storageWrite) {
+	var writes []storageWrite
+	var flushed []chan struct{}
+	for _, write := range batch {
+		if write.flushed != nil {
+			flushed = append(flushed, write.flushed)
+		} else {
+			writes = append(writes, write)
+		}
+	}
+	defer func() {
+		for _, done := range flushed {
+			close(done)
+		}
+	}()
+
+	if batcher, ok := a.StorageService.(batchWriter); ok && len(writes) > 1 {
+		err := batcher.writeBatch(writes)
+		if err == nil {
+			return
+		}
+		// One bad write shouldn't lose the rest of the batch
+		a.logger.Printf("⚠️  Failed to store a batch of %d writes, retrying them one at a time: %v", len(writes), err)
+	}
+	for _, write := range writes {
+		if err := a.apply(write); err != nil {
+			a.logger.Printf("❌ Error storing request %s: %v", write.id(), err)
+		}
+	}
+}
+
+// apply makes a write directly on the storage
+func (a *AsyncStorage) apply(write storageWrite) error {
+	var err error
+	switch {
+	case write.flushed != nil:
+		close(write.flushed)
+	case write.kind == writeRequest:
+		_, err = a.StorageService.SaveRequest(write.request)
+	case write.kind == writeResponse:
+		err = a.StorageService.UpdateRequestWithResponse(write.request)
+	case write.kind == writeGrade:
+		err = a.StorageService.UpdateRequestWithGrading(write.requestID, write.grade)
+	case write.kind == writeShadow:
+		err = a.StorageService.UpdateRequestWithShadow(write.requestID, write.shadow)
+	}
+	return err
+}
+
+func (w storageWrite) id() string {
+	if w.request != nil {
+		return w.request.RequestID
+	}
+	return w.requestID
+}
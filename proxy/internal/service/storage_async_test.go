@@ -0,0 +1,142 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func newTestAsyncStorage(t *testing.T, batchSize int) (*AsyncStorage, StorageService) {
+	t.Helper()
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	async := NewAsyncStorage(storage, config.WriteQueueConfig{Size: 10, BatchSize: batchSize}, log.New(io.Discard, "", 0))
+	t.Cleanup(async.Close)
+	return async, storage
+}
+
+func testRequestLog(id string) *model.RequestLog {
+	return &model.RequestLog{
+		RequestID: id,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Method:    "POST",
+		Endpoint:  "/v1/messages",
+		Body:      map[string]string{},
+		Model:     "claude-sonnet-4",
+	}
+}
+
+func TestAsyncStorage_Writes(t *testing.T) {
+	tests := []struct {
+		name      string
+		batchSize int
+	}{
+		{"Batched", 100},
+		{"One at a time", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			async, storage := newTestAsyncStorage(t, tt.batchSize)
+
+			// More parallel requests than the queue holds, as with parallel tool calls
+			var wg sync.WaitGroup
+			for i := 0; i < 40; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					request := testRequestLog(fmt.Sprintf("req-%d", i))
+					async.SaveRequest(request)
+					request.Response = &model.ResponseLog{StatusCode: 200}
+					async.UpdateRequestWithResponse(request)
+					async.UpdateRequestWithGrading(request.RequestID, &model.PromptGrade{Score: 4})
+					async.UpdateRequestWithShadow(request.RequestID, &model.ShadowResponse{Model: "gpt-4o"})
+				}(i)
+			}
+			wg.Wait()
+			async.Flush()
+
+			requests, total, err := storage.GetRequests(1, 100)
+			if err != nil {
+				t.Fatalf("GetRequests() returned error: %v", err)
+			}
+			if total != 40 {
+				t.Fatalf("stored %d requests, want 40", total)
+			}
+			for _, request := range requests {
+				if request.Response == nil || request.PromptGrade == nil || request.Shadow == nil {
+					t.Errorf("request %s is missing writes: response %v, grade %v, shadow %v", request.RequestID, request.Response, request.PromptGrade, request.Shadow)
+				}
+			}
+		})
+	}
+}
+
+func TestAsyncStorage_CopiesRequests(t *testing.T) {
+	async, storage := newTestAsyncStorage(t, 100)
+
+	request := testRequestLog("req-1")
+	async.SaveRequest(request)
+	request.Model = "changed after saving"
+	async.Flush()
+
+	stored, _, err := storage.GetRequestByShortID("req-1")
+	if err != nil {
+		t.Fatalf("GetRequestByShortID() returned error: %v", err)
+	}
+	if stored.Model != "claude-sonnet-4" {
+		t.Errorf("Model = %q, want the one it was saved with", stored.Model)
+	}
+}
+
+func TestAsyncStorage_FailedBatch(t *testing.T) {
+	async, storage := newTestAsyncStorage(t, 100)
+	if _, err := storage.SaveRequest(testRequestLog("duplicate")); err != nil {
+		t.Fatalf("SaveRequest() returned error: %v", err)
+	}
+
+	// The duplicate fails the batch's transaction; the others must still be stored
+	async.store([]storageWrite{
+		{kind: writeRequest, request: testRequestLog("before")},
+		{kind: writeRequest, request: testRequestLog("duplicate")},
+		{kind: writeRequest, request: testRequestLog("after")},
+	})
+
+	_, total, err := storage.GetRequests(1, 10)
+	if err != nil || total != 3 {
+		t.Errorf("GetRequests() = %d requests, %v, want 3", total, err)
+	}
+}
+
+func TestAsyncStorage_Close(t *testing.T) {
+	async, storage := newTestAsyncStorage(t, 100)
+
+	for i := 0; i < 5; i++ {
+		async.SaveRequest(testRequestLog(fmt.Sprintf("queued-%d", i)))
+	}
+	async.Close()
+	if _, total, _ := storage.GetRequests(1, 10); total != 5 {
+		t.Errorf("stored %d requests on Close, want 5", total)
+	}
+
+	// Writes after Close go straight to the storage, errors included
+	if _, err := async.SaveRequest(testRequestLog("late")); err != nil {
+		t.Errorf("SaveRequest() after Close returned error: %v", err)
+	}
+	if _, err := async.SaveRequest(testRequestLog("late")); err == nil {
+		t.Error("SaveRequest() of a duplicate after Close returned no error")
+	}
+	async.Flush()
+	if _, total, _ := storage.GetRequests(1, 10); total != 6 {
+		t.Errorf("stored %d requests, want 6", total)
+	}
+}
@@ -0,0 +1,318 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// Encodings of a body or response, recorded in the body_encoding and
+// response_encoding columns as the steps applied joined by "+", such as
+// "gzip+aes-gcm"; the columns are NULL for plain JSON
+const (
+	payloadEncodingGzip   = "gzip"
+	payloadEncodingAESGCM = "aes-gcm"
+	payloadEncodingBlob   = "blob"
+)
+
+// blobPreviewBytes is how much of an offloaded payload's JSON is kept in the
+// database as its preview
+const blobPreviewBytes = 1024
+
+// blobReference is stored in place of a payload offloaded to the blob store
+type blobReference struct {
+	Blob    string `json:"blob"`
+	Bytes   int    `json:"bytes"`
+	Preview string `json:"preview,omitempty"`
+}
+
+// payloadCodec prepares request bodies and responses for storage,
+// compressing those of at least compressMinBytes, with an encryption key
+// encrypting all of them, and moving those of at least blobMinBytes out of
+// the database into blobs. Without encryption, parts of bodies of at least
+// dedupMinBytes are stored once and shared, read back through segments.
+type payloadCodec struct {
+	compressMinBytes int
+	aead             cipher.AEAD
+	blobMinBytes     int
+	blobs            blobStore
+	dedupMinBytes    int
+	segments         func(hash string) ([]byte, error)
+}
+
+func newPayloadCodec(cfg *config.StorageConfig) (payloadCodec, error) {
+	codec := payloadCodec{compressMinBytes: cfg.CompressMinBytes, dedupMinBytes: cfg.DedupMinBytes}
+	if cfg.BlobMinBytes > 0 {
+		dir := cfg.BlobDir
+		if dir == "" {
+			dir = filepath.Join(filepath.Dir(cfg.DBPath), "blobs")
+		}
+		blobs, err := newFileBlobStore(dir)
+		if err != nil {
+			return codec, err
+		}
+		codec.blobMinBytes = cfg.BlobMinBytes
+		codec.blobs = blobs
+	}
+	aead, err := newPayloadCipher(cfg.EncryptionKey)
+	if err != nil {
+		return codec, err
+	}
+	codec.aead = aead
+	return codec, nil
+}
+
+// newPayloadCipher returns the AES-256-GCM cipher of a base64 encryption key,
+// or nil without one
+func newPayloadCipher(encryptionKey string) (cipher.AEAD, error) {
+	if encryptionKey == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encryptionKey)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("encryption key must be 32 bytes encoded as base64, such as the output of openssl rand -base64 32")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return aead, nil
+}
+
+// encode returns the value to store for a JSON payload and its encoding, which
+// is nil when the payload is stored as plain JSON
+func (c *payloadCodec) encode(data []byte) (interface{}, interface{}, error) {
+	original := data
+	data, steps, err := c.compress(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if c.aead != nil {
+		if data, err = c.encrypt(data); err != nil {
+			return nil, nil, err
+		}
+		steps = append(steps, payloadEncodingAESGCM)
+	}
+
+	if c.blobs != nil && len(original) >= c.blobMinBytes {
+		key, err := c.blobs.put(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		ref := blobReference{Blob: key, Bytes: len(original)}
+		if c.aead == nil {
+			ref.Preview = payloadPreview(original)
+		}
+		refJSON, err := json.Marshal(ref)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal blob reference: %w", err)
+		}
+		steps = append(steps, payloadEncodingBlob)
+		return string(refJSON), strings.Join(steps, "+"), nil
+	}
+
+	if len(steps) == 0 {
+		return string(data), nil, nil
+	}
+	return data, strings.Join(steps, "+"), nil
+}
+
+// compress gzips data of at least compressMinBytes, returning it with the
+// steps applied; payloads that don't shrink are kept as they are
+func (c *payloadCodec) compress(data []byte) ([]byte, []string, error) {
+	if c.compressMinBytes <= 0 || len(data) < c.compressMinBytes {
+		return data, nil, nil
+	}
+	compressed, err := gzipPayload(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(compressed) >= len(data) {
+		return data, nil, nil
+	}
+	return compressed, []string{payloadEncodingGzip}, nil
+}
+
+// dedup splits the shared parts out of a request body with dedupBody, unless
+// deduplication is off. Encrypted bodies aren't deduplicated, since the hashes
+// would tell which requests share text.
+func (c *payloadCodec) dedup(body []byte) ([]byte, map[string][]byte) {
+	if c.dedupMinBytes <= 0 || c.aead != nil {
+		return body, nil
+	}
+	return dedupBody(body, c.dedupMinBytes)
+}
+
+// decode returns the JSON of a stored payload, undoing its encoding steps in
+// reverse
+func (c *payloadCodec) decode(value []byte, encoding sql.NullString) ([]byte, error) {
+	if encoding.String == "" {
+		return value, nil
+	}
+
+	steps := strings.Split(encoding.String, "+")
+	for i := len(steps) - 1; i >= 0; i-- {
+		var err error
+		switch steps[i] {
+		case payloadEncodingGzip:
+			value, err = gunzipPayload(value)
+		case payloadEncodingAESGCM:
+			value, err = c.decrypt(value)
+		case payloadEncodingBlob:
+			value, err = c.readBlob(value)
+		case payloadEncodingDedup:
+			if c.segments == nil {
+				err = errors.New("body is deduplicated but no segment store is configured")
+			} else {
+				value, err = expandBody(value, c.segments)
+			}
+		default:
+			err = fmt.Errorf("unknown payload encoding %q", steps[i])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// decodeStoredResponse reads a response column and its encoding; like
+// decodeResponse, it returns nil for a missing or unreadable response
+func (c *payloadCodec) decodeStoredResponse(value []byte, encoding sql.NullString) *model.ResponseLog {
+	if value == nil {
+		return nil
+	}
+	data, err := c.decode(value, encoding)
+	if err != nil {
+		return nil
+	}
+	return decodeResponse(sql.NullString{String: string(data), Valid: true})
+}
+
+// requestText and responseText are the text to index for search, which is
+// left out when payloads are encrypted so it isn't stored in the clear
+func (c *payloadCodec) requestText(body []byte) string {
+	if c.aead != nil {
+		return ""
+	}
+	return requestSearchText(body)
+}
+
+func (c *payloadCodec) responseText(response *model.ResponseLog) string {
+	if c.aead != nil {
+		return ""
+	}
+	return responseSearchText(response)
+}
+
+func (c *payloadCodec) readBlob(value []byte) ([]byte, error) {
+	ref, err := parseBlobReference(value)
+	if err != nil {
+		return nil, err
+	}
+	if c.blobs == nil {
+		return nil, errors.New("payload is in a blob but no blob store is configured")
+	}
+	return c.blobs.get(ref.Blob)
+}
+
+// removeBlob deletes the blob a stored payload refers to, if it's in one
+func (c *payloadCodec) removeBlob(value []byte, encoding sql.NullString) error {
+	if c.blobs == nil || !strings.HasSuffix(encoding.String, payloadEncodingBlob) {
+		return nil
+	}
+	ref, err := parseBlobReference(value)
+	if err != nil {
+		return err
+	}
+	return c.blobs.remove(ref.Blob)
+}
+
+func parseBlobReference(value []byte) (blobReference, error) {
+	var ref blobReference
+	if err := json.Unmarshal(value, &ref); err != nil || ref.Blob == "" {
+		return ref, errors.New("invalid blob reference")
+	}
+	return ref, nil
+}
+
+// payloadPreview is the start of a payload's JSON, cut on a character boundary
+func payloadPreview(data []byte) string {
+	if len(data) <= blobPreviewBytes {
+		return string(data)
+	}
+	end := blobPreviewBytes
+	for end > 0 && !utf8.RuneStart(data[end]) {
+		end--
+	}
+	return string(data[:end])
+}
+
+// encrypt seals data with a random nonce, which it's prefixed with
+func (c *payloadCodec) encrypt(data []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to encrypt payload: %w", err)
+	}
+	return c.aead.Seal(nonce, nonce, data, nil), nil
+}
+
+func (c *payloadCodec) decrypt(value []byte) ([]byte, error) {
+	if c.aead == nil {
+		return nil, errors.New("payload is encrypted but no encryption key is configured")
+	}
+	nonceSize := c.aead.NonceSize()
+	if len(value) < nonceSize {
+		return nil, errors.New("failed to decrypt payload: too short")
+	}
+	data, err := c.aead.Open(nil, value[:nonceSize], value[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt payload: %w", err)
+	}
+	return data, nil
+}
+
+func gzipPayload(data []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress payload: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress payload: %w", err)
+	}
+	return compressed.Bytes(), nil
+}
+
+func gunzipPayload(value []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(value))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress payload: %w", err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress payload: %w", err)
+	}
+	return data, nil
+}
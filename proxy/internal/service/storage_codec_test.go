@@ -0,0 +1,113 @@
+package service
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+const testEncryptionKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=" // 0123456789abcdef0123456789abcdef
+
+func TestPayloadCodec(t *testing.T) {
+	small := []byte(`{"model":"claude-sonnet-4"}`)
+	large := []byte(`{"messages":["` + strings.Repeat("func main() {} ", 100) + `"]}`)
+
+	tests := []struct {
+		name             string
+		cfg              config.StorageConfig
+		data             []byte
+		expectedEncoding string
+	}{
+		{"Plain", config.StorageConfig{}, large, ""},
+		{"Below the threshold", config.StorageConfig{CompressMinBytes: 1024}, small, ""},
+		{"Compressed", config.StorageConfig{CompressMinBytes: 1024}, large, "gzip"},
+		{"Encrypted", config.StorageConfig{EncryptionKey: testEncryptionKey}, small, "aes-gcm"},
+		{"Compressed and encrypted", config.StorageConfig{CompressMinBytes: 1024, EncryptionKey: testEncryptionKey}, large, "gzip+aes-gcm"},
+		{"Compressed into a blob", config.StorageConfig{CompressMinBytes: 1024, BlobMinBytes: 1024, BlobDir: t.TempDir()}, large, "gzip+blob"},
+		{"Encrypted into a blob", config.StorageConfig{BlobMinBytes: 1024, BlobDir: t.TempDir(), EncryptionKey: testEncryptionKey}, large, "aes-gcm+blob"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec, err := newPayloadCodec(&tt.cfg)
+			if err != nil {
+				t.Fatalf("newPayloadCodec() returned error: %v", err)
+			}
+			value, encoding, err := codec.encode(tt.data)
+			if err != nil {
+				t.Fatalf("encode() returned error: %v", err)
+			}
+
+			var stored []byte
+			var storedEncoding sql.NullString
+			switch v := value.(type) {
+			case string:
+				stored = []byte(v)
+			case []byte:
+				stored = v
+			}
+			if encoding != nil {
+				storedEncoding = sql.NullString{String: encoding.(string), Valid: true}
+			}
+			if storedEncoding.String != tt.expectedEncoding {
+				t.Errorf("encoding = %q, want %q", storedEncoding.String, tt.expectedEncoding)
+			}
+			if tt.cfg.EncryptionKey != "" && bytes.Contains(stored, []byte("claude-sonnet-4")) {
+				t.Error("encrypted payload contains its plaintext")
+			}
+
+			decoded, err := codec.decode(stored, storedEncoding)
+			if err != nil {
+				t.Fatalf("decode() returned error: %v", err)
+			}
+			if !bytes.Equal(decoded, tt.data) {
+				t.Errorf("decode() = %.40q..., want the original payload", decoded)
+			}
+		})
+	}
+}
+
+func TestPayloadCodec_Errors(t *testing.T) {
+	encrypting, err := newPayloadCodec(&config.StorageConfig{EncryptionKey: testEncryptionKey})
+	if err != nil {
+		t.Fatalf("newPayloadCodec() returned error: %v", err)
+	}
+	value, _, err := encrypting.encode([]byte(`{}`))
+	if err != nil {
+		t.Fatalf("encode() returned error: %v", err)
+	}
+	encrypted := value.([]byte)
+	otherKey, _ := newPayloadCodec(&config.StorageConfig{EncryptionKey: "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="})
+
+	tests := []struct {
+		name          string
+		codec         payloadCodec
+		value         []byte
+		encoding      string
+		expectedError string
+	}{
+		{"No key", payloadCodec{}, encrypted, "aes-gcm", "no encryption key"},
+		{"Wrong key", otherKey, encrypted, "aes-gcm", "failed to decrypt"},
+		{"Truncated", encrypting, encrypted[:4], "aes-gcm", "too short"},
+		{"Not gzip", payloadCodec{}, []byte(`{}`), "gzip", "failed to decompress"},
+		{"Unknown encoding", payloadCodec{}, []byte(`{}`), "zstd", `unknown payload encoding "zstd"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.codec.decode(tt.value, sql.NullString{String: tt.encoding, Valid: true})
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("decode() error = %v, want one containing %q", err, tt.expectedError)
+			}
+		})
+	}
+
+	for _, key := range []string{"not base64!", "c2hvcnQ="} {
+		if _, err := newPayloadCodec(&config.StorageConfig{EncryptionKey: key}); err == nil {
+			t.Errorf("newPayloadCodec() accepted key %q", key)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// sqliteConnector opens connections with a driver whose hook applies the
+// tuning pragmas, since SQLite keeps them per connection
+type sqliteConnector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+func (c *sqliteConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *sqliteConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// openSQLite opens the database file at path tuned by cfg
+func openSQLite(path string, cfg config.SQLiteConfig) (*sql.DB, error) {
+	pragmas, err := sqlitePragmas(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(&sqliteConnector{dsn: path, driver: &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			for _, pragma := range pragmas {
+				if _, err := conn.Exec(pragma, nil); err != nil {
+					return fmt.Errorf("failed to apply %s: %w", pragma, err)
+				}
+			}
+			return nil
+		},
+	}})
+
+	// The journal mode is stored in the file, so it's set once rather than
+	// by every connection
+	if cfg.JournalMode != "" {
+		if _, err := db.Exec("PRAGMA journal_mode = " + strings.ToUpper(cfg.JournalMode)); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to set journal mode: %w", err)
+		}
+	}
+	return db, nil
+}
+
+// sqlitePragmas are the statements each connection runs to apply cfg
+func sqlitePragmas(cfg config.SQLiteConfig) ([]string, error) {
+	var pragmas []string
+	if cfg.CacheSizeKB < 0 || cfg.MmapSizeMB < 0 {
+		return nil, fmt.Errorf("storage.sqlite cache_size_kb and mmap_size_mb can't be negative")
+	}
+	if cfg.CacheSizeKB > 0 {
+		// A negative cache size is in KiB rather than pages
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA cache_size = -%d", cfg.CacheSizeKB))
+	}
+	if cfg.MmapSizeMB > 0 {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA mmap_size = %d", int64(cfg.MmapSizeMB)<<20))
+	}
+	switch strings.ToLower(cfg.Synchronous) {
+	case "":
+	case "off", "normal", "full", "extra":
+		pragmas = append(pragmas, "PRAGMA synchronous = "+strings.ToUpper(cfg.Synchronous))
+	default:
+		return nil, fmt.Errorf("invalid storage.sqlite synchronous %q, expected off, normal, full or extra", cfg.Synchronous)
+	}
+	switch strings.ToLower(cfg.JournalMode) {
+	case "", "delete", "truncate", "persist", "wal":
+	default:
+		return nil, fmt.Errorf("invalid storage.sqlite journal_mode %q, expected delete, truncate, persist or wal", cfg.JournalMode)
+	}
+	return pragmas, nil
+}
+
+// MaintenanceSteps are the steps Maintain can run, in the order it runs them:
+// ANALYZE refreshes the statistics the query planner chooses indexes by,
+// VACUUM rebuilds the file without the free pages deleted rows left, and a
+// checkpoint copies the write-ahead log into the database and truncates it
+var MaintenanceSteps = []string{"analyze", "vacuum", "checkpoint"}
+
+var maintenanceStatements = map[string]string{
+	"analyze":    "ANALYZE",
+	"vacuum":     "VACUUM",
+	"checkpoint": "PRAGMA wal_checkpoint(TRUNCATE)",
+}
+
+// ParseMaintenanceSteps reads a comma-separated list of maintenance steps;
+// an empty list is every step
+func ParseMaintenanceSteps(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return MaintenanceSteps, nil
+	}
+	requested := make(map[string]bool)
+	for _, step := range strings.Split(value, ",") {
+		step = strings.ToLower(strings.TrimSpace(step))
+		if _, ok := maintenanceStatements[step]; !ok {
+			return nil, fmt.Errorf("unknown maintenance step %q, expected analyze, vacuum or checkpoint", step)
+		}
+		requested[step] = true
+	}
+
+	var steps []string
+	for _, step := range MaintenanceSteps {
+		if requested[step] {
+			steps = append(steps, step)
+		}
+	}
+	return steps, nil
+}
+
+// Maintain runs the given steps of MaintenanceSteps, measuring the database
+// before and after
+func (s *sqliteStorageService) Maintain(steps []string) (*model.MaintenanceReport, error) {
+	before, err := s.databaseSizes()
+	if err != nil {
+		return nil, err
+	}
+	report := &model.MaintenanceReport{Steps: []model.MaintenanceStep{}, Before: before}
+
+	for _, step := range steps {
+		statement, ok := maintenanceStatements[step]
+		if !ok {
+			return nil, fmt.Errorf("unknown maintenance step %q", step)
+		}
+		start := time.Now()
+		if _, err := s.db.Exec(statement); err != nil {
+			return nil, fmt.Errorf("failed to %s database: %w", step, err)
+		}
+		report.Steps = append(report.Steps, model.MaintenanceStep{Name: step, DurationMs: time.Since(start).Milliseconds()})
+	}
+
+	if report.After, err = s.databaseSizes(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// NewMaintenanceTask runs the comma-separated maintenance steps of the "steps"
+// arg, by default all of them
+func NewMaintenanceTask(storage StorageService) ScheduledTask {
+	return func(ctx context.Context, args map[string]string) (string, error) {
+		steps, err := ParseMaintenanceSteps(args["steps"])
+		if err != nil {
+			return "", err
+		}
+		report, err := storage.Maintain(steps)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("ran %s: database %s, write-ahead log %s (was %s and %s)",
+			strings.Join(steps, ", "),
+			formatBytes(report.After.DatabaseBytes), formatBytes(report.After.WALBytes),
+			formatBytes(report.Before.DatabaseBytes), formatBytes(report.Before.WALBytes)), nil
+	}
+}
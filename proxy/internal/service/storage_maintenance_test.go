@@ -0,0 +1,120 @@
+package service
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+func TestSQLitePragmas(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         config.SQLiteConfig
+		expected    []string
+		expectError bool
+	}{
+		{"Defaults", config.SQLiteConfig{}, nil, false},
+		{"Tuned", config.SQLiteConfig{CacheSizeKB: 65536, MmapSizeMB: 256, Synchronous: "normal", JournalMode: "wal"}, []string{
+			"PRAGMA cache_size = -65536",
+			"PRAGMA mmap_size = 268435456",
+			"PRAGMA synchronous = NORMAL",
+		}, false},
+		{"Negative cache size", config.SQLiteConfig{CacheSizeKB: -1}, nil, true},
+		{"Unknown synchronous", config.SQLiteConfig{Synchronous: "sometimes"}, nil, true},
+		{"Unknown journal mode", config.SQLiteConfig{JournalMode: "journal"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pragmas, err := sqlitePragmas(tt.cfg)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("sqlitePragmas() error = %v, want error %v", err, tt.expectError)
+			}
+			if !reflect.DeepEqual(pragmas, tt.expected) {
+				t.Errorf("sqlitePragmas() = %q, want %q", pragmas, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseMaintenanceSteps(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		expected    []string
+		expectError bool
+	}{
+		{"Every step by default", "", []string{"analyze", "vacuum", "checkpoint"}, false},
+		{"Run in order", "Checkpoint, analyze", []string{"analyze", "checkpoint"}, false},
+		{"Repeated", "vacuum,vacuum", []string{"vacuum"}, false},
+		{"Unknown", "analyze,reindex", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := ParseMaintenanceSteps(tt.value)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("ParseMaintenanceSteps() error = %v, want error %v", err, tt.expectError)
+			}
+			if !reflect.DeepEqual(steps, tt.expected) {
+				t.Errorf("ParseMaintenanceSteps() = %v, want %v", steps, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSQLiteStorage_Maintain(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{
+		DBPath: filepath.Join(t.TempDir(), "requests.db"),
+		SQLite: config.SQLiteConfig{CacheSizeKB: 8192, Synchronous: "normal", JournalMode: "wal"},
+	})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	sqlite := storage.(*sqliteStorageService)
+
+	var journalMode string
+	var cacheSize, synchronous int
+	sqlite.db.QueryRow("PRAGMA journal_mode").Scan(&journalMode)
+	sqlite.db.QueryRow("PRAGMA cache_size").Scan(&cacheSize)
+	sqlite.db.QueryRow("PRAGMA synchronous").Scan(&synchronous)
+	if journalMode != "wal" || cacheSize != -8192 || synchronous != 1 {
+		t.Errorf("journal_mode, cache_size, synchronous = %s, %d, %d, want wal, -8192, 1", journalMode, cacheSize, synchronous)
+	}
+
+	for i := 0; i < 50; i++ {
+		request := testRequestLog(strings.Repeat("x", i+1))
+		request.Body = map[string]string{"prompt": strings.Repeat("padding ", 500)}
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+	}
+	if _, err := storage.ClearRequests(); err != nil {
+		t.Fatalf("ClearRequests() returned error: %v", err)
+	}
+
+	report, err := storage.Maintain(MaintenanceSteps)
+	if err != nil {
+		t.Fatalf("Maintain() returned error: %v", err)
+	}
+	var ran []string
+	for _, step := range report.Steps {
+		ran = append(ran, step.Name)
+	}
+	if !reflect.DeepEqual(ran, MaintenanceSteps) {
+		t.Errorf("steps run = %v, want %v", ran, MaintenanceSteps)
+	}
+	if report.Before.FreeBytes == 0 || report.Before.WALBytes == 0 {
+		t.Errorf("sizes before = %+v, want free pages and a write-ahead log", report.Before)
+	}
+	if report.After.FreeBytes != 0 || report.After.WALBytes != 0 || report.After.DatabaseBytes >= report.Before.DatabaseBytes {
+		t.Errorf("sizes after = %+v, want a smaller database without free pages or a write-ahead log (before %+v)", report.After, report.Before)
+	}
+
+	if _, err := storage.Maintain([]string{"reindex"}); err == nil {
+		t.Error("Maintain() with an unknown step returned no error")
+	}
+}
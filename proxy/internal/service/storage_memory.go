@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+// NewStorageService opens the storage of cfg.Driver: "sqlite", the default,
+// keeps requests in the database at DBPath and "memory" only until the
+// process exits
+func NewStorageService(cfg *config.StorageConfig) (StorageService, error) {
+	switch cfg.Driver {
+	case "", "sqlite":
+		return NewSQLiteStorageService(cfg)
+	case "memory":
+		return NewMemoryStorageService(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q, expected sqlite or memory", cfg.Driver)
+	}
+}
+
+// NewMemoryStorageService stores requests in an in-memory SQLite database of
+// its own, so it answers every query the sqlite driver does the same way
+// while writing nothing to disk. Payloads are never offloaded to blob files.
+func NewMemoryStorageService(cfg *config.StorageConfig) (StorageService, error) {
+	memory := *cfg
+	memory.BlobMinBytes = 0
+
+	// The memdb VFS shares one database between the pool's connections, and
+	// locks it like a file so readers wait for writers instead of failing
+	name := make([]byte, 8)
+	if _, err := rand.Read(name); err != nil {
+		return nil, fmt.Errorf("failed to name database: %w", err)
+	}
+	db, err := sql.Open("sqlite3", "file:/requests-"+hex.EncodeToString(name)+"?vfs=memdb")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// The database is freed with its last connection, so one is held open
+	// for as long as the storage is used
+	if _, err := db.Conn(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return newSQLiteStorage(db, &memory)
+}
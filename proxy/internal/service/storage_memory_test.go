@@ -0,0 +1,73 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+func TestNewStorageService(t *testing.T) {
+	tests := []struct {
+		name        string
+		driver      string
+		expectError bool
+	}{
+		{"Default", "", false},
+		{"SQLite", "sqlite", false},
+		{"Memory", "memory", false},
+		{"Unknown", "postgres", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, err := NewStorageService(&config.StorageConfig{Driver: tt.driver, DBPath: filepath.Join(t.TempDir(), "requests.db")})
+			if (err != nil) != tt.expectError {
+				t.Fatalf("NewStorageService() error = %v, want error %v", err, tt.expectError)
+			}
+			if err == nil {
+				if _, err := storage.SaveRequest(testRequestLog("req-1")); err != nil {
+					t.Errorf("SaveRequest() returned error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	first, err := NewMemoryStorageService(&config.StorageConfig{})
+	if err != nil {
+		t.Fatalf("NewMemoryStorageService() returned error: %v", err)
+	}
+	second, err := NewMemoryStorageService(&config.StorageConfig{})
+	if err != nil {
+		t.Fatalf("NewMemoryStorageService() returned error: %v", err)
+	}
+
+	// Writers and readers on different connections wait for each other
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, err := first.SaveRequest(testRequestLog(fmt.Sprintf("req-%d-%d", i, j))); err != nil {
+					t.Errorf("SaveRequest() returned error: %v", err)
+				}
+				if _, _, err := first.GetRequests(1, 5); err != nil {
+					t.Errorf("GetRequests() returned error: %v", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if _, total, _ := first.GetRequests(1, 1); total != 80 {
+		t.Errorf("requests stored = %d, want 80", total)
+	}
+	if _, total, _ := second.GetRequests(1, 1); total != 0 {
+		t.Errorf("requests in a second memory storage = %d, want it empty", total)
+	}
+}
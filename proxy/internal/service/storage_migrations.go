@@ -0,0 +1,599 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// sqliteMigration brings the database from the previous schema version to
+// version, inside a transaction that also records the new version in the
+// database's user_version.
+//
+// To change the schema, append a migration for SchemaVersion+1, bump
+// SchemaVersion and add a schemaChangelog entry; never edit a migration that
+// has shipped. Databases created before versions were recorded start at 0
+// with part of the schema already there, which is why the migrations use IF
+// NOT EXISTS and addColumns rather than failing on what exists.
+type sqliteMigration struct {
+	version int
+	apply   func(tx *sql.Tx) error
+}
+
+var sqliteMigrations = []sqliteMigration{
+	{1, execMigration(`
+		CREATE TABLE IF NOT EXISTS requests (
+			id TEXT PRIMARY KEY,
+			timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+			method TEXT NOT NULL,
+			endpoint TEXT NOT NULL,
+			headers TEXT NOT NULL,
+			body TEXT NOT NULL,
+			user_agent TEXT,
+			content_type TEXT,
+			prompt_grade TEXT,
+			response TEXT,
+			model TEXT,
+			original_model TEXT,
+			routed_model TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_timestamp ON requests(timestamp DESC);
+		CREATE INDEX IF NOT EXISTS idx_endpoint ON requests(endpoint);
+		CREATE INDEX IF NOT EXISTS idx_model ON requests(model);
+	`)},
+	{2, func(tx *sql.Tx) error {
+		if err := addColumns(tx, "requests", "experiment TEXT", "experiment_arm TEXT"); err != nil {
+			return err
+		}
+		_, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_experiment ON requests(experiment, experiment_arm)")
+		return err
+	}},
+	{3, columnsMigration("requests", "shadow TEXT")},
+	{4, execMigration(`
+		CREATE TABLE IF NOT EXISTS routing_rules (
+			id TEXT PRIMARY KEY,
+			position INTEGER NOT NULL DEFAULT 0,
+			rule TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);
+	`)},
+	{5, columnsMigration("requests", "provider TEXT", "request_bytes INTEGER", "request_wire_bytes INTEGER")},
+	{6, columnsMigration("requests", "routing TEXT")},
+	{7, execMigration(`
+		CREATE TABLE IF NOT EXISTS usage_events (
+			id TEXT PRIMARY KEY,
+			timestamp DATETIME NOT NULL,
+			source TEXT NOT NULL,
+			model TEXT,
+			requests INTEGER NOT NULL DEFAULT 1,
+			input_tokens INTEGER NOT NULL DEFAULT 0,
+			output_tokens INTEGER NOT NULL DEFAULT 0,
+			cache_read_tokens INTEGER NOT NULL DEFAULT 0,
+			cache_creation_tokens INTEGER NOT NULL DEFAULT 0,
+			cost_usd REAL NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_usage_events_timestamp ON usage_events(timestamp);
+	`)},
+	{8, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS config_snapshots (
+				generation INTEGER PRIMARY KEY AUTOINCREMENT,
+				hash TEXT NOT NULL,
+				config TEXT NOT NULL,
+				created_at TEXT NOT NULL
+			);
+		`)
+		if err != nil {
+			return err
+		}
+		return addColumns(tx, "requests", "config_generation INTEGER")
+	}},
+	// Origins of older responses are inferred when read
+	{9, nil},
+	{10, createSearchIndex},
+	{11, func(tx *sql.Tx) error {
+		if err := addColumns(tx, "requests",
+			"status_code INTEGER",
+			"response_origin TEXT",
+			"response_ms INTEGER",
+			"response_bytes INTEGER",
+			"response_wire_bytes INTEGER",
+			"input_tokens INTEGER",
+			"output_tokens INTEGER",
+			"cache_read_tokens INTEGER",
+			"cache_creation_tokens INTEGER",
+		); err != nil {
+			return err
+		}
+		return backfillResponseColumns(tx)
+	}},
+	// Existing rows stay uncompressed, with NULL encodings
+	{12, columnsMigration("requests", "body_encoding TEXT", "response_encoding TEXT")},
+	// Encryption only adds encodings; older proxies can't read them
+	{13, nil},
+	{14, func(tx *sql.Tx) error {
+		if err := addColumns(tx, "requests", "session_id TEXT"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_session_id ON requests(session_id, timestamp)"); err != nil {
+			return err
+		}
+		return backfillSessionIDs(tx)
+	}},
+	// Older requests are costed by SetPrices, which has the price table
+	{15, columnsMigration("requests", "cost_usd REAL")},
+	// Blobs only add an encoding; older proxies can't read them
+	{16, nil},
+	{17, execMigration(`
+		CREATE TABLE IF NOT EXISTS archived_requests (
+			id TEXT PRIMARY KEY,
+			timestamp DATETIME NOT NULL,
+			object TEXT NOT NULL,
+			archived_at TEXT NOT NULL
+		);
+	`)},
+	{18, execMigration(`
+		CREATE TABLE IF NOT EXISTS body_segments (
+			hash TEXT PRIMARY KEY,
+			data BLOB NOT NULL,
+			encoding TEXT,
+			bytes INTEGER NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS request_segments (
+			request_id TEXT NOT NULL,
+			hash TEXT NOT NULL,
+			PRIMARY KEY (request_id, hash)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_request_segments_hash ON request_segments(hash);
+	`)},
+	{19, execMigration(`
+		CREATE TABLE IF NOT EXISTS request_tags (
+			request_id TEXT NOT NULL,
+			tag TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			PRIMARY KEY (request_id, tag)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_request_tags_tag ON request_tags(tag);
+	`)},
+	// Older streams have no timings to fill in
+	{20, columnsMigration("requests", "ttft_ms INTEGER", "stream_ms INTEGER", "stream_chunks INTEGER", "tokens_per_second REAL")},
+	{21, func(tx *sql.Tx) error {
+		if err := addColumns(tx, "requests", "deleted_at TEXT"); err != nil {
+			return err
+		}
+		_, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_requests_deleted_at ON requests(deleted_at) WHERE deleted_at IS NOT NULL")
+		return err
+	}},
+	// The user a request was routed for is already in its routing explanation
+	{22, func(tx *sql.Tx) error {
+		if err := addColumns(tx, "requests", "tenant TEXT"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			UPDATE requests SET tenant = json_extract(routing, '$.user')
+			WHERE json_valid(routing) AND COALESCE(json_extract(routing, '$.user'), '') != '';
+
+			CREATE INDEX IF NOT EXISTS idx_requests_tenant ON requests(tenant, timestamp);
+		`)
+		return err
+	}},
+	{23, func(tx *sql.Tx) error {
+		if err := addColumns(tx, "requests", "error_type TEXT"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_requests_error_type ON requests(error_type, timestamp) WHERE error_type IS NOT NULL"); err != nil {
+			return err
+		}
+		return backfillErrorTypes(tx)
+	}},
+	{24, func(tx *sql.Tx) error {
+		if err := addColumns(tx, "requests", "project TEXT"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_requests_project ON requests(project, timestamp)"); err != nil {
+			return err
+		}
+		return backfillProjects(tx)
+	}},
+	// Days are filled in when stats first read them. The triggers forget a
+	// day whenever a request of it is stored, changed or deleted, so it's
+	// summed again on the next read.
+	{25, execMigration(`
+		CREATE TABLE IF NOT EXISTS usage_daily (
+			day TEXT NOT NULL,
+			tenant TEXT NOT NULL,
+			dimension TEXT NOT NULL,
+			key TEXT NOT NULL,
+			requests INTEGER NOT NULL,
+			errors INTEGER NOT NULL,
+			synthetic INTEGER NOT NULL,
+			input_tokens INTEGER NOT NULL,
+			output_tokens INTEGER NOT NULL,
+			cache_read_tokens INTEGER NOT NULL,
+			cache_creation_tokens INTEGER NOT NULL,
+			response_ms INTEGER NOT NULL,
+			response_ms_count INTEGER NOT NULL,
+			request_bytes INTEGER NOT NULL,
+			request_wire_bytes INTEGER NOT NULL,
+			response_bytes INTEGER NOT NULL,
+			response_wire_bytes INTEGER NOT NULL,
+			cost_usd REAL NOT NULL,
+			ttft_ms INTEGER NOT NULL,
+			ttft_ms_count INTEGER NOT NULL,
+			tokens_per_second REAL NOT NULL,
+			tokens_per_second_count INTEGER NOT NULL,
+			PRIMARY KEY (dimension, day, tenant, key)
+		);
+
+		CREATE TABLE IF NOT EXISTS usage_daily_days (
+			day TEXT PRIMARY KEY
+		);
+
+		CREATE TRIGGER IF NOT EXISTS usage_daily_insert AFTER INSERT ON requests BEGIN
+			DELETE FROM usage_daily_days WHERE day = date(NEW.timestamp);
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS usage_daily_update AFTER UPDATE OF
+			timestamp, model, routed_model, provider, tenant, deleted_at, request_bytes, request_wire_bytes, cost_usd,
+			status_code, response_origin, response_ms, response_bytes, response_wire_bytes,
+			input_tokens, output_tokens, cache_read_tokens, cache_creation_tokens, ttft_ms, tokens_per_second
+		ON requests BEGIN
+			DELETE FROM usage_daily_days WHERE day IN (date(OLD.timestamp), date(NEW.timestamp));
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS usage_daily_delete AFTER DELETE ON requests BEGIN
+			DELETE FROM usage_daily_days WHERE day = date(OLD.timestamp);
+		END;
+	`)},
+	// Requests were logged with the server's offset; in UTC they sort by
+	// when they were made even after the offset changed
+	{26, execMigration(`
+		UPDATE requests SET timestamp = strftime('%Y-%m-%dT%H:%M:%SZ', timestamp)
+		WHERE substr(timestamp, 11, 1) = 'T' AND substr(timestamp, -1) != 'Z' AND datetime(timestamp) IS NOT NULL;
+	`)},
+	{27, execMigration(`
+		CREATE TABLE IF NOT EXISTS request_annotations (
+			request_id TEXT PRIMARY KEY,
+			starred INTEGER NOT NULL DEFAULT 0,
+			note TEXT,
+			updated_at TEXT NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_request_annotations_starred ON request_annotations(starred);
+	`)},
+	{28, execMigration(`
+		CREATE TABLE IF NOT EXISTS conversation_reports (
+			session_id TEXT PRIMARY KEY,
+			report TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);
+	`)},
+	{29, columnsMigration("requests", "prompt_grade_encoding TEXT", "shadow_encoding TEXT")},
+}
+
+// migrate applies the migrations the database hasn't had yet
+func (s *sqliteStorageService) migrate() error {
+	var current int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if current > SchemaVersion {
+		return fmt.Errorf("database schema version %d is newer than this proxy's %d; upgrade the proxy to open it", current, SchemaVersion)
+	}
+
+	for _, migration := range sqliteMigrations {
+		if migration.version <= current {
+			continue
+		}
+		if err := s.applyMigration(migration); err != nil {
+			return fmt.Errorf("failed to migrate to schema version %d: %w", migration.version, err)
+		}
+	}
+
+	var definition string
+	err := s.db.QueryRow("SELECT sql FROM sqlite_master WHERE name = 'request_search'").Scan(&definition)
+	if err != nil {
+		return fmt.Errorf("failed to inspect search index: %w", err)
+	}
+	s.fts = strings.Contains(strings.ToLower(definition), "fts5")
+	return nil
+}
+
+func (s *sqliteStorageService) applyMigration(migration sqliteMigration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if migration.apply != nil {
+		if err := migration.apply(tx); err != nil {
+			return err
+		}
+	}
+	// Tools reading the database directly can check the version without the API
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", migration.version)); err != nil {
+		return fmt.Errorf("failed to record schema version: %w", err)
+	}
+	return tx.Commit()
+}
+
+func execMigration(statements string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(statements)
+		return err
+	}
+}
+
+func columnsMigration(table string, columns ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		return addColumns(tx, table, columns...)
+	}
+}
+
+// addColumns adds each "name definition" column to table unless it already exists
+func addColumns(tx *sql.Tx, table string, columns ...string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("failed to inspect table %s: %w", table, err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	for _, column := range columns {
+		name := strings.Fields(column)[0]
+		if existing[name] {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, column)); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", table, name, err)
+		}
+	}
+	return nil
+}
+
+// createSearchIndex creates request_search, which holds the text of each
+// request and response for SearchRequests, and fills it from the requests
+// stored before it existed
+func createSearchIndex(tx *sql.Tx) error {
+	var exists int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'request_search'").Scan(&exists); err != nil {
+		return fmt.Errorf("failed to inspect search index: %w", err)
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	_, err := tx.Exec("CREATE VIRTUAL TABLE request_search USING fts5(id UNINDEXED, request_text, response_text, tokenize = 'porter unicode61')")
+	if err != nil && strings.Contains(err.Error(), "no such module") {
+		// Without FTS5 compiled into SQLite, a plain table searched with LIKE
+		_, err = tx.Exec("CREATE TABLE request_search (id TEXT PRIMARY KEY, request_text TEXT, response_text TEXT)")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create search index: %w", err)
+	}
+
+	rows, err := tx.Query("SELECT id, body, response FROM requests")
+	if err != nil {
+		return fmt.Errorf("failed to query requests to index: %w", err)
+	}
+	defer rows.Close()
+
+	type indexed struct{ id, request, response string }
+	var entries []indexed
+	for rows.Next() {
+		var id, body string
+		var responseJSON sql.NullString
+		if err := rows.Scan(&id, &body, &responseJSON); err != nil {
+			return fmt.Errorf("failed to scan request to index: %w", err)
+		}
+		entries = append(entries, indexed{id, requestSearchText([]byte(body)), responseSearchText(decodeResponse(responseJSON))})
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query requests to index: %w", err)
+	}
+	rows.Close()
+
+	for _, entry := range entries {
+		if _, err := tx.Exec("INSERT INTO request_search (id, request_text, response_text) VALUES (?, ?, ?)", entry.id, entry.request, entry.response); err != nil {
+			return fmt.Errorf("failed to index request %s: %w", entry.id, err)
+		}
+	}
+	return nil
+}
+
+// backfillResponseColumns fills the response columns of requests stored
+// before they existed
+func backfillResponseColumns(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, response FROM requests WHERE response IS NOT NULL AND status_code IS NULL")
+	if err != nil {
+		return fmt.Errorf("failed to query requests to backfill: %w", err)
+	}
+	defer rows.Close()
+
+	type backfill struct {
+		id     string
+		values []interface{}
+	}
+	var pending []backfill
+	for rows.Next() {
+		var id string
+		var responseJSON sql.NullString
+		if err := rows.Scan(&id, &responseJSON); err != nil {
+			return fmt.Errorf("failed to scan request to backfill: %w", err)
+		}
+		values := responseColumns(decodeResponse(responseJSON))[:backfilledResponseColumns]
+		if values[0] == nil {
+			// An unreadable response still gets a status, like any other stored response
+			values[0] = 0
+		}
+		pending = append(pending, backfill{id, values})
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query requests to backfill: %w", err)
+	}
+	rows.Close()
+
+	query := "UPDATE requests SET " + strings.Join(responseColumnNames[:backfilledResponseColumns], " = ?, ") + " = ? WHERE id = ?"
+	for _, row := range pending {
+		if _, err := tx.Exec(query, append(row.values, row.id)...); err != nil {
+			return fmt.Errorf("failed to backfill request %s: %w", row.id, err)
+		}
+	}
+	return nil
+}
+
+// backfillSessionIDs fills the session of requests stored before it was
+// recorded. Encrypted bodies can't be read here and are left without one.
+func backfillSessionIDs(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, body, body_encoding FROM requests WHERE session_id IS NULL")
+	if err != nil {
+		return fmt.Errorf("failed to query requests to backfill: %w", err)
+	}
+	defer rows.Close()
+
+	var codec payloadCodec
+	sessions := make(map[string]string)
+	for rows.Next() {
+		var id string
+		var body []byte
+		var encoding sql.NullString
+		if err := rows.Scan(&id, &body, &encoding); err != nil {
+			return fmt.Errorf("failed to scan request to backfill: %w", err)
+		}
+		if body, err = codec.decode(body, encoding); err != nil {
+			continue
+		}
+		if session := bodySessionID(body); session != "" {
+			sessions[id] = session
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query requests to backfill: %w", err)
+	}
+	rows.Close()
+
+	for id, session := range sessions {
+		if _, err := tx.Exec("UPDATE requests SET session_id = ? WHERE id = ?", session, id); err != nil {
+			return fmt.Errorf("failed to backfill request %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// backfillErrorTypes fills the error type of responses stored before it had a
+// column. Encrypted responses and those in blob files can't be read here and
+// are left without one.
+func backfillErrorTypes(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, response, response_encoding FROM requests WHERE response IS NOT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to query requests to backfill: %w", err)
+	}
+	defer rows.Close()
+
+	var codec payloadCodec
+	errorTypes := make(map[string]string)
+	for rows.Next() {
+		var id string
+		var response []byte
+		var encoding sql.NullString
+		if err := rows.Scan(&id, &response, &encoding); err != nil {
+			return fmt.Errorf("failed to scan request to backfill: %w", err)
+		}
+		if resp := codec.decodeStoredResponse(response, encoding); resp != nil {
+			if errorType := responseErrorType(resp); errorType != "" {
+				errorTypes[id] = errorType
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query requests to backfill: %w", err)
+	}
+	rows.Close()
+
+	for id, errorType := range errorTypes {
+		if _, err := tx.Exec("UPDATE requests SET error_type = ? WHERE id = ?", errorType, id); err != nil {
+			return fmt.Errorf("failed to backfill request %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// backfillProjects fills the project of requests stored before it was
+// recorded. Encrypted bodies and those in blob files can't be read here and
+// are left without one.
+func backfillProjects(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, body, body_encoding FROM requests WHERE project IS NULL")
+	if err != nil {
+		return fmt.Errorf("failed to query requests to backfill: %w", err)
+	}
+	defer rows.Close()
+
+	type storedBody struct {
+		id       string
+		body     []byte
+		encoding sql.NullString
+	}
+	var bodies []storedBody
+	for rows.Next() {
+		var stored storedBody
+		if err := rows.Scan(&stored.id, &stored.body, &stored.encoding); err != nil {
+			return fmt.Errorf("failed to scan request to backfill: %w", err)
+		}
+		bodies = append(bodies, stored)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query requests to backfill: %w", err)
+	}
+	rows.Close()
+
+	// Bodies are read once the query is done, as shared segments are loaded
+	// through the same transaction
+	codec := migrationCodec(tx)
+	for _, stored := range bodies {
+		body, err := codec.decode(stored.body, stored.encoding)
+		if err != nil {
+			continue
+		}
+		if project := bodyProject(body); project != "" {
+			if _, err := tx.Exec("UPDATE requests SET project = ? WHERE id = ?", project, stored.id); err != nil {
+				return fmt.Errorf("failed to backfill request %s: %w", stored.id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// migrationCodec reads the payloads a migration backfills from: compressed
+// ones and bodies sharing segments, though not encrypted ones or blob files
+func migrationCodec(tx *sql.Tx) *payloadCodec {
+	codec := &payloadCodec{}
+	codec.segments = func(hash string) ([]byte, error) {
+		var data []byte
+		var encoding sql.NullString
+		if err := tx.QueryRow("SELECT data, encoding FROM body_segments WHERE hash = ?", hash).Scan(&data, &encoding); err != nil {
+			return nil, fmt.Errorf("failed to query body segment: %w", err)
+		}
+		return codec.decode(data, encoding)
+	}
+	return codec
+}
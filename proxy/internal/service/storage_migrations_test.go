@@ -0,0 +1,206 @@
+package service
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+func TestSQLiteMigrations_Versions(t *testing.T) {
+	if len(sqliteMigrations) != len(schemaChangelog) {
+		t.Fatalf("%d migrations for %d changelog entries", len(sqliteMigrations), len(schemaChangelog))
+	}
+	for i, migration := range sqliteMigrations {
+		if migration.version != i+1 || migration.version != schemaChangelog[i].Version {
+			t.Errorf("migration %d has version %d, changelog entry version %d", i+1, migration.version, schemaChangelog[i].Version)
+		}
+	}
+}
+
+// originalSchema is the requests table as the first release created it, with
+// one request
+const originalSchema = `
+	CREATE TABLE requests (
+		id TEXT PRIMARY KEY,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		method TEXT NOT NULL,
+		endpoint TEXT NOT NULL,
+		headers TEXT NOT NULL,
+		body TEXT NOT NULL,
+		user_agent TEXT,
+		content_type TEXT,
+		prompt_grade TEXT,
+		response TEXT,
+		model TEXT,
+		original_model TEXT,
+		routed_model TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO requests (id, timestamp, method, endpoint, headers, body, model, response)
+	VALUES ('old', '2025-01-02T03:04:05Z', 'POST', '/v1/messages', '{}', '{"messages":[{"role":"user","content":"legacy prompt"}]}', 'claude-sonnet-4',
+		'{"statusCode":200,"headers":{},"responseTime":10,"body":{"usage":{"input_tokens":7,"output_tokens":3}}}');
+`
+
+// openMigrated opens a database at dbPath after running setup on it directly
+func openMigrated(t *testing.T, dbPath string, setup func(db *sql.DB) error) StorageService {
+	t.Helper()
+	if setup != nil {
+		db, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		err = setup(db)
+		db.Close()
+		if err != nil {
+			t.Fatalf("failed to set up database: %v", err)
+		}
+	}
+
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: dbPath})
+	if err != nil {
+		t.Fatalf("NewSQLiteStorageService() returned error: %v", err)
+	}
+	return storage
+}
+
+func execSetup(statements string) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		_, err := db.Exec(statements)
+		return err
+	}
+}
+
+func TestSQLiteStorage_Migrate(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(db *sql.DB) error
+	}{
+		{"New database", nil},
+		{"Original schema without a version", execSetup(originalSchema)},
+		{"Partly migrated without a version", execSetup(originalSchema + `
+			ALTER TABLE requests ADD COLUMN experiment TEXT;
+			ALTER TABLE requests ADD COLUMN provider TEXT;
+			CREATE TABLE routing_rules (id TEXT PRIMARY KEY, position INTEGER NOT NULL DEFAULT 0, rule TEXT NOT NULL, created_at TEXT NOT NULL, updated_at TEXT NOT NULL);
+		`)},
+		{"Version 8", func(db *sql.DB) error {
+			for _, migration := range sqliteMigrations[:8] {
+				tx, err := db.Begin()
+				if err != nil {
+					return err
+				}
+				if err := migration.apply(tx); err != nil {
+					tx.Rollback()
+					return err
+				}
+				if err := tx.Commit(); err != nil {
+					return err
+				}
+			}
+			_, err := db.Exec("PRAGMA user_version = 8")
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbPath := filepath.Join(t.TempDir(), "requests.db")
+			storage := openMigrated(t, dbPath, tt.setup)
+
+			var version int
+			if err := storage.(*sqliteStorageService).db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+				t.Fatalf("failed to read user_version: %v", err)
+			}
+			if version != SchemaVersion {
+				t.Errorf("user_version = %d, want %d", version, SchemaVersion)
+			}
+
+			tables, err := storage.GetSchema()
+			if err != nil {
+				t.Fatalf("GetSchema() returned error: %v", err)
+			}
+			found := make(map[string]bool)
+			for _, table := range tables {
+				found[table.Name] = true
+				for _, column := range table.Columns {
+					found[table.Name+"."+column.Name] = true
+				}
+			}
+			for _, change := range SchemaChangelog() {
+				for _, added := range change.Added {
+					if !found[added] {
+						t.Errorf("%s is missing after migrating", added)
+					}
+				}
+			}
+
+			// Opening the migrated database again changes nothing
+			if _, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: dbPath}); err != nil {
+				t.Errorf("reopening returned error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSQLiteStorage_MigrateBackfillsLegacyRows(t *testing.T) {
+	storage := openMigrated(t, filepath.Join(t.TempDir(), "requests.db"), execSetup(originalSchema))
+
+	var status, inputTokens int
+	if err := storage.(*sqliteStorageService).db.QueryRow("SELECT status_code, input_tokens FROM requests WHERE id = 'old'").Scan(&status, &inputTokens); err != nil {
+		t.Fatalf("failed to read backfilled columns: %v", err)
+	}
+	if status != 200 || inputTokens != 7 {
+		t.Errorf("backfilled status %d and %d input tokens, want 200 and 7", status, inputTokens)
+	}
+
+	found, _, err := storage.SearchRequests("legacy", 1, 10)
+	if err != nil || len(found) != 1 {
+		t.Errorf("SearchRequests(legacy) = %d requests, %v; want the old request indexed", len(found), err)
+	}
+
+	session := bodySessionID([]byte(`{"messages":[{"role":"user","content":"legacy prompt"}]}`))
+	inSession, err := storage.GetSessionRequests(session)
+	if err != nil || len(inSession) != 1 || inSession[0].SessionID != session {
+		t.Errorf("GetSessionRequests(%s) = %+v, %v; want the old request", session, inSession, err)
+	}
+}
+
+func TestSQLiteStorage_MigrateTimestampsToUTC(t *testing.T) {
+	storage := openMigrated(t, filepath.Join(t.TempDir(), "requests.db"), execSetup(originalSchema+`
+		INSERT INTO requests (id, timestamp, method, endpoint, headers, body)
+		VALUES ('offset', '2025-01-02T01:30:00-05:00', 'POST', '/v1/messages', '{}', '{}');
+	`))
+
+	for id, want := range map[string]string{
+		"old":    "2025-01-02T03:04:05Z",
+		"offset": "2025-01-02T06:30:00Z",
+	} {
+		var timestamp string
+		if err := storage.(*sqliteStorageService).db.QueryRow("SELECT timestamp FROM requests WHERE id = ?", id).Scan(&timestamp); err != nil {
+			t.Fatalf("failed to read %s: %v", id, err)
+		}
+		if timestamp != want {
+			t.Errorf("%s timestamp = %s, want %s", id, timestamp, want)
+		}
+	}
+}
+
+func TestSQLiteStorage_MigrateNewerDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "requests.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	_, err = db.Exec("CREATE TABLE requests (id TEXT PRIMARY KEY); PRAGMA user_version = 9999")
+	db.Close()
+	if err != nil {
+		t.Fatalf("failed to set up database: %v", err)
+	}
+
+	_, err = NewSQLiteStorageService(&config.StorageConfig{DBPath: dbPath})
+	if err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("NewSQLiteStorageService() = %v, want an error about the newer schema", err)
+	}
+}
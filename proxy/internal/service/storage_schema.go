@@ -0,0 +1,100 @@
+package service
+
+import (
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// SchemaVersion is the version of the stored schema and data format, also
+// written to the database's user_version. Bump it with a schemaChangelog
+// entry and a sqliteMigrations step whenever tables, columns or the encoding
+// of stored data change.
+const SchemaVersion = 29
+
+var schemaChangelog = []model.SchemaChange{
+	{Version: 1, Description: "Requests with their headers, bodies, prompt grades, and original and routed models", Added: []string{"requests"}},
+	{Version: 2, Description: "A/B experiment and arm of each request", Added: []string{"requests.experiment", "requests.experiment_arm"}},
+	{Version: 3, Description: "Shadow responses from mirrored traffic", Added: []string{"requests.shadow"}},
+	{Version: 4, Description: "Routing rules managed through the API", Added: []string{"routing_rules"}},
+	{Version: 5, Description: "Provider and request sizes of each request; responses gain wireBytes and bodyBytes", Added: []string{"requests.provider", "requests.request_bytes", "requests.request_wire_bytes"}},
+	{Version: 6, Description: "Why each request was routed where it was", Added: []string{"requests.routing"}},
+	{Version: 7, Description: "Usage reported from outside the proxy", Added: []string{"usage_events"}},
+	{Version: 8, Description: "Routing config snapshots, and the generation each request was routed under", Added: []string{"config_snapshots", "requests.config_generation"}},
+	{Version: 9, Description: "Responses record their origin (upstream, cache, synthetic or fallback); older ones are inferred when read"},
+	{Version: 10, Description: "Text of each request and response for search, an FTS5 index when SQLite has it", Added: []string{"request_search"}},
+	{Version: 11, Description: "Status, origin, time, sizes and tokens of each response in their own columns, filled in for older requests", Added: []string{
+		"requests.status_code", "requests.response_origin", "requests.response_ms", "requests.response_bytes", "requests.response_wire_bytes",
+		"requests.input_tokens", "requests.output_tokens", "requests.cache_read_tokens", "requests.cache_creation_tokens",
+	}},
+	{Version: 12, Description: "Large request bodies and responses are stored gzip-compressed, marked by their encoding columns", Added: []string{"requests.body_encoding", "requests.response_encoding"}},
+	{Version: 13, Description: "Bodies and responses may be encrypted with AES-GCM when an encryption key is configured, and are then left out of the search index"},
+	{Version: 14, Description: "Conversation each request belongs to, from Claude Code's session or a fingerprint of the opening message, filled in for older readable requests", Added: []string{"requests.session_id"}},
+	{Version: 15, Description: "Cost of each request in USD with the prices when it was stored; older requests are costed with the prices of the first start after the upgrade", Added: []string{"requests.cost_usd"}},
+	{Version: 16, Description: "Bodies and responses over a configured size may be kept in blob files, leaving a reference with a preview in the database marked by a final blob encoding step"},
+	{Version: 17, Description: "Requests moved to the archive bucket, and the object each one is in", Added: []string{"archived_requests"}},
+	{Version: 18, Description: "System prompts, tool definitions and messages of request bodies stored once by SHA-256 and shared between requests, marked by a first dedup encoding step", Added: []string{"body_segments", "request_segments"}},
+	{Version: 19, Description: "Labels attached to requests through the API", Added: []string{"request_tags"}},
+	{Version: 20, Description: "Time to first token, duration, event count and output tokens per second of each streamed response", Added: []string{
+		"requests.ttft_ms", "requests.stream_ms", "requests.stream_chunks", "requests.tokens_per_second",
+	}},
+	{Version: 21, Description: "When a request was moved to the trash; trashed requests are hidden until they're restored or purged", Added: []string{"requests.deleted_at"}},
+	{Version: 22, Description: "User each request was routed for; with tenancy on, each user sees only their own requests through the API", Added: []string{"requests.tenant"}},
+	{Version: 23, Description: "Type of the API error each failed response carried, such as overloaded_error or rate_limit_error, filled in for older readable responses", Added: []string{"requests.error_type"}},
+	{Version: 24, Description: "Project each request was made for, the working directory Claude Code reports, filled in for older readable requests", Added: []string{"requests.project"}},
+	{Version: 25, Description: "Usage summed by UTC day and model, provider or routed model, so stats over long ranges read closed days from here; days are summed again after their requests change", Added: []string{"usage_daily", "usage_daily_days"}},
+	{Version: 26, Description: "Request timestamps are stored in UTC, those logged with the server's offset converted, so they sort and group the same whatever time zone the server runs in"},
+	{Version: 27, Description: "Stars and free-text notes attached to requests through the API", Added: []string{"request_annotations"}},
+	{Version: 28, Description: "Reports analyzing whole conversations, stored by session", Added: []string{"conversation_reports"}},
+	{Version: 29, Description: "Prompt grades and shadow responses are encoded like bodies and responses, so they're encrypted too when an encryption key is configured", Added: []string{"requests.prompt_grade_encoding", "requests.shadow_encoding"}},
+}
+
+// SchemaChangelog returns every version of the stored schema, oldest first
+func SchemaChangelog() []model.SchemaChange {
+	return append([]model.SchemaChange(nil), schemaChangelog...)
+}
+
+// StoredDataFormats describes how request data is encoded
+func StoredDataFormats() model.DataFormats {
+	return model.DataFormats{
+		Timestamps:   "rfc3339",
+		RequestBody:  "anthropic-messages-json",
+		ResponseBody: []string{"json", "text"},
+		Streaming:    "sse-lines",
+		Encodings:    []string{payloadEncodingGzip, payloadEncodingAESGCM, payloadEncodingGzip + "+" + payloadEncodingAESGCM, payloadEncodingBlob, payloadEncodingGzip + "+" + payloadEncodingBlob, payloadEncodingDedup + "+" + payloadEncodingGzip},
+		Exports: map[string]string{
+			"/api/v1/export/anonymized":            "application/x-ndjson",
+			"/api/v1/requests/export?format=jsonl": "application/x-ndjson",
+			"/api/v1/requests/export?format=csv":   "text/csv",
+			"/api/v1/summary.txt":                  "text/plain",
+		},
+	}
+}
+
+// Features lists the routing features enabled in the config, which decide
+// what requests can record (experiment arms, continuations, users and so on)
+func (r *ModelRouter) Features() []string {
+	var features []string
+	add := func(name string, enabled bool) {
+		if enabled {
+			features = append(features, name)
+		}
+	}
+
+	r.rulesMu.RLock()
+	rules := len(r.rules) > 0
+	r.rulesMu.RUnlock()
+
+	routing := r.config.Routing
+	add("subagent_routing", r.config.Subagents.Enable)
+	add("routing_hook", r.hook != nil)
+	add("routing_rules", rules)
+	add("experiments", len(r.experiments) > 0 || len(r.mappingCanaries) > 0)
+	add("size_routing", routing.LongContextModel != "" || routing.SmallRequestModel != "")
+	add("tier_routing", len(r.tiers) > 0)
+	add("user_policies", len(r.users) > 0)
+	add("failover", routing.Fallback.Model != "" || len(routing.Fallback.Models) > 0)
+	add("health_fallbacks", len(r.healthFallbacks) > 0)
+	add("context_limits", len(r.contextPolicies) > 0)
+	add("budget", r.budget.Enabled())
+	add("continuation", routing.Continuation.Enable)
+	return features
+}
@@ -4,7 +4,10 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log"
+	"sort"
 	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 
@@ -15,55 +18,76 @@ import (
 type sqliteStorageService struct {
 	db     *sql.DB
 	config *config.StorageConfig
+	// fts is whether request_search is an FTS5 index; without FTS5 compiled
+	// into SQLite it's a plain table searched with LIKE
+	fts   bool
+	codec payloadCodec
+	// prices cost responses as they're stored; see SetPrices
+	prices *PriceTable
+	// tenant limits a view made by ForTenant to one user's requests
+	tenant string
 }
 
 func NewSQLiteStorageService(cfg *config.StorageConfig) (StorageService, error) {
-	db, err := sql.Open("sqlite3", cfg.DBPath)
+	db, err := openSQLite(cfg.DBPath, cfg.SQLite)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	return newSQLiteStorage(db, cfg)
+}
+
+// newSQLiteStorage migrates an opened database and stores requests in it
+func newSQLiteStorage(db *sql.DB, cfg *config.StorageConfig) (*sqliteStorageService, error) {
+	codec, err := newPayloadCodec(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	service := &sqliteStorageService{
 		db:     db,
 		config: cfg,
+		codec:  codec,
 	}
+	service.codec.segments = service.loadSegment
 
-	if err := service.createTables(); err != nil {
-		return nil, fmt.Errorf("failed to create tables: %w", err)
+	if err := service.migrate(); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
 	return service, nil
 }
 
-func (s *sqliteStorageService) createTables() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS requests (
-		id TEXT PRIMARY KEY,
-		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
-		method TEXT NOT NULL,
-		endpoint TEXT NOT NULL,
-		headers TEXT NOT NULL,
-		body TEXT NOT NULL,
-		user_agent TEXT,
-		content_type TEXT,
-		prompt_grade TEXT,
-		response TEXT,
-		model TEXT,
-		original_model TEXT,
-		routed_model TEXT,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_timestamp ON requests(timestamp DESC);
-	CREATE INDEX IF NOT EXISTS idx_endpoint ON requests(endpoint);
-	CREATE INDEX IF NOT EXISTS idx_model ON requests(model);
-	`
+func (s *sqliteStorageService) SaveRequest(request *model.RequestLog) (string, error) {
+	return s.saveRequest(s.db, request)
+}
+
+// writeBatch stores writes queued by AsyncStorage in one transaction
+func (s *sqliteStorageService) writeBatch(writes []storageWrite) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
-	_, err := s.db.Exec(schema)
-	return err
+	for _, write := range writes {
+		switch write.kind {
+		case writeRequest:
+			_, err = s.saveRequest(tx, write.request)
+		case writeResponse:
+			err = s.updateRequestWithResponse(tx, write.request)
+		case writeGrade:
+			err = s.updateRequestWithGrading(tx, write.requestID, write.grade)
+		case writeShadow:
+			err = s.updateRequestWithShadow(tx, write.requestID, write.shadow)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-func (s *sqliteStorageService) SaveRequest(request *model.RequestLog) (string, error) {
+func (s *sqliteStorageService) saveRequest(db execer, request *model.RequestLog) (string, error) {
 	headersJSON, err := json.Marshal(request.Headers)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal headers: %w", err)
@@ -74,36 +98,269 @@ func (s *sqliteStorageService) SaveRequest(request *model.RequestLog) (string, e
 		return "", fmt.Errorf("failed to marshal body: %w", err)
 	}
 
+	routingJSON, err := marshalRouting(request.Routing)
+	if err != nil {
+		return "", err
+	}
+
+	body, bodyEncoding, err := s.encodeBody(db, request.RequestID, bodyJSON)
+	if err != nil {
+		return "", err
+	}
+
 	query := `
-		INSERT INTO requests (id, timestamp, method, endpoint, headers, body, user_agent, content_type, model, original_model, routed_model)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO requests (id, timestamp, method, endpoint, headers, body, body_encoding, user_agent, content_type, model, original_model, routed_model, experiment, experiment_arm, provider, session_id, request_bytes, request_wire_bytes, routing, config_generation, tenant, project)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err = s.db.Exec(query,
+	_, err = db.Exec(query,
 		request.RequestID,
-		request.Timestamp,
+		storedTimestamp(request.Timestamp),
 		request.Method,
 		request.Endpoint,
 		string(headersJSON),
-		string(bodyJSON),
+		body,
+		bodyEncoding,
 		request.UserAgent,
 		request.ContentType,
 		request.Model,
 		request.OriginalModel,
 		request.RoutedModel,
+		request.Experiment,
+		request.ExperimentArm,
+		request.Provider,
+		request.SessionID,
+		request.RequestBytes,
+		request.RequestWireBytes,
+		routingJSON,
+		request.ConfigGeneration,
+		requestTenant(request),
+		requestProject(bodyJSON),
 	)
 
 	if err != nil {
 		return "", fmt.Errorf("failed to insert request: %w", err)
 	}
 
+	_, err = db.Exec("INSERT INTO request_search (id, request_text, response_text) VALUES (?, ?, '')", request.RequestID, s.codec.requestText(bodyJSON))
+	if err != nil {
+		return "", fmt.Errorf("failed to index request: %w", err)
+	}
+
 	return request.RequestID, nil
 }
 
+// encodeBody prepares a request body for storage, first moving its shared
+// parts into body_segments, where each is stored once
+func (s *sqliteStorageService) encodeBody(db execer, requestID string, bodyJSON []byte) (interface{}, interface{}, error) {
+	deduped, segments := s.codec.dedup(bodyJSON)
+	for hash, segment := range segments {
+		data, steps, err := s.codec.compress(segment)
+		if err != nil {
+			return nil, nil, err
+		}
+		var encoding interface{}
+		if len(steps) > 0 {
+			encoding = strings.Join(steps, "+")
+		}
+		if _, err := db.Exec("INSERT OR IGNORE INTO body_segments (hash, data, encoding, bytes) VALUES (?, ?, ?, ?)",
+			hash, data, encoding, len(segment)); err != nil {
+			return nil, nil, fmt.Errorf("failed to store body segment: %w", err)
+		}
+		if _, err := db.Exec("INSERT OR IGNORE INTO request_segments (request_id, hash) VALUES (?, ?)", requestID, hash); err != nil {
+			return nil, nil, fmt.Errorf("failed to store body segment: %w", err)
+		}
+	}
+
+	body, encoding, err := s.codec.encode(deduped)
+	if err != nil || len(segments) == 0 {
+		return body, encoding, err
+	}
+	if encoding == nil {
+		return body, payloadEncodingDedup, nil
+	}
+	return body, payloadEncodingDedup + "+" + encoding.(string), nil
+}
+
+// loadSegment reads a part of a deduplicated body back from body_segments
+func (s *sqliteStorageService) loadSegment(hash string) ([]byte, error) {
+	var data []byte
+	var encoding sql.NullString
+	err := s.db.QueryRow("SELECT data, encoding FROM body_segments WHERE hash = ?", hash).Scan(&data, &encoding)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("body segment %s not found", hash)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query body segment: %w", err)
+	}
+	return s.codec.decode(data, encoding)
+}
+
+// pruneSegments deletes the body segments no stored request refers to anymore
+func (s *sqliteStorageService) pruneSegments(db execer) error {
+	if _, err := db.Exec("DELETE FROM request_segments WHERE request_id NOT IN (SELECT id FROM requests)"); err != nil {
+		return fmt.Errorf("failed to prune body segments: %w", err)
+	}
+	if _, err := db.Exec("DELETE FROM body_segments WHERE hash NOT IN (SELECT hash FROM request_segments)"); err != nil {
+		return fmt.Errorf("failed to prune body segments: %w", err)
+	}
+	return nil
+}
+
+// ImportRequest stores a complete request, such as one from an export, with
+// its response, shadow, grade, tags, star and note. It returns false without changing
+// anything when a request with the same ID is already stored.
+func (s *sqliteStorageService) ImportRequest(request *model.RequestLog) (bool, error) {
+	headersJSON, err := json.Marshal(request.Headers)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal headers: %w", err)
+	}
+	bodyJSON, err := json.Marshal(request.Body)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal body: %w", err)
+	}
+	routingJSON, err := marshalRouting(request.Routing)
+	if err != nil {
+		return false, err
+	}
+
+	// Exports from before sessions were recorded don't have one
+	sessionID := request.SessionID
+	if sessionID == "" {
+		sessionID = bodySessionID(bodyJSON)
+	}
+	// Keep the cost the request was exported with, as for requests stored here
+	var cost interface{}
+	if request.CostUSD != nil {
+		cost = *request.CostUSD
+	} else {
+		cost = s.responseCost(request)
+	}
+
+	// A missing grade, response or shadow stays NULL, as for new requests
+	var grade, gradeEncoding, response, responseEncoding, shadow, shadowEncoding interface{}
+	if request.PromptGrade != nil {
+		gradeJSON, err := json.Marshal(request.PromptGrade)
+		if err != nil {
+			return false, fmt.Errorf("failed to marshal grade: %w", err)
+		}
+		if grade, gradeEncoding, err = s.codec.encode(gradeJSON); err != nil {
+			return false, err
+		}
+	}
+	if request.Response != nil {
+		responseJSON, err := json.Marshal(request.Response)
+		if err != nil {
+			return false, fmt.Errorf("failed to marshal response: %w", err)
+		}
+		if response, responseEncoding, err = s.codec.encode(responseJSON); err != nil {
+			return false, err
+		}
+	}
+	if request.Shadow != nil {
+		shadowJSON, err := json.Marshal(request.Shadow)
+		if err != nil {
+			return false, fmt.Errorf("failed to marshal shadow response: %w", err)
+		}
+		if shadow, shadowEncoding, err = s.codec.encode(shadowJSON); err != nil {
+			return false, err
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	body, bodyEncoding, err := s.encodeBody(tx, request.RequestID, bodyJSON)
+	if err != nil {
+		return false, err
+	}
+
+	query := `
+		INSERT OR IGNORE INTO requests (id, timestamp, method, endpoint, headers, body, body_encoding, user_agent, content_type, prompt_grade, prompt_grade_encoding, response, response_encoding, model, original_model, routed_model, experiment, experiment_arm, shadow, shadow_encoding, provider, session_id, request_bytes, request_wire_bytes, routing, config_generation, cost_usd, tenant, project, ` +
+		strings.Join(responseColumnNames, ", ") + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?` + strings.Repeat(", ?", len(responseColumnNames)) + `)
+	`
+	args := []interface{}{
+		request.RequestID,
+		storedTimestamp(request.Timestamp),
+		request.Method,
+		request.Endpoint,
+		string(headersJSON),
+		body,
+		bodyEncoding,
+		request.UserAgent,
+		request.ContentType,
+		grade,
+		gradeEncoding,
+		response,
+		responseEncoding,
+		request.Model,
+		request.OriginalModel,
+		request.RoutedModel,
+		request.Experiment,
+		request.ExperimentArm,
+		shadow,
+		shadowEncoding,
+		request.Provider,
+		sessionID,
+		request.RequestBytes,
+		request.RequestWireBytes,
+		routingJSON,
+		request.ConfigGeneration,
+		cost,
+		requestTenant(request),
+		requestProject(bodyJSON),
+	}
+	result, err := tx.Exec(query, append(args, responseColumns(request.Response)...)...)
+	if err != nil {
+		return false, fmt.Errorf("failed to import request: %w", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if inserted == 0 {
+		return false, nil
+	}
+
+	_, err = tx.Exec("INSERT INTO request_search (id, request_text, response_text) VALUES (?, ?, ?)",
+		request.RequestID, s.codec.requestText(bodyJSON), s.codec.responseText(request.Response))
+	if err != nil {
+		return false, fmt.Errorf("failed to index request: %w", err)
+	}
+	for _, tag := range request.Tags {
+		if tag, err := NormalizeTag(tag); err == nil {
+			if _, err := tx.Exec("INSERT OR IGNORE INTO request_tags (request_id, tag, created_at) VALUES (?, ?, ?)",
+				request.RequestID, tag, time.Now().Format(time.RFC3339)); err != nil {
+				return false, fmt.Errorf("failed to tag request: %w", err)
+			}
+		}
+	}
+	if request.Starred || request.Note != "" {
+		var note interface{}
+		if request.Note != "" {
+			note = request.Note
+		}
+		if _, err := tx.Exec("INSERT INTO request_annotations (request_id, starred, note, updated_at) VALUES (?, ?, ?, ?)",
+			request.RequestID, request.Starred, note, time.Now().Format(time.RFC3339)); err != nil {
+			return false, fmt.Errorf("failed to annotate request: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit import: %w", err)
+	}
+	return true, nil
+}
+
 func (s *sqliteStorageService) GetRequests(page, limit int) ([]model.RequestLog, int, error) {
 	// Get total count
 	var total int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM requests").Scan(&total)
+	visible, visibleArgs := s.visible()
+	err := s.db.QueryRow("SELECT COUNT(*) FROM requests WHERE "+visible, visibleArgs...).Scan(&total)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to get total count: %w", err)
 	}
@@ -111,13 +368,14 @@ func (s *sqliteStorageService) GetRequests(page, limit int) ([]model.RequestLog,
 	// Get paginated results
 	offset := (page - 1) * limit
 	query := `
-		SELECT id, timestamp, method, endpoint, headers, body, model, user_agent, content_type, prompt_grade, response, original_model, routed_model
+		SELECT ` + requestColumns + `
 		FROM requests
+		WHERE ` + visible + `
 		ORDER BY timestamp DESC
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := s.db.Query(query, limit, offset)
+	rows, err := s.db.Query(query, queryArgs(visibleArgs, []interface{}{limit, offset})...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to query requests: %w", err)
 	}
@@ -125,85 +383,98 @@ func (s *sqliteStorageService) GetRequests(page, limit int) ([]model.RequestLog,
 
 	var requests []model.RequestLog
 	for rows.Next() {
-		var req model.RequestLog
-		var headersJSON, bodyJSON string
-		var promptGradeJSON, responseJSON sql.NullString
-
-		err := rows.Scan(
-			&req.RequestID,
-			&req.Timestamp,
-			&req.Method,
-			&req.Endpoint,
-			&headersJSON,
-			&bodyJSON,
-			&req.Model,
-			&req.UserAgent,
-			&req.ContentType,
-			&promptGradeJSON,
-			&responseJSON,
-			&req.OriginalModel,
-			&req.RoutedModel,
-		)
+		req, err := s.scanRequest(rows)
 		if err != nil {
 			// Error scanning row - skip
 			continue
 		}
+		requests = append(requests, *req)
+	}
 
-		// Unmarshal JSON fields
-		if err := json.Unmarshal([]byte(headersJSON), &req.Headers); err != nil {
-			// Error unmarshaling headers
-			continue
-		}
+	return requests, total, nil
+}
 
-		var body interface{}
-		if err := json.Unmarshal([]byte(bodyJSON), &body); err != nil {
-			// Error unmarshaling body
-			continue
-		}
-		req.Body = body
+// SearchRequests finds the requests whose messages or response contain every
+// term of query, newest first. Quoted phrases must appear as written.
+func (s *sqliteStorageService) SearchRequests(query string, page, limit int) ([]model.RequestLog, int, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []model.RequestLog{}, 0, nil
+	}
 
-		if promptGradeJSON.Valid {
-			var grade model.PromptGrade
-			if err := json.Unmarshal([]byte(promptGradeJSON.String), &grade); err == nil {
-				req.PromptGrade = &grade
-			}
+	var match string
+	var args []interface{}
+	if s.fts {
+		match = "request_search MATCH ?"
+		args = append(args, ftsQuery(terms))
+	} else {
+		conditions := make([]string, len(terms))
+		for i, term := range terms {
+			conditions[i] = `(request_text LIKE ? ESCAPE '\' OR response_text LIKE ? ESCAPE '\')`
+			args = append(args, likePattern(term), likePattern(term))
 		}
+		match = strings.Join(conditions, " AND ")
+	}
+	matching := "SELECT id FROM request_search WHERE " + match
 
-		if responseJSON.Valid {
-			var resp model.ResponseLog
-			if err := json.Unmarshal([]byte(responseJSON.String), &resp); err == nil {
-				req.Response = &resp
-			}
-		}
+	visible, visibleArgs := s.visible()
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM requests WHERE "+visible+" AND id IN ("+matching+")", queryArgs(visibleArgs, args)...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count matching requests: %w", err)
+	}
 
-		requests = append(requests, req)
+	offset := (page - 1) * limit
+	rows, err := s.db.Query(`
+		SELECT `+requestColumns+`
+		FROM requests
+		WHERE `+visible+` AND id IN (`+matching+`)
+		ORDER BY timestamp DESC
+		LIMIT ? OFFSET ?
+	`, queryArgs(visibleArgs, args, []interface{}{limit, offset})...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search requests: %w", err)
+	}
+	defer rows.Close()
+
+	requests := []model.RequestLog{}
+	for rows.Next() {
+		req, err := s.scanRequest(rows)
+		if err != nil {
+			continue
+		}
+		requests = append(requests, *req)
 	}
 
 	return requests, total, nil
 }
 
+// ClearRequests moves every request to the trash, or deletes them all when
+// the trash is turned off
 func (s *sqliteStorageService) ClearRequests() (int, error) {
-	result, err := s.db.Exec("DELETE FROM requests")
-	if err != nil {
-		return 0, fmt.Errorf("failed to clear requests: %w", err)
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	if s.config.TrashDays > 0 {
+		return s.trashRequests("1 = 1")
 	}
-
-	return int(rowsAffected), nil
+	scope, scopeArgs := s.tenantScope()
+	return s.deleteRequests("1 = 1"+scope, scopeArgs...)
 }
 
 func (s *sqliteStorageService) UpdateRequestWithGrading(requestID string, grade *model.PromptGrade) error {
+	return s.updateRequestWithGrading(s.db, requestID, grade)
+}
+
+func (s *sqliteStorageService) updateRequestWithGrading(db execer, requestID string, grade *model.PromptGrade) error {
 	gradeJSON, err := json.Marshal(grade)
 	if err != nil {
 		return fmt.Errorf("failed to marshal grade: %w", err)
 	}
 
-	query := "UPDATE requests SET prompt_grade = ? WHERE id = ?"
-	_, err = s.db.Exec(query, string(gradeJSON), requestID)
+	value, encoding, err := s.codec.encode(gradeJSON)
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE requests SET prompt_grade = ?, prompt_grade_encoding = ? WHERE id = ?"
+	_, err = db.Exec(query, value, encoding, requestID)
 	if err != nil {
 		return fmt.Errorf("failed to update request with grading: %w", err)
 	}
@@ -212,173 +483,1978 @@ func (s *sqliteStorageService) UpdateRequestWithGrading(requestID string, grade
 }
 
 func (s *sqliteStorageService) UpdateRequestWithResponse(request *model.RequestLog) error {
+	return s.updateRequestWithResponse(s.db, request)
+}
+
+func (s *sqliteStorageService) updateRequestWithResponse(db execer, request *model.RequestLog) error {
 	responseJSON, err := json.Marshal(request.Response)
 	if err != nil {
 		return fmt.Errorf("failed to marshal response: %w", err)
 	}
 
-	query := "UPDATE requests SET response = ? WHERE id = ?"
-	_, err = s.db.Exec(query, string(responseJSON), request.RequestID)
+	routingJSON, err := marshalRouting(request.Routing)
+	if err != nil {
+		return err
+	}
+
+	response, responseEncoding, err := s.codec.encode(responseJSON)
+	if err != nil {
+		return err
+	}
+
+	// routed_model, provider and routing may have changed if the request failed over to a fallback
+	query := "UPDATE requests SET response = ?, response_encoding = ?, routed_model = ?, provider = ?, routing = ?, cost_usd = ?, " +
+		strings.Join(responseColumnNames, " = ?, ") + " = ? WHERE id = ?"
+	args := []interface{}{response, responseEncoding, request.RoutedModel, request.Provider, routingJSON, s.responseCost(request)}
+	args = append(args, responseColumns(request.Response)...)
+	_, err = db.Exec(query, append(args, request.RequestID)...)
 	if err != nil {
 		return fmt.Errorf("failed to update request with response: %w", err)
 	}
 
+	_, err = db.Exec("UPDATE request_search SET response_text = ? WHERE id = ?", s.codec.responseText(request.Response), request.RequestID)
+	if err != nil {
+		return fmt.Errorf("failed to index response: %w", err)
+	}
+
 	return nil
 }
 
-func (s *sqliteStorageService) EnsureDirectoryExists() error {
-	// No directory needed for SQLite
-	return nil
+// responseCost is what a request's response cost for the cost_usd column,
+// priced by the model it was sent to; NULL without a response or a price
+func (s *sqliteStorageService) responseCost(request *model.RequestLog) interface{} {
+	if request.Response == nil || s.prices == nil {
+		return nil
+	}
+	modelName := request.RoutedModel
+	if modelName == "" {
+		modelName = request.Model
+	}
+	// Synthetic responses cost nothing, whatever they claim to have used
+	var usage *model.AnthropicUsage
+	if responseOrigin(request.Response) != model.ResponseOriginSynthetic {
+		usage = responseUsage(request.Response)
+	}
+	cost, ok := s.prices.Cost(modelName, usage)
+	if !ok {
+		return nil
+	}
+	return cost
 }
 
-func (s *sqliteStorageService) GetRequestByShortID(shortID string) (*model.RequestLog, string, error) {
-	query := `
-		SELECT id, timestamp, method, endpoint, headers, body, model, user_agent, content_type, prompt_grade, response, original_model, routed_model
+// SetPrices sets the price table responses are costed with when they're
+// stored, and costs the stored requests that haven't been: those from before
+// costs were stored, and those to models that had no price until now
+func (s *sqliteStorageService) SetPrices(prices *PriceTable) error {
+	s.prices = prices
+
+	rows, err := s.db.Query(`
+		SELECT DISTINCT COALESCE(NULLIF(routed_model, ''), model, '')
 		FROM requests
-		WHERE id LIKE ?
-		ORDER BY timestamp DESC
-		LIMIT 1
-	`
+		WHERE cost_usd IS NULL AND status_code IS NOT NULL
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query requests to cost: %w", err)
+	}
+	defer rows.Close()
 
-	var req model.RequestLog
-	var headersJSON, bodyJSON string
-	var promptGradeJSON, responseJSON sql.NullString
+	var models []string
+	for rows.Next() {
+		var modelName string
+		if err := rows.Scan(&modelName); err != nil {
+			return fmt.Errorf("failed to scan model to cost: %w", err)
+		}
+		models = append(models, modelName)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query requests to cost: %w", err)
+	}
+	rows.Close()
 
-	err := s.db.QueryRow(query, "%"+shortID).Scan(
-		&req.RequestID,
-		&req.Timestamp,
-		&req.Method,
-		&req.Endpoint,
-		&headersJSON,
-		&bodyJSON,
-		&req.Model,
-		&req.UserAgent,
-		&req.ContentType,
-		&promptGradeJSON,
-		&responseJSON,
-		&req.OriginalModel,
-		&req.RoutedModel,
-	)
+	// The token columns are 0 for synthetic responses, so they cost nothing here too
+	for _, modelName := range models {
+		price, ok := prices.Price(modelName)
+		if !ok {
+			continue
+		}
+		_, err := s.db.Exec(`
+			UPDATE requests
+			SET cost_usd = (COALESCE(input_tokens, 0) * ? + COALESCE(output_tokens, 0) * ? +
+				COALESCE(cache_read_tokens, 0) * ? + COALESCE(cache_creation_tokens, 0) * ?) / 1e6
+			WHERE cost_usd IS NULL AND status_code IS NOT NULL
+				AND COALESCE(NULLIF(routed_model, ''), model, '') = ?
+		`, price.Input, price.Output, price.CacheRead, price.CacheWrite, modelName)
+		if err != nil {
+			return fmt.Errorf("failed to cost requests to %s: %w", modelName, err)
+		}
+	}
+	return nil
+}
 
-	if err == sql.ErrNoRows {
-		return nil, "", fmt.Errorf("request with ID %s not found", shortID)
+// requestTenant is the tenant column of a request: the user it was routed
+// for, NULL for requests of no configured user
+func requestTenant(request *model.RequestLog) interface{} {
+	if request.Routing == nil || request.Routing.User == "" {
+		return nil
 	}
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to query request: %w", err)
+	return request.Routing.User
+}
+
+// storedTimestamp is a request's timestamp in UTC, the form timestamps are
+// stored in so they sort as text whatever offset they were logged with
+func storedTimestamp(timestamp string) string {
+	if parsed, err := time.Parse(time.RFC3339, timestamp); err == nil {
+		return parsed.UTC().Format(time.RFC3339)
 	}
+	return timestamp
+}
 
-	// Unmarshal JSON fields
-	if err := json.Unmarshal([]byte(headersJSON), &req.Headers); err != nil {
-		return nil, "", fmt.Errorf("failed to unmarshal headers: %w", err)
+// requestProject is the project column of a request body: the working
+// directory Claude Code reports, NULL for other clients
+func requestProject(bodyJSON []byte) interface{} {
+	if project := bodyProject(bodyJSON); project != "" {
+		return project
+	}
+	return nil
+}
+
+// marshalRouting encodes a routing explanation for the routing column, which is
+// NULL when there is none
+func marshalRouting(routing *model.RoutingExplanation) (interface{}, error) {
+	if routing == nil {
+		return nil, nil
+	}
+	routingJSON, err := json.Marshal(routing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal routing explanation: %w", err)
 	}
+	return string(routingJSON), nil
+}
+
+func (s *sqliteStorageService) UpdateRequestWithShadow(requestID string, shadow *model.ShadowResponse) error {
+	return s.updateRequestWithShadow(s.db, requestID, shadow)
+}
 
-	var body interface{}
-	if err := json.Unmarshal([]byte(bodyJSON), &body); err != nil {
-		return nil, "", fmt.Errorf("failed to unmarshal body: %w", err)
+func (s *sqliteStorageService) updateRequestWithShadow(db execer, requestID string, shadow *model.ShadowResponse) error {
+	shadowJSON, err := json.Marshal(shadow)
+	if err != nil {
+		return fmt.Errorf("failed to marshal shadow response: %w", err)
 	}
-	req.Body = body
 
-	if promptGradeJSON.Valid {
-		var grade model.PromptGrade
-		if err := json.Unmarshal([]byte(promptGradeJSON.String), &grade); err == nil {
-			req.PromptGrade = &grade
-		}
+	value, encoding, err := s.codec.encode(shadowJSON)
+	if err != nil {
+		return err
 	}
 
-	if responseJSON.Valid {
-		var resp model.ResponseLog
-		if err := json.Unmarshal([]byte(responseJSON.String), &resp); err == nil {
-			req.Response = &resp
-		}
+	query := "UPDATE requests SET shadow = ?, shadow_encoding = ? WHERE id = ?"
+	_, err = db.Exec(query, value, encoding, requestID)
+	if err != nil {
+		return fmt.Errorf("failed to update request with shadow response: %w", err)
 	}
 
-	return &req, req.RequestID, nil
+	return nil
 }
 
-func (s *sqliteStorageService) GetConfig() *config.StorageConfig {
-	return s.config
+func (s *sqliteStorageService) EnsureDirectoryExists() error {
+	// No directory needed for SQLite
+	return nil
 }
 
-func (s *sqliteStorageService) GetAllRequests(modelFilter string) ([]*model.RequestLog, error) {
+func (s *sqliteStorageService) GetRequestByShortID(shortID string) (*model.RequestLog, string, error) {
+	visible, visibleArgs := s.visible()
 	query := `
-		SELECT id, timestamp, method, endpoint, headers, body, model, user_agent, content_type, prompt_grade, response, original_model, routed_model
+		SELECT ` + requestColumns + `
 		FROM requests
+		WHERE id LIKE ? AND ` + visible + `
+		ORDER BY timestamp DESC
+		LIMIT 1
 	`
-	args := []interface{}{}
-
-	if modelFilter != "" && modelFilter != "all" {
-		query += " WHERE LOWER(model) LIKE ?"
-		args = append(args, "%"+strings.ToLower(modelFilter)+"%")
 
+	req, err := s.scanRequest(s.db.QueryRow(query, queryArgs([]interface{}{"%" + shortID}, visibleArgs)...))
+	if err == sql.ErrNoRows {
+		return nil, "", fmt.Errorf("request with ID %s not found", shortID)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query request: %w", err)
 	}
 
-	query += " ORDER BY timestamp DESC"
+	return req, req.RequestID, nil
+}
 
-	rows, err := s.db.Query(query, args...)
+// GetRequestByID looks a request up by its full ID, returning nil if there's
+// no such request
+func (s *sqliteStorageService) GetRequestByID(id string) (*model.RequestLog, error) {
+	visible, visibleArgs := s.visible()
+	req, err := s.scanRequest(s.db.QueryRow("SELECT "+requestColumns+" FROM requests WHERE id = ? AND "+visible, queryArgs([]interface{}{id}, visibleArgs)...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to query requests: %w", err)
+		return nil, fmt.Errorf("failed to query request: %w", err)
 	}
-	defer rows.Close()
+	return req, nil
+}
 
-	var requests []*model.RequestLog
-	for rows.Next() {
-		var req model.RequestLog
-		var headersJSON, bodyJSON string
-		var promptGradeJSON, responseJSON sql.NullString
-
-		err := rows.Scan(
-			&req.RequestID,
-			&req.Timestamp,
-			&req.Method,
-			&req.Endpoint,
-			&headersJSON,
-			&bodyJSON,
-			&req.Model,
-			&req.UserAgent,
-			&req.ContentType,
-			&promptGradeJSON,
-			&responseJSON,
-			&req.OriginalModel,
-			&req.RoutedModel,
-		)
-		if err != nil {
-			// Error scanning row - skip
-			continue
-		}
+// liveRequest is the condition of requests that aren't in the trash, which
+// every read but the trash's own leaves out
+const liveRequest = "deleted_at IS NULL"
 
-		// Unmarshal JSON fields
-		if err := json.Unmarshal([]byte(headersJSON), &req.Headers); err != nil {
-			// Error unmarshaling headers
-			continue
-		}
+// ForTenant returns a view of the storage that reads and deletes only the
+// requests of tenant, the user they were routed for; "" sees every request
+func (s *sqliteStorageService) ForTenant(tenant string) StorageService {
+	view := *s
+	view.tenant = tenant
+	return &view
+}
 
-		var body interface{}
-		if err := json.Unmarshal([]byte(bodyJSON), &body); err != nil {
-			// Error unmarshaling body
-			continue
-		}
-		req.Body = body
+// visible is the condition of the requests reads return, with its
+// arguments: those not in the trash and, in a tenant's view, the tenant's
+func (s *sqliteStorageService) visible() (string, []interface{}) {
+	scope, args := s.tenantScope()
+	return liveRequest + scope, args
+}
 
-		if promptGradeJSON.Valid {
-			var grade model.PromptGrade
-			if err := json.Unmarshal([]byte(promptGradeJSON.String), &grade); err == nil {
-				req.PromptGrade = &grade
-			}
+// tenantScope narrows a condition on requests to the view's tenant, returning
+// the clause to append and the tenant to bind to it
+func (s *sqliteStorageService) tenantScope() (string, []interface{}) {
+	if s.tenant == "" {
+		return "", nil
+	}
+	return " AND tenant = ?", []interface{}{s.tenant}
+}
+
+// queryArgs joins the arguments of the parts of a query, in the order the
+// parts appear in it
+func queryArgs(parts ...[]interface{}) []interface{} {
+	var args []interface{}
+	for _, part := range parts {
+		args = append(args, part...)
+	}
+	return args
+}
+
+// requestColumns are the columns scanRequest expects, in order
+const requestColumns = `id, timestamp, method, endpoint, headers, body, model, user_agent, content_type, prompt_grade, response, original_model, routed_model, experiment, experiment_arm, shadow, provider, request_bytes, request_wire_bytes, routing, config_generation, body_encoding, response_encoding, prompt_grade_encoding, shadow_encoding, session_id, cost_usd, deleted_at,
+	(SELECT group_concat(tag) FROM request_tags WHERE request_tags.request_id = requests.id),
+	(SELECT starred FROM request_annotations WHERE request_annotations.request_id = requests.id),
+	(SELECT note FROM request_annotations WHERE request_annotations.request_id = requests.id)`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// execer is the database or a transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// scanRequest reads one row selected with requestColumns
+func (s *sqliteStorageService) scanRequest(row rowScanner) (*model.RequestLog, error) {
+	var req model.RequestLog
+	var headersJSON string
+	var body, response, promptGrade, shadow []byte
+	var bodyEncoding, responseEncoding, promptGradeEncoding, shadowEncoding sql.NullString
+	var routingJSON sql.NullString
+	var modelName, userAgent, contentType sql.NullString
+	var originalModel, routedModel, experiment, experimentArm, provider, sessionID sql.NullString
+	var requestBytes, requestWireBytes, configGeneration sql.NullInt64
+	var cost sql.NullFloat64
+	var deletedAt, tags, note sql.NullString
+	var starred sql.NullBool
+
+	err := row.Scan(
+		&req.RequestID,
+		&req.Timestamp,
+		&req.Method,
+		&req.Endpoint,
+		&headersJSON,
+		&body,
+		&modelName,
+		&userAgent,
+		&contentType,
+		&promptGrade,
+		&response,
+		&originalModel,
+		&routedModel,
+		&experiment,
+		&experimentArm,
+		&shadow,
+		&provider,
+		&requestBytes,
+		&requestWireBytes,
+		&routingJSON,
+		&configGeneration,
+		&bodyEncoding,
+		&responseEncoding,
+		&promptGradeEncoding,
+		&shadowEncoding,
+		&sessionID,
+		&cost,
+		&deletedAt,
+		&tags,
+		&starred,
+		&note,
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Model = modelName.String
+	req.UserAgent = userAgent.String
+	req.ContentType = contentType.String
+	req.OriginalModel = originalModel.String
+	req.RoutedModel = routedModel.String
+	req.Experiment = experiment.String
+	req.ExperimentArm = experimentArm.String
+	req.Provider = provider.String
+	req.SessionID = sessionID.String
+	req.RequestBytes = requestBytes.Int64
+	req.RequestWireBytes = requestWireBytes.Int64
+	req.ConfigGeneration = configGeneration.Int64
+	if cost.Valid {
+		req.CostUSD = &cost.Float64
+	}
+	req.Tags = splitTags(tags.String)
+	req.Starred = starred.Bool
+	req.Note = note.String
+	req.DeletedAt = deletedAt.String
+
+	// Unmarshal JSON fields
+	if err := json.Unmarshal([]byte(headersJSON), &req.Headers); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal headers: %w", err)
+	}
+
+	bodyJSON, err := s.codec.decode(body, bodyEncoding)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bodyJSON, &req.Body); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal body: %w", err)
+	}
+
+	// An unreadable grade or shadow response is left out, like a response
+	if promptGrade != nil {
+		if gradeJSON, err := s.codec.decode(promptGrade, promptGradeEncoding); err == nil {
+			var grade model.PromptGrade
+			if err := json.Unmarshal(gradeJSON, &grade); err == nil {
+				req.PromptGrade = &grade
+			}
+		}
+	}
+
+	req.Response = s.codec.decodeStoredResponse(response, responseEncoding)
+
+	if shadow != nil {
+		if shadowJSON, err := s.codec.decode(shadow, shadowEncoding); err == nil {
+			var shadowResponse model.ShadowResponse
+			if err := json.Unmarshal(shadowJSON, &shadowResponse); err == nil {
+				req.Shadow = &shadowResponse
+			}
+		}
+	}
+
+	if routingJSON.Valid {
+		var routing model.RoutingExplanation
+		if err := json.Unmarshal([]byte(routingJSON.String), &routing); err == nil {
+			req.Routing = &routing
+		}
+	}
+
+	return &req, nil
+}
+
+func (s *sqliteStorageService) GetConfig() *config.StorageConfig {
+	return s.config
+}
+
+// GetAllRequests returns the requests matching every field set in filter,
+// newest first
+func (s *sqliteStorageService) GetAllRequests(filter RequestFilter) ([]*model.RequestLog, error) {
+	conditions, args := filter.conditions()
+	visible, visibleArgs := s.visible()
+	query := `
+		SELECT ` + requestColumns + `
+		FROM requests
+		WHERE ` + visible + ` AND ` + conditions + `
+		ORDER BY timestamp DESC
+	`
+
+	rows, err := s.db.Query(query, queryArgs(visibleArgs, args)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query requests: %w", err)
+	}
+	defer rows.Close()
+
+	var requests []*model.RequestLog
+	for rows.Next() {
+		req, err := s.scanRequest(rows)
+		if err != nil {
+			// Error scanning row - skip
+			continue
+		}
+		if grade := req.PromptGrade; filter.Ungraded && grade != nil && !grade.IsProcessing && grade.Error == "" {
+			continue
+		}
+		requests = append(requests, req)
+	}
+
+	return requests, nil
+}
+
+// exportBatchSize is how many requests ExportRequests reads at a time, so an
+// export to a slow client doesn't hold a read transaction that blocks writes
+var exportBatchSize = 500
+
+// ExportRequests calls fn with each request between start and end whose model
+// contains modelFilter, oldest first, stopping at the first error fn returns
+func (s *sqliteStorageService) ExportRequests(start, end time.Time, modelFilter string, fn func(*model.RequestLog) error) error {
+	visible, visibleArgs := s.visible()
+	query := `
+		SELECT id, timestamp, ` + requestColumns + `
+		FROM requests
+		WHERE datetime(timestamp) >= datetime(?) AND datetime(timestamp) < datetime(?)
+			AND (timestamp, id) > (?, ?) AND ` + visible + `
+	`
+	// The cursor's two arguments go in after the first two
+	args := queryArgs([]interface{}{sqliteTime(start), sqliteTime(end)}, visibleArgs)
+	if modelFilter != "" && modelFilter != "all" {
+		query += " AND LOWER(model) LIKE ?"
+		args = append(args, "%"+strings.ToLower(modelFilter)+"%")
+	}
+	query += " ORDER BY timestamp, id LIMIT ?"
+
+	// Each batch continues after the last request of the one before
+	var afterTimestamp, afterID string
+	for {
+		batchArgs := append(append([]interface{}{}, args[:2]...), afterTimestamp, afterID)
+		batchArgs = append(append(batchArgs, args[2:]...), exportBatchSize)
+
+		rows, err := s.db.Query(query, batchArgs...)
+		if err != nil {
+			return fmt.Errorf("failed to query requests to export: %w", err)
+		}
+		var batch []*model.RequestLog
+		read := 0
+		for rows.Next() {
+			read++
+			req, err := s.scanRequest(cursorRow{rows, &afterID, &afterTimestamp})
+			if err != nil {
+				// Error scanning row - skip
+				continue
+			}
+			batch = append(batch, req)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read requests to export: %w", err)
+		}
+
+		for _, req := range batch {
+			if err := fn(req); err != nil {
+				return err
+			}
+		}
+		if read < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// cursorRow reads the id and timestamp selected ahead of requestColumns into
+// the cursor of a batched read, even when the rest of the row can't be decoded
+type cursorRow struct {
+	rows          *sql.Rows
+	id, timestamp *string
+}
+
+func (c cursorRow) Scan(dest ...interface{}) error {
+	return c.rows.Scan(append([]interface{}{c.id, c.timestamp}, dest...)...)
+}
+
+func (s *sqliteStorageService) GetStats(start, end time.Time) (*model.UsageStats, error) {
+	stats := &model.UsageStats{
+		From: start.Format(time.RFC3339),
+		To:   end.Format(time.RFC3339),
+	}
+
+	byModel, err := s.sumUsage("COALESCE(model, '')", start, end)
+	if err != nil {
+		return nil, err
+	}
+	byProvider, err := s.sumUsage("COALESCE(provider, '')", start, end)
+	if err != nil {
+		return nil, err
+	}
+	// Requests logged before the provider was recorded aren't attributed
+	delete(byProvider, "")
+
+	modelLatency, err := s.getLatency("COALESCE(model, '')", start, end)
+	if err != nil {
+		return nil, err
+	}
+	providerLatency, err := s.getLatency("COALESCE(provider, '')", start, end)
+	if err != nil {
+		return nil, err
+	}
+	totalLatency, err := s.getLatency("''", start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	total := &modelAccumulator{}
+	for _, acc := range byModel {
+		total.merge(acc)
+	}
+
+	access, err := s.getModelAccessUsage(start, end)
+	if err != nil {
+		return nil, err
+	}
+	errorTypes, err := s.getErrorTypeUsage(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := map[string]*sourceAccumulator{}
+	if total.usage.Requests > 0 {
+		sources[model.UsageSourceProxy] = &sourceAccumulator{}
+		sources[model.UsageSourceProxy].addUsage(total.usage)
+	}
+
+	events, err := s.getUsageEvents(start, end)
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		acc, ok := byModel[event.Model]
+		if !ok {
+			acc = &modelAccumulator{}
+			byModel[event.Model] = acc
+		}
+		acc.addEvent(event)
+		total.addEvent(event)
+
+		sacc, ok := sources[event.Source]
+		if !ok {
+			sacc = &sourceAccumulator{}
+			sources[event.Source] = sacc
+		}
+		sacc.addEvent(event)
+	}
+
+	stats.Requests = total.usage.Requests
+	stats.Errors = total.usage.Errors
+	stats.InputTokens = total.usage.InputTokens
+	stats.OutputTokens = total.usage.OutputTokens
+	stats.CacheReadTokens = total.usage.CacheReadTokens
+	stats.CacheCreationTokens = total.usage.CacheCreationTokens
+	totals := total.averaged()
+	stats.AvgResponseTime = totals.AvgResponseTime
+	stats.AvgTimeToFirstToken = totals.AvgTimeToFirstToken
+	stats.AvgTokensPerSecond = totals.AvgTokensPerSecond
+	stats.Synthetic = total.usage.Synthetic
+	stats.CostUSD = total.usage.CostUSD
+	stats.Bandwidth = total.usage.Bandwidth
+	stats.Latency = totalLatency[""]
+
+	stats.Models = make([]model.ModelUsage, 0, len(byModel))
+	for name, acc := range byModel {
+		usage := acc.averaged()
+		usage.Model = name
+		usage.Latency = modelLatency[name]
+		stats.Models = append(stats.Models, usage)
+	}
+	sort.Slice(stats.Models, func(i, j int) bool {
+		if stats.Models[i].Requests != stats.Models[j].Requests {
+			return stats.Models[i].Requests > stats.Models[j].Requests
+		}
+		return stats.Models[i].Model < stats.Models[j].Model
+	})
+
+	stats.Providers = make([]model.ProviderUsage, 0, len(byProvider))
+	for name, acc := range byProvider {
+		stats.Providers = append(stats.Providers, model.ProviderUsage{
+			Provider:  name,
+			Requests:  acc.usage.Requests,
+			Latency:   providerLatency[name],
+			Bandwidth: acc.usage.Bandwidth,
+		})
+	}
+	sort.Slice(stats.Providers, func(i, j int) bool {
+		return stats.Providers[i].Provider < stats.Providers[j].Provider
+	})
+
+	// The proxy first, then ingested sources by name
+	stats.Sources = make([]model.SourceUsage, 0, len(sources))
+	for name, acc := range sources {
+		usage := acc.usage
+		usage.Source = name
+		stats.Sources = append(stats.Sources, usage)
+	}
+	sort.Slice(stats.Sources, func(i, j int) bool {
+		if (stats.Sources[i].Source == model.UsageSourceProxy) != (stats.Sources[j].Source == model.UsageSourceProxy) {
+			return stats.Sources[i].Source == model.UsageSourceProxy
+		}
+		return stats.Sources[i].Source < stats.Sources[j].Source
+	})
+
+	stats.ModelAccess = access
+	stats.ErrorTypes = errorTypes
+
+	return stats, nil
+}
+
+// GetStatsSummary totals the requests and ingested usage between start and
+// end, with the 95th percentile response time alongside the average
+func (s *sqliteStorageService) GetStatsSummary(start, end time.Time) (*model.StatsSummary, error) {
+	stats, err := s.GetStats(start, end)
+	if err != nil {
+		return nil, err
+	}
+	latencies, err := s.latencies("response_ms", "''", start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.StatsSummary{
+		From:                stats.From,
+		To:                  stats.To,
+		Requests:            stats.Requests,
+		Errors:              stats.Errors,
+		InputTokens:         stats.InputTokens,
+		OutputTokens:        stats.OutputTokens,
+		CacheReadTokens:     stats.CacheReadTokens,
+		CacheCreationTokens: stats.CacheCreationTokens,
+		CostUSD:             stats.CostUSD,
+		AvgResponseTime:     stats.AvgResponseTime,
+		P95ResponseTime:     percentile(latencies[""], 95),
+	}, nil
+}
+
+// latencies returns the values of a timing column of the requests between
+// start and end by group, sorted. Responses without one, such as synthetic
+// ones, are left out.
+func (s *sqliteStorageService) latencies(column, group string, start, end time.Time) (map[string][]int64, error) {
+	visible, visibleArgs := s.visible()
+	query := `
+		SELECT ` + group + `, ` + column + `
+		FROM requests
+		WHERE datetime(timestamp) >= datetime(?) AND datetime(timestamp) < datetime(?)
+			AND ` + column + ` IS NOT NULL AND ` + visible + `
+		ORDER BY 2
+	`
+
+	rows, err := s.db.Query(query, queryArgs([]interface{}{sqliteTime(start), sqliteTime(end)}, visibleArgs)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query latencies: %w", err)
+	}
+	defer rows.Close()
+
+	groups := make(map[string][]int64)
+	for rows.Next() {
+		var key string
+		var value int64
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan latencies: %w", err)
+		}
+		groups[key] = append(groups[key], value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read latencies: %w", err)
+	}
+	return groups, nil
+}
+
+// getLatency ranks the response times and times to first token between start
+// and end by group
+func (s *sqliteStorageService) getLatency(group string, start, end time.Time) (map[string]model.Latency, error) {
+	responseTimes, err := s.latencies("response_ms", group, start, end)
+	if err != nil {
+		return nil, err
+	}
+	ttfts, err := s.latencies("ttft_ms", group, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	latency := make(map[string]model.Latency)
+	for key, values := range responseTimes {
+		l := latency[key]
+		l.ResponseTimePercentiles = percentiles(values)
+		latency[key] = l
+	}
+	for key, values := range ttfts {
+		l := latency[key]
+		l.TimeToFirstTokenPercentiles = percentiles(values)
+		latency[key] = l
+	}
+	return latency, nil
+}
+
+// sumUsage totals the requests between start and end grouped by the SQL
+// expression group, from the daily sums for the groupings usage_daily keeps.
+// Read-only storage reads every request instead of filling in the sums.
+func (s *sqliteStorageService) sumUsage(group string, start, end time.Time) (map[string]*modelAccumulator, error) {
+	if dimension, ok := dailyUsageDimensions[group]; ok && !s.config.ReadOnly {
+		return s.sumDailyUsage(dimension, group, start, end)
+	}
+	return s.sumRequests(group, start, end)
+}
+
+// sumRequests totals the requests between start and end grouped by the SQL
+// expression group, reading every one
+func (s *sqliteStorageService) sumRequests(group string, start, end time.Time) (map[string]*modelAccumulator, error) {
+	visible, visibleArgs := s.visible()
+	query := `
+		SELECT ` + group + `, ` + usageSums + `
+		FROM requests
+		WHERE datetime(timestamp) >= datetime(?) AND datetime(timestamp) < datetime(?)
+			AND ` + visible + `
+		GROUP BY 1
+	`
+	return s.queryUsage(query, queryArgs([]interface{}{sqliteTime(start), sqliteTime(end)}, visibleArgs)...)
+}
+
+// queryUsage reads the rows of a query selecting a group key and usageSums
+func (s *sqliteStorageService) queryUsage(query string, args ...interface{}) (map[string]*modelAccumulator, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+	defer rows.Close()
+
+	groups := make(map[string]*modelAccumulator)
+	for rows.Next() {
+		key, acc, err := scanUsage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		}
+		groups[key] = acc
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage: %w", err)
+	}
+	return groups, nil
+}
+
+// getErrorTypeUsage counts the failed responses between start and end by
+// status and error type, most frequent first
+func (s *sqliteStorageService) getErrorTypeUsage(start, end time.Time) ([]model.ErrorTypeUsage, error) {
+	visible, visibleArgs := s.visible()
+	query := `
+		SELECT status_code, COALESCE(error_type, ''), COUNT(*)
+		FROM requests
+		WHERE datetime(timestamp) >= datetime(?) AND datetime(timestamp) < datetime(?)
+			AND (status_code >= 400 OR error_type IS NOT NULL)
+			AND ` + visible + `
+		GROUP BY 1, 2
+		ORDER BY 3 DESC, 1, 2
+	`
+
+	rows, err := s.db.Query(query, queryArgs([]interface{}{sqliteTime(start), sqliteTime(end)}, visibleArgs)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query error types: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []model.ErrorTypeUsage{}
+	for rows.Next() {
+		var u model.ErrorTypeUsage
+		if err := rows.Scan(&u.StatusCode, &u.ErrorType, &u.Requests); err != nil {
+			return nil, fmt.Errorf("failed to scan error types: %w", err)
+		}
+		usage = append(usage, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read error types: %w", err)
+	}
+	return usage, nil
+}
+
+// getModelAccessUsage counts the requests between start and end whose model
+// the access lists blocked or rewrote
+func (s *sqliteStorageService) getModelAccessUsage(start, end time.Time) ([]model.ModelAccessUsage, error) {
+	visible, visibleArgs := s.visible()
+	query := `
+		SELECT COALESCE(json_extract(routing, '$.deniedModel'), ''), json_extract(routing, '$.access'), COUNT(*)
+		FROM requests
+		WHERE datetime(timestamp) >= datetime(?) AND datetime(timestamp) < datetime(?)
+			AND COALESCE(CASE WHEN json_valid(routing) THEN json_extract(routing, '$.access') END, '') != ''
+			AND ` + visible + `
+		GROUP BY 1, 2
+	`
+
+	rows, err := s.db.Query(query, queryArgs([]interface{}{sqliteTime(start), sqliteTime(end)}, visibleArgs)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query model access usage: %w", err)
+	}
+	defer rows.Close()
+
+	byModel := make(map[string]*model.ModelAccessUsage)
+	for rows.Next() {
+		var deniedModel, access string
+		var count int
+		if err := rows.Scan(&deniedModel, &access, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan model access usage: %w", err)
+		}
+		usage, ok := byModel[deniedModel]
+		if !ok {
+			usage = &model.ModelAccessUsage{Model: deniedModel}
+			byModel[deniedModel] = usage
+		}
+		if access == model.ModelAccessBlocked {
+			usage.Blocked += count
+		} else {
+			usage.Rewritten += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read model access usage: %w", err)
+	}
+
+	usage := make([]model.ModelAccessUsage, 0, len(byModel))
+	for _, u := range byModel {
+		usage = append(usage, *u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Model < usage[j].Model
+	})
+	return usage, nil
+}
+
+// GetRoutedUsage totals the tokens of proxied requests between start and end
+// by the model they were sent to, which is what they cost. Ingested usage
+// isn't included.
+func (s *sqliteStorageService) GetRoutedUsage(start, end time.Time) ([]model.ModelUsage, error) {
+	byModel, err := s.sumUsage("COALESCE(NULLIF(routed_model, ''), model, '')", start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make([]model.ModelUsage, 0, len(byModel))
+	for name, acc := range byModel {
+		u := acc.averaged()
+		u.Model = name
+		usage = append(usage, u)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Model < usage[j].Model })
+	return usage, nil
+}
+
+// GetModelComparison sets the usage, cost and latency of models side by side,
+// by the model requests were served by. Models without requests in the range
+// are listed with nothing.
+func (s *sqliteStorageService) GetModelComparison(models []string, start, end time.Time) (*model.ModelComparison, error) {
+	const group = "COALESCE(NULLIF(routed_model, ''), model, '')"
+	byModel, err := s.sumUsage(group, start, end)
+	if err != nil {
+		return nil, err
+	}
+	latency, err := s.getLatency(group, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &model.ModelComparison{
+		From:   start.Format(time.RFC3339),
+		To:     end.Format(time.RFC3339),
+		Models: make([]model.ComparedModel, 0, len(models)),
+	}
+	for _, name := range models {
+		acc, ok := byModel[name]
+		if !ok {
+			acc = &modelAccumulator{}
+		}
+		acc.usage.Model = name
+		acc.usage.Latency = latency[name]
+		comparison.Models = append(comparison.Models, acc.compared())
+	}
+	return comparison, nil
+}
+
+// clientGroup is the first part of a request's User-Agent, the client and
+// its version without the platform details after it
+const clientGroup = "COALESCE(substr(user_agent, 1, instr(user_agent || ' ', ' ') - 1), '')"
+
+// GetClientStats totals the requests between start and end by client and by
+// the authenticated user who made them, most tokens first. Requests without a
+// user agent or user are grouped under "".
+func (s *sqliteStorageService) GetClientStats(start, end time.Time) (*model.ClientStats, error) {
+	byClient, err := s.sumUsage(clientGroup, start, end)
+	if err != nil {
+		return nil, err
+	}
+	byUser, err := s.sumUsage("COALESCE(tenant, '')", start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &model.ClientStats{
+		From: start.Format(time.RFC3339),
+		To:   end.Format(time.RFC3339),
+	}
+	for _, acc := range byClient {
+		stats.Tokens += acc.usage.InputTokens + acc.usage.OutputTokens + acc.usage.CacheReadTokens + acc.usage.CacheCreationTokens
+	}
+	stats.Clients = clientShares(byClient, stats.Tokens)
+	stats.Users = clientShares(byUser, stats.Tokens)
+	return stats, nil
+}
+
+// clientShares lists groups of usage with their share of total tokens, most
+// tokens first
+func clientShares(groups map[string]*modelAccumulator, total int64) []model.ClientUsage {
+	shares := make([]model.ClientUsage, 0, len(groups))
+	for name, acc := range groups {
+		usage := model.ClientUsage{
+			Name:                name,
+			Requests:            acc.usage.Requests,
+			Errors:              acc.usage.Errors,
+			InputTokens:         acc.usage.InputTokens,
+			OutputTokens:        acc.usage.OutputTokens,
+			CacheReadTokens:     acc.usage.CacheReadTokens,
+			CacheCreationTokens: acc.usage.CacheCreationTokens,
+			CostUSD:             roundTo(acc.usage.CostUSD, 6),
+		}
+		usage.Tokens = usage.InputTokens + usage.OutputTokens + usage.CacheReadTokens + usage.CacheCreationTokens
+		if total > 0 {
+			usage.TokenShare = roundTo(float64(usage.Tokens)/float64(total)*100, 1)
+		}
+		shares = append(shares, usage)
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].Tokens != shares[j].Tokens {
+			return shares[i].Tokens > shares[j].Tokens
+		}
+		return shares[i].Name < shares[j].Name
+	})
+	return shares
+}
+
+// GetSessionRequests returns the requests of a conversation, oldest first
+func (s *sqliteStorageService) GetSessionRequests(sessionID string) ([]model.RequestLog, error) {
+	visible, visibleArgs := s.visible()
+	query := `
+		SELECT ` + requestColumns + `
+		FROM requests
+		WHERE session_id = ? AND ` + visible + `
+		ORDER BY timestamp ASC, id ASC
+	`
+
+	rows, err := s.db.Query(query, queryArgs([]interface{}{sessionID}, visibleArgs)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session requests: %w", err)
+	}
+	defer rows.Close()
+
+	requests := []model.RequestLog{}
+	for rows.Next() {
+		req, err := s.scanRequest(rows)
+		if err != nil {
+			// Error scanning row - skip
+			continue
+		}
+		requests = append(requests, *req)
+	}
+	return requests, rows.Err()
+}
+
+// GetSessionUsage totals the requests between start and end by conversation,
+// most recently active first. Requests without a session aren't included.
+func (s *sqliteStorageService) GetSessionUsage(start, end time.Time) ([]model.SessionUsage, error) {
+	bySession, err := s.sumUsage("COALESCE(session_id, '')", start, end)
+	if err != nil {
+		return nil, err
+	}
+	delete(bySession, "")
+
+	// With MAX, SQLite takes the model from the latest request
+	visible, visibleArgs := s.visible()
+	query := `
+		SELECT session_id, MIN(timestamp), MAX(timestamp), COALESCE(NULLIF(routed_model, ''), model, '')
+		FROM requests
+		WHERE datetime(timestamp) >= datetime(?) AND datetime(timestamp) < datetime(?)
+			AND session_id IS NOT NULL AND session_id != '' AND ` + visible + `
+		GROUP BY session_id
+	`
+	rows, err := s.db.Query(query, queryArgs([]interface{}{sqliteTime(start), sqliteTime(end)}, visibleArgs)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session times: %w", err)
+	}
+	defer rows.Close()
+
+	usage := make([]model.SessionUsage, 0, len(bySession))
+	for rows.Next() {
+		var session model.SessionUsage
+		var latestModel string
+		if err := rows.Scan(&session.Session, &session.FirstRequestAt, &session.LastRequestAt, &latestModel); err != nil {
+			return nil, fmt.Errorf("failed to scan session times: %w", err)
+		}
+		acc, ok := bySession[session.Session]
+		if !ok {
+			continue
+		}
+		session.ModelUsage = acc.averaged()
+		session.Model = latestModel
+		usage = append(usage, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read session times: %w", err)
+	}
+
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].LastRequestAt != usage[j].LastRequestAt {
+			return usage[i].LastRequestAt > usage[j].LastRequestAt
+		}
+		return usage[i].Session < usage[j].Session
+	})
+	return usage, nil
+}
+
+// GetUsageSamples returns the token usage of the requests between start and end
+// that were answered by their provider, oldest first
+func (s *sqliteStorageService) GetUsageSamples(start, end time.Time) ([]model.UsageSample, error) {
+	visible, visibleArgs := s.visible()
+	query := `
+		SELECT timestamp, COALESCE(provider, ''), COALESCE(NULLIF(routed_model, ''), model, ''),
+			COALESCE(input_tokens, 0), COALESCE(output_tokens, 0),
+			COALESCE(cache_read_tokens, 0), COALESCE(cache_creation_tokens, 0)
+		FROM requests
+		WHERE datetime(timestamp) >= datetime(?) AND datetime(timestamp) < datetime(?)
+			AND status_code < 400 AND COALESCE(response_origin, '') != ? AND ` + visible + `
+		ORDER BY datetime(timestamp)
+	`
+
+	rows, err := s.db.Query(query, queryArgs([]interface{}{sqliteTime(start), sqliteTime(end), model.ResponseOriginSynthetic}, visibleArgs)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage samples: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []model.UsageSample
+	for rows.Next() {
+		var sample model.UsageSample
+		err := rows.Scan(&sample.Timestamp, &sample.Provider, &sample.Model, &sample.Usage.InputTokens,
+			&sample.Usage.OutputTokens, &sample.Usage.CacheReadInputTokens, &sample.Usage.CacheCreationInputTokens)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan usage samples: %w", err)
+		}
+		samples = append(samples, sample)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage samples: %w", err)
+	}
+	return samples, nil
+}
+
+// GetCostGroups sums the tokens and cost of the requests between start and end
+// by day in start's location, project, provider, served model and requested
+// model. SQLite doesn't know time zones, so requests are summed by UTC hour and
+// the hours added up on their local day here.
+func (s *sqliteStorageService) GetCostGroups(start, end time.Time) ([]model.CostGroup, error) {
+	visible, visibleArgs := s.visible()
+	query := `
+		SELECT strftime('%Y-%m-%d %H:00:00', timestamp), COALESCE(project, ''), COALESCE(provider, ''),
+			COALESCE(NULLIF(routed_model, ''), model, ''), COALESCE(NULLIF(original_model, ''), model, ''),
+			COUNT(*),
+			COALESCE(SUM(status_code IS NOT NULL AND cost_usd IS NULL), 0),
+			COALESCE(SUM(input_tokens), 0),
+			COALESCE(SUM(output_tokens), 0),
+			COALESCE(SUM(cache_read_tokens), 0),
+			COALESCE(SUM(cache_creation_tokens), 0),
+			COALESCE(SUM(cost_usd), 0)
+		FROM requests
+		WHERE datetime(timestamp) >= datetime(?) AND datetime(timestamp) < datetime(?)
+			AND ` + visible + `
+		GROUP BY 1, 2, 3, 4, 5
+	`
+
+	rows, err := s.db.Query(query, queryArgs([]interface{}{sqliteTime(start), sqliteTime(end)}, visibleArgs)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query costs: %w", err)
+	}
+	defer rows.Close()
+
+	type costKey struct {
+		day, project, provider, model, requestedModel string
+	}
+	groups := []model.CostGroup{}
+	days := make(map[costKey]int)
+	for rows.Next() {
+		var g model.CostGroup
+		err := rows.Scan(&g.Day, &g.Project, &g.Provider, &g.Model, &g.RequestedModel, &g.Requests, &g.Unpriced,
+			&g.InputTokens, &g.OutputTokens, &g.CacheReadTokens, &g.CacheCreationTokens, &g.CostUSD)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan costs: %w", err)
+		}
+		if hour, err := time.Parse("2006-01-02 15:04:05", g.Day); err == nil {
+			g.Day = hour.In(start.Location()).Format("2006-01-02")
+		}
+
+		key := costKey{g.Day, g.Project, g.Provider, g.Model, g.RequestedModel}
+		i, ok := days[key]
+		if !ok {
+			days[key] = len(groups)
+			groups = append(groups, g)
+			continue
+		}
+		day := &groups[i]
+		day.Requests += g.Requests
+		day.Unpriced += g.Unpriced
+		day.InputTokens += g.InputTokens
+		day.OutputTokens += g.OutputTokens
+		day.CacheReadTokens += g.CacheReadTokens
+		day.CacheCreationTokens += g.CacheCreationTokens
+		day.CostUSD += g.CostUSD
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read costs: %w", err)
+	}
+	return groups, nil
+}
+
+// GetErrorGroups counts the answered requests between start and end by UTC
+// hour, status and error type
+func (s *sqliteStorageService) GetErrorGroups(start, end time.Time) ([]model.ErrorGroup, error) {
+	visible, visibleArgs := s.visible()
+	query := `
+		SELECT strftime('%Y-%m-%d %H:00:00', timestamp), status_code, COALESCE(error_type, ''), COUNT(*)
+		FROM requests
+		WHERE datetime(timestamp) >= datetime(?) AND datetime(timestamp) < datetime(?)
+			AND status_code IS NOT NULL AND ` + visible + `
+		GROUP BY 1, 2, 3
+		ORDER BY 1, 2, 3
+	`
+
+	rows, err := s.db.Query(query, queryArgs([]interface{}{sqliteTime(start), sqliteTime(end)}, visibleArgs)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query errors: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []model.ErrorGroup{}
+	for rows.Next() {
+		var g model.ErrorGroup
+		if err := rows.Scan(&g.Hour, &g.StatusCode, &g.ErrorType, &g.Requests); err != nil {
+			return nil, fmt.Errorf("failed to scan errors: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read errors: %w", err)
+	}
+	return groups, nil
+}
+
+// GetHourlyUsage totals the requests between start and end by UTC hour,
+// oldest first
+func (s *sqliteStorageService) GetHourlyUsage(start, end time.Time) ([]model.HourlyUsage, error) {
+	sums, err := s.sumUsage("strftime('%Y-%m-%d %H:00:00', timestamp)", start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	hours := make([]model.HourlyUsage, 0, len(sums))
+	for hour, acc := range sums {
+		hours = append(hours, model.HourlyUsage{
+			Hour:     hour,
+			Requests: acc.usage.Requests,
+			Tokens:   acc.usage.InputTokens + acc.usage.OutputTokens + acc.usage.CacheReadTokens + acc.usage.CacheCreationTokens,
+		})
+	}
+	sort.Slice(hours, func(i, j int) bool { return hours[i].Hour < hours[j].Hour })
+	return hours, nil
+}
+
+// GetGradedPrompts returns the grades of the prompts sent between start and
+// end, oldest first, leaving out those still being graded
+func (s *sqliteStorageService) GetGradedPrompts(start, end time.Time) ([]model.GradedPrompt, error) {
+	visible, visibleArgs := s.visible()
+	query := `
+		SELECT timestamp, prompt_grade, prompt_grade_encoding
+		FROM requests
+		WHERE datetime(timestamp) >= datetime(?) AND datetime(timestamp) < datetime(?)
+			AND prompt_grade IS NOT NULL AND ` + visible + `
+		ORDER BY datetime(timestamp)
+	`
+
+	rows, err := s.db.Query(query, queryArgs([]interface{}{sqliteTime(start), sqliteTime(end)}, visibleArgs)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query grades: %w", err)
+	}
+	defer rows.Close()
+
+	prompts := []model.GradedPrompt{}
+	for rows.Next() {
+		var prompt model.GradedPrompt
+		var grade []byte
+		var encoding sql.NullString
+		if err := rows.Scan(&prompt.Timestamp, &grade, &encoding); err != nil {
+			return nil, fmt.Errorf("failed to scan grades: %w", err)
+		}
+		gradeJSON, err := s.codec.decode(grade, encoding)
+		if err != nil {
+			continue
+		}
+		if err := json.Unmarshal(gradeJSON, &prompt.Grade); err != nil || prompt.Grade.IsProcessing || prompt.Grade.Error != "" {
+			continue
+		}
+		prompts = append(prompts, prompt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read grades: %w", err)
+	}
+	return prompts, nil
+}
+
+// GetProviderSamples returns the outcome of every completed request in the
+// range, attributed to the provider that served it, plus one failed sample
+// for each provider a request failed over from
+func (s *sqliteStorageService) GetProviderSamples(start, end time.Time) ([]model.ProviderSample, error) {
+	visible, visibleArgs := s.visible()
+	query := `
+		SELECT provider, COALESCE(NULLIF(routed_model, ''), model), response, response_encoding
+		FROM requests
+		WHERE datetime(timestamp) >= datetime(?) AND datetime(timestamp) < datetime(?)
+			AND provider IS NOT NULL AND provider != '' AND response IS NOT NULL AND ` + visible + `
+	`
+
+	rows, err := s.db.Query(query, queryArgs([]interface{}{sqliteTime(start), sqliteTime(end)}, visibleArgs)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query provider samples: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []model.ProviderSample
+	for rows.Next() {
+		var providerName, modelName, responseEncoding sql.NullString
+		var response []byte
+		if err := rows.Scan(&providerName, &modelName, &response, &responseEncoding); err != nil {
+			continue
+		}
+		resp := s.codec.decodeStoredResponse(response, responseEncoding)
+		// Requests the proxy turned away itself never reached the provider
+		if resp == nil || (resp.Origin == model.ResponseOriginSynthetic && resp.StatusCode < 500) {
+			continue
+		}
+
+		if resp.Failover != nil {
+			samples = append(samples, model.ProviderSample{
+				Provider:   resp.Failover.FromProvider,
+				Model:      resp.Failover.FromModel,
+				StatusCode: resp.Failover.StatusCode,
+				Failover:   true,
+			})
+		}
+		samples = append(samples, model.ProviderSample{
+			Provider:     providerName.String,
+			Model:        modelName.String,
+			StatusCode:   resp.StatusCode,
+			ResponseTime: resp.ResponseTime,
+			Usage:        responseUsage(resp),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read provider samples: %w", err)
+	}
+	return samples, nil
+}
+
+// SaveUsageEvents stores ingested usage events. Events are keyed by ID, so a
+// client retrying a post doesn't count its usage twice.
+func (s *sqliteStorageService) SaveUsageEvents(events []model.UsageEvent) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO usage_events (id, timestamp, source, model, requests, input_tokens, output_tokens, cache_read_tokens, cache_creation_tokens, cost_usd)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			timestamp = excluded.timestamp, source = excluded.source, model = excluded.model,
+			requests = excluded.requests, input_tokens = excluded.input_tokens, output_tokens = excluded.output_tokens,
+			cache_read_tokens = excluded.cache_read_tokens, cache_creation_tokens = excluded.cache_creation_tokens,
+			cost_usd = excluded.cost_usd
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare usage event insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, e := range events {
+		if _, err := stmt.Exec(e.ID, e.Timestamp, e.Source, e.Model, e.Requests,
+			e.InputTokens, e.OutputTokens, e.CacheReadTokens, e.CacheCreationTokens, e.CostUSD); err != nil {
+			return fmt.Errorf("failed to save usage event: %w", err)
 		}
+	}
 
-		if responseJSON.Valid {
-			var resp model.ResponseLog
-			if err := json.Unmarshal([]byte(responseJSON.String), &resp); err == nil {
-				req.Response = &resp
-			}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit usage events: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteStorageService) getUsageEvents(start, end time.Time) ([]model.UsageEvent, error) {
+	// Ingested usage belongs to no tenant
+	if s.tenant != "" {
+		return nil, nil
+	}
+	rows, err := s.db.Query(`
+		SELECT id, timestamp, source, model, requests, input_tokens, output_tokens, cache_read_tokens, cache_creation_tokens, cost_usd
+		FROM usage_events
+		WHERE datetime(timestamp) >= datetime(?) AND datetime(timestamp) < datetime(?)
+	`, sqliteTime(start), sqliteTime(end))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []model.UsageEvent
+	for rows.Next() {
+		var e model.UsageEvent
+		var modelName sql.NullString
+		if err := rows.Scan(&e.ID, &e.Timestamp, &e.Source, &modelName, &e.Requests,
+			&e.InputTokens, &e.OutputTokens, &e.CacheReadTokens, &e.CacheCreationTokens, &e.CostUSD); err != nil {
+			return nil, fmt.Errorf("failed to scan usage event: %w", err)
 		}
+		e.Model = modelName.String
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (s *sqliteStorageService) GetExperimentStats(name string) ([]model.ExperimentArmStats, error) {
+	visible, visibleArgs := s.visible()
+	query := `
+		SELECT experiment_arm, routed_model, response, response_encoding
+		FROM requests
+		WHERE experiment = ? AND ` + visible + `
+	`
 
-		requests = append(requests, &req)
+	rows, err := s.db.Query(query, queryArgs([]interface{}{name}, visibleArgs)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query experiment stats: %w", err)
 	}
+	defer rows.Close()
 
-	return requests, nil
+	byArm := make(map[string]*modelAccumulator)
+	armModels := make(map[string]string)
+	for rows.Next() {
+		var arm, routedModel, responseEncoding sql.NullString
+		var response []byte
+		if err := rows.Scan(&arm, &routedModel, &response, &responseEncoding); err != nil {
+			continue
+		}
+
+		resp := s.codec.decodeStoredResponse(response, responseEncoding)
+
+		acc, ok := byArm[arm.String]
+		if !ok {
+			acc = &modelAccumulator{}
+			byArm[arm.String] = acc
+			armModels[arm.String] = routedModel.String
+		}
+		acc.add(resp)
+	}
+
+	arms := make([]model.ExperimentArmStats, 0, len(byArm))
+	for arm, acc := range byArm {
+		usage := acc.averaged()
+		usage.Model = armModels[arm]
+
+		stats := model.ExperimentArmStats{Arm: arm, ModelUsage: usage}
+		if usage.Requests > 0 {
+			stats.ErrorRate = float64(usage.Errors) / float64(usage.Requests)
+		}
+		arms = append(arms, stats)
+	}
+	sort.Slice(arms, func(i, j int) bool {
+		return arms[i].Arm < arms[j].Arm
+	})
+
+	return arms, nil
+}
+
+// GetRoutingRules returns the rules created through the API, in evaluation order
+func (s *sqliteStorageService) GetRoutingRules() ([]model.RoutingRule, error) {
+	rows, err := s.db.Query("SELECT rule, created_at, updated_at FROM routing_rules ORDER BY position, created_at")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query routing rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []model.RoutingRule{}
+	for rows.Next() {
+		var ruleJSON string
+		var rule model.RoutingRule
+		if err := rows.Scan(&ruleJSON, &rule.CreatedAt, &rule.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan routing rule: %w", err)
+		}
+		if err := json.Unmarshal([]byte(ruleJSON), &rule); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal routing rule: %w", err)
+		}
+		rule.Source = model.RuleSourceAPI
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// SaveRoutingRule inserts the rule, or replaces it if its ID already exists
+func (s *sqliteStorageService) SaveRoutingRule(rule *model.RoutingRule) error {
+	now := time.Now().Format(time.RFC3339)
+	if rule.CreatedAt == "" {
+		rule.CreatedAt = now
+	}
+	rule.UpdatedAt = now
+
+	ruleJSON, err := json.Marshal(rule)
+	if err != nil {
+		return fmt.Errorf("failed to marshal routing rule: %w", err)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO routing_rules (id, position, rule, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET position = excluded.position, rule = excluded.rule, updated_at = excluded.updated_at
+	`, rule.ID, rule.Position, string(ruleJSON), rule.CreatedAt, rule.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save routing rule: %w", err)
+	}
+	return nil
+}
+
+// DeleteRoutingRule removes a rule, reporting whether it existed
+func (s *sqliteStorageService) DeleteRoutingRule(id string) (bool, error) {
+	result, err := s.db.Exec("DELETE FROM routing_rules WHERE id = ?", id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete routing rule: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, nil
+}
+
+// SaveConfigSnapshot stores snapshot as the next config generation and sets its
+// Generation
+func (s *sqliteStorageService) SaveConfigSnapshot(snapshot *model.ConfigSnapshot) error {
+	configJSON, err := json.Marshal(snapshot.Config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config snapshot: %w", err)
+	}
+	if snapshot.CreatedAt == "" {
+		snapshot.CreatedAt = time.Now().Format(time.RFC3339)
+	}
+
+	result, err := s.db.Exec("INSERT INTO config_snapshots (hash, config, created_at) VALUES (?, ?, ?)",
+		snapshot.Hash, string(configJSON), snapshot.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save config snapshot: %w", err)
+	}
+	if snapshot.Generation, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get config generation: %w", err)
+	}
+	return nil
+}
+
+// GetConfigSnapshots lists every config generation, newest first, without the
+// configuration itself
+func (s *sqliteStorageService) GetConfigSnapshots() ([]model.ConfigSnapshot, error) {
+	rows, err := s.db.Query("SELECT generation, hash, created_at FROM config_snapshots ORDER BY generation DESC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query config snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	snapshots := []model.ConfigSnapshot{}
+	for rows.Next() {
+		var snapshot model.ConfigSnapshot
+		if err := rows.Scan(&snapshot.Generation, &snapshot.Hash, &snapshot.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan config snapshot: %w", err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+// GetConfigSnapshot returns one config generation, the latest if generation is
+// 0, or nil if there is no such generation
+func (s *sqliteStorageService) GetConfigSnapshot(generation int64) (*model.ConfigSnapshot, error) {
+	query := "SELECT generation, hash, config, created_at FROM config_snapshots WHERE generation = ?"
+	args := []interface{}{generation}
+	if generation == 0 {
+		query = "SELECT generation, hash, config, created_at FROM config_snapshots ORDER BY generation DESC LIMIT 1"
+		args = nil
+	}
+
+	var snapshot model.ConfigSnapshot
+	var configJSON string
+	err := s.db.QueryRow(query, args...).Scan(&snapshot.Generation, &snapshot.Hash, &configJSON, &snapshot.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query config snapshot: %w", err)
+	}
+	if err := json.Unmarshal([]byte(configJSON), &snapshot.Config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+func (s *sqliteStorageService) DeleteRequestsBefore(cutoff time.Time) (int, error) {
+	return s.deleteRequests("datetime(timestamp) < datetime(?)", sqliteTime(cutoff))
+}
+
+// DeleteRequests moves the requests matching every field set in filter to the
+// trash, or deletes them when the trash is turned off
+func (s *sqliteStorageService) DeleteRequests(filter RequestFilter) (int, error) {
+	conditions, args := filter.conditions()
+	if s.config.TrashDays > 0 {
+		return s.trashRequests(conditions, args...)
+	}
+	scope, scopeArgs := s.tenantScope()
+	return s.deleteRequests(conditions+scope, queryArgs(args, scopeArgs)...)
+}
+
+// conditions is the SQL condition matching the requests filter selects
+func (filter RequestFilter) conditions() (string, []interface{}) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+	if !filter.After.IsZero() {
+		conditions = append(conditions, "datetime(timestamp) >= datetime(?)")
+		args = append(args, sqliteTime(filter.After))
+	}
+	if !filter.Before.IsZero() {
+		conditions = append(conditions, "datetime(timestamp) < datetime(?)")
+		args = append(args, sqliteTime(filter.Before))
+	}
+	if filter.Model != "" {
+		conditions = append(conditions, "LOWER(model) LIKE ?")
+		args = append(args, "%"+strings.ToLower(filter.Model)+"%")
+	}
+	if filter.StatusCode != 0 {
+		conditions = append(conditions, "status_code = ?")
+		args = append(args, filter.StatusCode)
+	}
+	if filter.ErrorType != "" {
+		conditions = append(conditions, "error_type = ?")
+		args = append(args, filter.ErrorType)
+	}
+	if filter.SessionID != "" {
+		conditions = append(conditions, "session_id = ?")
+		args = append(args, filter.SessionID)
+	}
+	if filter.Tag != "" {
+		conditions = append(conditions, "id IN (SELECT request_id FROM request_tags WHERE tag = ?)")
+		args = append(args, filter.Tag)
+	}
+	if filter.Starred {
+		conditions = append(conditions, "id IN (SELECT request_id FROM request_annotations WHERE starred = 1)")
+	}
+	if filter.Annotated {
+		conditions = append(conditions, "id IN (SELECT request_id FROM request_annotations WHERE note IS NOT NULL)")
+	}
+	if filter.Ungraded {
+		// Encoded grades can't be read here, so they're matched and GetAllRequests
+		// checks them once decoded
+		conditions = append(conditions, "(prompt_grade IS NULL OR prompt_grade_encoding IS NOT NULL OR NOT json_valid(prompt_grade) OR "+
+			"json_extract(prompt_grade, '$.isProcessing') = 1 OR COALESCE(json_extract(prompt_grade, '$.error'), '') != '')")
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// deleteRequests deletes the requests matching where along with their search
+// text, tags, body segments no other request shares, and blobs
+func (s *sqliteStorageService) deleteRequests(where string, args ...interface{}) (int, error) {
+	blobs, err := s.requestBlobs(where, args...)
+	if err != nil {
+		return 0, err
+	}
+	result, err := s.db.Exec("DELETE FROM requests WHERE "+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete requests: %w", err)
+	}
+	if _, err := s.db.Exec("DELETE FROM request_search WHERE id NOT IN (SELECT id FROM requests)"); err != nil {
+		return 0, fmt.Errorf("failed to prune search index: %w", err)
+	}
+	if err := s.pruneSegments(s.db); err != nil {
+		return 0, err
+	}
+	if err := s.pruneTags(s.db); err != nil {
+		return 0, err
+	}
+	s.removeBlobs(blobs)
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return int(rowsAffected), nil
+}
+
+// archiveBatchSize is how many requests ArchiveRequests removes per statement,
+// well under SQLite's limit on parameters
+const archiveBatchSize = 500
+
+// ArchiveRequests records that requests were archived to object and removes
+// them from the database, returning how many were removed
+func (s *sqliteStorageService) ArchiveRequests(ids []string, object string) (int, error) {
+	archivedAt := time.Now().Format(time.RFC3339)
+	archived := 0
+	for start := 0; start < len(ids); start += archiveBatchSize {
+		batch := ids[start:]
+		if len(batch) > archiveBatchSize {
+			batch = batch[:archiveBatchSize]
+		}
+		in := "id IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", ") + ")"
+		args := make([]interface{}, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+
+		blobs, err := s.requestBlobs(in, args...)
+		if err != nil {
+			return archived, err
+		}
+		tx, err := s.db.Begin()
+		if err != nil {
+			return archived, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		_, err = tx.Exec("INSERT OR REPLACE INTO archived_requests (id, timestamp, object, archived_at) SELECT id, timestamp, ?, ? FROM requests WHERE "+in,
+			append([]interface{}{object, archivedAt}, args...)...)
+		if err != nil {
+			tx.Rollback()
+			return archived, fmt.Errorf("failed to record archived requests: %w", err)
+		}
+		result, err := tx.Exec("DELETE FROM requests WHERE "+in, args...)
+		if err != nil {
+			tx.Rollback()
+			return archived, fmt.Errorf("failed to delete archived requests: %w", err)
+		}
+		if _, err := tx.Exec("DELETE FROM request_search WHERE "+in, args...); err != nil {
+			tx.Rollback()
+			return archived, fmt.Errorf("failed to prune search index: %w", err)
+		}
+		if err := s.pruneSegments(tx); err != nil {
+			tx.Rollback()
+			return archived, err
+		}
+		if err := s.pruneTags(tx); err != nil {
+			tx.Rollback()
+			return archived, err
+		}
+		if err := tx.Commit(); err != nil {
+			return archived, fmt.Errorf("failed to commit archived requests: %w", err)
+		}
+		s.removeBlobs(blobs)
+
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return archived, fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		archived += int(deleted)
+	}
+	return archived, nil
+}
+
+// AddRequestTags attaches normalized tags to a stored request, keeping the
+// ones it already has, and returns false if there's no such request
+func (s *sqliteStorageService) AddRequestTags(id string, tags []string) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	visible, visibleArgs := s.visible()
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM requests WHERE id = ? AND "+visible+")", queryArgs([]interface{}{id}, visibleArgs)...).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to query request: %w", err)
+	}
+	if !exists {
+		return false, nil
+	}
+	createdAt := time.Now().Format(time.RFC3339)
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO request_tags (request_id, tag, created_at) VALUES (?, ?, ?)", id, tag, createdAt); err != nil {
+			return false, fmt.Errorf("failed to tag request: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit tags: %w", err)
+	}
+	return true, nil
+}
+
+// RemoveRequestTag detaches a tag from a request, returning false if the
+// request didn't carry it
+func (s *sqliteStorageService) RemoveRequestTag(id, tag string) (bool, error) {
+	visible, visibleArgs := s.visible()
+	result, err := s.db.Exec("DELETE FROM request_tags WHERE request_id = ? AND tag = ? AND request_id IN (SELECT id FROM requests WHERE "+visible+")",
+		queryArgs([]interface{}{id, tag}, visibleArgs)...)
+	if err != nil {
+		return false, fmt.Errorf("failed to untag request: %w", err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return removed > 0, nil
+}
+
+// GetTags lists the tags in use, most used first
+func (s *sqliteStorageService) GetTags() ([]model.TagCount, error) {
+	visible, visibleArgs := s.visible()
+	rows, err := s.db.Query(`
+		SELECT tag, COUNT(*) FROM request_tags
+		WHERE request_id IN (SELECT id FROM requests WHERE `+visible+`)
+		GROUP BY tag ORDER BY COUNT(*) DESC, tag
+	`, visibleArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := []model.TagCount{}
+	for rows.Next() {
+		var tag model.TagCount
+		if err := rows.Scan(&tag.Tag, &tag.Requests); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// StarRequest stars or unstars a stored request, returning false if there's
+// no such request
+func (s *sqliteStorageService) StarRequest(id string, starred bool) (bool, error) {
+	return s.annotate(id, "starred", starred)
+}
+
+// SetRequestNote attaches a free-text note to a stored request, replacing the
+// one it had; an empty note removes it. It returns false if there's no such
+// request.
+func (s *sqliteStorageService) SetRequestNote(id, note string) (bool, error) {
+	var value interface{}
+	if note != "" {
+		value = note
+	}
+	return s.annotate(id, "note", value)
+}
+
+// annotate sets a column of a visible request's annotation, dropping the
+// annotation once it's neither starred nor noted
+func (s *sqliteStorageService) annotate(id, column string, value interface{}) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	visible, visibleArgs := s.visible()
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM requests WHERE id = ? AND "+visible+")", queryArgs([]interface{}{id}, visibleArgs)...).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to query request: %w", err)
+	}
+	if !exists {
+		return false, nil
+	}
+	_, err = tx.Exec("INSERT INTO request_annotations (request_id, "+column+", updated_at) VALUES (?, ?, ?) "+
+		"ON CONFLICT (request_id) DO UPDATE SET "+column+" = excluded."+column+", updated_at = excluded.updated_at",
+		id, value, time.Now().Format(time.RFC3339))
+	if err != nil {
+		return false, fmt.Errorf("failed to annotate request: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM request_annotations WHERE request_id = ? AND starred = 0 AND note IS NULL", id); err != nil {
+		return false, fmt.Errorf("failed to annotate request: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit annotation: %w", err)
+	}
+	return true, nil
+}
+
+// SaveConversationReport stores a conversation's report, replacing the one
+// it had
+func (s *sqliteStorageService) SaveConversationReport(report *model.ConversationReport) error {
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal conversation report: %w", err)
+	}
+	_, err = s.db.Exec("INSERT INTO conversation_reports (session_id, report, created_at) VALUES (?, ?, ?) "+
+		"ON CONFLICT (session_id) DO UPDATE SET report = excluded.report, created_at = excluded.created_at",
+		report.SessionID, string(encoded), report.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save conversation report: %w", err)
+	}
+	return nil
+}
+
+// GetConversationReport returns the stored report of a conversation with
+// visible requests, or nil if it has none
+func (s *sqliteStorageService) GetConversationReport(sessionID string) (*model.ConversationReport, error) {
+	var encoded string
+	visible, visibleArgs := s.visible()
+	err := s.db.QueryRow("SELECT report FROM conversation_reports WHERE session_id = ? AND "+
+		"EXISTS (SELECT 1 FROM requests WHERE session_id = conversation_reports.session_id AND "+visible+")",
+		queryArgs([]interface{}{sessionID}, visibleArgs)...).Scan(&encoded)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversation report: %w", err)
+	}
+	var report model.ConversationReport
+	if err := json.Unmarshal([]byte(encoded), &report); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal conversation report: %w", err)
+	}
+	return &report, nil
+}
+
+// pruneTags deletes the tags and annotations of requests that are no longer
+// stored, and the reports of conversations none of whose requests are
+func (s *sqliteStorageService) pruneTags(db execer) error {
+	if _, err := db.Exec("DELETE FROM request_tags WHERE request_id NOT IN (SELECT id FROM requests)"); err != nil {
+		return fmt.Errorf("failed to prune tags: %w", err)
+	}
+	if _, err := db.Exec("DELETE FROM request_annotations WHERE request_id NOT IN (SELECT id FROM requests)"); err != nil {
+		return fmt.Errorf("failed to prune annotations: %w", err)
+	}
+	if _, err := db.Exec("DELETE FROM conversation_reports WHERE session_id NOT IN (SELECT session_id FROM requests WHERE session_id IS NOT NULL)"); err != nil {
+		return fmt.Errorf("failed to prune conversation reports: %w", err)
+	}
+	return nil
+}
+
+// GetArchivedRequest returns where a request was archived, or nil if it
+// wasn't
+func (s *sqliteStorageService) GetArchivedRequest(id string) (*model.ArchivedRequest, error) {
+	// The archive doesn't record tenants, so their views don't include it
+	if s.tenant != "" {
+		return nil, nil
+	}
+	var archived model.ArchivedRequest
+	err := s.db.QueryRow("SELECT id, timestamp, object, archived_at FROM archived_requests WHERE id = ?", id).
+		Scan(&archived.RequestID, &archived.Timestamp, &archived.Object, &archived.ArchivedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query archived request: %w", err)
+	}
+	return &archived, nil
+}
+
+// storedBlob is a payload column of a request whose value is in a blob
+type storedBlob struct {
+	value    []byte
+	encoding sql.NullString
+}
+
+// requestBlobs finds the blobs of the requests matching where, to remove once
+// the requests are deleted
+func (s *sqliteStorageService) requestBlobs(where string, args ...interface{}) ([]storedBlob, error) {
+	if s.codec.blobs == nil {
+		return nil, nil
+	}
+	rows, err := s.db.Query(`
+		SELECT body, body_encoding, response, response_encoding, prompt_grade, prompt_grade_encoding, shadow, shadow_encoding FROM requests
+		WHERE (body_encoding LIKE '%`+payloadEncodingBlob+`' OR response_encoding LIKE '%`+payloadEncodingBlob+`'
+			OR prompt_grade_encoding LIKE '%`+payloadEncodingBlob+`' OR shadow_encoding LIKE '%`+payloadEncodingBlob+`') AND `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query blobs: %w", err)
+	}
+	defer rows.Close()
+
+	var blobs []storedBlob
+	for rows.Next() {
+		var body, response, grade, shadow storedBlob
+		if err := rows.Scan(&body.value, &body.encoding, &response.value, &response.encoding,
+			&grade.value, &grade.encoding, &shadow.value, &shadow.encoding); err != nil {
+			return nil, fmt.Errorf("failed to scan blobs: %w", err)
+		}
+		blobs = append(blobs, body, response, grade, shadow)
+	}
+	return blobs, rows.Err()
+}
+
+// removeBlobs deletes the blobs of deleted requests; one that can't be deleted
+// is only logged, since its request is already gone
+func (s *sqliteStorageService) removeBlobs(blobs []storedBlob) {
+	for _, blob := range blobs {
+		if err := s.codec.removeBlob(blob.value, blob.encoding); err != nil {
+			log.Printf("⚠️ Failed to remove blob of a deleted request: %v", err)
+		}
+	}
+}
+
+func (s *sqliteStorageService) Backup(destPath string) error {
+	// VACUUM INTO writes a consistent, compacted copy without blocking writers for long
+	if _, err := s.db.Exec("VACUUM INTO ?", destPath); err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	return nil
+}
+
+// GetSchema lists the tables in the database and their columns
+func (s *sqliteStorageService) GetSchema() ([]model.SchemaTable, error) {
+	rows, err := s.db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+
+	tables := make([]model.SchemaTable, 0, len(names))
+	for _, name := range names {
+		columns, err := s.tableColumns(name)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, model.SchemaTable{Name: name, Columns: columns})
+	}
+	return tables, nil
+}
+
+func (s *sqliteStorageService) tableColumns(table string) ([]model.SchemaColumn, error) {
+	rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var columns []model.SchemaColumn
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, fmt.Errorf("failed to inspect table %s: %w", table, err)
+		}
+		columns = append(columns, model.SchemaColumn{Name: name, Type: colType})
+	}
+	return columns, rows.Err()
 }
 
 func (s *sqliteStorageService) Close() error {
 	return s.db.Close()
 }
+
+// sqliteTime formats t the way SQLite's datetime() normalizes timestamps (UTC)
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
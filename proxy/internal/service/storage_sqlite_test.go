@@ -0,0 +1,1842 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestSQLiteStorage_GetStatsBandwidth(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	requests := []struct {
+		id, model, provider            string
+		requestBytes, requestWireBytes int64
+		bodyBytes, wireBytes           int64
+	}{
+		{"a", "claude-sonnet-4", "anthropic", 1000, 400, 5000, 1200},
+		{"b", "claude-sonnet-4", "anthropic", 2000, 2000, 3000, 900},
+		{"c", "gpt-4o", "openai", 500, 500, 700, 700},
+	}
+	now := time.Now()
+	for _, r := range requests {
+		log := &model.RequestLog{
+			RequestID:        r.id,
+			Timestamp:        now.Format(time.RFC3339),
+			Method:           "POST",
+			Endpoint:         "/v1/messages",
+			Body:             map[string]string{"model": r.model},
+			Model:            r.model,
+			Provider:         r.provider,
+			RequestBytes:     r.requestBytes,
+			RequestWireBytes: r.requestWireBytes,
+		}
+		if _, err := storage.SaveRequest(log); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		log.Response = &model.ResponseLog{StatusCode: 200, BodyBytes: r.bodyBytes, WireBytes: r.wireBytes}
+		if err := storage.UpdateRequestWithResponse(log); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+	}
+
+	stats, err := storage.GetStats(now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetStats() returned error: %v", err)
+	}
+
+	want := model.Bandwidth{RequestBytes: 3500, RequestWireBytes: 2900, ResponseBytes: 8700, ResponseWireBytes: 2800}
+	if stats.Bandwidth != want {
+		t.Errorf("Bandwidth = %+v, want %+v", stats.Bandwidth, want)
+	}
+
+	if len(stats.Providers) != 2 {
+		t.Fatalf("expected 2 providers, got %+v", stats.Providers)
+	}
+	anthropic := stats.Providers[0]
+	if anthropic.Provider != "anthropic" || anthropic.Requests != 2 || anthropic.ResponseWireBytes != 2100 {
+		t.Errorf("unexpected anthropic usage %+v", anthropic)
+	}
+
+	if len(stats.Models) != 2 || stats.Models[0].Model != "claude-sonnet-4" || stats.Models[0].RequestWireBytes != 2400 {
+		t.Errorf("unexpected model usage %+v", stats.Models)
+	}
+
+	saved, _, err := storage.GetRequestByShortID("a")
+	if err != nil {
+		t.Fatalf("GetRequestByShortID() returned error: %v", err)
+	}
+	if saved.Provider != "anthropic" || saved.RequestWireBytes != 400 || saved.Response.WireBytes != 1200 {
+		t.Errorf("sizes not stored on the request: %+v", saved)
+	}
+}
+
+func TestSQLiteStorage_GetStatsStreamTimings(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	responses := []struct {
+		id       string
+		response *model.ResponseLog
+	}{
+		{"fast", &model.ResponseLog{StatusCode: 200, IsStreaming: true, TimeToFirstToken: 400, StreamDuration: 2000, ChunkCount: 40, TokensPerSecond: 80}},
+		{"slow", &model.ResponseLog{StatusCode: 200, IsStreaming: true, TimeToFirstToken: 1200, StreamDuration: 6000, ChunkCount: 90, TokensPerSecond: 40}},
+		// Neither a whole response nor a stream that never produced a token count toward the averages
+		{"whole", &model.ResponseLog{StatusCode: 200, ResponseTime: 3000}},
+		{"empty", &model.ResponseLog{StatusCode: 200, IsStreaming: true, StreamDuration: 10, ChunkCount: 2}},
+	}
+	now := time.Now()
+	for _, r := range responses {
+		request := testRequestLog(r.id)
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		request.Response = r.response
+		if err := storage.UpdateRequestWithResponse(request); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+	}
+
+	stats, err := storage.GetStats(now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetStats() returned error: %v", err)
+	}
+	if stats.AvgTimeToFirstToken != 800 || stats.AvgTokensPerSecond != 60 {
+		t.Errorf("averages = %d ms to first token, %v tokens/s, want 800 and 60", stats.AvgTimeToFirstToken, stats.AvgTokensPerSecond)
+	}
+	if len(stats.Models) != 1 || stats.Models[0].AvgTimeToFirstToken != 800 {
+		t.Errorf("model usage = %+v, want the same averages", stats.Models)
+	}
+
+	var chunks, streamMS sql.NullInt64
+	db := storage.(*sqliteStorageService).db
+	if err := db.QueryRow("SELECT stream_chunks, stream_ms FROM requests WHERE id = 'slow'").Scan(&chunks, &streamMS); err != nil {
+		t.Fatalf("failed to read stored row: %v", err)
+	}
+	if chunks.Int64 != 90 || streamMS.Int64 != 6000 {
+		t.Errorf("stored stream = %v chunks over %v ms, want 90 over 6000", chunks, streamMS)
+	}
+}
+
+func TestSQLiteStorage_GetStatsIngestedUsage(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	now := time.Now()
+	log := &model.RequestLog{
+		RequestID: "proxied",
+		Timestamp: now.Format(time.RFC3339),
+		Method:    "POST",
+		Endpoint:  "/v1/messages",
+		Body:      map[string]string{"model": "claude-sonnet-4"},
+		Model:     "claude-sonnet-4",
+	}
+	if _, err := storage.SaveRequest(log); err != nil {
+		t.Fatalf("SaveRequest() returned error: %v", err)
+	}
+
+	events := []model.UsageEvent{
+		{ID: "laptop-1", Timestamp: now.UTC().Format(time.RFC3339), Source: "laptop", Model: "claude-sonnet-4", Requests: 3, InputTokens: 100, OutputTokens: 10},
+		{ID: "workbench-1", Timestamp: now.UTC().Format(time.RFC3339), Source: "workbench", Model: "claude-opus-4", Requests: 1, InputTokens: 50, CostUSD: 0.25},
+		{ID: "old", Timestamp: now.Add(-48 * time.Hour).UTC().Format(time.RFC3339), Source: "laptop", Model: "claude-sonnet-4", Requests: 1, InputTokens: 1},
+	}
+	if err := storage.SaveUsageEvents(events); err != nil {
+		t.Fatalf("SaveUsageEvents() returned error: %v", err)
+	}
+	// A retried post replaces the event rather than counting it twice
+	if err := storage.SaveUsageEvents(events[:1]); err != nil {
+		t.Fatalf("SaveUsageEvents() returned error: %v", err)
+	}
+
+	stats, err := storage.GetStats(now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetStats() returned error: %v", err)
+	}
+
+	if stats.Requests != 5 || stats.InputTokens != 150 {
+		t.Errorf("totals = %d requests, %d input tokens, want 5 and 150", stats.Requests, stats.InputTokens)
+	}
+	if len(stats.Models) != 2 || stats.Models[0].Model != "claude-sonnet-4" || stats.Models[0].Requests != 4 {
+		t.Errorf("unexpected model usage %+v", stats.Models)
+	}
+
+	var sources []string
+	for _, s := range stats.Sources {
+		sources = append(sources, s.Source)
+	}
+	if strings.Join(sources, ",") != "proxy,laptop,workbench" {
+		t.Fatalf("sources = %v, want proxy first, then ingested sources by name", sources)
+	}
+	if stats.Sources[0].Requests != 1 || stats.Sources[1].Requests != 3 || stats.Sources[2].CostUSD != 0.25 {
+		t.Errorf("unexpected source usage %+v", stats.Sources)
+	}
+}
+
+func TestSQLiteStorage_GetSchema(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	tables, err := storage.GetSchema()
+	if err != nil {
+		t.Fatalf("GetSchema() returned error: %v", err)
+	}
+	columns := make(map[string]bool)
+	for _, table := range tables {
+		columns[table.Name] = true
+		for _, column := range table.Columns {
+			columns[table.Name+"."+column.Name] = true
+		}
+	}
+	// Everything the changelog says was added must exist in a new database
+	for _, change := range SchemaChangelog() {
+		for _, added := range change.Added {
+			if !columns[added] {
+				t.Errorf("schema version %d added %s, which the database doesn't have", change.Version, added)
+			}
+		}
+	}
+	if last := schemaChangelog[len(schemaChangelog)-1].Version; last != SchemaVersion {
+		t.Errorf("last changelog entry is version %d, want SchemaVersion %d", last, SchemaVersion)
+	}
+
+	var version int
+	if err := storage.(*sqliteStorageService).db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatalf("failed to read user_version: %v", err)
+	}
+	if version != SchemaVersion {
+		t.Errorf("user_version = %d, want %d", version, SchemaVersion)
+	}
+}
+
+func TestSQLiteStorage_GetProviderSamples(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	now := time.Now()
+	requests := []*model.RequestLog{
+		{RequestID: "served", Model: "claude-opus-4", RoutedModel: "claude-sonnet-4", Provider: "anthropic",
+			Response: &model.ResponseLog{StatusCode: 200, ResponseTime: 800, Body: []byte(`{"usage":{"input_tokens":10,"output_tokens":5}}`)}},
+		{RequestID: "failed-over", Model: "claude-opus-4", RoutedModel: "gpt-4o", Provider: "openai",
+			Response: &model.ResponseLog{StatusCode: 200, ResponseTime: 1500, Failover: &model.Failover{FromModel: "claude-opus-4", FromProvider: "anthropic", StatusCode: 529}}},
+		{RequestID: "in-flight", Model: "claude-opus-4", Provider: "anthropic"},
+	}
+	for _, request := range requests {
+		request.Timestamp = now.Format(time.RFC3339)
+		request.Method = "POST"
+		request.Endpoint = "/v1/messages"
+		request.Body = map[string]string{"model": request.Model}
+		response := request.Response
+		request.Response = nil
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		if response != nil {
+			request.Response = response
+			if err := storage.UpdateRequestWithResponse(request); err != nil {
+				t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+			}
+		}
+	}
+
+	samples, err := storage.GetProviderSamples(now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetProviderSamples() returned error: %v", err)
+	}
+	if len(samples) != 3 {
+		t.Fatalf("expected 3 samples (the in-flight request has none), got %+v", samples)
+	}
+	counts := make(map[string]int)
+	for _, sample := range samples {
+		switch {
+		case sample.Failover:
+			if sample.Provider != "anthropic" || sample.StatusCode != 529 {
+				t.Errorf("unexpected failover sample %+v", sample)
+			}
+		case sample.Provider == "anthropic":
+			if sample.Model != "claude-sonnet-4" || sample.Usage == nil || sample.Usage.OutputTokens != 5 {
+				t.Errorf("expected the routed model and usage, got %+v", sample)
+			}
+		}
+		counts[sample.Provider]++
+	}
+	if counts["anthropic"] != 2 || counts["openai"] != 1 {
+		t.Errorf("samples per provider = %v", counts)
+	}
+}
+
+func TestSQLiteStorage_SearchRequests(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "requests.db")
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: dbPath})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	requests := []struct {
+		id, timestamp, prompt, answer string
+	}{
+		{"auth", "2025-03-01T10:00:00Z", "Rewrite the auth middleware to check tokens", "I rewrote the middleware."},
+		{"docs", "2025-03-02T10:00:00Z", "Add a docstring to the router", "Added docs for the auth router."},
+		{"odd", "2025-03-03T10:00:00Z", "What does 100% coverage_mode mean?", "It means every line ran."},
+	}
+	for _, r := range requests {
+		log := &model.RequestLog{
+			RequestID: r.id,
+			Timestamp: r.timestamp,
+			Method:    "POST",
+			Endpoint:  "/v1/messages",
+			Body: map[string]interface{}{
+				"model":    "claude-sonnet-4",
+				"system":   []map[string]string{{"type": "text", "text": "You are Claude Code, an agent for auth work"}},
+				"messages": []map[string]string{{"role": "user", "content": r.prompt}},
+			},
+			Model: "claude-sonnet-4",
+		}
+		if _, err := storage.SaveRequest(log); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		log.Response = &model.ResponseLog{StatusCode: 200, Body: []byte(fmt.Sprintf(`{"type":"message","content":[{"type":"text","text":%q}]}`, r.answer))}
+		if err := storage.UpdateRequestWithResponse(log); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+	}
+
+	search := func(t *testing.T, storage StorageService, query string) []string {
+		t.Helper()
+		found, total, err := storage.SearchRequests(query, 1, 10)
+		if err != nil {
+			t.Fatalf("SearchRequests(%q) returned error: %v", query, err)
+		}
+		ids := []string{}
+		for _, request := range found {
+			ids = append(ids, request.RequestID)
+		}
+		if total != len(ids) {
+			t.Errorf("SearchRequests(%q) total = %d, want %d", query, total, len(ids))
+		}
+		return ids
+	}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"auth", []string{"docs", "auth"}},
+		{"auth middleware", []string{"auth"}},
+		{"AUTH router", []string{"docs"}},
+		{`"auth middleware"`, []string{"auth"}},
+		{`"middleware auth"`, []string{}},
+		{"100%", []string{"odd"}},
+		{"coverage_mode", []string{"odd"}},
+		{"agent", []string{}},
+		{"   ", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := search(t, storage, tt.query); strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("SearchRequests(%q) = %v, want %v", tt.query, got, tt.expected)
+			}
+		})
+	}
+
+	// Databases from before the index get it filled in when opened
+	if _, err := storage.(*sqliteStorageService).db.Exec("DROP TABLE request_search; PRAGMA user_version = 9"); err != nil {
+		t.Fatalf("failed to drop search index: %v", err)
+	}
+	reopened, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: dbPath})
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	if got := search(t, reopened, "rewrote"); strings.Join(got, ",") != "auth" {
+		t.Errorf("after backfill SearchRequests(rewrote) = %v, want [auth]", got)
+	}
+
+	if _, err := reopened.DeleteRequestsBefore(time.Date(2025, 3, 2, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("DeleteRequestsBefore() returned error: %v", err)
+	}
+	var indexed int
+	if err := reopened.(*sqliteStorageService).db.QueryRow("SELECT COUNT(*) FROM request_search").Scan(&indexed); err != nil {
+		t.Fatalf("failed to count indexed requests: %v", err)
+	}
+	if indexed != 1 {
+		t.Errorf("%d requests indexed after deleting old ones, want 1", indexed)
+	}
+}
+
+func TestSQLiteStorage_BackfillResponseColumns(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "requests.db")
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: dbPath})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	// Rows as stored before the response columns, with only the response JSON
+	now := time.Now().UTC()
+	legacy := []struct{ id, model, response string }{
+		{"ok", "claude-sonnet-4", `{"statusCode":200,"headers":{},"responseTime":300,"bodyBytes":50,"body":{"usage":{"input_tokens":100,"output_tokens":20,"cache_read_input_tokens":5}}}`},
+		{"overloaded", "claude-sonnet-4", `{"statusCode":529,"headers":{},"responseTime":100,"body":{"type":"error"}}`},
+		{"denied", "claude-opus-4", `{"statusCode":403,"responseTime":1}`},
+		{"corrupt", "claude-opus-4", `{not json`},
+	}
+	db := storage.(*sqliteStorageService).db
+	for _, row := range legacy {
+		_, err := db.Exec("INSERT INTO requests (id, timestamp, method, endpoint, headers, body, model, response) VALUES (?, ?, 'POST', '/v1/messages', '{}', '{}', ?, ?)",
+			row.id, now.Format(time.RFC3339), row.model, row.response)
+		if err != nil {
+			t.Fatalf("failed to insert legacy row: %v", err)
+		}
+	}
+
+	if _, err := db.Exec("PRAGMA user_version = 10"); err != nil {
+		t.Fatalf("failed to reset schema version: %v", err)
+	}
+
+	reopened, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: dbPath})
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	var missing int
+	if err := db.QueryRow("SELECT COUNT(*) FROM requests WHERE status_code IS NULL").Scan(&missing); err != nil {
+		t.Fatalf("failed to count rows: %v", err)
+	}
+	if missing != 0 {
+		t.Errorf("%d rows weren't backfilled", missing)
+	}
+
+	stats, err := reopened.GetStats(now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetStats() returned error: %v", err)
+	}
+	if stats.Requests != 4 || stats.Errors != 2 || stats.Synthetic != 1 {
+		t.Errorf("counts = %d requests, %d errors, %d synthetic, want 4, 2 and 1", stats.Requests, stats.Errors, stats.Synthetic)
+	}
+	if stats.InputTokens != 100 || stats.OutputTokens != 20 || stats.CacheReadTokens != 5 {
+		t.Errorf("tokens = %d in, %d out, %d cache read, want 100, 20 and 5", stats.InputTokens, stats.OutputTokens, stats.CacheReadTokens)
+	}
+	// The corrupt response has no time, and the denied one was made up by the proxy
+	if stats.AvgResponseTime != 200 || stats.Bandwidth.ResponseBytes != 50 {
+		t.Errorf("AvgResponseTime = %d, ResponseBytes = %d, want 200 and 50", stats.AvgResponseTime, stats.Bandwidth.ResponseBytes)
+	}
+	if len(stats.Models) != 2 || stats.Models[0].Model != "claude-opus-4" || stats.Models[0].Synthetic != 1 {
+		t.Errorf("unexpected model usage %+v", stats.Models)
+	}
+}
+
+func TestSQLiteStorage_ExportRequests(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	defer func(size int) { exportBatchSize = size }(exportBatchSize)
+	exportBatchSize = 2
+
+	// Requests sharing a timestamp must neither repeat nor go missing across batches
+	requests := []struct{ id, timestamp, model string }{
+		{"e", "2025-03-01T12:00:00Z", "claude-sonnet-4"},
+		{"a", "2025-03-01T10:00:00Z", "claude-sonnet-4"},
+		{"c", "2025-03-01T11:00:00Z", "claude-3-5-haiku"},
+		{"b", "2025-03-01T11:00:00Z", "claude-sonnet-4"},
+		{"d", "2025-03-01T11:00:00Z", "claude-sonnet-4"},
+		{"f", "2025-03-02T10:00:00Z", "claude-sonnet-4"},
+	}
+	for _, r := range requests {
+		log := &model.RequestLog{RequestID: r.id, Timestamp: r.timestamp, Method: "POST", Endpoint: "/v1/messages", Body: map[string]string{}, Model: r.model}
+		if _, err := storage.SaveRequest(log); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+	}
+
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		modelFilter string
+		expected    string
+	}{
+		{"All models", "", "a,b,c,d,e"},
+		{"Model filter", "Sonnet", "a,b,d,e"},
+		{"No matches", "gpt", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []string
+			err := storage.ExportRequests(start, end, tt.modelFilter, func(request *model.RequestLog) error {
+				ids = append(ids, request.RequestID)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ExportRequests() returned error: %v", err)
+			}
+			if got := strings.Join(ids, ","); got != tt.expected {
+				t.Errorf("exported %s, want %s", got, tt.expected)
+			}
+		})
+	}
+
+	stop := fmt.Errorf("client went away")
+	calls := 0
+	err = storage.ExportRequests(start, end, "", func(*model.RequestLog) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("ExportRequests() = %v after %d calls, want it to stop at the first error", err, calls)
+	}
+}
+
+func TestSQLiteStorage_BlobPayloads(t *testing.T) {
+	blobDir := filepath.Join(t.TempDir(), "blobs")
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{
+		DBPath:           filepath.Join(t.TempDir(), "requests.db"),
+		CompressMinBytes: 1024,
+		BlobMinBytes:     4096,
+		BlobDir:          blobDir,
+	})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		id               string
+		content          string
+		expectedEncoding string
+	}{
+		{"Oversized body", "oversized", strings.Repeat("A 5MB request pasted a whole log file. ", 500), "gzip+blob"},
+		{"Compressed body", "compressed", strings.Repeat("x", 2000), "gzip"},
+		{"Small body", "small", "hello", ""},
+	}
+
+	now := time.Now()
+	db := storage.(*sqliteStorageService).db
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := &model.RequestLog{
+				RequestID: tt.id,
+				Timestamp: now.Format(time.RFC3339),
+				Method:    "POST",
+				Endpoint:  "/v1/messages",
+				Body:      map[string]interface{}{"messages": []map[string]string{{"role": "user", "content": tt.content}}},
+				Model:     "claude-sonnet-4",
+			}
+			if _, err := storage.SaveRequest(request); err != nil {
+				t.Fatalf("SaveRequest() returned error: %v", err)
+			}
+			responseBody := fmt.Sprintf(`{"content":[{"type":"text","text":%q}]}`, tt.content)
+			request.Response = &model.ResponseLog{StatusCode: 200, Body: []byte(responseBody)}
+			if err := storage.UpdateRequestWithResponse(request); err != nil {
+				t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+			}
+
+			var bodyEncoding, responseEncoding, storedBody string
+			err := db.QueryRow("SELECT COALESCE(body_encoding, ''), COALESCE(response_encoding, ''), CAST(body AS TEXT) FROM requests WHERE id = ?", tt.id).
+				Scan(&bodyEncoding, &responseEncoding, &storedBody)
+			if err != nil {
+				t.Fatalf("failed to read stored row: %v", err)
+			}
+			if bodyEncoding != tt.expectedEncoding || responseEncoding != tt.expectedEncoding {
+				t.Errorf("encodings = %q and %q, want %q", bodyEncoding, responseEncoding, tt.expectedEncoding)
+			}
+			if tt.expectedEncoding == "gzip+blob" {
+				if len(storedBody) > 2*blobPreviewBytes || !strings.Contains(storedBody, "A 5MB request") {
+					t.Errorf("stored body = %.80q..., want a reference with a preview", storedBody)
+				}
+			}
+
+			stored, _, err := storage.GetRequestByShortID(tt.id)
+			if err != nil || stored == nil {
+				t.Fatalf("GetRequestByShortID() = %v, %v", stored, err)
+			}
+			messages := stored.Body.(map[string]interface{})["messages"].([]interface{})
+			if content := messages[0].(map[string]interface{})["content"]; content != tt.content {
+				t.Errorf("body content = %.40q..., want it unchanged", content)
+			}
+			if stored.Response == nil || string(stored.Response.Body) != responseBody {
+				t.Errorf("response wasn't read back unchanged")
+			}
+		})
+	}
+
+	countBlobs := func() int {
+		files, err := filepath.Glob(filepath.Join(blobDir, "*", "*"))
+		if err != nil {
+			t.Fatalf("failed to list blobs: %v", err)
+		}
+		return len(files)
+	}
+	if got := countBlobs(); got != 2 {
+		t.Fatalf("blob files = %d, want the body and response of the oversized request", got)
+	}
+	if deleted, err := storage.DeleteRequestsBefore(now.Add(time.Hour)); err != nil || deleted != 3 {
+		t.Fatalf("DeleteRequestsBefore() = %d, %v, want 3", deleted, err)
+	}
+	if got := countBlobs(); got != 0 {
+		t.Errorf("blob files = %d after deleting their requests, want 0", got)
+	}
+}
+
+func TestSQLiteStorage_CompressedPayloads(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db"), CompressMinBytes: 1024})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	longContext := strings.Repeat("The proxy logs every request it forwards. ", 200)
+	tests := []struct {
+		name             string
+		id               string
+		content          string
+		expectedEncoding string
+	}{
+		{"Large body", "large", longContext + "needle", payloadEncodingGzip},
+		{"Small body", "small", "hello needle", ""},
+	}
+
+	now := time.Now()
+	db := storage.(*sqliteStorageService).db
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := &model.RequestLog{
+				RequestID: tt.id,
+				Timestamp: now.Format(time.RFC3339),
+				Method:    "POST",
+				Endpoint:  "/v1/messages",
+				Body:      map[string]interface{}{"messages": []map[string]string{{"role": "user", "content": tt.content}}},
+				Model:     "claude-sonnet-4",
+			}
+			if _, err := storage.SaveRequest(request); err != nil {
+				t.Fatalf("SaveRequest() returned error: %v", err)
+			}
+			responseBody := fmt.Sprintf(`{"content":[{"type":"text","text":%q}],"usage":{"input_tokens":100,"output_tokens":20}}`, tt.content)
+			request.Response = &model.ResponseLog{StatusCode: 200, Body: []byte(responseBody)}
+			if err := storage.UpdateRequestWithResponse(request); err != nil {
+				t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+			}
+
+			var bodyEncoding, responseEncoding, bodyType string
+			err := db.QueryRow("SELECT COALESCE(body_encoding, ''), COALESCE(response_encoding, ''), typeof(body) FROM requests WHERE id = ?", tt.id).
+				Scan(&bodyEncoding, &responseEncoding, &bodyType)
+			if err != nil {
+				t.Fatalf("failed to read stored row: %v", err)
+			}
+			if bodyEncoding != tt.expectedEncoding || responseEncoding != tt.expectedEncoding {
+				t.Errorf("encodings = %q and %q, want %q", bodyEncoding, responseEncoding, tt.expectedEncoding)
+			}
+			if tt.expectedEncoding != "" && bodyType != "blob" {
+				t.Errorf("compressed body stored as %s", bodyType)
+			}
+
+			stored, _, err := storage.GetRequestByShortID(tt.id)
+			if err != nil || stored == nil {
+				t.Fatalf("GetRequestByShortID() = %v, %v", stored, err)
+			}
+			messages := stored.Body.(map[string]interface{})["messages"].([]interface{})
+			if content := messages[0].(map[string]interface{})["content"]; content != tt.content {
+				t.Errorf("body content = %.40q..., want it unchanged", content)
+			}
+			if stored.Response == nil || string(stored.Response.Body) != responseBody {
+				t.Errorf("response wasn't read back unchanged")
+			}
+		})
+	}
+
+	results, total, err := storage.SearchRequests("needle", 1, 10)
+	if err != nil || total != 2 || len(results) != 2 {
+		t.Errorf("SearchRequests() = %d of %d results, %v, want both requests", len(results), total, err)
+	}
+	stats, err := storage.GetStats(now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetStats() returned error: %v", err)
+	}
+	if stats.InputTokens != 200 || stats.OutputTokens != 40 {
+		t.Errorf("tokens = %d in, %d out, want 200 and 40", stats.InputTokens, stats.OutputTokens)
+	}
+}
+
+func TestSQLiteStorage_EncryptedPayloads(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "requests.db")
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: dbPath, EncryptionKey: testEncryptionKey})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	request := &model.RequestLog{
+		RequestID: "secret",
+		Timestamp: time.Now().Format(time.RFC3339),
+		Method:    "POST",
+		Endpoint:  "/v1/messages",
+		Body:      map[string]interface{}{"messages": []map[string]string{{"role": "user", "content": "API_TOKEN=hunter2"}}},
+		Model:     "claude-sonnet-4",
+	}
+	if _, err := storage.SaveRequest(request); err != nil {
+		t.Fatalf("SaveRequest() returned error: %v", err)
+	}
+	request.Response = &model.ResponseLog{StatusCode: 200, Body: []byte(`{"content":[{"type":"text","text":"hunter2 is set"}]}`)}
+	if err := storage.UpdateRequestWithResponse(request); err != nil {
+		t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+	}
+	grade := &model.PromptGrade{Score: 2, MaxScore: 5, Feedback: "Don't paste hunter2 into prompts"}
+	if err := storage.UpdateRequestWithGrading("secret", grade); err != nil {
+		t.Fatalf("UpdateRequestWithGrading() returned error: %v", err)
+	}
+	shadow := &model.ShadowResponse{Model: "claude-haiku-4", StatusCode: 200, BodyText: "hunter2 is set"}
+	if err := storage.UpdateRequestWithShadow("secret", shadow); err != nil {
+		t.Fatalf("UpdateRequestWithShadow() returned error: %v", err)
+	}
+	imported := &model.RequestLog{
+		RequestID:   "imported",
+		Timestamp:   time.Now().Format(time.RFC3339),
+		Method:      "POST",
+		Endpoint:    "/v1/messages",
+		Body:        map[string]interface{}{"messages": []map[string]string{{"role": "user", "content": "Is it safe?"}}},
+		Response:    &model.ResponseLog{StatusCode: 200, Body: []byte(`{"content":[{"type":"text","text":"No"}]}`)},
+		PromptGrade: &model.PromptGrade{MaxScore: 5, Error: "grading model said hunter2"},
+		Shadow:      &model.ShadowResponse{Model: "claude-haiku-4", StatusCode: 200, BodyText: "hunter2"},
+	}
+	if _, err := storage.ImportRequest(imported); err != nil {
+		t.Fatalf("ImportRequest() returned error: %v", err)
+	}
+
+	db := storage.(*sqliteStorageService).db
+	var leaked int
+	err = db.QueryRow(`SELECT (SELECT COUNT(*) FROM requests WHERE CAST(body AS TEXT) LIKE '%hunter2%' OR CAST(response AS TEXT) LIKE '%hunter2%'
+			OR CAST(prompt_grade AS TEXT) LIKE '%hunter2%' OR CAST(shadow AS TEXT) LIKE '%hunter2%')
+		+ (SELECT COUNT(*) FROM request_search WHERE request_text LIKE '%hunter2%' OR response_text LIKE '%hunter2%')`).Scan(&leaked)
+	if err != nil {
+		t.Fatalf("failed to inspect stored rows: %v", err)
+	}
+	if leaked != 0 {
+		t.Errorf("the secret is stored in the clear in %d places", leaked)
+	}
+
+	stored, _, err := storage.GetRequestByShortID("secret")
+	if err != nil {
+		t.Fatalf("GetRequestByShortID() returned error: %v", err)
+	}
+	if !strings.Contains(fmt.Sprint(stored.Body), "hunter2") || stored.Response == nil || !strings.Contains(string(stored.Response.Body), "hunter2") {
+		t.Errorf("stored request wasn't decrypted: %v, %+v", stored.Body, stored.Response)
+	}
+	if stored.PromptGrade == nil || stored.PromptGrade.Feedback != grade.Feedback || stored.Shadow == nil || stored.Shadow.BodyText != shadow.BodyText {
+		t.Errorf("stored grade and shadow response weren't decrypted: %+v, %+v", stored.PromptGrade, stored.Shadow)
+	}
+	stored, _, err = storage.GetRequestByShortID("imported")
+	if err != nil {
+		t.Fatalf("GetRequestByShortID() returned error: %v", err)
+	}
+	if stored.PromptGrade == nil || stored.PromptGrade.Error != imported.PromptGrade.Error || stored.Shadow == nil || stored.Shadow.BodyText != "hunter2" {
+		t.Errorf("imported grade and shadow response weren't decrypted: %+v, %+v", stored.PromptGrade, stored.Shadow)
+	}
+
+	// Encrypted grades still tell graded requests from ones to grade again
+	ungraded, err := storage.GetAllRequests(RequestFilter{Ungraded: true})
+	if err != nil {
+		t.Fatalf("GetAllRequests() returned error: %v", err)
+	}
+	if len(ungraded) != 1 || ungraded[0].RequestID != "imported" {
+		t.Errorf("ungraded requests = %d, want only the one whose grading failed", len(ungraded))
+	}
+	graded, err := storage.GetGradedPrompts(time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetGradedPrompts() returned error: %v", err)
+	}
+	if len(graded) != 1 || graded[0].Grade.Score != 2 {
+		t.Errorf("graded prompts = %+v, want the encrypted grade", graded)
+	}
+
+	// Without the key the request can't be read, rather than being read as garbage
+	withoutKey, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: dbPath})
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	if _, _, err := withoutKey.GetRequestByShortID("secret"); err == nil || !strings.Contains(err.Error(), "no encryption key") {
+		t.Errorf("GetRequestByShortID() without the key returned %v", err)
+	}
+}
+
+func TestSQLiteStorage_DedupBodies(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db"), CompressMinBytes: 1024, DedupMinBytes: 256})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	system := []map[string]string{{"type": "text", "text": strings.Repeat("You are Claude Code. ", 100)}}
+	opening := map[string]string{"role": "user", "content": strings.Repeat("Here is main.go: func main() {} ", 50)}
+	reply := map[string]string{"role": "assistant", "content": "Done."}
+	followUp := map[string]string{"role": "user", "content": strings.Repeat("Now add tests for it. ", 30)}
+	bodies := []struct {
+		id, timestamp string
+		body          map[string]interface{}
+	}{
+		{"turn-1", "2025-03-01T10:00:00Z", map[string]interface{}{"model": "claude-sonnet-4", "system": system, "messages": []interface{}{opening}}},
+		{"turn-2", "2025-03-01T10:01:00Z", map[string]interface{}{"model": "claude-sonnet-4", "system": system, "messages": []interface{}{opening, reply, followUp}}},
+	}
+	for _, b := range bodies {
+		request := &model.RequestLog{RequestID: b.id, Timestamp: b.timestamp, Method: "POST", Endpoint: "/v1/messages", Body: b.body}
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+	}
+
+	db := storage.(*sqliteStorageService).db
+	for _, b := range bodies {
+		var encoding string
+		if err := db.QueryRow("SELECT COALESCE(body_encoding, '') FROM requests WHERE id = ?", b.id).Scan(&encoding); err != nil {
+			t.Fatalf("failed to read stored row: %v", err)
+		}
+		if encoding != "dedup" {
+			t.Errorf("%s encoding = %q, want dedup", b.id, encoding)
+		}
+
+		stored, err := storage.GetRequestByID(b.id)
+		if err != nil || stored == nil {
+			t.Fatalf("GetRequestByID(%q) = %v, %v", b.id, stored, err)
+		}
+		var want interface{}
+		original, _ := json.Marshal(b.body)
+		json.Unmarshal(original, &want)
+		if !reflect.DeepEqual(stored.Body, want) {
+			t.Errorf("%s body wasn't read back unchanged: %v", b.id, stored.Body)
+		}
+	}
+
+	// The system prompt and opening message are shared; the reply is too short to split out
+	stats, err := storage.GetStorageStats()
+	if err != nil {
+		t.Fatalf("GetStorageStats() returned error: %v", err)
+	}
+	if stats.Dedup.Segments != 3 || stats.Dedup.References != 5 || stats.Dedup.SavedBytes <= 2000 {
+		t.Errorf("dedup stats = %+v, want 3 segments referenced 5 times", stats.Dedup)
+	}
+
+	if _, err := storage.DeleteRequestsBefore(time.Date(2025, 3, 1, 10, 0, 30, 0, time.UTC)); err != nil {
+		t.Fatalf("DeleteRequestsBefore() returned error: %v", err)
+	}
+	if stats, _ := storage.GetStorageStats(); stats.Dedup.Segments != 3 || stats.Dedup.References != 3 || stats.Dedup.SavedBytes != 0 {
+		t.Errorf("dedup stats after deleting turn-1 = %+v, want turn-2's 3 segments kept", stats.Dedup)
+	}
+	if stored, err := storage.GetRequestByID("turn-2"); err != nil || stored == nil {
+		t.Errorf("GetRequestByID() after deleting turn-1 = %v, %v", stored, err)
+	}
+
+	if _, err := storage.ClearRequests(); err != nil {
+		t.Fatalf("ClearRequests() returned error: %v", err)
+	}
+	if stats, _ := storage.GetStorageStats(); stats.Dedup.Segments != 0 {
+		t.Errorf("segments after clearing = %d, want 0", stats.Dedup.Segments)
+	}
+}
+
+func TestSQLiteStorage_RequestTags(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	for i, id := range []string{"slow", "cheap", "pricey"} {
+		request := testRequestLog(id)
+		request.Timestamp = time.Date(2025, 3, 1, 10, i, 0, 0, time.UTC).Format(time.RFC3339)
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+	}
+
+	tagged := []struct {
+		id   string
+		tags []string
+	}{
+		{"slow", []string{"bug-repro"}},
+		{"pricey", []string{"expensive", "bug-repro"}},
+		{"pricey", []string{"expensive"}},
+	}
+	for _, tt := range tagged {
+		if found, err := storage.AddRequestTags(tt.id, tt.tags); err != nil || !found {
+			t.Fatalf("AddRequestTags(%q) = %v, %v", tt.id, found, err)
+		}
+	}
+	if found, err := storage.AddRequestTags("missing", []string{"bug-repro"}); err != nil || found {
+		t.Errorf("AddRequestTags() of an unknown request = %v, %v, want not found", found, err)
+	}
+
+	if request, _ := storage.GetRequestByID("pricey"); !reflect.DeepEqual(request.Tags, []string{"bug-repro", "expensive"}) {
+		t.Errorf("tags of pricey = %v, want both, sorted and once each", request.Tags)
+	}
+	tags, err := storage.GetTags()
+	if err != nil {
+		t.Fatalf("GetTags() returned error: %v", err)
+	}
+	if want := []model.TagCount{{Tag: "bug-repro", Requests: 2}, {Tag: "expensive", Requests: 1}}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("GetTags() = %+v, want %+v", tags, want)
+	}
+
+	filters := []struct {
+		name     string
+		tag      string
+		expected []string
+	}{
+		{"No tag", "", []string{"pricey", "cheap", "slow"}},
+		{"Shared tag", "bug-repro", []string{"pricey", "slow"}},
+		{"Unused tag", "great-answer", nil},
+	}
+	for _, tt := range filters {
+		t.Run(tt.name, func(t *testing.T) {
+			requests, err := storage.GetAllRequests(RequestFilter{Tag: tt.tag})
+			if err != nil {
+				t.Fatalf("GetAllRequests() returned error: %v", err)
+			}
+			var ids []string
+			for _, request := range requests {
+				ids = append(ids, request.RequestID)
+			}
+			if !reflect.DeepEqual(ids, tt.expected) {
+				t.Errorf("GetAllRequests(%q) = %v, want %v", tt.tag, ids, tt.expected)
+			}
+		})
+	}
+
+	if removed, err := storage.RemoveRequestTag("pricey", "bug-repro"); err != nil || !removed {
+		t.Fatalf("RemoveRequestTag() = %v, %v", removed, err)
+	}
+	if removed, _ := storage.RemoveRequestTag("pricey", "bug-repro"); removed {
+		t.Error("RemoveRequestTag() of a tag already removed reported it removed")
+	}
+
+	if _, err := storage.DeleteRequestsBefore(time.Date(2025, 3, 1, 10, 1, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("DeleteRequestsBefore() returned error: %v", err)
+	}
+	if tags, _ := storage.GetTags(); !reflect.DeepEqual(tags, []model.TagCount{{Tag: "expensive", Requests: 1}}) {
+		t.Errorf("GetTags() after deleting slow = %+v, want only pricey's tag", tags)
+	}
+}
+
+func TestSQLiteStorage_RequestAnnotations(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	for i, id := range []string{"plain", "starred", "noted", "both"} {
+		request := testRequestLog(id)
+		request.Timestamp = time.Date(2025, 3, 1, 10, i, 0, 0, time.UTC).Format(time.RFC3339)
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+	}
+
+	for _, id := range []string{"starred", "both"} {
+		if found, err := storage.StarRequest(id, true); err != nil || !found {
+			t.Fatalf("StarRequest(%q) = %v, %v", id, found, err)
+		}
+	}
+	for _, id := range []string{"noted", "both"} {
+		if found, err := storage.SetRequestNote(id, "Good prompt for "+id); err != nil || !found {
+			t.Fatalf("SetRequestNote(%q) = %v, %v", id, found, err)
+		}
+	}
+	if found, err := storage.StarRequest("missing", true); err != nil || found {
+		t.Errorf("StarRequest() of an unknown request = %v, %v, want not found", found, err)
+	}
+	if request, _ := storage.GetRequestByID("both"); !request.Starred || request.Note != "Good prompt for both" {
+		t.Errorf("both = starred %v, note %q", request.Starred, request.Note)
+	}
+
+	filters := []struct {
+		name     string
+		filter   RequestFilter
+		expected []string
+	}{
+		{"Starred", RequestFilter{Starred: true}, []string{"both", "starred"}},
+		{"Annotated", RequestFilter{Annotated: true}, []string{"both", "noted"}},
+		{"Starred and annotated", RequestFilter{Starred: true, Annotated: true}, []string{"both"}},
+	}
+	for _, tt := range filters {
+		t.Run(tt.name, func(t *testing.T) {
+			requests, err := storage.GetAllRequests(tt.filter)
+			if err != nil {
+				t.Fatalf("GetAllRequests() returned error: %v", err)
+			}
+			var ids []string
+			for _, request := range requests {
+				ids = append(ids, request.RequestID)
+			}
+			if !reflect.DeepEqual(ids, tt.expected) {
+				t.Errorf("GetAllRequests(%+v) = %v, want %v", tt.filter, ids, tt.expected)
+			}
+		})
+	}
+
+	// Unstarring keeps the note, and clearing the note keeps the star
+	if _, err := storage.StarRequest("both", false); err != nil {
+		t.Fatalf("StarRequest() returned error: %v", err)
+	}
+	if _, err := storage.SetRequestNote("starred", ""); err != nil {
+		t.Fatalf("SetRequestNote() returned error: %v", err)
+	}
+	if request, _ := storage.GetRequestByID("both"); request.Starred || request.Note == "" {
+		t.Errorf("both after unstarring = starred %v, note %q", request.Starred, request.Note)
+	}
+	if request, _ := storage.GetRequestByID("starred"); !request.Starred || request.Note != "" {
+		t.Errorf("starred after clearing its note = starred %v, note %q", request.Starred, request.Note)
+	}
+
+	if _, err := storage.StarRequest("noted", false); err != nil {
+		t.Fatalf("StarRequest() returned error: %v", err)
+	}
+	if _, err := storage.SetRequestNote("noted", ""); err != nil {
+		t.Fatalf("SetRequestNote() returned error: %v", err)
+	}
+	if _, err := storage.DeleteRequestsBefore(time.Date(2025, 3, 1, 10, 2, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("DeleteRequestsBefore() returned error: %v", err)
+	}
+	var annotations int
+	if err := storage.(*sqliteStorageService).db.QueryRow("SELECT COUNT(*) FROM request_annotations").Scan(&annotations); err != nil {
+		t.Fatalf("failed to count annotations: %v", err)
+	}
+	if annotations != 1 {
+		t.Errorf("annotations left = %d, want only both's, the cleared and deleted ones dropped", annotations)
+	}
+}
+
+func TestSQLiteStorage_DeleteRequests(t *testing.T) {
+	stored := []struct {
+		id, model, session string
+		status, minute     int
+	}{
+		{"title", "claude-3-5-haiku-20241022", "session-a", 200, 0},
+		{"turn", "claude-sonnet-4", "session-a", 200, 1},
+		{"overloaded", "claude-sonnet-4", "session-b", 529, 2},
+		{"quota", "claude-3-5-haiku-20241022", "session-b", 200, 3},
+	}
+
+	tests := []struct {
+		name     string
+		filter   RequestFilter
+		expected []string // requests left, newest first
+	}{
+		{"Model", RequestFilter{Model: "HAIKU"}, []string{"overloaded", "turn"}},
+		{"Status", RequestFilter{StatusCode: 529}, []string{"quota", "turn", "title"}},
+		{"Session", RequestFilter{SessionID: "session-a"}, []string{"quota", "overloaded"}},
+		{"Before", RequestFilter{Before: time.Date(2025, 3, 1, 10, 2, 0, 0, time.UTC)}, []string{"quota", "overloaded"}},
+		{"Every filter", RequestFilter{Model: "haiku", SessionID: "session-b", Before: time.Date(2025, 3, 1, 11, 0, 0, 0, time.UTC)}, []string{"overloaded", "turn", "title"}},
+		{"No match", RequestFilter{Model: "opus"}, []string{"quota", "overloaded", "turn", "title"}},
+		{"No filter", RequestFilter{}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+			if err != nil {
+				t.Fatalf("failed to open storage: %v", err)
+			}
+			for _, r := range stored {
+				request := testRequestLog(r.id)
+				request.Timestamp = time.Date(2025, 3, 1, 10, r.minute, 0, 0, time.UTC).Format(time.RFC3339)
+				request.Model = r.model
+				request.SessionID = r.session
+				if _, err := storage.SaveRequest(request); err != nil {
+					t.Fatalf("SaveRequest() returned error: %v", err)
+				}
+				request.Response = &model.ResponseLog{StatusCode: r.status}
+				if err := storage.UpdateRequestWithResponse(request); err != nil {
+					t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+				}
+			}
+
+			deleted, err := storage.DeleteRequests(tt.filter)
+			if err != nil {
+				t.Fatalf("DeleteRequests() returned error: %v", err)
+			}
+			if deleted != len(stored)-len(tt.expected) {
+				t.Errorf("DeleteRequests() = %d, want %d", deleted, len(stored)-len(tt.expected))
+			}
+			requests, _ := storage.GetAllRequests(RequestFilter{})
+			var left []string
+			for _, request := range requests {
+				left = append(left, request.RequestID)
+			}
+			if !reflect.DeepEqual(left, tt.expected) {
+				t.Errorf("requests left = %v, want %v", left, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSQLiteStorage_Trash(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db"), TrashDays: 7})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	for i, id := range []string{"first", "second", "third"} {
+		request := testRequestLog(id)
+		request.Timestamp = time.Date(2025, 3, 1, 10, i, 0, 0, time.UTC).Format(time.RFC3339)
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+	}
+	if _, err := storage.AddRequestTags("second", []string{"keep"}); err != nil {
+		t.Fatalf("AddRequestTags() returned error: %v", err)
+	}
+
+	if trashed, err := storage.ClearRequests(); err != nil || trashed != 3 {
+		t.Fatalf("ClearRequests() = %d, %v, want 3 requests moved to the trash", trashed, err)
+	}
+	if _, total, _ := storage.GetRequests(1, 10); total != 0 {
+		t.Errorf("requests listed after clearing = %d, want none", total)
+	}
+	if request, _ := storage.GetRequestByID("first"); request != nil {
+		t.Errorf("GetRequestByID() of a trashed request = %+v, want nil", request)
+	}
+	if tags, _ := storage.GetTags(); len(tags) != 0 {
+		t.Errorf("GetTags() after clearing = %v, want no tags in use", tags)
+	}
+	trash, total, err := storage.GetTrash(1, 10)
+	if err != nil || total != 3 || len(trash) != 3 || trash[0].DeletedAt == "" {
+		t.Fatalf("GetTrash() = %+v, %d, %v, want 3 requests with their deletion time", trash, total, err)
+	}
+
+	if restored, err := storage.RestoreRequests([]string{"second", "missing"}); err != nil || restored != 1 {
+		t.Fatalf("RestoreRequests() = %d, %v, want 1 request restored", restored, err)
+	}
+	requests, _ := storage.GetAllRequests(RequestFilter{Tag: "keep"})
+	if len(requests) != 1 || requests[0].RequestID != "second" || requests[0].DeletedAt != "" {
+		t.Errorf("requests tagged keep after restoring = %+v, want second with its tags back", requests)
+	}
+
+	if purged, err := storage.PurgeTrash(time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+		t.Errorf("PurgeTrash() of requests trashed over an hour ago = %d, %v, want none purged", purged, err)
+	}
+	if purged, err := storage.PurgeTrash(time.Time{}); err != nil || purged != 2 {
+		t.Errorf("PurgeTrash() = %d, %v, want the 2 trashed requests purged", purged, err)
+	}
+	if restored, _ := storage.RestoreRequests(nil); restored != 0 {
+		t.Errorf("RestoreRequests() after purging = %d, want nothing left to restore", restored)
+	}
+	if _, total, _ := storage.GetRequests(1, 10); total != 1 {
+		t.Errorf("requests left = %d, want only the restored one", total)
+	}
+}
+
+func TestSQLiteStorage_ErrorTypes(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	responses := map[string]*model.ResponseLog{
+		"ok":         {StatusCode: 200, Body: []byte(`{"type":"message"}`)},
+		"overloaded": {StatusCode: 529, Headers: map[string][]string{}, Body: []byte(`{"type":"error","error":{"type":"overloaded_error"}}`)},
+		"limited":    {StatusCode: 429, Headers: map[string][]string{}, Body: []byte(`{"type":"error","error":{"type":"rate_limit_error"}}`)},
+		"limited-2":  {StatusCode: 429, Headers: map[string][]string{}, Body: []byte(`{"type":"error","error":{"type":"rate_limit_error"}}`)},
+		"gateway":    {StatusCode: 502, Headers: map[string][]string{}, BodyText: "Bad Gateway"},
+	}
+	for id, response := range responses {
+		if _, err := storage.SaveRequest(testRequestLog(id)); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		if err := storage.UpdateRequestWithResponse(&model.RequestLog{RequestID: id, Response: response}); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		filter   RequestFilter
+		expected int
+	}{
+		{"Error type", RequestFilter{ErrorType: "rate_limit_error"}, 2},
+		{"Status and error type", RequestFilter{StatusCode: 529, ErrorType: "overloaded_error"}, 1},
+		{"Status without an API error", RequestFilter{StatusCode: 502}, 1},
+		{"Unknown error type", RequestFilter{ErrorType: "api_error"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests, err := storage.GetAllRequests(tt.filter)
+			if err != nil || len(requests) != tt.expected {
+				t.Errorf("GetAllRequests(%+v) = %d requests, %v, want %d", tt.filter, len(requests), err, tt.expected)
+			}
+		})
+	}
+
+	stats, err := storage.GetStats(time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetStats() returned error: %v", err)
+	}
+	expected := []model.ErrorTypeUsage{
+		{StatusCode: 429, ErrorType: "rate_limit_error", Requests: 2},
+		{StatusCode: 502, ErrorType: "", Requests: 1},
+		{StatusCode: 529, ErrorType: "overloaded_error", Requests: 1},
+	}
+	if !reflect.DeepEqual(stats.ErrorTypes, expected) {
+		t.Errorf("error types = %+v, want %+v", stats.ErrorTypes, expected)
+	}
+}
+
+func TestSQLiteStorage_ForTenant(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	for i, user := range []string{"alice", "alice", "bob", ""} {
+		request := testRequestLog(fmt.Sprintf("req-%d", i))
+		if user != "" {
+			request.Routing = &model.RoutingExplanation{User: user}
+		}
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+	}
+	alice, bob := storage.ForTenant("alice"), storage.ForTenant("bob")
+
+	if _, total, _ := alice.GetRequests(1, 10); total != 2 {
+		t.Errorf("requests alice sees = %d, want her 2", total)
+	}
+	if _, total, _ := storage.GetRequests(1, 10); total != 4 {
+		t.Errorf("requests listed without a tenant = %d, want all 4", total)
+	}
+	if request, _ := bob.GetRequestByID("req-0"); request != nil {
+		t.Errorf("GetRequestByID() of alice's request as bob = %+v, want nil", request)
+	}
+	if stats, err := bob.GetStats(time.Time{}, time.Now().Add(time.Hour)); err != nil || stats.Requests != 1 {
+		t.Errorf("GetStats() as bob = %+v, %v, want his 1 request", stats, err)
+	}
+
+	if found, _ := bob.AddRequestTags("req-0", []string{"mine"}); found {
+		t.Error("AddRequestTags() found alice's request as bob")
+	}
+	if _, err := alice.AddRequestTags("req-0", []string{"mine"}); err != nil {
+		t.Fatalf("AddRequestTags() returned error: %v", err)
+	}
+	if tags, _ := bob.GetTags(); len(tags) != 0 {
+		t.Errorf("GetTags() as bob = %v, want none of alice's tags", tags)
+	}
+	if removed, _ := bob.RemoveRequestTag("req-0", "mine"); removed {
+		t.Error("RemoveRequestTag() of alice's tag as bob removed it")
+	}
+
+	if deleted, err := bob.ClearRequests(); err != nil || deleted != 1 {
+		t.Errorf("ClearRequests() as bob = %d, %v, want only his request deleted", deleted, err)
+	}
+	if _, total, _ := storage.GetRequests(1, 10); total != 3 {
+		t.Errorf("requests left = %d, want 3 after bob cleared his", total)
+	}
+
+	// The tenant is bound as an argument, never spliced into the query
+	if _, total, err := storage.ForTenant("x' OR '1' = '1").GetRequests(1, 10); err != nil || total != 0 {
+		t.Errorf("requests a quoted tenant sees = %d, %v, want none", total, err)
+	}
+}
+
+func TestSQLiteStorage_GetStorageStats(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	stats, err := storage.GetStorageStats()
+	if err != nil {
+		t.Fatalf("GetStorageStats() returned error: %v", err)
+	}
+	if stats.Requests != 0 || stats.OldestRequest != "" || stats.AverageRequestBytes != 0 {
+		t.Errorf("stats of an empty database = %+v, want no requests", stats)
+	}
+
+	for i, id := range []string{"first", "second", "third"} {
+		request := testRequestLog(id)
+		request.Timestamp = time.Date(2025, 3, 1, 10, i, 0, 0, time.UTC).Format(time.RFC3339)
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+	}
+	stats, err = storage.GetStorageStats()
+	if err != nil {
+		t.Fatalf("GetStorageStats() returned error: %v", err)
+	}
+	if stats.Requests != 3 || stats.OldestRequest != "2025-03-01T10:00:00Z" || stats.NewestRequest != "2025-03-01T10:02:00Z" {
+		t.Errorf("requests = %d from %s to %s, want 3 from 10:00 to 10:02", stats.Requests, stats.OldestRequest, stats.NewestRequest)
+	}
+	if stats.DatabaseBytes == 0 || stats.AverageRequestBytes == 0 {
+		t.Errorf("database bytes = %d, average request bytes = %d, want both set", stats.DatabaseBytes, stats.AverageRequestBytes)
+	}
+	if len(stats.FullScans) != 0 {
+		t.Errorf("full scans = %v, want every frequent query indexed", stats.FullScans)
+	}
+
+	tables := make(map[string]int64)
+	for _, table := range stats.Tables {
+		tables[table.Name] = table.Rows
+	}
+	if tables["requests"] != 3 || tables["request_search"] != 3 {
+		t.Errorf("table rows = %v, want 3 requests, each indexed for search", tables)
+	}
+
+	tests := []struct {
+		index string
+		query string
+	}{
+		{"idx_timestamp", "request list"},
+		{"idx_session_id", "session requests"},
+		{"idx_request_tags_tag", "tagged requests"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.index, func(t *testing.T) {
+			for _, index := range stats.Indexes {
+				if index.Name == tt.index {
+					if !reflect.DeepEqual(index.Queries, []string{tt.query}) {
+						t.Errorf("%s is used by %v, want %q", tt.index, index.Queries, tt.query)
+					}
+					return
+				}
+			}
+			t.Errorf("no %s among %+v", tt.index, stats.Indexes)
+		})
+	}
+}
+
+func TestSQLiteStorage_GetSessionUsage(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	requests := []struct {
+		id, session, timestamp, model string
+		inputTokens                   int
+	}{
+		{"a1", "session-a", "2025-03-01T10:00:00Z", "claude-sonnet-4", 100},
+		{"a2", "session-a", "2025-03-01T10:05:00Z", "claude-3-5-haiku", 50},
+		{"b1", "session-b", "2025-03-01T09:00:00Z", "claude-opus-4", 10},
+		{"none", "", "2025-03-01T11:00:00Z", "claude-sonnet-4", 1},
+	}
+	for _, r := range requests {
+		log := &model.RequestLog{RequestID: r.id, Timestamp: r.timestamp, Method: "POST", Endpoint: "/v1/messages", Body: map[string]string{}, Model: r.model, SessionID: r.session}
+		if _, err := storage.SaveRequest(log); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		log.Response = &model.ResponseLog{StatusCode: 200, ResponseTime: 100, Body: []byte(fmt.Sprintf(`{"usage":{"input_tokens":%d,"output_tokens":1}}`, r.inputTokens))}
+		if err := storage.UpdateRequestWithResponse(log); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+	}
+
+	sessions, err := storage.GetSessionUsage(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("GetSessionUsage() returned error: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("GetSessionUsage() = %+v, want the two sessions", sessions)
+	}
+	a := sessions[0]
+	if a.Session != "session-a" || a.Requests != 2 || a.InputTokens != 150 || a.Model != "claude-3-5-haiku" {
+		t.Errorf("first session = %+v, want session-a with 2 requests, 150 input tokens and its latest model", a)
+	}
+	if a.FirstRequestAt != "2025-03-01T10:00:00Z" || a.LastRequestAt != "2025-03-01T10:05:00Z" {
+		t.Errorf("session-a ran %s to %s", a.FirstRequestAt, a.LastRequestAt)
+	}
+	if sessions[1].Session != "session-b" || sessions[1].Requests != 1 {
+		t.Errorf("second session = %+v, want session-b", sessions[1])
+	}
+
+	inSession, err := storage.GetSessionRequests("session-a")
+	if err != nil || len(inSession) != 2 || inSession[0].RequestID != "a1" || inSession[1].RequestID != "a2" {
+		t.Errorf("GetSessionRequests() = %d requests, %v; want a1 then a2", len(inSession), err)
+	}
+}
+
+func TestSQLiteStorage_RequestCosts(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	now := time.Now()
+	save := func(id, modelName string, origin string) {
+		t.Helper()
+		request := &model.RequestLog{RequestID: id, Timestamp: now.Format(time.RFC3339), Method: "POST", Endpoint: "/v1/messages", Body: map[string]string{}, Model: modelName}
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		request.Response = &model.ResponseLog{StatusCode: 200, Origin: origin, Body: []byte(`{"usage":{"input_tokens":1000000,"output_tokens":100000}}`)}
+		if err := storage.UpdateRequestWithResponse(request); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+	}
+
+	// Stored before prices were set, like requests from before costs were stored
+	save("old", "claude-sonnet-4", "")
+	save("synthetic", "claude-sonnet-4", model.ResponseOriginSynthetic)
+	save("unpriced", "llama3", "")
+
+	if err := storage.SetPrices(NewPriceTable(nil)); err != nil {
+		t.Fatalf("SetPrices() returned error: %v", err)
+	}
+	save("new", "claude-sonnet-4", "")
+
+	// A price change afterwards leaves stored costs alone
+	if err := storage.SetPrices(NewPriceTable(map[string]config.PriceConfig{"sonnet": {Input: 1, Output: 1}})); err != nil {
+		t.Fatalf("SetPrices() returned error: %v", err)
+	}
+	save("repriced", "claude-sonnet-4", "")
+
+	tests := []struct {
+		id       string
+		expected *float64
+	}{
+		{"old", floatPtr(4.5)},
+		{"synthetic", floatPtr(0)},
+		{"unpriced", nil},
+		{"new", floatPtr(4.5)},
+		{"repriced", floatPtr(1.1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			stored, _, err := storage.GetRequestByShortID(tt.id)
+			if err != nil {
+				t.Fatalf("GetRequestByShortID() returned error: %v", err)
+			}
+			switch {
+			case tt.expected == nil && stored.CostUSD != nil:
+				t.Errorf("CostUSD = %v, want none", *stored.CostUSD)
+			case tt.expected != nil && stored.CostUSD == nil:
+				t.Errorf("CostUSD is missing, want %v", *tt.expected)
+			case tt.expected != nil && math.Abs(*stored.CostUSD-*tt.expected) > 1e-9:
+				t.Errorf("CostUSD = %v, want %v", *stored.CostUSD, *tt.expected)
+			}
+		})
+	}
+
+	stats, err := storage.GetStats(now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetStats() returned error: %v", err)
+	}
+	if math.Abs(stats.CostUSD-10.1) > 1e-9 {
+		t.Errorf("CostUSD = %v, want 10.1", stats.CostUSD)
+	}
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
+func TestSQLiteStorage_CostGroups(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	if err := storage.SetPrices(NewPriceTable(nil)); err != nil {
+		t.Fatalf("SetPrices() returned error: %v", err)
+	}
+
+	now := time.Now()
+	for i, routed := range []string{"gpt-4o", "gpt-4o", "", "gpt-5-preview"} {
+		request := testRequestLog(fmt.Sprintf("req-%d", i))
+		request.Body = map[string]interface{}{
+			"model":  "claude-sonnet-4",
+			"system": []map[string]string{{"type": "text", "text": "Here is useful information about the environment:\n<env>\nWorking directory: /src/api\n</env>"}},
+		}
+		request.OriginalModel = "claude-sonnet-4"
+		request.RoutedModel = routed
+		if routed != "" {
+			request.Provider = "openai"
+		}
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		request.Response = &model.ResponseLog{StatusCode: 200, Body: []byte(`{"usage":{"input_tokens":1000000}}`)}
+		if err := storage.UpdateRequestWithResponse(request); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+	}
+
+	groups, err := storage.GetCostGroups(now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetCostGroups() returned error: %v", err)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Model < groups[j].Model })
+	day := now.Format("2006-01-02")
+	expected := []model.CostGroup{
+		{Day: day, Project: "/src/api", Model: "claude-sonnet-4", RequestedModel: "claude-sonnet-4", Requests: 1, InputTokens: 1000000, CostUSD: 3},
+		{Day: day, Project: "/src/api", Provider: "openai", Model: "gpt-4o", RequestedModel: "claude-sonnet-4", Requests: 2, InputTokens: 2000000, CostUSD: 5},
+		{Day: day, Project: "/src/api", Provider: "openai", Model: "gpt-5-preview", RequestedModel: "claude-sonnet-4", Requests: 1, Unpriced: 1, InputTokens: 1000000},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("GetCostGroups() = %+v, want %+v", groups, expected)
+	}
+}
+
+func TestSQLiteStorage_GetStatsSummary(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	if err := storage.SetPrices(NewPriceTable(nil)); err != nil {
+		t.Fatalf("SetPrices() returned error: %v", err)
+	}
+
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	// Twenty answers taking 1s to 20s, a synthetic rejection and one from the day before
+	for i := 1; i <= 22; i++ {
+		request := testRequestLog(fmt.Sprintf("req-%d", i))
+		request.Timestamp = start.Add(time.Duration(i) * time.Minute).Format(time.RFC3339)
+		response := &model.ResponseLog{StatusCode: 200, ResponseTime: int64(i * 1000), Body: []byte(`{"usage":{"input_tokens":100,"output_tokens":10}}`)}
+		switch i {
+		case 21:
+			response = &model.ResponseLog{StatusCode: 429, Origin: model.ResponseOriginSynthetic}
+		case 22:
+			request.Timestamp = start.AddDate(0, 0, -1).Format(time.RFC3339)
+		}
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		request.Response = response
+		if err := storage.UpdateRequestWithResponse(request); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+	}
+
+	summary, err := storage.GetStatsSummary(start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetStatsSummary() returned error: %v", err)
+	}
+	expected := model.StatsSummary{
+		From:            "2025-03-01T10:00:00Z",
+		To:              "2025-03-01T11:00:00Z",
+		Requests:        21,
+		Errors:          1,
+		InputTokens:     2000,
+		OutputTokens:    200,
+		CostUSD:         0.009,
+		AvgResponseTime: 10500,
+		P95ResponseTime: 19000,
+	}
+	if math.Abs(summary.CostUSD-expected.CostUSD) < 1e-9 {
+		summary.CostUSD = expected.CostUSD
+	}
+	if *summary != expected {
+		t.Errorf("GetStatsSummary() = %+v, want %+v", *summary, expected)
+	}
+}
+
+func TestSQLiteStorage_GetStatsLatency(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	// Ten streamed sonnet answers taking 1s to 10s through anthropic, and
+	// one opus answer taking two minutes through bedrock
+	for i := 1; i <= 11; i++ {
+		request := testRequestLog(fmt.Sprintf("req-%d", i))
+		request.Timestamp = start.Add(time.Duration(i) * time.Minute).Format(time.RFC3339)
+		request.Provider = "anthropic"
+		response := &model.ResponseLog{
+			StatusCode:       200,
+			ResponseTime:     int64(i * 1000),
+			IsStreaming:      true,
+			ChunkCount:       10,
+			TimeToFirstToken: int64(i * 100),
+		}
+		if i == 11 {
+			request.Model = "claude-opus-4"
+			request.Provider = "bedrock"
+			response = &model.ResponseLog{StatusCode: 200, ResponseTime: 120000}
+		}
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		request.Response = response
+		if err := storage.UpdateRequestWithResponse(request); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+	}
+
+	stats, err := storage.GetStats(start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetStats() returned error: %v", err)
+	}
+
+	sonnet := model.Latency{
+		ResponseTimePercentiles:     &model.Percentiles{P50: 5000, P90: 9000, P99: 10000},
+		TimeToFirstTokenPercentiles: &model.Percentiles{P50: 500, P90: 900, P99: 1000},
+	}
+	opus := model.Latency{
+		ResponseTimePercentiles: &model.Percentiles{P50: 120000, P90: 120000, P99: 120000},
+	}
+	models := make(map[string]model.Latency)
+	for _, usage := range stats.Models {
+		models[usage.Model] = usage.Latency
+	}
+	providers := make(map[string]model.Latency)
+	for _, usage := range stats.Providers {
+		providers[usage.Provider] = usage.Latency
+	}
+
+	tests := []struct {
+		name     string
+		got      model.Latency
+		expected model.Latency
+	}{
+		{
+			name: "overall",
+			got:  stats.Latency,
+			expected: model.Latency{
+				ResponseTimePercentiles:     &model.Percentiles{P50: 6000, P90: 10000, P99: 120000},
+				TimeToFirstTokenPercentiles: sonnet.TimeToFirstTokenPercentiles,
+			},
+		},
+		{name: "sonnet", got: models["claude-sonnet-4"], expected: sonnet},
+		{name: "opus", got: models["claude-opus-4"], expected: opus},
+		{name: "anthropic", got: providers["anthropic"], expected: sonnet},
+		{name: "bedrock", got: providers["bedrock"], expected: opus},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.expected) {
+				got, _ := json.Marshal(tt.got)
+				expected, _ := json.Marshal(tt.expected)
+				t.Errorf("latency = %s, want %s", got, expected)
+			}
+		})
+	}
+}
+
+func TestSQLiteStorage_GetErrorGroups(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i, at := range []struct {
+		timestamp string
+		response  *model.ResponseLog
+	}{
+		{"2025-03-01T10:05:00Z", &model.ResponseLog{StatusCode: 200}},
+		{"2025-03-01T10:55:00Z", &model.ResponseLog{StatusCode: 200}},
+		// 11:10 in UTC
+		{"2025-03-01T12:10:00+01:00", &model.ResponseLog{StatusCode: 529, Body: []byte(`{"type":"error","error":{"type":"overloaded_error"}}`)}},
+		// Still pending
+		{"2025-03-01T11:00:00Z", nil},
+	} {
+		request := testRequestLog(fmt.Sprintf("req-%d", i))
+		request.Timestamp = at.timestamp
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		if at.response == nil {
+			continue
+		}
+		request.Response = at.response
+		if err := storage.UpdateRequestWithResponse(request); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+	}
+
+	groups, err := storage.GetErrorGroups(start, start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("GetErrorGroups() returned error: %v", err)
+	}
+	expected := []model.ErrorGroup{
+		{Hour: "2025-03-01 10:00:00", StatusCode: 200, Requests: 2},
+		{Hour: "2025-03-01 11:00:00", StatusCode: 529, ErrorType: "overloaded_error", Requests: 1},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("GetErrorGroups() = %+v, want %+v", groups, expected)
+	}
+}
+
+func TestSQLiteStorage_GetModelComparison(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	if err := storage.SetPrices(NewPriceTable(nil)); err != nil {
+		t.Fatalf("SetPrices() returned error: %v", err)
+	}
+
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	// Sonnet requests routed to gpt-4o, one of them failing, alongside
+	// sonnet served as asked
+	for i, routed := range []string{"gpt-4o", "gpt-4o", "gpt-4o", "gpt-4o", ""} {
+		request := testRequestLog(fmt.Sprintf("req-%d", i))
+		request.Timestamp = start.Add(time.Duration(i) * time.Minute).Format(time.RFC3339)
+		request.RoutedModel = routed
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		request.Response = &model.ResponseLog{StatusCode: 200, ResponseTime: int64(1000 * (i + 1)), BodyBytes: 400,
+			Body: []byte(`{"usage":{"input_tokens":1000,"output_tokens":200}}`)}
+		if i == 3 {
+			request.Response = &model.ResponseLog{StatusCode: 500, Origin: model.ResponseOriginUpstream, ResponseTime: 100, BodyBytes: 40, Body: []byte(`{"type":"error"}`)}
+		}
+		if err := storage.UpdateRequestWithResponse(request); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+	}
+
+	comparison, err := storage.GetModelComparison([]string{"claude-sonnet-4", "gpt-4o", "claude-opus-4"}, start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetModelComparison() returned error: %v", err)
+	}
+	expected := &model.ModelComparison{
+		From: "2025-03-01T10:00:00Z",
+		To:   "2025-03-01T11:00:00Z",
+		Models: []model.ComparedModel{
+			{
+				Model: "claude-sonnet-4", Requests: 1, InputTokens: 1000, OutputTokens: 200,
+				CostUSD: 0.006, CostPerRequestUSD: 0.006, AvgResponseTime: 5000, AvgOutputTokens: 200, AvgResponseBytes: 400,
+				Latency: model.Latency{ResponseTimePercentiles: &model.Percentiles{P50: 5000, P90: 5000, P99: 5000}},
+			},
+			{
+				Model: "gpt-4o", Requests: 4, Errors: 1, ErrorRate: 0.25, InputTokens: 3000, OutputTokens: 600,
+				CostUSD: 0.0135, CostPerRequestUSD: 0.003375, AvgResponseTime: 1525, AvgOutputTokens: 150, AvgResponseBytes: 310,
+				Latency: model.Latency{ResponseTimePercentiles: &model.Percentiles{P50: 1000, P90: 3000, P99: 3000}},
+			},
+			{Model: "claude-opus-4"},
+		},
+	}
+	if !reflect.DeepEqual(comparison, expected) {
+		got, _ := json.Marshal(comparison)
+		want, _ := json.Marshal(expected)
+		t.Errorf("GetModelComparison() = %s, want %s", got, want)
+	}
+}
+
+func TestSQLiteStorage_GetClientStats(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i, request := range []struct {
+		userAgent string
+		user      string
+		tokens    int
+	}{
+		{"claude-cli/1.0.80 (external, cli)", "alice", 600},
+		{"claude-cli/1.0.80 (external, cli)", "bob", 200},
+		{"claude-cli/1.0.72 (external, cli)", "alice", 100},
+		{"python-httpx/0.27.0", "", 100},
+	} {
+		saved := testRequestLog(fmt.Sprintf("req-%d", i))
+		saved.Timestamp = start.Add(time.Duration(i) * time.Minute).Format(time.RFC3339)
+		saved.UserAgent = request.userAgent
+		if request.user != "" {
+			saved.Routing = &model.RoutingExplanation{User: request.user}
+		}
+		if _, err := storage.SaveRequest(saved); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		saved.Response = &model.ResponseLog{StatusCode: 200, Body: []byte(fmt.Sprintf(`{"usage":{"input_tokens":%d}}`, request.tokens))}
+		if err := storage.UpdateRequestWithResponse(saved); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+	}
+
+	stats, err := storage.GetClientStats(start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetClientStats() returned error: %v", err)
+	}
+	expected := &model.ClientStats{
+		From:   "2025-03-01T10:00:00Z",
+		To:     "2025-03-01T11:00:00Z",
+		Tokens: 1000,
+		Clients: []model.ClientUsage{
+			{Name: "claude-cli/1.0.80", Requests: 2, InputTokens: 800, Tokens: 800, TokenShare: 80},
+			{Name: "claude-cli/1.0.72", Requests: 1, InputTokens: 100, Tokens: 100, TokenShare: 10},
+			{Name: "python-httpx/0.27.0", Requests: 1, InputTokens: 100, Tokens: 100, TokenShare: 10},
+		},
+		Users: []model.ClientUsage{
+			{Name: "alice", Requests: 2, InputTokens: 700, Tokens: 700, TokenShare: 70},
+			{Name: "bob", Requests: 1, InputTokens: 200, Tokens: 200, TokenShare: 20},
+			{Name: "", Requests: 1, InputTokens: 100, Tokens: 100, TokenShare: 10},
+		},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		got, _ := json.Marshal(stats)
+		want, _ := json.Marshal(expected)
+		t.Errorf("GetClientStats() = %s, want %s", got, want)
+	}
+}
+
+func TestSQLiteStorage_GetGradedPrompts(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	grades := []*model.PromptGrade{
+		{Score: 7, MaxScore: 10, Criteria: map[string]model.CriteriaScore{"clarity": {Score: 4}}},
+		{IsProcessing: true},
+		nil,
+		{Score: 3, MaxScore: 10},
+	}
+	for i, grade := range grades {
+		request := testRequestLog(fmt.Sprintf("req-%d", i))
+		request.Timestamp = start.Add(time.Duration(i) * time.Minute).Format(time.RFC3339)
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		if grade != nil {
+			if err := storage.UpdateRequestWithGrading(request.RequestID, grade); err != nil {
+				t.Fatalf("UpdateRequestWithGrading() returned error: %v", err)
+			}
+		}
+	}
+
+	prompts, err := storage.GetGradedPrompts(start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetGradedPrompts() returned error: %v", err)
+	}
+	expected := []model.GradedPrompt{
+		{Timestamp: "2025-03-01T10:00:00Z", Grade: *grades[0]},
+		{Timestamp: "2025-03-01T10:03:00Z", Grade: *grades[3]},
+	}
+	if !reflect.DeepEqual(prompts, expected) {
+		t.Errorf("GetGradedPrompts() = %+v, want %+v", prompts, expected)
+	}
+}
+
+func TestSQLiteStorage_StoresUTCTimestamps(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	// As text with their offsets the Berlin request looks the newer, though
+	// the New York one was made half an hour after it
+	for id, timestamp := range map[string]string{"new-york": "2025-03-01T20:00:00-05:00", "berlin": "2025-03-02T01:30:00+01:00"} {
+		request := testRequestLog(id)
+		request.Timestamp = timestamp
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+	}
+
+	requests, err := storage.GetAllRequests(RequestFilter{})
+	if err != nil {
+		t.Fatalf("GetAllRequests() returned error: %v", err)
+	}
+	if len(requests) != 2 || requests[0].RequestID != "new-york" || requests[0].Timestamp != "2025-03-02T01:00:00Z" ||
+		requests[1].RequestID != "berlin" || requests[1].Timestamp != "2025-03-02T00:30:00Z" {
+		t.Errorf("GetAllRequests() = %v and %v, want new-york at 01:00 UTC, then berlin at 00:30 UTC", requests[0], requests[1])
+	}
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// plannedQueries are the queries the proxy runs most, whose plans show which
+// indexes are in use. The parameters don't matter to the plan.
+var plannedQueries = []struct {
+	name, query string
+}{
+	{"request list", "SELECT id FROM requests WHERE " + liveRequest + " ORDER BY timestamp DESC LIMIT 10"},
+	{"session requests", "SELECT id FROM requests WHERE session_id = '' AND " + liveRequest + " ORDER BY timestamp"},
+	{"trash", "SELECT id FROM requests WHERE deleted_at IS NOT NULL"},
+	{"tagged requests", "SELECT request_id FROM request_tags WHERE tag = ''"},
+	{"body segment references", "SELECT request_id FROM request_segments WHERE hash = ''"},
+	{"usage events", "SELECT timestamp FROM usage_events WHERE timestamp >= '' AND timestamp < ''"},
+}
+
+var planIndexPattern = regexp.MustCompile(`USING (?:COVERING )?INDEX (\S+)`)
+
+// GetStorageStats reports how the database is using its space: its size and
+// that of the write-ahead log, the rows of each table, the stored requests
+// including those in the trash, which indexes the frequent queries use and
+// how much deduplication saves
+func (s *sqliteStorageService) GetStorageStats() (*model.StorageStats, error) {
+	sizes, err := s.databaseSizes()
+	if err != nil {
+		return nil, err
+	}
+	stats := &model.StorageStats{DatabaseSizes: sizes}
+
+	var oldest, newest sql.NullString
+	var average sql.NullFloat64
+	err = s.db.QueryRow(`
+		SELECT MIN(timestamp), MAX(timestamp),
+			AVG(length(headers) + COALESCE(length(body), 0) + COALESCE(length(response), 0)),
+			COUNT(deleted_at)
+		FROM requests
+	`).Scan(&oldest, &newest, &average, &stats.TrashedRequests)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query requests: %w", err)
+	}
+	stats.OldestRequest = oldest.String
+	stats.NewestRequest = newest.String
+	stats.AverageRequestBytes = int64(average.Float64)
+
+	if stats.Tables, err = s.tableRows(); err != nil {
+		return nil, err
+	}
+	for _, table := range stats.Tables {
+		if table.Name == "requests" {
+			stats.Requests = table.Rows
+		}
+	}
+	if stats.Indexes, stats.FullScans, err = s.indexUsage(); err != nil {
+		return nil, err
+	}
+
+	dedup := &stats.Dedup
+	err = s.db.QueryRow("SELECT COUNT(*), COALESCE(SUM(bytes), 0), COALESCE(SUM(length(data)), 0) FROM body_segments").
+		Scan(&dedup.Segments, &dedup.SegmentBytes, &dedup.StoredBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query body segments: %w", err)
+	}
+	err = s.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(s.bytes), 0)
+		FROM request_segments r JOIN body_segments s ON s.hash = r.hash
+	`).Scan(&dedup.References, &dedup.ReferencedBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query body segment references: %w", err)
+	}
+	dedup.SavedBytes = dedup.ReferencedBytes - dedup.SegmentBytes
+	return stats, nil
+}
+
+// databaseSizes measures the database file, its free pages and its
+// write-ahead log
+func (s *sqliteStorageService) databaseSizes() (model.DatabaseSizes, error) {
+	var sizes model.DatabaseSizes
+	var pageSize, pages, freePages int64
+	if err := s.db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return sizes, fmt.Errorf("failed to read page size: %w", err)
+	}
+	if err := s.db.QueryRow("PRAGMA page_count").Scan(&pages); err != nil {
+		return sizes, fmt.Errorf("failed to read page count: %w", err)
+	}
+	if err := s.db.QueryRow("PRAGMA freelist_count").Scan(&freePages); err != nil {
+		return sizes, fmt.Errorf("failed to read free pages: %w", err)
+	}
+	sizes.DatabaseBytes = pages * pageSize
+	sizes.FreeBytes = freePages * pageSize
+
+	// The in-memory driver has no file, and so no write-ahead log either
+	var seq int
+	var name, file string
+	if err := s.db.QueryRow("PRAGMA database_list").Scan(&seq, &name, &file); err != nil {
+		return sizes, fmt.Errorf("failed to read database file: %w", err)
+	}
+	if file != "" {
+		if info, err := os.Stat(file + "-wal"); err == nil {
+			sizes.WALBytes = info.Size()
+		}
+	}
+	return sizes, nil
+}
+
+// tableRows counts the rows of every table, as listed by GetSchema
+func (s *sqliteStorageService) tableRows() ([]model.TableStats, error) {
+	rows, err := s.db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	var tables []model.TableStats
+	for rows.Next() {
+		var table model.TableStats
+		if err := rows.Scan(&table.Name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+
+	for i := range tables {
+		if err := s.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %q", tables[i].Name)).Scan(&tables[i].Rows); err != nil {
+			return nil, fmt.Errorf("failed to count rows of %s: %w", tables[i].Name, err)
+		}
+	}
+	return tables, nil
+}
+
+// indexUsage lists the indexes with the planned queries that use each, and
+// the planned queries that scan a whole table instead
+func (s *sqliteStorageService) indexUsage() ([]model.IndexStats, []string, error) {
+	rows, err := s.db.Query("SELECT name, tbl_name FROM sqlite_master WHERE type = 'index' AND sql IS NOT NULL ORDER BY tbl_name, name")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+	var indexes []model.IndexStats
+	for rows.Next() {
+		index := model.IndexStats{Queries: []string{}}
+		if err := rows.Scan(&index.Name, &index.Table); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("failed to scan index: %w", err)
+		}
+		indexes = append(indexes, index)
+	}
+	rows.Close()
+
+	for i := range indexes {
+		columns, err := s.db.Query(fmt.Sprintf("PRAGMA index_info(%q)", indexes[i].Name))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to inspect index %s: %w", indexes[i].Name, err)
+		}
+		for columns.Next() {
+			var seqno, cid int
+			var column sql.NullString
+			if err := columns.Scan(&seqno, &cid, &column); err != nil {
+				columns.Close()
+				return nil, nil, fmt.Errorf("failed to inspect index %s: %w", indexes[i].Name, err)
+			}
+			indexes[i].Columns = append(indexes[i].Columns, column.String)
+		}
+		columns.Close()
+	}
+
+	fullScans := []string{}
+	for _, planned := range plannedQueries {
+		plan, err := s.queryPlan(planned.query)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, step := range plan {
+			if match := planIndexPattern.FindStringSubmatch(step); match != nil {
+				for i := range indexes {
+					if indexes[i].Name == match[1] {
+						indexes[i].Queries = append(indexes[i].Queries, planned.name)
+					}
+				}
+			} else if strings.HasPrefix(step, "SCAN ") {
+				fullScans = append(fullScans, planned.name)
+			}
+		}
+	}
+	return indexes, fullScans, nil
+}
+
+// queryPlan returns the steps SQLite would take to run query
+func (s *sqliteStorageService) queryPlan(query string) ([]string, error) {
+	rows, err := s.db.Query("EXPLAIN QUERY PLAN " + query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan query: %w", err)
+	}
+	defer rows.Close()
+
+	var steps []string
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			return nil, fmt.Errorf("failed to plan query: %w", err)
+		}
+		steps = append(steps, detail)
+	}
+	return steps, rows.Err()
+}
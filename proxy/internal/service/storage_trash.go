@@ -0,0 +1,91 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// trashRequests moves the stored requests matching where to the trash, where
+// they're hidden from everything but the trash until restored or purged
+func (s *sqliteStorageService) trashRequests(where string, args ...interface{}) (int, error) {
+	visible, visibleArgs := s.visible()
+	result, err := s.db.Exec("UPDATE requests SET deleted_at = ? WHERE "+visible+" AND ("+where+")",
+		queryArgs([]interface{}{time.Now().Format(time.RFC3339)}, visibleArgs, args)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to move requests to the trash: %w", err)
+	}
+	trashed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return int(trashed), nil
+}
+
+// GetTrash returns the requests in the trash, most recently deleted first
+func (s *sqliteStorageService) GetTrash(page, limit int) ([]model.RequestLog, int, error) {
+	scope, scopeArgs := s.tenantScope()
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM requests WHERE deleted_at IS NOT NULL"+scope, scopeArgs...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count trashed requests: %w", err)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT `+requestColumns+`
+		FROM requests
+		WHERE deleted_at IS NOT NULL`+scope+`
+		ORDER BY datetime(deleted_at) DESC, timestamp DESC
+		LIMIT ? OFFSET ?
+	`, queryArgs(scopeArgs, []interface{}{limit, (page - 1) * limit})...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query trashed requests: %w", err)
+	}
+	defer rows.Close()
+
+	requests := []model.RequestLog{}
+	for rows.Next() {
+		req, err := s.scanRequest(rows)
+		if err != nil {
+			// Error scanning row - skip
+			continue
+		}
+		requests = append(requests, *req)
+	}
+	return requests, total, rows.Err()
+}
+
+// RestoreRequests takes the requests with the given IDs out of the trash, or
+// every request in it when ids is empty, returning how many were restored
+func (s *sqliteStorageService) RestoreRequests(ids []string) (int, error) {
+	scope, args := s.tenantScope()
+	query := "UPDATE requests SET deleted_at = NULL WHERE deleted_at IS NOT NULL" + scope
+	if len(ids) > 0 {
+		query += " AND id IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ") + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to restore requests: %w", err)
+	}
+	restored, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return int(restored), nil
+}
+
+// PurgeTrash deletes the requests moved to the trash before cutoff for good,
+// or every request in it when cutoff is zero
+func (s *sqliteStorageService) PurgeTrash(cutoff time.Time) (int, error) {
+	scope, scopeArgs := s.tenantScope()
+	if cutoff.IsZero() {
+		return s.deleteRequests("deleted_at IS NOT NULL"+scope, scopeArgs...)
+	}
+	return s.deleteRequests("deleted_at IS NOT NULL AND datetime(deleted_at) < datetime(?)"+scope,
+		queryArgs([]interface{}{sqliteTime(cutoff)}, scopeArgs)...)
+}
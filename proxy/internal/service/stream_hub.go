@@ -0,0 +1,151 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// observerBuffer is how many chunks an observer may fall behind before it is
+// dropped
+const observerBuffer = 256
+
+// StreamHub lets the dashboard watch streaming responses while they are
+// forwarded to the client. The handler publishes every SSE line of a response
+// to its stream; an observer gets the lines sent so far and then the rest as
+// they arrive. Observers never hold up the client: one that falls too far
+// behind is disconnected.
+type StreamHub struct {
+	mu      sync.Mutex
+	streams map[string]*LiveStream
+}
+
+// LiveStream is the fan-out of one streaming response
+type LiveStream struct {
+	requestID string
+	model     string
+	startedAt time.Time
+
+	mu        sync.Mutex
+	lines     []string
+	observers map[chan string]struct{}
+	done      bool
+}
+
+func NewStreamHub() *StreamHub {
+	return &StreamHub{streams: make(map[string]*LiveStream)}
+}
+
+// Start registers a streaming response so observers can attach to it
+func (h *StreamHub) Start(requestID, model string) *LiveStream {
+	stream := &LiveStream{
+		requestID: requestID,
+		model:     model,
+		startedAt: time.Now(),
+		observers: make(map[chan string]struct{}),
+	}
+	h.mu.Lock()
+	h.streams[requestID] = stream
+	h.mu.Unlock()
+	return stream
+}
+
+// Finish ends a stream, disconnecting its observers
+func (h *StreamHub) Finish(stream *LiveStream) {
+	h.mu.Lock()
+	if h.streams[stream.requestID] == stream {
+		delete(h.streams, stream.requestID)
+	}
+	h.mu.Unlock()
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	stream.done = true
+	for ch := range stream.observers {
+		close(ch)
+	}
+	stream.observers = nil
+}
+
+// Observe attaches to the stream of a request. It returns the lines sent so
+// far and a channel with the ones that follow, which is closed when the
+// response ends or the observer falls behind; cancel detaches early. ok is
+// false if the request isn't streaming.
+func (h *StreamHub) Observe(requestID string) (lines []string, updates <-chan string, cancel func(), ok bool) {
+	h.mu.Lock()
+	stream := h.streams[requestID]
+	h.mu.Unlock()
+	if stream == nil {
+		return nil, nil, nil, false
+	}
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	if stream.done {
+		return nil, nil, nil, false
+	}
+	ch := make(chan string, observerBuffer)
+	stream.observers[ch] = struct{}{}
+	cancel = func() {
+		stream.mu.Lock()
+		defer stream.mu.Unlock()
+		if _, ok := stream.observers[ch]; ok {
+			delete(stream.observers, ch)
+			close(ch)
+		}
+	}
+	return append([]string(nil), stream.lines...), ch, cancel, true
+}
+
+// Active returns the responses currently streaming, oldest first
+func (h *StreamHub) Active() []model.LiveStream {
+	h.mu.Lock()
+	streams := make([]*LiveStream, 0, len(h.streams))
+	for _, stream := range h.streams {
+		streams = append(streams, stream)
+	}
+	h.mu.Unlock()
+	sort.Slice(streams, func(i, j int) bool { return streams[i].startedAt.Before(streams[j].startedAt) })
+
+	active := make([]model.LiveStream, 0, len(streams))
+	for _, stream := range streams {
+		stream.mu.Lock()
+		active = append(active, model.LiveStream{
+			RequestID: stream.requestID,
+			Model:     stream.model,
+			StartedAt: stream.startedAt.Format(time.RFC3339),
+			Chunks:    len(stream.lines),
+			Observers: len(stream.observers),
+		})
+		stream.mu.Unlock()
+	}
+	return active
+}
+
+// Publish sends an SSE line to the stream's observers
+func (s *LiveStream) Publish(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return
+	}
+	s.lines = append(s.lines, line)
+	for ch := range s.observers {
+		select {
+		case ch <- line:
+		default:
+			// Too far behind; the observer can reattach and replay
+			delete(s.observers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Streaming reports whether the response to a request is still streaming
+func (h *StreamHub) Streaming(requestID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.streams[requestID] != nil
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestStreamHub(t *testing.T) {
+	t.Run("Observers get the replay and live chunks", func(t *testing.T) {
+		hub := NewStreamHub()
+		stream := hub.Start("req_1", "claude-sonnet-4-20250514")
+		stream.Publish("data: one")
+
+		lines, updates, cancel, ok := hub.Observe("req_1")
+		if !ok {
+			t.Fatal("Observe() = false for a streaming request")
+		}
+		defer cancel()
+		if len(lines) != 1 || lines[0] != "data: one" {
+			t.Errorf("replay = %v, want [data: one]", lines)
+		}
+
+		stream.Publish("data: two")
+		if line := <-updates; line != "data: two" {
+			t.Errorf("update = %q, want data: two", line)
+		}
+
+		active := hub.Active()
+		if len(active) != 1 || active[0].RequestID != "req_1" || active[0].Chunks != 2 || active[0].Observers != 1 {
+			t.Errorf("Active() = %+v", active)
+		}
+
+		hub.Finish(stream)
+		if _, open := <-updates; open {
+			t.Error("updates still open after Finish()")
+		}
+		if hub.Streaming("req_1") || len(hub.Active()) != 0 {
+			t.Error("stream still listed after Finish()")
+		}
+		if _, _, _, ok := hub.Observe("req_1"); ok {
+			t.Error("Observe() = true after Finish()")
+		}
+	})
+
+	t.Run("Slow observers are dropped", func(t *testing.T) {
+		hub := NewStreamHub()
+		stream := hub.Start("req_2", "claude-sonnet-4-20250514")
+		_, updates, cancel, _ := hub.Observe("req_2")
+		defer cancel()
+
+		// Nobody reads, so publishing past the buffer must not block
+		for i := 0; i < observerBuffer+1; i++ {
+			stream.Publish("data: {}")
+		}
+		received := 0
+		for range updates {
+			received++
+		}
+		if received != observerBuffer {
+			t.Errorf("received %d chunks before being dropped, want %d", received, observerBuffer)
+		}
+		if !hub.Streaming("req_2") {
+			t.Error("dropping an observer ended the stream")
+		}
+	})
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// Subagent detection strategies (see config.SubagentsConfig)
+const (
+	DetectByHash         = "hash"
+	DetectByPrefix       = "prefix"
+	DetectBySubagentType = "subagent_type"
+)
+
+// taskToolName is the Claude Code tool that starts subagents
+const taskToolName = "Task"
+
+const (
+	// taskPromptTTL is how long a Task call is remembered; the subagent's
+	// requests start right after it, but can run for a while
+	taskPromptTTL = 30 * time.Minute
+	// maxTaskPrompts bounds the Task calls remembered at once
+	maxTaskPrompts = 1000
+)
+
+// compileDetection returns the known strategies in detection, in order
+func compileDetection(detection []string) ([]string, []string) {
+	var strategies, unknown []string
+	for _, strategy := range detection {
+		strategy = strings.ToLower(strings.TrimSpace(strategy))
+		switch strategy {
+		case DetectByHash, DetectByPrefix, DetectBySubagentType:
+			strategies = append(strategies, strategy)
+		case "":
+		default:
+			unknown = append(unknown, strategy)
+		}
+	}
+	if len(strategies) == 0 {
+		strategies = []string{DetectByHash}
+	}
+	return strategies, unknown
+}
+
+// detectSubagent tries each configured strategy in turn and returns the agent
+// req comes from, with a description of how it was recognized. hash is the
+// request's subagent prompt hash, if it has the subagent shape.
+func (r *ModelRouter) detectSubagent(req *model.AnthropicRequest, hash string) (SubagentDefinition, string, bool) {
+	for _, strategy := range r.detection {
+		switch strategy {
+		case DetectByHash:
+			if hash == "" {
+				continue
+			}
+			if definition, ok := r.agentForHash(hash); ok {
+				return definition, fmt.Sprintf("prompt hash %s matches agent %q", hash, definition.Name), true
+			}
+
+		case DetectByPrefix:
+			if definition, ok := r.agentForPrefix(req); ok {
+				return definition, fmt.Sprintf("prompt prefix matches agent %q", definition.Name), true
+			}
+
+		case DetectBySubagentType:
+			if subagentType, ok := r.taskPrompts.lookup(req); ok {
+				if definition, ok := r.agentForName(subagentType); ok {
+					return definition, fmt.Sprintf("started by a Task call with subagent_type %q", subagentType), true
+				}
+			}
+		}
+	}
+	return SubagentDefinition{}, "", false
+}
+
+func (r *ModelRouter) detects(strategy string) bool {
+	for _, s := range r.detection {
+		if s == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+// agentForPrefix finds the agent whose prompt starts a system message of req,
+// comparing the first PrefixLength characters with whitespace collapsed. This
+// survives Claude Code appending or changing dynamic sections of the prompt.
+func (r *ModelRouter) agentForPrefix(req *model.AnthropicRequest) (SubagentDefinition, bool) {
+	if len(req.System) == 0 {
+		return SubagentDefinition{}, false
+	}
+
+	for _, definition := range r.sortedAgents() {
+		prefix := truncateRunes(normalizeWhitespace(definition.FullPrompt), r.config.Subagents.PrefixLength)
+		if prefix == "" {
+			continue
+		}
+		for _, system := range req.System {
+			if strings.HasPrefix(normalizeWhitespace(system.Text), prefix) {
+				return definition, true
+			}
+		}
+	}
+	return SubagentDefinition{}, false
+}
+
+// agentForName finds the agent with the given frontmatter or mapping name
+func (r *ModelRouter) agentForName(name string) (SubagentDefinition, bool) {
+	for _, definition := range r.sortedAgents() {
+		if definition.AgentName == name || definition.Name == name {
+			return definition, true
+		}
+	}
+	return SubagentDefinition{}, false
+}
+
+// sortedAgents returns the loaded agents ordered by name, so overlapping
+// matches resolve the same way every time
+func (r *ModelRouter) sortedAgents() []SubagentDefinition {
+	r.agentsMu.RLock()
+	definitions := make([]SubagentDefinition, 0, len(r.customAgentPrompts))
+	for _, definition := range r.customAgentPrompts {
+		definitions = append(definitions, definition)
+	}
+	r.agentsMu.RUnlock()
+
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].Name < definitions[j].Name })
+	return definitions
+}
+
+// ObserveToolCalls remembers the Task calls in a response, so the requests of
+// the subagents they start can be recognized by their first message
+func (r *ModelRouter) ObserveToolCalls(blocks []model.ContentBlock) {
+	if !r.detects(DetectBySubagentType) {
+		return
+	}
+	for _, block := range blocks {
+		if block.Type != "tool_use" || block.Name != taskToolName {
+			continue
+		}
+		var input struct {
+			SubagentType string `json:"subagent_type"`
+			Prompt       string `json:"prompt"`
+		}
+		if err := json.Unmarshal(block.Input, &input); err != nil || input.SubagentType == "" || input.Prompt == "" {
+			continue
+		}
+		r.taskPrompts.add(input.Prompt, input.SubagentType)
+	}
+}
+
+// taskPromptCache maps the prompts of recent Task calls to their subagent_type
+type taskPromptCache struct {
+	mu      sync.Mutex
+	entries map[string]taskPrompt // normalized prompt -> call
+}
+
+type taskPrompt struct {
+	subagentType string
+	seen         time.Time
+}
+
+func newTaskPromptCache() *taskPromptCache {
+	return &taskPromptCache{entries: make(map[string]taskPrompt)}
+}
+
+func (c *taskPromptCache) add(prompt, subagentType string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= maxTaskPrompts {
+		var oldestKey string
+		var oldest time.Time
+		for key, entry := range c.entries {
+			if now.Sub(entry.seen) > taskPromptTTL {
+				delete(c.entries, key)
+				continue
+			}
+			if oldestKey == "" || entry.seen.Before(oldest) {
+				oldestKey, oldest = key, entry.seen
+			}
+		}
+		if len(c.entries) >= maxTaskPrompts {
+			delete(c.entries, oldestKey)
+		}
+	}
+	c.entries[normalizeWhitespace(prompt)] = taskPrompt{subagentType: subagentType, seen: now}
+}
+
+// lookup returns the subagent_type of the Task call whose prompt is a text
+// block of req's first message
+func (c *taskPromptCache) lookup(req *model.AnthropicRequest) (string, bool) {
+	if len(req.Messages) == 0 {
+		return "", false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, block := range req.Messages[0].GetContentBlocks() {
+		if block.Type != "text" {
+			continue
+		}
+		entry, ok := c.entries[normalizeWhitespace(block.Text)]
+		if ok && time.Since(entry.seen) <= taskPromptTTL {
+			return entry.subagentType, true
+		}
+	}
+	return "", false
+}
+
+// loadAgentFile reads the first agent definition found at paths
+func loadAgentFile(paths []string, fallbackName string) (SubagentDefinition, bool) {
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if definition, ok := parseAgentFile(content); ok {
+			if definition.AgentName == "" {
+				definition.AgentName = fallbackName
+			}
+			return definition, true
+		}
+	}
+	return SubagentDefinition{}, false
+}
+
+// findAgentByName looks through the agent directories for a definition whose
+// frontmatter name is name
+func findAgentByName(name string) (SubagentDefinition, bool) {
+	for _, dir := range agentDirs() {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.md"))
+		for _, file := range files {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				continue
+			}
+			if definition, ok := parseAgentFile(content); ok && definition.AgentName == name {
+				return definition, true
+			}
+		}
+	}
+	return SubagentDefinition{}, false
+}
+
+// parseAgentFile splits an agent file (frontmatter\n---\nsystem prompt) into
+// its frontmatter name and prompt
+func parseAgentFile(content []byte) (SubagentDefinition, bool) {
+	parts := strings.Split(string(content), "\n---\n")
+	if len(parts) < 2 {
+		return SubagentDefinition{}, false
+	}
+
+	var frontmatter struct {
+		Name string `yaml:"name"`
+	}
+	yaml.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(parts[0]), "---")), &frontmatter)
+
+	return SubagentDefinition{
+		AgentName:  frontmatter.Name,
+		FullPrompt: strings.TrimSpace(parts[1]),
+	}, true
+}
+
+func normalizeWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func truncateRunes(s string, n int) string {
+	if n <= 0 {
+		return s
+	}
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
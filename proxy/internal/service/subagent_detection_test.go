@@ -0,0 +1,109 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func TestModelRouter_SubagentDetection(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	agents := filepath.Join(home, ".claude", "agents")
+	if err := os.MkdirAll(agents, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// The file name differs from the frontmatter name the mapping uses
+	reviewerPrompt := "You are a meticulous code reviewer. Read the diff carefully and point out bugs, missing tests and unclear names."
+	agentFile := "---\nname: reviewer\ndescription: Reviews code\n---\n" + reviewerPrompt + "\n\nNotes:\n- be kind\n"
+	if err := os.WriteFile(filepath.Join(agents, "code-review.md"), []byte(agentFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+		"openai":    &stubProvider{name: "openai"},
+	}
+	newRouter := func(detection ...string) *ModelRouter {
+		cfg := &config.Config{
+			Subagents: config.SubagentsConfig{
+				Enable:       true,
+				Mappings:     map[string]string{"reviewer": "gpt-4o"},
+				Detection:    detection,
+				PrefixLength: 40,
+			},
+		}
+		return NewModelRouter(cfg, providers, log.New(io.Discard, "", 0))
+	}
+
+	request := func(system []string, text string) *model.AnthropicRequest {
+		req := &model.AnthropicRequest{
+			Model:    "claude-sonnet-4",
+			Messages: []model.AnthropicMessage{{Role: "user", Content: text}},
+		}
+		for _, s := range system {
+			req.System = append(req.System, model.AnthropicSystemMessage{Text: s})
+		}
+		return req
+	}
+	taskPrompt := "Review the changes in handlers.go"
+	taskCall := func() []model.ContentBlock {
+		input, _ := json.Marshal(map[string]string{"subagent_type": "reviewer", "prompt": taskPrompt})
+		return []model.ContentBlock{{Type: "tool_use", Name: "Task", Input: input}}
+	}
+
+	// Claude Code added a dynamic section and rewrapped the prompt, so its
+	// hash no longer matches
+	tweaked := strings.Replace(reviewerPrompt, "carefully and", "carefully\nand", 1) + "\n\nToday is Tuesday."
+
+	tests := []struct {
+		name          string
+		detection     []string
+		request       *model.AnthropicRequest
+		observe       bool
+		expectedAgent string
+		expectedVia   string
+	}{
+		{"Hash matches the unchanged prompt", []string{"hash"}, request([]string{"You are Claude Code.", reviewerPrompt}, taskPrompt), false, "reviewer", "prompt hash"},
+		{"Hash misses a tweaked prompt", []string{"hash"}, request([]string{"You are Claude Code.", tweaked}, taskPrompt), false, "", ""},
+		{"Prefix matches a tweaked prompt", []string{"hash", "prefix"}, request([]string{"You are Claude Code.", tweaked}, taskPrompt), false, "reviewer", "prompt prefix"},
+		{"Prefix misses another prompt", []string{"prefix"}, request([]string{"You are Claude Code.", "You plan work."}, taskPrompt), false, "", ""},
+		{"Task call matches the first message", []string{"subagent_type"}, request([]string{"You are Claude Code.", "Anything at all."}, taskPrompt), true, "reviewer", `subagent_type "reviewer"`},
+		{"No Task call seen", []string{"subagent_type"}, request([]string{"You are Claude Code.", "Anything at all."}, taskPrompt), false, "", ""},
+		{"Unknown strategies fall back to hash", []string{"telepathy"}, request([]string{"You are Claude Code.", reviewerPrompt}, taskPrompt), false, "reviewer", "prompt hash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newRouter(tt.detection...)
+			if tt.observe {
+				router.ObserveToolCalls(taskCall())
+			}
+
+			decision, err := router.DetermineRoute(tt.request)
+			if err != nil {
+				t.Fatalf("DetermineRoute() returned error: %v", err)
+			}
+			if decision.Explanation.Subagent != tt.expectedAgent {
+				t.Fatalf("Subagent = %q, want %q", decision.Explanation.Subagent, tt.expectedAgent)
+			}
+			if tt.expectedAgent == "" {
+				return
+			}
+			if decision.TargetModel != "gpt-4o" {
+				t.Errorf("TargetModel = %q, want gpt-4o", decision.TargetModel)
+			}
+			if !strings.Contains(decision.Explanation.Detail, tt.expectedVia) {
+				t.Errorf("Detail = %q, want it to contain %q", decision.Explanation.Detail, tt.expectedVia)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/i18n"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// FormatSummary renders stats as aligned plain text for terminals and screen
+// readers: totals, then one row per model, per provider and, when usage was
+// ingested, per source. Columns are padded
+// with spaces, never tabs or box-drawing characters.
+func FormatSummary(catalog *i18n.Catalog, language string, stats *model.UsageStats, start, end time.Time) string {
+	t := func(message string) string { return catalog.Translate(language, message) }
+
+	var b strings.Builder
+	b.WriteString(catalog.Sprintf(language, "Usage from %s to %s",
+		start.Format("2006-01-02 15:04"), end.Format("2006-01-02 15:04")) + "\n\n")
+
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\t%d\n", t("Requests"), stats.Requests)
+	fmt.Fprintf(tw, "%s\t%d\n", t("Errors"), stats.Errors)
+	fmt.Fprintf(tw, "%s\t%d ms\n", t("Average response time"), stats.AvgResponseTime)
+	if stats.AvgTimeToFirstToken > 0 {
+		fmt.Fprintf(tw, "%s\t%d ms\n", t("Average time to first token"), stats.AvgTimeToFirstToken)
+	}
+	if stats.AvgTokensPerSecond > 0 {
+		fmt.Fprintf(tw, "%s\t%.1f tokens/s\n", t("Average output speed"), stats.AvgTokensPerSecond)
+	}
+	fmt.Fprintf(tw, "%s\t%d\n", t("Input tokens"), stats.InputTokens)
+	fmt.Fprintf(tw, "%s\t%d\n", t("Output tokens"), stats.OutputTokens)
+	fmt.Fprintf(tw, "%s\t%d\n", t("Cache read tokens"), stats.CacheReadTokens)
+	fmt.Fprintf(tw, "%s\t%d\n", t("Cache write tokens"), stats.CacheCreationTokens)
+	fmt.Fprintf(tw, "%s\t%s\n", t("Sent"), formatBytes(stats.RequestWireBytes))
+	fmt.Fprintf(tw, "%s\t%s\n", t("Received"), formatBytes(stats.ResponseWireBytes))
+	tw.Flush()
+
+	if len(stats.Models) > 0 {
+		b.WriteString("\n")
+		tw = tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", t("Model"), t("Requests"), t("Errors"), t("Input tokens"), t("Output tokens"))
+		for _, m := range stats.Models {
+			name := m.Model
+			if name == "" {
+				name = t("(unknown)")
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", name, m.Requests, m.Errors, m.InputTokens, m.OutputTokens)
+		}
+		tw.Flush()
+	}
+
+	if len(stats.Providers) > 0 {
+		b.WriteString("\n")
+		tw = tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", t("Provider"), t("Requests"), t("Sent"), t("Received"))
+		for _, p := range stats.Providers {
+			name := p.Provider
+			if name == "" {
+				name = t("(unknown)")
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", name, p.Requests, formatBytes(p.RequestWireBytes), formatBytes(p.ResponseWireBytes))
+		}
+		tw.Flush()
+	}
+
+	// Only worth a table when usage was ingested from outside the proxy
+	if len(stats.Sources) > 1 || (len(stats.Sources) == 1 && stats.Sources[0].Source != model.UsageSourceProxy) {
+		b.WriteString("\n")
+		tw = tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", t("Source"), t("Requests"), t("Input tokens"), t("Output tokens"))
+		for _, s := range stats.Sources {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", s.Source, s.Requests, s.InputTokens, s.OutputTokens)
+		}
+		tw.Flush()
+	}
+
+	return b.String()
+}
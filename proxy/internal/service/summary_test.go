@@ -0,0 +1,65 @@
+package service
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/i18n"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestFormatSummary(t *testing.T) {
+	catalog, err := i18n.Load("en", "", log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+
+	stats := &model.UsageStats{
+		Requests: 12,
+		Errors:   1,
+		Models: []model.ModelUsage{
+			{Model: "claude-sonnet-4", Requests: 10, InputTokens: 1500, OutputTokens: 300},
+			{Model: "gpt-4o", Requests: 2, Errors: 1, InputTokens: 20, OutputTokens: 5},
+		},
+		Providers: []model.ProviderUsage{{Provider: "anthropic", Requests: 10, Bandwidth: model.Bandwidth{RequestWireBytes: 2048}}},
+	}
+	start := time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 3, 4, 15, 30, 0, 0, time.UTC)
+
+	summary := FormatSummary(catalog, "en", stats, start, end)
+	lines := strings.Split(summary, "\n")
+
+	if lines[0] != "Usage from 2025-03-04 00:00 to 2025-03-04 15:30" {
+		t.Errorf("unexpected heading %q", lines[0])
+	}
+	if strings.Contains(summary, "\t") {
+		t.Error("summary should be padded with spaces, not tabs")
+	}
+
+	// Values in a table start in the same column
+	var header, sonnet, gpt string
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "Model "):
+			header = line
+		case strings.HasPrefix(line, "claude-sonnet-4 "):
+			sonnet = line
+		case strings.HasPrefix(line, "gpt-4o "):
+			gpt = line
+		}
+	}
+	column := strings.Index(header, "Requests")
+	if column < 0 || !strings.HasPrefix(sonnet[column:], "10 ") || !strings.HasPrefix(gpt[column:], "2 ") {
+		t.Errorf("model table is not aligned:\n%s\n%s\n%s", header, sonnet, gpt)
+	}
+	if !strings.Contains(summary, "2.0 KiB") {
+		t.Errorf("expected provider bandwidth in the summary:\n%s", summary)
+	}
+
+	if german := FormatSummary(catalog, "de", stats, start, end); !strings.Contains(german, "Anfragen") {
+		t.Errorf("expected a German summary:\n%s", german)
+	}
+}
@@ -0,0 +1,364 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// SyntheticOptions shapes the data GenerateSynthetic writes. Models maps
+// requested models to relative weights.
+type SyntheticOptions struct {
+	Sessions     int
+	MaxTurns     int // requests per conversation are spread over 1..MaxTurns
+	Days         int // sessions start within the last Days days
+	Models       map[string]int
+	ErrorRate    float64
+	StreamRate   float64
+	SubagentRate float64 // share of sessions that are Task subagents
+	Seed         int64
+	Now          time.Time
+}
+
+// DefaultSyntheticOptions is a couple of weeks of one developer's traffic
+func DefaultSyntheticOptions() SyntheticOptions {
+	return SyntheticOptions{
+		Sessions: 60,
+		MaxTurns: 20,
+		Days:     14,
+		Models: map[string]int{
+			"claude-sonnet-4-20250514":  6,
+			"claude-3-5-haiku-20241022": 3,
+			"claude-opus-4-20250514":    1,
+		},
+		ErrorRate:    0.03,
+		StreamRate:   0.8,
+		SubagentRate: 0.2,
+		Seed:         1,
+	}
+}
+
+// SyntheticSummary counts what GenerateSynthetic wrote
+type SyntheticSummary struct {
+	Sessions int
+	Requests int
+	Errors   int
+}
+
+// GenerateSynthetic fills storage with made-up Claude Code conversations:
+// multi-turn sessions whose requests carry the growing message history, tool
+// calls and results, token usage, streaming and error responses. Everything is
+// built from a fixed vocabulary, so nothing real ends up in the database. The
+// same options and seed produce the same data.
+func GenerateSynthetic(storage StorageService, opts SyntheticOptions) (SyntheticSummary, error) {
+	var summary SyntheticSummary
+	if opts.Sessions <= 0 || opts.MaxTurns <= 0 || opts.Days <= 0 {
+		return summary, fmt.Errorf("sessions, max turns and days must be positive")
+	}
+	models, err := newWeightedModels(opts.Models)
+	if err != nil {
+		return summary, err
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	g := &syntheticGenerator{rng: rand.New(rand.NewSource(opts.Seed)), opts: opts}
+	for i := 0; i < opts.Sessions; i++ {
+		requests := g.session(models.pick(g.rng))
+		for _, request := range requests {
+			if _, err := storage.SaveRequest(request); err != nil {
+				return summary, err
+			}
+			if err := storage.UpdateRequestWithResponse(request); err != nil {
+				return summary, err
+			}
+			summary.Requests++
+			if request.Response.StatusCode >= 400 {
+				summary.Errors++
+			}
+		}
+		summary.Sessions++
+	}
+	return summary, nil
+}
+
+type weightedModels struct {
+	names   []string
+	weights []int
+	total   int
+}
+
+func newWeightedModels(models map[string]int) (*weightedModels, error) {
+	w := &weightedModels{}
+	for name := range models {
+		w.names = append(w.names, name)
+	}
+	// Sorted so a seed always maps to the same picks
+	sort.Strings(w.names)
+	for _, name := range w.names {
+		if models[name] < 0 {
+			return nil, fmt.Errorf("model %s has a negative weight", name)
+		}
+		w.weights = append(w.weights, models[name])
+		w.total += models[name]
+	}
+	if w.total == 0 {
+		return nil, fmt.Errorf("at least one model needs a positive weight")
+	}
+	return w, nil
+}
+
+func (w *weightedModels) pick(rng *rand.Rand) string {
+	n := rng.Intn(w.total)
+	for i, weight := range w.weights {
+		if n < weight {
+			return w.names[i]
+		}
+		n -= weight
+	}
+	return w.names[len(w.names)-1]
+}
+
+// Vocabulary the synthetic conversations are assembled from
+var (
+	syntheticAreas   = []string{"billing", "inventory", "search", "auth", "reports", "notifications", "checkout", "profile"}
+	syntheticTasks   = []string{"Add pagination to the %s endpoint", "Fix the flaky test in the %s package", "Refactor the %s service to use the new client", "Why does the %s page load slowly?", "Write tests for the %s handlers", "Rename the %s config options"}
+	syntheticReplies = []string{"I'll start by looking at how %s is structured.", "The %s code builds the query twice; caching it should help.", "Done. The %s changes compile and the tests pass.", "I found the issue in %s: the retry loop never resets its counter."}
+	syntheticAgents  = []string{"code-reviewer", "test-runner", "doc-writer"}
+	syntheticTools   = []model.Tool{
+		{Name: "Read", Description: "Read a file", InputSchema: model.InputSchema{Type: "object", Properties: map[string]interface{}{"file_path": map[string]string{"type": "string"}}, Required: []string{"file_path"}}},
+		{Name: "Edit", Description: "Edit a file", InputSchema: model.InputSchema{Type: "object", Properties: map[string]interface{}{"file_path": map[string]string{"type": "string"}, "old_string": map[string]string{"type": "string"}, "new_string": map[string]string{"type": "string"}}, Required: []string{"file_path", "old_string", "new_string"}}},
+		{Name: "Bash", Description: "Run a shell command", InputSchema: model.InputSchema{Type: "object", Properties: map[string]interface{}{"command": map[string]string{"type": "string"}}, Required: []string{"command"}}},
+		{Name: "Grep", Description: "Search file contents", InputSchema: model.InputSchema{Type: "object", Properties: map[string]interface{}{"pattern": map[string]string{"type": "string"}}, Required: []string{"pattern"}}},
+		{Name: "Task", Description: "Start a subagent", InputSchema: model.InputSchema{Type: "object", Properties: map[string]interface{}{"subagent_type": map[string]string{"type": "string"}, "prompt": map[string]string{"type": "string"}}, Required: []string{"subagent_type", "prompt"}}},
+	}
+	syntheticErrors = []struct {
+		status    int
+		errorType string
+		message   string
+	}{
+		{529, "overloaded_error", "Overloaded"},
+		{429, "rate_limit_error", "Number of request tokens has exceeded your per-minute rate limit"},
+		{500, "api_error", "Internal server error"},
+		{400, "invalid_request_error", "prompt is too long"},
+	}
+)
+
+type syntheticGenerator struct {
+	rng  *rand.Rand
+	opts SyntheticOptions
+}
+
+func (g *syntheticGenerator) choose(options []string) string {
+	return options[g.rng.Intn(len(options))]
+}
+
+func (g *syntheticGenerator) hex(n int) string {
+	const digits = "0123456789abcdef"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = digits[g.rng.Intn(len(digits))]
+	}
+	return string(b)
+}
+
+func (g *syntheticGenerator) uuid() string {
+	s := g.hex(32)
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// startTime picks a session start within the last Days days, mostly during
+// working hours
+func (g *syntheticGenerator) startTime() time.Time {
+	day := g.opts.Now.AddDate(0, 0, -g.rng.Intn(g.opts.Days))
+	hour := int(math.Round(g.rng.NormFloat64()*2.5 + 14))
+	if hour < 0 || hour > 23 {
+		hour = 14
+	}
+	start := time.Date(day.Year(), day.Month(), day.Day(), hour, g.rng.Intn(60), g.rng.Intn(60), 0, day.Location())
+	if start.After(g.opts.Now) {
+		start = g.opts.Now.Add(-time.Duration(g.rng.Intn(3600)) * time.Second)
+	}
+	return start
+}
+
+// session builds the requests of one conversation
+func (g *syntheticGenerator) session(requestedModel string) []*model.RequestLog {
+	area := g.choose(syntheticAreas)
+	userID := fmt.Sprintf("user_%s_account_%s_session_%s", g.hex(64), g.uuid(), g.uuid())
+	system := []model.AnthropicSystemMessage{
+		{Type: "text", Text: "You are Claude Code, Anthropic's official CLI for Claude."},
+		{Type: "text", Text: "You are an interactive CLI tool that helps users with software engineering tasks. (synthetic sandbox data)", CacheControl: &model.CacheControl{Type: "ephemeral"}},
+	}
+
+	turns := 1 + g.rng.Intn(g.opts.MaxTurns)
+	if strings.Contains(requestedModel, "haiku") {
+		// Haiku calls are mostly Claude Code's short background requests
+		turns = 1
+	}
+	if g.rng.Float64() < g.opts.SubagentRate {
+		system[1].Text = fmt.Sprintf("You are the %s agent. Do one focused job and report back. (synthetic sandbox data)", g.choose(syntheticAgents))
+	}
+
+	messages := []model.AnthropicMessage{{Role: "user", Content: fmt.Sprintf(g.choose(syntheticTasks), area)}}
+	at := g.startTime()
+	var requests []*model.RequestLog
+	for turn := 0; turn < turns; turn++ {
+		req := model.AnthropicRequest{
+			Model:     requestedModel,
+			Messages:  append([]model.AnthropicMessage(nil), messages...),
+			MaxTokens: 32000,
+			System:    system,
+			Stream:    g.rng.Float64() < g.opts.StreamRate,
+			Tools:     syntheticTools,
+			Metadata:  &model.RequestMetadata{UserID: userID},
+		}
+
+		last := turn == turns-1
+		request, reply := g.request(req, area, turn, last, at)
+		requests = append(requests, request)
+		if request.Response.StatusCode >= 400 {
+			// Claude Code retries the same request a little later
+			at = at.Add(time.Duration(2+g.rng.Intn(20)) * time.Second)
+			continue
+		}
+
+		messages = append(messages, model.AnthropicMessage{Role: "assistant", Content: reply})
+		if toolUse := reply[len(reply)-1]; toolUse.Type == "tool_use" {
+			messages = append(messages, model.AnthropicMessage{Role: "user", Content: []map[string]interface{}{{
+				"type":        "tool_result",
+				"tool_use_id": toolUse.ID,
+				"content":     fmt.Sprintf("(synthetic output of %s)", toolUse.Name),
+			}}})
+		}
+		at = at.Add(time.Duration(request.Response.ResponseTime)*time.Millisecond + time.Duration(1+g.rng.Intn(90))*time.Second)
+	}
+	return requests
+}
+
+// request builds one logged request and its response, returning the
+// assistant's reply so the conversation can continue
+func (g *syntheticGenerator) request(req model.AnthropicRequest, area string, turn int, last bool, at time.Time) (*model.RequestLog, []model.ContentBlock) {
+	bodyBytes, _ := json.Marshal(req)
+	request := &model.RequestLog{
+		RequestID: g.hex(16),
+		Timestamp: at.Format(time.RFC3339),
+		Method:    "POST",
+		Endpoint:  "/v1/messages",
+		Headers: map[string][]string{
+			"Content-Type":      {"application/json"},
+			"Anthropic-Version": {"2023-06-01"},
+			"User-Agent":        {"claude-cli/1.0.0 (external, cli)"},
+		},
+		Body:          req,
+		Model:         req.Model,
+		OriginalModel: req.Model,
+		RoutedModel:   req.Model,
+		Provider:      "anthropic",
+		SessionID:     SessionID(&req),
+		Routing: &model.RoutingExplanation{
+			Reason:   model.RouteReasonDefault,
+			Detail:   "no mapping or rule matched, using the requested model",
+			Provider: "anthropic",
+		},
+		UserAgent:        "claude-cli/1.0.0 (external, cli)",
+		ContentType:      "application/json",
+		RequestBytes:     int64(len(bodyBytes)),
+		RequestWireBytes: int64(len(bodyBytes)),
+	}
+
+	response := &model.ResponseLog{
+		Headers:     map[string][]string{"Content-Type": {"application/json"}},
+		IsStreaming: req.Stream,
+	}
+	request.Response = response
+
+	if g.rng.Float64() < g.opts.ErrorRate {
+		failure := syntheticErrors[g.rng.Intn(len(syntheticErrors))]
+		body, _ := json.Marshal(map[string]interface{}{
+			"type":  "error",
+			"error": map[string]string{"type": failure.errorType, "message": failure.message},
+		})
+		response.StatusCode = failure.status
+		response.Body = body
+		response.ResponseTime = int64(100 + g.rng.Intn(2000))
+		response.CompletedAt = at.Add(time.Duration(response.ResponseTime) * time.Millisecond).Format(time.RFC3339)
+		response.BodyBytes, response.WireBytes = int64(len(body)), int64(len(body))
+		return request, nil
+	}
+
+	var reply []model.ContentBlock
+	reply = append(reply, model.ContentBlock{Type: "text", Text: fmt.Sprintf(g.choose(syntheticReplies), area)})
+	stopReason := "end_turn"
+	if !last {
+		// Subagent sessions are generated on their own rather than from Task calls
+		tool := syntheticTools[g.rng.Intn(len(syntheticTools)-1)]
+		input, _ := json.Marshal(g.toolInput(tool.Name, area))
+		reply = append(reply, model.ContentBlock{Type: "tool_use", ID: "toolu_" + g.hex(24), Name: tool.Name, Input: input})
+		stopReason = "tool_use"
+	}
+
+	// Each turn adds to the history, most of which is read back from the cache
+	history := 4000 + turn*(800+g.rng.Intn(2500))
+	usage := model.AnthropicUsage{
+		InputTokens:  10 + g.rng.Intn(400),
+		OutputTokens: 40 + int(g.rng.ExpFloat64()*400),
+	}
+	if turn == 0 {
+		usage.CacheCreationInputTokens = history
+	} else {
+		usage.CacheReadInputTokens = history
+		usage.CacheCreationInputTokens = 200 + g.rng.Intn(1500)
+	}
+
+	content := make([]map[string]interface{}, 0, len(reply))
+	for _, block := range reply {
+		if block.Type == "text" {
+			content = append(content, map[string]interface{}{"type": "text", "text": block.Text})
+		} else if !req.Stream {
+			// Streamed responses are stored with their text only
+			content = append(content, map[string]interface{}{"type": "tool_use", "id": block.ID, "name": block.Name, "input": block.Input})
+		}
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":          "msg_" + g.hex(24),
+		"type":        "message",
+		"role":        "assistant",
+		"model":       req.Model,
+		"content":     content,
+		"stop_reason": stopReason,
+		"usage":       usage,
+	})
+
+	response.StatusCode = 200
+	response.Body = body
+	response.ResponseTime = int64(600 + usage.OutputTokens*15 + g.rng.Intn(1500))
+	response.CompletedAt = at.Add(time.Duration(response.ResponseTime) * time.Millisecond).Format(time.RFC3339)
+	response.BodyBytes = int64(len(body))
+	response.WireBytes = response.BodyBytes
+	if req.Stream {
+		response.Headers = map[string][]string{"Content-Type": {"text/event-stream"}}
+	}
+	return request, reply
+}
+
+func (g *syntheticGenerator) toolInput(tool, area string) map[string]string {
+	path := fmt.Sprintf("internal/%s/%s.go", area, g.choose([]string{"handler", "service", "store", "client"}))
+	switch tool {
+	case "Read":
+		return map[string]string{"file_path": path}
+	case "Edit":
+		return map[string]string{"file_path": path, "old_string": "oldName", "new_string": "newName"}
+	case "Bash":
+		return map[string]string{"command": "go test ./internal/" + area + "/..."}
+	default:
+		return map[string]string{"pattern": "func .*" + strings.ToUpper(area[:1]) + area[1:]}
+	}
+}
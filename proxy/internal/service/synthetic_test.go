@@ -0,0 +1,85 @@
+package service
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+func TestGenerateSynthetic(t *testing.T) {
+	now := time.Date(2025, 6, 15, 18, 0, 0, 0, time.UTC)
+	generate := func(seed int64) (StorageService, SyntheticSummary) {
+		storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "sandbox.db")})
+		if err != nil {
+			t.Fatalf("failed to create storage: %v", err)
+		}
+		opts := DefaultSyntheticOptions()
+		opts.Sessions = 20
+		opts.Seed = seed
+		opts.Now = now
+		summary, err := GenerateSynthetic(storage, opts)
+		if err != nil {
+			t.Fatalf("GenerateSynthetic() returned error: %v", err)
+		}
+		return storage, summary
+	}
+
+	storage, summary := generate(7)
+	if summary.Sessions != 20 || summary.Requests < summary.Sessions {
+		t.Fatalf("summary = %+v, want 20 sessions of at least one request", summary)
+	}
+
+	requests, total, err := storage.GetRequests(1, 1000)
+	if err != nil {
+		t.Fatalf("GetRequests() returned error: %v", err)
+	}
+	if total != summary.Requests {
+		t.Fatalf("stored %d requests, summary says %d", total, summary.Requests)
+	}
+	for _, request := range requests {
+		at, err := time.Parse(time.RFC3339, request.Timestamp)
+		if err != nil || at.Before(now.AddDate(0, 0, -14)) {
+			t.Errorf("request %s timestamp %q is outside the last 14 days", request.RequestID, request.Timestamp)
+		}
+		if request.Response == nil || request.Response.StatusCode == 0 {
+			t.Errorf("request %s has no response", request.RequestID)
+		}
+	}
+
+	stats, err := storage.GetStats(now.AddDate(0, 0, -15), now.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("GetStats() returned error: %v", err)
+	}
+	if stats.Requests != summary.Requests || stats.Errors != summary.Errors || stats.OutputTokens == 0 {
+		t.Errorf("stats = %d requests, %d errors, %d output tokens; want %d, %d and some tokens",
+			stats.Requests, stats.Errors, stats.OutputTokens, summary.Requests, summary.Errors)
+	}
+
+	if _, again := generate(7); !reflect.DeepEqual(again, summary) {
+		t.Errorf("same seed gave %+v, want %+v", again, summary)
+	}
+}
+
+func TestGenerateSynthetic_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*SyntheticOptions)
+	}{
+		{"No sessions", func(o *SyntheticOptions) { o.Sessions = 0 }},
+		{"No models", func(o *SyntheticOptions) { o.Models = nil }},
+		{"Negative weight", func(o *SyntheticOptions) { o.Models = map[string]int{"claude-sonnet-4": -1} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultSyntheticOptions()
+			tt.modify(&opts)
+			if _, err := GenerateSynthetic(nil, opts); err == nil {
+				t.Error("GenerateSynthetic() returned no error")
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxTagLength is the longest tag that can be attached to a request
+const maxTagLength = 64
+
+// NormalizeTag lowercases and trims a tag, rejecting empty or overlong ones
+// and ones with characters other than letters, digits, '-', '_', '.' and ':',
+// so a tag can be put in a URL path as it is
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "", fmt.Errorf("tag is empty")
+	}
+	if len(tag) > maxTagLength {
+		return "", fmt.Errorf("tag %q is longer than %d characters", tag, maxTagLength)
+	}
+	for _, c := range tag {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !strings.ContainsRune("-_.:", c) {
+			return "", fmt.Errorf("tag %q may only contain letters, digits and - _ . :", tag)
+		}
+	}
+	return tag, nil
+}
+
+// splitTags reads the comma-separated tags of a request, as selected by
+// requestColumns, sorted
+func splitTags(tags string) []string {
+	if tags == "" {
+		return nil
+	}
+	split := strings.Split(tags, ",")
+	sort.Strings(split)
+	return split
+}
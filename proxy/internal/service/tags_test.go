@@ -0,0 +1,37 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		name        string
+		tag         string
+		expected    string
+		expectError bool
+	}{
+		{"Plain tag", "bug-repro", "bug-repro", false},
+		{"Case and spaces", "  Great_Answer ", "great_answer", false},
+		{"Namespaced", "team:infra.v2", "team:infra.v2", false},
+		{"Non-ASCII letters", "überteuer", "überteuer", false},
+		{"Empty", "   ", "", true},
+		{"Inner space", "great answer", "", true},
+		{"Slash", "bug/repro", "", true},
+		{"Comma", "bug,repro", "", true},
+		{"Too long", strings.Repeat("x", maxTagLength+1), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeTag(tt.tag)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("NormalizeTag(%q) error = %v, want error %v", tt.tag, err, tt.expectError)
+			}
+			if got != tt.expected {
+				t.Errorf("NormalizeTag(%q) = %q, want %q", tt.tag, got, tt.expected)
+			}
+		})
+	}
+}
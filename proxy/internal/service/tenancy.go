@@ -0,0 +1,58 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+)
+
+// Tenancy partitions the dashboard API between the users of a shared proxy:
+// a caller authenticating with a user's API key is that user's tenant and sees
+// only the requests routed for them
+type Tenancy struct {
+	enabled   bool
+	adminKeys []string
+	router    *ModelRouter
+}
+
+// NewTenancy checks that a partitioned proxy has users to partition it
+// between; without Enable every caller sees everything
+func NewTenancy(cfg config.TenancyConfig, router *ModelRouter) (*Tenancy, error) {
+	tenancy := &Tenancy{enabled: cfg.Enable, router: router}
+	for _, key := range cfg.AdminKeys {
+		if key = strings.TrimSpace(key); key != "" {
+			tenancy.adminKeys = append(tenancy.adminKeys, key)
+		}
+	}
+	if !cfg.Enable {
+		return tenancy, nil
+	}
+
+	for _, user := range router.users {
+		if len(user.apiKeys) > 0 {
+			return tenancy, nil
+		}
+	}
+	return nil, fmt.Errorf("tenancy is enabled but no user has api_keys to sign in with")
+}
+
+func (t *Tenancy) Enabled() bool {
+	return t != nil && t.enabled
+}
+
+// Caller identifies whoever called the API with apiKey: an admin, who sees
+// every tenant, or the user whose key it is. ok is false for any other key.
+func (t *Tenancy) Caller(apiKey string) (tenant string, admin, ok bool) {
+	if keyMatches(t.adminKeys, apiKey) {
+		return "", true, true
+	}
+	t.router.rulesMu.RLock()
+	defer t.router.rulesMu.RUnlock()
+	for i := range t.router.users {
+		if keyMatches(t.router.users[i].apiKeys, apiKey) {
+			return t.router.users[i].name, false, true
+		}
+	}
+	return "", false, false
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func TestTenancy_Caller(t *testing.T) {
+	bobDigest := sha256.Sum256([]byte("sk-bob"))
+	cfg := &config.Config{
+		Tenancy: config.TenancyConfig{Enable: true, AdminKeys: []string{"sk-admin", " "}},
+		Users: []config.UserPolicyConfig{
+			{Name: "alice", APIKeys: []string{"sk-alice"}},
+			{Name: "bob", APIKeys: []string{"sha256:" + hex.EncodeToString(bobDigest[:])}},
+		},
+	}
+	router := NewModelRouter(cfg, map[string]provider.Provider{}, log.New(io.Discard, "", 0))
+	tenancy, err := NewTenancy(cfg.Tenancy, router)
+	if err != nil {
+		t.Fatalf("NewTenancy() returned error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		apiKey         string
+		expectedTenant string
+		expectedAdmin  bool
+		expectedOK     bool
+	}{
+		{"Admin", "sk-admin", "", true, true},
+		{"User", "sk-alice", "alice", false, true},
+		{"Hashed user key", "sk-bob", "bob", false, true},
+		{"Unknown key", "sk-mallory", "", false, false},
+		{"No key", "", "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant, admin, ok := tenancy.Caller(tt.apiKey)
+			if tenant != tt.expectedTenant || admin != tt.expectedAdmin || ok != tt.expectedOK {
+				t.Errorf("Caller(%q) = %q, %v, %v, want %q, %v, %v", tt.apiKey, tenant, admin, ok, tt.expectedTenant, tt.expectedAdmin, tt.expectedOK)
+			}
+		})
+	}
+
+	withoutKeys := NewModelRouter(&config.Config{Users: []config.UserPolicyConfig{{Name: "carol", Accounts: []string{"0f3c"}}}},
+		map[string]provider.Provider{}, log.New(io.Discard, "", 0))
+	if _, err := NewTenancy(config.TenancyConfig{Enable: true}, withoutKeys); err == nil {
+		t.Error("NewTenancy() without users to sign in returned no error")
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"encoding/json"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+const (
+	// charsPerToken is a conservative average for English prose and code
+	charsPerToken = 3.5
+	// perMessageTokens covers role markers and chat template overhead
+	perMessageTokens = 4
+	// attachmentTokens is charged for image and document blocks, whose base64
+	// payload says little about how many tokens the model will spend on them
+	attachmentTokens = 1600
+)
+
+// estimateTokens approximates the prompt size of req without a tokenizer. It
+// errs on the high side so local models are not pushed past their window.
+func estimateTokens(req *model.AnthropicRequest) int {
+	chars := 0
+	tokens := 0
+
+	for _, sys := range req.System {
+		chars += len(sys.Text)
+	}
+
+	for i := range req.Messages {
+		tokens += perMessageTokens
+		c, t := contentSize(req.Messages[i].Content)
+		chars += c
+		tokens += t
+	}
+
+	for _, tool := range req.Tools {
+		if schema, err := json.Marshal(tool); err == nil {
+			chars += len(schema)
+		}
+	}
+
+	return tokens + int(float64(chars)/charsPerToken+0.5)
+}
+
+// contentSize returns the character count of a message's content plus a flat
+// token charge for attachments
+func contentSize(content interface{}) (int, int) {
+	switch v := content.(type) {
+	case string:
+		return len(v), 0
+	case []interface{}:
+		chars, tokens := 0, 0
+		for _, item := range v {
+			block, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch block["type"] {
+			case "image", "document":
+				tokens += attachmentTokens
+			case "text", "thinking":
+				text, _ := block["text"].(string)
+				if text == "" {
+					text, _ = block["thinking"].(string)
+				}
+				chars += len(text)
+			case "tool_result":
+				c, t := contentSize(block["content"])
+				chars += c
+				tokens += t
+			default:
+				if raw, err := json.Marshal(block); err == nil {
+					chars += len(raw)
+				}
+			}
+		}
+		return chars, tokens
+	case nil:
+		return 0, 0
+	default:
+		raw, _ := json.Marshal(v)
+		return len(raw), 0
+	}
+}
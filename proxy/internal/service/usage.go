@@ -0,0 +1,299 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"strings"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// responseUsage extracts the Anthropic usage block from a stored response, if any
+func responseUsage(resp *model.ResponseLog) *model.AnthropicUsage {
+	if resp == nil || len(resp.Body) == 0 {
+		return nil
+	}
+
+	var body struct {
+		Usage *model.AnthropicUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return nil
+	}
+	return body.Usage
+}
+
+// decodeResponse parses a stored response. Responses stored before origins
+// were recorded get one: the errors the proxy made up were saved without
+// upstream headers, and failovers were recorded on the response.
+func decodeResponse(responseJSON sql.NullString) *model.ResponseLog {
+	if !responseJSON.Valid {
+		return nil
+	}
+	var resp model.ResponseLog
+	if err := json.Unmarshal([]byte(responseJSON.String), &resp); err != nil {
+		return nil
+	}
+	resp.Origin = responseOrigin(&resp)
+	return &resp
+}
+
+func responseOrigin(resp *model.ResponseLog) string {
+	switch {
+	case resp.Origin != "":
+		return resp.Origin
+	case resp.Headers == nil && resp.StatusCode >= 400:
+		return model.ResponseOriginSynthetic
+	case resp.Failover != nil:
+		return model.ResponseOriginFallback
+	default:
+		return model.ResponseOriginUpstream
+	}
+}
+
+// responseColumnNames are the columns holding the figures and error type of
+// each response, so stats can be summed and errors broken down in SQL rather
+// than by decoding every response
+var responseColumnNames = []string{
+	"status_code",
+	"response_origin",
+	"response_ms",
+	"response_bytes",
+	"response_wire_bytes",
+	"input_tokens",
+	"output_tokens",
+	"cache_read_tokens",
+	"cache_creation_tokens",
+	"ttft_ms",
+	"stream_ms",
+	"stream_chunks",
+	"tokens_per_second",
+	"error_type",
+}
+
+// backfilledResponseColumns is how many of responseColumnNames the migration
+// that added them filled in for older responses; the streaming figures after
+// them weren't recorded before they had columns
+const backfilledResponseColumns = 9
+
+// responseColumns returns the values of responseColumnNames for a response,
+// counted the way modelAccumulator.add counts them: synthetic responses have
+// no response time or sizes, and no tokens. Streaming figures are NULL for
+// responses that didn't stream, so they're left out of averages.
+func responseColumns(resp *model.ResponseLog) []interface{} {
+	values := make([]interface{}, len(responseColumnNames))
+	if resp == nil {
+		return values
+	}
+
+	origin := responseOrigin(resp)
+	values[0], values[1] = resp.StatusCode, origin
+	values[5], values[6], values[7], values[8] = 0, 0, 0, 0
+	if errorType := responseErrorType(resp); errorType != "" {
+		values[13] = errorType
+	}
+	if origin == model.ResponseOriginSynthetic {
+		return values
+	}
+	values[2], values[3], values[4] = resp.ResponseTime, resp.BodyBytes, resp.WireBytes
+	if usage := responseUsage(resp); usage != nil {
+		values[5] = usage.InputTokens
+		values[6] = usage.OutputTokens
+		values[7] = usage.CacheReadInputTokens
+		values[8] = usage.CacheCreationInputTokens
+	}
+	if resp.IsStreaming && resp.ChunkCount > 0 {
+		values[10], values[11] = resp.StreamDuration, resp.ChunkCount
+		if resp.TimeToFirstToken > 0 {
+			values[9] = resp.TimeToFirstToken
+		}
+		if resp.TokensPerSecond > 0 {
+			values[12] = resp.TokensPerSecond
+		}
+	}
+	return values
+}
+
+// responseErrorType is the type of the error a response carries, such as
+// overloaded_error or rate_limit_error: from the body of an error status, or
+// from the error event of a stream that failed partway. It's empty for a
+// successful response and for an error body that isn't an API error.
+func responseErrorType(resp *model.ResponseLog) string {
+	var payload struct {
+		Type  string `json:"type"`
+		Error *struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if resp.StatusCode >= 400 && len(resp.Body) > 0 {
+		if json.Unmarshal(resp.Body, &payload) == nil && payload.Error != nil {
+			return payload.Error.Type
+		}
+	}
+	for _, chunk := range resp.StreamingChunks {
+		data := strings.TrimSpace(strings.TrimPrefix(chunk, "data:"))
+		if !strings.Contains(data, `"error"`) {
+			continue
+		}
+		if json.Unmarshal([]byte(data), &payload) == nil && payload.Type == "error" && payload.Error != nil {
+			return payload.Error.Type
+		}
+	}
+	return ""
+}
+
+// usageSums aggregates a group of requests from the response columns, in the
+// order scanUsage reads them
+const usageSums = `
+	COUNT(*),
+	COALESCE(SUM(status_code >= 400), 0),
+	COALESCE(SUM(response_origin = 'synthetic'), 0),
+	COALESCE(SUM(input_tokens), 0),
+	COALESCE(SUM(output_tokens), 0),
+	COALESCE(SUM(cache_read_tokens), 0),
+	COALESCE(SUM(cache_creation_tokens), 0),
+	COALESCE(SUM(response_ms), 0),
+	COUNT(response_ms),
+	COALESCE(SUM(request_bytes), 0),
+	COALESCE(SUM(request_wire_bytes), 0),
+	COALESCE(SUM(response_bytes), 0),
+	COALESCE(SUM(response_wire_bytes), 0),
+	COALESCE(SUM(cost_usd), 0),
+	COALESCE(SUM(ttft_ms), 0),
+	COUNT(ttft_ms),
+	COALESCE(SUM(tokens_per_second), 0),
+	COUNT(tokens_per_second)`
+
+// scanUsage reads a group key followed by usageSums
+func scanUsage(rows *sql.Rows) (string, *modelAccumulator, error) {
+	var key string
+	acc := &modelAccumulator{}
+	usage := &acc.usage
+	err := rows.Scan(&key, &usage.Requests, &usage.Errors, &usage.Synthetic,
+		&usage.InputTokens, &usage.OutputTokens, &usage.CacheReadTokens, &usage.CacheCreationTokens,
+		&acc.totalRespTime, &acc.respCount,
+		&usage.RequestBytes, &usage.RequestWireBytes, &usage.ResponseBytes, &usage.ResponseWireBytes,
+		&usage.CostUSD,
+		&acc.totalTTFT, &acc.ttftCount, &acc.totalTokensPerSecond, &acc.tokensPerSecondCount)
+	return key, acc, err
+}
+
+// modelAccumulator sums usage for a group of requests
+type modelAccumulator struct {
+	usage         model.ModelUsage
+	totalRespTime int64
+	respCount     int64
+
+	totalTTFT            int64
+	ttftCount            int64
+	totalTokensPerSecond float64
+	tokensPerSecondCount int64
+}
+
+func (a *modelAccumulator) add(resp *model.ResponseLog) {
+	a.usage.Requests++
+	if resp == nil {
+		return
+	}
+
+	if resp.StatusCode >= 400 {
+		a.usage.Errors++
+	}
+	if resp.Origin == model.ResponseOriginSynthetic {
+		a.usage.Synthetic++
+		return
+	}
+	a.totalRespTime += resp.ResponseTime
+	a.respCount++
+	a.usage.ResponseBytes += resp.BodyBytes
+	a.usage.ResponseWireBytes += resp.WireBytes
+	if resp.IsStreaming && resp.TimeToFirstToken > 0 {
+		a.totalTTFT += resp.TimeToFirstToken
+		a.ttftCount++
+	}
+	if resp.IsStreaming && resp.TokensPerSecond > 0 {
+		a.totalTokensPerSecond += resp.TokensPerSecond
+		a.tokensPerSecondCount++
+	}
+
+	if usage := responseUsage(resp); usage != nil {
+		a.usage.InputTokens += int64(usage.InputTokens)
+		a.usage.OutputTokens += int64(usage.OutputTokens)
+		a.usage.CacheReadTokens += int64(usage.CacheReadInputTokens)
+		a.usage.CacheCreationTokens += int64(usage.CacheCreationInputTokens)
+	}
+}
+
+// merge adds the usage of another group
+func (a *modelAccumulator) merge(other *modelAccumulator) {
+	a.usage.Requests += other.usage.Requests
+	a.usage.Errors += other.usage.Errors
+	a.usage.Synthetic += other.usage.Synthetic
+	a.usage.InputTokens += other.usage.InputTokens
+	a.usage.OutputTokens += other.usage.OutputTokens
+	a.usage.CacheReadTokens += other.usage.CacheReadTokens
+	a.usage.CacheCreationTokens += other.usage.CacheCreationTokens
+	a.addRequestBytes(other.usage.RequestBytes, other.usage.RequestWireBytes)
+	a.usage.ResponseBytes += other.usage.ResponseBytes
+	a.usage.ResponseWireBytes += other.usage.ResponseWireBytes
+	a.usage.CostUSD += other.usage.CostUSD
+	a.totalRespTime += other.totalRespTime
+	a.respCount += other.respCount
+	a.totalTTFT += other.totalTTFT
+	a.ttftCount += other.ttftCount
+	a.totalTokensPerSecond += other.totalTokensPerSecond
+	a.tokensPerSecondCount += other.tokensPerSecondCount
+}
+
+func (a *modelAccumulator) addRequestBytes(decoded, wire int64) {
+	a.usage.RequestBytes += decoded
+	a.usage.RequestWireBytes += wire
+}
+
+func (a *modelAccumulator) avgResponseTime() int64 {
+	if a.respCount == 0 {
+		return 0
+	}
+	return a.totalRespTime / a.respCount
+}
+
+// averaged returns the usage with its averages filled in
+func (a *modelAccumulator) averaged() model.ModelUsage {
+	usage := a.usage
+	usage.AvgResponseTime = a.avgResponseTime()
+	if a.ttftCount > 0 {
+		usage.AvgTimeToFirstToken = a.totalTTFT / a.ttftCount
+	}
+	if a.tokensPerSecondCount > 0 {
+		usage.AvgTokensPerSecond = math.Round(a.totalTokensPerSecond/float64(a.tokensPerSecondCount)*10) / 10
+	}
+	return usage
+}
+
+// compared returns the usage set out for comparing models
+func (a *modelAccumulator) compared() model.ComparedModel {
+	usage := a.averaged()
+	compared := model.ComparedModel{
+		Model:               usage.Model,
+		Requests:            usage.Requests,
+		Errors:              usage.Errors,
+		InputTokens:         usage.InputTokens,
+		OutputTokens:        usage.OutputTokens,
+		CacheReadTokens:     usage.CacheReadTokens,
+		CacheCreationTokens: usage.CacheCreationTokens,
+		CostUSD:             roundTo(usage.CostUSD, 6),
+		AvgResponseTime:     usage.AvgResponseTime,
+		AvgTimeToFirstToken: usage.AvgTimeToFirstToken,
+		Latency:             usage.Latency,
+	}
+	if usage.Requests > 0 {
+		compared.ErrorRate = roundTo(float64(usage.Errors)/float64(usage.Requests), 4)
+		compared.CostPerRequestUSD = roundTo(usage.CostUSD/float64(usage.Requests), 6)
+	}
+	if a.respCount > 0 {
+		compared.AvgOutputTokens = usage.OutputTokens / a.respCount
+		compared.AvgResponseBytes = usage.ResponseBytes / a.respCount
+	}
+	return compared
+}
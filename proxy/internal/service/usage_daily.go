@@ -0,0 +1,172 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// dailyUsageDimensions are the groupings usage_daily keeps, by the SQL
+// expression sumUsage is asked to group requests on
+var dailyUsageDimensions = map[string]string{
+	"COALESCE(model, '')":                           "model",
+	"COALESCE(provider, '')":                        "provider",
+	"COALESCE(NULLIF(routed_model, ''), model, '')": "routed",
+}
+
+// dailyUsageSums adds up usage_daily rows in the order scanUsage reads them
+const dailyUsageSums = `
+	SUM(requests),
+	SUM(errors),
+	SUM(synthetic),
+	SUM(input_tokens),
+	SUM(output_tokens),
+	SUM(cache_read_tokens),
+	SUM(cache_creation_tokens),
+	SUM(response_ms),
+	SUM(response_ms_count),
+	SUM(request_bytes),
+	SUM(request_wire_bytes),
+	SUM(response_bytes),
+	SUM(response_wire_bytes),
+	SUM(cost_usd),
+	SUM(ttft_ms),
+	SUM(ttft_ms_count),
+	SUM(tokens_per_second),
+	SUM(tokens_per_second_count)`
+
+const dayFormat = "2006-01-02"
+
+// sumDailyUsage totals the requests between start and end like sumRequests,
+// reading the whole UTC days before today from usage_daily and only the
+// partial days at either end from the requests
+func (s *sqliteStorageService) sumDailyUsage(dimension, group string, start, end time.Time) (map[string]*modelAccumulator, error) {
+	firstDay := start.UTC().Truncate(24 * time.Hour)
+	if firstDay.Before(start) {
+		firstDay = firstDay.Add(24 * time.Hour)
+	}
+	lastDay := end.UTC().Truncate(24 * time.Hour)
+	if today := time.Now().UTC().Truncate(24 * time.Hour); lastDay.After(today) {
+		lastDay = today
+	}
+
+	// A range going back to the beginning of time starts its days at the
+	// oldest request, give or take a day for its offset, with nothing to read
+	// before them
+	head := start
+	var oldest string
+	err := s.db.QueryRow("SELECT timestamp FROM requests ORDER BY timestamp LIMIT 1").Scan(&oldest)
+	if err == sql.ErrNoRows {
+		return make(map[string]*modelAccumulator), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query oldest request: %w", err)
+	}
+	if parsed, err := time.Parse(time.RFC3339, oldest); err == nil {
+		if earliest := parsed.UTC().Truncate(24 * time.Hour).Add(-24 * time.Hour); firstDay.Before(earliest) {
+			firstDay, head = earliest, earliest
+		}
+	}
+	if !firstDay.Before(lastDay) {
+		return s.sumRequests(group, start, end)
+	}
+
+	if err := s.refreshDailyUsage(firstDay, lastDay); err != nil {
+		return nil, err
+	}
+	scope, scopeArgs := s.tenantScope()
+	groups, err := s.queryUsage(`
+		SELECT key, `+dailyUsageSums+`
+		FROM usage_daily
+		WHERE dimension = ? AND day >= ? AND day < ?`+scope+`
+		GROUP BY 1
+	`, queryArgs([]interface{}{dimension, firstDay.Format(dayFormat), lastDay.Format(dayFormat)}, scopeArgs)...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, partial := range [][2]time.Time{{head, firstDay}, {lastDay, end}} {
+		if !partial[0].Before(partial[1]) {
+			continue
+		}
+		sums, err := s.sumRequests(group, partial[0], partial[1])
+		if err != nil {
+			return nil, err
+		}
+		for key, acc := range sums {
+			if total, ok := groups[key]; ok {
+				total.merge(acc)
+			} else {
+				groups[key] = acc
+			}
+		}
+	}
+	return groups, nil
+}
+
+// refreshDailyUsage sums the days from first to last, exclusive, that
+// usage_daily doesn't have or has forgotten. Every day from the first missing
+// one to the last is summed again in one pass over the requests.
+func (s *sqliteStorageService) refreshDailyUsage(first, last time.Time) error {
+	rows, err := s.db.Query("SELECT day FROM usage_daily_days WHERE day >= ? AND day < ?", first.Format(dayFormat), last.Format(dayFormat))
+	if err != nil {
+		return fmt.Errorf("failed to query daily usage: %w", err)
+	}
+	summed := make(map[string]bool)
+	for rows.Next() {
+		var day string
+		if err := rows.Scan(&day); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan daily usage: %w", err)
+		}
+		summed[day] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read daily usage: %w", err)
+	}
+
+	var from, to time.Time
+	for day := first; day.Before(last); day = day.Add(24 * time.Hour) {
+		if summed[day.Format(dayFormat)] {
+			continue
+		}
+		if from.IsZero() {
+			from = day
+		}
+		to = day.Add(24 * time.Hour)
+	}
+	if from.IsZero() {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	fromDay, toDay := from.Format(dayFormat), to.Format(dayFormat)
+	if _, err := tx.Exec("DELETE FROM usage_daily WHERE day >= ? AND day < ?", fromDay, toDay); err != nil {
+		return fmt.Errorf("failed to clear daily usage: %w", err)
+	}
+	for group, dimension := range dailyUsageDimensions {
+		_, err := tx.Exec(`
+			INSERT INTO usage_daily
+			SELECT date(timestamp), COALESCE(tenant, ''), ?, `+group+`, `+usageSums+`
+			FROM requests
+			WHERE datetime(timestamp) >= datetime(?) AND datetime(timestamp) < datetime(?)
+				AND `+liveRequest+`
+			GROUP BY 1, 2, 4
+		`, dimension, sqliteTime(from), sqliteTime(to))
+		if err != nil {
+			return fmt.Errorf("failed to sum daily usage: %w", err)
+		}
+	}
+	for day := from; day.Before(to); day = day.Add(24 * time.Hour) {
+		if _, err := tx.Exec("INSERT OR REPLACE INTO usage_daily_days (day) VALUES (?)", day.Format(dayFormat)); err != nil {
+			return fmt.Errorf("failed to record daily usage: %w", err)
+		}
+	}
+	return tx.Commit()
+}
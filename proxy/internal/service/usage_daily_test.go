@@ -0,0 +1,124 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestSQLiteStorage_DailyUsage(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db"), TrashDays: 7})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	sqlite := storage.(*sqliteStorageService)
+
+	// A request every five hours over the last five days, for two users and
+	// two models
+	now := time.Now()
+	save := func(id string, at time.Time, user, modelName string, tokens int) *model.RequestLog {
+		request := testRequestLog(id)
+		request.Timestamp = at.Format(time.RFC3339)
+		request.Model = modelName
+		request.Provider = "anthropic"
+		request.Routing = &model.RoutingExplanation{User: user}
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		request.Response = &model.ResponseLog{StatusCode: 200, ResponseTime: 1000, Body: []byte(fmt.Sprintf(`{"usage":{"input_tokens":%d}}`, tokens))}
+		if err := storage.UpdateRequestWithResponse(request); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+		return request
+	}
+	var requests []*model.RequestLog
+	for i := 0; i < 24; i++ {
+		user, modelName := []string{"alice", "bob"}[i%2], []string{"claude-sonnet-4", "claude-opus-4"}[i/2%2]
+		requests = append(requests, save(fmt.Sprintf("req-%d", i), now.Add(-time.Duration(i)*5*time.Hour), user, modelName, 100+i))
+	}
+
+	start, end := now.Add(-100*time.Hour), now.Add(time.Minute)
+	check := func(step string) {
+		t.Helper()
+		for _, view := range []*sqliteStorageService{sqlite, sqlite.ForTenant("alice").(*sqliteStorageService)} {
+			for group := range dailyUsageDimensions {
+				summed, err := view.sumUsage(group, start, end)
+				if err != nil {
+					t.Fatalf("%s: sumUsage() returned error: %v", step, err)
+				}
+				read, err := view.sumRequests(group, start, end)
+				if err != nil {
+					t.Fatalf("%s: sumRequests() returned error: %v", step, err)
+				}
+				if !reflect.DeepEqual(summed, read) {
+					t.Errorf("%s: %s for %q = %+v, reading every request %+v", step, group, view.tenant, summed, read)
+				}
+			}
+		}
+	}
+
+	check("first read")
+	var days int
+	if err := sqlite.db.QueryRow("SELECT COUNT(*) FROM usage_daily_days").Scan(&days); err != nil || days < 3 {
+		t.Fatalf("summed %d days (err %v), want at least 3", days, err)
+	}
+
+	if _, err := storage.DeleteRequests(RequestFilter{Before: now.Add(-60 * time.Hour)}); err != nil {
+		t.Fatalf("DeleteRequests() returned error: %v", err)
+	}
+	check("after trashing")
+
+	if _, err := storage.RestoreRequests([]string{"req-20", "req-21"}); err != nil {
+		t.Fatalf("RestoreRequests() returned error: %v", err)
+	}
+	check("after restoring")
+
+	requests[10].Response.Body = []byte(`{"usage":{"input_tokens":5000}}`)
+	if err := storage.UpdateRequestWithResponse(requests[10]); err != nil {
+		t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+	}
+	check("after a response changed")
+
+	save("imported", now.Add(-80*time.Hour), "alice", "claude-haiku-4", 7)
+	check("after an old request was stored")
+}
+
+func TestSQLiteStorage_DailyUsage_ReadOnly(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "requests.db")
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: dbPath})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	now := time.Now()
+	for i := 0; i < 6; i++ {
+		request := testRequestLog(fmt.Sprintf("req-%d", i))
+		request.Timestamp = now.Add(-time.Duration(i) * 20 * time.Hour).Format(time.RFC3339)
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+	}
+
+	readOnly, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: dbPath, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("failed to open read-only storage: %v", err)
+	}
+	stats, err := readOnly.GetStats(now.Add(-200*time.Hour), now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("GetStats() returned error: %v", err)
+	}
+	if stats.Requests != 6 {
+		t.Errorf("requests = %d, want all 6", stats.Requests)
+	}
+
+	for _, table := range []string{"usage_daily", "usage_daily_days"} {
+		var rows int
+		if err := readOnly.(*sqliteStorageService).db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&rows); err != nil || rows != 0 {
+			t.Errorf("%s has %d rows (err %v) after a read-only read, want none", table, rows, err)
+		}
+	}
+}
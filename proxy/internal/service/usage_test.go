@@ -0,0 +1,77 @@
+package service
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestDecodeResponse(t *testing.T) {
+	tests := []struct {
+		name           string
+		stored         string
+		expectedOrigin string
+	}{
+		{"Recorded origin", `{"statusCode":200,"origin":"cache"}`, model.ResponseOriginCache},
+		{"Legacy upstream response", `{"statusCode":200,"headers":{"Content-Type":["application/json"]}}`, model.ResponseOriginUpstream},
+		{"Legacy upstream error", `{"statusCode":529,"headers":{"Content-Type":["application/json"]}}`, model.ResponseOriginUpstream},
+		{"Legacy quota rejection", `{"statusCode":429,"bodyText":"quota exceeded"}`, model.ResponseOriginSynthetic},
+		{"Legacy failover", `{"statusCode":200,"headers":{},"failover":{"fromModel":"claude-opus-4","fromProvider":"anthropic","statusCode":529}}`, model.ResponseOriginFallback},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := decodeResponse(sql.NullString{String: tt.stored, Valid: true})
+			if resp == nil || resp.Origin != tt.expectedOrigin {
+				t.Errorf("decodeResponse() = %+v, want origin %s", resp, tt.expectedOrigin)
+			}
+		})
+	}
+
+	if decodeResponse(sql.NullString{}) != nil || decodeResponse(sql.NullString{String: "{", Valid: true}) != nil {
+		t.Error("expected no response for NULL or invalid JSON")
+	}
+}
+
+func TestResponseErrorType(t *testing.T) {
+	tests := []struct {
+		name     string
+		resp     model.ResponseLog
+		expected string
+	}{
+		{"Success", model.ResponseLog{StatusCode: 200, Body: []byte(`{"type":"message"}`)}, ""},
+		{"Overloaded", model.ResponseLog{StatusCode: 529, Body: []byte(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)}, "overloaded_error"},
+		{"Rate limited", model.ResponseLog{StatusCode: 429, Body: []byte(`{"type":"error","error":{"type":"rate_limit_error"}}`)}, "rate_limit_error"},
+		{"OpenAI error", model.ResponseLog{StatusCode: 400, Body: []byte(`{"error":{"type":"invalid_request_error","code":null}}`)}, "invalid_request_error"},
+		{"Not an API error", model.ResponseLog{StatusCode: 502, BodyText: "<html>Bad Gateway</html>"}, ""},
+		{"Stream failed partway", model.ResponseLog{StatusCode: 200, IsStreaming: true, StreamingChunks: []string{
+			`data: {"type":"message_start","message":{"id":"msg_1"}}`,
+			`data: {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+		}}, "overloaded_error"},
+		{"Stream quoting an error", model.ResponseLog{StatusCode: 200, IsStreaming: true, StreamingChunks: []string{
+			`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"\"error\""}}`,
+		}}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := responseErrorType(&tt.resp); got != tt.expected {
+				t.Errorf("responseErrorType() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestModelAccumulator_Synthetic(t *testing.T) {
+	acc := &modelAccumulator{}
+	acc.add(&model.ResponseLog{StatusCode: 200, ResponseTime: 1000, BodyBytes: 500, Origin: model.ResponseOriginUpstream})
+	acc.add(&model.ResponseLog{StatusCode: 429, ResponseTime: 2, BodyBytes: 80, Origin: model.ResponseOriginSynthetic})
+
+	if acc.usage.Requests != 2 || acc.usage.Errors != 1 || acc.usage.Synthetic != 1 {
+		t.Errorf("counted %+v", acc.usage)
+	}
+	if acc.avgResponseTime() != 1000 || acc.usage.ResponseBytes != 500 {
+		t.Errorf("proxy-made response counted in response time or size: %dms, %d bytes", acc.avgResponseTime(), acc.usage.ResponseBytes)
+	}
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// defaultUsageWindow is how long a Claude subscription's usage window lasts
+const defaultUsageWindow = 5 * time.Hour
+
+// usageWindowProvider is the provider whose requests count against the
+// subscription
+const usageWindowProvider = "anthropic"
+
+type usageWindowSample struct {
+	at     time.Time
+	model  string
+	usage  model.AnthropicUsage
+	tokens int64
+}
+
+// usageWindowTracker follows the subscription's usage window: it opens with
+// the first request after the last one closed and resets once its duration is
+// up, whatever was used in it
+type usageWindowTracker struct {
+	mu           sync.Mutex
+	duration     time.Duration
+	tokenLimit   int64
+	messageLimit int
+	start        time.Time           // zero until a request opens a window
+	samples      []usageWindowSample // the requests of the window opened at start
+	now          func() time.Time
+}
+
+func newUsageWindowTracker(cfg config.UsageWindowConfig, logger *log.Logger) *usageWindowTracker {
+	duration, err := time.ParseDuration(cfg.Duration)
+	if err != nil || duration <= 0 {
+		if cfg.Duration != "" {
+			logger.Printf("⚠️  Invalid usage window duration %q, using %s", cfg.Duration, defaultUsageWindow)
+		}
+		duration = defaultUsageWindow
+	}
+	return &usageWindowTracker{
+		duration:     duration,
+		tokenLimit:   cfg.TokenLimit,
+		messageLimit: cfg.MessageLimit,
+		now:          time.Now,
+	}
+}
+
+// record adds a request answered at at, which opens a new window if the
+// current one is over
+func (t *usageWindowTracker) record(at time.Time, modelName string, usage model.AnthropicUsage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.start.IsZero() || !at.Before(t.start.Add(t.duration)) {
+		t.start, t.samples = at, nil
+	}
+	t.samples = append(t.samples, usageWindowSample{
+		at:    at,
+		model: modelName,
+		usage: usage,
+		tokens: int64(usage.InputTokens + usage.OutputTokens +
+			usage.CacheReadInputTokens + usage.CacheCreationInputTokens),
+	})
+}
+
+// load replays the stored requests recent enough to be in the current
+// window. Windows are chained from the oldest request of twice the duration
+// back, which finds the current window's start unless requests kept coming
+// for longer than that.
+func (t *usageWindowTracker) load(storage StorageService) error {
+	now := t.now()
+	samples, err := storage.GetUsageSamples(now.Add(-2*t.duration), now)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.start, t.samples = time.Time{}, nil
+	t.mu.Unlock()
+	for _, sample := range samples {
+		at, err := time.Parse(time.RFC3339, sample.Timestamp)
+		if err != nil || sample.Provider != usageWindowProvider {
+			continue
+		}
+		t.record(at.Local(), sample.Model, sample.Usage)
+	}
+	return nil
+}
+
+// used returns the tokens and messages of the window open at now and when it
+// resets. With none open, nothing is used yet of the window the next request
+// opens, which resets a whole duration from now.
+func (t *usageWindowTracker) used(now time.Time) (tokens int64, messages int, resetsAt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	resetsAt = t.start.Add(t.duration)
+	if t.start.IsZero() || !now.Before(resetsAt) {
+		return 0, 0, now.Add(t.duration)
+	}
+	for _, sample := range t.samples {
+		tokens += sample.tokens
+	}
+	return tokens, len(t.samples), resetsAt
+}
+
+// report sums the usage of the open window and works out when it resets
+func (t *usageWindowTracker) report() model.UsageWindow {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	window := model.UsageWindow{
+		Duration:     t.duration.String(),
+		TokenLimit:   t.tokenLimit,
+		MessageLimit: t.messageLimit,
+		Models:       []model.UsageWindowModel{},
+	}
+	now := t.now()
+	resetsAt := t.start.Add(t.duration)
+	if t.start.IsZero() || !now.Before(resetsAt) {
+		return window
+	}
+
+	window.Active = true
+	window.StartedAt = t.start.Format(time.RFC3339)
+	window.ResetsAt = resetsAt.Format(time.RFC3339)
+	window.ResetsInSeconds = int64(resetsAt.Sub(now).Seconds())
+
+	byModel := make(map[string]*model.UsageWindowModel)
+	for _, sample := range t.samples {
+		window.Messages++
+		window.Tokens += sample.tokens
+		window.InputTokens += int64(sample.usage.InputTokens)
+		window.OutputTokens += int64(sample.usage.OutputTokens)
+		window.CacheReadTokens += int64(sample.usage.CacheReadInputTokens)
+		window.CacheCreationTokens += int64(sample.usage.CacheCreationInputTokens)
+
+		usage, ok := byModel[sample.model]
+		if !ok {
+			usage = &model.UsageWindowModel{Model: sample.model}
+			byModel[sample.model] = usage
+		}
+		usage.Messages++
+		usage.Tokens += sample.tokens
+	}
+	for _, usage := range byModel {
+		window.Models = append(window.Models, *usage)
+	}
+	sort.Slice(window.Models, func(i, j int) bool {
+		if window.Models[i].Tokens != window.Models[j].Tokens {
+			return window.Models[i].Tokens > window.Models[j].Tokens
+		}
+		return window.Models[i].Model < window.Models[j].Model
+	})
+
+	// The pace is averaged over at least a minute, so the first request
+	// doesn't project the limit running out at once
+	elapsed := now.Sub(t.start)
+	if elapsed < time.Minute {
+		elapsed = time.Minute
+	}
+	window.TokensPerMinute = roundTo(float64(window.Tokens)/elapsed.Minutes(), 1)
+
+	var utilization float64
+	var exhaustedAt time.Time
+	project := func(used, limit float64) {
+		if limit <= 0 {
+			return
+		}
+		if percent := used / limit * 100; percent > utilization {
+			utilization = percent
+		}
+		if used >= limit {
+			exhaustedAt = now
+			return
+		}
+		if used == 0 {
+			return
+		}
+		at := now.Add(time.Duration((limit - used) / used * float64(elapsed)))
+		if at.Before(resetsAt) && (exhaustedAt.IsZero() || at.Before(exhaustedAt)) {
+			exhaustedAt = at
+		}
+	}
+	project(float64(window.Tokens), float64(t.tokenLimit))
+	project(float64(window.Messages), float64(t.messageLimit))
+	if t.tokenLimit > 0 || t.messageLimit > 0 {
+		utilization = roundTo(utilization, 1)
+		window.Utilization = &utilization
+	}
+	if !exhaustedAt.IsZero() {
+		window.ExhaustedAt = exhaustedAt.Format(time.RFC3339)
+	}
+	return window
+}
+
+// LoadUsageWindow seeds the subscription usage window with the requests
+// stored before a restart
+func (r *ModelRouter) LoadUsageWindow(storage StorageService) error {
+	return r.window.load(storage)
+}
+
+// UsageWindow reports the usage of the current subscription window
+func (r *ModelRouter) UsageWindow() model.UsageWindow {
+	return r.window.report()
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+func TestUsageWindowTracker(t *testing.T) {
+	start := time.Date(2025, 6, 15, 9, 0, 0, 0, time.UTC)
+	usage := model.AnthropicUsage{InputTokens: 100, OutputTokens: 400, CacheReadInputTokens: 500}
+
+	tests := []struct {
+		name        string
+		records     []time.Duration // after start
+		now         time.Duration
+		active      bool
+		startedAt   time.Duration
+		messages    int
+		utilization float64
+		exhaustedAt time.Duration // 0 for none
+	}{
+		{"No requests", nil, time.Hour, false, 0, 0, 0, 0},
+		// 3000 tokens in an hour of a 10000 limit runs out 140 minutes on
+		{"Open window", []time.Duration{0, 30 * time.Minute, time.Hour}, time.Hour, true, 0, 3, 30, 3*time.Hour + 20*time.Minute},
+		{"Reset after five hours", []time.Duration{0, 4 * time.Hour, 5*time.Hour + time.Minute}, 6 * time.Hour, true, 5*time.Hour + time.Minute, 1, 10, 0},
+		{"Closed window", []time.Duration{0}, 5 * time.Hour, false, 0, 0, 0, 0},
+		{"Limit reached", []time.Duration{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, time.Hour, true, 0, 10, 100, time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newUsageWindowTracker(config.UsageWindowConfig{TokenLimit: 10000}, log.New(io.Discard, "", 0))
+			tracker.now = func() time.Time { return start.Add(tt.now) }
+			for _, after := range tt.records {
+				tracker.record(start.Add(after), "claude-sonnet-4", usage)
+			}
+
+			window := tracker.report()
+			if window.Active != tt.active || window.Messages != tt.messages || window.Duration != "5h0m0s" {
+				t.Fatalf("report() = %+v, want active %v with %d messages", window, tt.active, tt.messages)
+			}
+			if !tt.active {
+				return
+			}
+			if window.StartedAt != start.Add(tt.startedAt).Format(time.RFC3339) ||
+				window.ResetsInSeconds != int64((tt.startedAt+5*time.Hour-tt.now).Seconds()) {
+				t.Errorf("window started %s, resets in %ds", window.StartedAt, window.ResetsInSeconds)
+			}
+			if window.Utilization == nil || *window.Utilization != tt.utilization {
+				t.Errorf("utilization = %v, want %v", window.Utilization, tt.utilization)
+			}
+			var exhaustedAt string
+			if tt.exhaustedAt != 0 {
+				exhaustedAt = start.Add(tt.exhaustedAt).Format(time.RFC3339)
+			}
+			if window.ExhaustedAt != exhaustedAt {
+				t.Errorf("ExhaustedAt = %q, want %q", window.ExhaustedAt, exhaustedAt)
+			}
+		})
+	}
+}
+
+func TestUsageWindowTracker_Load(t *testing.T) {
+	storage, err := NewSQLiteStorageService(&config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "requests.db")})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	now := time.Now().Truncate(time.Second)
+	save := func(id string, ago time.Duration, providerName string, status int) {
+		t.Helper()
+		request := testRequestLog(id)
+		request.Timestamp = now.Add(-ago).Format(time.RFC3339)
+		request.Provider = providerName
+		if _, err := storage.SaveRequest(request); err != nil {
+			t.Fatalf("SaveRequest() returned error: %v", err)
+		}
+		request.Response = &model.ResponseLog{StatusCode: status, Body: []byte(`{"usage":{"input_tokens":10,"output_tokens":90}}`)}
+		if err := storage.UpdateRequestWithResponse(request); err != nil {
+			t.Fatalf("UpdateRequestWithResponse() returned error: %v", err)
+		}
+	}
+	// The first window opened 7h ago, so the current one opened 2h ago
+	save("old", 7*time.Hour, "anthropic", 200)
+	save("first", 2*time.Hour, "anthropic", 200)
+	save("second", time.Hour, "anthropic", 200)
+	save("routed", time.Hour, "openai", 200)
+	save("failed", 30*time.Minute, "anthropic", 529)
+
+	tracker := newUsageWindowTracker(config.UsageWindowConfig{}, log.New(io.Discard, "", 0))
+	tracker.now = func() time.Time { return now }
+	if err := tracker.load(storage); err != nil {
+		t.Fatalf("load() returned error: %v", err)
+	}
+
+	window := tracker.report()
+	if !window.Active || window.Messages != 2 || window.Tokens != 200 || window.Utilization != nil {
+		t.Errorf("report() = %+v, want 2 messages and 200 tokens without utilization", window)
+	}
+	if want := now.Add(3 * time.Hour).Format(time.RFC3339); window.ResetsAt != want {
+		t.Errorf("ResetsAt = %s, want %s", window.ResetsAt, want)
+	}
+	if len(window.Models) != 1 || window.Models[0].Model != "claude-sonnet-4" || window.Models[0].Messages != 2 {
+		t.Errorf("models = %+v, want claude-sonnet-4 with 2 messages", window.Models)
+	}
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+)
+
+// userPolicy is a validated per-user routing policy from config
+type userPolicy struct {
+	name     string
+	apiKeys  []string // as configured: the key, or "sha256:<hex digest>"
+	accounts []string
+	mappings map[string]string // agentName -> targetModel, "" to opt out
+	tiers    map[string]string // model family -> target model, "" to opt out
+	rules    []routingRule
+	cfg      config.UserPolicyConfig
+}
+
+func compileUserPolicy(cfg config.UserPolicyConfig) (userPolicy, []error) {
+	policy := userPolicy{
+		name:     cfg.Name,
+		apiKeys:  cfg.APIKeys,
+		accounts: cfg.Accounts,
+		mappings: copyMappings(cfg.Mappings),
+		tiers:    make(map[string]string),
+		cfg:      cfg,
+	}
+	if policy.name == "" {
+		return policy, []error{fmt.Errorf("user policy has no name")}
+	}
+	if len(cfg.APIKeys) == 0 && len(cfg.Accounts) == 0 {
+		return policy, []error{fmt.Errorf("user %q has no api_keys or accounts to recognize them by", cfg.Name)}
+	}
+
+	var errs []error
+	for tier, targetModel := range cfg.Tiers {
+		tier = strings.ToLower(tier)
+		if !isModelTier(tier) {
+			errs = append(errs, fmt.Errorf("user %q has unknown model tier %q (expected haiku, sonnet or opus)", cfg.Name, tier))
+			continue
+		}
+		policy.tiers[tier] = targetModel
+	}
+	for _, ruleCfg := range cfg.Rules {
+		rule, err := compileRoutingRule(ruleCfg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %q: %w", cfg.Name, err))
+			continue
+		}
+		policy.rules = append(policy.rules, rule)
+	}
+	return policy, errs
+}
+
+// matches reports whether a request with the given API key and Claude Code
+// account belongs to the user
+func (p *userPolicy) matches(apiKey, account string) bool {
+	if keyMatches(p.apiKeys, apiKey) {
+		return true
+	}
+	if account != "" {
+		for _, a := range p.accounts {
+			if strings.EqualFold(a, account) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// keyMatches reports whether apiKey is one of keys, each configured as is or
+// as "sha256:<hex digest>"
+func keyMatches(keys []string, apiKey string) bool {
+	if apiKey == "" {
+		return false
+	}
+	digest := sha256.Sum256([]byte(apiKey))
+	hashed := "sha256:" + hex.EncodeToString(digest[:])
+	for _, key := range keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 || strings.EqualFold(key, hashed) {
+			return true
+		}
+	}
+	return false
+}
+
+// routing describes the policy for config snapshots
+func (p *userPolicy) routing() model.UserRouting {
+	routing := model.UserRouting{Name: p.name, Mappings: p.mappings, Tiers: p.tiers}
+	for i, ruleCfg := range p.cfg.Rules {
+		routing.Rules = append(routing.Rules, model.RoutingRule{
+			ID:          fmt.Sprintf("user-%s-rule-%d", p.name, i),
+			Name:        ruleCfg.Name,
+			Keywords:    ruleCfg.Keywords,
+			Pattern:     ruleCfg.Pattern,
+			Scope:       ruleCfg.Scope,
+			Models:      ruleCfg.Models,
+			TargetModel: ruleCfg.TargetModel,
+			Provider:    ruleCfg.Provider,
+			Enabled:     true,
+			Position:    i,
+			Source:      model.RuleSourceConfig,
+		})
+	}
+	return routing
+}
+
+// RequestAPIKey returns the key a client authenticated to the proxy with:
+// x-api-key, or the bearer token of the Authorization header
+func RequestAPIKey(header http.Header) string {
+	if key := header.Get("x-api-key"); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// requestAccount returns the Claude Code account UUID from the request's
+// metadata.user_id ("user_<hash>_account_<uuid>_session_<uuid>")
+func requestAccount(req *model.AnthropicRequest) string {
+	if req.Metadata == nil {
+		return ""
+	}
+	_, account, ok := strings.Cut(req.Metadata.UserID, "_account_")
+	if !ok {
+		return ""
+	}
+	account, _, _ = strings.Cut(account, "_session_")
+	return account
+}
+
+// UserFor returns the name of the user policy a request falls under, or ""
+// when it only gets the shared routing
+func (r *ModelRouter) UserFor(apiKey string, req *model.AnthropicRequest) string {
+	if user := r.userPolicy(apiKey, req); user != nil {
+		return user.name
+	}
+	return ""
+}
+
+func (r *ModelRouter) userPolicy(apiKey string, req *model.AnthropicRequest) *userPolicy {
+	r.rulesMu.RLock()
+	defer r.rulesMu.RUnlock()
+	if len(r.users) == 0 {
+		return nil
+	}
+	account := requestAccount(req)
+	for i := range r.users {
+		if r.users[i].matches(apiKey, account) {
+			return &r.users[i]
+		}
+	}
+	return nil
+}
+
+// userMappedAgents returns the agents only user policies map, which need
+// their definitions loaded too
+func (r *ModelRouter) userMappedAgents(shared map[string]string) []string {
+	seen := make(map[string]bool)
+	var agents []string
+	for _, user := range r.users {
+		for agent := range user.mappings {
+			if _, ok := shared[agent]; !ok && !seen[agent] {
+				seen[agent] = true
+				agents = append(agents, agent)
+			}
+		}
+	}
+	sort.Strings(agents)
+	return agents
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/seifghazi/claude-code-monitor/internal/config"
+	"github.com/seifghazi/claude-code-monitor/internal/model"
+	"github.com/seifghazi/claude-code-monitor/internal/provider"
+)
+
+func TestModelRouter_UserPolicies(t *testing.T) {
+	bobDigest := sha256.Sum256([]byte("sk-bob"))
+	cfg := &config.Config{
+		Subagents: config.SubagentsConfig{Enable: true},
+		Routing: config.RoutingConfig{
+			Tiers: map[string]string{"haiku": "gpt-4o-mini"},
+		},
+		Users: []config.UserPolicyConfig{
+			{
+				Name:     "alice",
+				APIKeys:  []string{"sk-alice"},
+				Tiers:    map[string]string{"haiku": "o3-mini"},
+				Mappings: map[string]string{"reviewer": "gpt-4o"},
+				Rules:    []config.RoutingRuleConfig{{Name: "alice-docs", Keywords: []string{"docstring"}, TargetModel: "claude-3-5-haiku-20241022"}},
+			},
+			{
+				Name:    "bob",
+				APIKeys: []string{"sha256:" + hex.EncodeToString(bobDigest[:])},
+				Tiers:   map[string]string{"haiku": ""},
+			},
+			{Name: "carol", Accounts: []string{"0f3c"}},
+			{Name: "nobody"},
+		},
+	}
+	providers := map[string]provider.Provider{
+		"anthropic": &stubProvider{name: "anthropic"},
+		"openai":    &stubProvider{name: "openai"},
+	}
+	router := NewModelRouter(cfg, providers, log.New(io.Discard, "", 0))
+	if len(router.users) != 3 {
+		t.Fatalf("expected the user without keys or accounts to be skipped, got %d users", len(router.users))
+	}
+
+	reviewerPrompt := "You review code."
+	router.customAgentPrompts = map[string]SubagentDefinition{
+		router.hashString(reviewerPrompt): {Name: "reviewer"},
+	}
+
+	request := func(modelName, text string, system ...string) *model.AnthropicRequest {
+		req := &model.AnthropicRequest{
+			Model:    modelName,
+			Metadata: &model.RequestMetadata{UserID: "user_abc_account_0f3c_session_1"},
+			Messages: []model.AnthropicMessage{{Role: "user", Content: text}},
+		}
+		for _, s := range system {
+			req.System = append(req.System, model.AnthropicSystemMessage{Text: s})
+		}
+		return req
+	}
+	haiku := request("claude-3-5-haiku-20241022", "hello")
+	haiku.Metadata = nil
+
+	tests := []struct {
+		name           string
+		apiKey         string
+		request        *model.AnthropicRequest
+		expectedUser   string
+		expectedModel  string
+		expectedReason string
+	}{
+		{"Shared tier", "sk-someone", haiku, "", "gpt-4o-mini", model.RouteReasonTier},
+		{"User tier", "sk-alice", haiku, "alice", "o3-mini", model.RouteReasonTier},
+		{"User opts out of a tier", "sk-bob", haiku, "bob", "claude-3-5-haiku-20241022", model.RouteReasonDefault},
+		{"User by account", "", request("claude-3-5-haiku-20241022", "hello"), "carol", "gpt-4o-mini", model.RouteReasonTier},
+		{"User mapping", "sk-alice", request("claude-sonnet-4", "review", "You are Claude Code.", reviewerPrompt), "alice", "gpt-4o", model.RouteReasonSubagent},
+		{"Other users' mapping", "sk-bob", request("claude-sonnet-4", "review", "You are Claude Code.", reviewerPrompt), "bob", "claude-sonnet-4", model.RouteReasonDefault},
+		{"User rule", "sk-alice", request("claude-sonnet-4", "add a docstring"), "alice", "claude-3-5-haiku-20241022", model.RouteReasonRule},
+		{"Other users' rule", "sk-bob", request("claude-sonnet-4", "add a docstring"), "bob", "claude-sonnet-4", model.RouteReasonDefault},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := router.DetermineRouteForKey(tt.request, tt.apiKey)
+			if err != nil {
+				t.Fatalf("DetermineRouteForKey() returned error: %v", err)
+			}
+			if decision.Explanation.User != tt.expectedUser {
+				t.Errorf("User = %q, want %q", decision.Explanation.User, tt.expectedUser)
+			}
+			if decision.TargetModel != tt.expectedModel || decision.Explanation.Reason != tt.expectedReason {
+				t.Errorf("routed to %s (%s), want %s (%s)", decision.TargetModel, decision.Explanation.Reason, tt.expectedModel, tt.expectedReason)
+			}
+		})
+	}
+}
+
+func TestRequestAPIKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected string
+	}{
+		{"x-api-key", http.Header{"X-Api-Key": {"sk-ant-1"}}, "sk-ant-1"},
+		{"Bearer token", http.Header{"Authorization": {"Bearer sk-litellm"}}, "sk-litellm"},
+		{"Other scheme", http.Header{"Authorization": {"Basic abc"}}, ""},
+		{"None", http.Header{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RequestAPIKey(tt.header); got != tt.expected {
+				t.Errorf("RequestAPIKey() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
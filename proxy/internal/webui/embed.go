@@ -0,0 +1,20 @@
+//go:build embedui
+
+package webui
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+// FS returns the dashboard's static files
+func FS() (fs.FS, bool) {
+	files, err := fs.Sub(dist, "dist/client")
+	if err != nil {
+		return nil, false
+	}
+	return files, true
+}
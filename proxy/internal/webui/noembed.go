@@ -0,0 +1,11 @@
+//go:build !embedui
+
+package webui
+
+import "io/fs"
+
+// FS returns the dashboard's static files, or false when the binary was built
+// without them
+func FS() (fs.FS, bool) {
+	return nil, false
+}
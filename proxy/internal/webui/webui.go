@@ -0,0 +1,5 @@
+// Package webui holds the dashboard when it is built into the binary. Release
+// builds embed it with the embedui build tag, after the web app has been built
+// into dist with `npm run build:embed`; other builds serve the dashboard from
+// the separate web server.
+package webui
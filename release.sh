@@ -0,0 +1,62 @@
+#!/bin/bash
+
+# Claude Code Monitor - Release Build Script
+#
+# Builds a single binary per platform with the dashboard embedded, so running
+# it needs neither Node.js nor Go. The SQLite driver uses cgo, so zig
+# (https://ziglang.org) is used as the C compiler for every target; Linux
+# binaries are linked statically against musl.
+#
+#   ./release.sh                          # all targets, into dist/
+#   TARGETS="linux/arm64" ./release.sh    # just a Raspberry Pi build
+
+set -e
+
+VERSION=${VERSION:-$(git describe --tags --always --dirty 2>/dev/null || echo dev)}
+TARGETS=${TARGETS:-"linux/amd64 linux/arm64 linux/arm darwin/amd64 darwin/arm64 windows/amd64"}
+OUT=${OUT:-dist}
+
+if ! command -v zig &> /dev/null; then
+    echo "❌ zig is not installed; it is needed to cross-compile SQLite."
+    exit 1
+fi
+
+# zig target for each platform
+zig_target() {
+    case "$1" in
+        linux/amd64)   echo "x86_64-linux-musl" ;;
+        linux/arm64)   echo "aarch64-linux-musl" ;;
+        linux/arm)     echo "arm-linux-musleabihf" ;;
+        darwin/amd64)  echo "x86_64-macos" ;;
+        darwin/arm64)  echo "aarch64-macos" ;;
+        windows/amd64) echo "x86_64-windows-gnu" ;;
+        *) return 1 ;;
+    esac
+}
+
+echo "🔨 Building dashboard..."
+(cd web && npm ci && npm run build:embed)
+
+mkdir -p "$OUT"
+for target in $TARGETS; do
+    os=${target%/*}
+    arch=${target#*/}
+    if ! zt=$(zig_target "$target"); then
+        echo "❌ Unsupported target $target"
+        exit 1
+    fi
+
+    name="claude-code-proxy_${VERSION}_${os}_${arch}"
+    [ "$os" = "windows" ] && name="$name.exe"
+
+    ldflags="-s -w -X main.version=$VERSION"
+    [ "$os" = "linux" ] && ldflags="$ldflags -linkmode external -extldflags -static"
+
+    echo "🔨 Building $name..."
+    (cd proxy && CGO_ENABLED=1 GOOS=$os GOARCH=$arch GOARM=7 CC="zig cc -target $zt" \
+        go build -trimpath -tags "embedui sqlite_fts5 sqlite_omit_load_extension osusergo netgo" \
+        -ldflags "$ldflags" -o "../$OUT/$name" ./cmd/proxy)
+done
+
+(cd "$OUT" && sha256sum claude-code-proxy_* > checksums.txt)
+echo "✅ Binaries written to $OUT/"
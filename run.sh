@@ -50,7 +50,7 @@ trap cleanup EXIT INT TERM
 echo -e "\n${BLUE}📦 Building proxy server...${NC}"
 cd proxy
 go mod download
-go build -o ../bin/proxy cmd/proxy/main.go
+go build -tags sqlite_fts5 -o ../bin/proxy ./cmd/proxy
 cd ..
 
 echo -e "${GREEN}✅ Proxy server built${NC}"
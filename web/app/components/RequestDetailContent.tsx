@@ -1,4 +1,4 @@
-import { useState } from 'react';
+import { useEffect, useState } from 'react';
 import { 
   ChevronDown, 
   Info, 
@@ -26,12 +26,29 @@ import { getChatCompletionsEndpoint, getProviderName } from '../utils/models';
 
 interface Request {
   id: number;
+  requestId?: string;
   timestamp: string;
   method: string;
   endpoint: string;
   headers: Record<string, string[]>;
   originalModel?: string;
   routedModel?: string;
+  requestBytes?: number;
+  requestWireBytes?: number;
+  configGeneration?: number;
+  routing?: {
+    reason: 'hook' | 'subagent' | 'rule' | 'experiment' | 'size' | 'tier' | 'override' | 'default';
+    detail: string;
+    subagent?: string;
+    promptHash?: string;
+    rule?: string;
+    provider: string;
+    user?: string;
+    canary?: 'canary' | 'baseline';
+    continuationOf?: string;
+    continuedBy?: string;
+    adjustments?: string[];
+  };
   body?: {
     model?: string;
     messages?: Array<{
@@ -65,6 +82,28 @@ interface Request {
     streamingChunks?: string[];
     isStreaming: boolean;
     completedAt: string;
+    origin?: 'upstream' | 'cache' | 'synthetic' | 'fallback';
+    failover?: {
+      fromModel: string;
+      fromProvider: string;
+      statusCode: number;
+    };
+    bodyBytes?: number;
+    wireBytes?: number;
+    timeToFirstToken?: number;
+    streamDuration?: number;
+    chunkCount?: number;
+    tokensPerSecond?: number;
+  };
+  shadow?: {
+    model: string;
+    provider: string;
+    statusCode?: number;
+    body?: any;
+    bodyText?: string;
+    error?: string;
+    responseTime: number;
+    completedAt: string;
   };
   promptGrade?: {
     score: number;
@@ -156,6 +195,17 @@ export default function RequestDetailContent({ request, onGrade }: RequestDetail
                 {getChatCompletionsEndpoint(request.routedModel, request.endpoint)}
               </code>
             </div>
+            {request.requestBytes ? (
+              <div className="flex items-center space-x-3">
+                <span className="text-gray-500 font-medium min-w-[80px]">Size:</span>
+                <span className="text-gray-900">
+                  {formatBytes(request.requestBytes)}
+                  {request.requestWireBytes && request.requestWireBytes !== request.requestBytes
+                    ? ` (${formatBytes(request.requestWireBytes)} on the wire)`
+                    : ''}
+                </span>
+              </div>
+            ) : null}
           </div>
           <div className="space-y-3">
             <div className="flex items-center space-x-3">
@@ -356,6 +406,11 @@ export default function RequestDetailContent({ request, onGrade }: RequestDetail
                             {getProviderName(request.routedModel)}
                           </span>
                         </div>
+                        {request.response?.failover && (
+                          <div className="mt-2 text-xs text-amber-700">
+                            Failed over after {request.response.failover.fromModel} ({request.response.failover.fromProvider}) returned {request.response.failover.statusCode}
+                          </div>
+                        )}
                       </div>
                       <div className="text-right">
                         <div className="text-xs text-gray-500 mb-1">Target Endpoint</div>
@@ -367,6 +422,47 @@ export default function RequestDetailContent({ request, onGrade }: RequestDetail
                   </div>
                 )}
 
+                {/* Why the router picked this route */}
+                {request.routing && (
+                  <div className="bg-gray-50 border border-gray-200 rounded-lg p-3 text-xs space-y-1">
+                    <div className="flex items-center space-x-2">
+                      <span className="text-gray-500">Routing decision</span>
+                      <span className="bg-purple-100 text-purple-700 px-2 py-0.5 rounded-full border border-purple-200 font-medium">
+                        {request.routing.reason}
+                      </span>
+                      <span className="text-gray-500">via {request.routing.provider}</span>
+                      {request.routing.user && (
+                        <span className="text-gray-400">policy of {request.routing.user}</span>
+                      )}
+                      {request.routing.canary && (
+                        <span className="text-gray-400">{request.routing.canary} side of a routing canary</span>
+                      )}
+                      {request.configGeneration ? (
+                        <span className="text-gray-400">config generation {request.configGeneration}</span>
+                      ) : null}
+                    </div>
+                    <div className="text-gray-800">{request.routing.detail}</div>
+                    {request.routing.promptHash && (
+                      <div className="text-gray-500">
+                        Prompt hash <code className="font-mono text-gray-700">{request.routing.promptHash}</code>
+                      </div>
+                    )}
+                    {request.routing.continuedBy && (
+                      <div className="text-gray-500">
+                        Cut off in a tool call; continued by <code className="font-mono text-gray-700">{request.routing.continuedBy}</code>
+                      </div>
+                    )}
+                    {request.routing.continuationOf && (
+                      <div className="text-gray-500">
+                        Continuation of <code className="font-mono text-gray-700">{request.routing.continuationOf}</code>
+                      </div>
+                    )}
+                    {request.routing.adjustments?.map((adjustment, i) => (
+                      <div key={i} className="text-amber-700">{adjustment}</div>
+                    ))}
+                  </div>
+                )}
+
                 {/* Model Parameters */}
                 <div className="grid grid-cols-2 gap-4">
                   {!request.routedModel || request.routedModel === request.originalModel ? (
@@ -403,6 +499,33 @@ export default function RequestDetailContent({ request, onGrade }: RequestDetail
         <ResponseDetails response={request.response} />
       )}
 
+      {/* Live view of a response that is still streaming to the client */}
+      {!request.response && request.body?.stream && request.requestId && (
+        <LiveResponse requestId={request.requestId} />
+      )}
+
+      {/* Shadow Response (stored for comparison, never returned to the client) */}
+      {request.shadow && (
+        <div className="bg-white border border-gray-200 rounded-xl shadow-sm p-6">
+          <div className="flex items-center justify-between mb-3">
+            <h4 className="text-lg font-semibold text-gray-900">Shadow Response</h4>
+            <div className="flex items-center space-x-2 text-xs">
+              <code className="bg-gray-100 px-2 py-1 rounded font-mono">{request.shadow.model}</code>
+              <span className="text-gray-500">{request.shadow.provider}</span>
+              {request.shadow.statusCode ? <span className="text-gray-500">{request.shadow.statusCode}</span> : null}
+              <span className="text-gray-500">{request.shadow.responseTime}ms</span>
+            </div>
+          </div>
+          {request.shadow.error ? (
+            <div className="text-sm text-red-700">{request.shadow.error}</div>
+          ) : (
+            <pre className="text-xs bg-gray-50 border border-gray-200 rounded-lg p-3 overflow-x-auto whitespace-pre-wrap">
+              {request.shadow.body ? JSON.stringify(request.shadow.body, null, 2) : request.shadow.bodyText}
+            </pre>
+          )}
+        </div>
+      )}
+
       {/* Prompt Grading Results */}
       {request.promptGrade && (
         <PromptGradingResults promptGrade={request.promptGrade} />
@@ -471,7 +594,70 @@ function PromptGradingResults({ promptGrade }: { promptGrade: any }) {
   );
 }
 
+// Live Response Component: attaches to /api/v1/streams/{id} and shows the text
+// as it is generated
+function LiveResponse({ requestId }: { requestId: string }) {
+  const [text, setText] = useState('');
+  const [status, setStatus] = useState<'connecting' | 'streaming' | 'done' | 'unavailable'>('connecting');
+
+  useEffect(() => {
+    setText('');
+    setStatus('connecting');
+    const source = new EventSource(`/api/v1/streams/${encodeURIComponent(requestId)}`);
+    source.onmessage = (message) => {
+      setStatus('streaming');
+      try {
+        const event = JSON.parse(message.data);
+        if (event.type === 'content_block_delta' && event.delta?.type === 'text_delta') {
+          setText(prev => prev + event.delta.text);
+        }
+      } catch {
+        // Not every line is JSON
+      }
+    };
+    source.addEventListener('done', () => {
+      setStatus('done');
+      source.close();
+    });
+    // A watcher that fell behind is replayed from the start
+    source.addEventListener('lagged', () => setText(''));
+    source.onerror = () => {
+      setStatus(prev => (prev === 'connecting' ? 'unavailable' : prev));
+      if (source.readyState === EventSource.CLOSED) {
+        source.close();
+      }
+    };
+    return () => source.close();
+  }, [requestId]);
+
+  return (
+    <div className="bg-white border border-gray-200 rounded-xl shadow-sm p-6">
+      <div className="flex items-center justify-between mb-3">
+        <h4 className="text-lg font-semibold text-gray-900 flex items-center space-x-2">
+          <Wifi className="w-5 h-5 text-blue-600" />
+          <span>Live Response</span>
+        </h4>
+        <span className="text-xs text-gray-500">
+          {status === 'connecting' ? 'Connecting…' :
+           status === 'streaming' ? 'Streaming' :
+           status === 'done' ? 'Finished, reload to see the stored response' :
+           'Not streaming right now'}
+        </span>
+      </div>
+      <pre className="text-sm bg-gray-50 border border-gray-200 rounded-lg p-3 overflow-x-auto whitespace-pre-wrap">
+        {text || '…'}
+      </pre>
+    </div>
+  );
+}
+
 // Response Details Component
+const formatBytes = (bytes: number) => {
+  if (bytes < 1024) return `${bytes} B`;
+  if (bytes < 1024 * 1024) return `${(bytes / 1024).toFixed(1)} KB`;
+  return `${(bytes / (1024 * 1024)).toFixed(1)} MB`;
+};
+
 function ResponseDetails({ response }: { response: NonNullable<Request['response']> }) {
   const [expandedSections, setExpandedSections] = useState<Record<string, boolean>>({
     overview: true
@@ -601,6 +787,11 @@ function ResponseDetails({ response }: { response: NonNullable<Request['response
             <span className={`text-xs px-2 py-1 rounded-full border ${statusColors.bg} ${statusColors.text} ${statusColors.border}`}>
               {response.statusCode}
             </span>
+            {response.origin && response.origin !== 'upstream' && (
+              <span className="text-xs px-2 py-1 rounded-full border bg-gray-100 text-gray-600 border-gray-200">
+                {response.origin === 'synthetic' ? 'made by the proxy' : `from ${response.origin}`}
+              </span>
+            )}
           </h4>
           <ChevronDown className={`w-5 h-5 text-gray-500 transition-transform ${
             expandedSections.overview ? 'rotate-180' : ''
@@ -633,6 +824,8 @@ function ResponseDetails({ response }: { response: NonNullable<Request['response
               <div className="text-lg font-bold text-blue-700">{response.responseTime}ms</div>
               <div className="text-xs text-blue-700 opacity-75">
                 {response.responseTime < 1000 ? 'Fast' : response.responseTime < 3000 ? 'Normal' : 'Slow'}
+                {response.timeToFirstToken ? ` · first token ${response.timeToFirstToken}ms` : ''}
+                {response.tokensPerSecond ? ` · ${response.tokensPerSecond} tok/s` : ''}
               </div>
             </div>
             
@@ -646,6 +839,8 @@ function ResponseDetails({ response }: { response: NonNullable<Request['response
               </div>
               <div className="text-xs text-purple-700 opacity-75">
                 {response.isStreaming ? 'Streaming' : 'Complete'}
+                {response.bodyBytes ? ` · ${formatBytes(response.bodyBytes)}` : ''}
+                {response.wireBytes && response.wireBytes !== response.bodyBytes ? ` (${formatBytes(response.wireBytes)} on the wire)` : ''}
               </div>
             </div>
             
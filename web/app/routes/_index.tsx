@@ -45,6 +45,7 @@ export const meta: MetaFunction = () => {
 
 interface Request {
   id: number;
+  requestId?: string;
   conversationId?: string;
   turnNumber?: number;
   isRoot?: boolean;
@@ -96,6 +97,8 @@ interface Request {
     streamingChunks?: string[];
     isStreaming: boolean;
     completedAt: string;
+    timeToFirstToken?: number;
+    tokensPerSecond?: number;
   };
   promptGrade?: {
     score: number;
@@ -154,6 +157,7 @@ export default function Index() {
   const [hasMoreRequests, setHasMoreRequests] = useState(true);
   const [conversationsCurrentPage, setConversationsCurrentPage] = useState(1);
   const [hasMoreConversations, setHasMoreConversations] = useState(true);
+  const [trashedCount, setTrashedCount] = useState(0);
   const itemsPerPage = 50;
 
   const loadRequests = async (filter?: string, loadMore = false) => {
@@ -161,7 +165,7 @@ export default function Index() {
     const pageToFetch = loadMore ? requestsCurrentPage + 1 : 1;
     try {
       const currentModelFilter = filter || modelFilter;
-      const url = new URL('/api/requests', window.location.origin);
+      const url = new URL('/api/v1/requests', window.location.origin);
       url.searchParams.append("page", pageToFetch.toString());
       url.searchParams.append("limit", itemsPerPage.toString());
       if (currentModelFilter !== "all") {
@@ -203,7 +207,7 @@ export default function Index() {
     setIsFetching(true);
     const pageToFetch = loadMore ? conversationsCurrentPage + 1 : 1;
     try {
-      const url = new URL('/api/conversations', window.location.origin);
+      const url = new URL('/api/v1/conversations', window.location.origin);
       url.searchParams.append("page", pageToFetch.toString());
       url.searchParams.append("limit", itemsPerPage.toString());
       if (modelFilter !== "all") {
@@ -237,7 +241,7 @@ export default function Index() {
 
   const loadConversationDetails = async (conversationId: string, projectName: string) => {
     try {
-      const response = await fetch(`/api/conversations/${conversationId}?project=${encodeURIComponent(projectName)}`);
+      const response = await fetch(`/api/v1/conversations/${conversationId}?project=${encodeURIComponent(projectName)}`);
       if (!response.ok) {
         throw new Error(`HTTP error! status: ${response.status}`);
       }
@@ -252,11 +256,13 @@ export default function Index() {
 
   const clearRequests = async () => {
     try {
-      const response = await fetch('/api/requests', {
+      const response = await fetch('/api/v1/requests', {
         method: 'DELETE'
       });
       
       if (response.ok) {
+        const data = await response.json();
+        setTrashedCount(data.deleted || 0);
         setRequests([]);
         setConversations([]);
         setRequestsCurrentPage(1);
@@ -270,6 +276,21 @@ export default function Index() {
     }
   };
 
+  const restoreRequests = async () => {
+    try {
+      const response = await fetch('/api/v1/trash/restore', {
+        method: 'POST'
+      });
+
+      if (response.ok) {
+        setTrashedCount(0);
+        loadRequests();
+      }
+    } catch (error) {
+      console.error('Failed to restore requests:', error);
+    }
+  };
+
   const filterRequests = (filter: string) => {
     if (filter === 'all') return requests;
     
@@ -347,6 +368,24 @@ export default function Index() {
     if (request) {
       setSelectedRequest(request);
       setIsModalOpen(true);
+      if (request.requestId) {
+        loadRequestDetails(request);
+      }
+    }
+  };
+
+  // The list may be out of date (a response still streaming, a grade added
+  // since), so the detail view reloads the full log by its exact ID
+  const loadRequestDetails = async (request: Request) => {
+    try {
+      const response = await fetch(`/api/v1/requests/${encodeURIComponent(request.requestId!)}`);
+      if (!response.ok) {
+        return;
+      }
+      const full = await response.json();
+      setSelectedRequest(current => current && current.id === request.id ? { ...full, id: request.id } : current);
+    } catch (error) {
+      console.error('Failed to load request details:', error);
     }
   };
 
@@ -516,6 +555,13 @@ export default function Index() {
               <h1 className="text-lg font-semibold text-gray-900">Claude Code Monitor</h1>
             </div>
             <div className="flex items-center space-x-2">
+              <a
+                href="/routing"
+                className="p-1.5 text-gray-600 hover:bg-gray-100 rounded transition-colors"
+                title="Routing rules"
+              >
+                <Settings className="w-4 h-4" />
+              </a>
               <button
                 onClick={() => loadRequests()}
                 className="p-1.5 text-gray-600 hover:bg-gray-100 rounded transition-colors"
@@ -535,6 +581,26 @@ export default function Index() {
         </div>
       </header>
 
+      {/* Undo for a cleared history, while the requests are in the trash */}
+      {trashedCount > 0 && (
+        <div className="mb-4 flex items-center justify-center space-x-3 text-xs text-gray-600">
+          <span>Moved {trashedCount} request{trashedCount === 1 ? '' : 's'} to the trash.</span>
+          <button
+            onClick={restoreRequests}
+            className="font-medium text-blue-600 hover:text-blue-800"
+          >
+            Restore
+          </button>
+          <button
+            onClick={() => setTrashedCount(0)}
+            className="text-gray-400 hover:text-gray-600"
+            title="Dismiss"
+          >
+            <X className="w-3 h-3" />
+          </button>
+        </div>
+      )}
+
       {/* View mode toggle */}
       <div className="mb-4 flex justify-center">
         <div className="inline-flex items-center bg-gray-100 rounded p-0.5">
@@ -721,6 +787,13 @@ export default function Index() {
                                 <span className="font-medium text-gray-900">{(request.response.responseTime / 1000).toFixed(2)}</span>s
                               </span>
                             )}
+
+                            {request.response?.timeToFirstToken && (
+                              <span className="font-mono text-gray-600" title="Time to first token">
+                                TTFT <span className="font-medium text-gray-900">{(request.response.timeToFirstToken / 1000).toFixed(2)}</span>s
+                                {request.response.tokensPerSecond ? ` · ${request.response.tokensPerSecond.toFixed(0)} tok/s` : ''}
+                              </span>
+                            )}
                           </div>
                         </div>
                         <div className="flex-shrink-0 text-right">
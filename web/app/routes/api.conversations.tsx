@@ -1,17 +1,21 @@
 import type { LoaderFunction } from "@remix-run/node";
 import { json } from "@remix-run/node";
+import { backendAuth, signInRequired } from "../utils/backend";
 
 export const loader: LoaderFunction = async ({ request }) => {
   try {
     const url = new URL(request.url);
     const modelFilter = url.searchParams.get("model");
 
-    const backendUrl = new URL('http://localhost:3001/api/conversations');
+    const backendUrl = new URL('http://localhost:3001/api/v1/conversations');
     if (modelFilter) {
       backendUrl.searchParams.append('model', modelFilter);
     }
 
-    const response = await fetch(backendUrl.toString());
+    const response = await fetch(backendUrl.toString(), { headers: backendAuth(request) });
+    if (response.status === 401) {
+      return signInRequired();
+    }
     
     if (!response.ok) {
       throw new Error(`HTTP error! status: ${response.status}`);
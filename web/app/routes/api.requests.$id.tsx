@@ -0,0 +1,18 @@
+import type { LoaderFunction } from "@remix-run/node";
+import { json } from "@remix-run/node";
+import { backendAuth, signInRequired } from "../utils/backend";
+
+// Fetches the full log of one request from the Go backend for the detail view
+export const loader: LoaderFunction = async ({ params, request }) => {
+  const backendUrl = `http://localhost:3001/api/v1/requests/${encodeURIComponent(params.id || '')}`;
+  try {
+    const response = await fetch(backendUrl, { headers: backendAuth(request) });
+    if (response.status === 401) {
+      return signInRequired();
+    }
+    return json(await response.json(), { status: response.status });
+  } catch (error) {
+    console.error('Failed to fetch request:', error);
+    return json({ error: 'Failed to fetch request' }, { status: 502 });
+  }
+};
@@ -1,5 +1,6 @@
 import type { ActionFunction, LoaderFunction } from "@remix-run/node";
 import { json } from "@remix-run/node";
+import { backendAuth, signInRequired } from "../utils/backend";
 
 export const loader: LoaderFunction = async ({ request }) => {
   try {
@@ -9,7 +10,7 @@ export const loader: LoaderFunction = async ({ request }) => {
     const limit = url.searchParams.get("limit");
 
     // Forward the request to the Go backend
-    const backendUrl = new URL('http://localhost:3001/api/requests');
+    const backendUrl = new URL('http://localhost:3001/api/v1/requests');
     if (modelFilter) {
       backendUrl.searchParams.append('model', modelFilter);
     }
@@ -20,7 +21,10 @@ export const loader: LoaderFunction = async ({ request }) => {
       backendUrl.searchParams.append('limit', limit);
     }
 
-    const response = await fetch(backendUrl.toString());
+    const response = await fetch(backendUrl.toString(), { headers: backendAuth(request) });
+    if (response.status === 401) {
+      return signInRequired();
+    }
     
     if (!response.ok) {
       throw new Error(`HTTP error! status: ${response.status}`);
@@ -42,15 +46,20 @@ export const action: ActionFunction = async ({ request }) => {
   if (method === "DELETE") {
     try {
       // Forward the DELETE request to the Go backend
-      const response = await fetch('http://localhost:3001/api/requests', {
-        method: 'DELETE'
+      const response = await fetch('http://localhost:3001/api/v1/requests', {
+        method: 'DELETE',
+        headers: backendAuth(request)
       });
+      if (response.status === 401) {
+        return signInRequired();
+      }
       
       if (!response.ok) {
         throw new Error(`HTTP error! status: ${response.status}`);
       }
       
-      return json({ success: true });
+      const data = await response.json();
+      return json({ success: true, deleted: data.deleted });
     } catch (error) {
       console.error('Failed to clear requests:', error);
       return json({ success: false, error: 'Failed to clear requests' }, { status: 500 });
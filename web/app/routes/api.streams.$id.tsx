@@ -0,0 +1,24 @@
+import type { LoaderFunction } from "@remix-run/node";
+import { backendAuth, signInRequired } from "../utils/backend";
+
+// Relays a response that is still streaming from the Go backend, so the
+// dashboard can watch it live
+export const loader: LoaderFunction = async ({ params, request }) => {
+  const backendUrl = `http://localhost:3001/api/v1/streams/${encodeURIComponent(params.id || '')}`;
+  try {
+    const response = await fetch(backendUrl, { headers: backendAuth(request), signal: request.signal });
+    if (response.status === 401) {
+      return signInRequired();
+    }
+    return new Response(response.body, {
+      status: response.status,
+      headers: {
+        'Content-Type': response.headers.get('Content-Type') || 'text/event-stream',
+        'Cache-Control': 'no-cache',
+      },
+    });
+  } catch (error) {
+    console.error('Failed to watch stream:', error);
+    return new Response(null, { status: 502 });
+  }
+};
@@ -0,0 +1,30 @@
+import type { ActionFunction } from "@remix-run/node";
+import { json } from "@remix-run/node";
+import { backendAuth, signInRequired } from "../utils/backend";
+
+export const action: ActionFunction = async ({ request }) => {
+  if (request.method !== "POST") {
+    return json({ error: 'Method not allowed' }, { status: 405 });
+  }
+
+  try {
+    // Forward the request to the Go backend, which restores everything in the trash without a body
+    const response = await fetch('http://localhost:3001/api/v1/trash/restore', {
+      method: 'POST',
+      headers: backendAuth(request)
+    });
+    if (response.status === 401) {
+      return signInRequired();
+    }
+
+    if (!response.ok) {
+      throw new Error(`HTTP error! status: ${response.status}`);
+    }
+
+    const data = await response.json();
+    return json(data);
+  } catch (error) {
+    console.error('Failed to restore requests:', error);
+    return json({ error: 'Failed to restore requests' }, { status: 500 });
+  }
+};
@@ -0,0 +1,230 @@
+import type { ClientActionFunctionArgs, MetaFunction } from "@remix-run/react";
+import { Form, useActionData, useLoaderData, useNavigation } from "@remix-run/react";
+import { ArrowLeft, Plus, Trash2 } from "lucide-react";
+
+// Loaded in the browser, so the page works in the dashboard embedded in the
+// proxy as well as from the dev server, which forwards /api to it
+const BACKEND_URL = '/api/v1/routing/rules';
+
+interface RoutingRule {
+  id: string;
+  name: string;
+  subagent?: string;
+  keywords?: string[];
+  pattern?: string;
+  scope?: string;
+  models?: string[];
+  targetModel: string;
+  provider?: string;
+  enabled: boolean;
+  position: number;
+  source: 'config' | 'api';
+}
+
+export const meta: MetaFunction = () => {
+  return [{ title: "Routing Rules - Claude Code Monitor" }];
+};
+
+export const clientLoader = async () => {
+  try {
+    const response = await fetch(BACKEND_URL);
+
+    if (!response.ok) {
+      throw new Error(`HTTP error! status: ${response.status}`);
+    }
+
+    return await response.json();
+  } catch (error) {
+    console.error('Failed to fetch routing rules:', error);
+
+    // Return no rules if backend is not available
+    return { rules: [] };
+  }
+};
+
+export function HydrateFallback() {
+  return <div className="min-h-screen bg-gray-50" />;
+}
+
+const splitList = (value: FormDataEntryValue | null) =>
+  String(value || '')
+    .split(',')
+    .map((item) => item.trim())
+    .filter(Boolean);
+
+export const clientAction = async ({ request }: ClientActionFunctionArgs) => {
+  const form = await request.formData();
+  const intent = form.get('intent');
+
+  let response: Response;
+  if (intent === 'create') {
+    const rule = {
+      name: String(form.get('name') || ''),
+      subagent: String(form.get('subagent') || '') || undefined,
+      keywords: splitList(form.get('keywords')),
+      pattern: String(form.get('pattern') || '') || undefined,
+      models: splitList(form.get('models')),
+      targetModel: String(form.get('targetModel') || ''),
+      provider: String(form.get('provider') || '') || undefined,
+      position: Number(form.get('position') || 0),
+      enabled: true,
+    };
+    response = await fetch(BACKEND_URL, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(rule),
+    });
+  } else if (intent === 'toggle') {
+    const rule = JSON.parse(String(form.get('rule')));
+    response = await fetch(`${BACKEND_URL}/${rule.id}`, {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ ...rule, enabled: !rule.enabled }),
+    });
+  } else if (intent === 'delete') {
+    response = await fetch(`${BACKEND_URL}/${form.get('id')}`, { method: 'DELETE' });
+  } else {
+    return { error: 'Unknown action' };
+  }
+
+  if (!response.ok) {
+    const body = await response.json().catch(() => ({}));
+    return { error: body.error || `HTTP error! status: ${response.status}` };
+  }
+  return { error: null };
+};
+
+function describeMatch(rule: RoutingRule) {
+  if (rule.subagent) {
+    return `Subagent "${rule.subagent}"`;
+  }
+  const parts = [];
+  if (rule.keywords?.length) {
+    parts.push(`Keywords: ${rule.keywords.join(', ')}`);
+  }
+  if (rule.pattern) {
+    parts.push(`Pattern: ${rule.pattern}`);
+  }
+  if (rule.models?.length) {
+    parts.push(`Models: ${rule.models.join(', ')}`);
+  }
+  return parts.join(' · ');
+}
+
+export default function Routing() {
+  const { rules } = useLoaderData<{ rules: RoutingRule[] }>();
+  const actionData = useActionData<{ error: string | null }>();
+  const navigation = useNavigation();
+  const busy = navigation.state !== 'idle';
+
+  return (
+    <div className="min-h-screen bg-gray-50">
+      <header className="sticky top-0 z-40 bg-white border-b border-gray-200">
+        <div className="max-w-7xl mx-auto px-6 py-3">
+          <div className="flex items-center space-x-3">
+            <a href="/" className="p-1.5 text-gray-600 hover:bg-gray-100 rounded transition-colors" title="Back">
+              <ArrowLeft className="w-4 h-4" />
+            </a>
+            <h1 className="text-lg font-semibold text-gray-900">Routing Rules</h1>
+          </div>
+        </div>
+      </header>
+
+      <main className="max-w-7xl mx-auto px-6 py-6 space-y-6">
+        {actionData?.error && (
+          <div className="bg-red-50 border border-red-200 text-red-700 text-sm rounded p-3">
+            {actionData.error}
+          </div>
+        )}
+
+        <div className="bg-white border border-gray-200 rounded-lg overflow-hidden">
+          <table className="w-full text-sm">
+            <thead className="bg-gray-50 text-gray-600 text-xs uppercase">
+              <tr>
+                <th className="text-left px-4 py-2">Name</th>
+                <th className="text-left px-4 py-2">Match</th>
+                <th className="text-left px-4 py-2">Target</th>
+                <th className="text-left px-4 py-2">Source</th>
+                <th className="text-right px-4 py-2">Actions</th>
+              </tr>
+            </thead>
+            <tbody className="divide-y divide-gray-100">
+              {rules.length === 0 && (
+                <tr>
+                  <td colSpan={5} className="px-4 py-6 text-center text-gray-500">No routing rules yet</td>
+                </tr>
+              )}
+              {rules.map((rule) => (
+                <tr key={rule.id} className={rule.enabled ? '' : 'opacity-50'}>
+                  <td className="px-4 py-2 font-medium text-gray-900">{rule.name}</td>
+                  <td className="px-4 py-2 text-gray-600">{describeMatch(rule)}</td>
+                  <td className="px-4 py-2 font-mono text-xs text-gray-800">
+                    {rule.targetModel}
+                    {rule.provider && <span className="text-gray-500"> ({rule.provider})</span>}
+                  </td>
+                  <td className="px-4 py-2 text-gray-500">{rule.source}</td>
+                  <td className="px-4 py-2">
+                    {rule.source === 'api' ? (
+                      <div className="flex items-center justify-end space-x-2">
+                        <Form method="post">
+                          <input type="hidden" name="intent" value="toggle" />
+                          <input type="hidden" name="rule" value={JSON.stringify(rule)} />
+                          <button
+                            type="submit"
+                            disabled={busy}
+                            className="px-2 py-1 text-xs rounded border border-gray-200 hover:bg-gray-50"
+                          >
+                            {rule.enabled ? 'Disable' : 'Enable'}
+                          </button>
+                        </Form>
+                        <Form method="post">
+                          <input type="hidden" name="intent" value="delete" />
+                          <input type="hidden" name="id" value={rule.id} />
+                          <button
+                            type="submit"
+                            disabled={busy}
+                            className="p-1.5 text-red-600 hover:bg-red-50 rounded transition-colors"
+                            title="Delete rule"
+                          >
+                            <Trash2 className="w-4 h-4" />
+                          </button>
+                        </Form>
+                      </div>
+                    ) : (
+                      <div className="text-right text-xs text-gray-400">config.yaml</div>
+                    )}
+                  </td>
+                </tr>
+              ))}
+            </tbody>
+          </table>
+        </div>
+
+        <Form method="post" className="bg-white border border-gray-200 rounded-lg p-4 space-y-3">
+          <input type="hidden" name="intent" value="create" />
+          <h2 className="text-sm font-semibold text-gray-900">New rule</h2>
+          <p className="text-xs text-gray-500">
+            Set a subagent to map that agent to the target model, or keywords and/or a pattern to route requests by content.
+          </p>
+          <div className="grid grid-cols-1 md:grid-cols-4 gap-3 text-sm">
+            <input name="name" placeholder="Name" required className="border border-gray-200 rounded px-2 py-1.5" />
+            <input name="subagent" placeholder="Subagent (optional)" className="border border-gray-200 rounded px-2 py-1.5" />
+            <input name="keywords" placeholder="Keywords, comma separated" className="border border-gray-200 rounded px-2 py-1.5" />
+            <input name="pattern" placeholder="Regex pattern" className="border border-gray-200 rounded px-2 py-1.5" />
+            <input name="models" placeholder="Only for models, comma separated" className="border border-gray-200 rounded px-2 py-1.5" />
+            <input name="targetModel" placeholder="Target model" required className="border border-gray-200 rounded px-2 py-1.5" />
+            <input name="provider" placeholder="Provider (optional)" className="border border-gray-200 rounded px-2 py-1.5" />
+            <input name="position" type="number" placeholder="Position" className="border border-gray-200 rounded px-2 py-1.5" />
+          </div>
+          <button
+            type="submit"
+            disabled={busy}
+            className="inline-flex items-center px-3 py-1.5 text-xs font-medium rounded bg-gray-900 text-white hover:bg-gray-800"
+          >
+            <Plus className="w-3 h-3 mr-1" /> Add rule
+          </button>
+        </Form>
+      </main>
+    </div>
+  );
+}
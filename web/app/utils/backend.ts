@@ -0,0 +1,26 @@
+/**
+ * Helpers for calling the Go backend from loaders and actions
+ */
+
+/**
+ * The credentials the dashboard was called with, passed on to the backend so a
+ * proxy partitioned by user shows each caller only their own requests
+ */
+export function backendAuth(request: Request): Record<string, string> {
+  const headers: Record<string, string> = {};
+  for (const name of ['Authorization', 'x-api-key']) {
+    const value = request.headers.get(name);
+    if (value) headers[name] = value;
+  }
+  return headers;
+}
+
+/**
+ * Asks the browser to prompt for credentials; the password is the API key
+ */
+export function signInRequired(): Response {
+  return new Response('Sign in with your API key', {
+    status: 401,
+    headers: { 'WWW-Authenticate': 'Basic realm="Claude Code Monitor", charset="UTF-8"' },
+  });
+}
@@ -8,9 +8,19 @@ declare module "@remix-run/node" {
   }
 }
 
+// EMBED_UI=1 builds the dashboard as static files for the Go binary to embed
+// (see proxy/internal/webui). The Go server answers /api itself, so the routes
+// that forward to it are left out.
+const embedUI = process.env.EMBED_UI === "1";
+
 export default defineConfig({
   plugins: [
     remix({
+      ...(embedUI && {
+        ssr: false,
+        buildDirectory: "../proxy/internal/webui/dist",
+        ignoredRouteFiles: ["**/api.*"],
+      }),
       future: {
         v3_fetcherPersist: true,
         v3_relativeSplatPath: true,